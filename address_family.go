@@ -0,0 +1,129 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Address families of EnforceAddressFamilies
+const (
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// AddressFamilyPolicy overrides the country rules for IPv4 or IPv6 clients. Unset fields inherit the global settings.
+type AddressFamilyPolicy struct {
+	DefaultPolicy    string   // "allow" or "block" when no rule matches (empty inherits DefaultAllow)
+	AllowedCountries []string // Replaces AllowedCountries for this family when not empty
+	BlockedCountries []string // Replaces BlockedCountries for this family when not empty
+}
+
+// countryRules are the country lists and default policy applied to one address family
+type countryRules struct {
+	allowed      map[string]struct{}
+	blocked      map[string]struct{}
+	defaultAllow bool
+	blockFirst   bool // BlockedCountries is checked before AllowedCountries
+}
+
+// newCountryRules merges a family policy into the global rules. Returns nil when the policy changes nothing.
+func newCountryRules(option string, policy AddressFamilyPolicy, global countryRules) (*countryRules, error) {
+	if policy.DefaultPolicy == "" && len(policy.AllowedCountries) == 0 && len(policy.BlockedCountries) == 0 {
+		return nil, nil
+	}
+
+	rules := global
+	switch policy.DefaultPolicy {
+	case "":
+	case ErrorPolicyAllow:
+		rules.defaultAllow = true
+	case ErrorPolicyBlock:
+		rules.defaultAllow = false
+	default:
+		return nil, fmt.Errorf("invalid %s.DefaultPolicy %q, must be %q or %q", option, policy.DefaultPolicy, ErrorPolicyAllow, ErrorPolicyBlock)
+	}
+
+	var err error
+	if len(policy.AllowedCountries) > 0 {
+		if rules.allowed, err = countrySet(option+".AllowedCountries", policy.AllowedCountries); err != nil {
+			return nil, err
+		}
+	}
+	if len(policy.BlockedCountries) > 0 {
+		if rules.blocked, err = countrySet(option+".BlockedCountries", policy.BlockedCountries); err != nil {
+			return nil, err
+		}
+	}
+	return &rules, nil
+}
+
+// countryRulesFor returns the rules for the IP's address family. A nil IP gets the global rules.
+func (p Plugin) countryRulesFor(ipAddr net.IP) countryRules {
+	if ipAddr != nil {
+		if ipAddr.To4() != nil {
+			if p.ipv4Rules != nil {
+				return *p.ipv4Rules
+			}
+		} else if p.ipv6Rules != nil {
+			return *p.ipv6Rules
+		}
+	}
+	return countryRules{allowed: p.allowedCountries, blocked: p.blockedCountries, defaultAllow: p.defaultAllow, blockFirst: p.countryBlockFirst}
+}
+
+// check applies the country lists and the default policy to a country code
+func (r countryRules) check(country string) (allow bool, phase string) {
+	_, allowed := r.allowed[country]
+	_, blocked := r.blocked[country]
+	if blocked && (r.blockFirst || !allowed) {
+		return false, PhaseBlockedCountry
+	}
+	if allowed {
+		return true, PhaseAllowedCountry
+	}
+
+	if r.defaultAllow {
+		return true, PhaseDefaultAllow
+	}
+	return false, PhaseDefaultAllow
+}
+
+// validateEnforceAddressFamilies checks EnforceAddressFamilies and returns the family whose blocks are only
+// logged, empty when both are enforced (the default)
+func validateEnforceAddressFamilies(families []string) (string, error) {
+	if len(families) == 0 {
+		return "", nil
+	}
+
+	var ipv4, ipv6 bool
+	for _, family := range families {
+		switch strings.ToLower(strings.TrimSpace(family)) {
+		case AddressFamilyIPv4:
+			ipv4 = true
+		case AddressFamilyIPv6:
+			ipv6 = true
+		default:
+			return "", fmt.Errorf("invalid EnforceAddressFamilies entry %q, must be %q or %q", family, AddressFamilyIPv4, AddressFamilyIPv6)
+		}
+	}
+	switch {
+	case ipv4 && !ipv6:
+		return AddressFamilyIPv6, nil
+	case ipv6 && !ipv4:
+		return AddressFamilyIPv4, nil
+	}
+	return "", nil
+}
+
+// addressFamily returns the family of an IP, empty when it doesn't parse
+func addressFamily(ip string) string {
+	ipAddr := net.ParseIP(ip)
+	switch {
+	case ipAddr == nil:
+		return ""
+	case ipAddr.To4() != nil:
+		return AddressFamilyIPv4
+	}
+	return AddressFamilyIPv6
+}
@@ -0,0 +1,116 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddressFamilyPolicies(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.BlockedCountries = []string{"DE"}
+	cfg.IPv6Policy = AddressFamilyPolicy{
+		DefaultPolicy:    "block",
+		AllowedCountries: []string{"US"},
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		ip      string
+		allowed bool
+		phase   string
+	}{
+		{ip: "1.1.1.1", allowed: true, phase: PhaseDefaultAllow},           // IPv4 keeps DefaultAllow
+		{ip: "85.214.132.1", allowed: false, phase: PhaseBlockedCountry},   // IPv4 keeps BlockedCountries
+		{ip: "2001:4860::8888", allowed: true, phase: PhaseAllowedCountry}, // IPv6 allowed list
+		{ip: "2a00:1450::1", allowed: false, phase: PhaseDefaultAllow},     // IPv6 default block
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			allowed, _, phase, err := plugin.CheckAllowed(tt.ip)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != tt.allowed || phase != tt.phase {
+				t.Errorf("expected allowed=%v phase=%s, got allowed=%v phase=%s", tt.allowed, tt.phase, allowed, phase)
+			}
+		})
+	}
+}
+
+func TestAddressFamilyPolicyValidation(t *testing.T) {
+	if _, err := newCountryRules("IPv4Policy", AddressFamilyPolicy{DefaultPolicy: "maybe"}, countryRules{}); err == nil {
+		t.Error("expected error for an invalid DefaultPolicy")
+	}
+	if rules, err := newCountryRules("IPv4Policy", AddressFamilyPolicy{}, countryRules{}); rules != nil || err != nil {
+		t.Errorf("expected no rules for an empty policy, got %v, %v", rules, err)
+	}
+}
+
+func TestEnforceAddressFamilies(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.EnforceAddressFamilies = []string{"IPv4"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"8.8.8.8", http.StatusForbidden},        // Enforced
+		{"1.1.1.1", http.StatusTeapot},           // Allowed country
+		{"2001:4860::8888", http.StatusTeapot},   // Monitored, the block is only logged
+		{"::ffff:8.8.8.8", http.StatusForbidden}, // IPv4-mapped addresses are IPv4
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", tt.ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.ip, tt.want, rr.Code)
+		}
+	}
+
+	// The decision itself is unchanged
+	if allowed, _, _, _ := plugin.CheckAllowed("2001:4860::8888"); allowed {
+		t.Error("expected the IPv6 decision to stay a block")
+	}
+}
+
+func TestValidateEnforceAddressFamilies(t *testing.T) {
+	tests := []struct {
+		families []string
+		want     string
+		wantErr  bool
+	}{
+		{nil, "", false},
+		{[]string{"ipv4", "ipv6"}, "", false},
+		{[]string{"ipv4"}, AddressFamilyIPv6, false},
+		{[]string{" IPv6 "}, AddressFamilyIPv4, false},
+		{[]string{"ipv5"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := validateEnforceAddressFamilies(tt.families)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("validateEnforceAddressFamilies(%v) = %q, %v; want %q, error %v", tt.families, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
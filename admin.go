@@ -0,0 +1,292 @@
+package traefik_geoblock
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// adminEndpoint serves the plugin's own endpoints under a configured path prefix
+type adminEndpoint struct {
+	path            string
+	token           string              // Bearer token, empty when not required
+	allowedNetworks []*net.IPNet        // Client networks allowed in, empty for any
+	clientCert      bool                // A verified client certificate is required
+	clientCertNames map[string]struct{} // Accepted certificate names, empty for any
+}
+
+// newAdminEndpoint validates the admin settings. Returns nil when no AdminPath is configured.
+func newAdminEndpoint(cfg *Config) (*adminEndpoint, error) {
+	if cfg.AdminPath == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(cfg.AdminPath, "/") {
+		return nil, fmt.Errorf("AdminPath must start with /, got %q", cfg.AdminPath)
+	}
+	if cfg.AdminToken == "" && len(cfg.AdminAllowedCIDRs) == 0 && !cfg.AdminRequireClientCert {
+		return nil, fmt.Errorf("AdminPath requires AdminToken, AdminAllowedCIDRs or AdminRequireClientCert")
+	}
+	if len(cfg.AdminClientCertNames) > 0 && !cfg.AdminRequireClientCert {
+		return nil, fmt.Errorf("AdminClientCertNames requires AdminRequireClientCert")
+	}
+	allowedNetworks, err := parseIPNetworks("AdminAllowedCIDRs", cfg.AdminAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	admin := &adminEndpoint{
+		path:            strings.TrimSuffix(cfg.AdminPath, "/"),
+		token:           cfg.AdminToken,
+		allowedNetworks: allowedNetworks,
+		clientCert:      cfg.AdminRequireClientCert,
+	}
+	if len(cfg.AdminClientCertNames) > 0 {
+		admin.clientCertNames = make(map[string]struct{}, len(cfg.AdminClientCertNames))
+		for _, name := range cfg.AdminClientCertNames {
+			admin.clientCertNames[strings.ToLower(name)] = struct{}{}
+		}
+	}
+	return admin, nil
+}
+
+// route returns the route below the admin path, and whether the request targets the admin path at all
+func (a *adminEndpoint) route(req *http.Request) (string, bool) {
+	if req.URL.Path != a.path && !strings.HasPrefix(req.URL.Path, a.path+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(req.URL.Path, a.path), true
+}
+
+// authorized checks the bearer token in constant time, when one is configured
+func (a *adminEndpoint) authorized(req *http.Request) bool {
+	if a.token == "" {
+		return true
+	}
+	token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// denied returns why the client may not reach the admin endpoint at all, empty when it may.
+// These checks also cover the OpenAPI document, so the endpoint stays invisible outside the allowed networks.
+func (a *adminEndpoint) denied(req *http.Request, clientIP net.IP) string {
+	if len(a.allowedNetworks) > 0 && (clientIP == nil || !containsIP(a.allowedNetworks, clientIP)) {
+		return "client IP not in AdminAllowedCIDRs"
+	}
+	if !a.clientCert {
+		return ""
+	}
+
+	// Traefik's TLS options verify the chain, verified chains are only set when they did
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "verified client certificate required"
+	}
+	if len(a.clientCertNames) == 0 {
+		return ""
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if _, ok := a.clientCertNames[strings.ToLower(cert.Subject.CommonName)]; ok {
+		return ""
+	}
+	for _, name := range cert.DNSNames {
+		if _, ok := a.clientCertNames[strings.ToLower(name)]; ok {
+			return ""
+		}
+	}
+	return "client certificate not in AdminClientCertNames"
+}
+
+// adminClientIP returns the IP AdminAllowedCIDRs apply to: the connection peer, or, when the peer is one of
+// TrustedProxies, the rightmost entry of the IP headers that is not a trusted proxy. Entries on its left were
+// sent by the client and are never used here, and a chain that can't be parsed gives no IP at all.
+func (p Plugin) adminClientIP(req *http.Request) net.IP {
+	peer := net.ParseIP(cleanIPAddress(req.RemoteAddr))
+	if peer == nil || !containsIP(p.trustedProxies, peer) {
+		return peer
+	}
+	if p.ipHeaderPreset != nil {
+		// Presets read headers set by the platform edge, never by the client
+		if ips := presetRemoteIPs(req, p.ipHeaderPreset); len(ips) > 0 {
+			return net.ParseIP(ips[0])
+		}
+		return peer
+	}
+
+	for _, headerName := range p.requestIPHeaders(req) {
+		if headerName == "remoteAddress" {
+			continue
+		}
+		entries := strings.Split(req.Header.Get(headerName), ",")
+		for i := len(entries) - 1; i >= 0; i-- {
+			token, valid := parseIPToken(entries[i])
+			if token == "" {
+				continue
+			}
+			if !valid {
+				return nil
+			}
+			ip := net.ParseIP(token)
+			if !containsIP(p.trustedProxies, ip) {
+				return ip
+			}
+		}
+	}
+	return peer
+}
+
+// serveAdmin handles requests to the admin path. Returns false when the request is not for the admin path.
+func (p Plugin) serveAdmin(rw http.ResponseWriter, req *http.Request) bool {
+	if p.admin == nil {
+		return false
+	}
+	route, ok := p.admin.route(req)
+	if !ok {
+		return false
+	}
+
+	if reason := p.admin.denied(req, p.adminClientIP(req)); reason != "" {
+		p.logger.Warn("admin request denied", "path", req.URL.Path, "remote_addr", req.RemoteAddr, "reason", reason)
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return true
+	}
+
+	if route == adminOpenAPIRoute && req.Method == http.MethodGet {
+		writeAdminJSON(rw, p.admin.openAPI())
+		return true
+	}
+
+	if !p.admin.authorized(req) {
+		p.logger.Warn("unauthorized admin request", "path", req.URL.Path, "remote_addr", req.RemoteAddr)
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="geoblock"`)
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return true
+	}
+
+	switch route {
+	case "/stats/countries":
+		if p.countryStats == nil {
+			http.Error(rw, "country statistics are disabled", http.StatusNotFound)
+			return true
+		}
+		writeAdminJSON(rw, p.countryStats.snapshot())
+	case "/stats/errors":
+		writeAdminJSON(rw, p.ErrorCounts())
+	case "/stats/rules":
+		writeAdminJSON(rw, p.RuleHits())
+	case "/stats/logs":
+		writeAdminJSON(rw, p.LogQueueStats())
+	case "/stats/latency":
+		writeAdminJSON(rw, p.LookupLatency())
+	case "/stats/threatintel":
+		writeAdminJSON(rw, p.ThreatIntelStats())
+	case "/stats/cloudfront":
+		writeAdminJSON(rw, p.CloudFrontStats())
+	case "/offload":
+		p.serveAdminOffload(rw, req)
+	case "/bans":
+		p.serveAdminBans(rw, req)
+	case "/shed":
+		p.serveAdminShed(rw, req)
+	default:
+		http.NotFound(rw, req)
+	}
+	return true
+}
+
+// serveAdminBans lists (GET), adds (POST {"cidr": "...", "ttlSeconds": 3600}) and removes (DELETE ?cidr=...) runtime bans
+func (p Plugin) serveAdminBans(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeAdminJSON(rw, p.DynamicBans())
+	case http.MethodPost:
+		var body struct {
+			CIDR       string `json:"cidr"`
+			TTLSeconds int64  `json:"ttlSeconds"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 4096)).Decode(&body); err != nil {
+			http.Error(rw, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := p.BanIP(body.CIDR, time.Duration(body.TTLSeconds)*time.Second); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		removed, err := p.UnbanIP(req.URL.Query().Get("cidr"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !removed {
+			http.Error(rw, "not banned", http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		rw.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveAdminShed lists (GET), adds (POST {"country": "CN", "ttlSeconds": 600}) and lifts (DELETE ?country=...)
+// load sheds
+func (p Plugin) serveAdminShed(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeAdminJSON(rw, p.LoadSheds())
+	case http.MethodPost:
+		var body struct {
+			Country    string `json:"country"`
+			TTLSeconds int64  `json:"ttlSeconds"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 4096)).Decode(&body); err != nil {
+			http.Error(rw, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := p.ShedCountry(body.Country, time.Duration(body.TTLSeconds)*time.Second); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		removed, err := p.UnshedCountry(req.URL.Query().Get("country"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !removed {
+			http.Error(rw, "not shed", http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		rw.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveAdminOffload returns the offload hints with the serial as ETag, so agents polling with
+// If-None-Match only download them after a change
+func (p Plugin) serveAdminOffload(rw http.ResponseWriter, req *http.Request) {
+	hints := p.OffloadHints()
+	etag := `"` + hints.Serial + `"`
+	rw.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeAdminJSON(rw, hints)
+}
+
+// writeAdminJSON writes an admin response as JSON
+func writeAdminJSON(rw http.ResponseWriter, value interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(rw)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
@@ -0,0 +1,243 @@
+package traefik_geoblock
+
+// adminOpenAPIRoute serves the OpenAPI description of the admin routes, without the bearer token
+// so tools can discover the operations and the auth scheme before being configured
+const adminOpenAPIRoute = "/openapi.json"
+
+// apiObject, apiArray and apiSchemaRef keep the OpenAPI document below readable
+type apiObject map[string]interface{}
+
+func apiArray(items ...interface{}) []interface{} { return items }
+
+func apiSchemaRef(name string) apiObject { return apiObject{"$ref": "#/components/schemas/" + name} }
+
+// apiJSONResponse describes a 200 response with a JSON body
+func apiJSONResponse(description string, schema apiObject) apiObject {
+	return apiObject{"200": apiObject{
+		"description": description,
+		"content":     apiObject{"application/json": apiObject{"schema": schema}},
+	}}
+}
+
+// openAPI returns the OpenAPI 3.0 document of the admin routes served below the admin path
+func (a *adminEndpoint) openAPI() apiObject {
+	count := apiObject{"type": "integer", "format": "int64"}
+	cidrParameter := apiObject{"name": "cidr", "in": "query", "required": true, "schema": apiObject{"type": "string"}, "example": "203.0.113.7"}
+	unauthorized := apiObject{"description": "Missing or wrong bearer token"}
+	forbidden := apiObject{"description": "Client IP or certificate not allowed"}
+	restricted := len(a.allowedNetworks) > 0 || a.clientCert
+
+	withErrors := func(responses apiObject) apiObject {
+		if a.token != "" {
+			responses["401"] = unauthorized
+		}
+		if restricted {
+			responses["403"] = forbidden
+		}
+		return responses
+	}
+
+	security := apiArray()
+	if a.token != "" {
+		security = apiArray(apiObject{"bearerAuth": apiArray()})
+	}
+
+	return apiObject{
+		"openapi": "3.0.3",
+		"info": apiObject{
+			"title":   "traefik-geoblock admin API",
+			"version": "1",
+		},
+		"servers":  apiArray(apiObject{"url": a.path}),
+		"security": security,
+		"paths": apiObject{
+			"/stats/countries": apiObject{"get": apiObject{
+				"summary":   "Per-country request and block counters",
+				"responses": withErrors(apiJSONResponse("Country statistics ring", apiSchemaRef("CountryStatsSnapshot"))),
+			}},
+			"/stats/errors": apiObject{"get": apiObject{
+				"summary":   "Error policy counters",
+				"responses": withErrors(apiJSONResponse("Error counters", apiSchemaRef("ErrorCounts"))),
+			}},
+			"/stats/rules": apiObject{"get": apiObject{
+				"summary":   "Hit counters of the allowed and blocked IP blocks",
+				"responses": withErrors(apiJSONResponse("Rule hit counters, most hits first", apiSchemaRef("RuleHitCounts"))),
+			}},
+			"/stats/logs": apiObject{"get": apiObject{
+				"summary":   "Asynchronous log queue counters",
+				"responses": withErrors(apiJSONResponse("Log queue state", apiSchemaRef("LogQueueStats"))),
+			}},
+			"/stats/latency": apiObject{"get": apiObject{
+				"summary":   "Database lookup latency percentiles since startup",
+				"responses": withErrors(apiJSONResponse("Lookup latency", apiSchemaRef("LookupLatency"))),
+			}},
+			"/stats/threatintel": apiObject{"get": apiObject{
+				"summary":   "Threat intelligence ingestion counters",
+				"responses": withErrors(apiJSONResponse("Ingestion state", apiSchemaRef("ThreatIntelStats"))),
+			}},
+			"/stats/cloudfront": apiObject{"get": apiObject{
+				"summary":   "CloudFront range refresh counters",
+				"responses": withErrors(apiJSONResponse("Refresh state", apiSchemaRef("CloudFrontStats"))),
+			}},
+			"/offload": apiObject{"get": apiObject{
+				"summary": "Aggregated per-CIDR verdicts for XDP/eBPF agents",
+				"parameters": apiArray(apiObject{"name": "If-None-Match", "in": "header", "schema": apiObject{"type": "string"},
+					"description": "ETag of the last response, answered with 304 while the serial is unchanged"}),
+				"responses": withErrors(apiJSONResponse("Offload hints", apiSchemaRef("OffloadHints"))),
+			}},
+			"/bans": apiObject{
+				"get": apiObject{
+					"summary":   "List runtime bans",
+					"responses": withErrors(apiJSONResponse("Active bans", apiObject{"type": "array", "items": apiSchemaRef("DynamicBan")})),
+				},
+				"post": apiObject{
+					"summary": "Ban an IP or CIDR",
+					"requestBody": apiObject{
+						"required": true,
+						"content": apiObject{"application/json": apiObject{"schema": apiObject{
+							"type":     "object",
+							"required": apiArray("cidr"),
+							"properties": apiObject{
+								"cidr":       apiObject{"type": "string", "example": "203.0.113.7"},
+								"ttlSeconds": apiObject{"type": "integer", "format": "int64", "description": "0 bans permanently"},
+							},
+						}}},
+					},
+					"responses": withErrors(apiObject{
+						"204": apiObject{"description": "Banned"},
+						"400": apiObject{"description": "Invalid body or CIDR"},
+					}),
+				},
+				"delete": apiObject{
+					"summary":    "Remove a runtime ban",
+					"parameters": apiArray(cidrParameter),
+					"responses": withErrors(apiObject{
+						"204": apiObject{"description": "Ban removed"},
+						"400": apiObject{"description": "Invalid CIDR"},
+						"404": apiObject{"description": "Not banned"},
+					}),
+				},
+			},
+			"/shed": apiObject{
+				"get": apiObject{
+					"summary":   "List shed countries",
+					"responses": withErrors(apiJSONResponse("Active sheds", apiObject{"type": "array", "items": apiSchemaRef("LoadShed")})),
+				},
+				"post": apiObject{
+					"summary": "Answer a country or group with 503 and Retry-After for a while",
+					"requestBody": apiObject{
+						"required": true,
+						"content": apiObject{"application/json": apiObject{"schema": apiObject{
+							"type":     "object",
+							"required": apiArray("country", "ttlSeconds"),
+							"properties": apiObject{
+								"country":    apiObject{"type": "string", "example": "CN"},
+								"ttlSeconds": apiObject{"type": "integer", "format": "int64", "description": "At most LoadShedMaxSeconds"},
+							},
+						}}},
+					},
+					"responses": withErrors(apiObject{
+						"204": apiObject{"description": "Shed"},
+						"400": apiObject{"description": "Invalid body, country or duration"},
+					}),
+				},
+				"delete": apiObject{
+					"summary":    "Lift a shed before it expires",
+					"parameters": apiArray(apiObject{"name": "country", "in": "query", "required": true, "schema": apiObject{"type": "string"}, "example": "CN"}),
+					"responses": withErrors(apiObject{
+						"204": apiObject{"description": "Shed lifted"},
+						"400": apiObject{"description": "Invalid country"},
+						"404": apiObject{"description": "Not shed"},
+					}),
+				},
+			},
+			adminOpenAPIRoute: apiObject{"get": apiObject{
+				"summary":   "This document",
+				"security":  apiArray(),
+				"responses": apiJSONResponse("OpenAPI document", apiObject{"type": "object"}),
+			}},
+		},
+		"components": apiObject{
+			"securitySchemes": apiObject{
+				"bearerAuth": apiObject{"type": "http", "scheme": "bearer", "description": "The configured AdminToken"},
+			},
+			"schemas": apiObject{
+				"CountryCount": apiObject{"type": "object", "properties": apiObject{
+					"requests": count,
+					"blocked":  count,
+				}},
+				"CountryStatsSnapshot": apiObject{"type": "object", "properties": apiObject{
+					"bucketSeconds": apiObject{"type": "integer"},
+					"sampleRate":    apiObject{"type": "integer"},
+					"buckets": apiObject{"type": "array", "items": apiObject{"type": "object", "properties": apiObject{
+						"start":     apiObject{"type": "string", "format": "date-time"},
+						"countries": apiObject{"type": "object", "additionalProperties": apiSchemaRef("CountryCount")},
+					}}},
+					"totals": apiObject{"type": "object", "additionalProperties": apiSchemaRef("CountryCount")},
+				}},
+				"ErrorCounts": apiObject{"type": "object", "properties": apiObject{
+					"parseErrors":   count,
+					"lookupErrors":  count,
+					"emptyHeaders":  count,
+					"skippedTokens": count,
+				}},
+				"CIDRHits": apiObject{"type": "object", "properties": apiObject{
+					"cidr": apiObject{"type": "string"},
+					"hits": count,
+				}},
+				"RuleHitCounts": apiObject{"type": "object", "properties": apiObject{
+					"allowedIPBlocks": apiObject{"type": "array", "items": apiSchemaRef("CIDRHits")},
+					"blockedIPBlocks": apiObject{"type": "array", "items": apiSchemaRef("CIDRHits")},
+				}},
+				"LogQueueStats": apiObject{"type": "object", "properties": apiObject{
+					"enabled":  apiObject{"type": "boolean"},
+					"queued":   apiObject{"type": "integer"},
+					"capacity": apiObject{"type": "integer"},
+					"written":  count,
+					"dropped":  count,
+				}},
+				"LookupLatency": apiObject{"type": "object", "properties": apiObject{
+					"enabled":   apiObject{"type": "boolean", "description": "False with an injected Lookuper"},
+					"count":     count,
+					"p50Micros": apiObject{"type": "integer"},
+					"p95Micros": apiObject{"type": "integer"},
+					"p99Micros": apiObject{"type": "integer"},
+					"maxMicros": apiObject{"type": "integer"},
+				}},
+				"ThreatIntelStats": apiObject{"type": "object", "properties": apiObject{
+					"enabled":     apiObject{"type": "boolean"},
+					"indicators":  apiObject{"type": "integer", "description": "Indicators currently blocked"},
+					"ingested":    apiObject{"type": "integer"},
+					"expired":     apiObject{"type": "integer"},
+					"skipped":     apiObject{"type": "integer"},
+					"refreshes":   count,
+					"failures":    count,
+					"lastRefresh": apiObject{"type": "string", "format": "date-time"},
+					"lastError":   apiObject{"type": "string"},
+				}},
+				"CloudFrontStats": apiObject{"type": "object", "properties": apiObject{
+					"enabled":     apiObject{"type": "boolean"},
+					"ranges":      apiObject{"type": "integer", "description": "0 until the first successful refresh"},
+					"refreshes":   count,
+					"failures":    count,
+					"lastRefresh": apiObject{"type": "string", "format": "date-time"},
+					"lastError":   apiObject{"type": "string"},
+				}},
+				"OffloadHints": apiObject{"type": "object", "properties": apiObject{
+					"serial": apiObject{"type": "string", "description": "Changes whenever the content does, also sent as ETag"},
+					"bans":   apiObject{"type": "array", "items": apiSchemaRef("DynamicBan")},
+					"allow":  apiObject{"type": "array", "items": apiObject{"type": "string"}},
+					"drop":   apiObject{"type": "array", "items": apiObject{"type": "string"}},
+				}},
+				"DynamicBan": apiObject{"type": "object", "properties": apiObject{
+					"cidr":    apiObject{"type": "string"},
+					"expires": apiObject{"type": "string", "format": "date-time", "description": "Zero time for permanent bans"},
+				}},
+				"LoadShed": apiObject{"type": "object", "properties": apiObject{
+					"country": apiObject{"type": "string"},
+					"expires": apiObject{"type": "string", "format": "date-time"},
+				}},
+			},
+		},
+	}
+}
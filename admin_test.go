@@ -0,0 +1,238 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminCountryStats(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.IPHeaders = []string{"x-real-ip"}
+	cfg.CountryStats = true
+	cfg.AdminPath = "/.geoblock/"
+	cfg.AdminToken = "s3cret"
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2", "8.8.8.8"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	admin := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Real-IP", "8.8.8.8") // Blocked country, admin access relies on the token
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		for _, token := range []string{"", "wrong"} {
+			if rr := admin("/.geoblock/stats/countries", token); rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		}
+	})
+
+	t.Run("CountryStats", func(t *testing.T) {
+		rr := admin("/.geoblock/stats/countries", "s3cret")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var snapshot CountryStatsSnapshot
+		if err := json.Unmarshal(rr.Body.Bytes(), &snapshot); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+		if got := snapshot.Totals["AU"]; got.Requests != 2 || got.Blocked != 0 {
+			t.Errorf("unexpected AU counters %+v", got)
+		}
+		if got := snapshot.Totals["US"]; got.Requests != 1 || got.Blocked != 1 {
+			t.Errorf("unexpected US counters %+v", got)
+		}
+	})
+
+	t.Run("OpenAPI", func(t *testing.T) {
+		rr := admin("/.geoblock/openapi.json", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected the description without a token, got status %d", rr.Code)
+		}
+		var spec struct {
+			Servers []struct {
+				URL string `json:"url"`
+			} `json:"servers"`
+			Paths      map[string]map[string]json.RawMessage `json:"paths"`
+			Components struct {
+				SecuritySchemes map[string]struct {
+					Type   string `json:"type"`
+					Scheme string `json:"scheme"`
+				} `json:"securitySchemes"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+		if len(spec.Servers) != 1 || spec.Servers[0].URL != "/.geoblock" {
+			t.Errorf("expected the admin path as server, got %+v", spec.Servers)
+		}
+		if scheme := spec.Components.SecuritySchemes["bearerAuth"]; scheme.Type != "http" || scheme.Scheme != "bearer" {
+			t.Errorf("expected a bearer auth scheme, got %+v", scheme)
+		}
+		for _, route := range []string{"/stats/countries", "/stats/errors", "/stats/rules", "/stats/logs", "/stats/latency", "/stats/threatintel", "/stats/cloudfront", "/offload", "/bans"} {
+			if _, ok := spec.Paths[route]["get"]; !ok {
+				t.Errorf("expected GET %s to be described", route)
+			}
+		}
+		if _, ok := spec.Paths["/bans"]["delete"]; !ok {
+			t.Error("expected DELETE /bans to be described")
+		}
+	})
+
+	t.Run("UnknownRoute", func(t *testing.T) {
+		if rr := admin("/.geoblock/unknown", "s3cret"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("SimilarPrefixIsNotAdmin", func(t *testing.T) {
+		if rr := admin("/.geoblockish", "s3cret"); rr.Code != http.StatusForbidden {
+			t.Errorf("expected regular geoblocking, got status %d", rr.Code)
+		}
+	})
+}
+
+func TestAdminAccessRestrictions(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.AdminPath = "/.geoblock"
+	cfg.AdminAllowedCIDRs = []string{"10.0.0.0/8"}
+	cfg.TrustedProxies = []string{"192.0.2.1", "192.0.2.2"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		xff        string
+		want       int
+	}{
+		{"AllowedPeer", "10.1.2.3:1234", "", "", http.StatusOK},
+		{"OtherPeer", "198.51.100.7:1234", "", "", http.StatusForbidden},
+		{"AllowedCountryStillDenied", "198.51.100.7:1234", "1.1.1.1", "", http.StatusForbidden},
+		{"SpoofedHeader", "198.51.100.7:1234", "10.1.2.3", "", http.StatusForbidden},
+		{"TrustedProxy", "192.0.2.1:1234", "10.1.2.3", "", http.StatusOK},
+		{"TrustedProxyOtherClient", "192.0.2.1:1234", "1.1.1.1", "", http.StatusForbidden},
+		{"TrustedProxyChain", "192.0.2.1:1234", "", "198.51.100.7, 10.1.2.3, 192.0.2.2", http.StatusOK},
+		{"SpoofedLeftmostForwardedFor", "192.0.2.1:1234", "", "10.1.2.3, 198.51.100.7", http.StatusForbidden},
+		{"SpoofedForwardedForBeforeRealIP", "192.0.2.1:1234", "10.1.2.3", "10.1.2.3, 198.51.100.7", http.StatusForbidden},
+		{"InvalidForwardedFor", "192.0.2.1:1234", "", "10.1.2.3, not-an-ip", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/.geoblock/stats/errors", "/.geoblock/openapi.json"} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.RemoteAddr = tt.remoteAddr
+				if tt.realIP != "" {
+					req.Header.Set("X-Real-IP", tt.realIP)
+				}
+				if tt.xff != "" {
+					req.Header.Set("X-Forwarded-For", tt.xff)
+				}
+				rr := httptest.NewRecorder()
+				plugin.ServeHTTP(rr, req)
+				if rr.Code != tt.want {
+					t.Errorf("%s: expected status %d, got %d", path, tt.want, rr.Code)
+				}
+			}
+		})
+	}
+
+	t.Run("OpenAPIWithoutToken", func(t *testing.T) {
+		spec := plugin.admin.openAPI()
+		if security := spec["security"].([]interface{}); len(security) != 0 {
+			t.Errorf("expected no bearer requirement without AdminToken, got %v", security)
+		}
+	})
+}
+
+func TestAdminClientCertificate(t *testing.T) {
+	admin, err := newAdminEndpoint(&Config{
+		AdminPath:              "/.geoblock",
+		AdminRequireClientCert: true,
+		AdminClientCertNames:   []string{"ops.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	withCert := func(cert *x509.Certificate) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/.geoblock/stats/errors", nil)
+		req.TLS = &tls.ConnectionState{}
+		if cert != nil {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		allowed bool
+	}{
+		{"PlainHTTP", httptest.NewRequest(http.MethodGet, "/.geoblock/stats/errors", nil), false},
+		{"Unverified", withCert(nil), false},
+		{"CommonName", withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "OPS.example.com"}}), true},
+		{"DNSName", withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "x"}, DNSNames: []string{"ops.example.com"}}), true},
+		{"OtherName", withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "dev.example.com"}}), false},
+	}
+	for _, tt := range tests {
+		if reason := admin.denied(tt.req, nil); (reason == "") != tt.allowed {
+			t.Errorf("%s: expected allowed=%v, got %q", tt.name, tt.allowed, reason)
+		}
+	}
+}
+
+func TestAdminEndpointValidation(t *testing.T) {
+	if _, err := newAdminEndpoint(&Config{AdminPath: "/.geoblock"}); err == nil {
+		t.Error("expected error without AdminToken, AdminAllowedCIDRs or AdminRequireClientCert")
+	}
+	if _, err := newAdminEndpoint(&Config{AdminPath: "/.geoblock", AdminAllowedCIDRs: []string{"10.0.0.0/8"}}); err != nil {
+		t.Errorf("expected AdminAllowedCIDRs to be enough, got %v", err)
+	}
+	if _, err := newAdminEndpoint(&Config{AdminPath: "/.geoblock", AdminToken: "x", AdminAllowedCIDRs: []string{"nope"}}); err == nil {
+		t.Error("expected error for an invalid AdminAllowedCIDRs entry")
+	}
+	if _, err := newAdminEndpoint(&Config{AdminPath: "/.geoblock", AdminToken: "x", AdminClientCertNames: []string{"ops"}}); err == nil {
+		t.Error("expected error for AdminClientCertNames without AdminRequireClientCert")
+	}
+	if _, err := newAdminEndpoint(&Config{AdminPath: "geoblock", AdminToken: "x"}); err == nil {
+		t.Error("expected error for a relative AdminPath")
+	}
+	if a, err := newAdminEndpoint(&Config{}); a != nil || err != nil {
+		t.Errorf("expected admin endpoint to be disabled, got %v, %v", a, err)
+	}
+}
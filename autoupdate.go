@@ -8,9 +8,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// inProcessUpdateMutex replaces the update lock file when NoLocalCopy is set
+var inProcessUpdateMutex sync.Mutex
+
 const (
 	liteDownloadURL  = "https://download.ip2location.com/lite/IP2LOCATION-LITE-DB1.IPV6.BIN.ZIP"
 	tokenDownloadURL = "https://www.ip2location.com/download?token=%s&file=%s" // #nosec G101
@@ -19,6 +25,11 @@ const (
 // UpdateIfNeeded checks if the database needs updating and performs the update if necessary.
 // If runSync is true, the update will be performed synchronously, otherwise it runs in background.
 func UpdateIfNeeded(dbPath string, runSync bool, logger *slog.Logger, config *Config) error {
+	return updateIfNeeded(dbPath, runSync, logger, config, systemClock{})
+}
+
+// updateIfNeeded is UpdateIfNeeded with the database age measured against clock
+func updateIfNeeded(dbPath string, runSync bool, logger *slog.Logger, config *Config, clock Clock) error {
 	var performUpdate bool
 	if dbPath == "" {
 		// Empty path means we need to update
@@ -29,7 +40,7 @@ func UpdateIfNeeded(dbPath string, runSync bool, logger *slog.Logger, config *Co
 		if err != nil {
 			logger.Warn("cannot determine database age", "error", err)
 			performUpdate = true
-		} else if time.Since(dbDate) > 30*24*time.Hour {
+		} else if clock.Now().Sub(dbDate) > 30*24*time.Hour {
 			// Database is older than a month, update
 			logger.Info("database is older than 30 days, updating", "sync", runSync)
 			performUpdate = true
@@ -41,12 +52,12 @@ func UpdateIfNeeded(dbPath string, runSync bool, logger *slog.Logger, config *Co
 	}
 
 	if runSync {
-		return downloadAndUpdateDatabase(config, logger)
+		return downloadAndUpdateDatabase(config, logger, clock)
 	}
 
 	// Run update asynchronously
 	go func() {
-		if err := downloadAndUpdateDatabase(config, logger); err != nil {
+		if err := downloadAndUpdateDatabase(config, logger, clock); err != nil {
 			logger.Error("async database update failed", "error", err)
 		}
 	}()
@@ -54,6 +65,64 @@ func UpdateIfNeeded(dbPath string, runSync bool, logger *slog.Logger, config *Co
 	return nil
 }
 
+// maxDatabaseCode is the highest IP2Location product code, DB1 to DB26
+const maxDatabaseCode = 26
+
+// validateAutoUpdate rejects auto-update settings that would only fail at the first update, hours after
+// startup, with a suggested fix. Settings that have no effect without DatabaseAutoUpdate are logged.
+func validateAutoUpdate(config *DatabaseConfig, logger *slog.Logger) error {
+	if config.DatabaseAutoUpdateToken != "" && config.DatabaseAutoUpdateDir == "" {
+		return fmt.Errorf("DatabaseAutoUpdateToken is set but DatabaseAutoUpdateDir is empty: " +
+			"set DatabaseAutoUpdateDir to a writable directory where downloaded databases are kept")
+	}
+	if !config.DatabaseAutoUpdate {
+		if config.DatabaseAutoUpdateToken != "" {
+			logger.Warn("DatabaseAutoUpdateToken has no effect, set DatabaseAutoUpdate to true to download updates")
+		}
+		if config.DatabaseAutoUpdateWindow != "" {
+			logger.Warn("DatabaseAutoUpdateWindow has no effect, set DatabaseAutoUpdate to true to download updates")
+		}
+		return nil
+	}
+
+	code := config.DatabaseAutoUpdateCode
+	if code != "" {
+		number, err := strconv.Atoi(strings.TrimPrefix(code, "DB"))
+		if err != nil || !strings.HasPrefix(code, "DB") || number < 1 || number > maxDatabaseCode {
+			return fmt.Errorf("invalid DatabaseAutoUpdateCode %q, must be DB1 to DB%d%s", code, maxDatabaseCode, databaseCodeHint(code))
+		}
+	}
+	if code != "" && code != "DB1" && config.DatabaseAutoUpdateToken == "" {
+		return fmt.Errorf("DatabaseAutoUpdateCode %s requires DatabaseAutoUpdateToken: without a token only the free "+
+			"DB1 LITE database is downloaded, set the token of your IP2Location account or use DB1", code)
+	}
+
+	// Without a directory the configured database is used as is, see handleAutoUpdateInit
+	if config.DatabaseAutoUpdateDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(config.DatabaseAutoUpdateDir, 0755); err != nil {
+		return fmt.Errorf("DatabaseAutoUpdateDir %s cannot be created: %w (mount a writable volume there or choose another directory)",
+			config.DatabaseAutoUpdateDir, err)
+	}
+	if err := validateLocalCopyDir(config.DatabaseAutoUpdateDir); err != nil {
+		return fmt.Errorf("invalid DatabaseAutoUpdateDir: %w (downloads are written there, mount it read-write or choose another directory)", err)
+	}
+	return nil
+}
+
+// databaseCodeHint suggests the code a typo was meant to be, e.g. "db11" or "11" for DB11
+func databaseCodeHint(code string) string {
+	upper := strings.ToUpper(strings.TrimSpace(code))
+	if !strings.HasPrefix(upper, "DB") {
+		upper = "DB" + upper
+	}
+	if number, err := strconv.Atoi(strings.TrimPrefix(upper, "DB")); err == nil && number >= 1 && number <= maxDatabaseCode {
+		return fmt.Sprintf(", did you mean %s?", upper)
+	}
+	return ""
+}
+
 // findLatestDatabase finds the most recent database file in the specified directory
 func findLatestDatabase(dir string, dbCode string) (string, error) {
 	if dbCode == "" {
@@ -87,7 +156,7 @@ func findLatestDatabase(dir string, dbCode string) (string, error) {
 	return latest, nil
 }
 
-func downloadAndUpdateDatabase(cfg *Config, logger *slog.Logger) error {
+func downloadAndUpdateDatabase(cfg *Config, logger *slog.Logger, clock Clock) error {
 	dbCode := cfg.DatabaseAutoUpdateCode
 	if dbCode == "" {
 		dbCode = "DB1"
@@ -98,12 +167,22 @@ func downloadAndUpdateDatabase(cfg *Config, logger *slog.Logger) error {
 		return fmt.Errorf("failed to create database directory: %w", err)
 	}
 
+	// Without lock files, updates are only serialized within this process
+	if cfg.NoLocalCopy {
+		if !inProcessUpdateMutex.TryLock() {
+			logger.Debug("another update is in progress in this process")
+			return nil
+		}
+		defer inProcessUpdateMutex.Unlock()
+		return downloadDatabase(cfg, logger, dbCode)
+	}
+
 	// Create lock file
 	lockFile := filepath.Join(cfg.DatabaseAutoUpdateDir, "update.lock")
 
 	// Check if lock file exists and its age
 	if fi, err := os.Stat(lockFile); err == nil {
-		age := time.Since(fi.ModTime())
+		age := clock.Now().Sub(fi.ModTime())
 		if age < time.Hour {
 			logger.Debug("another update is in progress (lock file: %s, age: %s)", lockFile, age)
 			return nil
@@ -124,6 +203,11 @@ func downloadAndUpdateDatabase(cfg *Config, logger *slog.Logger) error {
 		os.Remove(lockFile)
 	}()
 
+	return downloadDatabase(cfg, logger, dbCode)
+}
+
+// downloadDatabase downloads and extracts the database into DatabaseAutoUpdateDir, named after its version date
+func downloadDatabase(cfg *Config, logger *slog.Logger, dbCode string) error {
 	// Create temporary directory
 	tmpDir, err := os.MkdirTemp(cfg.DatabaseAutoUpdateDir, "ip2location-*")
 	if err != nil {
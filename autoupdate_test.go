@@ -1,6 +1,7 @@
 package traefik_geoblock
 
 import (
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -77,7 +78,7 @@ func TestPlugin_DatabaseDownloadAndUpdate(t *testing.T) {
 			})).With("plugin", "test")
 
 			// Test database update
-			err := downloadAndUpdateDatabase(tt.config, logger)
+			err := downloadAndUpdateDatabase(tt.config, logger, systemClock{})
 
 			// Check error conditions
 			if tt.wantErr {
@@ -252,6 +253,43 @@ func TestFindLatestDatabase(t *testing.T) {
 	}
 }
 
+func TestValidateAutoUpdate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(file, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  DatabaseConfig
+		wantErr string
+	}{
+		{"Disabled", DatabaseConfig{DatabaseAutoUpdateCode: "DB1"}, ""},
+		{"Lite", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: filepath.Join(dir, "new"), DatabaseAutoUpdateCode: "DB1"}, ""},
+		{"Premium", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: dir, DatabaseAutoUpdateToken: "t", DatabaseAutoUpdateCode: "DB26"}, ""},
+		{"TokenWithoutDir", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateToken: "t"}, "set DatabaseAutoUpdateDir"},
+		{"TokenWithoutDirDisabled", DatabaseConfig{DatabaseAutoUpdateToken: "t"}, "set DatabaseAutoUpdateDir"},
+		{"UnknownCode", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: dir, DatabaseAutoUpdateCode: "DB27"}, "must be DB1 to DB26"},
+		{"LowercaseCode", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: dir, DatabaseAutoUpdateCode: "db11"}, "did you mean DB11?"},
+		{"NumberOnly", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: dir, DatabaseAutoUpdateCode: "3"}, "did you mean DB3?"},
+		{"PremiumWithoutToken", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: dir, DatabaseAutoUpdateCode: "DB11"}, "requires DatabaseAutoUpdateToken"},
+		{"DirUnderFile", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: filepath.Join(file, "sub")}, "cannot be created"},
+		{"DirIsFile", DatabaseConfig{DatabaseAutoUpdate: true, DatabaseAutoUpdateDir: file}, "not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAutoUpdate(&tt.config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestDatabaseDirectoryIsCreatedAndDatabaseDownloaded(t *testing.T) {
 	// Create a temporary base directory for testing
 	tempBase := t.TempDir()
@@ -274,7 +312,7 @@ func TestDatabaseDirectoryIsCreatedAndDatabaseDownloaded(t *testing.T) {
 		t.Fatalf("directory should not exist before test: %v", err)
 	}
 
-	err := downloadAndUpdateDatabase(cfg, logger)
+	err := downloadAndUpdateDatabase(cfg, logger, systemClock{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -0,0 +1,207 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Firewall formats of the ban export
+const (
+	BanExportFormatIPSet    = "ipset"    // Input for "ipset restore"
+	BanExportFormatNftables = "nftables" // Input for "nft -f"
+)
+
+// banExporter periodically writes the active dynamic bans to a file a firewall in front of Traefik
+// loads, so banned clients are dropped before reaching HTTP
+type banExporter struct {
+	file string
+
+	mu        sync.Mutex
+	blocklist *dynamicBlocklist
+	format    string
+	set       string
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+var (
+	// banExporters keeps one export loop per file across configuration reloads, the latest
+	// plugin instance provides the blocklist and the settings
+	banExporters      = make(map[string]*banExporter)
+	banExportersMutex sync.Mutex
+)
+
+// startBanExport validates the ban export settings and starts the export loop of the file, or hands
+// the running loop the new blocklist and settings. Does nothing when BanExportFile is empty.
+func startBanExport(cfg *Config, blocklist *dynamicBlocklist, logger *slog.Logger) error {
+	if cfg.BanExportFile == "" {
+		return nil
+	}
+
+	format := strings.ToLower(cfg.BanExportFormat)
+	switch format {
+	case "":
+		format = BanExportFormatIPSet
+	case BanExportFormatIPSet, BanExportFormatNftables:
+	default:
+		return fmt.Errorf("invalid BanExportFormat %q, must be one of: %s, %s", cfg.BanExportFormat, BanExportFormatIPSet, BanExportFormatNftables)
+	}
+	set := cfg.BanExportSetName
+	if set == "" {
+		set = "geoblock"
+	}
+	if !validSetName(set) {
+		return fmt.Errorf("invalid BanExportSetName %q, use up to 30 letters, digits, '_' or '-'", set)
+	}
+	if cfg.BanExportIntervalSeconds <= 0 {
+		return fmt.Errorf("BanExportIntervalSeconds must be positive, got %d", cfg.BanExportIntervalSeconds)
+	}
+	interval := time.Duration(cfg.BanExportIntervalSeconds) * time.Second
+
+	banExportersMutex.Lock()
+	defer banExportersMutex.Unlock()
+
+	exporter, running := banExporters[cfg.BanExportFile]
+	if !running {
+		exporter = &banExporter{file: cfg.BanExportFile}
+		banExporters[cfg.BanExportFile] = exporter
+	}
+	exporter.mu.Lock()
+	exporter.blocklist, exporter.format, exporter.set, exporter.interval, exporter.logger = blocklist, format, set, interval, logger
+	exporter.mu.Unlock()
+
+	if !running {
+		go exporter.loop()
+	}
+	return nil
+}
+
+// validSetName checks a name for both ipset (31 characters at most) and nftables, leaving room for the family suffix
+func validSetName(name string) bool {
+	if name == "" || len(name) > 30 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// loop exports the bans now and after every interval
+func (e *banExporter) loop() {
+	for {
+		time.Sleep(e.export(time.Now()))
+	}
+}
+
+// export writes the file once and returns the time to wait before the next export
+func (e *banExporter) export(now time.Time) time.Duration {
+	e.mu.Lock()
+	blocklist, format, set, interval, logger := e.blocklist, e.format, e.set, e.interval, e.logger
+	e.mu.Unlock()
+
+	content := renderBanExport(blocklist.list(), format, set, now)
+	if err := writeFileAtomic(e.file, []byte(content)); err != nil {
+		logger.Warn("failed to export bans", "file", e.file, "error", err)
+	}
+	return interval
+}
+
+// renderBanExport formats the bans as one IPv4 set "<set>4" and one IPv6 set "<set>6", replacing
+// their content. Bans inside another ban are left out, nftables rejects overlapping intervals;
+// they are exported again once the wider ban expired.
+func renderBanExport(bans []DynamicBan, format, set string, now time.Time) string {
+	type entry struct {
+		cidr    string
+		timeout int64 // Remaining seconds, 0 for permanent bans
+	}
+	var v4, v6 []entry
+	var networks []*net.IPNet
+	for _, ban := range bans {
+		if _, network, err := net.ParseCIDR(ban.CIDR); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	for _, ban := range bans {
+		ip, network, err := net.ParseCIDR(ban.CIDR)
+		if err != nil || coveredByWiderBan(network, networks) {
+			continue
+		}
+		var timeout int64
+		if !ban.Expires.IsZero() {
+			timeout = int64(ban.Expires.Sub(now).Seconds())
+			if timeout <= 0 {
+				continue
+			}
+		}
+		if ip.To4() != nil {
+			v4 = append(v4, entry{ban.CIDR, timeout})
+		} else {
+			v6 = append(v6, entry{ban.CIDR, timeout})
+		}
+	}
+
+	var out strings.Builder
+	families := []struct {
+		set     string
+		entries []entry
+		ipset   string
+		nft     string
+	}{
+		{set + "4", v4, "inet", "ipv4_addr"},
+		{set + "6", v6, "inet6", "ipv6_addr"},
+	}
+	switch format {
+	case BanExportFormatNftables:
+		fmt.Fprintf(&out, "add table inet %s\n", set)
+		for _, family := range families {
+			fmt.Fprintf(&out, "add set inet %s %s { type %s; flags interval, timeout; }\n", set, family.set, family.nft)
+			fmt.Fprintf(&out, "flush set inet %s %s\n", set, family.set)
+			if len(family.entries) == 0 {
+				continue
+			}
+			elements := make([]string, 0, len(family.entries))
+			for _, e := range family.entries {
+				if e.timeout > 0 {
+					elements = append(elements, fmt.Sprintf("%s timeout %ds", e.cidr, e.timeout))
+				} else {
+					elements = append(elements, e.cidr)
+				}
+			}
+			fmt.Fprintf(&out, "add element inet %s %s { %s }\n", set, family.set, strings.Join(elements, ", "))
+		}
+	default:
+		for _, family := range families {
+			// timeout 0 enables per-entry timeouts, entries without one never expire
+			fmt.Fprintf(&out, "create %s hash:net family %s timeout 0 -exist\n", family.set, family.ipset)
+			fmt.Fprintf(&out, "flush %s\n", family.set)
+			for _, e := range family.entries {
+				if e.timeout > 0 {
+					fmt.Fprintf(&out, "add %s %s timeout %d\n", family.set, e.cidr, e.timeout)
+				} else {
+					fmt.Fprintf(&out, "add %s %s\n", family.set, e.cidr)
+				}
+			}
+		}
+	}
+	return out.String()
+}
+
+// coveredByWiderBan reports whether another ban contains the network
+func coveredByWiderBan(network *net.IPNet, networks []*net.IPNet) bool {
+	ones, _ := network.Mask.Size()
+	for _, other := range networks {
+		otherOnes, _ := other.Mask.Size()
+		if otherOnes < ones && len(other.IP) == len(network.IP) && other.Contains(network.IP) {
+			return true
+		}
+	}
+	return false
+}
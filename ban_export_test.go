@@ -0,0 +1,86 @@
+package traefik_geoblock
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderBanExport(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	bans := []DynamicBan{
+		{CIDR: "10.0.0.0/8", Expires: now.Add(time.Hour)},
+		{CIDR: "10.1.2.3/32"}, // Inside 10.0.0.0/8
+		{CIDR: "2001:db8::1/128"},
+		{CIDR: "203.0.113.7/32", Expires: now.Add(90 * time.Second)},
+	}
+
+	ipset := renderBanExport(bans, BanExportFormatIPSet, "geoblock", now)
+	for _, want := range []string{
+		"create geoblock4 hash:net family inet timeout 0 -exist\nflush geoblock4\n",
+		"add geoblock4 10.0.0.0/8 timeout 3600\n",
+		"add geoblock4 203.0.113.7/32 timeout 90\n",
+		"create geoblock6 hash:net family inet6 timeout 0 -exist\nflush geoblock6\nadd geoblock6 2001:db8::1/128\n",
+	} {
+		if !strings.Contains(ipset, want) {
+			t.Errorf("expected the ipset export to contain %q, got:\n%s", want, ipset)
+		}
+	}
+	if strings.Contains(ipset, "10.1.2.3") {
+		t.Error("expected the ban inside 10.0.0.0/8 to be left out")
+	}
+
+	nft := renderBanExport(bans, BanExportFormatNftables, "geoblock", now)
+	for _, want := range []string{
+		"add table inet geoblock\n",
+		"add set inet geoblock geoblock4 { type ipv4_addr; flags interval, timeout; }\nflush set inet geoblock geoblock4\n",
+		"add element inet geoblock geoblock4 { 10.0.0.0/8 timeout 3600s, 203.0.113.7/32 timeout 90s }\n",
+		"add element inet geoblock geoblock6 { 2001:db8::1/128 }\n",
+	} {
+		if !strings.Contains(nft, want) {
+			t.Errorf("expected the nftables export to contain %q, got:\n%s", want, nft)
+		}
+	}
+
+	// Empty sets are flushed without an empty element list, which nft rejects
+	if empty := renderBanExport(nil, BanExportFormatNftables, "geoblock", now); strings.Contains(empty, "element") {
+		t.Errorf("expected no elements, got:\n%s", empty)
+	}
+}
+
+func TestStartBanExport(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	file := filepath.Join(t.TempDir(), "bans.nft")
+	defer func() {
+		banExportersMutex.Lock()
+		delete(banExporters, file)
+		banExportersMutex.Unlock()
+	}()
+
+	blocklist := newDynamicBlocklist("", logger)
+	if _, err := blocklist.add("198.51.100.9", 0); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	cfg := &Config{BanExportFile: file, BanExportFormat: "nftables", BanExportIntervalSeconds: 60}
+	if err := startBanExport(cfg, blocklist, logger); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	waitFor(t, "the first export", func() bool {
+		content, _ := os.ReadFile(file)
+		return strings.Contains(string(content), "198.51.100.9/32")
+	})
+
+	for _, invalid := range []*Config{
+		{BanExportFile: file, BanExportFormat: "pf", BanExportIntervalSeconds: 60},
+		{BanExportFile: file, BanExportSetName: "geo block", BanExportIntervalSeconds: 60},
+		{BanExportFile: file},
+	} {
+		if err := startBanExport(invalid, blocklist, logger); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
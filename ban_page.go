@@ -0,0 +1,202 @@
+package traefik_geoblock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBanHtml is served to blocked GET requests when no BanHtmlFilePath is configured.
+// It is a constant rather than an embedded file because Traefik runs plugins with Yaegi,
+// which does not support go:embed. Placeholders: {{.IP}}, {{.Country}} and {{.AppealURL}}.
+const defaultBanHtml = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8" />
+  <meta name="viewport" content="width=device-width, initial-scale=1" />
+  <meta name="robots" content="noindex" />
+  <title>Access Denied</title>
+  <style>
+    :root{--bg:#f6f7f9;--card:#fff;--text:#111827;--muted:#6b7280;--accent:#dc3545}
+    @media (prefers-color-scheme: dark){
+      :root{--bg:#0b0f14;--card:#0f141b;--text:#e5e7eb;--muted:#9aa4b2;--accent:#ef4444}
+    }
+    *{box-sizing:border-box}
+    body{margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;padding:24px;
+      font-family:ui-sans-serif,system-ui,-apple-system,"Segoe UI",Roboto,"Helvetica Neue",Arial,sans-serif;
+      background:var(--bg);color:var(--text)}
+    main{width:min(620px,100%);background:var(--card);border-radius:14px;padding:clamp(20px,4vw,40px);
+      text-align:center;box-shadow:0 10px 25px rgba(0,0,0,.08)}
+    h1{margin:0 0 .5rem;color:var(--accent);font-size:clamp(1.4rem,4.5vw,2rem)}
+    p{margin:.4rem 0;line-height:1.6}
+    .muted{color:var(--muted);font-size:.9rem}
+    .pill{display:inline-block;padding:.3rem .7rem;border-radius:999px;background:rgba(127,127,127,.1);margin:.2rem}
+    a{color:var(--accent)}
+  </style>
+</head>
+<body>
+  <div id="data" data-country="{{.Country}}" data-ip="{{.IP}}" data-appeal="{{.AppealURL}}" hidden></div>
+  <main role="main" aria-labelledby="title">
+    <h1 id="title">Access Denied</h1>
+    <p>Access to this website is not available from <span id="country">your location</span>.</p>
+    <p class="muted"><span class="pill">{{.Country}}</span><span class="pill">{{.IP}}</span></p>
+    <p id="appeal" class="muted" hidden>Think this is a mistake? <a id="appealLink" rel="nofollow">Request access</a></p>
+  </main>
+  <script>
+    (function () {
+      var el = document.getElementById('data');
+      var code = (el.getAttribute('data-country') || '').trim().toUpperCase();
+      var appeal = (el.getAttribute('data-appeal') || '').trim();
+      if (/^[A-Z]{2}$/.test(code) && typeof Intl !== 'undefined' && Intl.DisplayNames) {
+        try {
+          var name = new Intl.DisplayNames([navigator.language || 'en'], { type: 'region' }).of(code);
+          if (name) { document.getElementById('country').textContent = name; }
+        } catch (e) {}
+      }
+      if (/^https?:\/\//i.test(appeal)) {
+        document.getElementById('appealLink').setAttribute('href', appeal);
+        document.getElementById('appeal').hidden = false;
+      }
+    })();
+  </script>
+</body>
+</html>
+`
+
+// statusAllowsBody reports whether a response with this status code may carry a body
+func statusAllowsBody(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// renderBanHtml replaces the placeholders of a ban page. Values are HTML escaped because the IP
+// comes from request headers and is unvalidated when the ban is caused by a parse error.
+func renderBanHtml(content, ip, country, appealURL string) string {
+	return strings.NewReplacer(
+		"{{.Country}}", html.EscapeString(country),
+		"{{.IP}}", html.EscapeString(ip),
+		"{{.AppealURL}}", html.EscapeString(appealURL),
+	).Replace(content)
+}
+
+// banPageFile keeps the content of BanHtmlFilePath and reloads it when the file changes, so the page can be
+// updated without restarting Traefik. Requests see either the old or the new page, never a partial one.
+type banPageFile struct {
+	path string
+
+	mu       sync.RWMutex
+	content  string
+	modTime  time.Time
+	size     int64
+	interval time.Duration
+	logger   *slog.Logger
+
+	refCount int           // Plugin instances using the watcher, guarded by banPageFilesMutex
+	stop     chan struct{} // Closed by releaseBanPage when the last instance is closed
+}
+
+var (
+	// banPageFiles keeps one watcher per file across configuration reloads
+	banPageFiles      = make(map[string]*banPageFile)
+	banPageFilesMutex sync.Mutex
+)
+
+// watchBanPage starts watching a ban page read at startup, or hands the running watcher of the file the
+// content and settings of the new instance
+func watchBanPage(path string, content string, interval time.Duration, logger *slog.Logger) *banPageFile {
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	banPageFilesMutex.Lock()
+	defer banPageFilesMutex.Unlock()
+
+	page, running := banPageFiles[path]
+	if !running {
+		page = &banPageFile{path: path, stop: make(chan struct{})}
+		banPageFiles[path] = page
+	}
+	page.refCount++
+	page.mu.Lock()
+	page.content, page.modTime, page.size = content, modTime, size
+	page.interval, page.logger = interval, logger
+	page.mu.Unlock()
+
+	if !running {
+		go page.loop()
+	}
+	return page
+}
+
+// releaseBanPage drops one reference to the watcher and stops it once no plugin instance uses it
+func releaseBanPage(page *banPageFile) {
+	banPageFilesMutex.Lock()
+	defer banPageFilesMutex.Unlock()
+
+	page.refCount--
+	if page.refCount > 0 {
+		return
+	}
+	if registered, exists := banPageFiles[page.path]; exists && registered == page {
+		delete(banPageFiles, page.path)
+	}
+	close(page.stop)
+}
+
+// get returns the current page
+func (b *banPageFile) get() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.content
+}
+
+// loop checks the file after every interval until stopped
+func (b *banPageFile) loop() {
+	for {
+		b.mu.RLock()
+		interval := b.interval
+		b.mu.RUnlock()
+
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(interval):
+		}
+		b.reload()
+	}
+}
+
+// reload reads the file again when its modification time or size changed. A missing or unreadable file
+// keeps the previous page.
+func (b *banPageFile) reload() {
+	b.mu.RLock()
+	modTime, size, logger := b.modTime, b.size, b.logger
+	b.mu.RUnlock()
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		logger.Warn("failed to check ban HTML file, keeping the previous page", "file", b.path, "error", err)
+		return
+	}
+	if info.ModTime().Equal(modTime) && info.Size() == size {
+		return
+	}
+	content, err := os.ReadFile(b.path)
+	if err != nil {
+		logger.Warn("failed to reload ban HTML file, keeping the previous page", "file", b.path, "error", err)
+		return
+	}
+
+	b.mu.Lock()
+	b.content, b.modTime, b.size = string(content), info.ModTime(), info.Size()
+	b.mu.Unlock()
+	hash := sha256.Sum256(content)
+	logger.Info("ban HTML file reloaded", "file", b.path, "bytes", len(content), "sha256", hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,182 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultBanPage(t *testing.T) {
+	newPlugin := func(t *testing.T, mutate func(cfg *Config)) http.Handler {
+		t.Helper()
+		cfg := &Config{
+			Enabled:              true,
+			DatabaseFilePath:     tinyDbFilePath,
+			AllowedCountries:     []string{"AU"},
+			BanIfError:           true,
+			DisallowedStatusCode: http.StatusForbidden,
+			IPHeaders:            []string{"x-real-ip"},
+			IPHeaderStrategy:     IPHeaderStrategyCheckAll,
+			BanAppealURL:         "https://example.com/appeal?from=geo&x=1",
+		}
+		if mutate != nil {
+			mutate(cfg)
+		}
+		plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		return plugin
+	}
+
+	serve := func(plugin http.Handler, method, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("ServedWithoutBanHtmlFilePath", func(t *testing.T) {
+		rr := serve(newPlugin(t, nil), http.MethodGet, "8.8.8.8")
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("expected HTML content type, got %q", ct)
+		}
+		body := rr.Body.String()
+		for _, want := range []string{`data-country="US"`, `data-ip="8.8.8.8"`, `data-appeal="https://example.com/appeal?from=geo&amp;x=1"`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected body to contain %s", want)
+			}
+		}
+		if strings.Contains(body, "{{.") {
+			t.Error("expected all placeholders to be replaced")
+		}
+	})
+
+	t.Run("PlaceholdersAreEscaped", func(t *testing.T) {
+		rr := serve(newPlugin(t, nil), http.MethodGet, `<script>alert(1)</script>`)
+		if strings.Contains(rr.Body.String(), "<script>alert(1)") {
+			t.Error("expected the raw header value to be HTML escaped")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		rr := serve(newPlugin(t, func(cfg *Config) { cfg.DisableDefaultBanPage = true }), http.MethodGet, "8.8.8.8")
+		if rr.Body.Len() != 0 {
+			t.Errorf("expected empty body, got %q", rr.Body.String())
+		}
+	})
+
+	t.Run("NoBodyForHeadOrNoContent", func(t *testing.T) {
+		if rr := serve(newPlugin(t, nil), http.MethodHead, "8.8.8.8"); rr.Body.Len() != 0 {
+			t.Error("expected empty body for HEAD")
+		}
+		rr := serve(newPlugin(t, func(cfg *Config) { cfg.DisallowedStatusCode = http.StatusNoContent }), http.MethodGet, "8.8.8.8")
+		if rr.Code != http.StatusNoContent || rr.Body.Len() != 0 {
+			t.Errorf("expected empty 204, got %d with %d bytes", rr.Code, rr.Body.Len())
+		}
+	})
+}
+
+func TestStrictFiles_BanHtmlFilePath(t *testing.T) {
+	t.Setenv("TRAEFIK_PLUGIN_GEOBLOCK_PATH", ".")
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	missing := filepath.Join(t.TempDir(), "missing", "geoblockban.html")
+	cfg.BanHtmlFilePath = missing
+
+	// The search falls back to the bundled page...
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected the environment fallback to find the page, got: %v", err)
+	}
+	plugin.(*Plugin).Close()
+
+	// ...which strict mode refuses. The plugin stores the path it found, restore the configured one.
+	cfg.BanHtmlFilePath = missing
+	cfg.StrictFiles = true
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err == nil || !strings.Contains(err.Error(), "StrictFiles") {
+		t.Errorf("expected a StrictFiles error, got: %v", err)
+	}
+}
+
+func TestBanPageReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ban.html")
+	if err := os.WriteFile(path, []byte("<p>old page for {{.Country}}</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.BanHtmlFilePath = path
+	cfg.BanHtmlReloadSeconds = 3600 // Reloads are triggered by the test
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	page := plugin.banPageFile
+	logs := &syncBuffer{}
+	page.mu.Lock()
+	page.logger = slog.New(slog.NewTextHandler(logs, nil))
+	page.mu.Unlock()
+
+	serve := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", "8.8.8.8")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+	if body := serve(); body != "<p>old page for US</p>" {
+		t.Fatalf("unexpected ban page %q", body)
+	}
+
+	// Unchanged files are not read again
+	page.reload()
+	if strings.Contains(logs.String(), "reloaded") {
+		t.Errorf("expected no reload of an unchanged file, got %s", logs.String())
+	}
+
+	updated := []byte("<p>new page for {{.Country}}</p>")
+	if err := os.WriteFile(path, updated, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	page.reload()
+	if body := serve(); body != "<p>new page for US</p>" {
+		t.Errorf("expected the reloaded page, got %q", body)
+	}
+	hash := sha256.Sum256(updated)
+	if !strings.Contains(logs.String(), "ban HTML file reloaded") || !strings.Contains(logs.String(), "sha256="+hex.EncodeToString(hash[:])) {
+		t.Errorf("expected the reload to be logged with the content hash, got %s", logs.String())
+	}
+
+	// A deleted file keeps the last page
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	page.reload()
+	if body := serve(); body != "<p>new page for US</p>" {
+		t.Errorf("expected the previous page to stay, got %q", body)
+	}
+}
@@ -0,0 +1,95 @@
+package traefik_geoblock
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// What happens to the unread request body of blocked requests
+const (
+	BlockedBodyPolicyDrain = "drain" // Leave it to the server, which reads a small remainder to keep the connection (default)
+	BlockedBodyPolicyLimit = "limit" // Close the connection when the body is larger than BlockedBodyLimitBytes or of unknown size
+	BlockedBodyPolicyClose = "close" // Close the connection right after the response whenever there is a body
+)
+
+// blockedBody stops blocked clients from uploading their bodies through the proxy. Nothing reads the
+// body of a blocked request, but an HTTP/1.x server keeps receiving it to reuse the connection.
+type blockedBody struct {
+	policy string
+	limit  int64
+}
+
+// newBlockedBody validates the blocked body settings. Returns nil for the drain policy.
+func newBlockedBody(cfg *Config) (*blockedBody, error) {
+	policy := strings.ToLower(cfg.BlockedBodyPolicy)
+	switch policy {
+	case "", BlockedBodyPolicyDrain:
+		return nil, nil
+	case BlockedBodyPolicyLimit:
+		if cfg.BlockedBodyLimitBytes < 0 {
+			return nil, fmt.Errorf("BlockedBodyLimitBytes must not be negative, got %d", cfg.BlockedBodyLimitBytes)
+		}
+	case BlockedBodyPolicyClose:
+	default:
+		return nil, fmt.Errorf("invalid BlockedBodyPolicy %q, must be one of: %s, %s, %s",
+			cfg.BlockedBodyPolicy, BlockedBodyPolicyDrain, BlockedBodyPolicyLimit, BlockedBodyPolicyClose)
+	}
+	return &blockedBody{policy: policy, limit: cfg.BlockedBodyLimitBytes}, nil
+}
+
+// prepare marks the response to close the connection when the body must not be received. Returns true
+// when the connection should also be hijacked and closed once the response is written, to stop at once.
+// HTTP/2 streams are reset by the server when the handler returns without reading the body.
+func (b *blockedBody) prepare(rw http.ResponseWriter, req *http.Request) bool {
+	if req.ProtoMajor != 1 || req.ContentLength == 0 {
+		return false
+	}
+	if b.policy == BlockedBodyPolicyLimit && req.ContentLength > 0 && req.ContentLength <= b.limit {
+		return false
+	}
+	rw.Header().Set("Connection", "close")
+	return b.policy == BlockedBodyPolicyClose
+}
+
+// hangUp sends the response written so far and closes the connection, when the writer supports it
+func (b *blockedBody) hangUp(rw http.ResponseWriter, logger *slog.Logger) {
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		return
+	}
+	if flusher, ok := rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		logger.Debug("failed to hijack blocked connection", "error", err)
+		return
+	}
+	conn.Close()
+}
+
+// dropConnection closes the connection without a response, with a TCP reset where possible, so port
+// scanners see a dead host. Returns false when the writer can't be hijacked (HTTP/2), the caller then
+// has to respond.
+func dropConnection(rw http.ResponseWriter) bool {
+	hijacker, ok := rw.(http.Hijacker)
+	if !ok {
+		return false
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return false
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0) // Close sends RST instead of FIN
+	}
+	conn.Close()
+	return true
+}
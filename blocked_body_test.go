@@ -0,0 +1,136 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlockedBody_Prepare(t *testing.T) {
+	tests := []struct {
+		policy        string
+		contentLength int64
+		wantClose     bool
+		wantHangUp    bool
+	}{
+		{BlockedBodyPolicyLimit, 0, false, false},
+		{BlockedBodyPolicyLimit, 100, false, false},
+		{BlockedBodyPolicyLimit, 101, true, false},
+		{BlockedBodyPolicyLimit, -1, true, false}, // Chunked, size unknown
+		{BlockedBodyPolicyClose, 0, false, false},
+		{BlockedBodyPolicyClose, 1, true, true},
+	}
+	for _, tt := range tests {
+		body, err := newBlockedBody(&Config{BlockedBodyPolicy: tt.policy, BlockedBodyLimitBytes: 100})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.ContentLength = tt.contentLength
+		rr := httptest.NewRecorder()
+		hangUp := body.prepare(rr, req)
+		if closed := rr.Header().Get("Connection") == "close"; closed != tt.wantClose || hangUp != tt.wantHangUp {
+			t.Errorf("%s with %d bytes: expected close %v and hang up %v, got %v and %v",
+				tt.policy, tt.contentLength, tt.wantClose, tt.wantHangUp, closed, hangUp)
+		}
+	}
+
+	if _, err := newBlockedBody(&Config{BlockedBodyPolicy: "reset"}); err == nil {
+		t.Error("expected an invalid policy to be rejected")
+	}
+}
+
+func TestBlockedBody_CloseHangsUp(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.BlockedBodyPolicy = BlockedBodyPolicyClose
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	server := httptest.NewServer(plugin)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Announce a large upload but only send the headers
+	if _, err := io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: example.com\r\nX-Real-IP: 8.8.8.8\r\nContent-Length: 104857600\r\n\r\n"); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden || !resp.Close || resp.ContentLength != 0 {
+		t.Errorf("expected a complete 403 closing the connection, got %d close=%v length=%d", resp.StatusCode, resp.Close, resp.ContentLength)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestBanModeDrop(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.BanMode = BanModeDrop
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	server := httptest.NewServer(plugin)
+	defer server.Close()
+
+	request := func(ip string) (*http.Response, error) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nX-Real-IP: "+ip+"\r\n\r\n"); err != nil {
+			t.Fatalf("failed to write request: %v", err)
+		}
+		return http.ReadResponse(bufio.NewReader(conn), nil)
+	}
+
+	if resp, err := request("1.1.1.1"); err != nil || resp.StatusCode != http.StatusTeapot {
+		t.Errorf("expected allowed requests to be answered, got %v", err)
+	}
+	if resp, err := request("8.8.8.8"); err == nil {
+		t.Errorf("expected the connection to be dropped without a response, got %d", resp.StatusCode)
+	}
+
+	// Without hijacking support (HTTP/2) the status code is sent
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	rr := httptest.NewRecorder()
+	plugin.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected the status code fallback, got %d", rr.Code)
+	}
+}
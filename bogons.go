@@ -0,0 +1,250 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseBogon is used when the IP is in a bogon (reserved or unallocated) range
+const PhaseBogon = "bogon"
+
+// BogonCountryAlias is reported as the country of bogon IPs
+const BogonCountryAlias = "BOGON"
+
+// Team Cymru full bogon feeds, which also cover allocated-but-unassigned space
+const (
+	CymruFullBogonsIPv4URL = "https://www.team-cymru.org/Services/Bogons/fullbogons-ipv4.txt"
+	CymruFullBogonsIPv6URL = "https://www.team-cymru.org/Services/Bogons/fullbogons-ipv6.txt"
+)
+
+// defaultBogonBlocks are the reserved ranges (RFC 6890 and friends) plus IPv6 space outside 2000::/3.
+// Private and loopback ranges are left out, AllowPrivate decides on those.
+var defaultBogonBlocks = []string{
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"169.254.0.0/16",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"100::/64",
+	"2001:2::/48",
+	"2001:10::/28",
+	"2001:db8::/32",
+	"3fff::/20",
+	"fe80::/10",
+	"fec0::/10",
+	"ff00::/8",
+	// Not allocated by IANA
+	"100::/8",
+	"200::/7",
+	"400::/6",
+	"800::/5",
+	"1000::/4",
+	"4000::/2",
+	"8000::/2",
+	"c000::/3",
+	"e000::/4",
+	"f000::/5",
+	"f800::/6",
+	"fe00::/9",
+}
+
+// bogonList matches IPs against the static bogon ranges and the optional feeds.
+// IPv4 and IPv6 use separate trees, so IPv6 prefixes can't shadow IPv4 addresses.
+type bogonList struct {
+	mu     sync.RWMutex
+	v4, v6 *IpLookupHelper
+	static []string
+
+	feeds   []string
+	refresh time.Duration
+	client  *http.Client
+	logger  *slog.Logger
+
+	key      string        // Entry in bogonLists
+	refCount int           // Plugin instances using the list, guarded by bogonListsMutex
+	stop     chan struct{} // Closed by releaseBogonList when the last instance is closed
+}
+
+var (
+	// bogonLists shares one list (and one refresher) per configuration between plugin instances
+	bogonLists      = make(map[string]*bogonList)
+	bogonListsMutex sync.Mutex
+)
+
+// newBogonList builds the bogon list. Returns nil when BlockBogons is disabled.
+// Feeds are fetched in the background, the static ranges apply until the first refresh succeeds.
+func newBogonList(cfg *Config, logger *slog.Logger) (*bogonList, error) {
+	if !cfg.BlockBogons {
+		return nil, nil
+	}
+
+	static := cfg.BogonBlocks
+	if len(static) == 0 {
+		static = defaultBogonBlocks
+	}
+	refresh := time.Duration(cfg.BogonFeedRefreshSeconds) * time.Second
+	if refresh <= 0 {
+		refresh = 24 * time.Hour
+	}
+
+	key := strings.Join(static, ",") + "|" + strings.Join(cfg.BogonFeedURLs, ",") + "|" + refresh.String()
+	bogonListsMutex.Lock()
+	defer bogonListsMutex.Unlock()
+	if existing, ok := bogonLists[key]; ok {
+		existing.refCount++
+		return existing, nil
+	}
+
+	list := &bogonList{
+		static:   static,
+		feeds:    cfg.BogonFeedURLs,
+		refresh:  refresh,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		logger:   logger,
+		key:      key,
+		refCount: 1,
+		stop:     make(chan struct{}),
+	}
+	if err := list.rebuild(nil); err != nil {
+		return nil, fmt.Errorf("invalid BogonBlocks: %w", err)
+	}
+	if len(list.feeds) > 0 {
+		go list.refreshLoop()
+	}
+
+	bogonLists[key] = list
+	return list, nil
+}
+
+// releaseBogonList drops one reference to the list and stops its feed refresher once no plugin instance uses it
+func releaseBogonList(list *bogonList) {
+	bogonListsMutex.Lock()
+	defer bogonListsMutex.Unlock()
+
+	list.refCount--
+	if list.refCount > 0 {
+		return
+	}
+	if registered, exists := bogonLists[list.key]; exists && registered == list {
+		delete(bogonLists, list.key)
+	}
+	close(list.stop)
+}
+
+// rebuild replaces the trees with the static ranges plus the feed entries
+func (b *bogonList) rebuild(feedBlocks []string) error {
+	v4, v6 := NewEmptyIpLookupHelper(), NewEmptyIpLookupHelper()
+	for _, blocks := range [][]string{b.static, feedBlocks} {
+		for _, cidr := range blocks {
+			ip, _, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid bogon range %q: %w", cidr, err)
+			}
+			helper := v6
+			if ip.To4() != nil {
+				helper = v4
+			}
+			if err := helper.AddCIDR(cidr); err != nil {
+				return err
+			}
+		}
+	}
+
+	b.mu.Lock()
+	b.v4, b.v6 = v4, v6
+	b.mu.Unlock()
+	return nil
+}
+
+// contains reports whether the IP is a bogon
+func (b *bogonList) contains(ip net.IP) bool {
+	b.mu.RLock()
+	helper := b.v6
+	if ip.To4() != nil {
+		helper = b.v4
+	}
+	b.mu.RUnlock()
+
+	found, _, _ := helper.IsContained(ip)
+	return found
+}
+
+// refreshLoop downloads the feeds now and then periodically until stopped, keeping the previous ranges on failure
+func (b *bogonList) refreshLoop() {
+	ticker := time.NewTicker(b.refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := b.refreshFeeds(); err != nil {
+			b.logger.Warn("bogon feed refresh failed, keeping previous ranges", "error", err)
+		}
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshFeeds downloads every feed and swaps the ranges in once all of them succeeded
+func (b *bogonList) refreshFeeds() error {
+	var blocks []string
+	for _, url := range b.feeds {
+		feedBlocks, err := b.fetchFeed(url)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, feedBlocks...)
+	}
+	if err := b.rebuild(blocks); err != nil {
+		return err
+	}
+	b.logger.Debug("bogon feeds refreshed", "feeds", len(b.feeds), "ranges", len(blocks))
+	return nil
+}
+
+// fetchFeed downloads a feed with one CIDR per line, # starts a comment
+func (b *bogonList) fetchFeed(url string) ([]string, error) {
+	resp, err := b.client.Get(url) // #nosec G107
+	if err != nil {
+		return nil, fmt.Errorf("failed to download bogon feed %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download bogon feed %s: status %d", url, resp.StatusCode)
+	}
+	return parseBogonFeed(resp.Body, url)
+}
+
+// parseBogonFeed reads CIDRs from a feed, rejecting the whole feed on the first invalid line
+func parseBogonFeed(r io.Reader, source string) ([]string, error) {
+	var blocks []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(line); err != nil {
+			return nil, fmt.Errorf("invalid line in bogon feed %s: %q", source, line)
+		}
+		blocks = append(blocks, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read bogon feed %s: %w", source, err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,120 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBlockBogons(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.AllowPrivate = true
+	cfg.BlockBogons = true
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		ip        string
+		wantPhase string
+		allowed   bool
+	}{
+		{ip: "1.1.1.1", allowed: true},
+		{ip: "10.0.0.1", wantPhase: PhaseAllowPrivate, allowed: true},
+		{ip: "100.64.1.1", wantPhase: PhaseBogon},
+		{ip: "192.0.2.10", wantPhase: PhaseBogon},
+		{ip: "240.1.2.3", wantPhase: PhaseBogon},
+		{ip: "2001:4860::8888", allowed: true},
+		{ip: "2001:db8::1", wantPhase: PhaseBogon},
+		{ip: "4000::1", wantPhase: PhaseBogon},
+		{ip: "128.0.0.1", allowed: true}, // IPv6 8000::/2 must not shadow IPv4
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			allowed, country, phase, err := plugin.CheckAllowed(tt.ip)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != tt.allowed {
+				t.Errorf("expected allowed=%v, got %v (phase %s)", tt.allowed, allowed, phase)
+			}
+			if tt.wantPhase != "" && phase != tt.wantPhase {
+				t.Errorf("expected phase %s, got %s", tt.wantPhase, phase)
+			}
+			if phase == PhaseBogon && country != BogonCountryAlias {
+				t.Errorf("expected country %s, got %s", BogonCountryAlias, country)
+			}
+		})
+	}
+
+	// Disabled by default
+	cfg.BlockBogons = false
+	handler, err = New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if allowed, _, _, _ := handler.(*Plugin).CheckAllowed("192.0.2.10"); !allowed {
+		t.Error("expected bogons to be allowed without BlockBogons")
+	}
+}
+
+func TestBogonFeedRefresh(t *testing.T) {
+	feed := "# last updated 1700000000\n1.1.1.0/24\n2001:4860::/32\n"
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/broken" {
+			_, _ = io.WriteString(rw, "not a cidr\n")
+			return
+		}
+		_, _ = io.WriteString(rw, feed)
+	}))
+	defer server.Close()
+
+	list := &bogonList{
+		static: []string{"192.0.2.0/24"},
+		feeds:  []string{server.URL + "/fullbogons"},
+		client: server.Client(),
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	if err := list.rebuild(nil); err != nil {
+		t.Fatalf("failed to build list: %v", err)
+	}
+	if list.contains(net.ParseIP("1.1.1.1")) {
+		t.Fatal("expected feed ranges to be absent before the first refresh")
+	}
+
+	if err := list.refreshFeeds(); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	for _, ip := range []string{"1.1.1.1", "2001:4860::1", "192.0.2.1"} {
+		if !list.contains(net.ParseIP(ip)) {
+			t.Errorf("expected %s to be a bogon after refresh", ip)
+		}
+	}
+
+	// A broken feed keeps the previous ranges
+	list.feeds = append(list.feeds, server.URL+"/broken")
+	if err := list.refreshFeeds(); err == nil || !strings.Contains(err.Error(), "invalid line") {
+		t.Errorf("expected invalid line error, got %v", err)
+	}
+	if !list.contains(net.ParseIP("1.1.1.1")) {
+		t.Error("expected previous ranges to be kept after a failed refresh")
+	}
+}
+
+func TestBogonBlocksValidation(t *testing.T) {
+	if _, err := newBogonList(&Config{BlockBogons: true, BogonBlocks: []string{"nope"}}, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Error("expected error for an invalid bogon range")
+	}
+}
@@ -0,0 +1,184 @@
+package traefik_geoblock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BypassTokenStats counts the bypass tokens seen by the plugin
+type BypassTokenStats struct {
+	Accepted  int64 `json:"accepted"`  // Tokens that bypassed the geoblocking check
+	Invalid   int64 `json:"invalid"`   // Malformed tokens and bad signatures
+	Expired   int64 `json:"expired"`   // Tokens past their expiry, or expiring later than BypassTokenMaxTTLSeconds
+	Replayed  int64 `json:"replayed"`  // Tokens used before
+	CacheFull int64 `json:"cacheFull"` // Valid tokens rejected because the replay cache was full of unexpired tokens
+	Cached    int   `json:"cached"`    // Tokens currently in the replay cache
+}
+
+// bypassTokens lets requests carrying a signed one-time token skip the geoblocking check, like BypassHeaders.
+// A token is "<expiry>.<nonce>.<signature>": the unix expiry, a random nonce and the base64url HMAC-SHA256
+// of "<expiry>.<nonce>". Used nonces are remembered until their token expires, so a token works once.
+//
+// The replay cache is bounded: expired nonces are evicted first, and when all entries are still valid new
+// tokens are rejected rather than evicting one, which would make that token usable again.
+type bypassTokens struct {
+	secret []byte
+	header string
+	maxTTL time.Duration
+	limit  int
+
+	mu   sync.Mutex
+	used map[string]time.Time // Nonce -> expiry of its token
+
+	accepted  *int64
+	invalid   *int64
+	expired   *int64
+	replayed  *int64
+	cacheFull *int64
+}
+
+// Results of bypassTokens.check
+const (
+	bypassTokenNone = iota
+	bypassTokenAccepted
+	bypassTokenInvalid
+	bypassTokenExpired
+	bypassTokenReplayed
+	bypassTokenCacheFull
+)
+
+// newBypassTokens validates the bypass token settings. Returns nil when no BypassTokenSecret is configured.
+func newBypassTokens(cfg *Config) (*bypassTokens, error) {
+	if cfg.BypassTokenSecret == "" {
+		return nil, nil
+	}
+	if len(cfg.BypassTokenSecret) < 16 {
+		return nil, fmt.Errorf("BypassTokenSecret must be at least 16 characters")
+	}
+	if cfg.BypassTokenHeader == "" {
+		return nil, fmt.Errorf("BypassTokenSecret requires BypassTokenHeader")
+	}
+	if cfg.BypassTokenMaxTTLSeconds <= 0 {
+		return nil, fmt.Errorf("BypassTokenMaxTTLSeconds must be positive, got %d", cfg.BypassTokenMaxTTLSeconds)
+	}
+	if cfg.BypassTokenReplayCacheSize <= 0 {
+		return nil, fmt.Errorf("BypassTokenReplayCacheSize must be positive, got %d", cfg.BypassTokenReplayCacheSize)
+	}
+
+	return &bypassTokens{
+		secret:    []byte(cfg.BypassTokenSecret),
+		header:    cfg.BypassTokenHeader,
+		maxTTL:    time.Duration(cfg.BypassTokenMaxTTLSeconds) * time.Second,
+		limit:     cfg.BypassTokenReplayCacheSize,
+		used:      make(map[string]time.Time),
+		accepted:  new(int64),
+		invalid:   new(int64),
+		expired:   new(int64),
+		replayed:  new(int64),
+		cacheFull: new(int64),
+	}, nil
+}
+
+// check verifies the token of the request and consumes it. Returns bypassTokenNone without a token.
+func (b *bypassTokens) check(req *http.Request, now time.Time) int {
+	token := strings.TrimSpace(req.Header.Get(b.header))
+	if token == "" {
+		return bypassTokenNone
+	}
+
+	result := b.consume(token, now)
+	switch result {
+	case bypassTokenAccepted:
+		atomic.AddInt64(b.accepted, 1)
+	case bypassTokenInvalid:
+		atomic.AddInt64(b.invalid, 1)
+	case bypassTokenExpired:
+		atomic.AddInt64(b.expired, 1)
+	case bypassTokenReplayed:
+		atomic.AddInt64(b.replayed, 1)
+	case bypassTokenCacheFull:
+		atomic.AddInt64(b.cacheFull, 1)
+	}
+	return result
+}
+
+// consume validates the token and records its nonce
+func (b *bypassTokens) consume(token string, now time.Time) int {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[1] == "" {
+		return bypassTokenInvalid
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return bypassTokenInvalid
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(b.sign(parts[0], parts[1]))) {
+		return bypassTokenInvalid
+	}
+	// Tokens expiring far in the future would stay in the cache for as long
+	expiry := time.Unix(expires, 0)
+	if !expiry.After(now) || expiry.Sub(now) > b.maxTTL {
+		return bypassTokenExpired
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, used := b.used[parts[1]]; used {
+		return bypassTokenReplayed
+	}
+	if len(b.used) >= b.limit {
+		b.evictExpiredLocked(now)
+		if len(b.used) >= b.limit {
+			return bypassTokenCacheFull
+		}
+	}
+	b.used[parts[1]] = expiry
+	return bypassTokenAccepted
+}
+
+// evictExpiredLocked drops the nonces of expired tokens, which can't be replayed anyway.
+// Only runs when the cache is full. Callers must hold mu.
+func (b *bypassTokens) evictExpiredLocked(now time.Time) {
+	for nonce, expiry := range b.used {
+		if !expiry.After(now) {
+			delete(b.used, nonce)
+		}
+	}
+}
+
+// sign returns the HMAC of the expiry and nonce
+func (b *bypassTokens) sign(expiry, nonce string) string {
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(expiry + "." + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// token returns a token for the nonce valid until expires, used by tests and tooling sharing the secret
+func (b *bypassTokens) token(nonce string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + nonce + "." + b.sign(expiry, nonce)
+}
+
+// stats returns the counters and the size of the replay cache
+func (b *bypassTokens) stats() *BypassTokenStats {
+	b.mu.Lock()
+	cached := len(b.used)
+	b.mu.Unlock()
+	return &BypassTokenStats{
+		Accepted:  atomic.LoadInt64(b.accepted),
+		Invalid:   atomic.LoadInt64(b.invalid),
+		Expired:   atomic.LoadInt64(b.expired),
+		Replayed:  atomic.LoadInt64(b.replayed),
+		CacheFull: atomic.LoadInt64(b.cacheFull),
+		Cached:    cached,
+	}
+}
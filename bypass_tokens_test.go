@@ -0,0 +1,74 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBypassTokens(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US"}
+	cfg.BypassTokenSecret = "0123456789abcdef"
+	cfg.BypassTokenReplayCacheSize = 2
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	now := time.Now()
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", "85.214.132.1") // DE, blocked
+		req.Header.Set("X-Geoblock-Bypass-Token", token)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	tokens := plugin.bypassTokens
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"Valid", tokens.token("a", now.Add(time.Minute)), http.StatusTeapot},
+		{"Replayed", tokens.token("a", now.Add(time.Minute)), http.StatusForbidden},
+		{"BadSignature", tokens.token("b", now.Add(time.Minute)) + "x", http.StatusForbidden},
+		{"Malformed", "b.c", http.StatusForbidden},
+		{"Expired", tokens.token("c", now.Add(-time.Minute)), http.StatusForbidden},
+		{"TooLong", tokens.token("d", now.Add(2*time.Hour)), http.StatusForbidden},
+		{"SecondValid", tokens.token("e", now.Add(time.Minute)), http.StatusTeapot},
+		{"CacheFull", tokens.token("f", now.Add(time.Minute)), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := serve(tt.token); got != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, got)
+		}
+	}
+
+	want := BypassTokenStats{Accepted: 2, Invalid: 2, Expired: 2, Replayed: 1, CacheFull: 1, Cached: 2}
+	if stats := plugin.Stats().BypassTokens; stats == nil || *stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+
+	// Expired nonces are evicted to make room, and can't be replayed since their token expired
+	tokens.used["a"] = now.Add(-time.Second)
+	if got := serve(tokens.token("f", now.Add(time.Minute))); got != http.StatusTeapot {
+		t.Errorf("expected the expired nonce to be evicted, got status %d", got)
+	}
+	if _, ok := tokens.used["a"]; ok {
+		t.Error("expected the expired nonce to be evicted")
+	}
+
+	cfg.BypassTokenSecret = "short"
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+		t.Error("expected an error for a short secret")
+	}
+}
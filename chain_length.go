@@ -0,0 +1,33 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PhaseLongChain is used when the IP headers hold more than MaxChainLength entries (LongChainPolicy "block")
+const PhaseLongChain = "long_chain"
+
+// What happens to requests whose IP headers hold more than MaxChainLength entries. Only the first
+// MaxChainLength entries are ever parsed, so stuffing X-Forwarded-For costs nothing but the header itself.
+const (
+	LongChainPolicyAllow = "allow" // Evaluate the first entries
+	LongChainPolicyLog   = "log"   // Evaluate the first entries and log a warning (default)
+	LongChainPolicyBlock = "block" // Block the request
+)
+
+// validateLongChainPolicy checks MaxChainLength and LongChainPolicy and returns the normalized policy
+func validateLongChainPolicy(cfg *Config) (string, error) {
+	if cfg.MaxChainLength < 0 {
+		return "", fmt.Errorf("MaxChainLength must not be negative, got %d", cfg.MaxChainLength)
+	}
+	policy := strings.ToLower(cfg.LongChainPolicy)
+	switch policy {
+	case "":
+		return LongChainPolicyLog, nil
+	case LongChainPolicyAllow, LongChainPolicyLog, LongChainPolicyBlock:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid LongChainPolicy %q, must be one of: %s, %s, %s",
+		cfg.LongChainPolicy, LongChainPolicyAllow, LongChainPolicyLog, LongChainPolicyBlock)
+}
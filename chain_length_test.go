@@ -0,0 +1,95 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMaxChainLength(t *testing.T) {
+	// Ten US addresses, then a German one past the limit
+	chain := make([]string, 0, 11)
+	for i := 1; i <= 10; i++ {
+		chain = append(chain, "8.8.8."+strconv.Itoa(i))
+	}
+	chain = append(chain, "85.214.132.1")
+	forwardedFor := strings.Join(chain, ", ")
+
+	tests := []struct {
+		name   string
+		policy string
+		max    int
+		want   int
+		phase  string
+	}{
+		{"log evaluates the first entries", LongChainPolicyLog, 10, http.StatusTeapot, ""},
+		{"allow evaluates the first entries", LongChainPolicyAllow, 10, http.StatusTeapot, ""},
+		{"block", LongChainPolicyBlock, 10, http.StatusForbidden, PhaseLongChain},
+		{"no limit", LongChainPolicyBlock, 0, http.StatusForbidden, PhaseDefaultAllow},
+		{"chain within the limit", LongChainPolicyBlock, 11, http.StatusForbidden, PhaseDefaultAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.AllowedCountries = []string{"US"}
+			cfg.MaxChainLength = tt.max
+			cfg.LongChainPolicy = tt.policy
+			plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			defer plugin.Close()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+			if tt.phase != "" && plugin.Stats().Phases[tt.phase] != 1 {
+				t.Errorf("expected phase %s, got %v", tt.phase, plugin.Stats().Phases)
+			}
+		})
+	}
+}
+
+func TestMaxChainLengthAcrossHeaders(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.MaxChainLength = 3
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	// Invalid and empty entries count too, they cost as much to skip
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "8.8.8.8, garbage")
+	req.Header.Set("X-Real-IP", "1.1.1.1, 8.8.4.4")
+	ips, truncated := plugin.remoteIPs(req)
+	if !truncated || len(ips) != 2 || ips[0] != "8.8.8.8" || ips[1] != "1.1.1.1" {
+		t.Errorf("expected 8.8.8.8 and 1.1.1.1 and a truncated chain, got %v and %v", ips, truncated)
+	}
+
+	for _, tt := range []struct {
+		max    int
+		policy string
+	}{{-1, ""}, {10, "drop"}} {
+		cfg := CreateConfig()
+		cfg.Enabled = true
+		cfg.DatabaseFilePath = tinyDbFilePath
+		cfg.MaxChainLength = tt.max
+		cfg.LongChainPolicy = tt.policy
+		if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+			t.Errorf("expected an error for MaxChainLength %d and LongChainPolicy %q", tt.max, tt.policy)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package traefik_geoblock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ban modes
+const (
+	BanModeBlock     = "block"     // Serve the ban page (default)
+	BanModeChallenge = "challenge" // Serve a challenge page to country blocks, passing clients get a signed cookie
+	BanModeDrop      = "drop"      // Close the connection without a response, like a dead host
+)
+
+// Challenge types
+const (
+	ChallengeTypeJS     = "js"     // The page sets the cookie from JavaScript, clients without JavaScript stay blocked
+	ChallengeTypeCookie = "cookie" // The response sets the cookie and the page reloads, clients without a cookie jar stay blocked
+)
+
+// Challenge phases
+const (
+	PhaseChallenge       = "challenge"        // A challenge page was served instead of the ban page
+	PhaseChallengePassed = "challenge_passed" // The request carried a valid challenge cookie
+)
+
+// challengePage is served to challenged clients. Robots must not index it.
+const challengePage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex, nofollow">%s<title>Checking your browser</title></head>
+<body><p>Checking your browser, this page reloads automatically.</p>%s</body></html>
+`
+
+// challengeGate replaces country blocks with a challenge. The cookie is an HMAC over the client IP
+// and its expiry, so it cannot be shared between IPs or extended.
+type challengeGate struct {
+	secret     []byte
+	cookieName string
+	ttl        time.Duration
+	kind       string
+}
+
+// newChallengeGate validates the challenge settings. Returns nil unless BanMode is "challenge".
+func newChallengeGate(cfg *Config) (*challengeGate, error) {
+	switch strings.ToLower(cfg.BanMode) {
+	case "", BanModeBlock, BanModeDrop:
+		return nil, nil
+	case BanModeChallenge:
+	default:
+		return nil, fmt.Errorf("invalid BanMode %q, must be one of: %s, %s, %s", cfg.BanMode, BanModeBlock, BanModeChallenge, BanModeDrop)
+	}
+
+	if len(cfg.ChallengeSecret) < 16 {
+		return nil, fmt.Errorf("BanMode %q needs a ChallengeSecret of at least 16 characters", BanModeChallenge)
+	}
+	if cfg.ChallengeCookieName == "" || cfg.ChallengeTTLSeconds <= 0 {
+		return nil, fmt.Errorf("BanMode %q needs ChallengeCookieName and a positive ChallengeTTLSeconds", BanModeChallenge)
+	}
+	if !validCookieName(cfg.ChallengeCookieName) {
+		return nil, fmt.Errorf("invalid ChallengeCookieName %q, only letters, digits, '_' and '-' are allowed", cfg.ChallengeCookieName)
+	}
+
+	kind := strings.ToLower(cfg.ChallengeType)
+	switch kind {
+	case "":
+		kind = ChallengeTypeJS
+	case ChallengeTypeJS, ChallengeTypeCookie:
+	default:
+		return nil, fmt.Errorf("invalid ChallengeType %q, must be one of: %s, %s", cfg.ChallengeType, ChallengeTypeJS, ChallengeTypeCookie)
+	}
+
+	return &challengeGate{
+		secret:     []byte(cfg.ChallengeSecret),
+		cookieName: cfg.ChallengeCookieName,
+		ttl:        time.Duration(cfg.ChallengeTTLSeconds) * time.Second,
+		kind:       kind,
+	}, nil
+}
+
+// validCookieName reports whether the name only has letters, digits, '_' and '-', which are safe
+// in Set-Cookie headers and script strings alike
+func validCookieName(name string) bool {
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// applies reports whether a blocked decision can be challenged. Only country blocks are, on requests
+// a page reload can repeat.
+func (g *challengeGate) applies(req *http.Request, decision ipDecision) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return decision.err == nil && decision.ip != "" && isCountryBlockPhase(decision.phase)
+}
+
+// passed reports whether the request carries a valid cookie for the IP
+func (g *challengeGate) passed(req *http.Request, ip string, now time.Time) bool {
+	cookie, err := req.Cookie(g.cookieName)
+	if err != nil {
+		return false
+	}
+	expiry, signature, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(g.sign(ip, expiry)))
+}
+
+// token returns a cookie value for the IP valid for the TTL
+func (g *challengeGate) token(ip string, now time.Time) string {
+	expiry := strconv.FormatInt(now.Add(g.ttl).Unix(), 10)
+	return expiry + "." + g.sign(ip, expiry)
+}
+
+// sign returns the HMAC of the IP and expiry
+func (g *challengeGate) sign(ip, expiry string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(ip + "|" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// serve writes the challenge page for the IP
+func (g *challengeGate) serve(rw http.ResponseWriter, ip string, statusCode int, now time.Time) {
+	token := g.token(ip, now)
+	maxAge := int(g.ttl.Seconds())
+
+	var head, body string
+	switch g.kind {
+	case ChallengeTypeCookie:
+		http.SetCookie(rw, &http.Cookie{
+			Name:     g.cookieName,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   maxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		head = `<meta http-equiv="refresh" content="1">`
+	default:
+		// The cookie name is validated and the token is base64url, both are safe in a script string
+		body = fmt.Sprintf(`<noscript><p>Please enable JavaScript to continue.</p></noscript>
+<script>document.cookie=%q;location.reload();</script>`,
+			fmt.Sprintf("%s=%s; path=/; max-age=%d; SameSite=Lax", g.cookieName, token, maxAge))
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(statusCode)
+	fmt.Fprintf(rw, challengePage, head, body)
+}
@@ -0,0 +1,117 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChallenge(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	for _, kind := range []string{ChallengeTypeJS, ChallengeTypeCookie} {
+		t.Run(kind, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.DefaultAllow = true
+			cfg.BlockedCountries = []string{"US"}
+			cfg.BlockedIPBlocks = []string{"8.8.4.8/32"}
+			cfg.BanMode = BanModeChallenge
+			cfg.ChallengeType = kind
+			cfg.ChallengeSecret = "0123456789abcdef"
+			cfg.RemediationHeadersCustomName = "X-Geoblock-Phase"
+
+			plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			defer plugin.Close()
+
+			serve := func(method, ip string, cookie *http.Cookie) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, "/", nil)
+				req.Header.Set("X-Real-IP", ip)
+				if cookie != nil {
+					req.AddCookie(cookie)
+				}
+				rr := httptest.NewRecorder()
+				plugin.ServeHTTP(rr, req)
+				return rr
+			}
+
+			rr := serve(http.MethodGet, "8.8.8.8", nil)
+			if rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseChallenge {
+				t.Fatalf("expected a challenge, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+			}
+			if rr.Header().Get("Cache-Control") != "no-store" {
+				t.Error("expected the challenge page not to be cached")
+			}
+			body := rr.Body.String()
+			switch kind {
+			case ChallengeTypeJS:
+				if !strings.Contains(body, "document.cookie=") || len(rr.Result().Cookies()) != 0 {
+					t.Errorf("expected the cookie to be set from the script, got %q", body)
+				}
+			case ChallengeTypeCookie:
+				if !strings.Contains(body, `http-equiv="refresh"`) || len(rr.Result().Cookies()) != 1 {
+					t.Errorf("expected a Set-Cookie and a meta refresh, got %q", body)
+				}
+			}
+
+			valid := &http.Cookie{Name: "geoblock_challenge", Value: plugin.challenge.token("8.8.8.8", time.Now())}
+			if rr := serve(http.MethodGet, "8.8.8.8", valid); rr.Code != http.StatusTeapot {
+				t.Errorf("expected a valid cookie to pass, got %d", rr.Code)
+			}
+			if rr := serve(http.MethodGet, "8.8.4.4", valid); rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseChallenge {
+				t.Errorf("expected a cookie for another IP to be challenged, got %d", rr.Code)
+			}
+			expired := &http.Cookie{Name: "geoblock_challenge", Value: plugin.challenge.token("8.8.8.8", time.Now().Add(-2*time.Hour))}
+			if rr := serve(http.MethodGet, "8.8.8.8", expired); rr.Code != http.StatusForbidden {
+				t.Errorf("expected an expired cookie to be challenged, got %d", rr.Code)
+			}
+			expiry, signature, _ := strings.Cut(valid.Value, ".")
+			tampered := &http.Cookie{Name: "geoblock_challenge", Value: expiry + "0." + signature}
+			if rr := serve(http.MethodGet, "8.8.8.8", tampered); rr.Code != http.StatusForbidden {
+				t.Errorf("expected an extended cookie to be challenged, got %d", rr.Code)
+			}
+			if rr := serve(http.MethodPost, "8.8.8.8", nil); rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseBlockedCountry {
+				t.Errorf("expected a POST to get the ban, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+			}
+			if rr := serve(http.MethodGet, "8.8.4.8", &http.Cookie{Name: "geoblock_challenge", Value: plugin.challenge.token("8.8.4.8", time.Now())}); rr.Header().Get("X-Geoblock-Phase") != PhaseBlockedIPBlock {
+				t.Errorf("expected an IP block not to be challenged, got %q", rr.Header().Get("X-Geoblock-Phase"))
+			}
+			if rr := serve(http.MethodGet, "1.1.1.1", nil); rr.Code != http.StatusTeapot {
+				t.Errorf("expected allowed countries not to be challenged, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestChallenge_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"unknown mode", Config{BanMode: "tarpit"}, "invalid BanMode"},
+		{"short secret", Config{BanMode: "challenge", ChallengeSecret: "short", ChallengeCookieName: "c", ChallengeTTLSeconds: 60}, "at least 16"},
+		{"no TTL", Config{BanMode: "challenge", ChallengeSecret: "0123456789abcdef", ChallengeCookieName: "c"}, "ChallengeTTLSeconds"},
+		{"cookie name", Config{BanMode: "challenge", ChallengeSecret: "0123456789abcdef", ChallengeCookieName: "a;b", ChallengeTTLSeconds: 60}, "ChallengeCookieName"},
+		{"unknown type", Config{BanMode: "challenge", ChallengeType: "captcha", ChallengeSecret: "0123456789abcdef", ChallengeCookieName: "c", ChallengeTTLSeconds: 60}, "invalid ChallengeType"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newChallengeGate(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+
+	if gate, err := newChallengeGate(&Config{}); gate != nil || err != nil {
+		t.Errorf("expected the block mode to disable the challenge, got %v/%v", gate, err)
+	}
+}
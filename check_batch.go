@@ -0,0 +1,39 @@
+package traefik_geoblock
+
+// CheckResult is the decision for one IP of a CheckAllowedBatch call
+type CheckResult struct {
+	IP      string `json:"ip"`
+	Allowed bool   `json:"allowed"`
+	Country string `json:"country,omitempty"`
+	Phase   string `json:"phase,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CheckAllowedBatch runs every IP through the same rules as CheckAllowed and returns one result per IP,
+// in the input order. The configuration overlay is resolved once for the whole batch and repeated IPs are
+// only evaluated once, which makes it suited to bulk log analysis and offline audits.
+func (p Plugin) CheckAllowedBatch(ips []string) []CheckResult {
+	if p.configOverlay != nil {
+		p.configOverlay.apply(&p)
+	}
+
+	results := make([]CheckResult, len(ips))
+	evaluated := make(map[string]CheckResult, len(ips))
+	for i, ip := range ips {
+		result, ok := evaluated[ip]
+		if !ok {
+			result = CheckResult{IP: ip}
+			allowed, country, phase, _, err := p.checkIP(ip)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Allowed = allowed
+				result.Country = country
+				result.Phase = phase
+			}
+			evaluated[ip] = result
+		}
+		results[i] = result
+	}
+	return results
+}
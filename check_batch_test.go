@@ -0,0 +1,42 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckAllowedBatch(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	results := plugin.CheckAllowedBatch([]string{"1.1.1.1", "8.8.8.8", "not-an-ip", "1.1.1.1"})
+	want := []CheckResult{
+		{IP: "1.1.1.1", Allowed: true, Country: "AU", Phase: PhaseAllowedCountry},
+		{IP: "8.8.8.8", Allowed: false, Country: "US", Phase: PhaseDefaultAllow},
+		{IP: "not-an-ip", Error: (&ipParseError{ip: "not-an-ip"}).Error()},
+		{IP: "1.1.1.1", Allowed: true, Country: "AU", Phase: PhaseAllowedCountry},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(results))
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d: expected %+v, got %+v", i, want[i], results[i])
+		}
+		if results[i].Error != "" {
+			continue
+		}
+		allowed, country, phase, _ := plugin.CheckAllowed(want[i].IP)
+		if allowed != results[i].Allowed || country != results[i].Country || phase != results[i].Phase {
+			t.Errorf("result %d differs from CheckAllowed: %v %s %s", i, allowed, country, phase)
+		}
+	}
+}
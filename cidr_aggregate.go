@@ -0,0 +1,100 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// aggregatePrefix is a CIDR block normalized for aggregation. IPv4 blocks use the first 4 bytes of addr.
+type aggregatePrefix struct {
+	addr      [16]byte
+	prefixLen int
+}
+
+// bit returns the bit at position i, most significant first
+func (p aggregatePrefix) bit(i int) byte {
+	return (p.addr[i/8] >> (7 - i%8)) & 1
+}
+
+// contains reports whether other lies within p
+func (p aggregatePrefix) contains(other aggregatePrefix) bool {
+	if other.prefixLen < p.prefixLen {
+		return false
+	}
+	return maskPrefix(other.addr, p.prefixLen) == p.addr
+}
+
+// maskPrefix clears every bit after the first prefixLen bits
+func maskPrefix(addr [16]byte, prefixLen int) [16]byte {
+	for i := prefixLen; i < 128; i++ {
+		addr[i/8] &^= 1 << (7 - i%8)
+	}
+	return addr
+}
+
+// aggregateCIDRs merges contained and adjacent blocks into the smallest equivalent list.
+// Every address covered by the input stays covered and no other address becomes covered.
+func aggregateCIDRs(blocks []*net.IPNet) []*net.IPNet {
+	var v4, v6 []aggregatePrefix
+	for _, block := range blocks {
+		prefixLen, bits := block.Mask.Size()
+		var prefix aggregatePrefix
+		if ip4 := block.IP.To4(); ip4 != nil && bits == 32 {
+			copy(prefix.addr[:], ip4)
+			prefix.prefixLen = prefixLen
+			prefix.addr = maskPrefix(prefix.addr, prefixLen)
+			v4 = append(v4, prefix)
+			continue
+		}
+		copy(prefix.addr[:], block.IP.To16())
+		prefix.prefixLen = prefixLen
+		prefix.addr = maskPrefix(prefix.addr, prefixLen)
+		v6 = append(v6, prefix)
+	}
+
+	result := make([]*net.IPNet, 0, len(blocks))
+	for _, prefix := range aggregatePrefixes(v4) {
+		result = append(result, &net.IPNet{IP: net.IP(append([]byte(nil), prefix.addr[:4]...)), Mask: net.CIDRMask(prefix.prefixLen, 32)})
+	}
+	for _, prefix := range aggregatePrefixes(v6) {
+		result = append(result, &net.IPNet{IP: net.IP(append([]byte(nil), prefix.addr[:]...)), Mask: net.CIDRMask(prefix.prefixLen, 128)})
+	}
+	return result
+}
+
+// aggregatePrefixes aggregates prefixes of a single address family
+func aggregatePrefixes(prefixes []aggregatePrefix) []aggregatePrefix {
+	// Sorted by address and then by size, a block can only be contained in the last kept one
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := bytes.Compare(prefixes[i].addr[:], prefixes[j].addr[:]); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].prefixLen < prefixes[j].prefixLen
+	})
+
+	var stack []aggregatePrefix
+	for _, prefix := range prefixes {
+		if len(stack) > 0 && stack[len(stack)-1].contains(prefix) {
+			continue
+		}
+		stack = append(stack, prefix)
+
+		// Collapse sibling pairs into their parent as long as possible
+		for len(stack) >= 2 {
+			low, high := stack[len(stack)-2], stack[len(stack)-1]
+			length := high.prefixLen
+			if length == 0 || low.prefixLen != length || low.bit(length-1) != 0 {
+				break
+			}
+			sibling := low
+			sibling.addr[(length-1)/8] |= 1 << (7 - (length-1)%8)
+			if sibling.addr != high.addr {
+				break
+			}
+			low.prefixLen--
+			stack = append(stack[:len(stack)-2], low)
+		}
+	}
+	return stack
+}
@@ -0,0 +1,98 @@
+package traefik_geoblock
+
+import (
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func parseCIDRs(t *testing.T, cidrs []string) []*net.IPNet {
+	t.Helper()
+	blocks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("invalid CIDR %q: %v", cidr, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func TestAggregateCIDRs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{"Empty", nil, []string{}},
+		{"Contained", []string{"10.1.0.0/16", "10.0.0.0/8", "10.1.2.3/32"}, []string{"10.0.0.0/8"}},
+		{"Adjacent", []string{"192.168.1.0/24", "192.168.0.0/24"}, []string{"192.168.0.0/23"}},
+		{"Cascade", []string{"1.0.0.0/24", "1.0.1.0/24", "1.0.2.0/23", "1.0.4.0/22"}, []string{"1.0.0.0/21"}},
+		{"NotSiblings", []string{"1.0.1.0/24", "1.0.2.0/24"}, []string{"1.0.1.0/24", "1.0.2.0/24"}},
+		{"Duplicates", []string{"8.8.8.8/32", "8.8.8.8/32"}, []string{"8.8.8.8/32"}},
+		{"Unmasked", []string{"10.0.0.5/24", "10.0.1.9/24"}, []string{"10.0.0.0/23"}},
+		{"Families", []string{"2001:db8::/33", "2001:db8:8000::/33", "0.0.0.0/1", "128.0.0.0/1"}, []string{"0.0.0.0/0", "2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, block := range aggregateCIDRs(parseCIDRs(t, tt.in)) {
+				got = append(got, block.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aggregateCIDRs(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAggregateCIDRs_Coverage checks random lists cover exactly the same addresses after aggregation
+func TestAggregateCIDRs_Coverage(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var cidrs []string
+	for i := 0; i < 500; i++ {
+		ip := net.IPv4(10, byte(random.Intn(4)), byte(random.Intn(256)), byte(random.Intn(256)))
+		block := &net.IPNet{IP: ip.Mask(net.CIDRMask(20+random.Intn(13), 32)), Mask: net.CIDRMask(20+random.Intn(13), 32)}
+		block.IP = block.IP.Mask(block.Mask)
+		cidrs = append(cidrs, block.String())
+	}
+	original, _ := NewIpLookupHelper(cidrs)
+	aggregated := NewEmptyIpLookupHelper()
+	for _, block := range aggregateCIDRs(parseCIDRs(t, cidrs)) {
+		aggregated.addBlock(block)
+	}
+	if aggregated.Count() >= original.Count() {
+		t.Errorf("expected fewer blocks after aggregation, got %d from %d", aggregated.Count(), original.Count())
+	}
+	for i := 0; i < 20000; i++ {
+		ip := net.IPv4(10, byte(random.Intn(5)), byte(random.Intn(256)), byte(random.Intn(256)))
+		want, _, _ := original.IsContained(ip)
+		got, _, _ := aggregated.IsContained(ip)
+		if got != want {
+			t.Fatalf("%s: contained %v after aggregation, %v before", ip, got, want)
+		}
+	}
+}
+
+func TestIpLookupFileMonitor_Aggregate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	tempDir := t.TempDir()
+	writeBlocksFile(t, filepath.Join(tempDir, "feed.txt"), []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.0.7/32", "2001:db8::/32"})
+
+	monitor, err := newIpLookupFileMonitorWithOptions([]string{"10.0.1.0/24"}, tempDir, ipBlockLoadOptions{aggregate: true}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	if monitor.Count() != 2 || monitor.Collapsed() != 3 {
+		t.Errorf("expected 2 blocks with 3 collapsed, got %d with %d collapsed", monitor.Count(), monitor.Collapsed())
+	}
+	contained, prefixLen, _ := monitor.IsContained(net.ParseIP("10.0.1.200"))
+	if !contained || prefixLen != 23 {
+		t.Errorf("expected 10.0.1.200 in the merged /23, got contained=%v prefix=%d", contained, prefixLen)
+	}
+}
@@ -0,0 +1,32 @@
+package traefik_geoblock
+
+import "time"
+
+// Clock is the time source for update scheduling and buffered log flushing, so tests can
+// simulate days of tickers and database aging without sleeping
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the part of time.Ticker used by the scheduling code
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the real clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+// systemTicker adapts time.Ticker to Ticker
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.ticker.C }
+
+func (t systemTicker) Stop() { t.ticker.Stop() }
@@ -0,0 +1,197 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced Clock. Tickers fire once per period crossed by Advance,
+// dropping ticks the receiver has not consumed yet like time.Ticker does.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	clock  *fakeClock
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ticker := &fakeTicker{clock: c, period: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the clock forward and fires the tickers that came due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, ticker := range c.tickers {
+		for !ticker.next.After(c.now) {
+			select {
+			case ticker.ch <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// waitFor polls cond, for effects of background goroutines woken by a fake tick
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger and a test reading it concurrently
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestBufferedFileWriter_FakeClock(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "geoblock.log")
+	writer, err := newBufferedFileWriterWithClock(path, 1024, time.Minute, clock)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	defer writer.Close()
+
+	if _, err := writer.Write([]byte("first line\n")); err != nil {
+		t.Fatal(err)
+	}
+	readLog := func() string {
+		content, _ := os.ReadFile(path)
+		return string(content)
+	}
+
+	// Not flushed before the timeout, however long the test really takes
+	clock.Advance(59 * time.Second)
+	if content := readLog(); content != "" {
+		t.Fatalf("expected nothing flushed before the timeout, got %q", content)
+	}
+
+	clock.Advance(time.Second)
+	waitFor(t, "timed flush", func() bool { return readLog() == "first line\n" })
+}
+
+func TestDatabaseFactory_FakeClockSchedulesUpdates(t *testing.T) {
+	// The tiny database is from 2025-04-01
+	clock := newFakeClock(time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC))
+	logs := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	updateDir := t.TempDir()
+	factory, err := newDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:      tinyDbFilePath,
+		DatabaseAutoUpdate:    true,
+		DatabaseAutoUpdateDir: updateDir,
+	}, logger, clock)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	waitFor(t, "first update check", func() bool {
+		return strings.Contains(logs.String(), "checkAndUpdate: database is recent, skipping update")
+	})
+	if strings.Contains(logs.String(), "more than 2 months old") {
+		t.Error("expected no age warning for a database that is one day old")
+	}
+
+	// A month later the daily ticker finds the database old. A recent file in the update directory
+	// keeps UpdateIfNeeded from downloading anything.
+	if err := copyFile(tinyDbFilePath, filepath.Join(updateDir, "20250501_IP2LOCATION-LITE-DB1.IPV6.BIN"), true); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(35 * 24 * time.Hour)
+	waitFor(t, "scheduled update check", func() bool {
+		return strings.Contains(logs.String(), "checkAndUpdate: database is old, attempting download update")
+	})
+	waitFor(t, "update check result", func() bool {
+		return strings.Contains(logs.String(), "checkAndUpdate: no new database found after update attempt")
+	})
+}
+
+func TestUpdateIfNeeded_FakeClock(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &Config{DatabaseAutoUpdateDir: t.TempDir()}
+	dbPath := "20250401_IP2LOCATION-LITE-DB1.IPV6.BIN"
+
+	// 30 days old is still recent, nothing is downloaded
+	clock := newFakeClock(time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err := updateIfNeeded(dbPath, true, logger, cfg, clock); err != nil {
+		t.Errorf("expected no update for a 30 days old database, got %v", err)
+	}
+
+	// Older databases are updated, unless another update holds a fresh lock
+	clock = newFakeClock(time.Now().Add(31 * 24 * time.Hour))
+	lockFile := filepath.Join(cfg.DatabaseAutoUpdateDir, "update.lock")
+	if err := os.WriteFile(lockFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(lockFile, clock.Now().Add(-time.Minute), clock.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateIfNeeded(dbPath, true, logger, cfg, clock); err != nil {
+		t.Errorf("expected the update to be skipped while locked, got %v", err)
+	}
+	if _, err := os.Stat(lockFile); err != nil {
+		t.Errorf("expected the fresh lock to be kept, got %v", err)
+	}
+}
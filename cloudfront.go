@@ -0,0 +1,271 @@
+package traefik_geoblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AWSIPRangesURL is the range file AWS publishes for all its services, CloudFront included
+const AWSIPRangesURL = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+
+// cloudFrontViewerCountryHeader is set by CloudFront when the origin request policy includes it
+const cloudFrontViewerCountryHeader = "CloudFront-Viewer-Country"
+
+// cloudFrontService is the service of the CloudFront edge ranges in the AWS range file
+const cloudFrontService = "CLOUDFRONT"
+
+// CloudFrontStats reports the CloudFront range refreshes
+type CloudFrontStats struct {
+	Enabled     bool      `json:"enabled"`
+	Ranges      int       `json:"ranges"`                // CloudFront ranges trusted, 0 until the first successful refresh
+	Refreshes   int64     `json:"refreshes"`             // Successful refreshes
+	Failures    int64     `json:"failures"`              // Failed refreshes, the previous ranges were kept
+	LastRefresh time.Time `json:"lastRefresh,omitempty"` // Time of the last successful refresh
+	LastError   string    `json:"lastError,omitempty"`   // Error of the last failed refresh, cleared by a success
+}
+
+// cloudFrontRanges holds the CloudFront edge ranges, so CloudFront-Viewer-Country is only trusted from
+// CloudFront itself. The ranges are downloaded in the background; until then no peer is trusted.
+type cloudFrontRanges struct {
+	mu     sync.RWMutex
+	ranges *IpLookupHelper
+	stats  CloudFrontStats
+
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	logger  *slog.Logger
+
+	key      string        // Entry in cloudFrontRangeLists
+	refCount int           // Plugin instances using the list, guarded by cloudFrontRangeListsMutex
+	stop     chan struct{} // Closed by releaseCloudFrontRanges when the last instance is closed
+}
+
+var (
+	// cloudFrontRangeLists shares one list (and one refresher) per configuration between plugin instances
+	cloudFrontRangeLists      = make(map[string]*cloudFrontRanges)
+	cloudFrontRangeListsMutex sync.Mutex
+)
+
+// newCloudFrontRanges starts refreshing the CloudFront ranges. Returns nil when TrustCloudFrontViewerCountry is disabled.
+func newCloudFrontRanges(cfg *Config, logger *slog.Logger) (*cloudFrontRanges, error) {
+	if !cfg.TrustCloudFrontViewerCountry {
+		return nil, nil
+	}
+	url := cfg.CloudFrontRangesURL
+	if url == "" {
+		url = AWSIPRangesURL
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid CloudFrontRangesURL %q, must be an http(s) URL", url)
+	}
+	if cfg.CloudFrontRefreshSeconds <= 0 {
+		return nil, fmt.Errorf("CloudFrontRefreshSeconds must be positive, got %d", cfg.CloudFrontRefreshSeconds)
+	}
+	refresh := time.Duration(cfg.CloudFrontRefreshSeconds) * time.Second
+
+	key := url + "|" + refresh.String()
+	cloudFrontRangeListsMutex.Lock()
+	defer cloudFrontRangeListsMutex.Unlock()
+	if existing, ok := cloudFrontRangeLists[key]; ok {
+		existing.refCount++
+		return existing, nil
+	}
+
+	list := &cloudFrontRanges{
+		ranges:   NewEmptyIpLookupHelper(),
+		stats:    CloudFrontStats{Enabled: true},
+		url:      url,
+		refresh:  refresh,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		logger:   logger,
+		key:      key,
+		refCount: 1,
+		stop:     make(chan struct{}),
+	}
+	go list.refreshLoop()
+
+	cloudFrontRangeLists[key] = list
+	return list, nil
+}
+
+// releaseCloudFrontRanges drops one reference to the list and stops its refresher once no plugin instance uses it
+func releaseCloudFrontRanges(list *cloudFrontRanges) {
+	cloudFrontRangeListsMutex.Lock()
+	defer cloudFrontRangeListsMutex.Unlock()
+
+	list.refCount--
+	if list.refCount > 0 {
+		return
+	}
+	if registered, exists := cloudFrontRangeLists[list.key]; exists && registered == list {
+		delete(cloudFrontRangeLists, list.key)
+	}
+	close(list.stop)
+}
+
+// contains reports whether the IP is a CloudFront edge
+func (c *cloudFrontRanges) contains(ip net.IP) bool {
+	c.mu.RLock()
+	ranges := c.ranges
+	c.mu.RUnlock()
+
+	found, _, _ := ranges.IsContained(ip)
+	return found
+}
+
+// snapshot returns the refresh stats
+func (c *cloudFrontRanges) snapshot() CloudFrontStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stats
+}
+
+// refreshLoop downloads the ranges now and then periodically until stopped, keeping the previous ranges on failure
+func (c *cloudFrontRanges) refreshLoop() {
+	ticker := time.NewTicker(c.refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := c.refreshRanges(); err != nil {
+			c.mu.Lock()
+			c.stats.Failures++
+			c.stats.LastError = err.Error()
+			trusted := c.stats.Ranges > 0
+			c.mu.Unlock()
+			if trusted {
+				c.logger.Warn("CloudFront range refresh failed, keeping previous ranges", "url", c.url, "error", err)
+			} else {
+				c.logger.Warn("CloudFront range download failed, CloudFront-Viewer-Country is ignored until it succeeds", "url", c.url, "error", err)
+			}
+		}
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRanges downloads the range file and swaps the CloudFront ranges in
+func (c *cloudFrontRanges) refreshRanges() error {
+	resp, err := c.client.Get(c.url) // #nosec G107
+	if err != nil {
+		return fmt.Errorf("failed to download AWS ranges: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download AWS ranges: status %d", resp.StatusCode)
+	}
+	blocks, err := parseCloudFrontRanges(resp.Body, c.url)
+	if err != nil {
+		return err
+	}
+
+	ranges := NewEmptyIpLookupHelper()
+	for _, cidr := range blocks {
+		if err := ranges.AddCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid range in %s: %w", c.url, err)
+		}
+	}
+	c.mu.Lock()
+	c.ranges = ranges
+	c.stats.Ranges = len(blocks)
+	c.stats.Refreshes++
+	c.stats.LastRefresh = time.Now()
+	c.stats.LastError = ""
+	c.mu.Unlock()
+	c.logger.Debug("CloudFront ranges refreshed", "ranges", len(blocks))
+	return nil
+}
+
+// parseCloudFrontRanges reads the CloudFront prefixes of the AWS range file. A file without any is rejected,
+// it would silently stop trusting CloudFront.
+func parseCloudFrontRanges(r io.Reader, source string) ([]string, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, 20<<20)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid AWS range file %s: %w", source, err)
+	}
+
+	var blocks []string
+	add := func(cidr, service string) error {
+		if service != cloudFrontService {
+			return nil
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid prefix in AWS range file %s: %q", source, cidr)
+		}
+		blocks = append(blocks, cidr)
+		return nil
+	}
+	for _, prefix := range feed.Prefixes {
+		if err := add(prefix.IPPrefix, prefix.Service); err != nil {
+			return nil, err
+		}
+	}
+	for _, prefix := range feed.IPv6Prefixes {
+		if err := add(prefix.IPv6Prefix, prefix.Service); err != nil {
+			return nil, err
+		}
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("AWS range file %s has no %s prefixes", source, cloudFrontService)
+	}
+	return blocks, nil
+}
+
+// CloudFrontStats reports the CloudFront range refreshes. Enabled is false unless TrustCloudFrontViewerCountry is set.
+func (p Plugin) CloudFrontStats() CloudFrontStats {
+	if p.cloudFront == nil {
+		return CloudFrontStats{}
+	}
+	return p.cloudFront.snapshot()
+}
+
+// withViewerCountry returns the plugin answering lookups of the CloudFront viewer with CloudFront-Viewer-Country,
+// when the direct peer is a CloudFront edge. The viewer is the IP of CloudFront-Viewer-Address, or else the
+// entry CloudFront appended to X-Forwarded-For. IP rules still apply, only the database lookup is skipped.
+func (p Plugin) withViewerCountry(req *http.Request) Plugin {
+	country := strings.ToUpper(strings.TrimSpace(req.Header.Get(cloudFrontViewerCountryHeader)))
+	if country == "" {
+		return p
+	}
+	peer := net.ParseIP(cleanIPAddress(req.RemoteAddr))
+	if peer == nil || !p.cloudFront.contains(peer) {
+		p.logger.Debug("ignoring CloudFront-Viewer-Country from a peer outside the CloudFront ranges", "remote_addr", req.RemoteAddr)
+		return p
+	}
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		p.logger.Debug("ignoring invalid CloudFront-Viewer-Country", "value", country)
+		return p
+	}
+
+	var viewer string
+	if address := req.Header.Get("CloudFront-Viewer-Address"); address != "" {
+		viewer = viewerAddressIP(address)
+	} else if forwarded := strings.Split(req.Header.Get("X-Forwarded-For"), ","); len(forwarded) > 0 {
+		viewer, _ = parseIPToken(forwarded[len(forwarded)-1])
+	}
+	if net.ParseIP(viewer) == nil {
+		return p
+	}
+	p.logger.Debug("using CloudFront-Viewer-Country", "ip", viewer, "country", country)
+	p.viewerIP, p.viewerCountry = viewer, country
+	return p
+}
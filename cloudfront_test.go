@@ -0,0 +1,162 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrustCloudFrontViewerCountry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"prefixes": [
+			{"ip_prefix": "192.0.2.0/24", "service": "CLOUDFRONT"},
+			{"ip_prefix": "198.51.100.0/24", "service": "EC2"}
+		], "ipv6_prefixes": []}`))
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"DE"}
+	cfg.BlockedIPBlocks = []string{"8.8.4.4/32"}
+	cfg.TrustCloudFrontViewerCountry = true
+	cfg.CloudFrontRangesURL = server.URL + "/ip-ranges.json"
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	waitFor(t, "CloudFront ranges", func() bool { return plugin.cloudFront.contains(net.ParseIP("192.0.2.1")) })
+	if stats := plugin.CloudFrontStats(); !stats.Enabled || stats.Ranges != 1 || stats.Refreshes != 1 || stats.LastError != "" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    int
+	}{
+		{"header from CloudFront", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "8.8.8.8", "CloudFront-Viewer-Country": "DE"}, http.StatusTeapot},
+		{"viewer address", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "8.8.8.8", "CloudFront-Viewer-Address": "8.8.8.8:51234", "CloudFront-Viewer-Country": "de"}, http.StatusTeapot},
+		{"country rules apply", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "85.214.132.1", "CloudFront-Viewer-Country": "US"}, http.StatusForbidden},
+		{"not CloudFront", "198.51.100.1:443", map[string]string{"X-Forwarded-For": "8.8.8.8", "CloudFront-Viewer-Country": "DE"}, http.StatusForbidden},
+		{"invalid country", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "8.8.8.8", "CloudFront-Viewer-Country": "D1"}, http.StatusForbidden},
+		{"IP rules apply", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "8.8.4.4", "CloudFront-Viewer-Country": "DE"}, http.StatusForbidden},
+		{"database without header", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "85.214.132.1"}, http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	cfg.CloudFrontRefreshSeconds = 0
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+		t.Error("expected an error for a zero refresh interval")
+	}
+}
+
+func TestCloudFrontRanges_FailureAndClose(t *testing.T) {
+	requests := make(chan struct{}, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests <- struct{}{}
+		http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.TrustCloudFrontViewerCountry = true
+	cfg.CloudFrontRangesURL = server.URL + "/ip-ranges.json"
+	cfg.CloudFrontRefreshSeconds = 1
+
+	first, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	second, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if first.cloudFront != second.cloudFront {
+		t.Fatal("expected both instances to share the ranges")
+	}
+
+	// The failed download is visible, no peer is trusted
+	waitFor(t, "failed refresh", func() bool { return second.CloudFrontStats().Failures > 0 })
+	if stats := second.CloudFrontStats(); stats.Ranges != 0 || stats.Refreshes != 0 || !strings.Contains(stats.LastError, "status 503") {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Closing the previous instance keeps the refresher running for the other one
+	list := second.cloudFront
+	first.Close()
+	<-requests
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the refresher to keep running while an instance uses it")
+	}
+	second.Close()
+
+	cloudFrontRangeListsMutex.Lock()
+	_, registered := cloudFrontRangeLists[list.key]
+	cloudFrontRangeListsMutex.Unlock()
+	if registered {
+		t.Error("expected the ranges to be removed from the registry")
+	}
+	select {
+	case <-requests:
+		t.Error("expected no refresh after the last instance was closed")
+	case <-time.After(2500 * time.Millisecond):
+	}
+}
+
+func TestParseCloudFrontRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		want    int
+		wantErr string
+	}{
+		{"both families", `{"prefixes": [{"ip_prefix": "13.32.0.0/15", "service": "CLOUDFRONT"}, {"ip_prefix": "3.5.140.0/22", "service": "AMAZON"}],
+			"ipv6_prefixes": [{"ipv6_prefix": "2600:9000::/28", "service": "CLOUDFRONT"}]}`, 2, ""},
+		{"invalid prefix", `{"prefixes": [{"ip_prefix": "13.32.0.0", "service": "CLOUDFRONT"}]}`, 0, "invalid prefix"},
+		{"no CloudFront prefixes", `{"prefixes": [{"ip_prefix": "3.5.140.0/22", "service": "AMAZON"}]}`, 0, "no CLOUDFRONT prefixes"},
+		{"not JSON", `13.32.0.0/15`, 0, "invalid AWS range file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseCloudFrontRanges(strings.NewReader(tt.feed), "test")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(blocks) != tt.want {
+				t.Errorf("expected %d prefixes, got %d", tt.want, len(blocks))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Command geoblock-authd serves the geoblock rules as a Traefik ForwardAuth endpoint, for deployments that
+// prefer the forwardAuth middleware over the Yaegi plugin, or that don't run Traefik's plugin system at all.
+//
+// Traefik sends the client request headers to the endpoint; a 2xx answer lets the request through and any
+// other answer (the ban page) is returned to the client:
+//
+//	http:
+//	  middlewares:
+//	    geoblock:
+//	      forwardAuth:
+//	        address: "http://geoblock-authd:8080/auth"
+//	        trustForwardHeader: true
+//	        authResponseHeaders:
+//	          - "X-IPCountry"
+//
+// The configuration file is the JSON form of the plugin configuration (same option names as the Traefik
+// dynamic configuration), applied on top of the defaults. The plugin is always enabled.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+func main() {
+	var configPath string
+	var listen string
+	var authPath string
+
+	flag.StringVar(&configPath, "config", "", "Path to the JSON plugin configuration")
+	flag.StringVar(&listen, "listen", ":8080", "Address to listen on")
+	flag.StringVar(&authPath, "path", "/auth", "Path of the ForwardAuth endpoint")
+	flag.Parse()
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatalf("loading configuration failed: %v", err)
+	}
+
+	plugin, err := geoblock.NewFromOptions(geoblock.WithConfig(cfg), geoblock.WithName("geoblock-authd"))
+	if err != nil {
+		log.Fatalf("creating geoblock failed: %v", err)
+	}
+	defer plugin.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle(authPath, newAuthHandler(plugin, cfg))
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("geoblock-authd listening on %s%s", listen, authPath)
+	log.Fatal(server.ListenAndServe())
+}
+
+// loadConfig reads the JSON configuration on top of the plugin defaults
+func loadConfig(path string) (*geoblock.Config, error) {
+	cfg := geoblock.CreateConfig()
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, cfg); err != nil {
+			return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+		}
+	}
+	cfg.Enabled = true
+	return cfg, nil
+}
+
+// newAuthHandler adapts ForwardAuth requests to the plugin. Traefik describes the original request in
+// X-Forwarded-* headers, which are restored so ignoreVerbs, bypass rules and logs see the real request.
+// Allowed requests get a 200 carrying the request headers set by the plugin (country, verdict), for
+// authResponseHeaders to copy them to the upstream request.
+func newAuthHandler(plugin *geoblock.Plugin, cfg *geoblock.Config) http.Handler {
+	forwarded := []string{cfg.CountryHeader, cfg.VerdictHeader}
+	allow := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		for _, header := range forwarded {
+			if header == "" {
+				continue
+			}
+			for _, value := range req.Header.Values(header) {
+				rw.Header().Add(header, value)
+			}
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+	checked := plugin.Wrap(allow)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		original := req.Clone(req.Context())
+		if method := req.Header.Get("X-Forwarded-Method"); method != "" {
+			original.Method = method
+		}
+		if host := req.Header.Get("X-Forwarded-Host"); host != "" {
+			original.Host = host
+		}
+		if uri := req.Header.Get("X-Forwarded-Uri"); uri != "" {
+			if parsed, err := original.URL.Parse(uri); err == nil {
+				original.URL = parsed
+			}
+		}
+		checked.ServeHTTP(rw, original)
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+const tinyDbFilePath = "../../testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN"
+
+func TestAuthHandler(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "geoblock.json")
+	config := `{
+		"databaseFilePath": "` + tinyDbFilePath + `",
+		"allowedCountries": ["AU"],
+		"ignoreVerbs": ["OPTIONS"],
+		"countryHeader": "X-IPCountry",
+		"logLevel": "error"
+	}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	plugin, err := geoblock.NewFromOptions(geoblock.WithConfig(cfg))
+	if err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	defer plugin.Close()
+	handler := newAuthHandler(plugin, cfg)
+
+	tests := []struct {
+		name    string
+		ip      string
+		method  string
+		status  int
+		country string
+	}{
+		{name: "allowed country", ip: "1.1.1.1", method: http.MethodGet, status: http.StatusOK, country: "AU"},
+		{name: "blocked country", ip: "8.8.8.8", method: http.MethodGet, status: http.StatusForbidden},
+		{name: "ignored original verb", ip: "8.8.8.8", method: http.MethodOptions, status: http.StatusOK, country: "US"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ForwardAuth always uses GET, the original method comes in X-Forwarded-Method
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			req.Header.Set("X-Forwarded-For", tt.ip)
+			req.Header.Set("X-Forwarded-Method", tt.method)
+			req.Header.Set("X-Forwarded-Host", "example.com")
+			req.Header.Set("X-Forwarded-Uri", "/some/page?x=1")
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("X-IPCountry"); got != tt.country {
+				t.Errorf("expected country header %q, got %q", tt.country, got)
+			}
+		})
+	}
+}
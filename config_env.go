@@ -0,0 +1,157 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// resolveConfigEnv returns a copy of the configuration with ${NAME} references replaced by environment
+// variables, so secrets don't have to be committed to the dynamic configuration. Only secrets, paths, URLs
+// and the header maps are resolved; "$${" stands for a literal "${". An unset variable is an error.
+func resolveConfigEnv(cfg *Config) (*Config, error) {
+	resolved := *cfg
+
+	fields := []struct {
+		option string
+		value  *string
+	}{
+		{"DatabaseFilePath", &resolved.DatabaseFilePath},
+		{"DatabaseAutoUpdateDir", &resolved.DatabaseAutoUpdateDir},
+		{"DatabaseAutoUpdateToken", &resolved.DatabaseAutoUpdateToken},
+		{"DatabaseAutoUpdateCode", &resolved.DatabaseAutoUpdateCode},
+		{"DatabaseLocalCopyDir", &resolved.DatabaseLocalCopyDir},
+		{"DatabaseHotSwapWebhookURL", &resolved.DatabaseHotSwapWebhookURL},
+		{"DatabaseHeartbeatTarget", &resolved.DatabaseHeartbeatTarget},
+		{"AllowedIPBlocksDir", &resolved.AllowedIPBlocksDir},
+		{"BlockedIPBlocksDir", &resolved.BlockedIPBlocksDir},
+		{"ConfigOverlayFile", &resolved.ConfigOverlayFile},
+		{"CountryPolicyFile", &resolved.CountryPolicyFile},
+		{"ConsentRedirectURL", &resolved.ConsentRedirectURL},
+		{"MaintenanceHtmlFilePath", &resolved.MaintenanceHtmlFilePath},
+		{"DecisionServiceURL", &resolved.DecisionServiceURL},
+		{"CountryStatsFile", &resolved.CountryStatsFile},
+		{"StatsPushAddress", &resolved.StatsPushAddress},
+		{"CountryQuotaFile", &resolved.CountryQuotaFile},
+		{"AdminToken", &resolved.AdminToken},
+		{"ThreatIntelURL", &resolved.ThreatIntelURL},
+		{"RangeOverridesFile", &resolved.RangeOverridesFile},
+		{"DynamicBlocklistFile", &resolved.DynamicBlocklistFile},
+		{"LoadShedFile", &resolved.LoadShedFile},
+		{"DecisionLogFile", &resolved.DecisionLogFile},
+		{"BanExportFile", &resolved.BanExportFile},
+		{"BanHtmlFilePath", &resolved.BanHtmlFilePath},
+		{"BanAppealURL", &resolved.BanAppealURL},
+		{"ChallengeSecret", &resolved.ChallengeSecret},
+		{"DecisionCookieSecret", &resolved.DecisionCookieSecret},
+		{"BypassTokenSecret", &resolved.BypassTokenSecret},
+		{"LogPath", &resolved.LogPath},
+		{"LogHashSalt", &resolved.LogHashSalt},
+		{"CloudFrontRangesURL", &resolved.CloudFrontRangesURL},
+	}
+	for _, field := range fields {
+		value, err := expandEnv(*field.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.option, err)
+		}
+		*field.value = value
+	}
+
+	lists := []struct {
+		option string
+		values *[]string
+	}{
+		{"SearchEngineFeedURLs", &resolved.SearchEngineFeedURLs},
+		{"BogonFeedURLs", &resolved.BogonFeedURLs},
+		{"RegistrationFiles", &resolved.RegistrationFiles},
+	}
+	for _, list := range lists {
+		if len(*list.values) == 0 {
+			continue
+		}
+		values := make([]string, len(*list.values))
+		for i, value := range *list.values {
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", list.option, i, err)
+			}
+			values[i] = expanded
+		}
+		*list.values = values
+	}
+
+	// Header values often carry API keys, the copies keep the caller's maps untouched
+	headers := []struct {
+		option string
+		values *map[string]string
+	}{
+		{"DecisionServiceHeaders", &resolved.DecisionServiceHeaders},
+		{"ThreatIntelHeaders", &resolved.ThreatIntelHeaders},
+		{"StatsPushHeaders", &resolved.StatsPushHeaders},
+		{"BypassHeaders", &resolved.BypassHeaders},
+	}
+	for _, header := range headers {
+		if len(*header.values) == 0 {
+			continue
+		}
+		values := make(map[string]string, len(*header.values))
+		for name, value := range *header.values {
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%s]: %w", header.option, name, err)
+			}
+			values[name] = expanded
+		}
+		*header.values = values
+	}
+
+	return &resolved, nil
+}
+
+// expandEnv replaces ${NAME} references in a value. Unlike os.Expand, $NAME without braces is kept as is.
+func expandEnv(value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var expanded strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			expanded.WriteString(value)
+			return expanded.String(), nil
+		}
+		if start > 0 && value[start-1] == '$' {
+			expanded.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated environment reference in %q", value[start:])
+		}
+		name := value[start+2 : start+end]
+		if !isEnvName(name) {
+			return "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		expanded.WriteString(value[:start] + env)
+		value = value[start+end+1:]
+	}
+}
+
+// isEnvName reports whether name is a portable environment variable name
+func isEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GEOBLOCK_TEST_TOKEN", "s3cret")
+	t.Setenv("GEOBLOCK_TEST_EMPTY", "")
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"plain", "plain", ""},
+		{"${GEOBLOCK_TEST_TOKEN}", "s3cret", ""},
+		{"Bearer ${GEOBLOCK_TEST_TOKEN}!", "Bearer s3cret!", ""},
+		{"a${GEOBLOCK_TEST_EMPTY}b", "ab", ""},
+		{"$GEOBLOCK_TEST_TOKEN", "$GEOBLOCK_TEST_TOKEN", ""},
+		{"$${GEOBLOCK_TEST_TOKEN} ${GEOBLOCK_TEST_TOKEN}", "${GEOBLOCK_TEST_TOKEN} s3cret", ""},
+		{"${GEOBLOCK_TEST_UNSET}", "", "GEOBLOCK_TEST_UNSET is not set"},
+		{"${GEOBLOCK_TEST_TOKEN", "", "unterminated"},
+		{"${1NAME}", "", "invalid environment variable name"},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expandEnv(%q): expected error containing %q, got %q, %v", tt.value, tt.wantErr, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveConfigEnv(t *testing.T) {
+	t.Setenv("GEOBLOCK_TEST_DB", tinyDbFilePath)
+	t.Setenv("GEOBLOCK_TEST_ADMIN", "s3cret")
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = "${GEOBLOCK_TEST_DB}"
+	cfg.AdminPath = "/.geoblock"
+	cfg.AdminToken = "${GEOBLOCK_TEST_ADMIN}"
+	cfg.BypassHeaders = map[string]string{"X-Bypass": "${GEOBLOCK_TEST_ADMIN}"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	if plugin.admin.token != "s3cret" || plugin.bypassHeaders["X-Bypass"] != "s3cret" {
+		t.Errorf("expected the secrets to be resolved, got %q and %q", plugin.admin.token, plugin.bypassHeaders["X-Bypass"])
+	}
+	// The caller's configuration is left untouched
+	if cfg.AdminToken != "${GEOBLOCK_TEST_ADMIN}" || cfg.BypassHeaders["X-Bypass"] != "${GEOBLOCK_TEST_ADMIN}" {
+		t.Errorf("expected the configuration to keep its references, got %q and %q", cfg.AdminToken, cfg.BypassHeaders["X-Bypass"])
+	}
+
+	cfg.AdminToken = "${GEOBLOCK_TEST_MISSING}"
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil ||
+		!strings.Contains(err.Error(), "AdminToken: environment variable GEOBLOCK_TEST_MISSING is not set") {
+		t.Errorf("expected an error naming the option and the variable, got %v", err)
+	}
+}
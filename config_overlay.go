@@ -0,0 +1,274 @@
+package traefik_geoblock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigOverlay is the content of ConfigOverlayFile, the subset of the configuration that can change
+// without a provider reload. Missing fields keep the middleware configuration, empty lists clear it.
+type ConfigOverlay struct {
+	AllowedCountries []string `json:"allowedCountries"`
+	BlockedCountries []string `json:"blockedCountries"`
+	DefaultAllow     *bool    `json:"defaultAllow"`
+	AllowedIPBlocks  []string `json:"allowedIPBlocks"` // Replaces AllowedIPBlocks, AllowedIPBlocksDir is loaded again
+	BlockedIPBlocks  []string `json:"blockedIPBlocks"` // Replaces BlockedIPBlocks, BlockedIPBlocksDir is loaded again
+}
+
+// overlayRules are the rules of a middleware with the overlay applied
+type overlayRules struct {
+	global          countryRules
+	ipv4Rules       *countryRules
+	ipv6Rules       *countryRules
+	allowedIPBlocks *IpLookupFileMonitor
+	blockedIPBlocks *IpLookupFileMonitor
+}
+
+// overlayBase is what the overlay is applied to, provided by the latest plugin instance using the file
+type overlayBase struct {
+	cfg         *Config
+	rules       overlayRules // Rules of the instance without overlay
+	loadOptions ipBlockLoadOptions
+	interval    time.Duration
+	logger      *slog.Logger
+}
+
+// configOverlay watches ConfigOverlayFile and keeps the rules built from its latest valid content
+type configOverlay struct {
+	file     string
+	reloadMu sync.Mutex // Serializes reloads of the watcher and of new instances
+
+	mu      sync.RWMutex
+	base    overlayBase
+	content *ConfigOverlay // nil when the file doesn't exist
+	modTime time.Time
+	size    int64
+	rules   *overlayRules // nil without content
+
+	refCount int           // Plugin instances using the watcher, guarded by configOverlaysMutex
+	stop     chan struct{} // Closed by releaseConfigOverlay when the last instance is closed
+}
+
+var (
+	// configOverlays keeps one watcher per file across configuration reloads
+	configOverlays      = make(map[string]*configOverlay)
+	configOverlaysMutex sync.Mutex
+)
+
+// startConfigOverlay loads the overlay file and starts watching it, or hands the running watcher the
+// new base. An invalid file fails the plugin creation; later it only logs and keeps the last valid rules.
+// Returns nil when ConfigOverlayFile is empty.
+func startConfigOverlay(cfg *Config, rules overlayRules, loadOptions ipBlockLoadOptions, logger *slog.Logger) (*configOverlay, error) {
+	if cfg.ConfigOverlayFile == "" {
+		return nil, nil
+	}
+	if cfg.ConfigOverlayIntervalSeconds <= 0 {
+		return nil, fmt.Errorf("ConfigOverlayIntervalSeconds must be positive, got %d", cfg.ConfigOverlayIntervalSeconds)
+	}
+
+	configOverlaysMutex.Lock()
+	defer configOverlaysMutex.Unlock()
+
+	overlay, running := configOverlays[cfg.ConfigOverlayFile]
+	if !running {
+		overlay = &configOverlay{file: cfg.ConfigOverlayFile, stop: make(chan struct{})}
+	}
+	base := overlayBase{
+		cfg:         cfg,
+		rules:       rules,
+		loadOptions: loadOptions,
+		interval:    time.Duration(cfg.ConfigOverlayIntervalSeconds) * time.Second,
+		logger:      logger,
+	}
+	if err := overlay.reload(&base); err != nil {
+		return nil, err
+	}
+
+	overlay.refCount++
+	if !running {
+		configOverlays[cfg.ConfigOverlayFile] = overlay
+		go overlay.loop()
+	}
+	return overlay, nil
+}
+
+// releaseConfigOverlay drops one reference to the watcher and stops it once no plugin instance uses it
+func releaseConfigOverlay(overlay *configOverlay) {
+	configOverlaysMutex.Lock()
+	defer configOverlaysMutex.Unlock()
+
+	overlay.refCount--
+	if overlay.refCount > 0 {
+		return
+	}
+	if registered, exists := configOverlays[overlay.file]; exists && registered == overlay {
+		delete(configOverlays, overlay.file)
+	}
+	close(overlay.stop)
+}
+
+// loop checks the file after every interval until stopped
+func (o *configOverlay) loop() {
+	for {
+		o.mu.RLock()
+		interval, logger := o.base.interval, o.base.logger
+		o.mu.RUnlock()
+
+		select {
+		case <-o.stop:
+			return
+		case <-time.After(interval):
+		}
+		if err := o.reload(nil); err != nil {
+			logger.Warn("failed to apply config overlay, keeping the previous rules", "file", o.file, "error", err)
+		}
+	}
+}
+
+// reload rebuilds the rules on a new base, or with a nil base when the file changed since the last reload
+func (o *configOverlay) reload(newBase *overlayBase) error {
+	o.reloadMu.Lock()
+	defer o.reloadMu.Unlock()
+
+	o.mu.RLock()
+	base := o.base
+	o.mu.RUnlock()
+	if newBase != nil {
+		base = *newBase
+	}
+
+	info, err := os.Stat(o.file)
+	if errors.Is(err, os.ErrNotExist) {
+		o.mu.Lock()
+		removed := o.content != nil
+		o.base, o.content, o.rules, o.modTime, o.size = base, nil, nil, time.Time{}, 0
+		o.mu.Unlock()
+		if removed {
+			base.logger.Info("config overlay removed, using the middleware configuration", "file", o.file)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat config overlay %s: %w", o.file, err)
+	}
+
+	o.mu.RLock()
+	unchanged := info.ModTime().Equal(o.modTime) && info.Size() == o.size
+	o.mu.RUnlock()
+	if unchanged && newBase == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(o.file)
+	if err != nil {
+		return fmt.Errorf("failed to read config overlay %s: %w", o.file, err)
+	}
+	var content ConfigOverlay
+	if strings.EqualFold(filepath.Ext(o.file), ".csv") {
+		// A country policy export only sets the country lists, its row report is the error
+		if content.AllowedCountries, content.BlockedCountries, err = parseCountryPolicy(data, o.file); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(data, &content); err != nil {
+		return fmt.Errorf("invalid config overlay %s: %w", o.file, err)
+	}
+	rules, err := buildOverlayRules(&content, base)
+	if err != nil {
+		return fmt.Errorf("invalid config overlay %s: %w", o.file, err)
+	}
+
+	o.mu.Lock()
+	o.base, o.content, o.rules, o.modTime, o.size = base, &content, rules, info.ModTime(), info.Size()
+	o.mu.Unlock()
+	if !unchanged {
+		base.logger.Info("config overlay applied", "file", o.file,
+			"allowed_countries", len(rules.global.allowed),
+			"blocked_countries", len(rules.global.blocked),
+			"default_allow", rules.global.defaultAllow,
+			"allowed_ip_blocks", rules.allowedIPBlocks.Count(),
+			"blocked_ip_blocks", rules.blockedIPBlocks.Count())
+	}
+	return nil
+}
+
+// buildOverlayRules applies the overlay to the base rules, with the same validation as the configuration
+func buildOverlayRules(content *ConfigOverlay, base overlayBase) (*overlayRules, error) {
+	rules := base.rules
+	var err error
+	if content.AllowedCountries != nil {
+		if rules.global.allowed, err = countrySet("allowedCountries", content.AllowedCountries); err != nil {
+			return nil, err
+		}
+	}
+	if content.BlockedCountries != nil {
+		if rules.global.blocked, err = countrySet("blockedCountries", content.BlockedCountries); err != nil {
+			return nil, err
+		}
+	}
+	if content.DefaultAllow != nil {
+		rules.global.defaultAllow = *content.DefaultAllow
+	}
+
+	rules.global.blockFirst, err = validateCountryListPrecedence(base.cfg.CountryListPrecedence, "overlay", rules.global, base.logger)
+	if err != nil {
+		return nil, err
+	}
+	if rules.ipv4Rules, err = newCountryRules("IPv4Policy", base.cfg.IPv4Policy, rules.global); err != nil {
+		return nil, err
+	}
+	if rules.ipv6Rules, err = newCountryRules("IPv6Policy", base.cfg.IPv6Policy, rules.global); err != nil {
+		return nil, err
+	}
+
+	// The memory budget starts over with the trees the overlay keeps
+	loadOptions := base.loadOptions
+	loadOptions.memoryBudget = loadOptions.memoryBudget.renewed()
+	if content.AllowedIPBlocks == nil && rules.allowedIPBlocks != nil {
+		if err := loadOptions.memoryBudget.charge("allowed IP blocks in use", rules.allowedIPBlocks.MemoryBytes()); err != nil {
+			return nil, err
+		}
+	}
+	if content.BlockedIPBlocks == nil && rules.blockedIPBlocks != nil {
+		if err := loadOptions.memoryBudget.charge("blocked IP blocks in use", rules.blockedIPBlocks.MemoryBytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	if content.AllowedIPBlocks != nil {
+		allowedLoadOptions := loadOptions
+		allowedLoadOptions.allowList = true
+		rules.allowedIPBlocks, err = newIpLookupFileMonitorWithOptions(content.AllowedIPBlocks, base.cfg.AllowedIPBlocksDir, allowedLoadOptions, base.logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading allowed IP blocks: %w", err)
+		}
+	}
+	if content.BlockedIPBlocks != nil {
+		rules.blockedIPBlocks, err = newIpLookupFileMonitorWithOptions(content.BlockedIPBlocks, base.cfg.BlockedIPBlocksDir, loadOptions, base.logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading blocked IP blocks: %w", err)
+		}
+	}
+	return &rules, nil
+}
+
+// apply replaces the rules of a plugin copy with the overlay rules, so a request sees one consistent version
+func (o *configOverlay) apply(p *Plugin) {
+	o.mu.RLock()
+	rules := o.rules
+	o.mu.RUnlock()
+	if rules == nil {
+		return
+	}
+
+	p.allowedCountries, p.blockedCountries = rules.global.allowed, rules.global.blocked
+	p.defaultAllow, p.countryBlockFirst = rules.global.defaultAllow, rules.global.blockFirst
+	p.ipv4Rules, p.ipv6Rules = rules.ipv4Rules, rules.ipv6Rules
+	p.allowedIPBlocks, p.blockedIPBlocks = rules.allowedIPBlocks, rules.blockedIPBlocks
+}
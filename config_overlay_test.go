@@ -0,0 +1,88 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigOverlay(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	file := filepath.Join(t.TempDir(), "overlay.json")
+	defer func() {
+		configOverlaysMutex.Lock()
+		delete(configOverlays, file)
+		configOverlaysMutex.Unlock()
+	}()
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"allowedCountries": ["AU", "US"]}`)
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.ConfigOverlayFile = file
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	serve := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve("8.8.8.8"); code != http.StatusTeapot {
+		t.Errorf("expected the overlay to allow US, got %d", code)
+	}
+
+	write(`{"allowedCountries": ["AU", "US"], "blockedIPBlocks": ["1.1.1.0/24"]}`)
+	if err := plugin.configOverlay.reload(nil); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if code := serve("1.1.1.1"); code != http.StatusForbidden {
+		t.Errorf("expected the overlay IP block to block, got %d", code)
+	}
+	if allowed, _, phase, _ := plugin.CheckAllowed("1.1.1.1"); allowed || phase != PhaseBlockedIPBlock {
+		t.Errorf("expected CheckAllowed to see the overlay, got %v %s", allowed, phase)
+	}
+
+	// An invalid change keeps the last valid rules
+	write(`{"allowedCountries": `)
+	if err := plugin.configOverlay.reload(nil); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+	if code := serve("8.8.8.8"); code != http.StatusTeapot {
+		t.Errorf("expected the previous overlay to stay, got %d", code)
+	}
+
+	// Without the file the middleware configuration applies again
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.configOverlay.reload(nil); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if code := serve("8.8.8.8"); code != http.StatusForbidden {
+		t.Errorf("expected the configured rules without overlay, got %d", code)
+	}
+
+	// A new instance with an invalid overlay fails
+	write(`{"blockedIPBlocks": ["not-a-cidr"]}`)
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+		t.Error("expected an invalid overlay to fail the plugin creation")
+	}
+}
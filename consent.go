@@ -0,0 +1,123 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PhaseConsentRequired is used when a request is redirected to the consent URL
+const PhaseConsentRequired = "consent_required"
+
+// countryGroups are aliases that can be used in country lists and expand to their members
+var countryGroups = map[string][]string{
+	// European Union member states
+	"EU": {"AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR", "HU", "IE", "IT", "LV",
+		"LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK", "SI", "ES", "SE"},
+	// European Economic Area: EU plus Iceland, Liechtenstein and Norway
+	"EEA": {"AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR", "HU", "IE", "IT", "LV",
+		"LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK", "SI", "ES", "SE", "IS", "LI", "NO"},
+}
+
+// expandCountryGroups converts a country list to a set, expanding group aliases such as "EU"
+func expandCountryGroups(countries []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(countries))
+	for _, c := range countries {
+		if members, isGroup := countryGroups[strings.ToUpper(c)]; isGroup {
+			for _, m := range members {
+				set[m] = struct{}{}
+			}
+			continue
+		}
+		set[c] = struct{}{}
+	}
+	return set
+}
+
+// consentGate requires requests from some countries to some paths to carry a consent token
+type consentGate struct {
+	countries   map[string]struct{}
+	paths       []string // Path prefixes, empty means all paths
+	cookieName  string
+	headerName  string
+	redirectURL string
+	consentHost string // Host of the consent page, empty when redirectURL is relative
+	consentPath string // Path of the consent page, never gated so the redirect can't loop
+}
+
+// newConsentGate validates the consent settings. Returns nil when consent mode is disabled.
+func newConsentGate(cfg *Config) (*consentGate, error) {
+	if len(cfg.ConsentCountries) == 0 {
+		return nil, nil
+	}
+
+	if cfg.ConsentCookieName == "" && cfg.ConsentHeaderName == "" {
+		return nil, fmt.Errorf("ConsentCountries requires ConsentCookieName or ConsentHeaderName")
+	}
+	if cfg.ConsentRedirectURL == "" {
+		return nil, fmt.Errorf("ConsentCountries requires ConsentRedirectURL")
+	}
+	target, err := url.Parse(cfg.ConsentRedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ConsentRedirectURL: %w", err)
+	}
+	consentPath := target.Path
+	if consentPath == "" {
+		consentPath = "/"
+	}
+
+	return &consentGate{
+		countries:   expandCountryGroups(cfg.ConsentCountries),
+		paths:       cfg.ConsentPaths,
+		cookieName:  cfg.ConsentCookieName,
+		headerName:  cfg.ConsentHeaderName,
+		redirectURL: cfg.ConsentRedirectURL,
+		consentHost: hostName(target.Host),
+		consentPath: consentPath,
+	}, nil
+}
+
+// required reports whether the request must be redirected to collect consent
+func (g *consentGate) required(req *http.Request, country string) bool {
+	if _, gated := g.countries[country]; !gated {
+		return false
+	}
+	if req.URL.Path == g.consentPath && (g.consentHost == "" || g.consentHost == hostName(req.Host)) {
+		return false
+	}
+
+	if len(g.paths) > 0 {
+		matched := false
+		for _, prefix := range g.paths {
+			if strings.HasPrefix(req.URL.Path, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if g.headerName != "" && req.Header.Get(g.headerName) != "" {
+		return false
+	}
+	if g.cookieName != "" {
+		if cookie, err := req.Cookie(g.cookieName); err == nil && cookie.Value != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redirect sends the client to the consent URL, passing the original URL in the return_to parameter
+func (g *consentGate) redirect(rw http.ResponseWriter, req *http.Request) {
+	target, _ := url.Parse(g.redirectURL) // Validated in newConsentGate
+	query := target.Query()
+	query.Set("return_to", req.URL.RequestURI())
+	target.RawQuery = query.Encode()
+
+	http.Redirect(rw, req, target.String(), http.StatusFound)
+}
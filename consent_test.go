@@ -0,0 +1,158 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestConsentGate(t *testing.T) {
+	cfg := &Config{
+		Enabled:                      true,
+		DatabaseFilePath:             tinyDbFilePath,
+		AllowedCountries:             []string{"AU", "DE", "IE"},
+		DisallowedStatusCode:         http.StatusForbidden,
+		IPHeaders:                    []string{"x-real-ip"},
+		IPHeaderStrategy:             IPHeaderStrategyCheckAll,
+		ConsentCountries:             []string{"EU"},
+		ConsentPaths:                 []string{"/checkout"},
+		ConsentCookieName:            "consent",
+		ConsentHeaderName:            "X-Consent",
+		ConsentRedirectURL:           "https://example.com/consent?lang=en",
+		RemediationHeadersCustomName: "X-Geoblock-Action",
+		BypassHeaders:                map[string]string{"X-Bypass": "secret"},
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ip       string
+		path     string
+		prepare  func(req *http.Request)
+		redirect bool
+	}{
+		{name: "EU country on gated path", ip: "85.214.132.117", path: "/checkout/cart?id=1", redirect: true},
+		{name: "EU country on other path", ip: "85.214.132.117", path: "/products"},
+		{name: "non EU country on gated path", ip: "1.1.1.1", path: "/checkout"},
+		{name: "consent cookie present", ip: "85.214.132.117", path: "/checkout", prepare: func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: "consent", Value: "granted"})
+		}},
+		{name: "empty consent cookie", ip: "85.214.132.117", path: "/checkout", redirect: true, prepare: func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: "consent", Value: ""})
+		}},
+		{name: "consent header present", ip: "2a00:1450::1", path: "/checkout", prepare: func(req *http.Request) {
+			req.Header.Set("X-Consent", "granted")
+		}},
+		{name: "bypass header skips consent", ip: "85.214.132.117", path: "/checkout", prepare: func(req *http.Request) {
+			req.Header.Set("X-Bypass", "secret")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			if tt.prepare != nil {
+				tt.prepare(req)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if !tt.redirect {
+				if rr.Code != http.StatusTeapot {
+					t.Errorf("expected request to reach next handler, got status %d", rr.Code)
+				}
+				return
+			}
+
+			if rr.Code != http.StatusFound {
+				t.Fatalf("expected status %d, got %d", http.StatusFound, rr.Code)
+			}
+			if got := rr.Header().Get("X-Geoblock-Action"); got != PhaseConsentRequired {
+				t.Errorf("expected remediation header %q, got %q", PhaseConsentRequired, got)
+			}
+			location, err := url.Parse(rr.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("invalid Location header: %v", err)
+			}
+			if location.Host != "example.com" || location.Path != "/consent" {
+				t.Errorf("unexpected redirect target %s", location)
+			}
+			if got := location.Query().Get("lang"); got != "en" {
+				t.Errorf("expected existing query to be preserved, got lang=%q", got)
+			}
+			if got := location.Query().Get("return_to"); got != tt.path {
+				t.Errorf("expected return_to %q, got %q", tt.path, got)
+			}
+		})
+	}
+}
+
+func TestConsentGateSameHostPage(t *testing.T) {
+	for _, redirectURL := range []string{"/consent", "https://shop.example.com/consent"} {
+		gate, err := newConsentGate(&Config{ConsentCountries: []string{"EU"}, ConsentCookieName: "consent", ConsentRedirectURL: redirectURL})
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://shop.example.com/consent?return_to=%2F", nil)
+		if gate.required(req, "DE") {
+			t.Errorf("%s: expected the consent page not to redirect to itself", redirectURL)
+		}
+		req = httptest.NewRequest(http.MethodGet, "http://shop.example.com/consent/other", nil)
+		if !gate.required(req, "DE") {
+			t.Errorf("%s: expected other paths to stay gated", redirectURL)
+		}
+	}
+
+	// Another host serving the same path is still gated
+	gate, _ := newConsentGate(&Config{ConsentCountries: []string{"EU"}, ConsentCookieName: "consent", ConsentRedirectURL: "https://consent.example.com/consent"})
+	if !gate.required(httptest.NewRequest(http.MethodGet, "http://shop.example.com/consent", nil), "DE") {
+		t.Error("expected the path to be gated on other hosts")
+	}
+}
+
+func TestConsentGateValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing token source", cfg: Config{ConsentCountries: []string{"EU"}, ConsentRedirectURL: "https://example.com"}},
+		{name: "missing redirect URL", cfg: Config{ConsentCountries: []string{"EU"}, ConsentCookieName: "consent"}},
+		{name: "invalid redirect URL", cfg: Config{ConsentCountries: []string{"EU"}, ConsentCookieName: "consent", ConsentRedirectURL: "http://[::1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newConsentGate(&tt.cfg); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+
+	gate, err := newConsentGate(&Config{})
+	if err != nil || gate != nil {
+		t.Errorf("expected consent mode to be disabled without ConsentCountries, got %v, %v", gate, err)
+	}
+}
+
+func TestExpandCountryGroups(t *testing.T) {
+	set := expandCountryGroups([]string{"eu", "US"})
+	for _, code := range []string{"DE", "FR", "IE", "US"} {
+		if _, ok := set[code]; !ok {
+			t.Errorf("expected %s in expanded set", code)
+		}
+	}
+	if _, ok := set["NO"]; ok {
+		t.Error("NO is not an EU member")
+	}
+	if len(set) != 28 {
+		t.Errorf("expected 28 countries, got %d", len(set))
+	}
+}
@@ -0,0 +1,111 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// graceRules are the country rules of one configuration, resolved per address family
+type graceRules struct {
+	ipv4  countryRules
+	ipv6  countryRules
+	until time.Time // End of the grace period of the countries this configuration allowed, zero while it is active
+}
+
+// check applies the rules of the IP's address family
+func (r graceRules) check(ipAddr net.IP, country string) bool {
+	rules := r.ipv6
+	if ipAddr == nil || ipAddr.To4() != nil {
+		rules = r.ipv4
+	}
+	allow, _ := rules.check(country)
+	return allow
+}
+
+// countryGraceHistory holds the active rules of a middleware and the ones replaced within the grace period
+type countryGraceHistory struct {
+	current  graceRules
+	replaced []graceRules
+}
+
+var (
+	// countryGraceHistories survive Traefik configuration reloads, which create new plugin instances,
+	// keyed by middleware name
+	countryGraceHistories      = make(map[string]*countryGraceHistory)
+	countryGraceHistoriesMutex sync.Mutex
+)
+
+// countryGrace lets countries that a configuration change moved from allowed to blocked through for
+// a while, so sessions started before the deploy are not cut mid-transaction
+type countryGrace struct {
+	replaced []graceRules // Configurations replaced less than the grace period ago, oldest first
+}
+
+// newCountryGrace records the rules of a new configuration of the middleware and returns the
+// configurations replaced within CountryBlockGraceMinutes. Returns nil when no grace applies.
+func newCountryGrace(cfg *Config, name string, global countryRules, ipv4Rules, ipv6Rules *countryRules, now time.Time) (*countryGrace, error) {
+	if cfg.CountryBlockGraceMinutes < 0 {
+		return nil, fmt.Errorf("CountryBlockGraceMinutes must not be negative, got %d", cfg.CountryBlockGraceMinutes)
+	}
+
+	rules := graceRules{ipv4: global, ipv6: global}
+	if ipv4Rules != nil {
+		rules.ipv4 = *ipv4Rules
+	}
+	if ipv6Rules != nil {
+		rules.ipv6 = *ipv6Rules
+	}
+
+	countryGraceHistoriesMutex.Lock()
+	defer countryGraceHistoriesMutex.Unlock()
+
+	history, ok := countryGraceHistories[name]
+	if !ok {
+		// First configuration since startup, nothing was allowed before
+		countryGraceHistories[name] = &countryGraceHistory{current: rules}
+		return nil, nil
+	}
+
+	previous := history.current
+	history.current = rules
+	if cfg.CountryBlockGraceMinutes == 0 {
+		// Ends the grace periods still running from earlier changes too
+		history.replaced = nil
+		return nil, nil
+	}
+
+	grace := time.Duration(cfg.CountryBlockGraceMinutes) * time.Minute
+	previous.until = now.Add(grace)
+
+	var replaced []graceRules
+	for _, old := range append(history.replaced, previous) {
+		if now.Before(old.until) {
+			replaced = append(replaced, old)
+		}
+	}
+	history.replaced = replaced
+
+	if len(replaced) == 0 {
+		return nil, nil
+	}
+	return &countryGrace{replaced: replaced}, nil
+}
+
+// until returns the end of the grace period of a country the current rules block, and false
+// when no configuration replaced within the grace period allowed it
+func (g *countryGrace) until(decision ipDecision, now time.Time) (time.Time, bool) {
+	// Only the country lists and the default policy are compared between configurations
+	if (decision.phase != PhaseBlockedCountry && decision.phase != PhaseDefaultAllow) || isUnknownCountry(decision.country) {
+		return time.Time{}, false
+	}
+	ipAddr := net.ParseIP(decision.ip)
+	var until time.Time
+	for _, old := range g.replaced {
+		if now.Before(old.until) && old.until.After(until) && old.check(ipAddr, decision.country) {
+			until = old.until
+		}
+	}
+	return until, !until.IsZero()
+}
@@ -0,0 +1,76 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountryBlockGrace(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	const name = "grace-test"
+	defer func() {
+		countryGraceHistoriesMutex.Lock()
+		delete(countryGraceHistories, name)
+		countryGraceHistoriesMutex.Unlock()
+	}()
+
+	logs := &syncBuffer{}
+	reload := func(allowed []string, graceMinutes int) *Plugin {
+		cfg := CreateConfig()
+		cfg.Enabled = true
+		cfg.DatabaseFilePath = tinyDbFilePath
+		cfg.AllowedCountries = allowed
+		cfg.LogBannedRequests = true
+		cfg.CountryBlockGraceMinutes = graceMinutes
+		plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, name, nil)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		plugin.logger = slog.New(slog.NewTextHandler(logs, nil))
+		t.Cleanup(func() { plugin.Close() })
+		return plugin
+	}
+	serve := func(plugin *Plugin, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	reload([]string{"AU", "US"}, 30)
+
+	// US moves to blocked: let through and logged during the grace period
+	plugin := reload([]string{"AU"}, 30)
+	if code := serve(plugin, "8.8.8.8"); code != http.StatusTeapot {
+		t.Errorf("expected the newly blocked country to pass during the grace period, got %d", code)
+	}
+	if !strings.Contains(logs.String(), "would block (grace)") {
+		t.Errorf("expected a grace log line, got %q", logs.String())
+	}
+	if code := serve(plugin, "85.214.132.1"); code != http.StatusForbidden {
+		t.Errorf("expected a country that was never allowed to be blocked, got %d", code)
+	}
+
+	// An unrelated reload during the grace period keeps it
+	plugin = reload([]string{"AU", "IE"}, 30)
+	if code := serve(plugin, "8.8.8.8"); code != http.StatusTeapot {
+		t.Errorf("expected the grace period to survive a second reload, got %d", code)
+	}
+	if _, ok := plugin.countryGrace.until(ipDecision{blocked: true, ip: "8.8.8.8", country: "US", phase: PhaseDefaultAllow}, time.Now().Add(31*time.Minute)); ok {
+		t.Error("expected the grace period to end")
+	}
+
+	// Without a grace period the block applies immediately
+	plugin = reload([]string{"AU"}, 0)
+	if code := serve(plugin, "8.8.8.8"); code != http.StatusForbidden {
+		t.Errorf("expected an immediate block without grace period, got %d", code)
+	}
+}
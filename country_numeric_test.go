@@ -0,0 +1,88 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCountryNumericCodesCoverCountryNames(t *testing.T) {
+	seen := make(map[string]string, len(countryNumericCodes))
+	for numeric, code := range countryNumericCodes {
+		if len(numeric) != 3 {
+			t.Errorf("numeric code %q must have 3 digits", numeric)
+		}
+		if _, known := countryNames[code]; !known {
+			t.Errorf("numeric code %s maps to %s, which has no country name", numeric, code)
+		}
+		if previous, duplicate := seen[code]; duplicate {
+			t.Errorf("%s is mapped from both %s and %s", code, previous, numeric)
+		}
+		seen[code] = numeric
+	}
+	for code := range countryNames {
+		if _, ok := seen[code]; !ok {
+			t.Errorf("%s has no numeric code", code)
+		}
+	}
+}
+
+func TestCountrySet(t *testing.T) {
+	set, err := countrySet("AllowedCountries", []string{"276", "36", "US", "EU"})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	for _, want := range []string{"DE", "AU", "US", "EU"} {
+		if _, ok := set[want]; !ok {
+			t.Errorf("expected %s in %v", want, set)
+		}
+	}
+
+	for _, invalid := range []string{"999", "0276"} {
+		_, err := countrySet("BlockedCountries", []string{invalid})
+		if err == nil || !strings.Contains(err.Error(), `invalid BlockedCountries entry "`+invalid+`"`) {
+			t.Errorf("expected an error for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestNumericCountryRules(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"036"}                                  // Australia
+	cfg.IPv6Policy = AddressFamilyPolicy{AllowedCountries: []string{"372"}} // Ireland
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"1.1.1.1", http.StatusTeapot},
+		{"8.8.8.8", http.StatusForbidden},
+		{"2a00:1450::1", http.StatusTeapot},
+		{"2001:4860::1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", tt.ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.ip, tt.want, rr.Code)
+		}
+	}
+
+	cfg.IPv6Policy = AddressFamilyPolicy{BlockedCountries: []string{"900"}}
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil ||
+		!strings.Contains(err.Error(), "IPv6Policy.BlockedCountries") {
+		t.Errorf("expected an error naming the option, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Actions of the country policy file
+const (
+	CountryPolicyAllow = "allow"
+	CountryPolicyBlock = "block"
+)
+
+// maxReportedPolicyRows bounds the rows listed in the message of a CountryPolicyError
+const maxReportedPolicyRows = 10
+
+// CountryPolicyRowError is a row of the country policy file that doesn't validate
+type CountryPolicyRowError struct {
+	Line   int    // Line of the row in the file
+	Reason string // What is wrong with it
+}
+
+// CountryPolicyError lists every invalid row of a country policy file. None of the file is applied.
+type CountryPolicyError struct {
+	Source string
+	Rows   []CountryPolicyRowError
+}
+
+func (e *CountryPolicyError) Error() string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "invalid country policy %s: %d invalid rows", e.Source, len(e.Rows))
+	for i, row := range e.Rows {
+		if i == maxReportedPolicyRows {
+			fmt.Fprintf(&report, "; and %d more", len(e.Rows)-i)
+			break
+		}
+		fmt.Fprintf(&report, "; line %d: %s", row.Line, row.Reason)
+	}
+	return report.String()
+}
+
+// loadCountryPolicy reads CountryPolicyFile into the country lists. The file replaces AllowedCountries and
+// BlockedCountries, so setting both is an error rather than a guess at how to merge them.
+func loadCountryPolicy(cfg *Config) (allowed, blocked []string, err error) {
+	if len(cfg.AllowedCountries) > 0 || len(cfg.BlockedCountries) > 0 {
+		return nil, nil, fmt.Errorf("CountryPolicyFile replaces AllowedCountries and BlockedCountries, they can't be set with it")
+	}
+	data, err := os.ReadFile(cfg.CountryPolicyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read country policy %s: %w", cfg.CountryPolicyFile, err)
+	}
+	return parseCountryPolicy(data, cfg.CountryPolicyFile)
+}
+
+// parseCountryPolicy reads a country_code,action(,note) CSV as exported by spreadsheets: an optional header row,
+// a UTF-8 BOM and ";" or tab separators are accepted, "#" starts a comment line. Country codes can be alpha-2,
+// numeric or a group such as "EU". Every row is validated and all errors are returned in a *CountryPolicyError.
+func parseCountryPolicy(data []byte, source string) (allowed, blocked []string, err error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = policySeparator(data)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	type listing struct {
+		action string
+		line   int
+	}
+	listed := make(map[string]listing)
+	var rows []CountryPolicyRowError
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, CountryPolicyRowError{Line: parseErr.Line, Reason: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read country policy %s: %w", source, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		header := first && strings.EqualFold(record[0], "country_code")
+		first = false
+		if header || strings.Join(record, "") == "" {
+			continue
+		}
+		if len(record) < 2 {
+			rows = append(rows, CountryPolicyRowError{Line: line, Reason: "expected country_code,action(,note)"})
+			continue
+		}
+
+		countries, err := policyCountries(record[0])
+		if err != nil {
+			rows = append(rows, CountryPolicyRowError{Line: line, Reason: err.Error()})
+			continue
+		}
+		action := strings.ToLower(record[1])
+		if action != CountryPolicyAllow && action != CountryPolicyBlock {
+			rows = append(rows, CountryPolicyRowError{Line: line,
+				Reason: fmt.Sprintf("invalid action %q, must be %s or %s", record[1], CountryPolicyAllow, CountryPolicyBlock)})
+			continue
+		}
+		for _, code := range countries {
+			if previous, ok := listed[code]; ok && previous.action != action {
+				rows = append(rows, CountryPolicyRowError{Line: line,
+					Reason: fmt.Sprintf("%s is set to %s on line %d", code, previous.action, previous.line)})
+				break
+			}
+			listed[code] = listing{action: action, line: line}
+		}
+	}
+	if len(rows) > 0 {
+		return nil, nil, &CountryPolicyError{Source: source, Rows: rows}
+	}
+
+	// Non-nil lists, so an overlay file without blocks still clears the configured ones
+	allowed, blocked = []string{}, []string{}
+	for code, entry := range listed {
+		if entry.action == CountryPolicyAllow {
+			allowed = append(allowed, code)
+		} else {
+			blocked = append(blocked, code)
+		}
+	}
+	sort.Strings(allowed)
+	sort.Strings(blocked)
+	return allowed, blocked, nil
+}
+
+// policySeparator guesses the separator from the first line: spreadsheets in locales with a decimal
+// comma export ";", some export tabs
+func policySeparator(data []byte) rune {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	separator, count := ',', bytes.Count(firstLine, []byte(","))
+	if n := bytes.Count(firstLine, []byte(";")); n > count {
+		separator, count = ';', n
+	}
+	if n := bytes.Count(firstLine, []byte("\t")); n > count {
+		separator = '\t'
+	}
+	return separator
+}
+
+// policyCountries returns the alpha-2 codes of a country cell: a code, a numeric code or a group
+func policyCountries(value string) ([]string, error) {
+	upper := strings.ToUpper(value)
+	if members, isGroup := countryGroups[upper]; isGroup {
+		return members, nil
+	}
+	code, err := countryCode(upper)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country %q: %w", value, err)
+	}
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return nil, fmt.Errorf("invalid country %q, expected an ISO 3166-1 code or a group", value)
+	}
+	return []string{code}, nil
+}
@@ -0,0 +1,131 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCountryPolicy(t *testing.T) {
+	data := "\xef\xbb\xbfcountry_code;action;note\r\n" +
+		"us;Allow;Main market\r\n" +
+		"# Sanctions\r\n" +
+		"RU;block;\r\n" +
+		"643;block;Numeric code of RU\r\n" +
+		";;\r\n" +
+		"EEA;allow\r\n"
+	allowed, blocked, err := parseCountryPolicy([]byte(data), "policy.csv")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if len(allowed) != 31 || allowed[0] != "AT" || blocked == nil || !reflect.DeepEqual(blocked, []string{"RU"}) {
+		t.Errorf("unexpected lists %v and %v", allowed, blocked)
+	}
+
+	data = "DE,allow\nXYZ,block\nFR,deny\nES\nDE,block\n999,allow\n"
+	_, _, err = parseCountryPolicy([]byte(data), "policy.csv")
+	var policyErr *CountryPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a CountryPolicyError, got %v", err)
+	}
+	var lines []int
+	for _, row := range policyErr.Rows {
+		lines = append(lines, row.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 3, 4, 5, 6}) || !strings.Contains(err.Error(), "line 5: DE is set to allow on line 1") {
+		t.Errorf("unexpected report %v: %v", lines, err)
+	}
+}
+
+func TestCountryPolicyFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.csv")
+	if err := os.WriteFile(file, []byte("country_code,action,note\nUS,allow,\nDE,block,\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.CountryPolicyFile = file
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	for ip, want := range map[string]int{"8.8.8.8": http.StatusTeapot, "85.214.132.1": http.StatusForbidden, "1.1.1.1": http.StatusTeapot} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("%s: expected status %d, got %d", ip, want, rr.Code)
+		}
+	}
+
+	cfg.AllowedCountries = []string{"FR"}
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected an error with AllowedCountries, got %v", err)
+	}
+
+	cfg.AllowedCountries = nil
+	if err := os.WriteFile(file, []byte("US,allow\nUS,maybe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var policyErr *CountryPolicyError
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); !errors.As(err, &policyErr) || len(policyErr.Rows) != 1 {
+		t.Errorf("expected the invalid row to fail the startup, got %v", err)
+	}
+}
+
+func TestCountryPolicyOverlay(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	file := filepath.Join(t.TempDir(), "overlay.csv")
+	defer func() {
+		configOverlaysMutex.Lock()
+		delete(configOverlays, file)
+		configOverlaysMutex.Unlock()
+	}()
+	if err := os.WriteFile(file, []byte("country_code,action\nUS,allow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.ConfigOverlayFile = file
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	if allowed, _, _, _ := plugin.CheckAllowed("8.8.8.8"); !allowed {
+		t.Error("expected the CSV overlay to allow US")
+	}
+	if allowed, _, _, _ := plugin.CheckAllowed("1.1.1.1"); allowed {
+		t.Error("expected the CSV overlay to replace the allowed countries")
+	}
+
+	// Invalid rows keep the previous overlay
+	if err := os.WriteFile(file, []byte("country_code,action\nAU,allow\nUS,allowed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var policyErr *CountryPolicyError
+	if err := plugin.configOverlay.reload(nil); !errors.As(err, &policyErr) || policyErr.Rows[0].Line != 3 {
+		t.Errorf("expected a row report, got %v", err)
+	}
+	if allowed, _, _, _ := plugin.CheckAllowed("8.8.8.8"); !allowed {
+		t.Error("expected the previous overlay to stay")
+	}
+}
@@ -0,0 +1,51 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// Country list precedence options
+const (
+	CountryListPrecedenceAllowFirst  = "allow_first"   // A country in both lists is allowed (default)
+	CountryListPrecedenceBlockFirst  = "block_first"   // A country in both lists is blocked
+	CountryListPrecedenceErrorIfBoth = "error_if_both" // Setting both lists is a configuration error
+)
+
+// validateCountryListPrecedence checks the precedence option against the configured lists and returns
+// whether blocked countries win. Countries listed in both lists are reported, they are usually a mistake.
+func validateCountryListPrecedence(option, scope string, rules countryRules, logger *slog.Logger) (bool, error) {
+	switch option {
+	case "", CountryListPrecedenceAllowFirst, CountryListPrecedenceBlockFirst:
+	case CountryListPrecedenceErrorIfBoth:
+		if len(rules.allowed) > 0 && len(rules.blocked) > 0 {
+			return false, fmt.Errorf("%s: AllowedCountries and BlockedCountries are both set, which CountryListPrecedence %q forbids", scope, option)
+		}
+	default:
+		return false, fmt.Errorf("invalid CountryListPrecedence %q, must be one of: allow_first, block_first, error_if_both", option)
+	}
+
+	blockFirst := option == CountryListPrecedenceBlockFirst
+	if overlap := countryListOverlap(rules); len(overlap) > 0 {
+		winner := "allowed"
+		if blockFirst {
+			winner = "blocked"
+		}
+		logger.Warn("countries listed in both AllowedCountries and BlockedCountries",
+			"scope", scope, "countries", overlap, "result", winner)
+	}
+	return blockFirst, nil
+}
+
+// countryListOverlap returns the countries present in both lists, sorted
+func countryListOverlap(rules countryRules) []string {
+	var overlap []string
+	for country := range rules.allowed {
+		if _, found := rules.blocked[country]; found {
+			overlap = append(overlap, country)
+		}
+	}
+	sort.Strings(overlap)
+	return overlap
+}
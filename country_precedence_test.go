@@ -0,0 +1,106 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCountryListPrecedence(t *testing.T) {
+	// AU is in both lists, US only in the allowed list, DE only in the blocked list, IE in neither
+	tests := []struct {
+		precedence string
+		defaultOK  bool
+		want       map[string]string // IP -> expected phase, prefixed with + when allowed
+	}{
+		{
+			precedence: "",
+			want:       map[string]string{"1.1.1.1": "+allowed_country", "8.8.8.8": "+allowed_country", "85.214.132.1": "blocked_country", "2a00:1450::1": "default_allow"},
+		},
+		{
+			precedence: CountryListPrecedenceAllowFirst,
+			defaultOK:  true,
+			want:       map[string]string{"1.1.1.1": "+allowed_country", "8.8.8.8": "+allowed_country", "85.214.132.1": "blocked_country", "2a00:1450::1": "+default_allow"},
+		},
+		{
+			precedence: CountryListPrecedenceBlockFirst,
+			want:       map[string]string{"1.1.1.1": "blocked_country", "8.8.8.8": "+allowed_country", "85.214.132.1": "blocked_country", "2a00:1450::1": "default_allow"},
+		},
+		{
+			precedence: CountryListPrecedenceBlockFirst,
+			defaultOK:  true,
+			want:       map[string]string{"1.1.1.1": "blocked_country", "8.8.8.8": "+allowed_country", "85.214.132.1": "blocked_country", "2a00:1450::1": "+default_allow"},
+		},
+	}
+
+	for _, tt := range tests {
+		name := tt.precedence
+		if name == "" {
+			name = "unset"
+		}
+		if tt.defaultOK {
+			name += "/defaultAllow"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.AllowedCountries = []string{"AU", "US"}
+			cfg.BlockedCountries = []string{"AU", "DE"}
+			cfg.CountryListPrecedence = tt.precedence
+			cfg.DefaultAllow = tt.defaultOK
+
+			handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			for ip, want := range tt.want {
+				allowed, _, phase, err := handler.(*Plugin).CheckAllowed(ip)
+				if err != nil {
+					t.Fatalf("unexpected error for %s: %v", ip, err)
+				}
+				got := phase
+				if allowed {
+					got = "+" + phase
+				}
+				if got != want {
+					t.Errorf("%s: expected %s, got %s", ip, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCountryListPrecedenceValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		precedence string
+		allowed    []string
+		blocked    []string
+		ipv6       AddressFamilyPolicy
+		wantErr    bool
+	}{
+		{name: "error_if_both with both lists", precedence: CountryListPrecedenceErrorIfBoth, allowed: []string{"US"}, blocked: []string{"DE"}, wantErr: true},
+		{name: "error_if_both with allowed only", precedence: CountryListPrecedenceErrorIfBoth, allowed: []string{"US"}},
+		{name: "error_if_both with blocked only", precedence: CountryListPrecedenceErrorIfBoth, blocked: []string{"DE"}},
+		{name: "error_if_both with family mixing lists", precedence: CountryListPrecedenceErrorIfBoth, allowed: []string{"US"}, ipv6: AddressFamilyPolicy{BlockedCountries: []string{"DE"}}, wantErr: true},
+		{name: "invalid value", precedence: "allow_last", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.AllowedCountries = tt.allowed
+			cfg.BlockedCountries = tt.blocked
+			cfg.IPv6Policy = tt.ipv6
+			cfg.CountryListPrecedence = tt.precedence
+
+			_, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseCountryQuota is used when a country used up its daily or monthly request quota
+const PhaseCountryQuota = "country_quota"
+
+// countryQuotaFlushInterval is the minimum time between two writes of the counter file
+const countryQuotaFlushInterval = time.Minute
+
+// Period formats, UTC
+const (
+	quotaDayFormat   = "2006-01-02"
+	quotaMonthFormat = "2006-01"
+)
+
+// countryQuotas blocks countries once they used up their request budget for the day or the month
+type countryQuotas struct {
+	daily    map[string]int64 // By country, groups expanded
+	monthly  map[string]int64
+	counters *quotaCounters
+}
+
+// quotaCounters counts the allowed requests of the current day and month per country
+type quotaCounters struct {
+	file   string // Empty keeps the counters in memory only
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	day       string
+	month     string
+	daily     map[string]int64
+	monthly   map[string]int64
+	exhausted map[string]bool // Countries whose exhaustion was logged in the current periods
+	lastFlush time.Time
+	flushing  bool
+}
+
+var (
+	// quotaCounterFiles shares the counters of a file between plugin instances, so configuration
+	// reloads don't reset the budgets
+	quotaCounterFiles      = make(map[string]*quotaCounters)
+	quotaCounterFilesMutex sync.Mutex
+)
+
+// newCountryQuotas validates the quotas and loads the counter file. Returns nil when no quota is configured.
+func newCountryQuotas(cfg *Config, logger *slog.Logger) (*countryQuotas, error) {
+	if len(cfg.CountryDailyQuotas) == 0 && len(cfg.CountryMonthlyQuotas) == 0 {
+		return nil, nil
+	}
+	daily, err := expandQuotas("CountryDailyQuotas", cfg.CountryDailyQuotas)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := expandQuotas("CountryMonthlyQuotas", cfg.CountryMonthlyQuotas)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := getQuotaCounters(cfg.CountryQuotaFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &countryQuotas{daily: daily, monthly: monthly, counters: counters}, nil
+}
+
+// expandQuotas expands country groups, explicit country entries win over group members
+func expandQuotas(option string, quotas map[string]int) (map[string]int64, error) {
+	keys := make([]string, 0, len(quotas))
+	for key := range quotas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	expanded := make(map[string]int64)
+	for _, key := range keys {
+		if quotas[key] < 0 {
+			return nil, fmt.Errorf("%s[%s] must not be negative, got %d", option, key, quotas[key])
+		}
+		if members, isGroup := countryGroups[strings.ToUpper(key)]; isGroup {
+			for _, m := range members {
+				if _, explicit := quotas[m]; !explicit {
+					expanded[m] = int64(quotas[key])
+				}
+			}
+			continue
+		}
+		expanded[strings.ToUpper(key)] = int64(quotas[key])
+	}
+	return expanded, nil
+}
+
+// getQuotaCounters returns the counters of the file, loading it on first use.
+// Without a file every plugin instance gets its own counters.
+func getQuotaCounters(file string, logger *slog.Logger) (*quotaCounters, error) {
+	if file == "" {
+		return newQuotaCounters("", logger), nil
+	}
+
+	quotaCounterFilesMutex.Lock()
+	defer quotaCounterFilesMutex.Unlock()
+
+	if existing, ok := quotaCounterFiles[file]; ok {
+		return existing, nil
+	}
+	counters := newQuotaCounters(file, logger)
+	if err := counters.load(time.Now()); err != nil {
+		return nil, err
+	}
+	quotaCounterFiles[file] = counters
+	return counters, nil
+}
+
+func newQuotaCounters(file string, logger *slog.Logger) *quotaCounters {
+	return &quotaCounters{
+		file:      file,
+		logger:    logger,
+		daily:     make(map[string]int64),
+		monthly:   make(map[string]int64),
+		exhausted: make(map[string]bool),
+		lastFlush: time.Now(),
+	}
+}
+
+// load reads "period,country,requests" lines, keeping those of the current day and month.
+// A missing file means no request was counted yet.
+func (c *quotaCounters) load(now time.Time) error {
+	file, err := os.Open(c.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open country quota file %s: %w", c.file, err)
+	}
+	defer file.Close()
+
+	c.rollLocked(now)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			continue
+		}
+		requests, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case c.day:
+			c.daily[fields[1]] = requests
+		case c.month:
+			c.monthly[fields[1]] = requests
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read country quota file %s: %w", c.file, err)
+	}
+	return nil
+}
+
+// rollLocked starts new counters when the day or the month changed. Callers must hold the lock.
+func (c *quotaCounters) rollLocked(now time.Time) {
+	day, month := now.UTC().Format(quotaDayFormat), now.UTC().Format(quotaMonthFormat)
+	if day != c.day {
+		c.day = day
+		c.daily = make(map[string]int64)
+		c.exhausted = make(map[string]bool)
+	}
+	if month != c.month {
+		c.month = month
+		c.monthly = make(map[string]int64)
+	}
+}
+
+// take counts a request of the country and reports whether it was within its quotas.
+// Requests above a quota are not counted.
+func (q *countryQuotas) take(country string, now time.Time) bool {
+	dailyLimit, hasDaily := q.daily[country]
+	monthlyLimit, hasMonthly := q.monthly[country]
+	if !hasDaily && !hasMonthly {
+		return true
+	}
+
+	c := q.counters
+	c.mu.Lock()
+	c.rollLocked(now)
+	if (hasDaily && c.daily[country] >= dailyLimit) || (hasMonthly && c.monthly[country] >= monthlyLimit) {
+		logExhausted, day := !c.exhausted[country], c.day
+		c.exhausted[country] = true
+		c.mu.Unlock()
+		if logExhausted {
+			c.logger.Warn("country quota exhausted", "country", country, "day", day, "daily_quota", dailyLimit, "monthly_quota", monthlyLimit)
+		}
+		return false
+	}
+	c.daily[country]++
+	c.monthly[country]++
+
+	var encoded []byte
+	if c.file != "" && !c.flushing && now.Sub(c.lastFlush) >= countryQuotaFlushInterval {
+		c.flushing = true
+		c.lastFlush = now
+		encoded = c.encodeLocked()
+	}
+	c.mu.Unlock()
+
+	if encoded != nil {
+		go func() {
+			if err := writeFileAtomic(c.file, encoded); err != nil {
+				c.logger.Warn("failed to write country quota file", "path", c.file, "error", err)
+			}
+			c.mu.Lock()
+			c.flushing = false
+			c.mu.Unlock()
+		}()
+	}
+	return true
+}
+
+// apply blocks an allowed request of a country above its quota. Only country decisions count:
+// allowed IP blocks, private IPs and verified crawlers are not limited.
+func (q *countryQuotas) apply(decision ipDecision, now time.Time) ipDecision {
+	if decision.blocked || decision.err != nil || isUnknownCountry(decision.country) {
+		return decision
+	}
+	switch decision.phase {
+	case PhaseAllowedCountry, PhaseDefaultAllow, PhaseDecisionCookie:
+	default:
+		return decision
+	}
+	if q.take(decision.country, now) {
+		return decision
+	}
+	return ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseCountryQuota}
+}
+
+// flush writes the counter file synchronously
+func (c *quotaCounters) flush() error {
+	if c.file == "" {
+		return nil
+	}
+	c.mu.Lock()
+	encoded := c.encodeLocked()
+	c.mu.Unlock()
+	return writeFileAtomic(c.file, encoded)
+}
+
+// encodeLocked formats the counters as "period,country,requests" lines. Callers must hold the lock.
+func (c *quotaCounters) encodeLocked() []byte {
+	var content strings.Builder
+	content.WriteString("# period,country,requests\n")
+	for _, period := range []struct {
+		name   string
+		counts map[string]int64
+	}{{c.day, c.daily}, {c.month, c.monthly}} {
+		countries := make([]string, 0, len(period.counts))
+		for country := range period.counts {
+			countries = append(countries, country)
+		}
+		sort.Strings(countries)
+		for _, country := range countries {
+			fmt.Fprintf(&content, "%s,%s,%d\n", period.name, country, period.counts[country])
+		}
+	}
+	return []byte(content.String())
+}
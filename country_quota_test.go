@@ -0,0 +1,102 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCountryQuotas(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	file := filepath.Join(t.TempDir(), "quotas.txt")
+	defer func() {
+		quotaCounterFilesMutex.Lock()
+		delete(quotaCounterFiles, file)
+		quotaCounterFilesMutex.Unlock()
+	}()
+
+	newQuotaPlugin := func() *Plugin {
+		cfg := CreateConfig()
+		cfg.Enabled = true
+		cfg.DatabaseFilePath = tinyDbFilePath
+		cfg.AllowedCountries = []string{"AU", "US"}
+		cfg.AllowedIPBlocks = []string{"8.8.4.0/24"}
+		cfg.RemediationHeadersCustomName = "X-Geoblock-Phase"
+		cfg.CountryDailyQuotas = map[string]int{"US": 2}
+		cfg.CountryQuotaFile = file
+		plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		return plugin
+	}
+	serve := func(plugin *Plugin, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	plugin := newQuotaPlugin()
+	for i := 0; i < 2; i++ {
+		if rr := serve(plugin, "8.8.8.8"); rr.Code != http.StatusTeapot {
+			t.Fatalf("expected request %d within the quota, got %d", i+1, rr.Code)
+		}
+	}
+	if rr := serve(plugin, "8.8.8.8"); rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseCountryQuota {
+		t.Errorf("expected the quota to block, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+	}
+	if rr := serve(plugin, "8.8.4.4"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected allowed IP blocks to ignore the quota, got %d", rr.Code)
+	}
+	if rr := serve(plugin, "1.1.1.1"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected countries without quota to pass, got %d", rr.Code)
+	}
+	if err := plugin.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The counters survive a restart
+	quotaCounterFilesMutex.Lock()
+	delete(quotaCounterFiles, file)
+	quotaCounterFilesMutex.Unlock()
+	plugin = newQuotaPlugin()
+	defer plugin.Close()
+	if rr := serve(plugin, "8.8.8.8"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the persisted counter to keep blocking, got %d", rr.Code)
+	}
+
+	// A new day starts a new budget
+	quotas := &countryQuotas{daily: map[string]int64{"US": 1}, counters: newQuotaCounters("", plugin.logger)}
+	now := time.Now()
+	if !quotas.take("US", now) || quotas.take("US", now) {
+		t.Error("expected one request within the daily quota")
+	}
+	if !quotas.take("US", now.Add(24*time.Hour)) {
+		t.Error("expected the daily quota to reset the next day")
+	}
+}
+
+func TestCountryQuotas_Groups(t *testing.T) {
+	cfg := &Config{CountryMonthlyQuotas: map[string]int{"EU": 1000, "DE": 10}}
+	quotas, err := newCountryQuotas(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if quotas.monthly["FR"] != 1000 || quotas.monthly["DE"] != 10 {
+		t.Errorf("expected group members to inherit the group quota unless explicit, got %v", quotas.monthly)
+	}
+
+	cfg = &Config{CountryDailyQuotas: map[string]int{"US": -1}}
+	if _, err := newCountryQuotas(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Error("expected a negative quota to be rejected")
+	}
+}
@@ -0,0 +1,114 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Formats of the CountryHeader values
+const (
+	CountryHeaderFormatCode      = "code"      // ISO 3166-1 alpha-2 code as found in the database, "US"
+	CountryHeaderFormatLowercase = "lowercase" // Lowercase code, "us"
+	CountryHeaderFormatName      = "name"      // English short name, "United States"; codes without name stay codes
+)
+
+// validateCountryHeaderFormat checks the CountryHeader format and returns it with the private IP alias
+func validateCountryHeaderFormat(cfg *Config) (string, string, error) {
+	format := strings.ToLower(cfg.CountryHeaderFormat)
+	switch format {
+	case "":
+		format = CountryHeaderFormatCode
+	case CountryHeaderFormatCode, CountryHeaderFormatLowercase, CountryHeaderFormatName:
+	default:
+		return "", "", fmt.Errorf("invalid CountryHeaderFormat %q, must be one of: %s, %s, %s",
+			cfg.CountryHeaderFormat, CountryHeaderFormatCode, CountryHeaderFormatLowercase, CountryHeaderFormatName)
+	}
+
+	alias := strings.TrimSpace(cfg.PrivateCountryAlias)
+	if alias == "" {
+		alias = PrivateIpCountryAlias
+	}
+	for _, c := range alias {
+		if c < 0x20 || c > 0x7e {
+			return "", "", fmt.Errorf("invalid PrivateCountryAlias %q, use printable ASCII characters", cfg.PrivateCountryAlias)
+		}
+	}
+	return format, alias, nil
+}
+
+// countryHeaderValue formats a country for the CountryHeader. The private alias is used as configured.
+func (p Plugin) countryHeaderValue(country string) string {
+	if country == PrivateIpCountryAlias && p.privateCountryAlias != "" {
+		return p.privateCountryAlias
+	}
+	switch p.countryHeaderFormat {
+	case CountryHeaderFormatLowercase:
+		return strings.ToLower(country)
+	case CountryHeaderFormatName:
+		if name, ok := countryNames[country]; ok {
+			return name
+		}
+	}
+	return country
+}
+
+// newCountryCookieTemplate validates the country cookie settings and builds the cookie
+// attributes shared by all responses. Returns nil when the cookie is disabled.
+func newCountryCookieTemplate(cfg *Config) (*http.Cookie, error) {
+	if cfg.CountryCookieName == "" {
+		return nil, nil
+	}
+
+	cookie := &http.Cookie{
+		Name:     cfg.CountryCookieName,
+		Domain:   cfg.CountryCookieDomain,
+		Path:     cfg.CountryCookiePath,
+		MaxAge:   cfg.CountryCookieMaxAgeSeconds,
+		Secure:   cfg.CountryCookieSecure,
+		HttpOnly: cfg.CountryCookieHttpOnly,
+	}
+
+	switch strings.ToLower(cfg.CountryCookieSameSite) {
+	case "", "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		// Browsers reject SameSite=None cookies without the Secure attribute
+		if !cookie.Secure {
+			return nil, fmt.Errorf("CountryCookieSameSite 'None' requires CountryCookieSecure to be enabled")
+		}
+		cookie.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("invalid CountryCookieSameSite '%s', must be one of: Lax, Strict, None", cfg.CountryCookieSameSite)
+	}
+
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	return cookie, nil
+}
+
+// annotateAllowedResponse adds the detected country to the response of an allowed request,
+// as a header and/or a cookie, so frontends can localize without a separate geo API call.
+// The cookie is only sent when the client doesn't already hold the same value.
+func (p Plugin) annotateAllowedResponse(rw http.ResponseWriter, req *http.Request, country string) {
+	if country == "" {
+		return
+	}
+
+	if p.responseCountryHeader != "" {
+		rw.Header().Set(p.responseCountryHeader, country)
+	}
+
+	if p.countryCookie != nil {
+		if existing, err := req.Cookie(p.countryCookie.Name); err == nil && existing.Value == country {
+			return
+		}
+		cookie := *p.countryCookie
+		cookie.Value = country
+		http.SetCookie(rw, &cookie)
+	}
+}
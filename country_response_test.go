@@ -0,0 +1,168 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountryResponseAnnotations(t *testing.T) {
+	cfg := &Config{
+		Enabled:                    true,
+		DatabaseFilePath:           tinyDbFilePath,
+		AllowedCountries:           []string{"AU"},
+		AllowPrivate:               true,
+		DisallowedStatusCode:       http.StatusForbidden,
+		IPHeaders:                  []string{"x-real-ip"},
+		IPHeaderStrategy:           IPHeaderStrategyCheckAll,
+		ResponseCountryHeader:      "X-Geo-Country",
+		CountryCookieName:          "geo_country",
+		CountryCookieMaxAgeSeconds: 3600,
+		CountryCookieSecure:        true,
+		CountryCookieSameSite:      "Strict",
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	t.Run("AllowedResponseIsAnnotated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", "1.1.1.1")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("X-Geo-Country"); got != "AU" {
+			t.Errorf("expected response header AU, got %q", got)
+		}
+
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("expected one cookie, got %d", len(cookies))
+		}
+		c := cookies[0]
+		if c.Name != "geo_country" || c.Value != "AU" || c.Path != "/" || c.MaxAge != 3600 || !c.Secure || c.SameSite != http.SameSiteStrictMode {
+			t.Errorf("unexpected cookie: %+v", c)
+		}
+	})
+
+	t.Run("CookieNotResentWhenUnchanged", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", "1.1.1.1")
+		req.AddCookie(&http.Cookie{Name: "geo_country", Value: "AU"})
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+
+		if len(rr.Result().Cookies()) != 0 {
+			t.Error("expected no Set-Cookie when the client already has the same country")
+		}
+		if got := rr.Header().Get("X-Geo-Country"); got != "AU" {
+			t.Errorf("expected response header AU, got %q", got)
+		}
+	})
+
+	t.Run("PrivateClient", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", "192.168.1.1")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("X-Geo-Country"); got != PrivateIpCountryAlias {
+			t.Errorf("expected response header %s, got %q", PrivateIpCountryAlias, got)
+		}
+	})
+
+	t.Run("BlockedResponseIsNotAnnotated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", "8.8.8.8")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if rr.Header().Get("X-Geo-Country") != "" || len(rr.Result().Cookies()) != 0 {
+			t.Error("expected blocked response not to carry country hints")
+		}
+	})
+}
+
+func TestNewCountryCookieTemplate_Validation(t *testing.T) {
+	tests := []struct {
+		name     string
+		sameSite string
+		secure   bool
+		wantErr  bool
+	}{
+		{"default", "", false, false},
+		{"lax", "lax", false, false},
+		{"strict", "Strict", false, false},
+		{"none secure", "None", true, false},
+		{"none insecure", "None", false, true},
+		{"invalid", "sometimes", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCountryCookieTemplate(&Config{
+				CountryCookieName:     "geo",
+				CountryCookieSameSite: tt.sameSite,
+				CountryCookieSecure:   tt.secure,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCountryHeaderFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		alias  string
+		ip     string
+		want   string
+	}{
+		{format: "", ip: "8.8.8.8", want: "US"},
+		{format: CountryHeaderFormatLowercase, ip: "8.8.8.8", want: "us"},
+		{format: CountryHeaderFormatName, ip: "2a00:1450::1", want: "Ireland"},
+		{format: CountryHeaderFormatName, ip: "192.168.1.1", want: PrivateIpCountryAlias},
+		{format: CountryHeaderFormatLowercase, alias: "LOCAL", ip: "192.168.1.1", want: "LOCAL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.ip, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.DefaultAllow = true
+			cfg.AllowPrivate = true
+			cfg.CountryHeader = "X-IPCountry"
+			cfg.CountryHeaderFormat = tt.format
+			cfg.PrivateCountryAlias = tt.alias
+
+			var seen string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				seen = req.Header.Get("X-IPCountry")
+			})
+			handler, err := New(context.TODO(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if seen != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, seen)
+			}
+		})
+	}
+
+	cfg := CreateConfig()
+	cfg.CountryHeaderFormat = "full"
+	if _, _, err := validateCountryHeaderFormat(cfg); err == nil {
+		t.Error("expected an invalid format to be rejected")
+	}
+}
@@ -0,0 +1,333 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// countryStatsMagic identifies country statistics ring files
+const countryStatsMagic = "GBCS"
+
+// countryStatsVersion is the version of the ring file format
+const countryStatsVersion = 1
+
+// countryStatsFlushInterval is the minimum time between two writes of the ring file
+const countryStatsFlushInterval = time.Minute
+
+// CountryCount holds the counters of one country in one bucket
+type CountryCount struct {
+	Requests int64 `json:"requests"` // Requests seen (estimated from the sample rate)
+	Blocked  int64 `json:"blocked"`  // Requests that were blocked (estimated from the sample rate)
+}
+
+// CountryStatsBucket holds the per-country counters of one time bucket
+type CountryStatsBucket struct {
+	Start     time.Time               `json:"start"`
+	Countries map[string]CountryCount `json:"countries"`
+}
+
+// CountryStatsSnapshot is the content of the country statistics ring, oldest bucket first
+type CountryStatsSnapshot struct {
+	BucketSeconds int                     `json:"bucketSeconds"`
+	SampleRate    int                     `json:"sampleRate"`
+	Buckets       []CountryStatsBucket    `json:"buckets"`
+	Totals        map[string]CountryCount `json:"totals"`
+}
+
+// countryStatsSlot is one position of the ring
+type countryStatsSlot struct {
+	start     int64 // Unix time of the bucket start, 0 when unused
+	countries map[string]CountryCount
+}
+
+// countryStats samples requests into per-country counters kept in fixed time buckets.
+// The buckets form a ring: once all are used, the oldest one is reused.
+type countryStats struct {
+	bucketSeconds int64
+	sampleRate    int64
+	file          string
+	logger        *slog.Logger
+
+	seen *int64 // Requests seen, used for sampling
+
+	mu        *sync.Mutex
+	slots     []countryStatsSlot
+	lastFlush time.Time
+	flushing  bool
+}
+
+// newCountryStats creates the collector. Returns nil when country statistics are disabled.
+// When a ring file is configured and exists, its buckets are loaded so history survives restarts.
+func newCountryStats(cfg *Config, logger *slog.Logger) (*countryStats, error) {
+	if !cfg.CountryStats {
+		return nil, nil
+	}
+	if cfg.CountryStatsBucketSeconds <= 0 {
+		return nil, fmt.Errorf("CountryStatsBucketSeconds must be positive, got %d", cfg.CountryStatsBucketSeconds)
+	}
+	if cfg.CountryStatsBuckets <= 0 || cfg.CountryStatsBuckets > 65535 {
+		return nil, fmt.Errorf("CountryStatsBuckets must be between 1 and 65535, got %d", cfg.CountryStatsBuckets)
+	}
+	if cfg.CountryStatsSampleRate <= 0 {
+		return nil, fmt.Errorf("CountryStatsSampleRate must be positive, got %d", cfg.CountryStatsSampleRate)
+	}
+
+	stats := &countryStats{
+		bucketSeconds: int64(cfg.CountryStatsBucketSeconds),
+		sampleRate:    int64(cfg.CountryStatsSampleRate),
+		file:          cfg.CountryStatsFile,
+		logger:        logger,
+		seen:          new(int64),
+		mu:            &sync.Mutex{},
+		slots:         make([]countryStatsSlot, cfg.CountryStatsBuckets),
+		lastFlush:     time.Now(),
+	}
+
+	if stats.file != "" {
+		snapshot, err := ReadCountryStatsFile(stats.file)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			logger.Warn("ignoring unreadable country stats file", "path", stats.file, "error", err)
+		case int64(snapshot.BucketSeconds) != stats.bucketSeconds:
+			logger.Warn("ignoring country stats file with a different bucket size",
+				"path", stats.file, "bucket_seconds", snapshot.BucketSeconds)
+		default:
+			for _, bucket := range snapshot.Buckets {
+				slot := stats.slot(bucket.Start.Unix())
+				slot.start = bucket.Start.Unix()
+				slot.countries = bucket.Countries
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// slot returns the ring position for a bucket start. Callers must hold the lock.
+func (s *countryStats) slot(start int64) *countryStatsSlot {
+	return &s.slots[(start/s.bucketSeconds)%int64(len(s.slots))]
+}
+
+// record counts a request for the country, honoring the sample rate
+func (s *countryStats) record(country string, blocked bool) {
+	if atomic.AddInt64(s.seen, 1)%s.sampleRate != 0 {
+		return
+	}
+
+	now := time.Now()
+	start := now.Unix() - now.Unix()%s.bucketSeconds
+
+	s.mu.Lock()
+	slot := s.slot(start)
+	if slot.start != start {
+		slot.start = start
+		slot.countries = make(map[string]CountryCount)
+	}
+	count := slot.countries[country]
+	count.Requests += s.sampleRate
+	if blocked {
+		count.Blocked += s.sampleRate
+	}
+	slot.countries[country] = count
+
+	var encoded []byte
+	if s.file != "" && !s.flushing && now.Sub(s.lastFlush) >= countryStatsFlushInterval {
+		s.flushing = true
+		s.lastFlush = now
+		encoded = s.encodeLocked(now)
+	}
+	s.mu.Unlock()
+
+	if encoded != nil {
+		go func() {
+			if err := writeFileAtomic(s.file, encoded); err != nil {
+				s.logger.Warn("failed to write country stats file", "path", s.file, "error", err)
+			}
+			s.mu.Lock()
+			s.flushing = false
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// snapshot returns the buckets that are still inside the ring window, oldest first
+func (s *countryStats) snapshot() *CountryStatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshotLocked(time.Now())
+}
+
+func (s *countryStats) snapshotLocked(now time.Time) *CountryStatsSnapshot {
+	oldest := now.Unix() - s.bucketSeconds*int64(len(s.slots))
+
+	snapshot := &CountryStatsSnapshot{
+		BucketSeconds: int(s.bucketSeconds),
+		SampleRate:    int(s.sampleRate),
+		Totals:        make(map[string]CountryCount),
+	}
+	for _, slot := range s.slots {
+		if slot.start == 0 || slot.start <= oldest {
+			continue
+		}
+		countries := make(map[string]CountryCount, len(slot.countries))
+		for country, count := range slot.countries {
+			countries[country] = count
+			total := snapshot.Totals[country]
+			total.Requests += count.Requests
+			total.Blocked += count.Blocked
+			snapshot.Totals[country] = total
+		}
+		snapshot.Buckets = append(snapshot.Buckets, CountryStatsBucket{Start: time.Unix(slot.start, 0).UTC(), Countries: countries})
+	}
+	sort.Slice(snapshot.Buckets, func(i, j int) bool {
+		return snapshot.Buckets[i].Start.Before(snapshot.Buckets[j].Start)
+	})
+	return snapshot
+}
+
+// flush writes the ring file synchronously
+func (s *countryStats) flush() error {
+	if s.file == "" {
+		return nil
+	}
+	s.mu.Lock()
+	encoded := s.encodeLocked(time.Now())
+	s.mu.Unlock()
+	return writeFileAtomic(s.file, encoded)
+}
+
+// encodeLocked serializes the ring. Layout: magic, version, bucket seconds, sample rate, bucket count,
+// then for each bucket its start and country entries, with uvarint encoded numbers.
+func (s *countryStats) encodeLocked(now time.Time) []byte {
+	snapshot := s.snapshotLocked(now)
+
+	var buf bytes.Buffer
+	buf.WriteString(countryStatsMagic)
+	buf.WriteByte(countryStatsVersion)
+
+	varint := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) {
+		n := binary.PutUvarint(varint, v)
+		buf.Write(varint[:n])
+	}
+
+	writeUvarint(uint64(snapshot.BucketSeconds))
+	writeUvarint(uint64(snapshot.SampleRate))
+	writeUvarint(uint64(len(snapshot.Buckets)))
+	for _, bucket := range snapshot.Buckets {
+		writeUvarint(uint64(bucket.Start.Unix()))
+		writeUvarint(uint64(len(bucket.Countries)))
+
+		countries := make([]string, 0, len(bucket.Countries))
+		for country := range bucket.Countries {
+			countries = append(countries, country)
+		}
+		sort.Strings(countries)
+		for _, country := range countries {
+			count := bucket.Countries[country]
+			writeUvarint(uint64(len(country)))
+			buf.WriteString(country)
+			writeUvarint(uint64(count.Requests))
+			writeUvarint(uint64(count.Blocked))
+		}
+	}
+	return buf.Bytes()
+}
+
+// ReadCountryStatsFile decodes a country statistics ring file
+func ReadCountryStatsFile(path string) (*CountryStatsSnapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, len(countryStatsMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if string(header[:len(countryStatsMagic)]) != countryStatsMagic {
+		return nil, fmt.Errorf("not a country stats file")
+	}
+	if header[len(countryStatsMagic)] != countryStatsVersion {
+		return nil, fmt.Errorf("unsupported country stats file version %d", header[len(countryStatsMagic)])
+	}
+
+	var readErr error
+	readUvarint := func() uint64 {
+		if readErr != nil {
+			return 0
+		}
+		var v uint64
+		v, readErr = binary.ReadUvarint(r)
+		return v
+	}
+
+	snapshot := &CountryStatsSnapshot{
+		BucketSeconds: int(readUvarint()),
+		SampleRate:    int(readUvarint()),
+		Totals:        make(map[string]CountryCount),
+	}
+	bucketCount := readUvarint()
+	for i := uint64(0); i < bucketCount && readErr == nil; i++ {
+		bucket := CountryStatsBucket{
+			Start:     time.Unix(int64(readUvarint()), 0).UTC(),
+			Countries: make(map[string]CountryCount),
+		}
+		entries := readUvarint()
+		for j := uint64(0); j < entries && readErr == nil; j++ {
+			nameLength := readUvarint()
+			if nameLength > 64 {
+				readErr = fmt.Errorf("country name of %d bytes", nameLength)
+				break
+			}
+			name := make([]byte, nameLength)
+			if readErr == nil {
+				_, readErr = io.ReadFull(r, name)
+			}
+			count := CountryCount{Requests: int64(readUvarint()), Blocked: int64(readUvarint())}
+			bucket.Countries[string(name)] = count
+
+			total := snapshot.Totals[string(name)]
+			total.Requests += count.Requests
+			total.Blocked += count.Blocked
+			snapshot.Totals[string(name)] = total
+		}
+		snapshot.Buckets = append(snapshot.Buckets, bucket)
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("corrupted country stats file: %w", readErr)
+	}
+	return snapshot, nil
+}
+
+// writeFileAtomic writes the content to a temporary file next to path and renames it into place
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
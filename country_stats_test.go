@@ -0,0 +1,112 @@
+package traefik_geoblock
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCountryStats(t *testing.T, file string, sampleRate int) *countryStats {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	stats, err := newCountryStats(&Config{
+		CountryStats:              true,
+		CountryStatsFile:          file,
+		CountryStatsBucketSeconds: 3600,
+		CountryStatsBuckets:       24,
+		CountryStatsSampleRate:    sampleRate,
+	}, logger)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return stats
+}
+
+func TestCountryStatsRecord(t *testing.T) {
+	stats := newTestCountryStats(t, "", 1)
+	stats.record("US", false)
+	stats.record("US", true)
+	stats.record("DE", false)
+
+	snapshot := stats.snapshot()
+	if len(snapshot.Buckets) != 1 {
+		t.Fatalf("expected one bucket, got %d", len(snapshot.Buckets))
+	}
+	if got := snapshot.Totals["US"]; got.Requests != 2 || got.Blocked != 1 {
+		t.Errorf("unexpected US counters %+v", got)
+	}
+	if got := snapshot.Totals["DE"]; got.Requests != 1 || got.Blocked != 0 {
+		t.Errorf("unexpected DE counters %+v", got)
+	}
+}
+
+func TestCountryStatsSampling(t *testing.T) {
+	stats := newTestCountryStats(t, "", 10)
+	for i := 0; i < 100; i++ {
+		stats.record("FR", false)
+	}
+
+	if got := stats.snapshot().Totals["FR"].Requests; got != 100 {
+		t.Errorf("expected sampled counts to be scaled back to 100, got %d", got)
+	}
+}
+
+func TestCountryStatsRingExpiresOldBuckets(t *testing.T) {
+	stats := newTestCountryStats(t, "", 1)
+
+	// A bucket from two days ago occupies a slot but is outside the 24h window
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	old -= old % 3600
+	slot := stats.slot(old)
+	slot.start = old
+	slot.countries = map[string]CountryCount{"CN": {Requests: 5}}
+
+	stats.record("US", false)
+
+	snapshot := stats.snapshot()
+	if _, found := snapshot.Totals["CN"]; found {
+		t.Error("expected buckets outside the ring window to be ignored")
+	}
+	if snapshot.Totals["US"].Requests != 1 {
+		t.Errorf("expected current bucket to be counted, got %+v", snapshot.Totals)
+	}
+}
+
+func TestCountryStatsFileRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "country-stats.bin")
+
+	stats := newTestCountryStats(t, file, 1)
+	stats.record("US", true)
+	stats.record("PRIVATE", false)
+	if err := stats.flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	snapshot, err := ReadCountryStatsFile(file)
+	if err != nil {
+		t.Fatalf("reading stats file failed: %v", err)
+	}
+	if snapshot.BucketSeconds != 3600 || len(snapshot.Buckets) != 1 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+	if got := snapshot.Totals["US"]; got.Requests != 1 || got.Blocked != 1 {
+		t.Errorf("unexpected US counters %+v", got)
+	}
+
+	// A new collector picks up the persisted history
+	reloaded := newTestCountryStats(t, file, 1)
+	reloaded.record("US", false)
+	if got := reloaded.snapshot().Totals["US"].Requests; got != 2 {
+		t.Errorf("expected persisted counts to be loaded, got %d", got)
+	}
+
+	if err := os.WriteFile(file, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCountryStatsFile(file); err == nil {
+		t.Error("expected error for an invalid stats file")
+	}
+}
@@ -2,12 +2,15 @@ package traefik_geoblock
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"log/slog"
@@ -17,51 +20,131 @@ import (
 
 // DatabaseConfig contains only the configuration needed for database management
 type DatabaseConfig struct {
-	DatabaseFilePath        string
-	DatabaseAutoUpdate      bool
-	DatabaseAutoUpdateDir   string
-	DatabaseAutoUpdateToken string
-	DatabaseAutoUpdateCode  string
+	DatabaseFilePath             string
+	DatabaseAutoUpdate           bool
+	DatabaseAutoUpdateDir        string
+	DatabaseAutoUpdateToken      string
+	DatabaseAutoUpdateCode       string
+	NoLocalCopy                  bool   // Open databases in place instead of temp copies
+	DatabaseLocalCopyDir         string // Directory for local copies (defaults to the OS temp directory)
+	DatabaseLocalCopyMaxAgeHours int    // Delete unused local copies older than this on startup (0 disables)
+	DatabaseHotSwapWebhookURL    string // Notified when a hot swap changes the database version (empty disables)
+	DatabaseWarmUp               string // Warm-up before a database is used: "none", "read" or "memory"
+	DatabaseLatencyLogSeconds    int    // Interval of the lookup latency summary log (0 disables it)
+	DatabaseHeartbeatTarget      string // Directory or http(s) URL replicas publish their database version to (empty disables)
+	DatabaseHeartbeatSeconds     int    // Interval of the heartbeat
+	DatabaseAutoUpdateWindow     string // Daily window for downloads and hot swaps, e.g. "02:00-05:00 UTC" (empty for any time)
 }
 
-// DatabaseWrapper wraps ip2location.DB and allows for hot-swapping during updates
-type DatabaseWrapper struct {
+// hotSwapCloseDelay is how long a swapped out database stays open for lookups that already picked it up
+var hotSwapCloseDelay = 10 * time.Second
+
+// ip2locationGlobals guards the package variables the ip2location library rewrites on every OpenDB
+// and reads on every lookup. The values never change, but unguarded they are a data race.
+var ip2locationGlobals sync.RWMutex
+
+// openIP2LocationDB opens a database without racing lookups on other databases
+func openIP2LocationDB(path string) (*ip2location.DB, error) {
+	ip2locationGlobals.Lock()
+	defer ip2locationGlobals.Unlock()
+	return ip2location.OpenDB(path)
+}
+
+// errDatabaseClosed is returned by lookups on a wrapper whose factory has been closed
+var errDatabaseClosed = errors.New("database is closed")
+
+// databaseState is the database in use. It is replaced as a whole, so a lookup never sees
+// the path of one database with the handle of another.
+type databaseState struct {
 	db      *ip2location.DB
+	content []byte // The file loaded into memory by DatabaseWarmUp "memory", nil otherwise
 	path    string
 	version *DBVersion
 }
 
-// Get_country_short performs IP country lookup (fast path - no locking)
+// DatabaseWrapper wraps ip2location.DB and allows for hot-swapping during updates
+type DatabaseWrapper struct {
+	state       atomic.Value    // *databaseState
+	ranges      *binRangeReader // Opened on first LookupRange, reopened when path changes
+	rangesMutex sync.RWMutex
+	latency     latencyHistogram // Durations of LookupCountry
+}
+
+// newDatabaseWrapper creates a wrapper around an open database
+func newDatabaseWrapper(db *ip2location.DB, path string, version *DBVersion) *DatabaseWrapper {
+	dw := &DatabaseWrapper{}
+	dw.state.Store(&databaseState{db: db, path: path, version: version})
+	return dw
+}
+
+// current returns the database in use (fast path - no locking)
+func (dw *DatabaseWrapper) current() *databaseState {
+	if state, ok := dw.state.Load().(*databaseState); ok {
+		return state
+	}
+	return &databaseState{}
+}
+
+// Get_country_short performs IP country lookup (fast path - only blocked while a database is being opened)
 func (dw *DatabaseWrapper) Get_country_short(ip string) (ip2location.IP2Locationrecord, error) {
-	return dw.db.Get_country_short(ip)
+	db := dw.current().db
+	if db == nil {
+		return ip2location.IP2Locationrecord{}, errDatabaseClosed
+	}
+	ip2locationGlobals.RLock()
+	defer ip2locationGlobals.RUnlock()
+	return db.Get_country_short(ip)
+}
+
+// LookupCountry returns the country code of the IP, implementing Lookuper
+func (dw *DatabaseWrapper) LookupCountry(ip string) (string, error) {
+	start := time.Now()
+	record, err := dw.Get_country_short(ip)
+	dw.latency.record(time.Since(start))
+	if err != nil {
+		return "", err
+	}
+
+	// Avoid redundant assignment and string conversion
+	if strings.HasPrefix(strings.ToLower(record.Country_short), "invalid") {
+		return "", errors.New(record.Country_short)
+	}
+
+	return record.Country_short, nil
 }
 
 // GetVersion returns the current database version (fast path - no locking)
 func (dw *DatabaseWrapper) GetVersion() *DBVersion {
-	return dw.version
+	return dw.current().version
 }
 
 // GetPath returns the current database path (fast path - no locking)
 func (dw *DatabaseWrapper) GetPath() string {
-	return dw.path
+	return dw.current().path
 }
 
-// Close closes the database connection
+// Close closes the database connection. Later lookups fail with errDatabaseClosed.
 func (dw *DatabaseWrapper) Close() error {
-	if dw.db != nil {
-		dw.db.Close()
-		dw.db = nil
+	state := dw.current()
+	dw.state.Store(&databaseState{path: state.path, version: state.version})
+	if state.db != nil {
+		state.db.Close()
 	}
+
+	dw.rangesMutex.Lock()
+	if dw.ranges != nil {
+		dw.ranges.Close()
+		dw.ranges = nil
+	}
+	dw.rangesMutex.Unlock()
 	return nil
 }
 
-// swapDatabase replaces the current database with a new one (internal method)
-func (dw *DatabaseWrapper) swapDatabase(newDB *ip2location.DB, newPath string, newVersion *DBVersion) *ip2location.DB {
-	oldDB := dw.db
-	dw.db = newDB
-	dw.path = newPath
-	dw.version = newVersion
-
+// swapDatabase replaces the current database with a new one (internal method). content is the file
+// loaded into memory, nil when the database reads it from disk.
+func (dw *DatabaseWrapper) swapDatabase(newDB *ip2location.DB, content []byte, newPath string, newVersion *DBVersion) *ip2location.DB {
+	oldDB := dw.current().db
+	dw.state.Store(&databaseState{db: newDB, content: content, path: newPath, version: newVersion})
 	return oldDB
 }
 
@@ -72,13 +155,25 @@ type DatabaseFactory struct {
 	wrapper            *DatabaseWrapper
 	currentLocalDbCopy string
 	sourceDbPath       string // Track the original database that was used for the current local copy
-	updateTicker       *time.Ticker
+	updateTicker       Ticker
+	updateDone         chan struct{} // Closed when the auto-update goroutine exits
+	updateWindow       *updateWindow // Window updates are limited to, nil for any time
+	lastWindowCheck    time.Time     // When the update loop last checked inside the window
+	clock              Clock         // Time source for the update ticker and database age checks
 	stopChan           chan struct{}
+	latencyTicker      Ticker // Lookup latency summaries, nil when disabled
+	heartbeatTicker    Ticker // Replica heartbeats, nil when disabled
 	factoryID          string // Unique identifier for this factory instance
+	refCount           int    // Number of GetDatabaseFactory callers holding this factory, guarded by factoryMutex
 }
 
 // NewDatabaseFactory creates a new database factory instance
 func NewDatabaseFactory(config *DatabaseConfig, logger *slog.Logger) (*DatabaseFactory, error) {
+	return newDatabaseFactory(config, logger, systemClock{})
+}
+
+// newDatabaseFactory creates a database factory scheduling updates with clock
+func newDatabaseFactory(config *DatabaseConfig, logger *slog.Logger, clock Clock) (*DatabaseFactory, error) {
 	// Generate unique factory ID and create wrapped logger
 	factoryID := generateConfigHash(config)
 	wrappedLogger := logger.With("factory_id", factoryID)
@@ -86,9 +181,10 @@ func NewDatabaseFactory(config *DatabaseConfig, logger *slog.Logger) (*DatabaseF
 	factory := &DatabaseFactory{
 		config:    config,
 		logger:    wrappedLogger,
-		wrapper:   &DatabaseWrapper{},
+		wrapper:   newDatabaseWrapper(nil, "", nil),
 		stopChan:  make(chan struct{}),
 		factoryID: factoryID,
+		clock:     clock,
 	}
 
 	// Initialize the database
@@ -100,6 +196,14 @@ func NewDatabaseFactory(config *DatabaseConfig, logger *slog.Logger) (*DatabaseF
 	if config.DatabaseAutoUpdate {
 		factory.startAutoUpdate()
 	}
+	if config.DatabaseLatencyLogSeconds > 0 {
+		factory.latencyTicker = clock.NewTicker(time.Duration(config.DatabaseLatencyLogSeconds) * time.Second)
+		go factory.logLatencySummaries(factory.latencyTicker)
+	}
+	if config.DatabaseHeartbeatTarget != "" {
+		factory.heartbeatTicker = clock.NewTicker(time.Duration(config.DatabaseHeartbeatSeconds) * time.Second)
+		go factory.runHeartbeat(factory.heartbeatTicker)
+	}
 
 	return factory, nil
 }
@@ -121,9 +225,15 @@ func (df *DatabaseFactory) GetFactoryID() string {
 
 // Close shuts down the factory and cleans up resources
 func (df *DatabaseFactory) Close() error {
-	// Stop auto-update ticker
-	if df.updateTicker != nil {
-		df.updateTicker.Stop()
+	// Stop the auto-update, latency summary and heartbeat tickers
+	running := false
+	for _, ticker := range []Ticker{df.updateTicker, df.latencyTicker, df.heartbeatTicker} {
+		if ticker != nil {
+			ticker.Stop()
+			running = true
+		}
+	}
+	if running {
 		close(df.stopChan)
 	}
 
@@ -131,12 +241,45 @@ func (df *DatabaseFactory) Close() error {
 	if df.wrapper != nil {
 		df.wrapper.Close()
 	}
+	if df.currentLocalDbCopy != "" {
+		trackLocalCopy(df.currentLocalDbCopy, false)
+	}
 
 	return nil
 }
 
 // initialize sets up the initial database using the best available version
 func (df *DatabaseFactory) initialize() error {
+	searchStart := time.Now()
+
+	// Fail early rather than on the first hot swap
+	if err := validateHotSwapWebhook(df.config.DatabaseHotSwapWebhookURL); err != nil {
+		return err
+	}
+	if err := validateDatabaseWarmUp(df.config.DatabaseWarmUp); err != nil {
+		return err
+	}
+	if err := validateHeartbeatTarget(df.config.DatabaseHeartbeatTarget, df.config.DatabaseHeartbeatSeconds); err != nil {
+		return err
+	}
+	if err := validateAutoUpdate(df.config, df.logger); err != nil {
+		return err
+	}
+	updateWindow, err := parseUpdateWindow(df.config.DatabaseAutoUpdateWindow)
+	if err != nil {
+		return err
+	}
+	df.updateWindow = updateWindow
+	if df.config.DatabaseLocalCopyDir != "" && !df.config.NoLocalCopy {
+		if err := validateLocalCopyDir(df.config.DatabaseLocalCopyDir); err != nil {
+			return fmt.Errorf("invalid DatabaseLocalCopyDir: %w", err)
+		}
+	}
+	if df.config.DatabaseLocalCopyMaxAgeHours > 0 && !df.config.NoLocalCopy {
+		maxAge := time.Duration(df.config.DatabaseLocalCopyMaxAgeHours) * time.Hour
+		cleanupOrphanedLocalCopies(df.localCopyDir(), maxAge, df.clock.Now(), df.logger)
+	}
+
 	// Determine the target database path
 	targetPath, err := df.resolveDatabasePath()
 	if err != nil {
@@ -160,8 +303,11 @@ func (df *DatabaseFactory) initialize() error {
 		df.sourceDbPath = targetPath
 	}
 
+	searchDuration := time.Since(searchStart)
+	openStart := time.Now()
+
 	// Open the database
-	db, err := ip2location.OpenDB(targetPath)
+	db, content, err := df.openDatabase(targetPath)
 	if err != nil {
 		return fmt.Errorf("failed to open database %s: %w", targetPath, err)
 	}
@@ -174,20 +320,21 @@ func (df *DatabaseFactory) initialize() error {
 	}
 
 	// Initialize wrapper
-	df.wrapper.db = db
-	df.wrapper.path = targetPath
-	df.wrapper.version = version
+	df.wrapper.swapDatabase(db, content, targetPath, version)
 
+	age := df.clock.Now().Sub(version.Date())
 	df.logger.Info("database initialized",
 		"path", targetPath,
 		"version", version.String(),
-		"age", time.Since(version.Date()).Round(24*time.Hour))
+		"age", age.Round(24*time.Hour),
+		"search_duration", searchDuration,
+		"open_duration", time.Since(openStart))
 
 	// Check if database is older than 2 months
-	if time.Since(version.Date()) > 60*24*time.Hour {
+	if age > 60*24*time.Hour {
 		df.logger.Warn("ip2location database is more than 2 months old",
 			"version", version.String(),
-			"age", time.Since(version.Date()).Round(24*time.Hour))
+			"age", age.Round(24*time.Hour))
 	}
 
 	return nil
@@ -200,7 +347,7 @@ func (df *DatabaseFactory) resolveDatabasePath() (string, error) {
 	// Search for database file
 	databasePath, err := fileUtils.Search(databasePath, "IP2LOCATION-LITE-DB1.IPV6.BIN", df.logger)
 	if err != nil {
-		return "", fmt.Errorf("database file not found: %w", err)
+		return "", fmt.Errorf("%w: %w", ErrDatabaseNotFound, err)
 	}
 
 	return databasePath, nil
@@ -224,6 +371,9 @@ func (df *DatabaseFactory) handleAutoUpdateInit(fallbackPath string) (string, er
 		df.logger.Debug("found existing database in auto-update directory", "path", latest)
 		// Track the original source before creating local copy
 		df.sourceDbPath = latest
+		if df.config.NoLocalCopy {
+			return latest, nil
+		}
 		// Create local copy for consistent access
 		return df.createLocalDatabaseCopy(latest)
 	}
@@ -237,7 +387,7 @@ func (df *DatabaseFactory) createLocalDatabaseCopy(sourcePath string) (string, e
 	// Always create unique timestamped copy with nanoseconds to guarantee uniqueness
 	now := time.Now()
 	timestamp := fmt.Sprintf("%s_%d", now.Format("20060102_150405"), now.Nanosecond())
-	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("IP2LOCATION-LITE-DB1.IPV6_%s.BIN", timestamp))
+	tmpFile := filepath.Join(df.localCopyDir(), fmt.Sprintf("IP2LOCATION-LITE-DB1.IPV6_%s.BIN", timestamp))
 
 	// Copy to temp location
 	if err := copyFile(sourcePath, tmpFile, false); err != nil {
@@ -245,24 +395,57 @@ func (df *DatabaseFactory) createLocalDatabaseCopy(sourcePath string) (string, e
 	}
 
 	df.currentLocalDbCopy = tmpFile
+	trackLocalCopy(tmpFile, true)
 	df.logger.Debug("created local database copy", "source", sourcePath, "dest", tmpFile)
 	return tmpFile, nil
 }
 
-// startAutoUpdate starts the auto-update ticker
+// localCopyDir returns the directory local database copies are written to
+func (df *DatabaseFactory) localCopyDir() string {
+	if df.config.DatabaseLocalCopyDir != "" {
+		return df.config.DatabaseLocalCopyDir
+	}
+	return os.TempDir()
+}
+
+// validateLocalCopyDir checks that dir is an existing directory we can create files in
+func validateLocalCopyDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".geoblock-write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// startAutoUpdate starts the auto-update ticker. With an update window the ticker checks every
+// updateWindowTick and updates once per window, instead of every 24 hours.
 func (df *DatabaseFactory) startAutoUpdate() {
-	df.updateTicker = time.NewTicker(24 * time.Hour)
+	interval := 24 * time.Hour
+	if df.updateWindow != nil {
+		interval = updateWindowTick
+	}
+	df.updateTicker = df.clock.NewTicker(interval)
+	df.updateDone = make(chan struct{})
 
 	go func() {
+		defer close(df.updateDone)
 		df.logger.Debug("startAutoUpdate: starting auto-update ticker")
 
 		// Run first check immediately
-		df.checkAndUpdate()
+		df.scheduledCheck()
 
 		for {
 			select {
-			case <-df.updateTicker.C:
-				df.checkAndUpdate()
+			case <-df.updateTicker.C():
+				df.scheduledCheck()
 			case <-df.stopChan:
 				df.logger.Debug("startAutoUpdate: stopping auto-update ticker")
 				return
@@ -271,6 +454,23 @@ func (df *DatabaseFactory) startAutoUpdate() {
 	}()
 }
 
+// scheduledCheck runs checkAndUpdate, once per window when DatabaseAutoUpdateWindow is set.
+// Only called from the update goroutine.
+func (df *DatabaseFactory) scheduledCheck() {
+	if df.updateWindow == nil {
+		df.checkAndUpdate()
+		return
+	}
+	now := df.clock.Now()
+	opened, inside := df.updateWindow.opened(now)
+	if !inside || !df.lastWindowCheck.Before(opened) {
+		return
+	}
+	df.lastWindowCheck = now
+	df.logger.Debug("scheduledCheck: inside the update window", "window", df.updateWindow.String())
+	df.checkAndUpdate()
+}
+
 // checkAndUpdate checks if an update is needed and performs actual downloads/updates
 func (df *DatabaseFactory) checkAndUpdate() {
 	currentVersion := df.wrapper.GetVersion()
@@ -280,12 +480,13 @@ func (df *DatabaseFactory) checkAndUpdate() {
 	}
 
 	// Only update if database is older than 1 month
-	if time.Since(currentVersion.Date()) < 30*24*time.Hour {
-		df.logger.Debug("checkAndUpdate: database is recent, skipping update", "age", time.Since(currentVersion.Date()).Round(24*time.Hour))
+	age := df.clock.Now().Sub(currentVersion.Date())
+	if age < 30*24*time.Hour {
+		df.logger.Debug("checkAndUpdate: database is recent, skipping update", "age", age.Round(24*time.Hour))
 		return
 	}
 
-	df.logger.Info("checkAndUpdate: database is old, attempting download update", "age", time.Since(currentVersion.Date()).Round(24*time.Hour))
+	df.logger.Info("checkAndUpdate: database is old, attempting download update", "age", age.Round(24*time.Hour))
 
 	// Find current latest database
 	latest, err := findLatestDatabase(df.config.DatabaseAutoUpdateDir, df.config.DatabaseAutoUpdateCode)
@@ -299,9 +500,10 @@ func (df *DatabaseFactory) checkAndUpdate() {
 		DatabaseAutoUpdateDir:   df.config.DatabaseAutoUpdateDir,
 		DatabaseAutoUpdateToken: df.config.DatabaseAutoUpdateToken,
 		DatabaseAutoUpdateCode:  df.config.DatabaseAutoUpdateCode,
+		NoLocalCopy:             df.config.NoLocalCopy,
 	}
 
-	if err := UpdateIfNeeded(latest, true, df.logger, updateCfg); err != nil {
+	if err := updateIfNeeded(latest, true, df.logger, updateCfg, df.clock); err != nil {
 		df.logger.Error("checkAndUpdate: background database update failed", "error", err)
 		return
 	}
@@ -326,16 +528,29 @@ func (df *DatabaseFactory) checkAndUpdate() {
 
 // performHotSwap replaces the current database with a new one
 func (df *DatabaseFactory) performHotSwap(newDatabasePath string) error {
-	// Create new local copy with unique name
-	newLocalCopy, err := df.createLocalDatabaseCopy(newDatabasePath)
-	if err != nil {
-		return err
+	oldLocalCopy, oldSource := df.currentLocalDbCopy, df.sourceDbPath
+	oldVersion := df.wrapper.GetVersion()
+
+	// Create new local copy with unique name, or use the new database in place
+	newLocalCopy := newDatabasePath
+	removeCopy := func() {}
+	if !df.config.NoLocalCopy {
+		var err error
+		newLocalCopy, err = df.createLocalDatabaseCopy(newDatabasePath)
+		if err != nil {
+			return err
+		}
+		removeCopy = func() {
+			os.Remove(newLocalCopy)
+			trackLocalCopy(newLocalCopy, false)
+			df.currentLocalDbCopy = oldLocalCopy
+		}
 	}
 
 	// Open new database
-	newDB, err := ip2location.OpenDB(newLocalCopy)
+	newDB, newContent, err := df.openDatabase(newLocalCopy)
 	if err != nil {
-		os.Remove(newLocalCopy)
+		removeCopy()
 		return fmt.Errorf("performHotSwap: failed to open new database: %w", err)
 	}
 
@@ -343,28 +558,46 @@ func (df *DatabaseFactory) performHotSwap(newDatabasePath string) error {
 	newVersion, err := GetDatabaseVersion(newLocalCopy)
 	if err != nil {
 		newDB.Close()
-		os.Remove(newLocalCopy)
+		removeCopy()
 		return fmt.Errorf("performHotSwap: failed to read new database version: %w", err)
 	}
 
 	// Perform the swap
-	oldDB := df.wrapper.swapDatabase(newDB, newLocalCopy, newVersion)
+	oldDB := df.wrapper.swapDatabase(newDB, newContent, newLocalCopy, newVersion)
 
 	// Update tracking information
-	df.currentLocalDbCopy = newLocalCopy
 	df.sourceDbPath = newDatabasePath // Track the new source database
 
 	// Close old database after brief delay for ongoing operations
 	if oldDB != nil {
-		go func() {
-			time.Sleep(10 * time.Second) // Brief delay, not the most elegant approach, but simple. And if it panics, not really a big deal.
+		time.AfterFunc(hotSwapCloseDelay, func() {
 			oldDB.Close()
-		}()
+			if oldLocalCopy != "" {
+				trackLocalCopy(oldLocalCopy, false)
+			}
+		})
 	}
 
+	event := HotSwapEvent{
+		FactoryID:  df.factoryID,
+		NewVersion: newVersion.String(),
+		OldSource:  oldSource,
+		NewSource:  newDatabasePath,
+		Path:       newLocalCopy,
+		Time:       df.clock.Now(),
+	}
+	if oldVersion != nil {
+		event.OldVersion = oldVersion.String()
+	}
 	df.logger.Info("performHotSwap: database hot-swapped successfully",
-		"new_version", newVersion.String(),
+		"old_version", event.OldVersion,
+		"new_version", event.NewVersion,
+		"old_source", oldSource,
+		"new_source", newDatabasePath,
 		"new_path", newLocalCopy)
+	if event.OldVersion != event.NewVersion {
+		sendHotSwapWebhook(df.config.DatabaseHotSwapWebhookURL, event, df.logger)
+	}
 
 	return nil
 }
@@ -400,33 +633,44 @@ func GetDatabaseFactory(config *DatabaseConfig, logger *slog.Logger) (*DatabaseF
 	// Generate unique key from the entire configuration
 	key := generateConfigHash(config)
 
-	factoryMutex.RLock()
-	if factory, exists := factories[key]; exists {
-		factoryMutex.RUnlock()
-		return factory, nil
-	}
-	factoryMutex.RUnlock()
-
-	// Create new factory
 	factoryMutex.Lock()
 	defer factoryMutex.Unlock()
 
-	// Double-check pattern
 	if factory, exists := factories[key]; exists {
+		factory.refCount++
 		return factory, nil
 	}
 
+	// Create new factory
 	factory, err := NewDatabaseFactory(config, logger)
 	if err != nil {
 		return nil, err
 	}
 
+	factory.refCount = 1
 	factories[key] = factory
 	logger.Debug("created new database factory", "config_hash", key)
 
 	return factory, nil
 }
 
+// releaseDatabaseFactory drops one reference to a factory obtained from GetDatabaseFactory,
+// closing it and removing it from the registry when nobody else uses it
+func releaseDatabaseFactory(factory *DatabaseFactory) {
+	factoryMutex.Lock()
+	defer factoryMutex.Unlock()
+
+	factory.refCount--
+	if factory.refCount > 0 {
+		return
+	}
+
+	if registered, exists := factories[factory.factoryID]; exists && registered == factory {
+		delete(factories, factory.factoryID)
+	}
+	factory.Close()
+}
+
 // CleanupFactories closes all database factories (for testing/shutdown)
 func CleanupFactories() {
 	factoryMutex.Lock()
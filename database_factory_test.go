@@ -2,7 +2,12 @@ package traefik_geoblock
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -241,6 +246,24 @@ func TestDatabaseFactory_Initialize_Errors(t *testing.T) {
 			expectError: true,
 			errorText:   "database file not found",
 		},
+		{
+			name: "missing local copy directory",
+			config: &DatabaseConfig{
+				DatabaseFilePath:     "./IP2LOCATION-LITE-DB1.IPV6.BIN",
+				DatabaseLocalCopyDir: "./nonexistent-copy-dir",
+			},
+			expectError: true,
+			errorText:   "invalid DatabaseLocalCopyDir",
+		},
+		{
+			name: "local copy directory is a file",
+			config: &DatabaseConfig{
+				DatabaseFilePath:     "./IP2LOCATION-LITE-DB1.IPV6.BIN",
+				DatabaseLocalCopyDir: "./IP2LOCATION-LITE-DB1.IPV6.BIN",
+			},
+			expectError: true,
+			errorText:   "is not a directory",
+		},
 	}
 
 	for _, tt := range tests {
@@ -347,6 +370,109 @@ func TestDatabaseFactory_HotSwap(t *testing.T) {
 	}
 }
 
+func TestDatabaseFactory_NoLocalCopy(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	// Any local copy would land in the temp directory
+	tempRoot := t.TempDir()
+	t.Setenv("TMPDIR", tempRoot)
+
+	updateDir := t.TempDir()
+	oldDbPath := filepath.Join(updateDir, time.Now().AddDate(0, -2, 0).Format("20060102")+"_IP2LOCATION-LITE-DB1.IPV6.BIN")
+	newDbPath := filepath.Join(updateDir, time.Now().Format("20060102")+"_IP2LOCATION-LITE-DB1.IPV6.BIN")
+	if err := copyFile("./IP2LOCATION-LITE-DB1.IPV6.BIN", oldDbPath, true); err != nil {
+		t.Fatalf("Failed to copy old database: %v", err)
+	}
+	// Mimic a read-only mount
+	if err := os.Chmod(oldDbPath, 0444); err != nil {
+		t.Fatalf("Failed to make database read-only: %v", err)
+	}
+
+	config := &DatabaseConfig{
+		DatabaseFilePath:       "./IP2LOCATION-LITE-DB1.IPV6.BIN",
+		DatabaseAutoUpdate:     true,
+		DatabaseAutoUpdateDir:  updateDir,
+		DatabaseAutoUpdateCode: "DB1",
+		NoLocalCopy:            true,
+	}
+	factory, err := NewDatabaseFactory(config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	wrapper := factory.GetWrapper()
+	if wrapper.GetPath() != oldDbPath {
+		t.Errorf("Expected database to be opened in place at %s, got %s", oldDbPath, wrapper.GetPath())
+	}
+
+	if err := copyFile("./IP2LOCATION-LITE-DB1.IPV6.BIN", newDbPath, true); err != nil {
+		t.Fatalf("Failed to copy new database: %v", err)
+	}
+	if err := factory.performHotSwap(newDbPath); err != nil {
+		t.Fatalf("Failed to perform hot swap: %v", err)
+	}
+	if wrapper.GetPath() != newDbPath {
+		t.Errorf("Expected hot swapped database to be opened in place at %s, got %s", newDbPath, wrapper.GetPath())
+	}
+
+	record, err := wrapper.Get_country_short("8.8.8.8")
+	if err != nil {
+		t.Fatalf("Failed to lookup IP after hot swap: %v", err)
+	}
+	if record.Country_short != "US" {
+		t.Errorf("Expected country US for 8.8.8.8, got %s", record.Country_short)
+	}
+
+	entries, err := os.ReadDir(tempRoot)
+	if err != nil {
+		t.Fatalf("Failed to read temp directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no local copies in the temp directory, found %d entries", len(entries))
+	}
+}
+
+func TestDatabaseFactory_LocalCopyDir(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	updateDir := t.TempDir()
+	copyDir := t.TempDir()
+	dbPath := filepath.Join(updateDir, time.Now().Format("20060102")+"_IP2LOCATION-LITE-DB1.IPV6.BIN")
+	if err := copyFile("./IP2LOCATION-LITE-DB1.IPV6.BIN", dbPath, true); err != nil {
+		t.Fatalf("Failed to copy database: %v", err)
+	}
+
+	factory, err := NewDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:       "./IP2LOCATION-LITE-DB1.IPV6.BIN",
+		DatabaseAutoUpdate:     true,
+		DatabaseAutoUpdateDir:  updateDir,
+		DatabaseAutoUpdateCode: "DB1",
+		DatabaseLocalCopyDir:   copyDir,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Failed to create factory: %v", err)
+	}
+	// The update goroutine writes to the temp dirs, it must be done before they are removed
+	defer func() {
+		factory.Close()
+		<-factory.updateDone
+	}()
+
+	if got := filepath.Dir(factory.GetWrapper().GetPath()); got != copyDir {
+		t.Errorf("Expected local copy in %s, got %s", copyDir, factory.GetWrapper().GetPath())
+	}
+	entries, err := os.ReadDir(copyDir)
+	if err != nil {
+		t.Fatalf("Failed to read copy directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the local copy in %s, found %d entries", copyDir, len(entries))
+	}
+}
+
 func TestCleanupFactories(t *testing.T) {
 	// Create a couple of factories
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
@@ -828,3 +954,124 @@ func TestDatabaseFactory_CheckAndUpdate_SynchronousDownloadAndHotSwap(t *testing
 		}
 	}
 }
+
+func TestDatabaseFactory_HotSwapWebhook(t *testing.T) {
+	events := make(chan HotSwapEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var event HotSwapEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	config := &DatabaseConfig{
+		DatabaseFilePath:          tinyDbFilePath,
+		NoLocalCopy:               true,
+		DatabaseHotSwapWebhookURL: server.URL,
+	}
+	factory, err := NewDatabaseFactory(config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	// The same database with the next day in its header
+	content, err := os.ReadFile(tinyDbFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read database: %v", err)
+	}
+	content[4]++
+	newDbPath := filepath.Join(t.TempDir(), "IP2LOCATION-LITE-DB1.IPV6.BIN")
+	if err := os.WriteFile(newDbPath, content, 0644); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+
+	oldVersion := factory.GetWrapper().GetVersion().String()
+	if err := factory.performHotSwap(newDbPath); err != nil {
+		t.Fatalf("Failed to perform hot swap: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Event != "database_hot_swap" || event.OldVersion != oldVersion ||
+			event.NewVersion != factory.GetWrapper().GetVersion().String() || event.OldVersion == event.NewVersion {
+			t.Errorf("unexpected versions in event: %+v", event)
+		}
+		if event.OldSource != tinyDbFilePath || event.NewSource != newDbPath || event.Path != newDbPath {
+			t.Errorf("unexpected sources in event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+	}
+
+	// Swapping in the same version again doesn't notify
+	if err := factory.performHotSwap(newDbPath); err != nil {
+		t.Fatalf("Failed to perform hot swap: %v", err)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected webhook for an unchanged version: %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDatabaseFactory_InvalidHotSwapWebhook(t *testing.T) {
+	config := &DatabaseConfig{DatabaseFilePath: tinyDbFilePath, DatabaseHotSwapWebhookURL: "ftp://example.com/hook"}
+	if _, err := NewDatabaseFactory(config, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Fatal("expected an error for a non-http webhook URL")
+	}
+}
+
+func TestDatabaseFactory_WarmUp(t *testing.T) {
+	for _, mode := range []string{DatabaseWarmUpNone, DatabaseWarmUpRead, "Memory"} {
+		t.Run(mode, func(t *testing.T) {
+			logs := &syncBuffer{}
+			config := &DatabaseConfig{DatabaseFilePath: tinyDbFilePath, NoLocalCopy: true, DatabaseWarmUp: mode}
+			factory, err := NewDatabaseFactory(config, slog.New(slog.NewTextHandler(logs, nil)))
+			if err != nil {
+				t.Fatalf("Failed to create factory: %v", err)
+			}
+			defer factory.Close()
+
+			// A copy of the database, emptied before the lookups: only a database in memory still answers
+			newDbPath := filepath.Join(t.TempDir(), "IP2LOCATION-LITE-DB1.IPV6.BIN")
+			content, err := os.ReadFile(tinyDbFilePath)
+			if err != nil {
+				t.Fatalf("Failed to read database: %v", err)
+			}
+			if err := os.WriteFile(newDbPath, content, 0644); err != nil {
+				t.Fatalf("Failed to write database: %v", err)
+			}
+			if err := factory.performHotSwap(newDbPath); err != nil {
+				t.Fatalf("Failed to perform hot swap: %v", err)
+			}
+			if mode == "Memory" {
+				if err := os.WriteFile(newDbPath, nil, 0644); err != nil {
+					t.Fatalf("Failed to empty database: %v", err)
+				}
+			}
+
+			if country, err := factory.GetWrapper().LookupCountry("8.8.8.8"); err != nil || country != "US" {
+				t.Errorf("expected US, got %q (%v)", country, err)
+			}
+			// The range reader searches the same content
+			if country, _, _, _, err := factory.GetWrapper().LookupRange(net.ParseIP("8.8.8.8")); err != nil || country != "US" {
+				t.Errorf("expected US from the range reader, got %q (%v)", country, err)
+			}
+			want := 2
+			if mode == DatabaseWarmUpNone {
+				want = 0
+			}
+			if warmed := strings.Count(logs.String(), "database warmed up"); warmed != want {
+				t.Errorf("expected a warm-up at startup and on the hot swap, got %d in %s", warmed, logs.String())
+			}
+		})
+	}
+
+	config := &DatabaseConfig{DatabaseFilePath: tinyDbFilePath, DatabaseWarmUp: "mmap"}
+	if _, err := NewDatabaseFactory(config, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Fatal("expected an error for an unknown warm-up mode")
+	}
+}
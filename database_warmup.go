@@ -0,0 +1,86 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ip2location/ip2location-go/v9"
+)
+
+// What is done with a database file before it is swapped in
+const (
+	DatabaseWarmUpNone   = "none"   // Nothing, the first lookups read the file from disk (default)
+	DatabaseWarmUpRead   = "read"   // Read the file sequentially once, so its pages are in the page cache
+	DatabaseWarmUpMemory = "memory" // Load the file into memory and serve lookups from there
+)
+
+// validateDatabaseWarmUp checks the DatabaseWarmUp mode
+func validateDatabaseWarmUp(mode string) error {
+	switch strings.ToLower(mode) {
+	case "", DatabaseWarmUpNone, DatabaseWarmUpRead, DatabaseWarmUpMemory:
+		return nil
+	}
+	return fmt.Errorf("invalid DatabaseWarmUp %q, must be one of: %s, %s, %s",
+		mode, DatabaseWarmUpNone, DatabaseWarmUpRead, DatabaseWarmUpMemory)
+}
+
+// memoryDBReader serves a database file loaded into memory
+type memoryDBReader struct {
+	*bytes.Reader
+}
+
+// Close releases nothing, the garbage collector frees the content once the database is dropped
+func (memoryDBReader) Close() error {
+	return nil
+}
+
+// openDatabase opens a database file, warming it up first as configured. Lookups against a cold file
+// miss the page cache, which shows as a latency spike on the first requests after a monthly update.
+// Returns the content of the file when it was loaded into memory, for the range reader to share.
+func (df *DatabaseFactory) openDatabase(path string) (*ip2location.DB, []byte, error) {
+	mode := strings.ToLower(df.config.DatabaseWarmUp)
+	if mode == "" || mode == DatabaseWarmUpNone {
+		db, err := openIP2LocationDB(path)
+		return db, nil, err
+	}
+
+	start := time.Now()
+	var db *ip2location.DB
+	var content []byte
+	var size int64
+	var err error
+	if mode == DatabaseWarmUpMemory {
+		if content, err = os.ReadFile(path); err != nil {
+			return nil, nil, fmt.Errorf("failed to load database into memory: %w", err)
+		}
+		size = int64(len(content))
+		ip2locationGlobals.Lock()
+		db, err = ip2location.OpenDBWithReader(memoryDBReader{bytes.NewReader(content)})
+		ip2locationGlobals.Unlock()
+	} else {
+		if size, err = readSequentially(path); err != nil {
+			return nil, nil, fmt.Errorf("failed to warm up database: %w", err)
+		}
+		db, err = openIP2LocationDB(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	df.logger.Info("database warmed up", "path", path, "mode", mode, "bytes", size, "duration", time.Since(start))
+	return db, content, nil
+}
+
+// readSequentially reads a whole file and discards it, leaving it in the page cache
+func readSequentially(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.CopyBuffer(io.Discard, file, make([]byte, 1<<20))
+}
@@ -0,0 +1,236 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// rangeKey is an IP as a 128-bit number. IPv4 addresses only use lo.
+type rangeKey struct {
+	hi, lo uint64
+}
+
+func (k rangeKey) less(other rangeKey) bool {
+	return k.hi < other.hi || (k.hi == other.hi && k.lo < other.lo)
+}
+
+// ipRangeKey converts an IP to its key. IPv4-mapped addresses are IPv4.
+func ipRangeKey(ip net.IP) (key rangeKey, v4 bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return rangeKey{lo: uint64(binary.BigEndian.Uint32(ip4))}, true
+	}
+	ip16 := ip.To16()
+	return rangeKey{hi: binary.BigEndian.Uint64(ip16[:8]), lo: binary.BigEndian.Uint64(ip16[8:])}, false
+}
+
+// binRangeReader searches an IP2Location BIN file like the ip2location library does, but also returns the
+// bounds of the matched row. Each row covers [from, to) and maps to a single country.
+type binRangeReader struct {
+	file         io.ReaderAt // The BIN file, or its content when the database was loaded into memory
+	closer       io.Closer   // nil for content in memory
+	path         string
+	v4Count      uint32
+	v4Addr       uint32
+	v6Count      uint32
+	v6Addr       uint32
+	v4IndexAddr  uint32
+	v6IndexAddr  uint32
+	v4ColumnSize uint32
+	v6ColumnSize uint32
+}
+
+// errRangeNotSupported is returned for IPs the library remaps (6to4, Teredo), which are left to the library
+var errRangeNotSupported = errors.New("range lookup not supported for this address")
+
+// openBinRangeReader opens the BIN file and reads its header
+func openBinRangeReader(path string) (*binRangeReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newBinRangeReader(file, file, path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// newBinRangeReader reads the header of the BIN file in source. closer is closed by Close, nil for content in memory.
+func newBinRangeReader(source io.ReaderAt, closer io.Closer, path string) (*binRangeReader, error) {
+	header := make([]byte, 64)
+	if _, err := source.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read database header: %w", err)
+	}
+
+	columns := uint32(header[1])
+	if columns < 2 {
+		return nil, fmt.Errorf("database %s has no country column", path)
+	}
+
+	return &binRangeReader{
+		file:         source,
+		closer:       closer,
+		path:         path,
+		v4Count:      binary.LittleEndian.Uint32(header[5:]),
+		v4Addr:       binary.LittleEndian.Uint32(header[9:]),
+		v6Count:      binary.LittleEndian.Uint32(header[13:]),
+		v6Addr:       binary.LittleEndian.Uint32(header[17:]),
+		v4IndexAddr:  binary.LittleEndian.Uint32(header[21:]),
+		v6IndexAddr:  binary.LittleEndian.Uint32(header[25:]),
+		v4ColumnSize: columns << 2,
+		v6ColumnSize: 16 + ((columns - 1) << 2),
+	}, nil
+}
+
+// isRemappedIPv6 reports whether the library maps the IPv6 address to IPv4 (6to4 and Teredo)
+func isRemappedIPv6(key rangeKey) bool {
+	return key.hi>>48 == 0x2002 || key.hi>>32 == 0x20010000
+}
+
+// lookup returns the country of the IP and the [from, to) bounds of its database row
+func (r *binRangeReader) lookup(ip net.IP) (country string, from, to rangeKey, v4 bool, err error) {
+	key, v4 := ipRangeKey(ip)
+	if !v4 && isRemappedIPv6(key) {
+		return "", rangeKey{}, rangeKey{}, false, errRangeNotSupported
+	}
+
+	base, count, columnSize, firstColumn := r.v4Addr, r.v4Count, r.v4ColumnSize, uint32(4)
+	if !v4 {
+		if r.v6Count == 0 {
+			return "", rangeKey{}, rangeKey{}, false, errRangeNotSupported
+		}
+		base, count, columnSize, firstColumn = r.v6Addr, r.v6Count, r.v6ColumnSize, 16
+	}
+
+	low, high := int64(0), int64(count)
+	if indexAddr := r.indexAddr(key, v4); indexAddr > 0 {
+		index := make([]byte, 8)
+		if _, err := r.file.ReadAt(index, int64(indexAddr)-1); err != nil {
+			return "", rangeKey{}, rangeKey{}, v4, err
+		}
+		low, high = int64(binary.LittleEndian.Uint32(index)), int64(binary.LittleEndian.Uint32(index[4:]))
+	}
+
+	// The last address of the space belongs to the last row
+	if (v4 && key.lo >= 0xFFFFFFFF) || (!v4 && key.hi == ^uint64(0) && key.lo == ^uint64(0)) {
+		key.lo--
+	}
+
+	row := make([]byte, columnSize+firstColumn)
+	for low <= high {
+		mid := (low + high) >> 1
+		if _, err := r.file.ReadAt(row, int64(base)+mid*int64(columnSize)-1); err != nil {
+			return "", rangeKey{}, rangeKey{}, v4, err
+		}
+
+		from, to = r.readKey(row, 0, v4), r.readKey(row, columnSize, v4)
+		switch {
+		case key.less(from):
+			high = mid - 1
+		case !key.less(to):
+			low = mid + 1
+		default:
+			country, err := r.readString(binary.LittleEndian.Uint32(row[firstColumn:]))
+			return country, from, to, v4, err
+		}
+	}
+	return "", rangeKey{}, rangeKey{}, v4, fmt.Errorf("no database row for %s", ip)
+}
+
+// indexAddr returns the position of the index entry for the key, or 0 when the section has no index
+func (r *binRangeReader) indexAddr(key rangeKey, v4 bool) uint32 {
+	if v4 {
+		if r.v4IndexAddr == 0 {
+			return 0
+		}
+		return uint32(key.lo>>16)<<3 + r.v4IndexAddr
+	}
+	if r.v6IndexAddr == 0 {
+		return 0
+	}
+	return uint32(key.hi>>48)<<3 + r.v6IndexAddr
+}
+
+// readKey reads a little endian IP number from a row
+func (r *binRangeReader) readKey(row []byte, pos uint32, v4 bool) rangeKey {
+	if v4 {
+		return rangeKey{lo: uint64(binary.LittleEndian.Uint32(row[pos:]))}
+	}
+	return rangeKey{lo: binary.LittleEndian.Uint64(row[pos:]), hi: binary.LittleEndian.Uint64(row[pos+8:])}
+}
+
+// readString reads a length-prefixed string
+func (r *binRangeReader) readString(pos uint32) (string, error) {
+	data := make([]byte, 256)
+	n, err := r.file.ReadAt(data, int64(pos))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	length := int(data[0])
+	if length+1 > n {
+		return "", fmt.Errorf("truncated string at %d", pos)
+	}
+	return string(data[1 : length+1]), nil
+}
+
+func (r *binRangeReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// LookupRange returns the country of the IP and the [from, to) bounds of the database row it belongs to,
+// so callers can cache the whole row. Returns errRangeNotSupported for 6to4 and Teredo addresses.
+func (dw *DatabaseWrapper) LookupRange(ip net.IP) (country string, from, to rangeKey, v4 bool, err error) {
+	reader, err := dw.rangeReader()
+	if err != nil {
+		return "", rangeKey{}, rangeKey{}, false, err
+	}
+	start := time.Now()
+	country, from, to, v4, err = reader.lookup(ip)
+	dw.latency.record(time.Since(start))
+	return country, from, to, v4, err
+}
+
+// rangeReader returns the range reader for the current database, reopening it after a hot swap.
+// Only the swap takes the exclusive lock, lookups of the current database share it.
+func (dw *DatabaseWrapper) rangeReader() (*binRangeReader, error) {
+	state := dw.current()
+	dw.rangesMutex.RLock()
+	reader := dw.ranges
+	dw.rangesMutex.RUnlock()
+	if reader != nil && reader.path == state.path {
+		return reader, nil
+	}
+
+	dw.rangesMutex.Lock()
+	defer dw.rangesMutex.Unlock()
+	if dw.ranges != nil && dw.ranges.path == state.path {
+		return dw.ranges, nil
+	}
+
+	// A database loaded into memory is searched there, the file may already be gone
+	var err error
+	if state.content != nil {
+		reader, err = newBinRangeReader(bytes.NewReader(state.content), nil, state.path)
+	} else {
+		reader, err = openBinRangeReader(state.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if old := dw.ranges; old != nil {
+		// Same grace period as the swapped database, lookups may still be running
+		time.AfterFunc(hotSwapCloseDelay, func() { old.Close() })
+	}
+	dw.ranges = reader
+	return reader, nil
+}
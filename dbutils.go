@@ -113,5 +113,11 @@ func GetDateFromName(dbPath string) (time.Time, error) {
 		return time.Time{}, fmt.Errorf("invalid day in filename: %s", dateStr[6:8])
 	}
 
-	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
+	// Atoi accepts signs and time.Date normalizes out of range values, so 2024-1-1 or 20241340
+	// would otherwise turn into some other date
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Format("20060102") != dateStr {
+		return time.Time{}, fmt.Errorf("invalid date in filename: %s", dateStr)
+	}
+	return date, nil
 }
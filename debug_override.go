@@ -0,0 +1,113 @@
+package traefik_geoblock
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// countryOverride lets trusted clients force the detected country through a request header, for QA
+type countryOverride struct {
+	header       string
+	trustedCIDRs []*net.IPNet
+}
+
+// newCountryOverride validates the override settings. Returns nil when no header is configured.
+func newCountryOverride(cfg *Config) (*countryOverride, error) {
+	if cfg.DebugCountryOverrideHeader == "" {
+		return nil, nil
+	}
+
+	trustedCIDRs, err := parseIPNetworks("DebugCountryOverrideTrustedIPBlocks", cfg.DebugCountryOverrideTrustedIPBlocks)
+	if err != nil {
+		return nil, err
+	}
+	return &countryOverride{header: cfg.DebugCountryOverrideHeader, trustedCIDRs: trustedCIDRs}, nil
+}
+
+// trusted reports whether an IP may use the override: private, loopback or in a trusted block
+func (o *countryOverride) trusted(ip string) bool {
+	ipAddr := net.ParseIP(ip)
+	if ipAddr == nil {
+		return false
+	}
+	return ipAddr.IsPrivate() || ipAddr.IsLoopback() || containsIP(o.trustedCIDRs, ipAddr)
+}
+
+// country returns the forced country, or an empty string when the header is absent or the request
+// is not trusted. Every IP in the chain and the direct peer must be trusted, so a public client
+// can't unlock the override by prepending a private address to X-Forwarded-For.
+func (o *countryOverride) country(req *http.Request, remoteIPs []string) string {
+	country := strings.ToUpper(strings.TrimSpace(req.Header.Get(o.header)))
+	if country == "" {
+		return ""
+	}
+
+	if !o.trusted(cleanIPAddress(req.RemoteAddr)) {
+		return ""
+	}
+	for _, ip := range remoteIPs {
+		if !o.trusted(ip) {
+			return ""
+		}
+	}
+	return country
+}
+
+// evaluateCountryOverride decides the request as if it came from the forced country
+func (p Plugin) evaluateCountryOverride(req *http.Request, remoteIPs []string, country string, skipBlocking bool) ipDecision {
+	if p.countryHeader != "" {
+		req.Header.Set(p.countryHeader, p.countryHeaderValue(country))
+	}
+
+	var ip string
+	if len(remoteIPs) > 0 {
+		ip = remoteIPs[0]
+	}
+
+	var (
+		allowed bool
+		phase   string
+		score   *scoreResult
+	)
+	// The forced country is judged with the rules of the client's address family
+	rules := p.countryRulesFor(net.ParseIP(ip))
+	if p.scoring != nil {
+		_, allowedCountry := rules.allowed[country]
+		_, blockedCountry := rules.blocked[country]
+		score = p.scoring.evaluate(country, false, false, allowedCountry, blockedCountry)
+		allowed, phase = !score.blocked, PhaseScore
+	} else {
+		allowed, phase = rules.check(country)
+	}
+
+	if !allowed && !skipBlocking {
+		return ipDecision{blocked: true, ip: ip, country: country, phase: phase, score: score}
+	}
+	return ipDecision{ip: ip, country: country, phase: phase}
+}
+
+// debugCountryOverride returns the forced country for the request, logging every use
+func (p Plugin) debugCountryOverride(req *http.Request, remoteIPs []string, ipChain string) string {
+	if p.countryOverride == nil {
+		return ""
+	}
+
+	country := p.countryOverride.country(req, remoteIPs)
+	if country == "" {
+		if req.Header.Get(p.countryOverride.header) != "" {
+			p.logger.Warn("debug country override ignored from untrusted client",
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain)
+		}
+		return ""
+	}
+
+	p.logger.Info("debug country override used",
+		"country", country,
+		"host", req.Host,
+		"path", req.URL.Path,
+		"remote_addr", req.RemoteAddr,
+		"ip_chain", ipChain)
+	return country
+}
@@ -0,0 +1,83 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugCountryOverride(t *testing.T) {
+	cfg := &Config{
+		Enabled:                             true,
+		DatabaseFilePath:                    tinyDbFilePath,
+		AllowedCountries:                    []string{"AU"},
+		AllowPrivate:                        true,
+		DisallowedStatusCode:                http.StatusForbidden,
+		IPHeaders:                           []string{"x-real-ip"},
+		IPHeaderStrategy:                    IPHeaderStrategyCheckAll,
+		CountryHeader:                       "X-IPCountry",
+		DebugCountryOverrideHeader:          "X-Debug-Country",
+		DebugCountryOverrideTrustedIPBlocks: []string{"203.0.113.0/24"},
+	}
+
+	var seenCountry string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenCountry = r.Header.Get("X-IPCountry")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	plugin, err := New(context.TODO(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		clientIP    string
+		override    string
+		status      int
+		wantCountry string
+	}{
+		{name: "private client forces blocked country", remoteAddr: "10.0.0.1:1234", clientIP: "10.0.0.5", override: "fr", status: http.StatusForbidden},
+		{name: "private client forces allowed country", remoteAddr: "10.0.0.1:1234", clientIP: "10.0.0.5", override: "AU", status: http.StatusTeapot, wantCountry: "AU"},
+		{name: "trusted public client", remoteAddr: "203.0.113.10:1234", clientIP: "203.0.113.10", override: "AU", status: http.StatusTeapot, wantCountry: "AU"},
+		{name: "public client in chain is ignored", remoteAddr: "10.0.0.1:1234", clientIP: "8.8.8.8", override: "AU", status: http.StatusForbidden},
+		{name: "untrusted peer is ignored", remoteAddr: "8.8.8.8:1234", clientIP: "10.0.0.5", override: "FR", status: http.StatusTeapot, wantCountry: PrivateIpCountryAlias},
+		{name: "no header keeps normal detection", remoteAddr: "10.0.0.1:1234", clientIP: "1.1.1.1", status: http.StatusTeapot, wantCountry: "AU"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenCountry = ""
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Real-IP", tt.clientIP)
+			if tt.override != "" {
+				req.Header.Set("X-Debug-Country", tt.override)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if seenCountry != tt.wantCountry {
+				t.Errorf("expected country header %q, got %q", tt.wantCountry, seenCountry)
+			}
+		})
+	}
+}
+
+func TestDebugCountryOverrideDisabledByDefault(t *testing.T) {
+	if CreateConfig().DebugCountryOverrideHeader != "" {
+		t.Error("the debug country override must be disabled by default")
+	}
+	if o, err := newCountryOverride(&Config{DebugCountryOverrideTrustedIPBlocks: []string{"10.0.0.0/8"}}); o != nil || err != nil {
+		t.Errorf("expected no override without a header, got %v, %v", o, err)
+	}
+	if _, err := newCountryOverride(&Config{DebugCountryOverrideHeader: "X-Debug-Country", DebugCountryOverrideTrustedIPBlocks: []string{"not-a-cidr"}}); err == nil {
+		t.Error("expected error for an invalid trusted block")
+	}
+}
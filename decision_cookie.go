@@ -0,0 +1,150 @@
+package traefik_geoblock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PhaseDecisionCookie is used when the allow decision was taken from a valid decision cookie
+const PhaseDecisionCookie = "decision_cookie"
+
+// decisionCookie makes the country of a browsing session sticky. The cookie carries the country, its expiry
+// and an HMAC over both, the host, the database version and the country rules, so it is bound to the site and
+// revoked by a database update or a policy change. It only replaces the database lookup of the client: bans,
+// IP blocks, threat checks and the current country rules still apply. It is deliberately not bound to the IP,
+// to survive mobile IP changes.
+type decisionCookie struct {
+	secret []byte
+	name   string
+	ttl    time.Duration
+	secure bool
+}
+
+// newDecisionCookie validates the decision cookie settings. Returns nil when DecisionCookieName is empty.
+func newDecisionCookie(cfg *Config) (*decisionCookie, error) {
+	if cfg.DecisionCookieName == "" {
+		return nil, nil
+	}
+	if !validCookieName(cfg.DecisionCookieName) {
+		return nil, fmt.Errorf("invalid DecisionCookieName %q, only letters, digits, '_' and '-' are allowed", cfg.DecisionCookieName)
+	}
+	if len(cfg.DecisionCookieSecret) < 16 {
+		return nil, fmt.Errorf("DecisionCookieName needs a DecisionCookieSecret of at least 16 characters")
+	}
+	if cfg.DecisionServiceURL != "" {
+		// The service decides per IP and path, a cookie would skip it for the whole session
+		return nil, fmt.Errorf("DecisionCookieName can't be combined with DecisionServiceURL")
+	}
+	if cfg.DecisionCookieTTLSeconds <= 0 {
+		return nil, fmt.Errorf("DecisionCookieTTLSeconds must be positive, got %d", cfg.DecisionCookieTTLSeconds)
+	}
+	return &decisionCookie{
+		secret: []byte(cfg.DecisionCookieSecret),
+		name:   cfg.DecisionCookieName,
+		ttl:    time.Duration(cfg.DecisionCookieTTLSeconds) * time.Second,
+		secure: cfg.DecisionCookieSecure,
+	}, nil
+}
+
+// eligible reports whether an evaluated decision can be made sticky. Only country allows are: an allowed
+// IP block or private IP says nothing about the next IP of the session.
+func (c *decisionCookie) eligible(decision ipDecision) bool {
+	if decision.blocked || decision.err != nil || isUnknownCountry(decision.country) {
+		return false
+	}
+	return decision.phase == PhaseAllowedCountry || decision.phase == PhaseDefaultAllow
+}
+
+// issue sets the cookie for the country on the response
+func (c *decisionCookie) issue(rw http.ResponseWriter, req *http.Request, country, dbVersion, policy string, now time.Time) {
+	expiry := strconv.FormatInt(now.Add(c.ttl).Unix(), 10)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     c.name,
+		Value:    country + "." + expiry + "." + c.sign(country, expiry, hostName(req.Host), dbVersion, policy),
+		Path:     "/",
+		MaxAge:   int(c.ttl.Seconds()),
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// country returns the country of a valid cookie on the request
+func (c *decisionCookie) country(req *http.Request, dbVersion, policy string, now time.Time) (string, bool) {
+	cookie, err := req.Cookie(c.name)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	country, expiry, signature := parts[0], parts[1], parts[2]
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(c.sign(country, expiry, hostName(req.Host), dbVersion, policy))) {
+		return "", false
+	}
+	return country, true
+}
+
+// sign returns the HMAC of the cookie fields
+func (c *decisionCookie) sign(country, expiry, host, dbVersion, policy string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(country + "|" + expiry + "|" + host + "|" + dbVersion + "|" + policy))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// databaseVersion identifies the loaded database, empty with an injected Lookuper
+func (p Plugin) databaseVersion() string {
+	if p.db == nil {
+		return ""
+	}
+	if version := p.db.GetVersion(); version != nil {
+		return version.String()
+	}
+	return ""
+}
+
+// policyFingerprint identifies the country rules requests are evaluated with, global and per address family.
+// Changing them in the config, the overlay, a profile or a host rule revokes the cookies issued before.
+func (p Plugin) policyFingerprint() string {
+	h := sha256.New()
+	global := countryRules{allowed: p.allowedCountries, blocked: p.blockedCountries, defaultAllow: p.defaultAllow, blockFirst: p.countryBlockFirst}
+	for _, rules := range []*countryRules{&global, p.ipv4Rules, p.ipv6Rules} {
+		if rules == nil {
+			h.Write([]byte("-;"))
+			continue
+		}
+		for _, list := range []map[string]struct{}{rules.allowed, rules.blocked} {
+			codes := make([]string, 0, len(list))
+			for code := range list {
+				codes = append(codes, code)
+			}
+			sort.Strings(codes)
+			h.Write([]byte(strings.Join(codes, ",") + ";"))
+		}
+		fmt.Fprintf(h, "%t,%t;", rules.defaultAllow, rules.blockFirst)
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// cookieClientIP returns the client IP the country of a decision cookie stands for: the first public remote IP
+func cookieClientIP(remoteIPs []string) string {
+	for _, ip := range remoteIPs {
+		if ipAddr := net.ParseIP(ip); ipAddr != nil && !ipAddr.IsPrivate() && !ipAddr.IsLoopback() {
+			return ip
+		}
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecisionCookie(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.DecisionCookieName = "geoblock_session"
+	cfg.DecisionCookieSecret = "0123456789abcdef"
+	cfg.TrapPaths = []string{"/.env"}
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Phase"
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	serve := func(host, ip, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		req.Header.Set("X-Real-IP", ip)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("example.com", "1.1.1.1", "/", nil)
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusTeapot || len(cookies) != 1 || !strings.HasPrefix(cookies[0].Value, "AU.") {
+		t.Fatalf("expected an allowed request with a decision cookie, got %d %v", rr.Code, cookies)
+	}
+	cookie := cookies[0]
+
+	// The session survives an IP change, and the cookie is not renewed
+	if rr := serve("example.com:443", "8.8.8.8", "/", cookie); rr.Code != http.StatusTeapot || len(rr.Result().Cookies()) != 0 {
+		t.Errorf("expected the cookie to allow the new IP, got %d", rr.Code)
+	}
+	if rr := serve("other.example.com", "8.8.8.8", "/", cookie); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the cookie to be bound to its host, got %d", rr.Code)
+	}
+	forged := &http.Cookie{Name: cookie.Name, Value: "US" + strings.TrimPrefix(cookie.Value, "AU")}
+	if rr := serve("example.com", "8.8.8.8", "/", forged); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a forged country to be rejected, got %d", rr.Code)
+	}
+	if rr := serve("example.com", "8.8.8.8", "/.env", cookie); rr.Header().Get("X-Geoblock-Phase") != PhaseTrapPath {
+		t.Errorf("expected trap paths to ignore the cookie, got %q", rr.Header().Get("X-Geoblock-Phase"))
+	}
+	if rr := serve("example.com", "8.8.4.4", "/", nil); len(rr.Result().Cookies()) != 0 {
+		t.Error("expected no cookie for a blocked request")
+	}
+
+	// A database update or a policy change revokes every cookie
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "example.com"
+	req.AddCookie(cookie)
+	policy := plugin.policyFingerprint()
+	if _, ok := plugin.decisionCookie.country(req, plugin.databaseVersion(), policy, time.Now()); !ok {
+		t.Error("expected the cookie to be valid for the loaded database")
+	}
+	if _, ok := plugin.decisionCookie.country(req, "26.1.1", policy, time.Now()); ok {
+		t.Error("expected the cookie to be revoked by another database version")
+	}
+	if _, ok := plugin.decisionCookie.country(req, plugin.databaseVersion(), policy, time.Now().Add(time.Hour)); ok {
+		t.Error("expected the cookie to expire")
+	}
+
+	// Bans still apply to the IP presenting the cookie
+	if err := plugin.BanIP("8.8.8.8", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve("example.com", "8.8.8.8", "/", cookie); rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseDynamicBlocklist {
+		t.Errorf("expected the ban to win over the cookie, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+	}
+}
+
+func TestDecisionCookie_CountryBlockedAfterIssue(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.DecisionCookieName = "geoblock_session"
+	cfg.DecisionCookieSecret = "0123456789abcdef"
+
+	serve := func(plugin *Plugin, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "example.com"
+		req.Header.Set("X-Real-IP", "8.8.8.8")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	issuer, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer issuer.Close()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "example.com"
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	rr := httptest.NewRecorder()
+	issuer.ServeHTTP(rr, req)
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a decision cookie, got %v", cookies)
+	}
+	if rr := serve(issuer, cookies[0]); rr.Code != http.StatusTeapot {
+		t.Fatalf("expected the cookie to allow the session, got %d", rr.Code)
+	}
+
+	// AU is blocked after the cookie was issued, with the same secret
+	cfg.AllowedCountries = nil
+	cfg.BlockedCountries = []string{"AU"}
+	cfg.DefaultAllow = true
+	reloaded, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer reloaded.Close()
+	if reloaded.policyFingerprint() == issuer.policyFingerprint() {
+		t.Error("expected the policy change to change the fingerprint")
+	}
+
+	// 8.8.8.8 is in US: allowed by the new default, but never as AU from the cookie
+	if rr := serve(reloaded, cookies[0]); rr.Code != http.StatusTeapot || len(rr.Result().Cookies()) != 1 || !strings.HasPrefix(rr.Result().Cookies()[0].Value, "US.") {
+		t.Errorf("expected the old cookie to be ignored and a new one for US, got %d %v", rr.Code, rr.Result().Cookies())
+	}
+
+	// The current rules apply to the cookie's country even when the signature still matches
+	cfg.BlockedCountries = []string{"AU", "US"}
+	blocked, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer blocked.Close()
+	expiry := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	forged := &http.Cookie{Name: cfg.DecisionCookieName, Value: "AU." + expiry + "." +
+		blocked.decisionCookie.sign("AU", expiry, "example.com", blocked.databaseVersion(), issuer.policyFingerprint())}
+	if rr := serve(blocked, forged); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a cookie of an old policy to be rejected, got %d", rr.Code)
+	}
+	forged.Value = "AU." + expiry + "." + blocked.decisionCookie.sign("AU", expiry, "example.com", blocked.databaseVersion(), blocked.policyFingerprint())
+	if rr := serve(blocked, forged); rr.Code != http.StatusForbidden {
+		t.Errorf("expected the blocked country of a valid cookie to be blocked, got %d", rr.Code)
+	}
+}
+
+func TestDecisionCookie_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"short secret", Config{DecisionCookieName: "s", DecisionCookieSecret: "short", DecisionCookieTTLSeconds: 60}, "at least 16"},
+		{"decision service", Config{DecisionCookieName: "s", DecisionCookieSecret: "0123456789abcdef", DecisionCookieTTLSeconds: 60,
+			DecisionServiceURL: "http://opa:8181/v1/data/geoblock"}, "DecisionServiceURL"},
+		{"no TTL", Config{DecisionCookieName: "s", DecisionCookieSecret: "0123456789abcdef"}, "DecisionCookieTTLSeconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDecisionCookie(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// decisionLogHeader starts every decision log file, so the replayer can tell the format version
+const decisionLogHeader = "# geoblock decisions v1: unix_seconds,ip,country,phase,allow|block\n"
+
+// DecisionRecord is one line of the decision log
+type DecisionRecord struct {
+	Time    time.Time
+	IP      string
+	Country string
+	Phase   string
+	Blocked bool
+}
+
+// decisionLog appends one compact CSV line per decision to DecisionLogFile, so the decisions can later be
+// replayed against a candidate configuration or database (ReplayDecisions, tools/logreplay -decisions)
+type decisionLog struct {
+	writer *bufferedFileWriter
+}
+
+var (
+	// decisionLogs shares one writer per file between plugin instances, so lines don't interleave
+	decisionLogs      = make(map[string]*decisionLog)
+	decisionLogsMutex sync.Mutex
+)
+
+// getDecisionLog opens DecisionLogFile for appending. Returns nil when no file is configured.
+func getDecisionLog(cfg *Config) (*decisionLog, error) {
+	if cfg.DecisionLogFile == "" {
+		return nil, nil
+	}
+
+	decisionLogsMutex.Lock()
+	defer decisionLogsMutex.Unlock()
+
+	if existing, ok := decisionLogs[cfg.DecisionLogFile]; ok {
+		return existing, nil
+	}
+
+	bufferSize := cfg.FileLogBufferSizeBytes
+	if bufferSize <= 0 {
+		bufferSize = 1024
+	}
+	timeout := time.Duration(cfg.FileLogBufferTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	writer, err := newBufferedFileWriter(cfg.DecisionLogFile, bufferSize, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open decision log %s: %w", cfg.DecisionLogFile, err)
+	}
+	if info, err := writer.file.Stat(); err == nil && info.Size() == 0 {
+		_, _ = writer.Write([]byte(decisionLogHeader))
+	}
+
+	log := &decisionLog{writer: writer}
+	decisionLogs[cfg.DecisionLogFile] = log
+	return log, nil
+}
+
+// record appends a decision. Write errors are dropped like those of the request logs.
+func (l *decisionLog) record(now time.Time, decision ipDecision, blocked bool) {
+	if decision.ip == "" {
+		return
+	}
+	verdict := "allow"
+	if blocked {
+		verdict = "block"
+	}
+	line := strconv.FormatInt(now.Unix(), 10) + "," + decision.ip + "," + decision.country + "," + decision.phase + "," + verdict + "\n"
+	_, _ = l.writer.Write([]byte(line))
+}
+
+// parseDecisionRecord reads one decision log line
+func parseDecisionRecord(line string) (DecisionRecord, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 5 {
+		return DecisionRecord{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return DecisionRecord{}, fmt.Errorf("invalid time %q", fields[0])
+	}
+	if fields[1] == "" {
+		return DecisionRecord{}, fmt.Errorf("missing IP")
+	}
+	record := DecisionRecord{Time: time.Unix(seconds, 0), IP: fields[1], Country: fields[2], Phase: fields[3]}
+	switch fields[4] {
+	case "allow":
+	case "block":
+		record.Blocked = true
+	default:
+		return DecisionRecord{}, fmt.Errorf("invalid verdict %q", fields[4])
+	}
+	return record, nil
+}
+
+// DecisionDiff reports how a candidate configuration or database would have decided the logged requests
+type DecisionDiff struct {
+	Records               int            // Decisions read from the log
+	Skipped               int            // Lines that are not decisions
+	Errors                int            // Decisions whose re-evaluation failed
+	Unchanged             int            // Same verdict as logged
+	NewlyBlocked          int            // Allowed in the log, blocked by the candidate
+	NewlyAllowed          int            // Blocked in the log, allowed by the candidate
+	CountryChanged        int            // Decisions where the candidate resolved another country
+	NewlyBlockedByCountry map[string]int // Newly blocked decisions by the candidate's country
+	NewlyAllowedByCountry map[string]int // Newly allowed decisions by the candidate's country
+	PhaseChanges          map[string]int // Changed verdicts by "logged phase -> candidate phase"
+}
+
+// ReplayDecisions re-evaluates a decision log with this plugin's configuration and database, without
+// blocking anything, and reports the decisions that would change before the candidate is rolled out.
+// Only the IP is re-evaluated: request based checks (rules, User-Agent, quotas...) are not replayed.
+func (p Plugin) ReplayDecisions(r io.Reader) (*DecisionDiff, error) {
+	diff := &DecisionDiff{
+		NewlyBlockedByCountry: make(map[string]int),
+		NewlyAllowedByCountry: make(map[string]int),
+		PhaseChanges:          make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		record, err := parseDecisionRecord(line)
+		if err != nil {
+			diff.Skipped++
+			continue
+		}
+		diff.Records++
+
+		allowed, country, phase, err := p.CheckAllowed(record.IP)
+		if err != nil {
+			diff.Errors++
+			p.logger.Debug("decision replay failed", "ip", record.IP, "error", err)
+			continue
+		}
+		if country != record.Country {
+			diff.CountryChanged++
+		}
+		switch {
+		case allowed == !record.Blocked:
+			diff.Unchanged++
+			continue
+		case allowed:
+			diff.NewlyAllowed++
+			diff.NewlyAllowedByCountry[country]++
+		default:
+			diff.NewlyBlocked++
+			diff.NewlyBlockedByCountry[country]++
+		}
+		diff.PhaseChanges[record.Phase+" -> "+phase]++
+	}
+	if err := scanner.Err(); err != nil {
+		return diff, fmt.Errorf("error reading decision log: %w", err)
+	}
+	return diff, nil
+}
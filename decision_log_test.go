@@ -0,0 +1,84 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecisionLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "decisions.csv")
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US"}
+	cfg.DecisionLogFile = file
+	cfg.BypassHeaders = map[string]string{"X-Bypass": "yes"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	for _, ip := range []string{"8.8.8.8", "85.214.132.1", "1.1.1.1"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	bypassed := httptest.NewRequest(http.MethodGet, "/", nil)
+	bypassed.Header.Set("X-Real-IP", "2a00:1450::1")
+	bypassed.Header.Set("X-Bypass", "yes")
+	plugin.ServeHTTP(httptest.NewRecorder(), bypassed)
+	if err := plugin.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read the decision log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 4 || lines[0]+"\n" != decisionLogHeader {
+		t.Fatalf("expected the header and 3 decisions, got %q", content)
+	}
+	record, err := parseDecisionRecord(lines[2])
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", lines[2], err)
+	}
+	if record.IP != "85.214.132.1" || record.Country != "DE" || record.Phase != PhaseDefaultAllow || !record.Blocked {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	// The candidate allows DE and blocks US
+	candidateCfg := CreateConfig()
+	candidateCfg.Enabled = true
+	candidateCfg.DatabaseFilePath = tinyDbFilePath
+	candidateCfg.AllowedCountries = []string{"DE", "AU"}
+	candidate, err := newPlugin(context.TODO(), &noopHandler{}, candidateCfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer candidate.Close()
+
+	diff, err := candidate.ReplayDecisions(strings.NewReader(string(content) + "garbage\n1700000000,8.8.8.8,US,allowed_country,maybe\n"))
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if diff.Records != 3 || diff.Skipped != 2 || diff.Unchanged != 0 {
+		t.Errorf("expected 3 records, 2 skipped lines and nothing unchanged, got %+v", diff)
+	}
+	if diff.NewlyBlocked != 1 || diff.NewlyBlockedByCountry["US"] != 1 {
+		t.Errorf("expected US to be newly blocked, got %+v", diff)
+	}
+	if diff.NewlyAllowed != 2 || diff.NewlyAllowedByCountry["DE"] != 1 || diff.NewlyAllowedByCountry["AU"] != 1 {
+		t.Errorf("expected DE and AU to be newly allowed, got %+v", diff)
+	}
+	if diff.PhaseChanges[PhaseAllowedCountry+" -> "+PhaseDefaultAllow] != 1 || diff.PhaseChanges[PhaseDefaultAllow+" -> "+PhaseAllowedCountry] != 2 {
+		t.Errorf("unexpected phase changes %v", diff.PhaseChanges)
+	}
+}
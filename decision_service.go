@@ -0,0 +1,282 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseExternal is used when the external decision service blocked the request
+const PhaseExternal = "external"
+
+// Decision service formats
+const (
+	DecisionServiceFormatWebhook = "webhook" // POST the context, expects {"allow": bool}
+	DecisionServiceFormatOPA     = "opa"     // POST {"input": context}, expects {"result": bool} or {"result": {"allow": bool}}
+)
+
+// Decision service fallbacks, used when the service fails or times out
+const (
+	DecisionServiceFallbackLocal = "local" // Keep the decision made by the plugin rules
+	DecisionServiceFallbackAllow = "allow"
+	DecisionServiceFallbackBlock = "block"
+)
+
+// maxDecisionCacheEntries bounds the decision cache, it is flushed when full
+const maxDecisionCacheEntries = 10000
+
+// decisionRequest is the context sent to the external decision service
+type decisionRequest struct {
+	IP           string `json:"ip"`
+	Country      string `json:"country"`
+	ASN          string `json:"asn,omitempty"` // Empty unless the database provides it
+	Host         string `json:"host"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	LocalAllowed bool   `json:"localAllowed"` // Decision of the plugin rules
+	LocalPhase   string `json:"localPhase,omitempty"`
+}
+
+// decisionCacheEntry is a cached answer of the decision service
+type decisionCacheEntry struct {
+	allow   bool
+	expires time.Time
+}
+
+// decisionService defers the final decision to an external policy endpoint
+type decisionService struct {
+	url      string
+	format   string
+	fallback string
+	headers  map[string]string
+	cacheTTL time.Duration
+	client   *http.Client
+
+	mu         *sync.Mutex
+	cache      map[string]decisionCacheEntry
+	maxEntries int // Cache capacity, maxDecisionCacheEntries unless shrunk by MemoryBudgetMB
+}
+
+// newDecisionService validates the decision service settings. Returns nil when no URL is configured.
+func newDecisionService(cfg *Config) (*decisionService, error) {
+	if cfg.DecisionServiceURL == "" {
+		return nil, nil
+	}
+
+	if _, err := url.ParseRequestURI(cfg.DecisionServiceURL); err != nil {
+		return nil, fmt.Errorf("invalid DecisionServiceURL: %w", err)
+	}
+
+	format := strings.ToLower(cfg.DecisionServiceFormat)
+	switch format {
+	case "":
+		format = DecisionServiceFormatWebhook
+	case DecisionServiceFormatWebhook, DecisionServiceFormatOPA:
+	default:
+		return nil, fmt.Errorf("invalid DecisionServiceFormat %q: must be %q or %q",
+			cfg.DecisionServiceFormat, DecisionServiceFormatWebhook, DecisionServiceFormatOPA)
+	}
+
+	fallback := strings.ToLower(cfg.DecisionServiceFallback)
+	switch fallback {
+	case "":
+		fallback = DecisionServiceFallbackLocal
+	case DecisionServiceFallbackLocal, DecisionServiceFallbackAllow, DecisionServiceFallbackBlock:
+	default:
+		return nil, fmt.Errorf("invalid DecisionServiceFallback %q: must be %q, %q or %q",
+			cfg.DecisionServiceFallback, DecisionServiceFallbackLocal, DecisionServiceFallbackAllow, DecisionServiceFallbackBlock)
+	}
+
+	if cfg.DecisionServiceTimeoutMs <= 0 {
+		return nil, fmt.Errorf("DecisionServiceTimeoutMs must be positive, got %d", cfg.DecisionServiceTimeoutMs)
+	}
+	if cfg.DecisionServiceCacheSeconds < 0 {
+		return nil, fmt.Errorf("DecisionServiceCacheSeconds can't be negative, got %d", cfg.DecisionServiceCacheSeconds)
+	}
+
+	return &decisionService{
+		url:        cfg.DecisionServiceURL,
+		format:     format,
+		fallback:   fallback,
+		headers:    cfg.DecisionServiceHeaders,
+		cacheTTL:   time.Duration(cfg.DecisionServiceCacheSeconds) * time.Second,
+		client:     &http.Client{Timeout: time.Duration(cfg.DecisionServiceTimeoutMs) * time.Millisecond},
+		mu:         &sync.Mutex{},
+		cache:      make(map[string]decisionCacheEntry),
+		maxEntries: maxDecisionCacheEntries,
+	}, nil
+}
+
+// decide asks the service about the request and returns the final decision.
+// Decisions caused by lookup errors are kept as they are, there is no reliable context to send.
+func (s *decisionService) decide(req *http.Request, local ipDecision, logger *slog.Logger) ipDecision {
+	if local.err != nil || local.ip == "" {
+		return local
+	}
+
+	payload := decisionRequest{
+		IP:           local.ip,
+		Country:      local.country,
+		Host:         req.Host,
+		Method:       req.Method,
+		Path:         req.URL.Path,
+		LocalAllowed: !local.blocked,
+		LocalPhase:   local.phase,
+	}
+
+	cacheKey := strings.Join([]string{payload.IP, payload.Method, payload.Host, payload.Path, payload.LocalPhase}, "|")
+	allow, cached := s.cached(cacheKey)
+	if !cached {
+		var err error
+		allow, err = s.query(req.Context(), payload)
+		if err != nil {
+			logger.Warn("decision service failed, using fallback",
+				"ip", local.ip,
+				"fallback", s.fallback,
+				"error", err)
+
+			switch s.fallback {
+			case DecisionServiceFallbackAllow:
+				return ipDecision{ip: local.ip, country: local.country, phase: PhaseExternal}
+			case DecisionServiceFallbackBlock:
+				return ipDecision{blocked: true, ip: local.ip, country: local.country, phase: PhaseExternal}
+			default:
+				return local
+			}
+		}
+		s.store(cacheKey, allow)
+	}
+
+	logger.Debug("decision service answered",
+		"ip", local.ip,
+		"country", local.country,
+		"allow", allow,
+		"local_allowed", !local.blocked,
+		"cached", cached)
+
+	if allow {
+		return ipDecision{ip: local.ip, country: local.country, phase: PhaseExternal}
+	}
+	if local.blocked {
+		return local // Keep the more specific local phase
+	}
+	return ipDecision{blocked: true, ip: local.ip, country: local.country, phase: PhaseExternal}
+}
+
+// query calls the decision service
+func (s *decisionService) query(ctx context.Context, payload decisionRequest) (bool, error) {
+	var body interface{} = payload
+	if s.format == DecisionServiceFormatOPA {
+		body = map[string]interface{}{"input": payload}
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(encoded))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return false, err
+	}
+
+	if s.format == DecisionServiceFormatOPA {
+		return parseOPAResult(raw)
+	}
+
+	var answer struct {
+		Allow *bool `json:"allow"`
+	}
+	if err := json.Unmarshal(raw, &answer); err != nil {
+		return false, fmt.Errorf("invalid response: %w", err)
+	}
+	if answer.Allow == nil {
+		return false, fmt.Errorf("response has no allow field")
+	}
+	return *answer.Allow, nil
+}
+
+// parseOPAResult accepts both a boolean rule ({"result": true}) and an object rule ({"result": {"allow": true}}).
+// An undefined decision (no result) is an error so that the fallback applies.
+func parseOPAResult(raw []byte) (bool, error) {
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &answer); err != nil {
+		return false, fmt.Errorf("invalid OPA response: %w", err)
+	}
+	if len(answer.Result) == 0 {
+		return false, fmt.Errorf("OPA decision is undefined")
+	}
+
+	var allow bool
+	if err := json.Unmarshal(answer.Result, &allow); err == nil {
+		return allow, nil
+	}
+
+	var object struct {
+		Allow *bool `json:"allow"`
+	}
+	if err := json.Unmarshal(answer.Result, &object); err != nil || object.Allow == nil {
+		return false, fmt.Errorf("OPA result must be a boolean or an object with an allow field")
+	}
+	return *object.Allow, nil
+}
+
+// cached returns the cached answer for the key, if still valid
+func (s *decisionService) cached(key string) (bool, bool) {
+	if s.cacheTTL == 0 {
+		return false, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return false, false
+	}
+	return entry.allow, true
+}
+
+// store caches an answer
+func (s *decisionService) store(key string, allow bool) {
+	if s.cacheTTL == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cache) >= s.maxEntries {
+		s.cache = make(map[string]decisionCacheEntry)
+	}
+	s.cache[key] = decisionCacheEntry{allow: allow, expires: time.Now().Add(s.cacheTTL)}
+}
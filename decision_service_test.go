@@ -0,0 +1,184 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newDecisionServiceTestPlugin(t *testing.T, serviceURL, format, fallback string, cacheSeconds int) http.Handler {
+	t.Helper()
+
+	cfg := &Config{
+		Enabled:                      true,
+		DatabaseFilePath:             tinyDbFilePath,
+		AllowedCountries:             []string{"AU"},
+		DisallowedStatusCode:         http.StatusForbidden,
+		IPHeaders:                    []string{"x-real-ip"},
+		IPHeaderStrategy:             IPHeaderStrategyCheckAll,
+		RemediationHeadersCustomName: "X-Geoblock-Action",
+		DecisionServiceURL:           serviceURL,
+		DecisionServiceFormat:        format,
+		DecisionServiceFallback:      fallback,
+		DecisionServiceTimeoutMs:     100,
+		DecisionServiceCacheSeconds:  cacheSeconds,
+		DecisionServiceHeaders:       map[string]string{"Authorization": "Bearer test"},
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return plugin
+}
+
+func serveIP(handler http.Handler, ip, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Real-IP", ip)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestDecisionServiceWebhook(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		if r.Header.Get("Authorization") != "Bearer test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload decisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Allow US on /public only, deny everything under /admin
+		allow := (payload.Country == "US" && payload.Path == "/public") ||
+			(payload.LocalAllowed && payload.Path != "/admin")
+		_ = json.NewEncoder(w).Encode(map[string]bool{"allow": allow})
+	}))
+	defer server.Close()
+
+	plugin := newDecisionServiceTestPlugin(t, server.URL, "", "", 60)
+
+	tests := []struct {
+		name   string
+		ip     string
+		path   string
+		status int
+		phase  string
+	}{
+		{name: "service overrides local block", ip: "8.8.8.8", path: "/public", status: http.StatusTeapot},
+		{name: "local block kept with its phase", ip: "8.8.8.8", path: "/other", status: http.StatusForbidden, phase: PhaseDefaultAllow},
+		{name: "service blocks locally allowed request", ip: "1.1.1.1", path: "/admin", status: http.StatusForbidden, phase: PhaseExternal},
+		{name: "service allows locally allowed request", ip: "1.1.1.1", path: "/", status: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveIP(plugin, tt.ip, tt.path)
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("X-Geoblock-Action"); got != tt.phase {
+				t.Errorf("expected remediation header %q, got %q", tt.phase, got)
+			}
+		})
+	}
+
+	t.Run("AnswersAreCached", func(t *testing.T) {
+		before := atomic.LoadInt64(&calls)
+		for i := 0; i < 5; i++ {
+			serveIP(plugin, "1.1.1.1", "/cached")
+		}
+		if got := atomic.LoadInt64(&calls) - before; got != 1 {
+			t.Errorf("expected one call to the service, got %d", got)
+		}
+	})
+}
+
+func TestDecisionServiceOPA(t *testing.T) {
+	responses := map[string]string{
+		"/bool":      `{"result": false}`,
+		"/object":    `{"result": {"allow": false}}`,
+		"/undefined": `{}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input *decisionRequest `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Input == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(responses[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/bool", "/object"} {
+		plugin := newDecisionServiceTestPlugin(t, server.URL+path, DecisionServiceFormatOPA, "", 0)
+		if rr := serveIP(plugin, "1.1.1.1", "/"); rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected OPA deny to block, got status %d", path, rr.Code)
+		}
+	}
+
+	// Undefined decisions use the fallback, here the local decision
+	plugin := newDecisionServiceTestPlugin(t, server.URL+"/undefined", DecisionServiceFormatOPA, "", 0)
+	if rr := serveIP(plugin, "1.1.1.1", "/"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected local decision on undefined OPA result, got status %d", rr.Code)
+	}
+}
+
+func TestDecisionServiceFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond) // Longer than the 100ms timeout
+		_, _ = w.Write([]byte(`{"allow": true}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		fallback string
+		ip       string
+		status   int
+	}{
+		{fallback: DecisionServiceFallbackLocal, ip: "1.1.1.1", status: http.StatusTeapot},
+		{fallback: DecisionServiceFallbackLocal, ip: "8.8.8.8", status: http.StatusForbidden},
+		{fallback: DecisionServiceFallbackAllow, ip: "8.8.8.8", status: http.StatusTeapot},
+		{fallback: DecisionServiceFallbackBlock, ip: "1.1.1.1", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fallback+"_"+tt.ip, func(t *testing.T) {
+			plugin := newDecisionServiceTestPlugin(t, server.URL, "", tt.fallback, 0)
+			if rr := serveIP(plugin, tt.ip, "/"); rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDecisionServiceValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "relative URL", cfg: Config{DecisionServiceURL: "decide", DecisionServiceTimeoutMs: 100}},
+		{name: "unknown format", cfg: Config{DecisionServiceURL: "http://opa:8181/v1/data/geo", DecisionServiceFormat: "grpc", DecisionServiceTimeoutMs: 100}},
+		{name: "unknown fallback", cfg: Config{DecisionServiceURL: "http://opa:8181/v1/data/geo", DecisionServiceFallback: "maybe", DecisionServiceTimeoutMs: 100}},
+		{name: "missing timeout", cfg: Config{DecisionServiceURL: "http://opa:8181/v1/data/geo"}},
+		{name: "negative cache", cfg: Config{DecisionServiceURL: "http://opa:8181/v1/data/geo", DecisionServiceTimeoutMs: 100, DecisionServiceCacheSeconds: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDecisionService(&tt.cfg); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
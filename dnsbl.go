@@ -0,0 +1,201 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseDNSBL is used when the IP is listed in one of the DNSBLZones
+const PhaseDNSBL = "dnsbl"
+
+// DNSBL actions for listed IPs
+const (
+	DNSBLActionBlock = "block" // Block with phase "dnsbl"
+	DNSBLActionScore = "score" // Add ScoreDNSBLWeight in scoring mode
+	DNSBLActionLog   = "log"   // Only log the listing
+)
+
+const (
+	// maxDNSBLCacheEntries bounds the listing cache, it is flushed when full
+	maxDNSBLCacheEntries = 50000
+	// dnsblQueryTimeout bounds the background queries that outlive the latency budget
+	dnsblQueryTimeout = 2 * time.Second
+)
+
+// dnsblResult is the cached outcome for an IP, listed in zone when zone is not empty
+type dnsblResult struct {
+	zone    string
+	expires time.Time
+}
+
+// dnsblChecker queries DNS blocklists. Queries run in the background: a request waits at most the
+// latency budget, and a slower answer is still cached for the next requests from that IP.
+type dnsblChecker struct {
+	zones      []string
+	action     string
+	budget     time.Duration
+	cacheTTL   time.Duration
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu         *sync.Mutex
+	cache      map[string]dnsblResult
+	maxEntries int // Cache capacity, maxDNSBLCacheEntries unless shrunk by MemoryBudgetMB
+	inflight   map[string]*dnsblQuery
+}
+
+// dnsblQuery is a running query, shared by the requests of the same IP
+type dnsblQuery struct {
+	done chan struct{} // Closed once zone is set
+	zone string        // Zone listing the IP, empty when not listed
+}
+
+// newDNSBLChecker validates the DNSBL settings. Returns nil when no zones are configured.
+func newDNSBLChecker(cfg *Config) (*dnsblChecker, error) {
+	if len(cfg.DNSBLZones) == 0 {
+		return nil, nil
+	}
+
+	action := strings.ToLower(cfg.DNSBLAction)
+	switch action {
+	case "":
+		action = DNSBLActionBlock
+	case DNSBLActionBlock, DNSBLActionLog:
+	case DNSBLActionScore:
+		if cfg.ScoreThreshold == 0 || cfg.ScoreDNSBLWeight == 0 {
+			return nil, fmt.Errorf("DNSBLAction %q needs ScoreThreshold and ScoreDNSBLWeight", DNSBLActionScore)
+		}
+	default:
+		return nil, fmt.Errorf("invalid DNSBLAction %q: must be %q, %q or %q", cfg.DNSBLAction, DNSBLActionBlock, DNSBLActionScore, DNSBLActionLog)
+	}
+
+	if cfg.DNSBLTimeoutMs <= 0 {
+		return nil, fmt.Errorf("DNSBLTimeoutMs must be positive, got %d", cfg.DNSBLTimeoutMs)
+	}
+	if cfg.DNSBLCacheSeconds < 0 {
+		return nil, fmt.Errorf("DNSBLCacheSeconds can't be negative, got %d", cfg.DNSBLCacheSeconds)
+	}
+
+	zones := make([]string, 0, len(cfg.DNSBLZones))
+	for _, zone := range cfg.DNSBLZones {
+		zone = strings.Trim(strings.TrimSpace(zone), ".")
+		if zone == "" {
+			return nil, fmt.Errorf("DNSBLZones contains an empty zone")
+		}
+		zones = append(zones, zone)
+	}
+
+	return &dnsblChecker{
+		zones:      zones,
+		action:     action,
+		budget:     time.Duration(cfg.DNSBLTimeoutMs) * time.Millisecond,
+		cacheTTL:   time.Duration(cfg.DNSBLCacheSeconds) * time.Second,
+		lookupHost: net.DefaultResolver.LookupHost,
+		mu:         &sync.Mutex{},
+		cache:      make(map[string]dnsblResult),
+		maxEntries: maxDNSBLCacheEntries,
+		inflight:   make(map[string]*dnsblQuery),
+	}, nil
+}
+
+// check returns the zone listing the IP. An IP whose answer does not arrive within the budget counts as not listed.
+func (c *dnsblChecker) check(ip net.IP, logger *slog.Logger) (string, bool) {
+	key := ip.String()
+
+	c.mu.Lock()
+	if result, ok := c.cache[key]; ok && time.Now().Before(result.expires) {
+		c.mu.Unlock()
+		return result.zone, result.zone != ""
+	}
+	query, running := c.inflight[key]
+	if !running {
+		query = &dnsblQuery{done: make(chan struct{})}
+		c.inflight[key] = query
+		go c.query(ip, key, query, logger)
+	}
+	c.mu.Unlock()
+
+	timer := time.NewTimer(c.budget)
+	defer timer.Stop()
+	select {
+	case <-query.done:
+		return query.zone, query.zone != ""
+	case <-timer.C:
+		logger.Debug("DNSBL answer exceeded the latency budget", "ip", key, "budget_ms", c.budget.Milliseconds())
+		return "", false
+	}
+}
+
+// query asks every zone in parallel and records the first listing
+func (c *dnsblChecker) query(ip net.IP, key string, query *dnsblQuery, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsblQueryTimeout)
+	defer cancel()
+
+	name := dnsblName(ip)
+	listings := make([]bool, len(c.zones))
+	var wg sync.WaitGroup
+	for i, zone := range c.zones {
+		wg.Add(1)
+		go func(i int, zone string) {
+			defer wg.Done()
+			addrs, err := c.lookupHost(ctx, name+"."+zone)
+			if err != nil {
+				// NXDOMAIN is the normal "not listed" answer
+				if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+					logger.Debug("DNSBL query failed", "ip", key, "zone", zone, "error", err)
+				}
+				return
+			}
+			listings[i] = dnsblListed(addrs)
+		}(i, zone)
+	}
+	wg.Wait()
+
+	for i, listed := range listings {
+		if listed {
+			query.zone = c.zones[i]
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if c.cacheTTL > 0 {
+		if len(c.cache) >= c.maxEntries {
+			c.cache = make(map[string]dnsblResult)
+		}
+		c.cache[key] = dnsblResult{zone: query.zone, expires: time.Now().Add(c.cacheTTL)}
+	}
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(query.done)
+}
+
+// dnsblListed reports whether a DNSBL answer is a listing. Answers in 127.255.255.0/24 are errors
+// (e.g. Spamhaus refusing queries from public resolvers) and must not block anybody.
+func dnsblListed(addrs []string) bool {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr).To4()
+		if ip != nil && ip[0] == 127 && !(ip[1] == 255 && ip[2] == 255) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsblName returns the reversed query label: octets for IPv4, nibbles for IPv6
+func dnsblName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	ip16 := ip.To16()
+	const hexDigits = "0123456789abcdef"
+	nibbles := make([]string, 0, 32)
+	for i := len(ip16) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, string(hexDigits[ip16[i]&0x0f]), string(hexDigits[ip16[i]>>4]))
+	}
+	return strings.Join(nibbles, ".")
+}
@@ -0,0 +1,143 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeDNSBL answers listed names with 127.0.0.2 after delay, everything else with NXDOMAIN
+func fakeDNSBL(delay time.Duration, listed ...string) func(ctx context.Context, host string) ([]string, error) {
+	names := make(map[string]bool, len(listed))
+	for _, name := range listed {
+		names[name] = true
+	}
+	return func(ctx context.Context, host string) ([]string, error) {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if names[host] {
+			return []string{"127.0.0.2"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+}
+
+func TestDNSBLName(t *testing.T) {
+	tests := map[string]string{
+		"8.8.4.4":     "4.4.8.8",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2",
+	}
+	for ip, want := range tests {
+		if got := dnsblName(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: expected %s, got %s", ip, want, got)
+		}
+	}
+}
+
+func TestDNSBLListed(t *testing.T) {
+	if !dnsblListed([]string{"127.0.0.2"}) {
+		t.Error("expected 127.0.0.2 to be a listing")
+	}
+	if dnsblListed([]string{"127.255.255.254"}) {
+		t.Error("expected the Spamhaus public resolver error not to be a listing")
+	}
+	if dnsblListed([]string{"10.0.0.1"}) {
+		t.Error("expected answers outside 127/8 not to be a listing")
+	}
+}
+
+func TestDNSBL_Block(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.DNSBLZones = []string{"zen.example.org."}
+	cfg.AllowedIPBlocks = []string{"8.8.8.8/32"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	plugin.dnsbl.lookupHost = fakeDNSBL(0, "4.4.8.8.zen.example.org", "8.8.8.8.zen.example.org")
+
+	tests := []struct {
+		ip          string
+		wantAllowed bool
+		wantPhase   string
+	}{
+		{"8.8.4.4", false, PhaseDNSBL},
+		{"1.1.1.1", true, PhaseDefaultAllow},
+		{"8.8.8.8", true, PhaseAllowedIPBlock}, // Listed, but allowed IP blocks skip DNSBL
+	}
+	for _, tt := range tests {
+		allowed, country, phase, err := plugin.CheckAllowed(tt.ip)
+		if err != nil || allowed != tt.wantAllowed || phase != tt.wantPhase {
+			t.Errorf("%s: expected %v/%s, got %v/%s/%s (err: %v)", tt.ip, tt.wantAllowed, tt.wantPhase, allowed, phase, country, err)
+		}
+	}
+}
+
+func TestDNSBL_LatencyBudget(t *testing.T) {
+	checker, err := newDNSBLChecker(&Config{DNSBLZones: []string{"zen.example.org"}, DNSBLTimeoutMs: 10, DNSBLCacheSeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.lookupHost = fakeDNSBL(100*time.Millisecond, "4.4.8.8.zen.example.org")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	start := time.Now()
+	if _, listed := checker.check(net.ParseIP("8.8.4.4"), logger); listed {
+		t.Error("expected a slow answer to count as not listed")
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Errorf("expected the check to return within the budget, took %s", elapsed)
+	}
+
+	// The query keeps running and its answer is cached for the next request
+	waitFor(t, "cached DNSBL listing", func() bool {
+		zone, listed := checker.check(net.ParseIP("8.8.4.4"), logger)
+		return listed && zone == "zen.example.org"
+	})
+}
+
+func TestDNSBL_Score(t *testing.T) {
+	if _, err := newDNSBLChecker(&Config{DNSBLZones: []string{"zen.example.org"}, DNSBLAction: DNSBLActionScore, DNSBLTimeoutMs: 10}); err == nil {
+		t.Error("expected the score action to require scoring")
+	}
+
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DNSBLZones = []string{"zen.example.org"}
+	cfg.DNSBLAction = DNSBLActionScore
+	cfg.ScoreThreshold = 100
+	cfg.ScoreCountryWeights = map[string]int{"US": 60}
+	cfg.ScoreDNSBLWeight = 50
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	plugin.dnsbl.lookupHost = fakeDNSBL(0, "4.4.8.8.zen.example.org")
+
+	if allowed, _, _, _ := plugin.CheckAllowed("8.8.8.8"); !allowed {
+		t.Error("expected an unlisted US IP to stay below the threshold")
+	}
+	if allowed, _, phase, _ := plugin.CheckAllowed("8.8.4.4"); allowed || phase != PhaseScore {
+		t.Errorf("expected a listed US IP to reach the threshold, got %v/%s", allowed, phase)
+	}
+}
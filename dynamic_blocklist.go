@@ -0,0 +1,318 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseDynamicBlocklist is used when the IP matched a runtime ban
+const PhaseDynamicBlocklist = "dynamic_blocklist"
+
+// DynamicBan is a runtime ban, as stored in the dynamic blocklist file
+type DynamicBan struct {
+	CIDR    string    `json:"cidr"`
+	Expires time.Time `json:"expires,omitempty"` // Zero for permanent bans
+}
+
+// dynamicBlocklist holds runtime bans and persists them as "cidr,expiry" lines.
+// Single addresses are kept in a map, wider networks are matched linearly.
+type dynamicBlocklist struct {
+	file   string // Empty keeps the bans in memory only
+	logger *slog.Logger
+
+	mu       sync.RWMutex
+	bans     map[string]DynamicBan // By normalized CIDR
+	addrs    map[string]string     // Single address -> CIDR key in bans
+	networks map[string]*net.IPNet // CIDR key -> network, for bans wider than one address
+}
+
+var (
+	// dynamicBlocklists shares one blocklist per file between plugin instances, so Traefik
+	// configuration reloads and several middlewares don't overwrite each other's bans
+	dynamicBlocklists      = make(map[string]*dynamicBlocklist)
+	dynamicBlocklistsMutex sync.Mutex
+)
+
+// getDynamicBlocklist returns the blocklist for the file, loading it on first use.
+// Without a file every plugin instance gets its own in-memory blocklist.
+func getDynamicBlocklist(file string, logger *slog.Logger) (*dynamicBlocklist, error) {
+	if file == "" {
+		return newDynamicBlocklist("", logger), nil
+	}
+
+	dynamicBlocklistsMutex.Lock()
+	defer dynamicBlocklistsMutex.Unlock()
+
+	if existing, ok := dynamicBlocklists[file]; ok {
+		return existing, nil
+	}
+
+	blocklist := newDynamicBlocklist(file, logger)
+	if err := blocklist.load(); err != nil {
+		return nil, err
+	}
+	dynamicBlocklists[file] = blocklist
+	return blocklist, nil
+}
+
+func newDynamicBlocklist(file string, logger *slog.Logger) *dynamicBlocklist {
+	return &dynamicBlocklist{
+		file:     file,
+		logger:   logger,
+		bans:     make(map[string]DynamicBan),
+		addrs:    make(map[string]string),
+		networks: make(map[string]*net.IPNet),
+	}
+}
+
+// parseBanCIDR normalizes a CIDR or single address to its network
+func parseBanCIDR(value string) (*net.IPNet, error) {
+	networks, err := parseIPNetworks("ban", []string{value})
+	if err != nil {
+		return nil, err
+	}
+	return networks[0], nil
+}
+
+// load reads the blocklist file. A missing file is an empty blocklist, expired and invalid lines are dropped.
+func (b *dynamicBlocklist) load() error {
+	file, err := os.Open(b.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open dynamic blocklist %s: %w", b.file, err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cidr, expiryValue, _ := strings.Cut(line, ",")
+		network, err := parseBanCIDR(cidr)
+		if err != nil {
+			b.logger.Warn("invalid entry in dynamic blocklist", "file", b.file, "line", lineNum, "error", err)
+			continue
+		}
+		expires, err := parseBanExpiry(expiryValue)
+		if err != nil {
+			b.logger.Warn("invalid expiry in dynamic blocklist", "file", b.file, "line", lineNum, "error", err)
+			continue
+		}
+		if !expires.IsZero() && !expires.After(now) {
+			continue
+		}
+		b.setLocked(network, expires)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read dynamic blocklist %s: %w", b.file, err)
+	}
+
+	b.logger.Debug("loaded dynamic blocklist", "file", b.file, "bans", len(b.bans))
+	return nil
+}
+
+// parseBanExpiry accepts RFC 3339 timestamps or unix seconds. Empty, "0" and "never" mean permanent.
+func parseBanExpiry(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "", "0", "never":
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// setLocked adds or replaces a ban. Callers must hold the write lock.
+func (b *dynamicBlocklist) setLocked(network *net.IPNet, expires time.Time) {
+	key := network.String()
+	b.bans[key] = DynamicBan{CIDR: key, Expires: expires}
+
+	if ones, bits := network.Mask.Size(); ones == bits {
+		b.addrs[network.IP.String()] = key
+	} else {
+		b.networks[key] = network
+	}
+}
+
+// deleteLocked removes a ban. Callers must hold the write lock.
+func (b *dynamicBlocklist) deleteLocked(key string) {
+	delete(b.bans, key)
+	delete(b.networks, key)
+	if ip, _, err := net.ParseCIDR(key); err == nil {
+		delete(b.addrs, ip.String())
+	}
+}
+
+// add bans a CIDR or single address. A ttl of 0 bans permanently.
+func (b *dynamicBlocklist) add(cidr string, ttl time.Duration) (DynamicBan, error) {
+	network, err := parseBanCIDR(cidr)
+	if err != nil {
+		return DynamicBan{}, err
+	}
+	if ttl < 0 {
+		return DynamicBan{}, fmt.Errorf("ban duration can't be negative")
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).Truncate(time.Second)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLocked(network, expires)
+	b.purgeLocked()
+	return b.bans[network.String()], b.persistLocked()
+}
+
+// remove lifts a ban. Returns false when the CIDR was not banned.
+func (b *dynamicBlocklist) remove(cidr string) (bool, error) {
+	network, err := parseBanCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.bans[network.String()]; !ok {
+		return false, nil
+	}
+	b.deleteLocked(network.String())
+	b.purgeLocked()
+	return true, b.persistLocked()
+}
+
+// contains reports whether the IP is banned by an active ban
+func (b *dynamicBlocklist) contains(ip net.IP) (bool, string) {
+	now := time.Now()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.bans) == 0 {
+		return false, ""
+	}
+	if key, ok := b.addrs[ip.String()]; ok && b.active(key, now) {
+		return true, key
+	}
+	for key, network := range b.networks {
+		if network.Contains(ip) && b.active(key, now) {
+			return true, key
+		}
+	}
+	return false, ""
+}
+
+// active reports whether the ban has not expired. Callers must hold a lock.
+func (b *dynamicBlocklist) active(key string, now time.Time) bool {
+	ban := b.bans[key]
+	return ban.Expires.IsZero() || ban.Expires.After(now)
+}
+
+// list returns the active bans sorted by CIDR
+func (b *dynamicBlocklist) list() []DynamicBan {
+	now := time.Now()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	bans := make([]DynamicBan, 0, len(b.bans))
+	for key, ban := range b.bans {
+		if b.active(key, now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CIDR < bans[j].CIDR })
+	return bans
+}
+
+// purgeLocked drops expired bans. Callers must hold the write lock.
+func (b *dynamicBlocklist) purgeLocked() {
+	now := time.Now()
+	for key := range b.bans {
+		if !b.active(key, now) {
+			b.deleteLocked(key)
+		}
+	}
+}
+
+// persistLocked writes the active bans to the file. Callers must hold the write lock.
+func (b *dynamicBlocklist) persistLocked() error {
+	if b.file == "" {
+		return nil
+	}
+
+	keys := make([]string, 0, len(b.bans))
+	for key := range b.bans {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var content strings.Builder
+	content.WriteString("# cidr,expiry (RFC 3339, empty for permanent bans)\n")
+	for _, key := range keys {
+		content.WriteString(key)
+		content.WriteString(",")
+		if expires := b.bans[key].Expires; !expires.IsZero() {
+			content.WriteString(expires.UTC().Format(time.RFC3339))
+		}
+		content.WriteString("\n")
+	}
+
+	if err := writeFileAtomic(b.file, []byte(content.String())); err != nil {
+		return fmt.Errorf("failed to persist dynamic blocklist %s: %w", b.file, err)
+	}
+	return nil
+}
+
+// BanIP adds a runtime ban for a CIDR or single address. A ttl of 0 bans permanently.
+// With DynamicBlocklistFile the ban is persisted and survives restarts.
+func (p Plugin) BanIP(cidr string, ttl time.Duration) error {
+	if p.dynamicBlocklist == nil {
+		return fmt.Errorf("plugin is disabled")
+	}
+	ban, err := p.dynamicBlocklist.add(cidr, ttl)
+	if err == nil {
+		p.logger.Info("dynamic ban added", "cidr", ban.CIDR, "expires", ban.Expires)
+	}
+	return err
+}
+
+// UnbanIP removes a runtime ban. Returns false when the CIDR was not banned.
+func (p Plugin) UnbanIP(cidr string) (bool, error) {
+	if p.dynamicBlocklist == nil {
+		return false, fmt.Errorf("plugin is disabled")
+	}
+	removed, err := p.dynamicBlocklist.remove(cidr)
+	if removed {
+		p.logger.Info("dynamic ban removed", "cidr", cidr)
+	}
+	return removed, err
+}
+
+// DynamicBans returns the active runtime bans
+func (p Plugin) DynamicBans() []DynamicBan {
+	if p.dynamicBlocklist == nil {
+		return nil
+	}
+	return p.dynamicBlocklist.list()
+}
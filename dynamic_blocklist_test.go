@@ -0,0 +1,212 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDynamicBlocklistTestPlugin(t *testing.T, file string) *Plugin {
+	t.Helper()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.IPHeaders = []string{"x-real-ip"}
+	cfg.DynamicBlocklistFile = file
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return handler.(*Plugin)
+}
+
+func TestDynamicBlocklist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bans.txt")
+	plugin := newDynamicBlocklistTestPlugin(t, file)
+
+	if err := plugin.BanIP("1.1.1.0/28", 0); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if err := plugin.BanIP("1.1.1.100", time.Hour); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if err := plugin.BanIP("not-an-ip", 0); err == nil {
+		t.Error("expected error for an invalid CIDR")
+	}
+
+	for ip, wantAllowed := range map[string]bool{"1.1.1.5": false, "1.1.1.100": false, "1.1.1.200": true} {
+		allowed, country, phase, err := plugin.CheckAllowed(ip)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", ip, err)
+		}
+		if allowed != wantAllowed {
+			t.Errorf("expected allowed=%v for %s, got %v (phase %s)", wantAllowed, ip, allowed, phase)
+		}
+		if !wantAllowed && (phase != PhaseDynamicBlocklist || country != "AU") {
+			t.Errorf("expected phase %s and country AU for %s, got %s and %s", PhaseDynamicBlocklist, ip, phase, country)
+		}
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read blocklist file: %v", err)
+	}
+	if !strings.Contains(string(content), "1.1.1.0/28,\n") || !strings.Contains(string(content), "1.1.1.100/32,20") {
+		t.Errorf("unexpected blocklist file content:\n%s", content)
+	}
+
+	removed, err := plugin.UnbanIP("1.1.1.100")
+	if err != nil || !removed {
+		t.Fatalf("expected ban to be removed, got %v, %v", removed, err)
+	}
+	if allowed, _, _, _ := plugin.CheckAllowed("1.1.1.100"); !allowed {
+		t.Error("expected 1.1.1.100 to be allowed after unban")
+	}
+	if removed, _ := plugin.UnbanIP("1.1.1.100"); removed {
+		t.Error("expected second unban to report nothing removed")
+	}
+}
+
+func TestDynamicBlocklistLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bans.txt")
+	content := "# comment\n" +
+		"1.1.1.1,\n" +
+		"1.1.1.2,never\n" +
+		"1.1.1.3," + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + "\n" +
+		"1.1.1.4," + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + "\n" +
+		"garbage\n" +
+		"2001:4860::/32,0\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write blocklist file: %v", err)
+	}
+
+	blocklist := newDynamicBlocklist(file, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := blocklist.load(); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	for ip, want := range map[string]bool{
+		"1.1.1.1":         true,
+		"1.1.1.2":         true,
+		"1.1.1.3":         true,
+		"1.1.1.4":         false, // Expired
+		"1.1.1.5":         false,
+		"2001:4860::8888": true,
+	} {
+		if banned, _ := blocklist.contains(net.ParseIP(ip)); banned != want {
+			t.Errorf("expected banned=%v for %s, got %v", want, ip, banned)
+		}
+	}
+	if got := len(blocklist.list()); got != 4 {
+		t.Errorf("expected 4 active bans, got %d", got)
+	}
+}
+
+func TestDynamicBlocklistExpiry(t *testing.T) {
+	blocklist := newDynamicBlocklist("", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if _, err := blocklist.add("8.8.8.8", time.Hour); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+
+	// Expire the ban without waiting
+	blocklist.mu.Lock()
+	ban := blocklist.bans["8.8.8.8/32"]
+	ban.Expires = time.Now().Add(-time.Second)
+	blocklist.bans["8.8.8.8/32"] = ban
+	blocklist.mu.Unlock()
+
+	if banned, _ := blocklist.contains(net.ParseIP("8.8.8.8")); banned {
+		t.Error("expected expired ban to be ignored")
+	}
+	if len(blocklist.list()) != 0 {
+		t.Error("expected expired ban to be hidden from the list")
+	}
+}
+
+func TestDynamicBlocklistSurvivesRestart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bans.txt")
+	plugin := newDynamicBlocklistTestPlugin(t, file)
+	if err := plugin.BanIP("1.1.1.1", time.Hour); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+
+	// Instances of a reloaded configuration share the blocklist
+	if allowed, _, _, _ := newDynamicBlocklistTestPlugin(t, file).CheckAllowed("1.1.1.1"); allowed {
+		t.Error("expected ban to be shared with a new instance")
+	}
+
+	// A fresh process reads the bans back from the file
+	dynamicBlocklistsMutex.Lock()
+	delete(dynamicBlocklists, file)
+	dynamicBlocklistsMutex.Unlock()
+
+	if allowed, _, _, _ := newDynamicBlocklistTestPlugin(t, file).CheckAllowed("1.1.1.1"); allowed {
+		t.Error("expected ban to be reloaded from the file")
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.IPHeaders = []string{"x-real-ip"}
+	cfg.AdminPath = "/.geoblock"
+	cfg.AdminToken = "s3cret"
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request(http.MethodPost, "/.geoblock/bans", `{"cidr": "1.1.1.1", "ttlSeconds": 600}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request(http.MethodPost, "/.geoblock/bans", `{"cidr": "nope"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid CIDR, got %d", rr.Code)
+	}
+
+	rr := request(http.MethodGet, "/.geoblock/bans", "")
+	var bans []DynamicBan
+	if err := json.Unmarshal(rr.Body.Bytes(), &bans); err != nil {
+		t.Fatalf("failed to decode bans: %v", err)
+	}
+	if len(bans) != 1 || bans[0].CIDR != "1.1.1.1/32" || bans[0].Expires.IsZero() {
+		t.Errorf("unexpected bans: %+v", bans)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	blocked := httptest.NewRecorder()
+	plugin.ServeHTTP(blocked, req)
+	if blocked.Code != http.StatusForbidden {
+		t.Errorf("expected banned IP to be blocked, got %d", blocked.Code)
+	}
+
+	if rr := request(http.MethodDelete, "/.geoblock/bans?cidr=1.1.1.1", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := request(http.MethodDelete, "/.geoblock/bans?cidr=1.1.1.1", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing ban, got %d", rr.Code)
+	}
+}
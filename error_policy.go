@@ -0,0 +1,183 @@
+package traefik_geoblock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Phases used when a request is decided by an error policy
+const (
+	PhaseParseError   = "parse_error"   // A client IP could not be parsed
+	PhaseLookupError  = "lookup_error"  // The database or IP block lookup failed
+	PhaseEmptyHeaders = "empty_headers" // No client IP was found in the configured IP headers
+)
+
+// Error policies
+const (
+	ErrorPolicyAllow     = "allow"
+	ErrorPolicyBlock     = "block"
+	ErrorPolicyLastKnown = "last-known" // Reuse the last successful decision for the IP (lookup errors only)
+
+	NoIPPolicyUseRemoteAddr = "use_remote_addr" // Evaluate the connection's remote address (requests without client IP only)
+)
+
+// maxLastKnownDecisions bounds the last-known decision cache, it is flushed when full
+const maxLastKnownDecisions = 10000
+
+// ipParseError is returned by checkIP when the client IP is not a valid address
+type ipParseError struct {
+	ip string
+}
+
+func (e *ipParseError) Error() string {
+	return fmt.Sprintf("unable to parse IP address from [%s]", e.ip)
+}
+
+// ErrorCounts reports how many times each error policy was applied
+type ErrorCounts struct {
+	ParseErrors   int64 `json:"parseErrors"`
+	LookupErrors  int64 `json:"lookupErrors"`
+	EmptyHeaders  int64 `json:"emptyHeaders"`
+	SkippedTokens int64 `json:"skippedTokens"` // IP header tokens that are not IP addresses, e.g. "unknown"
+}
+
+// lastKnownDecision is a cached successful decision
+type lastKnownDecision struct {
+	allowed bool
+	country string
+	phase   string
+}
+
+// errorPolicies holds the resolved error policies and their counters
+type errorPolicies struct {
+	onParseError   string
+	onLookupError  string
+	onEmptyHeaders string
+
+	parseErrors  *int64
+	lookupErrors *int64
+	emptyHeaders *int64
+	skipped      *int64
+
+	mu        *sync.Mutex                  // Guards lastKnown
+	lastKnown map[string]lastKnownDecision // Only used with the last-known lookup error policy
+}
+
+// newErrorPolicies validates the error policies. OnParseError and OnLookupError default to BanIfError,
+// NoIPPolicy (or its older name OnEmptyHeaders) defaults to allow, which is how requests without
+// client IPs were always handled.
+func newErrorPolicies(cfg *Config) (*errorPolicies, error) {
+	defaultPolicy := ErrorPolicyAllow
+	if cfg.BanIfError {
+		defaultPolicy = ErrorPolicyBlock
+	}
+
+	resolve := func(option, value, fallback string, allowed ...string) (string, error) {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			return fallback, nil
+		}
+		for _, a := range allowed {
+			if value == a {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("invalid %s %q: must be one of %s", option, value, strings.Join(allowed, ", "))
+	}
+
+	onParseError, err := resolve("OnParseError", cfg.OnParseError, defaultPolicy, ErrorPolicyAllow, ErrorPolicyBlock)
+	if err != nil {
+		return nil, err
+	}
+	onLookupError, err := resolve("OnLookupError", cfg.OnLookupError, defaultPolicy, ErrorPolicyAllow, ErrorPolicyBlock, ErrorPolicyLastKnown)
+	if err != nil {
+		return nil, err
+	}
+	noIPOption, noIPPolicy := "NoIPPolicy", cfg.NoIPPolicy
+	if noIPPolicy == "" {
+		noIPOption, noIPPolicy = "OnEmptyHeaders", cfg.OnEmptyHeaders
+	} else if cfg.OnEmptyHeaders != "" {
+		return nil, fmt.Errorf("NoIPPolicy and OnEmptyHeaders are the same setting, set only NoIPPolicy")
+	}
+	onEmptyHeaders, err := resolve(noIPOption, noIPPolicy, ErrorPolicyAllow, ErrorPolicyAllow, ErrorPolicyBlock, NoIPPolicyUseRemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &errorPolicies{
+		onParseError:   onParseError,
+		onLookupError:  onLookupError,
+		onEmptyHeaders: onEmptyHeaders,
+		parseErrors:    new(int64),
+		lookupErrors:   new(int64),
+		emptyHeaders:   new(int64),
+		skipped:        new(int64),
+		mu:             &sync.Mutex{},
+		lastKnown:      make(map[string]lastKnownDecision),
+	}, nil
+}
+
+// forError counts the error and returns the policy and phase that apply to it
+func (e *errorPolicies) forError(err error) (policy string, phase string) {
+	var parseErr *ipParseError
+	if errors.As(err, &parseErr) {
+		atomic.AddInt64(e.parseErrors, 1)
+		return e.onParseError, PhaseParseError
+	}
+	atomic.AddInt64(e.lookupErrors, 1)
+	return e.onLookupError, PhaseLookupError
+}
+
+// forEmptyHeaders counts a request without client IPs and returns its policy
+func (e *errorPolicies) forEmptyHeaders() string {
+	atomic.AddInt64(e.emptyHeaders, 1)
+	return e.onEmptyHeaders
+}
+
+// skipTokens counts IP header tokens that are not IP addresses
+func (e *errorPolicies) skipTokens(n int) {
+	atomic.AddInt64(e.skipped, int64(n))
+}
+
+// remember stores a successful decision for the last-known policy
+func (e *errorPolicies) remember(ip string, allowed bool, country, phase string) {
+	if e.onLookupError != ErrorPolicyLastKnown {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.lastKnown) >= maxLastKnownDecisions {
+		e.lastKnown = make(map[string]lastKnownDecision)
+	}
+	e.lastKnown[ip] = lastKnownDecision{allowed: allowed, country: country, phase: phase}
+}
+
+// recall returns the last successful decision for the IP
+func (e *errorPolicies) recall(ip string) (lastKnownDecision, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	decision, ok := e.lastKnown[ip]
+	return decision, ok
+}
+
+// counts returns a snapshot of the counters
+func (e *errorPolicies) counts() ErrorCounts {
+	return ErrorCounts{
+		ParseErrors:   atomic.LoadInt64(e.parseErrors),
+		LookupErrors:  atomic.LoadInt64(e.lookupErrors),
+		EmptyHeaders:  atomic.LoadInt64(e.emptyHeaders),
+		SkippedTokens: atomic.LoadInt64(e.skipped),
+	}
+}
+
+// ErrorCounts returns how many parse errors, lookup errors and requests without client IPs were seen
+func (p Plugin) ErrorCounts() ErrorCounts {
+	if p.errorPolicies == nil {
+		return ErrorCounts{}
+	}
+	return p.errorPolicies.counts()
+}
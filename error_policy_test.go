@@ -0,0 +1,215 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ip2location/ip2location-go/v9"
+)
+
+func newErrorPolicyTestPlugin(t *testing.T, cfg *Config) *Plugin {
+	t.Helper()
+
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DisallowedStatusCode = http.StatusForbidden
+	cfg.IPHeaders = []string{"x-real-ip"}
+	cfg.IPHeaderStrategy = IPHeaderStrategyCheckAll
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Action"
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	return handler.(*Plugin)
+}
+
+// breakDatabase points the plugin to a closed database so every lookup fails
+func breakDatabase(t *testing.T, p *Plugin) {
+	t.Helper()
+
+	db, err := ip2location.OpenDB(tinyDbFilePath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Close()
+	p.db = newDatabaseWrapper(db, tinyDbFilePath, nil)
+	p.lookuper = p.db
+}
+
+func serveWithClientIP(p *Plugin, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if ip != "" {
+		req.Header.Set("X-Real-IP", ip)
+	}
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestErrorPolicies(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		ip        string
+		broken    bool
+		status    int
+		phase     string
+		wantCount ErrorCounts
+	}{
+		{
+			name:      "parse error blocked by BanIfError",
+			cfg:       Config{BanIfError: true, DefaultAllow: true},
+			ip:        "not.an.ip",
+			status:    http.StatusForbidden,
+			phase:     PhaseParseError,
+			wantCount: ErrorCounts{ParseErrors: 1},
+		},
+		{
+			name:      "parse error allowed by OnParseError",
+			cfg:       Config{BanIfError: true, DefaultAllow: true, OnParseError: "allow"},
+			ip:        "not.an.ip",
+			status:    http.StatusTeapot,
+			wantCount: ErrorCounts{ParseErrors: 1},
+		},
+		{
+			name:      "lookup error blocked",
+			cfg:       Config{DefaultAllow: true, OnLookupError: "block"},
+			ip:        "1.1.1.1",
+			broken:    true,
+			status:    http.StatusForbidden,
+			phase:     PhaseLookupError,
+			wantCount: ErrorCounts{LookupErrors: 1},
+		},
+		{
+			name:      "lookup error allowed",
+			cfg:       Config{BanIfError: true, DefaultAllow: true, OnLookupError: "Allow"},
+			ip:        "1.1.1.1",
+			broken:    true,
+			status:    http.StatusTeapot,
+			wantCount: ErrorCounts{LookupErrors: 1},
+		},
+		{
+			name:      "empty headers allowed by default",
+			cfg:       Config{BanIfError: true, DefaultAllow: true},
+			status:    http.StatusTeapot,
+			wantCount: ErrorCounts{EmptyHeaders: 1},
+		},
+		{
+			name:      "empty headers blocked",
+			cfg:       Config{DefaultAllow: true, OnEmptyHeaders: "block"},
+			status:    http.StatusForbidden,
+			phase:     PhaseEmptyHeaders,
+			wantCount: ErrorCounts{EmptyHeaders: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			p := newErrorPolicyTestPlugin(t, &cfg)
+			if tt.broken {
+				breakDatabase(t, p)
+			}
+
+			rr := serveWithClientIP(p, tt.ip)
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("X-Geoblock-Action"); got != tt.phase {
+				t.Errorf("expected remediation header %q, got %q", tt.phase, got)
+			}
+			if got := p.ErrorCounts(); got != tt.wantCount {
+				t.Errorf("expected counters %+v, got %+v", tt.wantCount, got)
+			}
+		})
+	}
+}
+
+func TestErrorPolicyLastKnown(t *testing.T) {
+	p := newErrorPolicyTestPlugin(t, &Config{AllowedCountries: []string{"AU"}, OnLookupError: "last-known"})
+
+	// Learn the decisions while the database works
+	if rr := serveWithClientIP(p, "1.1.1.1"); rr.Code != http.StatusTeapot {
+		t.Fatalf("expected AU to be allowed, got %d", rr.Code)
+	}
+	if rr := serveWithClientIP(p, "8.8.8.8"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected US to be blocked, got %d", rr.Code)
+	}
+
+	breakDatabase(t, p)
+
+	if rr := serveWithClientIP(p, "1.1.1.1"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected last known allow, got %d", rr.Code)
+	}
+	rr := serveWithClientIP(p, "8.8.8.8")
+	if rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Action") != PhaseDefaultAllow {
+		t.Errorf("expected last known block with its phase, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Action"))
+	}
+	rr = serveWithClientIP(p, "1.1.1.2")
+	if rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Action") != PhaseLookupError {
+		t.Errorf("expected unknown IP to be blocked as lookup error, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Action"))
+	}
+
+	if got := p.ErrorCounts().LookupErrors; got != 3 {
+		t.Errorf("expected 3 lookup errors, got %d", got)
+	}
+}
+
+func TestErrorPoliciesValidation(t *testing.T) {
+	for _, cfg := range []Config{
+		{OnParseError: "last-known"},
+		{OnLookupError: "ignore"},
+		{OnEmptyHeaders: "maybe"},
+		{NoIPPolicy: "remote_addr"},
+		{NoIPPolicy: "block", OnEmptyHeaders: "block"},
+	} {
+		if _, err := newErrorPolicies(&cfg); err == nil {
+			t.Errorf("expected validation error for %+v", cfg)
+		}
+	}
+}
+
+func TestNoIPPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		headerIP   string
+		remoteAddr string
+		status     int
+		phase      string
+	}{
+		{"allow", "allow", "", "8.8.8.8:5000", http.StatusTeapot, ""},
+		{"block", "block", "", "1.1.1.1:5000", http.StatusForbidden, PhaseEmptyHeaders},
+		{"remote address allowed", "use_remote_addr", "", "1.1.1.1:5000", http.StatusTeapot, ""},
+		{"remote address blocked", "use_remote_addr", "", "8.8.8.8:5000", http.StatusForbidden, PhaseDefaultAllow},
+		{"remote address missing", "use_remote_addr", "", "", http.StatusForbidden, PhaseEmptyHeaders},
+		{"headers win", "use_remote_addr", "8.8.8.8", "1.1.1.1:5000", http.StatusForbidden, PhaseDefaultAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newErrorPolicyTestPlugin(t, &Config{AllowedCountries: []string{"AU"}, NoIPPolicy: tt.policy})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.headerIP != "" {
+				req.Header.Set("X-Real-IP", tt.headerIP)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+			if rr.Code != tt.status || rr.Header().Get("X-Geoblock-Action") != tt.phase {
+				t.Errorf("expected %d %q, got %d %q", tt.status, tt.phase, rr.Code, rr.Header().Get("X-Geoblock-Action"))
+			}
+			wantCount := int64(1)
+			if tt.headerIP != "" {
+				wantCount = 0
+			}
+			if got := p.ErrorCounts().EmptyHeaders; got != wantCount {
+				t.Errorf("expected %d requests without client IP, got %d", wantCount, got)
+			}
+		})
+	}
+}
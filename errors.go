@@ -0,0 +1,51 @@
+package traefik_geoblock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by New and the embedding API, to be matched with errors.Is instead of their messages
+var (
+	// ErrInvalidConfig is matched by every error caused by the configuration: invalid values, and files
+	// or URLs it points to that can't be used
+	ErrInvalidConfig = errors.New("invalid configuration")
+	// ErrDatabaseNotFound is matched when no IP2Location database exists at DatabaseFilePath
+	ErrDatabaseNotFound = errors.New("database file not found")
+)
+
+// ErrInvalidCIDR is returned for an IP block that can't be parsed, match it with errors.As
+type ErrInvalidCIDR struct {
+	Value string // The entry as configured
+	Err   error  // The parse error of the net package
+}
+
+func (e *ErrInvalidCIDR) Error() string {
+	return fmt.Sprintf("invalid CIDR %q", e.Value)
+}
+
+func (e *ErrInvalidCIDR) Unwrap() error {
+	return e.Err
+}
+
+// invalidConfigError keeps the message of a configuration error and makes it match ErrInvalidConfig
+type invalidConfigError struct {
+	err error
+}
+
+func (e *invalidConfigError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidConfigError) Unwrap() error {
+	return e.err
+}
+
+func (e *invalidConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+// invalidConfig prefixes a configuration error with the plugin name, like the other errors of newPlugin
+func invalidConfig(name string, err error) error {
+	return &invalidConfigError{err: fmt.Errorf("%s: %w", name, err)}
+}
@@ -0,0 +1,53 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestErrorTypes(t *testing.T) {
+	newConfig := func() *Config {
+		cfg := CreateConfig()
+		cfg.Enabled = true
+		cfg.DatabaseFilePath = tinyDbFilePath
+		return cfg
+	}
+
+	cfg := newConfig()
+	cfg.IPHeaderStrategy = "akamai"
+	_, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if !errors.Is(err, ErrInvalidConfig) || errors.Is(err, ErrDatabaseNotFound) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
+	if err != nil && err.Error() != pluginName+": invalid IPHeaderStrategy 'akamai', must be one of: CheckAll, CheckFirst, CheckFirstNonePrivate, or a preset: cloudfront, azure, gclb" {
+		t.Errorf("expected the message to be unchanged, got %q", err)
+	}
+
+	for name, blocks := range map[string][]string{"AllowedIPBlocks": {"10.0.0.0/33"}, "TrustedProxies": {"10.0.0.0/33"}} {
+		cfg := newConfig()
+		if name == "AllowedIPBlocks" {
+			cfg.AllowedIPBlocks = blocks
+		} else {
+			cfg.TrustedProxies = blocks
+		}
+		_, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		var cidrErr *ErrInvalidCIDR
+		if !errors.Is(err, ErrInvalidConfig) || !errors.As(err, &cidrErr) || cidrErr.Value != "10.0.0.0/33" {
+			t.Errorf("%s: expected ErrInvalidConfig and ErrInvalidCIDR, got %v", name, err)
+		}
+	}
+
+	cfg = newConfig()
+	cfg.DatabaseFilePath = t.TempDir() + "/missing.BIN"
+	t.Setenv("TRAEFIK_PLUGIN_GEOBLOCK_PATH", "")
+	_, err = New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if !errors.Is(err, ErrDatabaseNotFound) || errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrDatabaseNotFound, got %v", err)
+	}
+
+	var cidrErr *ErrInvalidCIDR
+	if err := NewEmptyIpLookupHelper().AddCIDR("not-a-cidr"); !errors.As(err, &cidrErr) || cidrErr.Value != "not-a-cidr" {
+		t.Errorf("expected ErrInvalidCIDR, got %v", err)
+	}
+}
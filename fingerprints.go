@@ -0,0 +1,73 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PhaseBlockedFingerprint is used when the TLS fingerprint of the client is in BlockFingerprints
+const PhaseBlockedFingerprint = "blocked_fingerprint"
+
+// What a known TLS fingerprint does to the request
+const (
+	fingerprintNone = iota
+	fingerprintBypass
+	fingerprintBlock
+)
+
+// tlsFingerprints matches the TLS client fingerprint (JA3, JA4...) a proxy in front of the plugin
+// writes to a request header. Known-good internal clients skip geoblocking, known-bad bots are
+// blocked wherever they come from.
+type tlsFingerprints struct {
+	header string
+	bypass map[string]struct{} // Lowercase fingerprints
+	block  map[string]struct{}
+}
+
+// newTLSFingerprints validates the fingerprint settings. Returns nil when both lists are empty.
+func newTLSFingerprints(cfg *Config) (*tlsFingerprints, error) {
+	if len(cfg.BypassFingerprints) == 0 && len(cfg.BlockFingerprints) == 0 {
+		return nil, nil
+	}
+	if cfg.FingerprintHeader == "" {
+		return nil, fmt.Errorf("FingerprintHeader is required with BypassFingerprints or BlockFingerprints")
+	}
+
+	f := &tlsFingerprints{
+		header: cfg.FingerprintHeader,
+		bypass: make(map[string]struct{}, len(cfg.BypassFingerprints)),
+		block:  make(map[string]struct{}, len(cfg.BlockFingerprints)),
+	}
+	for _, fingerprint := range cfg.BypassFingerprints {
+		if normalized := strings.ToLower(strings.TrimSpace(fingerprint)); normalized != "" {
+			f.bypass[normalized] = struct{}{}
+		}
+	}
+	for _, fingerprint := range cfg.BlockFingerprints {
+		normalized := strings.ToLower(strings.TrimSpace(fingerprint))
+		if normalized == "" {
+			continue
+		}
+		if _, both := f.bypass[normalized]; both {
+			return nil, fmt.Errorf("fingerprint %q is in both BypassFingerprints and BlockFingerprints", fingerprint)
+		}
+		f.block[normalized] = struct{}{}
+	}
+	return f, nil
+}
+
+// match returns the fingerprint of the request and what to do with it
+func (f *tlsFingerprints) match(req *http.Request) (string, int) {
+	fingerprint := strings.ToLower(strings.TrimSpace(req.Header.Get(f.header)))
+	if fingerprint == "" {
+		return "", fingerprintNone
+	}
+	if _, ok := f.bypass[fingerprint]; ok {
+		return fingerprint, fingerprintBypass
+	}
+	if _, ok := f.block[fingerprint]; ok {
+		return fingerprint, fingerprintBlock
+	}
+	return fingerprint, fingerprintNone
+}
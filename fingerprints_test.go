@@ -0,0 +1,65 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSFingerprints(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Phase"
+	cfg.FingerprintHeader = "X-JA3-Hash"
+	cfg.BypassFingerprints = []string{"E7D705A3286E19EA42F587B344EE6865"}
+	cfg.BlockFingerprints = []string{"3b5074b1b5d032e5620f69f9f700ff0e"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		ip          string
+		fingerprint string
+		wantCode    int
+		wantPhase   string
+	}{
+		{name: "bypass from a blocked country", ip: "8.8.8.8", fingerprint: "e7d705a3286e19ea42f587b344ee6865", wantCode: http.StatusTeapot},
+		{name: "block from an allowed country", ip: "1.1.1.1", fingerprint: "3b5074b1b5d032e5620f69f9f700ff0e", wantCode: http.StatusForbidden, wantPhase: PhaseBlockedFingerprint},
+		{name: "unknown fingerprint", ip: "1.1.1.1", fingerprint: "00000000000000000000000000000000", wantCode: http.StatusTeapot},
+		{name: "no fingerprint", ip: "8.8.8.8", wantCode: http.StatusForbidden, wantPhase: PhaseDefaultAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			if tt.fingerprint != "" {
+				req.Header.Set("X-JA3-Hash", tt.fingerprint)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.wantCode {
+				t.Errorf("expected %d, got %d", tt.wantCode, rr.Code)
+			}
+			if got := rr.Header().Get("X-Geoblock-Phase"); got != tt.wantPhase {
+				t.Errorf("expected phase %q, got %q", tt.wantPhase, got)
+			}
+		})
+	}
+
+	cfg = CreateConfig()
+	cfg.BlockFingerprints = []string{"3b5074b1b5d032e5620f69f9f700ff0e"}
+	if _, err := newTLSFingerprints(cfg); err == nil {
+		t.Error("expected an error without FingerprintHeader")
+	}
+	cfg.FingerprintHeader = "X-JA3-Hash"
+	cfg.BypassFingerprints = []string{"3B5074B1B5D032E5620F69F9F700FF0E"}
+	if _, err := newTLSFingerprints(cfg); err == nil {
+		t.Error("expected an error for a fingerprint in both lists")
+	}
+}
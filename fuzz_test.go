@@ -0,0 +1,130 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func FuzzCleanIPAddress(f *testing.F) {
+	for _, seed := range []string{"1.2.3.4", " 1.2.3.4:8080 ", "[2001:db8::1]:443", "::ffff:1.2.3.4", "fe80::1%eth0", "[", "]:", "unknown", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		cleaned := cleanIPAddress(input)
+
+		// A bare address must come back untouched
+		if trimmed := strings.TrimSpace(input); net.ParseIP(trimmed) != nil && cleaned != trimmed {
+			t.Errorf("cleanIPAddress(%q) = %q, want %q", input, cleaned, trimmed)
+		}
+		if strings.TrimSpace(input) == "" && cleaned != "" {
+			t.Errorf("cleanIPAddress(%q) = %q, want empty", input, cleaned)
+		}
+	})
+}
+
+func FuzzGetRemoteIPs(f *testing.F) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.IPHeaders = []string{"x-forwarded-for", "x-real-ip", "remoteAddress"}
+	cfg.IPHeaderStrategy = IPHeaderStrategyCheckAll
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		f.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	f.Add("1.1.1.1, 8.8.8.8:53, [2001:db8::1]:80", "9.9.9.9", "10.0.0.1:1234")
+	f.Add(",,, ,", "", "")
+	f.Add("for=192.0.2.60;proto=http;by=203.0.113.43", "unknown", "[::1]:80")
+	f.Add("1.1.1.1,1.1.1.1, 1.1.1.1:80", "1.1.1.1", "1.1.1.1:443")
+	f.Fuzz(func(t *testing.T, forwardedFor, realIP, remoteAddr string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", realIP)
+		req.RemoteAddr = remoteAddr
+
+		seen := make(map[string]struct{})
+		for _, ip := range plugin.GetRemoteIPs(req) {
+			if ip == "" {
+				t.Fatalf("empty IP returned for %q / %q / %q", forwardedFor, realIP, remoteAddr)
+			}
+			if _, dup := seen[ip]; dup {
+				t.Fatalf("duplicate IP %q returned", ip)
+			}
+			seen[ip] = struct{}{}
+		}
+
+		// Whatever the headers contain, the request is answered without panicking
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
+
+func FuzzRadixTree(f *testing.F) {
+	f.Add([]byte{10, 0, 0, 0}, uint8(8), []byte{10, 1, 2, 3}, []byte{10, 1, 0, 0}, uint8(16))
+	f.Add([]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, uint8(32),
+		[]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, []byte{0x20, 0x01, 0x0d, 0xb9, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, uint8(128))
+	f.Add([]byte{1, 2, 3, 4}, uint8(0), []byte{255, 255, 255, 255}, []byte{1, 2, 3, 4}, uint8(32))
+	f.Fuzz(func(t *testing.T, first []byte, firstLen uint8, probe []byte, second []byte, secondLen uint8) {
+		// IPv4 and IPv6 blocks share the tree root, so every address must be of the probe's family
+		size := len(probe)
+		if size != net.IPv4len && size != net.IPv6len {
+			return
+		}
+		if len(first) != size || len(second) != size {
+			return
+		}
+		if size == net.IPv6len && (net.IP(probe).To4() != nil || net.IP(first).To4() != nil || net.IP(second).To4() != nil) {
+			return
+		}
+
+		var blocks []*net.IPNet
+		for _, b := range []struct {
+			addr []byte
+			len  uint8
+		}{{first, firstLen}, {second, secondLen}} {
+			mask := net.CIDRMask(int(b.len)%(size*8+1), size*8)
+			blocks = append(blocks, &net.IPNet{IP: net.IP(b.addr).Mask(mask), Mask: mask})
+		}
+
+		tree := newIPRadixTree()
+		wantFound, wantLen := false, 0
+		for _, block := range blocks {
+			tree.insert(block)
+			if block.Contains(net.IP(probe)) {
+				ones, _ := block.Mask.Size()
+				if !wantFound || ones > wantLen {
+					wantLen = ones
+				}
+				wantFound = true
+			}
+		}
+
+		found, prefixLen := tree.contains(net.IP(probe))
+		if found != wantFound || prefixLen != wantLen {
+			t.Errorf("contains(%s) with %v = %v/%d, want %v/%d", net.IP(probe), blocks, found, prefixLen, wantFound, wantLen)
+		}
+	})
+}
+
+func FuzzGetDateFromName(f *testing.F) {
+	for _, seed := range []string{"20240315_IP2LOCATION-LITE-DB1.BIN", `C:\db\20241231_x.BIN`, "+2024+1+1_x", "20241340_x", "2024-1-1_x", "../../_", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		date, err := GetDateFromName(name)
+		if err != nil {
+			return
+		}
+		// Only real calendar dates spelled with 8 digits are accepted
+		_, tail := filepath.Split(strings.ReplaceAll(name, "\\", "/"))
+		if want := strings.Split(tail, "_")[0]; date.Format("20060102") != want {
+			t.Errorf("GetDateFromName(%q) = %s, which does not match %q", name, date.Format("20060102"), want)
+		}
+	})
+}
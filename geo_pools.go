@@ -0,0 +1,88 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// geoPools maps the detected country of allowed requests to an upstream pool name, e.g. "eu", "us" or "apac",
+// written to a request header so load balancers or backends can send users to the nearest cluster
+type geoPools struct {
+	pools       map[string]string // Country code to pool, groups expanded
+	defaultPool string            // Pool for countries without an entry, empty to omit the header
+	header      string
+}
+
+// newGeoPools validates the pool settings. Returns nil when no pools are configured.
+func newGeoPools(cfg *Config) (*geoPools, error) {
+	if len(cfg.GeoPools) == 0 && cfg.GeoPoolDefault == "" {
+		return nil, nil
+	}
+	if strings.TrimSpace(cfg.GeoPoolHeader) == "" {
+		return nil, fmt.Errorf("GeoPoolHeader can't be empty when GeoPools are configured")
+	}
+
+	// Expand groups, explicit country entries win over group members
+	pools := make(map[string]string)
+	keys := make([]string, 0, len(cfg.GeoPools))
+	for key := range cfg.GeoPools {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pool := strings.TrimSpace(cfg.GeoPools[key])
+		if err := validateGeoPool(pool); err != nil {
+			return nil, fmt.Errorf("invalid GeoPools entry %q: %w", key, err)
+		}
+		if members, isGroup := countryGroups[strings.ToUpper(key)]; isGroup {
+			for _, m := range members {
+				if _, explicit := cfg.GeoPools[m]; !explicit {
+					pools[m] = pool
+				}
+			}
+			continue
+		}
+		pools[strings.ToUpper(key)] = pool
+	}
+
+	defaultPool := strings.TrimSpace(cfg.GeoPoolDefault)
+	if defaultPool != "" {
+		if err := validateGeoPool(defaultPool); err != nil {
+			return nil, fmt.Errorf("invalid GeoPoolDefault: %w", err)
+		}
+	}
+
+	return &geoPools{pools: pools, defaultPool: defaultPool, header: cfg.GeoPoolHeader}, nil
+}
+
+// validateGeoPool checks that a pool name can be sent as a header value
+func validateGeoPool(pool string) error {
+	if pool == "" {
+		return fmt.Errorf("empty pool name")
+	}
+	for _, c := range pool {
+		if c <= 0x20 || c > 0x7e {
+			return fmt.Errorf("pool %q must be printable ASCII without spaces", pool)
+		}
+	}
+	return nil
+}
+
+// pool returns the pool of a country, or the default pool
+func (g *geoPools) pool(country string) string {
+	if pool, ok := g.pools[country]; ok {
+		return pool
+	}
+	return g.defaultPool
+}
+
+// annotate sets the pool header of an allowed request. A client-sent value is always removed.
+func (g *geoPools) annotate(req *http.Request, country string) {
+	if pool := g.pool(country); pool != "" {
+		req.Header.Set(g.header, pool)
+	} else {
+		req.Header.Del(g.header)
+	}
+}
@@ -0,0 +1,70 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoPools(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultPool string
+		ip          string
+		want        string
+	}{
+		{"group", "", "2a00:1450::1", "eu"},
+		{"explicit country wins over its group", "", "85.214.132.1", "de"},
+		{"country", "", "8.8.8.8", "us"},
+		{"no entry", "", "1.1.1.1", ""},
+		{"default pool", "us", "1.1.1.1", "us"},
+		{"private clients get the default pool", "us", "10.0.0.1", "us"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.DefaultAllow = true
+			cfg.AllowPrivate = true
+			cfg.GeoPools = map[string]string{"EU": "eu", "DE": "de", "US": "us"}
+			cfg.GeoPoolDefault = tt.defaultPool
+
+			pool, forwarded := "", false
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				pool, forwarded = req.Header.Get("X-Geo-Pool"), true
+				rw.WriteHeader(http.StatusTeapot)
+			})
+			plugin, err := newPlugin(context.TODO(), next, cfg, pluginName, nil)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			defer plugin.Close()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			req.Header.Set("X-Geo-Pool", "spoofed")
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+			if !forwarded {
+				t.Fatal("expected the request to be allowed")
+			}
+			if pool != tt.want {
+				t.Errorf("expected pool %q, got %q", tt.want, pool)
+			}
+		})
+	}
+}
+
+func TestGeoPools_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{GeoPools: map[string]string{"US": "us"}},
+		{GeoPools: map[string]string{"US": "us east"}, GeoPoolHeader: "X-Geo-Pool"},
+		{GeoPools: map[string]string{"US": ""}, GeoPoolHeader: "X-Geo-Pool"},
+		{GeoPoolDefault: "eu\twest", GeoPoolHeader: "X-Geo-Pool"},
+	} {
+		if _, err := newGeoPools(&cfg); err == nil {
+			t.Errorf("expected an error for pools %v, default %q, header %q", cfg.GeoPools, cfg.GeoPoolDefault, cfg.GeoPoolHeader)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GRPCCodePermissionDenied is the numeric value of codes.PermissionDenied from google.golang.org/grpc/codes
+const GRPCCodePermissionDenied = 7
+
+// DeniedError is returned by CheckPeer when a call must be rejected.
+// Interceptors should map it to a PermissionDenied status, using Phase as reason, as the grpcmw module does.
+type DeniedError struct {
+	IP      string // Client IP that caused the block
+	Country string // Detected country, "Unknown" when the check failed
+	Phase   string // Phase where the decision was made
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("geoblock: access denied for %s (country %s, phase %s)", e.IP, e.Country, e.Phase)
+}
+
+// GRPCCode returns the gRPC status code to reply with
+func (e *DeniedError) GRPCCode() int {
+	return GRPCCodePermissionDenied
+}
+
+// CheckPeer applies the configured rules to a gRPC call, so gRPC services can share the policy of
+// the HTTP middleware without depending on it. The grpcmw module wraps it as server interceptors. peerAddr is the address of the connection (as returned
+// by peer.FromContext(ctx).Addr.String()) and md the incoming metadata (metadata.MD is a map[string][]string).
+//
+// The client IPs are extracted with the configured IPHeaders and IPHeaderStrategy; metadata keys are
+// matched case-insensitively and the synthetic "remoteAddress" header maps to peerAddr.
+// Returns nil if the call is allowed, or a *DeniedError.
+func (p Plugin) CheckPeer(peerAddr string, md map[string][]string) error {
+	if !p.enabled {
+		return nil
+	}
+	if p.configOverlay != nil {
+		p.configOverlay.apply(&p)
+	}
+
+	req := &http.Request{
+		Method:     http.MethodPost, // gRPC calls are always POST
+		URL:        &url.URL{Path: "/"},
+		RemoteAddr: peerAddr,
+		Header:     make(http.Header, len(md)),
+	}
+	for key, values := range md {
+		// Binary metadata can't hold IPs
+		if strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	remoteIPs := p.GetRemoteIPs(req)
+	ipChain := strings.Join(remoteIPs, ", ")
+	decision := p.evaluateIPs(req, remoteIPs, ipChain, false)
+	if p.decisionService != nil {
+		decision = p.decisionService.decide(req, decision, p.logger)
+	}
+	if !decision.blocked || !p.enforceBlock(decision, ipChain) {
+		return nil
+	}
+
+	if level, ok := p.logPhaseLevels.level(decision.phase, slog.LevelInfo, p.logBannedRequests); ok && decision.err == nil {
+		p.logger.Log(context.Background(), level, "blocked grpc call", append([]any{
+			"ip", decision.ip,
+			"ip_chain", ipChain,
+			"country", decision.country,
+			"phase", decision.phase,
+			"remote_addr", peerAddr}, decision.scoreLogArgs()...)...)
+	}
+
+	return &DeniedError{IP: decision.ip, Country: decision.country, Phase: decision.phase}
+}
@@ -0,0 +1,66 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestPlugin_CheckPeer(t *testing.T) {
+	cfg := &Config{
+		Enabled:              true,
+		DatabaseFilePath:     tinyDbFilePath,
+		AllowedCountries:     []string{"AU"},
+		AllowPrivate:         true,
+		DisallowedStatusCode: http.StatusForbidden,
+		IPHeaders:            []string{"x-forwarded-for", "remoteAddress"},
+		IPHeaderStrategy:     IPHeaderStrategyCheckFirst,
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		name        string
+		peerAddr    string
+		md          map[string][]string
+		wantDenied  bool
+		wantCountry string
+	}{
+		{"allowed peer", "1.1.1.1:50051", nil, false, ""},
+		{"blocked peer", "8.8.8.8:50051", nil, true, "US"},
+		{"allowed forwarded client", "10.0.0.1:50051", map[string][]string{"x-forwarded-for": {"1.1.1.1"}}, false, ""},
+		{"blocked forwarded client", "10.0.0.1:50051", map[string][]string{"x-forwarded-for": {"8.8.8.8, 10.0.0.2"}}, true, "US"},
+		{"binary metadata ignored", "1.1.1.1:50051", map[string][]string{"x-forwarded-for-bin": {"8.8.8.8"}}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := plugin.CheckPeer(tt.peerAddr, tt.md)
+			if !tt.wantDenied {
+				if err != nil {
+					t.Errorf("expected call to be allowed, got: %v", err)
+				}
+				return
+			}
+
+			var denied *DeniedError
+			if !errors.As(err, &denied) {
+				t.Fatalf("expected *DeniedError, got: %v", err)
+			}
+			if denied.Country != tt.wantCountry {
+				t.Errorf("expected country %s, got %s", tt.wantCountry, denied.Country)
+			}
+			if denied.Phase != PhaseDefaultAllow {
+				t.Errorf("expected phase %s, got %s", PhaseDefaultAllow, denied.Phase)
+			}
+			if denied.GRPCCode() != GRPCCodePermissionDenied {
+				t.Errorf("expected gRPC code %d, got %d", GRPCCodePermissionDenied, denied.GRPCCode())
+			}
+		})
+	}
+}
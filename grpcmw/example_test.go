@@ -0,0 +1,33 @@
+package grpcmw_test
+
+import (
+	"log"
+	"net"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"github.com/david-garcia-garcia/traefik-geoblock/grpcmw"
+	"google.golang.org/grpc"
+)
+
+func ExampleUnaryServerInterceptor() {
+	plugin, err := geoblock.NewFromOptions(
+		geoblock.WithDatabaseFilePath("/data/IP2LOCATION-LITE-DB1.IPV6.BIN"),
+		geoblock.WithAllowedCountries("DE", "FR"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer plugin.Close()
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcmw.UnaryServerInterceptor(plugin)),
+		grpc.StreamInterceptor(grpcmw.StreamServerInterceptor(plugin)),
+	)
+	// Register the services here
+
+	listener, err := net.Listen("tcp", ":50051")
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(server.Serve(listener))
+}
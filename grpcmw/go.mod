@@ -0,0 +1,23 @@
+module github.com/david-garcia-garcia/traefik-geoblock/grpcmw
+
+go 1.21
+
+replace github.com/david-garcia-garcia/traefik-geoblock => ..
+
+replace github.com/ip2location/ip2location-go/v9 v9.7.1 => github.com/david-garcia-garcia/ip2location-go/v9 v9.7.1-safe
+
+require (
+	github.com/david-garcia-garcia/traefik-geoblock v0.0.0-00010101000000-000000000000
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20231002182017-d307bd883b97
+	google.golang.org/grpc v1.60.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/ip2location/ip2location-go/v9 v9.7.1 // indirect
+	golang.org/x/net v0.16.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+	lukechampine.com/uint128 v1.3.0 // indirect
+)
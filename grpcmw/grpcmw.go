@@ -0,0 +1,75 @@
+// Package grpcmw adapts Plugin.CheckPeer to gRPC interceptors. It is a module of its own, so the plugin
+// doesn't depend on gRPC.
+//
+//	plugin, err := geoblock.NewFromOptions(...)
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcmw.UnaryServerInterceptor(plugin)),
+//		grpc.StreamInterceptor(grpcmw.StreamServerInterceptor(plugin)),
+//	)
+package grpcmw
+
+import (
+	"context"
+	"errors"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail attached to rejected calls
+const ErrorDomain = "geoblock"
+
+// UnaryServerInterceptor rejects unary calls blocked by the plugin with PermissionDenied
+func UnaryServerInterceptor(plugin *geoblock.Plugin) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := check(ctx, plugin); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams blocked by the plugin with PermissionDenied before the handler runs
+func StreamServerInterceptor(plugin *geoblock.Plugin) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(ss.Context(), plugin); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// check applies the plugin rules to the peer and incoming metadata of the call. A blocked call gets a
+// PermissionDenied status whose ErrorInfo detail carries the phase as reason, and the IP and country.
+func check(ctx context.Context, plugin *geoblock.Plugin) error {
+	var peerAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	err := plugin.CheckPeer(peerAddr, md)
+	var denied *geoblock.DeniedError
+	if !errors.As(err, &denied) {
+		return err
+	}
+
+	st := status.New(codes.PermissionDenied, "access denied")
+	if detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: denied.Phase,
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			"ip":      denied.IP,
+			"country": denied.Country,
+			"phase":   denied.Phase,
+		},
+	}); detailsErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,100 @@
+package grpcmw
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const tinyDbFilePath = "../testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN"
+
+func TestInterceptors(t *testing.T) {
+	plugin, err := geoblock.NewFromOptions(
+		geoblock.WithDatabaseFilePath(tinyDbFilePath),
+		geoblock.WithAllowedCountries("AU"),
+		geoblock.WithLogging("error", "text", ""),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(plugin)),
+		grpc.StreamInterceptor(StreamServerInterceptor(plugin)),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener) //nolint:errcheck
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	tests := []struct {
+		name    string
+		ip      string
+		allowed bool
+	}{
+		{"allowed country", "1.1.1.1", true},
+		{"blocked country", "8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", tt.ip))
+			defer cancel()
+
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			checkStatus(t, "unary", err, tt.allowed)
+
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Fatalf("expected no error opening the stream, but got: %v", err)
+			}
+			_, err = stream.Recv()
+			checkStatus(t, "stream", err, tt.allowed)
+		})
+	}
+}
+
+// checkStatus verifies that an allowed call succeeded, or that a blocked one got PermissionDenied with its details
+func checkStatus(t *testing.T, kind string, err error, allowed bool) {
+	t.Helper()
+	if allowed {
+		if err != nil {
+			t.Errorf("%s: expected the call to be allowed, got %v", kind, err)
+		}
+		return
+	}
+
+	st, _ := status.FromError(err)
+	if st.Code() != codes.PermissionDenied {
+		t.Fatalf("%s: expected %s, got %v", kind, codes.PermissionDenied, err)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if info.Domain != ErrorDomain || info.Reason == "" || info.Metadata["country"] != "US" || info.Metadata["ip"] != "8.8.8.8" {
+				t.Errorf("%s: unexpected error info %+v", kind, info)
+			}
+			return
+		}
+	}
+	t.Errorf("%s: expected an ErrorInfo detail, got %v", kind, st.Details())
+}
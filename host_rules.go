@@ -0,0 +1,172 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// PhaseUnknownHost is used when the Host header matches none of the HostRules
+const PhaseUnknownHost = "unknown_host"
+
+// Policies for requests to hosts matching none of the HostRules
+const (
+	UnknownHostPolicyAllow = "allow" // Evaluate with the global rules
+	UnknownHostPolicyLog   = "log"   // Evaluate with the global rules and log the host (default)
+	UnknownHostPolicyBlock = "block" // Block with phase "unknown_host"
+)
+
+// HostRule overrides the country rules for requests to some virtual hosts. Unset fields inherit
+// the global settings, or IPv4Policy/IPv6Policy for their address family.
+type HostRule struct {
+	Hosts            []string // Host names, "*.example.com" matches any subdomain
+	DefaultPolicy    string   // "allow" or "block" when no rule matches (empty inherits)
+	AllowedCountries []string // Replaces AllowedCountries for these hosts when not empty
+	BlockedCountries []string // Replaces BlockedCountries for these hosts when not empty
+}
+
+// hostRule is a HostRule merged into the rules of each address family
+type hostRule struct {
+	exact     map[string]struct{}
+	suffixes  []string      // ".example.com" for "*.example.com"
+	ipv4Rules *countryRules // nil when the rule changes nothing for the family
+	ipv6Rules *countryRules
+}
+
+// hostRules selects the country rules by Host header
+type hostRules struct {
+	rules         []hostRule
+	unknownPolicy string
+}
+
+// newHostRules validates HostRules on top of the family rules. Returns nil when no rules are configured.
+func newHostRules(cfg *Config, global countryRules, ipv4Rules, ipv6Rules *countryRules, logger *slog.Logger) (*hostRules, error) {
+	if len(cfg.HostRules) == 0 {
+		if cfg.UnknownHostPolicy != "" {
+			logger.Warn("UnknownHostPolicy has no effect without HostRules")
+		}
+		return nil, nil
+	}
+
+	unknownPolicy := strings.ToLower(cfg.UnknownHostPolicy)
+	switch unknownPolicy {
+	case "":
+		unknownPolicy = UnknownHostPolicyLog
+	case UnknownHostPolicyAllow, UnknownHostPolicyLog, UnknownHostPolicyBlock:
+	default:
+		return nil, fmt.Errorf("invalid UnknownHostPolicy %q, must be one of: %s, %s, %s",
+			cfg.UnknownHostPolicy, UnknownHostPolicyAllow, UnknownHostPolicyLog, UnknownHostPolicyBlock)
+	}
+
+	hosts := &hostRules{unknownPolicy: unknownPolicy}
+	for i, rule := range cfg.HostRules {
+		scope := fmt.Sprintf("HostRules[%d]", i)
+		if len(rule.Hosts) == 0 {
+			return nil, fmt.Errorf("%s has no Hosts", scope)
+		}
+
+		policy := AddressFamilyPolicy{DefaultPolicy: rule.DefaultPolicy, AllowedCountries: rule.AllowedCountries, BlockedCountries: rule.BlockedCountries}
+		parsed, err := newHostRule(cfg, scope, rule.Hosts, policy, global, ipv4Rules, ipv6Rules, logger)
+		if err != nil {
+			return nil, err
+		}
+		hosts.rules = append(hosts.rules, parsed)
+	}
+	return hosts, nil
+}
+
+// newHostRule validates the host patterns and merges the policy into the rules of both address families
+func newHostRule(cfg *Config, scope string, hosts []string, policy AddressFamilyPolicy, global countryRules, ipv4Rules, ipv6Rules *countryRules, logger *slog.Logger) (hostRule, error) {
+	parsed := hostRule{exact: make(map[string]struct{}, len(hosts))}
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if suffix, wildcard := strings.CutPrefix(host, "*"); wildcard {
+			if !strings.HasPrefix(suffix, ".") || len(suffix) < 2 {
+				return hostRule{}, fmt.Errorf("%s: invalid host pattern %q, wildcards must look like *.example.com", scope, host)
+			}
+			parsed.suffixes = append(parsed.suffixes, suffix)
+			continue
+		}
+		if host == "" || strings.Contains(host, "*") {
+			return hostRule{}, fmt.Errorf("%s: invalid host %q", scope, host)
+		}
+		parsed.exact[host] = struct{}{}
+	}
+
+	var err error
+	if parsed.ipv4Rules, err = hostFamilyRules(cfg, scope, policy, global, ipv4Rules, logger); err != nil {
+		return hostRule{}, err
+	}
+	if parsed.ipv6Rules, err = hostFamilyRules(cfg, scope, policy, global, ipv6Rules, logger); err != nil {
+		return hostRule{}, err
+	}
+	return parsed, nil
+}
+
+// hostFamilyRules merges a host policy into the rules of one address family (nil for the global rules)
+func hostFamilyRules(cfg *Config, scope string, policy AddressFamilyPolicy, global countryRules, family *countryRules, logger *slog.Logger) (*countryRules, error) {
+	base := global
+	if family != nil {
+		base = *family
+	}
+	merged, err := newCountryRules(scope, policy, base)
+	if err != nil || merged == nil {
+		return family, err
+	}
+	if len(policy.AllowedCountries) > 0 || len(policy.BlockedCountries) > 0 {
+		if _, err := validateCountryListPrecedence(cfg.CountryListPrecedence, scope, *merged, logger); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// match returns the first rule for the Host header, ignoring the port
+func (h *hostRules) match(hostHeader string) (*hostRule, bool) {
+	i := matchHost(h.rules, hostName(hostHeader))
+	if i < 0 {
+		return nil, false
+	}
+	return &h.rules[i], true
+}
+
+// matchHost returns the index of the first rule for a normalized host name, -1 when none matches
+func matchHost(rules []hostRule, host string) int {
+	for i := range rules {
+		if _, ok := rules[i].exact[host]; ok {
+			return i
+		}
+		for _, suffix := range rules[i].suffixes {
+			if strings.HasSuffix(host, suffix) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// hostName normalizes a Host header: lowercased, without port or trailing dot
+func hostName(hostHeader string) string {
+	host := strings.ToLower(hostHeader)
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// forHost returns the plugin to evaluate a request for the host with, and whether the host is unknown
+func (p Plugin) forHost(host string) (Plugin, bool) {
+	rule, known := p.hostRules.match(host)
+	if !known {
+		return p, true
+	}
+	return p.withHostRule(rule), false
+}
+
+// withHostRule returns the plugin with the country rules of a host rule or profile
+func (p Plugin) withHostRule(rule *hostRule) Plugin {
+	p.ipv4Rules, p.ipv6Rules = rule.ipv4Rules, rule.ipv6Rules
+	p.countryGrace = nil // The grace period compares the global and family rules only
+	return p
+}
@@ -0,0 +1,95 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostRules(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	newHostRulesPlugin := func(unknownHostPolicy string) *Plugin {
+		cfg := CreateConfig()
+		cfg.Enabled = true
+		cfg.DatabaseFilePath = tinyDbFilePath
+		cfg.AllowedCountries = []string{"AU"}
+		cfg.AllowPrivate = true
+		cfg.RemediationHeadersCustomName = "X-Geoblock-Phase"
+		cfg.HostRules = []HostRule{
+			{Hosts: []string{"shop.example.com"}, AllowedCountries: []string{"DE"}},
+			{Hosts: []string{"*.api.example.com"}, DefaultPolicy: "allow"},
+			{Hosts: []string{"example.com"}},
+		}
+		cfg.UnknownHostPolicy = unknownHostPolicy
+
+		plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		t.Cleanup(func() { plugin.Close() })
+		return plugin
+	}
+
+	tests := []struct {
+		policy    string
+		host      string
+		ip        string
+		want      int
+		wantPhase string
+	}{
+		{UnknownHostPolicyBlock, "shop.example.com:8443", "85.214.132.1", http.StatusTeapot, ""},
+		{UnknownHostPolicyBlock, "SHOP.example.com", "1.1.1.1", http.StatusForbidden, PhaseDefaultAllow},
+		{UnknownHostPolicyBlock, "v1.api.example.com", "8.8.8.8", http.StatusTeapot, ""},
+		{UnknownHostPolicyBlock, "example.com", "1.1.1.1", http.StatusTeapot, ""},
+		{UnknownHostPolicyBlock, "example.com", "8.8.8.8", http.StatusForbidden, PhaseDefaultAllow},
+		{UnknownHostPolicyBlock, "api.example.com", "1.1.1.1", http.StatusForbidden, PhaseUnknownHost},
+		{UnknownHostPolicyBlock, "203.0.113.7", "192.168.1.1", http.StatusTeapot, ""},
+		{UnknownHostPolicyLog, "api.example.com", "1.1.1.1", http.StatusTeapot, ""},
+		{UnknownHostPolicyLog, "api.example.com", "8.8.8.8", http.StatusForbidden, PhaseDefaultAllow},
+	}
+	plugins := map[string]*Plugin{}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.host+" "+tt.ip, func(t *testing.T) {
+			plugin, ok := plugins[tt.policy]
+			if !ok {
+				plugin = newHostRulesPlugin(tt.policy)
+				plugins[tt.policy] = plugin
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			req.Header.Set("X-Real-IP", tt.ip)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want || rr.Header().Get("X-Geoblock-Phase") != tt.wantPhase {
+				t.Errorf("expected %d %q, got %d %q", tt.want, tt.wantPhase, rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+			}
+		})
+	}
+}
+
+func TestHostRules_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"policy", Config{HostRules: []HostRule{{Hosts: []string{"example.com"}}}, UnknownHostPolicy: "drop"}, "invalid UnknownHostPolicy"},
+		{"no hosts", Config{HostRules: []HostRule{{AllowedCountries: []string{"US"}}}}, "has no Hosts"},
+		{"wildcard", Config{HostRules: []HostRule{{Hosts: []string{"*example.com"}}}}, "invalid host pattern"},
+		{"default policy", Config{HostRules: []HostRule{{Hosts: []string{"example.com"}, DefaultPolicy: "deny"}}}, "HostRules[0].DefaultPolicy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHostRules(&tt.cfg, countryRules{}, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHotSwapSoak serves requests from many goroutines while the database is hot swapped and other
+// factories are created and released, and expects every answer to be right. Run it with -race.
+// GEOBLOCK_SOAK_SECONDS makes it run longer than the default second, e.g. before a release:
+//
+//	GEOBLOCK_SOAK_SECONDS=300 go test -race -run TestHotSwapSoak .
+func TestHotSwapSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test skipped in short mode")
+	}
+	duration := time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("GEOBLOCK_SOAK_SECONDS")); err == nil && seconds > 0 {
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	CleanupFactories()
+	defer CleanupFactories()
+
+	// Swapped out databases are closed quickly, so lookups still holding one would fail the test
+	defer func(delay time.Duration) { hotSwapCloseDelay = delay }(hotSwapCloseDelay)
+	hotSwapCloseDelay = 250 * time.Millisecond
+
+	// Local copies made by every swap go to the test directory
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	alternatePath := filepath.Join(tempDir, "alternate", "IP2LOCATION-LITE-DB1.IPV6.BIN")
+	if err := os.MkdirAll(filepath.Dir(alternatePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(tinyDbFilePath, alternatePath, true); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.LogLevel = "error"
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	cases := []struct {
+		ip      string
+		country string
+		status  int
+	}{
+		{"1.1.1.1", "AU", http.StatusTeapot},
+		{"8.8.8.8", "US", http.StatusForbidden},
+		{"185.5.82.10", "DE", http.StatusForbidden},
+		{"2001:4860::8888", "US", http.StatusForbidden},
+		{"9.9.9.9", "-", http.StatusForbidden},
+	}
+
+	var failures, requests, swaps, factories int64
+	fail := func(format string, args ...interface{}) {
+		if atomic.AddInt64(&failures, 1) <= 10 {
+			t.Errorf(format, args...)
+		}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Request load: half of the workers go through ServeHTTP, the other half through CheckAllowed
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := worker; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				c := cases[i%len(cases)]
+				if worker%2 == 0 {
+					req := httptest.NewRequest(http.MethodGet, "/", nil)
+					req.Header.Set("X-Real-IP", c.ip)
+					rr := httptest.NewRecorder()
+					plugin.ServeHTTP(rr, req)
+					if rr.Code != c.status {
+						fail("%s: expected status %d, got %d", c.ip, c.status, rr.Code)
+					}
+				} else {
+					_, country, _, err := plugin.CheckAllowed(c.ip)
+					if err != nil || country != c.country {
+						fail("%s: expected %s, got %s (err: %v)", c.ip, c.country, country, err)
+					}
+				}
+				atomic.AddInt64(&requests, 1)
+			}
+		}(worker)
+	}
+
+	// Continuous hot swaps between two copies of the database
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sources := []string{alternatePath, tinyDbFilePath}
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+			if err := plugin.factory.performHotSwap(sources[i%2]); err != nil {
+				fail("hot swap failed: %v", err)
+			}
+			atomic.AddInt64(&swaps, 1)
+		}
+	}()
+
+	// Factories with other settings are created, used and released next to the swapping one
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			churn, err := NewFromOptions(
+				WithName(fmt.Sprintf("churn%d", i%4)),
+				WithDatabaseFilePath(alternatePath),
+				WithAllowedCountries("US"),
+				WithLogging("error", "text", ""),
+			)
+			if err != nil {
+				fail("creating plugin failed: %v", err)
+				continue
+			}
+			if allowed, _, _, err := churn.CheckAllowed("8.8.8.8"); err != nil || !allowed {
+				fail("churn plugin: expected 8.8.8.8 to be allowed, got %v (err: %v)", allowed, err)
+			}
+			churn.Close()
+			atomic.AddInt64(&factories, 1)
+		}
+	}()
+
+	time.Sleep(duration)
+	close(stop)
+	wg.Wait()
+
+	if counts := plugin.ErrorCounts(); counts.LookupErrors != 0 {
+		t.Errorf("expected no lookup errors, got %d", counts.LookupErrors)
+	}
+	if swaps == 0 || factories == 0 {
+		t.Errorf("expected swaps and factory churn, got %d swaps and %d factories", swaps, factories)
+	}
+	t.Logf("%d requests, %d hot swaps, %d factories, %d failures", requests, swaps, factories, failures)
+}
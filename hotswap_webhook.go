@@ -0,0 +1,66 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// hotSwapWebhookTimeout bounds one webhook call, it runs in the background
+const hotSwapWebhookTimeout = 10 * time.Second
+
+// HotSwapEvent is POSTed as JSON to DatabaseHotSwapWebhookURL after a hot swap changed the database version
+type HotSwapEvent struct {
+	Event      string    `json:"event"` // Always "database_hot_swap"
+	Host       string    `json:"host"`  // Hostname of the node, so fleets can tell who swapped
+	FactoryID  string    `json:"factoryId"`
+	OldVersion string    `json:"oldVersion"`
+	NewVersion string    `json:"newVersion"`
+	OldSource  string    `json:"oldSource"`
+	NewSource  string    `json:"newSource"` // Database the new local copy was made from
+	Path       string    `json:"path"`      // Database file now in use
+	Time       time.Time `json:"time"`
+}
+
+// validateHotSwapWebhook checks the webhook URL, empty disables the webhook
+func validateHotSwapWebhook(url string) error {
+	if url == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil || (req.URL.Scheme != "http" && req.URL.Scheme != "https") || req.URL.Host == "" {
+		return fmt.Errorf("invalid DatabaseHotSwapWebhookURL %q, must be an http(s) URL", url)
+	}
+	return nil
+}
+
+// sendHotSwapWebhook posts the event in the background, failures are only logged
+func sendHotSwapWebhook(url string, event HotSwapEvent, logger *slog.Logger) {
+	if url == "" {
+		return
+	}
+	event.Event = "database_hot_swap"
+	event.Host, _ = os.Hostname()
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		logger.Warn("failed to encode hot swap webhook", "error", err)
+		return
+	}
+
+	go func() {
+		client := &http.Client{Timeout: hotSwapWebhookTimeout}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(encoded)) // #nosec G107
+		if err != nil {
+			logger.Warn("hot swap webhook failed", "url", url, "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			logger.Warn("hot swap webhook failed", "url", url, "status", resp.StatusCode)
+		}
+	}()
+}
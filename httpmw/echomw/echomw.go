@@ -0,0 +1,15 @@
+// Package echomw adapts httpmw to echo. It is a module of its own, so the plugin doesn't depend on echo.
+//
+//	gb, err := httpmw.New(cfg)
+//	e.Use(echomw.Middleware(gb))
+package echomw
+
+import (
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware returns echo middleware for gb. Blocked requests get the ban response and the next handler isn't called.
+func Middleware(gb *httpmw.Geoblock) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(gb.Middleware())
+}
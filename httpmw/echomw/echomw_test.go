@@ -0,0 +1,41 @@
+package echomw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+	"github.com/labstack/echo/v4"
+)
+
+const tinyDbFilePath = "../../testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN"
+
+func TestMiddleware(t *testing.T) {
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.LogLevel = "error"
+	gb, err := httpmw.New(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer gb.Close()
+
+	e := echo.New()
+	e.Use(Middleware(gb))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusTeapot)
+	})
+
+	for ip, want := range map[string]int{"1.1.1.1": http.StatusTeapot, "8.8.8.8": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		rr := httptest.NewRecorder()
+		e.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("expected status %d for %s, got %d", want, ip, rr.Code)
+		}
+	}
+}
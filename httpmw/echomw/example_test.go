@@ -0,0 +1,31 @@
+package echomw_test
+
+import (
+	"log"
+	"net/http"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw/echomw"
+	"github.com/labstack/echo/v4"
+)
+
+func ExampleMiddleware() {
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = "/data/IP2LOCATION-LITE-DB1.IPV6.BIN"
+	cfg.AllowedCountries = []string{"DE", "FR"}
+
+	gb, err := httpmw.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer gb.Close()
+
+	e := echo.New()
+	e.Use(echomw.Middleware(gb))
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+
+	log.Fatal(e.Start(":8080"))
+}
@@ -0,0 +1,26 @@
+module github.com/david-garcia-garcia/traefik-geoblock/httpmw/echomw
+
+go 1.21
+
+replace github.com/david-garcia-garcia/traefik-geoblock => ../..
+
+replace github.com/ip2location/ip2location-go/v9 v9.7.1 => github.com/david-garcia-garcia/ip2location-go/v9 v9.7.1-safe
+
+require (
+	github.com/david-garcia-garcia/traefik-geoblock v0.0.0-00010101000000-000000000000
+	github.com/labstack/echo/v4 v4.11.4
+)
+
+require (
+	github.com/ip2location/ip2location-go/v9 v9.7.1 // indirect
+	github.com/labstack/gommon v0.4.2 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.2 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	lukechampine.com/uint128 v1.3.0 // indirect
+)
@@ -0,0 +1,42 @@
+package httpmw_test
+
+import (
+	"log"
+	"net/http"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+)
+
+func ExampleMiddleware() {
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = "/data/IP2LOCATION-LITE-DB1.IPV6.BIN"
+	cfg.AllowedCountries = []string{"DE", "FR"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	log.Fatal(http.ListenAndServe(":8080", httpmw.Middleware(cfg)(mux))) // #nosec G114
+}
+
+func ExampleGeoblock_Allow() {
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = "/data/IP2LOCATION-LITE-DB1.IPV6.BIN"
+	cfg.BlockedCountries = []string{"RU"}
+	cfg.DefaultAllow = true
+
+	gb, err := httpmw.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer gb.Close()
+
+	http.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		if !gb.Allow(w, r) {
+			return // ban response already written
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+}
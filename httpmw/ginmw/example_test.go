@@ -0,0 +1,31 @@
+package ginmw_test
+
+import (
+	"log"
+	"net/http"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw/ginmw"
+	"github.com/gin-gonic/gin"
+)
+
+func ExampleMiddleware() {
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = "/data/IP2LOCATION-LITE-DB1.IPV6.BIN"
+	cfg.AllowedCountries = []string{"DE", "FR"}
+
+	gb, err := httpmw.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer gb.Close()
+
+	router := gin.New()
+	router.Use(ginmw.Middleware(gb))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+
+	log.Fatal(router.Run(":8080"))
+}
@@ -0,0 +1,21 @@
+// Package ginmw adapts httpmw to gin. It is a module of its own, so the plugin doesn't depend on gin.
+//
+//	gb, err := httpmw.New(cfg)
+//	router.Use(ginmw.Middleware(gb))
+package ginmw
+
+import (
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware returns gin middleware for gb. Blocked requests get the ban response and the chain is aborted.
+func Middleware(gb *httpmw.Geoblock) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !gb.Allow(c.Writer, c.Request) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package ginmw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+	"github.com/david-garcia-garcia/traefik-geoblock/httpmw"
+	"github.com/gin-gonic/gin"
+)
+
+const tinyDbFilePath = "../../testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN"
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.LogLevel = "error"
+	gb, err := httpmw.New(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer gb.Close()
+
+	router := gin.New()
+	router.Use(Middleware(gb))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	for ip, want := range map[string]int{"1.1.1.1": http.StatusTeapot, "8.8.8.8": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("expected status %d for %s, got %d", want, ip, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package httpmw exposes the geoblock rule engine as plain net/http middleware, so it can be
+// reused outside Traefik (net/http, chi, gorilla, echo, gin...) without copying ServeHTTP logic.
+//
+// net/http and chi take the standard middleware signature directly:
+//
+//	r := chi.NewRouter()
+//	r.Use(httpmw.Middleware(cfg))
+//
+// gin and echo have adapters in the ginmw and echomw modules, kept apart so this module doesn't depend
+// on them:
+//
+//	gb, err := httpmw.New(cfg)
+//	router.Use(ginmw.Middleware(gb))
+//	e.Use(echomw.Middleware(gb))
+//
+// Other frameworks can use Allow, which writes the ban response when the request is blocked.
+package httpmw
+
+import (
+	"net/http"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+// Geoblock is a geoblock plugin instance usable as net/http middleware
+type Geoblock struct {
+	plugin *geoblock.Plugin
+	marker http.Handler // next handler used by Allow
+}
+
+// New creates a Geoblock from a plugin configuration. The plugin is enabled regardless of cfg.Enabled.
+func New(cfg *geoblock.Config) (*Geoblock, error) {
+	copied := *cfg
+	copied.Enabled = true
+
+	plugin, err := geoblock.NewFromOptions(geoblock.WithConfig(&copied))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Geoblock{plugin: plugin}
+	g.marker = plugin.Wrap(http.HandlerFunc(markAllowed))
+	return g, nil
+}
+
+// Middleware returns standard net/http middleware for cfg.
+// It panics if the configuration is invalid, like regexp.MustCompile; use New to handle the error.
+func Middleware(cfg *geoblock.Config) func(http.Handler) http.Handler {
+	g, err := New(cfg)
+	if err != nil {
+		panic("httpmw: " + err.Error())
+	}
+	return g.Middleware()
+}
+
+// Middleware returns standard net/http middleware sharing this instance and its database
+func (g *Geoblock) Middleware() func(http.Handler) http.Handler {
+	return g.plugin.Wrap
+}
+
+// Allow evaluates the request. Blocked requests get the ban response written to w and false is
+// returned; allowed requests are left untouched (apart from the configured country header).
+func (g *Geoblock) Allow(w http.ResponseWriter, r *http.Request) bool {
+	rec := &allowRecorder{ResponseWriter: w}
+	g.marker.ServeHTTP(rec, r)
+	return rec.allowed
+}
+
+// Plugin returns the underlying plugin, to call CheckAllowed or Lookup directly
+func (g *Geoblock) Plugin() *geoblock.Plugin {
+	return g.plugin
+}
+
+// Close releases the database held by this instance
+func (g *Geoblock) Close() error {
+	return g.plugin.Close()
+}
+
+// allowRecorder records whether the plugin passed the request to the next handler
+type allowRecorder struct {
+	http.ResponseWriter
+	allowed bool
+}
+
+// markAllowed is the next handler used by Allow: reaching it means the request was allowed
+func markAllowed(w http.ResponseWriter, _ *http.Request) {
+	if rec, ok := w.(*allowRecorder); ok {
+		rec.allowed = true
+	}
+}
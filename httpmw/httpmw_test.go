@@ -0,0 +1,78 @@
+package httpmw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+const tinyDbFilePath = "../testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN"
+
+func testConfig() *geoblock.Config {
+	cfg := geoblock.CreateConfig()
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.LogLevel = "error"
+	return cfg
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(testConfig())(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for ip, want := range map[string]int{"1.1.1.1": http.StatusTeapot, "8.8.8.8": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("expected status %d for %s, got %d", want, ip, rr.Code)
+		}
+	}
+}
+
+func TestMiddleware_PanicsOnInvalidConfig(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid configuration")
+		}
+	}()
+
+	cfg := testConfig()
+	cfg.IPHeaders = nil
+	Middleware(cfg)
+}
+
+func TestGeoblock_Allow(t *testing.T) {
+	cfg := testConfig()
+	cfg.CountryHeader = "X-Country"
+
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer g.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	rr := httptest.NewRecorder()
+	if !g.Allow(rr, req) {
+		t.Error("expected AU request to be allowed")
+	}
+	if req.Header.Get("X-Country") != "AU" {
+		t.Errorf("expected country header AU, got %q", req.Header.Get("X-Country"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "8.8.8.8")
+	rr = httptest.NewRecorder()
+	if g.Allow(rr, req) {
+		t.Error("expected US request to be blocked")
+	}
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected ban response %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
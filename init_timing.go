@@ -0,0 +1,59 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// initTimer measures the initialization steps of a plugin instance and enforces InitBudgetMs
+type initTimer struct {
+	start  time.Time
+	last   time.Time
+	budget time.Duration // Zero disables the budget
+	names  []string
+	times  []time.Duration
+}
+
+func newInitTimer(budgetMs int) *initTimer {
+	now := time.Now()
+	return &initTimer{start: now, last: now, budget: time.Duration(budgetMs) * time.Millisecond}
+}
+
+// step records the duration of the step that just finished, and fails once the budget is exceeded
+func (t *initTimer) step(name string) error {
+	now := time.Now()
+	t.names = append(t.names, name)
+	t.times = append(t.times, now.Sub(t.last))
+	t.last = now
+
+	if t.budget > 0 && now.Sub(t.start) > t.budget {
+		return fmt.Errorf("initialization exceeded InitBudgetMs (%s > %s) at step %s (%s)",
+			t.total().Round(time.Millisecond), t.budget, name, t.String())
+	}
+	return nil
+}
+
+// total returns the time spent since the timer was created
+func (t *initTimer) total() time.Duration {
+	return t.last.Sub(t.start)
+}
+
+// String lists the steps as "database=12ms ip_blocks=1ms"
+func (t *initTimer) String() string {
+	parts := make([]string, len(t.names))
+	for i, name := range t.names {
+		parts[i] = fmt.Sprintf("%s=%s", name, t.times[i].Round(time.Microsecond))
+	}
+	return strings.Join(parts, " ")
+}
+
+// logArgs returns the step durations as log key/value pairs
+func (t *initTimer) logArgs() []any {
+	args := make([]any, 0, 2*len(t.names)+2)
+	args = append(args, "total", t.total())
+	for i, name := range t.names {
+		args = append(args, name, t.times[i])
+	}
+	return args
+}
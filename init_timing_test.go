@@ -0,0 +1,39 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitTimerBudget(t *testing.T) {
+	timer := newInitTimer(5)
+	if err := timer.step("database"); err != nil {
+		t.Fatalf("unexpected error within budget: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	err := timer.step("ip_blocks")
+	if err == nil {
+		t.Fatal("expected error once the budget is exceeded")
+	}
+	if !strings.Contains(err.Error(), "at step ip_blocks") || !strings.Contains(err.Error(), "database=") {
+		t.Errorf("expected the step breakdown in the error, got %v", err)
+	}
+
+	if err := newInitTimer(0).step("database"); err != nil {
+		t.Errorf("expected no budget when InitBudgetMs is 0, got %v", err)
+	}
+}
+
+func TestInitBudgetMs(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.InitBudgetMs = 60000
+
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err != nil {
+		t.Errorf("expected initialization within the budget, got %v", err)
+	}
+}
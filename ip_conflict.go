@@ -0,0 +1,124 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// PhaseIPConflict is used when the configured IP headers name different clients (ConflictPolicy "block")
+const PhaseIPConflict = "ip_conflict"
+
+// What happens to requests whose IP headers disagree
+const (
+	ConflictPolicyIgnore = "ignore" // Don't compare the headers (default)
+	ConflictPolicyFlag   = "flag"   // Log the conflict and set ConflictHeader, the request is evaluated as usual
+	ConflictPolicyBlock  = "block"  // Block the request
+)
+
+// What must differ between the headers for a conflict
+const (
+	ConflictCompareCountry = "country" // The countries of the client IPs (default), proxies adding their own public IP don't count
+	ConflictCompareIP      = "ip"      // The client IPs themselves
+)
+
+// ipConflicts compares the client IP each configured header names. Two headers naming different
+// public clients is a typical sign of a spoofed header or of a proxy that isn't configured to replace it.
+type ipConflicts struct {
+	policy  string
+	compare string
+	header  string
+}
+
+// headerClientIP is the client IP named by one IP header
+type headerClientIP struct {
+	header  string
+	ip      string
+	country string
+}
+
+// newIPConflicts validates the conflict settings. Returns nil for the ignore policy.
+func newIPConflicts(cfg *Config) (*ipConflicts, error) {
+	policy := strings.ToLower(cfg.ConflictPolicy)
+	switch policy {
+	case "", ConflictPolicyIgnore:
+		return nil, nil
+	case ConflictPolicyFlag, ConflictPolicyBlock:
+	default:
+		return nil, fmt.Errorf("invalid ConflictPolicy %q, must be one of: %s, %s, %s",
+			cfg.ConflictPolicy, ConflictPolicyIgnore, ConflictPolicyFlag, ConflictPolicyBlock)
+	}
+	compare := strings.ToLower(cfg.ConflictCompare)
+	switch compare {
+	case "":
+		compare = ConflictCompareCountry
+	case ConflictCompareCountry, ConflictCompareIP:
+	default:
+		return nil, fmt.Errorf("invalid ConflictCompare %q, must be one of: %s, %s",
+			cfg.ConflictCompare, ConflictCompareCountry, ConflictCompareIP)
+	}
+	return &ipConflicts{policy: policy, compare: compare, header: cfg.ConflictHeader}, nil
+}
+
+// detectIPConflict returns the client IP of every IP header when at least two of them disagree, nil otherwise.
+// The client IP of a header is its leftmost public address; the synthetic remoteAddress header is the peer,
+// not a claim about the client, and is left out. So are headers of untrusted peers, they are not used.
+func (p Plugin) detectIPConflict(req *http.Request) []headerClientIP {
+	if _, untrusted := p.untrustedPeerIP(req); untrusted {
+		return nil
+	}
+
+	var clients []headerClientIP
+	for _, headerName := range p.requestIPHeaders(req) {
+		if headerName == "remoteAddress" {
+			continue
+		}
+		for i, rest, more := 0, req.Header.Get(headerName), true; more; i++ {
+			// Stuffed headers are only read as far as remoteIPs reads them
+			if p.maxChainLength > 0 && i == p.maxChainLength {
+				break
+			}
+			var token string
+			token, rest, more = strings.Cut(rest, ",")
+			ip, valid := parseIPToken(token)
+			if !valid {
+				continue
+			}
+			if parsed := net.ParseIP(ip); parsed.IsPrivate() || parsed.IsLoopback() {
+				continue
+			}
+			client := headerClientIP{header: headerName, ip: ip}
+			if p.ipConflicts.compare == ConflictCompareCountry {
+				country, err := p.Lookup(ip)
+				if err != nil {
+					break // Can't tell, the header takes no part in the comparison
+				}
+				client.country = country
+			}
+			clients = append(clients, client)
+			break
+		}
+	}
+
+	for i := 1; i < len(clients); i++ {
+		if (p.ipConflicts.compare == ConflictCompareIP && !net.ParseIP(clients[i].ip).Equal(net.ParseIP(clients[0].ip))) ||
+			(p.ipConflicts.compare == ConflictCompareCountry && clients[i].country != clients[0].country) {
+			return clients
+		}
+	}
+	return nil
+}
+
+// formatIPConflict lists the client IP of every header, e.g. "x-forwarded-for=1.2.3.4 (US), x-real-ip=5.6.7.8 (DE)"
+func formatIPConflict(clients []headerClientIP) string {
+	parts := make([]string, 0, len(clients))
+	for _, client := range clients {
+		part := client.header + "=" + client.ip
+		if client.country != "" {
+			part += " (" + client.country + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,85 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		compare      string
+		forwardedFor string
+		realIP       string
+		want         int
+		wantConflict string
+	}{
+		{"same client", "block", "", "1.1.1.1, 8.8.8.8", "1.1.1.1", http.StatusTeapot, ""},
+		{"other country blocked", "block", "", "1.1.1.1", "85.214.132.1", http.StatusForbidden, "x-forwarded-for=1.1.1.1 (AU), x-real-ip=85.214.132.1 (DE)"},
+		{"other country flagged", "flag", "", "1.1.1.1", "85.214.132.1", http.StatusTeapot, "x-forwarded-for=1.1.1.1 (AU), x-real-ip=85.214.132.1 (DE)"},
+		{"same country, other IP", "block", "country", "8.8.8.8", "8.8.4.4", http.StatusTeapot, ""},
+		{"same country, other IP compared by IP", "block", "ip", "8.8.8.8", "8.8.4.4", http.StatusForbidden, "x-forwarded-for=8.8.8.8, x-real-ip=8.8.4.4"},
+		{"private addresses don't count", "block", "ip", "10.0.0.1, 1.1.1.1", "1.1.1.1", http.StatusTeapot, ""},
+		{"single header", "block", "ip", "1.1.1.1", "", http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.DefaultAllow = true
+			cfg.AllowPrivate = true
+			cfg.IPHeaders = []string{"x-forwarded-for", "x-real-ip"}
+			cfg.ConflictPolicy = tt.policy
+			cfg.ConflictCompare = tt.compare
+			cfg.ConflictHeader = "X-Geoblock-IP-Conflict"
+			cfg.RemediationHeadersCustomName = "X-Geoblock-Action"
+
+			var forwarded string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				forwarded = req.Header.Get("X-Geoblock-IP-Conflict")
+				rw.WriteHeader(http.StatusTeapot)
+			})
+			plugin, err := newPlugin(context.TODO(), next, cfg, pluginName, nil)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			defer plugin.Close()
+			logs := &syncBuffer{}
+			plugin.logger = slog.New(slog.NewTextHandler(logs, nil))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			req.Header.Set("X-Real-IP", tt.realIP)
+			req.Header.Set("X-Geoblock-IP-Conflict", "spoofed")
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+			if rr.Code == http.StatusForbidden && rr.Header().Get("X-Geoblock-Action") != PhaseIPConflict {
+				t.Errorf("expected phase %s, got %q", PhaseIPConflict, rr.Header().Get("X-Geoblock-Action"))
+			}
+			if rr.Code == http.StatusTeapot && forwarded != tt.wantConflict {
+				t.Errorf("expected conflict header %q, got %q", tt.wantConflict, forwarded)
+			}
+			if logged := strings.Contains(logs.String(), "IP headers name different clients"); logged != (tt.wantConflict != "") {
+				t.Errorf("expected conflict logged=%v, got logs %s", tt.wantConflict != "", logs.String())
+			}
+		})
+	}
+}
+
+func TestConflictPolicy_Invalid(t *testing.T) {
+	for _, cfg := range []Config{{ConflictPolicy: "warn"}, {ConflictPolicy: "block", ConflictCompare: "asn"}} {
+		if _, err := newIPConflicts(&cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ipHeaderRegexPrefix marks an IPHeaders entry as a regular expression over header names
+const ipHeaderRegexPrefix = "regex:"
+
+// ipHeaderPatterns holds the IPHeaders entries matching several headers, such as "X-Tenant-*-Client-IP"
+// or "regex:^X-Tenant-[0-9]+-Client-IP$". They are compiled at startup, keyed by the configured entry.
+type ipHeaderPatterns map[string]*regexp.Regexp
+
+// newIPHeaderPatterns compiles the wildcard and regex entries of IPHeaders. Returns nil when all entries
+// are plain header names, so the common configuration keeps reading the headers directly.
+func newIPHeaderPatterns(headers []string) (ipHeaderPatterns, error) {
+	var patterns ipHeaderPatterns
+	for _, header := range headers {
+		var expr string
+		switch {
+		case strings.HasPrefix(header, ipHeaderRegexPrefix):
+			expr = strings.TrimPrefix(header, ipHeaderRegexPrefix)
+			if expr == "" {
+				return nil, fmt.Errorf("invalid IPHeaders entry %q: empty expression", header)
+			}
+		case strings.Contains(header, "*"):
+			parts := strings.Split(header, "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			expr = "^" + strings.Join(parts, ".*") + "$"
+		default:
+			continue
+		}
+
+		// Header names are case insensitive, the request holds them in canonical form
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPHeaders entry %q: %w", header, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("invalid IPHeaders entry %q: it matches any header name", header)
+		}
+		if patterns == nil {
+			patterns = make(ipHeaderPatterns)
+		}
+		patterns[header] = re
+	}
+	return patterns, nil
+}
+
+// requestIPHeaders returns the IP headers to read for the request: plain entries as configured, and in place
+// of each pattern the matching request headers sorted by name, so the order doesn't depend on map iteration.
+// A header listed by an earlier entry is not read twice.
+func (p Plugin) requestIPHeaders(req *http.Request) []string {
+	if p.ipHeaderPatterns == nil {
+		return p.ipHeaders
+	}
+
+	headers := make([]string, 0, len(p.ipHeaders))
+	listed := make(map[string]struct{}, len(p.ipHeaders))
+	for _, entry := range p.ipHeaders {
+		re, isPattern := p.ipHeaderPatterns[entry]
+		if !isPattern {
+			name := entry
+			if name != "remoteAddress" {
+				name = http.CanonicalHeaderKey(name)
+			}
+			if _, ok := listed[name]; !ok {
+				listed[name] = struct{}{}
+				headers = append(headers, entry)
+			}
+			continue
+		}
+
+		var matches []string
+		for name := range req.Header {
+			if _, ok := listed[name]; !ok && re.MatchString(name) {
+				matches = append(matches, name)
+			}
+		}
+		sort.Strings(matches)
+		for _, name := range matches {
+			listed[name] = struct{}{}
+		}
+		headers = append(headers, matches...)
+	}
+	return headers
+}
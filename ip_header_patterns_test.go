@@ -0,0 +1,46 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIPHeaderPatterns(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.IPHeaders = []string{"x-real-ip", "X-Tenant-*-Client-IP", "regex:^x-edge-[a-z]+-ip$", "remoteAddress"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Tenant-456-Client-IP", "85.214.132.1")
+	req.Header.Set("X-Tenant-123-Client-IP", "8.8.8.8")
+	req.Header.Set("X-Tenant-Client-IP-Extra", "1.1.1.1")
+	req.Header.Set("X-Edge-Paris-IP", "2a00:1450::1")
+	req.Header.Set("X-Edge-9-IP", "8.8.4.4")
+	req.Header.Set("X-Real-IP", "185.5.82.1")
+
+	// Matches are sorted by name, in place of their pattern
+	want := []string{"185.5.82.1", "8.8.8.8", "85.214.132.1", "2a00:1450::1", "192.0.2.1"}
+	for i := 0; i < 10; i++ {
+		if got := plugin.GetRemoteIPs(req); !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	for _, headers := range [][]string{{"regex:"}, {"regex:x-(["}, {"*"}, {"x-forwarded-for", "regex:.*"}} {
+		cfg.IPHeaders = headers
+		if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+			t.Errorf("expected an error for IPHeaders %q", headers)
+		}
+	}
+}
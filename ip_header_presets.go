@@ -0,0 +1,89 @@
+package traefik_geoblock
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPHeaderStrategy presets for cloud load balancers. They replace IPHeaders with the headers the platform
+// sets, in priority order, and take a single client IP from the first one present.
+const (
+	IPHeaderStrategyCloudFront = "cloudfront" // CloudFront-Viewer-Address
+	IPHeaderStrategyAzure      = "azure"      // X-Azure-SocketIP, then X-Azure-ClientIP (Front Door)
+	IPHeaderStrategyGCLB       = "gclb"       // X-Appengine-User-IP, then the client entry of X-Forwarded-For
+)
+
+// platformHeader is one header of a preset and how the client IP is read from its value
+type platformHeader struct {
+	name    string
+	extract func(value string) string
+}
+
+// ipHeaderPresets maps the preset strategies to their headers, highest priority first
+var ipHeaderPresets = map[string][]platformHeader{
+	IPHeaderStrategyCloudFront: {
+		{name: "CloudFront-Viewer-Address", extract: viewerAddressIP},
+	},
+	// The client can influence X-Azure-ClientIP, the socket IP is what Front Door saw
+	IPHeaderStrategyAzure: {
+		{name: "X-Azure-SocketIP", extract: strings.TrimSpace},
+		{name: "X-Azure-ClientIP", extract: strings.TrimSpace},
+	},
+	IPHeaderStrategyGCLB: {
+		{name: "X-Appengine-User-IP", extract: strings.TrimSpace},
+		{name: "X-Forwarded-For", extract: gclbClientIP},
+	},
+}
+
+// ipHeaderPreset returns the headers of a preset strategy (case insensitive), nil for the other strategies
+func ipHeaderPreset(strategy string) []platformHeader {
+	return ipHeaderPresets[strings.ToLower(strategy)]
+}
+
+// presetHeaderNames returns the header names of a preset, used for logs and conflict detection
+func presetHeaderNames(preset []platformHeader) []string {
+	names := make([]string, len(preset))
+	for i, header := range preset {
+		names[i] = header.name
+	}
+	return names
+}
+
+// presetRemoteIPs returns the client IP from the first preset header present. A value that is not an IP
+// is returned as is, so it goes through OnParseError rather than looking like a request without headers.
+func presetRemoteIPs(req *http.Request, preset []platformHeader) []string {
+	for _, header := range preset {
+		value := req.Header.Get(header.name)
+		if value == "" {
+			continue
+		}
+		if ip := header.extract(value); ip != "" {
+			return []string{ip}
+		}
+	}
+	return nil
+}
+
+// viewerAddressIP reads CloudFront-Viewer-Address, "ip:port" where IPv6 addresses have no brackets
+// (e.g. "2001:db8::1:46532"), so the port is always after the last colon
+func viewerAddressIP(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndexByte(value, ':'); i > 0 {
+		if host := value[:i]; net.ParseIP(host) != nil {
+			return host
+		}
+	}
+	return value
+}
+
+// gclbClientIP reads X-Forwarded-For behind a Google Cloud load balancer, which appends "<client>, <lb>":
+// the client is the second entry from the right, entries on its left were sent by the client
+func gclbClientIP(value string) string {
+	entries := strings.Split(value, ",")
+	if len(entries) < 2 {
+		return ""
+	}
+	ip, _ := parseIPToken(entries[len(entries)-2])
+	return ip
+}
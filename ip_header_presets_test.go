@@ -0,0 +1,77 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIPHeaderPresets(t *testing.T) {
+	tests := []struct {
+		strategy string
+		headers  map[string]string
+		want     []string
+	}{
+		{IPHeaderStrategyCloudFront, map[string]string{"CloudFront-Viewer-Address": "198.51.100.10:46532"}, []string{"198.51.100.10"}},
+		{IPHeaderStrategyCloudFront, map[string]string{"CloudFront-Viewer-Address": "2001:db8::1:46532"}, []string{"2001:db8::1"}},
+		{IPHeaderStrategyCloudFront, map[string]string{"CloudFront-Viewer-Address": "2001:db8::1"}, []string{"2001:db8::1"}}, // Without port
+		{IPHeaderStrategyCloudFront, map[string]string{"X-Forwarded-For": "8.8.8.8"}, nil},
+		{IPHeaderStrategyAzure, map[string]string{"X-Azure-ClientIP": "8.8.8.8", "X-Azure-SocketIP": "1.1.1.1"}, []string{"1.1.1.1"}},
+		{IPHeaderStrategyAzure, map[string]string{"X-Azure-ClientIP": "8.8.8.8"}, []string{"8.8.8.8"}},
+		{IPHeaderStrategyGCLB, map[string]string{"X-Appengine-User-IP": "1.1.1.1", "X-Forwarded-For": "8.8.8.8, 35.191.0.1"}, []string{"1.1.1.1"}},
+		{IPHeaderStrategyGCLB, map[string]string{"X-Forwarded-For": "6.6.6.6, 8.8.8.8, 35.191.0.1"}, []string{"8.8.8.8"}},
+		{IPHeaderStrategyGCLB, map[string]string{"X-Forwarded-For": "8.8.8.8"}, nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		if got := presetRemoteIPs(req, ipHeaderPreset(tt.strategy)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %v: got %v, want %v", tt.strategy, tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestIPHeaderPresetStrategy(t *testing.T) {
+	plugin, err := NewFromOptions(
+		WithDatabaseFilePath(tinyDbFilePath),
+		WithAllowedCountries("IE"),
+		WithIPHeaders("CloudFront"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	handler := plugin.Wrap(&noopHandler{})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"ViewerAddress", map[string]string{"CloudFront-Viewer-Address": "2a00:1450::1:443"}, http.StatusTeapot},
+		{"ForwardedForIgnored", map[string]string{"CloudFront-Viewer-Address": "8.8.8.8:443", "X-Forwarded-For": "2a00:1450::1"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rr.Code)
+		}
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.IPHeaderStrategy = "akamai"
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
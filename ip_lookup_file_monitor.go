@@ -2,53 +2,131 @@ package traefik_geoblock
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"log/slog"
 )
 
 // IpLookupFileMonitor is a simple wrapper that reads IP blocks from a directory once
 type IpLookupFileMonitor struct {
-	helper *IpLookupHelper
-	logger *slog.Logger
+	helper    *IpLookupHelper
+	logger    *slog.Logger
+	collapsed int // Blocks removed by aggregation
+}
+
+const (
+	// ipBlockChunkSize is how many parsed blocks a file parser hands over at once
+	ipBlockChunkSize = 4096
+	// defaultIPBlockProgressEvery is how many loaded blocks separate two progress log lines
+	defaultIPBlockProgressEvery = 250000
+)
+
+// ipBlockLoadOptions tunes how block directories are loaded
+type ipBlockLoadOptions struct {
+	maxRules      int  // Maximum number of blocks in the monitor, static ones included (0 for no limit)
+	workers       int  // Files parsed in parallel (0 for one per CPU)
+	progressEvery int  // Blocks between progress log lines (0 for the default)
+	aggregate     bool // Merge contained and adjacent blocks before building the tree
+	strict        bool // Fail on a missing directory or an unreadable file instead of skipping it
+	allowList     bool // nginx and Apache files contribute their allow directives instead of their deny ones
+
+	memoryBudget *memoryBudget // Estimated memory shared with the other trees, nil for no limit
 }
 
 // NewIpLookupFileMonitor creates a new IP lookup monitor by reading all .txt files in the directory once
 func NewIpLookupFileMonitor(cidrBlocks []string, directoryPath string, logger *slog.Logger) (*IpLookupFileMonitor, error) {
-	// Create empty helper and insert CIDRs directly to save memory
+	return newIpLookupFileMonitorWithOptions(cidrBlocks, directoryPath, ipBlockLoadOptions{}, logger)
+}
+
+// newIpLookupFileMonitorWithOptions is NewIpLookupFileMonitor with a rule limit and loader tuning
+func newIpLookupFileMonitorWithOptions(cidrBlocks []string, directoryPath string, options ipBlockLoadOptions, logger *slog.Logger) (*IpLookupFileMonitor, error) {
+	if options.maxRules > 0 && len(cidrBlocks) > options.maxRules {
+		return nil, fmt.Errorf("%d static IP blocks exceed MaxIPBlockRules (%d)", len(cidrBlocks), options.maxRules)
+	}
+
+	// Create empty helper and insert CIDRs directly to save memory. When aggregating,
+	// blocks are collected first and the tree is built from the merged list.
 	helper := NewEmptyIpLookupHelper()
+	var collected []*net.IPNet
+	insert := helper.addSourcedBlock
+	if options.aggregate {
+		// Merged blocks have no single source
+		insert = func(block *net.IPNet, _ *RuleSource) { collected = append(collected, block) }
+	}
+
+	// Every block is charged to its file, static ones to the setting listing them
+	staticSource := "BlockedIPBlocks"
+	if options.allowList {
+		staticSource = "AllowedIPBlocks"
+	}
+	memoryBytes := func() int64 { return helper.MemoryBytes() + int64(len(collected))*collectedBlockBytes }
+	add := func(block *net.IPNet, source *RuleSource) error {
+		if options.memoryBudget == nil {
+			insert(block, source)
+			return nil
+		}
+		before := memoryBytes()
+		insert(block, source)
+		name := source.File
+		if name == "static" {
+			name = staticSource
+		}
+		return options.memoryBudget.charge(name, memoryBytes()-before)
+	}
 
 	// Add static blocks first
-	for _, cidr := range cidrBlocks {
-		if err := helper.AddCIDR(cidr); err != nil {
-			return nil, fmt.Errorf("failed to add static CIDR block %q: %w", cidr, err)
+	for i, cidr := range cidrBlocks {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add static CIDR block: %w", &ErrInvalidCIDR{Value: cidr, Err: err})
+		}
+		if err := add(block, &RuleSource{File: "static", Line: i + 1}); err != nil {
+			return nil, err
 		}
 	}
-	staticCount := helper.Count()
+	staticCount := len(cidrBlocks)
+	directoryCount := 0
 
 	// Add blocks from directory if specified
 	if directoryPath != "" {
-		directoryBlocks, err := insertBlocksFromDirectory(helper, directoryPath, logger)
+		directoryBlocks, err := insertBlocksFromDirectory(add, staticCount, directoryPath, options, logger)
 		if err != nil {
-			if os.IsNotExist(err) {
+			if os.IsNotExist(err) && !options.strict {
 				logger.Debug("IP blocks directory does not exist, using only static blocks", "directory", directoryPath)
 			} else {
 				return nil, fmt.Errorf("failed to read blocks from directory %s: %w", directoryPath, err)
 			}
 		} else {
 			logger.Debug("loaded IP blocks from directory", "directory", directoryPath, "blocks", directoryBlocks)
+			directoryCount = directoryBlocks
 		}
 	}
 
-	logger.Debug("loaded IP blocks", "total_count", helper.Count(), "static_count", staticCount, "directory_count", helper.Count()-staticCount)
+	collapsed := 0
+	if options.aggregate {
+		for _, block := range aggregateCIDRs(collected) {
+			helper.addBlock(block)
+		}
+		collapsed = len(collected) - helper.Count()
+		if len(collected) > 0 {
+			logger.Info("aggregated IP blocks", "directory", directoryPath, "before", len(collected), "after", helper.Count(), "collapsed", collapsed)
+		}
+	}
+
+	logger.Debug("loaded IP blocks", "total_count", helper.Count(), "static_count", staticCount, "directory_count", directoryCount)
 
 	return &IpLookupFileMonitor{
-		helper: helper,
-		logger: logger,
+		helper:    helper,
+		logger:    logger,
+		collapsed: collapsed,
 	}, nil
 }
 
@@ -57,65 +135,199 @@ func (m *IpLookupFileMonitor) IsContained(ipAddr net.IP) (bool, int, error) {
 	return m.helper.IsContained(ipAddr)
 }
 
-// insertBlocksFromDirectory reads CIDR blocks from all .txt files in the directory and inserts them into the helper
-func insertBlocksFromDirectory(helper *IpLookupHelper, directoryPath string, logger *slog.Logger) (int, error) {
+// Count returns the number of blocks in the lookup tree, after aggregation
+func (m *IpLookupFileMonitor) Count() int {
+	return m.helper.Count()
+}
+
+// MemoryBytes estimates the memory used by the lookup tree, for MemoryBudgetMB
+func (m *IpLookupFileMonitor) MemoryBytes() int64 {
+	return m.helper.MemoryBytes()
+}
+
+// Collapsed returns how many blocks were removed by aggregation
+func (m *IpLookupFileMonitor) Collapsed() int {
+	return m.collapsed
+}
+
+// HitCounts returns how often each CIDR block matched, most hits first
+func (m *IpLookupFileMonitor) HitCounts() []CIDRHits {
+	return m.helper.HitCounts()
+}
+
+// Match returns the most specific CIDR block containing the IP and where it was configured.
+// The source is nil for blocks merged by aggregation.
+func (m *IpLookupFileMonitor) Match(ipAddr net.IP) (string, *RuleSource, bool) {
+	return m.helper.Match(ipAddr)
+}
+
+// insertBlocksFromDirectory reads CIDR blocks from all .txt and .txt.gz files in the directory and passes them to add.
+// Files are parsed in parallel and streamed in chunks, but added in walk order because the tree is not
+// safe for concurrent writes. loadedBefore counts the blocks already added, for the rule limit.
+func insertBlocksFromDirectory(add func(block *net.IPNet, source *RuleSource) error, loadedBefore int, directoryPath string, options ipBlockLoadOptions, logger *slog.Logger) (int, error) {
 	if _, err := os.Stat(directoryPath); err != nil {
 		return 0, err
 	}
 
-	// Track count before adding directory blocks
-	countBefore := helper.Count()
+	files, err := listBlockFiles(directoryPath, options.strict, logger)
+	if err != nil {
+		return 0, err
+	}
 
-	err := filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			logger.Warn("error accessing file during directory scan", "file", path, "error", err)
-			return nil // Continue with other files
+	workers := options.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	progressEvery := options.progressEvery
+	if progressEvery <= 0 {
+		progressEvery = defaultIPBlockProgressEvery
+	}
+
+	// Closing done stops the parsers when loading is aborted
+	done := make(chan struct{})
+	defer close(done)
+
+	// Parsers are started in file order, so the stream being inserted always has a running parser
+	streams := make(chan *blockFileStream, len(files))
+	go func() {
+		slots := make(chan struct{}, workers)
+		for _, path := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				close(streams)
+				return
+			}
+			stream := &blockFileStream{path: path, chunks: make(chan []sourcedBlock, 2)}
+			streams <- stream
+			go func() {
+				defer func() { <-slots }()
+				stream.err = streamBlocksFromFile(stream.path, options.allowList, stream.chunks, done, logger)
+				close(stream.chunks)
+			}()
 		}
+		close(streams)
+	}()
 
-		// Skip directories and non-.txt files
-		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".txt") {
-			return nil
+	start := time.Now()
+	loaded := 0
+	filesDone := 0
+	nextProgress := progressEvery
+	for stream := range streams {
+		added := 0
+		for chunk := range stream.chunks {
+			for _, block := range chunk {
+				if options.maxRules > 0 && loadedBefore+loaded >= options.maxRules {
+					return 0, fmt.Errorf("more than %d IP block rules (MaxIPBlockRules) while loading %s", options.maxRules, stream.path)
+				}
+				if err := add(block.block, block.source); err != nil {
+					return 0, err
+				}
+				added++
+				loaded++
+			}
+			if loaded >= nextProgress {
+				logger.Info("loading IP blocks", "directory", directoryPath, "loaded", loaded, "files_done", filesDone, "files_total", len(files), "elapsed", time.Since(start).String())
+				nextProgress = loaded + progressEvery
+			}
+		}
+		filesDone++
+
+		// err is written before the chunks channel is closed
+		if stream.err != nil {
+			if options.strict {
+				return 0, fmt.Errorf("failed to read blocks from %s: %w", stream.path, stream.err)
+			}
+			logger.Warn("failed to read blocks from file", "file", stream.path, "loaded", added, "error", stream.err)
+			continue
 		}
+		logger.Debug("loaded blocks from file", "file", stream.path, "blocks", added)
+	}
+
+	return loaded, nil
+}
+
+// blockFileStream carries the parsed blocks of one file from its parser to the inserter
+type blockFileStream struct {
+	path   string
+	chunks chan []sourcedBlock
+	err    error
+}
+
+// sourcedBlock is a parsed block with the file and line it came from
+type sourcedBlock struct {
+	block  *net.IPNet
+	source *RuleSource
+}
 
-		// Read blocks from this file
-		blocks, err := readBlocksFromFile(path, logger)
+// listBlockFiles returns the .txt, .conf and .txt.gz/.conf.gz files below the directory in walk order.
+// In strict mode, inaccessible entries and unsupported .txt.zst files are errors.
+func listBlockFiles(directoryPath string, strict bool, logger *slog.Logger) ([]string, error) {
+	var files []string
+	err := filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			logger.Warn("failed to read blocks from file", "file", path, "error", err)
+			if strict {
+				return err
+			}
+			logger.Warn("error accessing file during directory scan", "file", path, "error", err)
 			return nil // Continue with other files
 		}
 
-		successfullyAdded := 0
-		for _, cidr := range blocks {
-			if err := helper.AddCIDR(cidr); err != nil {
-				logger.Warn("failed to add CIDR block", "cidr", cidr, "error", err)
-			} else {
-				successfullyAdded++
+		if info.IsDir() {
+			return nil
+		}
+		fileName := strings.ToLower(info.Name())
+		switch {
+		case strings.HasSuffix(fileName, ".txt"), strings.HasSuffix(fileName, ".txt.gz"),
+			strings.HasSuffix(fileName, ".conf"), strings.HasSuffix(fileName, ".conf.gz"):
+			files = append(files, path)
+		case strings.HasSuffix(fileName, ".txt.zst"):
+			// No zstd decoder in the standard library, and plugins cannot pull in third party code
+			if strict {
+				return fmt.Errorf("zstd compressed block file %s is not supported, recompress with gzip", path)
 			}
+			logger.Warn("zstd compressed block files are not supported, recompress with gzip", "file", path)
 		}
-
-		logger.Debug("loaded blocks from file", "file", path, "attempted", len(blocks), "successful", successfullyAdded)
 		return nil
 	})
-
-	if err != nil {
-		return 0, err
-	}
-
-	// Return the actual number of blocks added (helper knows the truth)
-	return helper.Count() - countBefore, nil
+	return files, err
 }
 
-// readBlocksFromFile reads CIDR blocks from a single file, one per line
-func readBlocksFromFile(filePath string, logger *slog.Logger) ([]string, error) {
+// streamBlocksFromFile parses CIDR blocks from a single file, one per line, and sends them in chunks.
+// Text after '#' or ';' on a CIDR line is kept as the comment of the rule (Spamhaus DROP uses ';').
+// nginx and Apache access rules are detected from the first rule line and read as they are, see serverDirectiveAddresses.
+// Files ending in .gz are decompressed on the fly.
+// Returns early without error when done is closed.
+func streamBlocksFromFile(filePath string, allowList bool, chunks chan<- []sourcedBlock, done <-chan struct{}, logger *slog.Logger) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer file.Close()
 
-	var blocks []string
-	scanner := bufio.NewScanner(file)
+	var reader io.Reader = file
+	if strings.HasSuffix(strings.ToLower(filePath), ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("error opening gzip stream: %w", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	send := func(chunk []sourcedBlock) bool {
+		select {
+		case chunks <- chunk:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	chunk := make([]sourcedBlock, 0, ipBlockChunkSize)
+	scanner := bufio.NewScanner(reader)
 	lineNum := 0
+	format := ""
 
 	for scanner.Scan() {
 		lineNum++
@@ -126,19 +338,57 @@ func readBlocksFromFile(filePath string, logger *slog.Logger) ([]string, error)
 			continue
 		}
 
-		// Validate CIDR format
-		_, _, err := net.ParseCIDR(line)
-		if err != nil {
-			logger.Warn("invalid CIDR block in file", "file", filePath, "line", lineNum, "cidr", line, "error", err)
-			continue
+		if format == "" {
+			format = detectBlockFileFormat(line)
+			if format != blockFileFormatPlain {
+				logger.Debug("reading server access rules", "file", filePath, "format", format)
+			}
 		}
 
-		blocks = append(blocks, line)
+		var blocks []*net.IPNet
+		var comment string
+		if format == blockFileFormatPlain {
+			cidr := line
+			if i := strings.IndexAny(line, "#;"); i >= 0 {
+				cidr, comment = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+			}
+
+			// Validate CIDR format
+			_, block, err := net.ParseCIDR(cidr)
+			if err != nil {
+				logger.Warn("invalid CIDR block in file", "file", filePath, "line", lineNum, "cidr", cidr, "error", err)
+				continue
+			}
+			blocks = append(blocks, block)
+		} else {
+			var addresses []string
+			addresses, comment = serverDirectiveAddresses(format, line, allowList)
+			for _, address := range addresses {
+				block, err := parseServerAddress(address)
+				if err != nil {
+					logger.Warn("invalid address in server access rule", "file", filePath, "line", lineNum, "address", address, "error", err)
+					continue
+				}
+				blocks = append(blocks, block)
+			}
+		}
+
+		for _, block := range blocks {
+			chunk = append(chunk, sourcedBlock{block: block, source: &RuleSource{File: filePath, Line: lineNum, Comment: comment}})
+			if len(chunk) == ipBlockChunkSize {
+				if !send(chunk) {
+					return nil
+				}
+				chunk = make([]sourcedBlock, 0, ipBlockChunkSize)
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %w", err)
+		return fmt.Errorf("error reading file: %w", err)
 	}
-
-	return blocks, nil
+	if len(chunk) > 0 {
+		send(chunk)
+	}
+	return nil
 }
@@ -1,6 +1,8 @@
 package traefik_geoblock
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"net"
@@ -398,3 +400,258 @@ func writeBlocksFile(t *testing.T, filename string, blocks []string) {
 		t.Fatalf("Failed to write blocks file %s: %v", filename, err)
 	}
 }
+
+// TestIpLookupFileMonitor_LargeDirectory checks parallel loading keeps every block and enforces the rule limit
+func TestIpLookupFileMonitor_LargeDirectory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	tempDir := t.TempDir()
+
+	// 8 files of 5000 /32s each, larger than one chunk
+	for f := 0; f < 8; f++ {
+		blocks := make([]string, 0, 5000)
+		for i := 0; i < 5000; i++ {
+			blocks = append(blocks, fmt.Sprintf("10.%d.%d.%d/32", f, i/256, i%256))
+		}
+		writeBlocksFile(t, filepath.Join(tempDir, fmt.Sprintf("feed%d.txt", f)), blocks)
+	}
+
+	t.Run("ParallelLoad", func(t *testing.T) {
+		monitor, err := newIpLookupFileMonitorWithOptions([]string{"192.168.0.0/16"}, tempDir, ipBlockLoadOptions{workers: 3, progressEvery: 1000}, logger)
+		if err != nil {
+			t.Fatalf("Failed to create monitor: %v", err)
+		}
+		if count := monitor.helper.Count(); count != 40001 {
+			t.Errorf("Expected 40001 blocks, got %d", count)
+		}
+		for _, ip := range []string{"10.0.0.0", "10.7.19.135", "192.168.1.1"} {
+			if contained, _, _ := monitor.IsContained(net.ParseIP(ip)); !contained {
+				t.Errorf("Expected %s to be contained", ip)
+			}
+		}
+		if contained, _, _ := monitor.IsContained(net.ParseIP("10.8.0.0")); contained {
+			t.Errorf("Expected 10.8.0.0 to not be contained")
+		}
+	})
+
+	t.Run("MaxRulesExceeded", func(t *testing.T) {
+		_, err := newIpLookupFileMonitorWithOptions(nil, tempDir, ipBlockLoadOptions{maxRules: 12000, workers: 2}, logger)
+		if err == nil || !strings.Contains(err.Error(), "MaxIPBlockRules") {
+			t.Errorf("Expected MaxIPBlockRules error, got %v", err)
+		}
+	})
+
+	t.Run("MaxRulesExact", func(t *testing.T) {
+		if _, err := newIpLookupFileMonitorWithOptions(nil, tempDir, ipBlockLoadOptions{maxRules: 40000}, logger); err != nil {
+			t.Errorf("Expected limit equal to the block count to load, got %v", err)
+		}
+	})
+
+	t.Run("StaticBlocksExceed", func(t *testing.T) {
+		_, err := newIpLookupFileMonitorWithOptions([]string{"1.1.1.1/32", "2.2.2.2/32"}, "", ipBlockLoadOptions{maxRules: 1}, logger)
+		if err == nil {
+			t.Errorf("Expected error when static blocks exceed the limit")
+		}
+	})
+}
+
+// TestIpLookupFileMonitor_CompressedFiles checks .txt.gz files are decompressed and .txt.zst files are skipped
+func TestIpLookupFileMonitor_CompressedFiles(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	tempDir := t.TempDir()
+
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	fmt.Fprint(gzipWriter, "# threat feed\n203.0.113.0/24\n2001:db8::/32\n")
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("Failed to compress feed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "feed.TXT.GZ"), compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write feed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "other.txt.zst"), []byte("198.51.100.0/24\n"), 0644); err != nil {
+		t.Fatalf("Failed to write feed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "broken.txt.gz"), []byte("not gzip"), 0644); err != nil {
+		t.Fatalf("Failed to write feed: %v", err)
+	}
+
+	monitor, err := NewIpLookupFileMonitor(nil, tempDir, logger)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	if count := monitor.helper.Count(); count != 2 {
+		t.Errorf("Expected 2 blocks, got %d", count)
+	}
+	for _, ip := range []string{"203.0.113.7", "2001:db8::1"} {
+		if contained, _, _ := monitor.IsContained(net.ParseIP(ip)); !contained {
+			t.Errorf("Expected %s to be contained", ip)
+		}
+	}
+	if contained, _, _ := monitor.IsContained(net.ParseIP("198.51.100.1")); contained {
+		t.Errorf("Expected blocks from the zstd file to be skipped")
+	}
+}
+
+// TestIpLookupFileMonitor_StrictFiles checks strict mode turns skipped directories and files into errors
+func TestIpLookupFileMonitor_StrictFiles(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	strict := ipBlockLoadOptions{strict: true}
+
+	t.Run("MissingDirectory", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing")
+		if _, err := newIpLookupFileMonitorWithOptions(nil, missing, ipBlockLoadOptions{}, logger); err != nil {
+			t.Errorf("Expected a missing directory to be ignored, got %v", err)
+		}
+		if _, err := newIpLookupFileMonitorWithOptions(nil, missing, strict, logger); err == nil {
+			t.Errorf("Expected a missing directory to fail in strict mode")
+		}
+	})
+
+	t.Run("BrokenFile", func(t *testing.T) {
+		tempDir := t.TempDir()
+		writeBlocksFile(t, filepath.Join(tempDir, "good.txt"), []string{"203.0.113.0/24"})
+		if err := os.WriteFile(filepath.Join(tempDir, "broken.txt.gz"), []byte("not gzip"), 0644); err != nil {
+			t.Fatalf("Failed to write feed: %v", err)
+		}
+		_, err := newIpLookupFileMonitorWithOptions(nil, tempDir, strict, logger)
+		if err == nil || !strings.Contains(err.Error(), "broken.txt.gz") {
+			t.Errorf("Expected an error naming the broken file, got %v", err)
+		}
+	})
+
+	t.Run("ZstdFile", func(t *testing.T) {
+		tempDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(tempDir, "feed.txt.zst"), []byte("198.51.100.0/24\n"), 0644); err != nil {
+			t.Fatalf("Failed to write feed: %v", err)
+		}
+		if _, err := newIpLookupFileMonitorWithOptions(nil, tempDir, strict, logger); err == nil {
+			t.Errorf("Expected a zstd file to fail in strict mode")
+		}
+	})
+}
+
+func TestIpLookupFileMonitor_RuleSources(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	tempDir := t.TempDir()
+	blockFile := filepath.Join(tempDir, "drop.txt")
+	writeBlocksFile(t, blockFile, []string{
+		"# Spamhaus DROP",
+		"203.0.113.0/24 ; SBL123",
+		"198.51.100.0/24 # scanner farm",
+		"192.0.2.0/24",
+	})
+
+	monitor, err := NewIpLookupFileMonitor([]string{"10.0.0.0/8"}, tempDir, logger)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		cidr string
+		want RuleSource
+	}{
+		{"203.0.113.7", "203.0.113.0/24", RuleSource{File: blockFile, Line: 2, Comment: "SBL123"}},
+		{"198.51.100.7", "198.51.100.0/24", RuleSource{File: blockFile, Line: 3, Comment: "scanner farm"}},
+		{"192.0.2.7", "192.0.2.0/24", RuleSource{File: blockFile, Line: 4}},
+		{"10.1.2.3", "10.0.0.0/8", RuleSource{File: "static", Line: 1}},
+	}
+	for _, tt := range tests {
+		cidr, source, ok := monitor.Match(net.ParseIP(tt.ip))
+		if !ok || cidr != tt.cidr || source == nil || *source != tt.want {
+			t.Errorf("%s: expected %s from %v, got %s from %v", tt.ip, tt.cidr, tt.want, cidr, source)
+		}
+	}
+	if _, _, ok := monitor.Match(net.ParseIP("8.8.8.8")); ok {
+		t.Error("expected no match outside the blocks")
+	}
+	for _, hits := range monitor.HitCounts() {
+		if hits.Hits != 0 {
+			t.Errorf("expected Match not to count hits, got %v", hits)
+		}
+	}
+}
+
+func TestIpLookupFileMonitor_ServerFormats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	tempDir := t.TempDir()
+	writeBlocksFile(t, filepath.Join(tempDir, "nginx-deny.conf"), []string{
+		"# Blocked by the old nginx config",
+		"deny 203.0.113.0/24; # scrapers",
+		"deny 198.51.100.7; deny 2001:db8::/32;",
+		"allow 192.0.2.1;",
+		"deny all;",
+	})
+	writeBlocksFile(t, filepath.Join(tempDir, "apache.txt"), []string{
+		"<RequireAll>",
+		"    Require all granted",
+		"    Require not ip 100.64.0.0/10 172.16 bad-address",
+		"    Require ip 192.0.2.2",
+		"</RequireAll>",
+		"Deny from 192.168.50.1",
+	})
+
+	tests := []struct {
+		ip        string
+		allowList bool
+		want      bool
+	}{
+		{"203.0.113.9", false, true},
+		{"198.51.100.7", false, true},
+		{"198.51.100.8", false, false},
+		{"2001:db8::1", false, true},
+		{"192.0.2.1", false, false},
+		{"100.64.1.1", false, true},
+		{"172.16.200.1", false, true},
+		{"172.17.0.1", false, false},
+		{"192.168.50.1", false, true},
+		{"192.0.2.2", false, false},
+		{"192.0.2.1", true, true},
+		{"192.0.2.2", true, true},
+		{"203.0.113.9", true, false},
+	}
+	for _, tt := range tests {
+		monitor, err := newIpLookupFileMonitorWithOptions(nil, tempDir, ipBlockLoadOptions{allowList: tt.allowList}, logger)
+		if err != nil {
+			t.Fatalf("Failed to create monitor: %v", err)
+		}
+		if contained, _, _ := monitor.IsContained(net.ParseIP(tt.ip)); contained != tt.want {
+			t.Errorf("%s (allow list %v): expected contained=%v", tt.ip, tt.allowList, tt.want)
+		}
+	}
+
+	monitor, err := NewIpLookupFileMonitor(nil, tempDir, logger)
+	if err != nil {
+		t.Fatalf("Failed to create monitor: %v", err)
+	}
+	_, source, ok := monitor.Match(net.ParseIP("203.0.113.9"))
+	if !ok || source == nil || source.Line != 2 || source.Comment != "scrapers" {
+		t.Errorf("expected the nginx line and comment as the source, got %v", source)
+	}
+}
+
+func TestParseServerAddress(t *testing.T) {
+	for address, want := range map[string]string{
+		"10":            "10.0.0.0/8",
+		"10.1":          "10.1.0.0/16",
+		"10.1.2.":       "10.1.2.0/24",
+		"10.1.2.3":      "10.1.2.3/32",
+		"10.1.2.0/24":   "10.1.2.0/24",
+		"2001:db8::1":   "2001:db8::1/128",
+		"2001:db8::/32": "2001:db8::/32",
+		"10.1.2.3.4":    "",
+		"example.com":   "",
+		"10.300":        "",
+		"10.1.2.0/33":   "",
+		"":              "",
+	} {
+		block, err := parseServerAddress(address)
+		got := ""
+		if err == nil {
+			got = block.String()
+		}
+		if got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", address, want, got, err)
+		}
+	}
+}
@@ -3,30 +3,54 @@ package traefik_geoblock
 import (
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
+	"sync/atomic"
 )
 
+// RuleSource tells where an IP block rule was configured
+type RuleSource struct {
+	File    string `json:"file"`              // Block file, or "static" for AllowedIPBlocks/BlockedIPBlocks
+	Line    int    `json:"line"`              // Line in the file, or position in the static list (1-based)
+	Comment string `json:"comment,omitempty"` // Inline comment after the CIDR
+}
+
+// String formats the source as "file:line (comment)"
+func (s RuleSource) String() string {
+	source := s.File + ":" + strconv.Itoa(s.Line)
+	if s.Comment != "" {
+		source += " (" + s.Comment + ")"
+	}
+	return source
+}
+
 // radixNode represents a node in the IP radix tree
 type radixNode struct {
-	isEndpoint bool       // true if this node represents the end of a CIDR block
-	prefixLen  int        // the prefix length of the CIDR block (if isEndpoint is true)
-	left       *radixNode // for bit 0
-	right      *radixNode // for bit 1
+	isEndpoint bool        // true if this node represents the end of a CIDR block
+	prefixLen  int         // the prefix length of the CIDR block (if isEndpoint is true)
+	cidr       string      // the CIDR block as inserted (if isEndpoint is true)
+	hits       int64       // number of lookups where this block was the longest match, updated atomically
+	source     *RuleSource // where the block was configured, nil when unknown (aggregated blocks)
+	left       *radixNode  // for bit 0
+	right      *radixNode  // for bit 1
 }
 
 // ipRadixTree provides fast O(log k) IP block lookups where k is the IP bit length (32 for IPv4, 128 for IPv6)
 type ipRadixTree struct {
-	root *radixNode
+	root  *radixNode
+	nodes int // Nodes in the tree, the root included
 }
 
 // newIPRadixTree creates a new empty radix tree
 func newIPRadixTree() *ipRadixTree {
 	return &ipRadixTree{
-		root: &radixNode{},
+		root:  &radixNode{},
+		nodes: 1,
 	}
 }
 
-// insert adds a CIDR block to the radix tree
-func (tree *ipRadixTree) insert(cidr *net.IPNet) {
+// insert adds a CIDR block to the radix tree and returns its node
+func (tree *ipRadixTree) insert(cidr *net.IPNet) *radixNode {
 	ip := cidr.IP
 	prefixLen, _ := cidr.Mask.Size()
 
@@ -60,11 +84,13 @@ func (tree *ipRadixTree) insert(cidr *net.IPNet) {
 		if bit == 0 {
 			if current.left == nil {
 				current.left = &radixNode{}
+				tree.nodes++
 			}
 			current = current.left
 		} else {
 			if current.right == nil {
 				current.right = &radixNode{}
+				tree.nodes++
 			}
 			current = current.right
 		}
@@ -73,12 +99,24 @@ func (tree *ipRadixTree) insert(cidr *net.IPNet) {
 	// Mark this node as an endpoint with the prefix length
 	current.isEndpoint = true
 	current.prefixLen = prefixLen
+	current.cidr = cidr.String()
+	return current
 }
 
 // contains checks if an IP address is contained in any of the CIDR blocks in the tree
 // Returns (found, prefixLength) where found indicates if a match was found
 // and prefixLength is the length of the matching CIDR block (for priority calculation)
 func (tree *ipRadixTree) contains(ip net.IP) (bool, int) {
+	match := tree.longestMatch(ip)
+	if match == nil {
+		return false, 0
+	}
+	atomic.AddInt64(&match.hits, 1)
+	return true, match.prefixLen
+}
+
+// longestMatch returns the node of the most specific CIDR block containing the IP, nil when none does
+func (tree *ipRadixTree) longestMatch(ip net.IP) *radixNode {
 	// Determine if this is IPv4 or IPv6
 	isIPv4 := ip.To4() != nil
 	var bitStart, maxPrefixLen int
@@ -95,15 +133,13 @@ func (tree *ipRadixTree) contains(ip net.IP) (bool, int) {
 	}
 
 	current := tree.root
-	longestMatch := 0
-	found := false
+	var match *radixNode
 
 	// Walk through each bit of the IP
 	for i := 0; i < maxPrefixLen && current != nil; i++ {
 		// Check if current node is an endpoint (represents a CIDR block)
 		if current.isEndpoint {
-			found = true
-			longestMatch = current.prefixLen
+			match = current
 			// Continue walking to find longest match (most specific CIDR)
 		}
 
@@ -125,11 +161,28 @@ func (tree *ipRadixTree) contains(ip net.IP) (bool, int) {
 
 	// Check final node
 	if current != nil && current.isEndpoint {
-		found = true
-		longestMatch = current.prefixLen
+		match = current
 	}
 
-	return found, longestMatch
+	return match
+}
+
+// walk calls fn for every CIDR block in the tree
+func (tree *ipRadixTree) walk(fn func(node *radixNode)) {
+	stack := []*radixNode{tree.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node.isEndpoint {
+			fn(node)
+		}
+		if node.right != nil {
+			stack = append(stack, node.right)
+		}
+		if node.left != nil {
+			stack = append(stack, node.left)
+		}
+	}
 }
 
 // IpLookupHelper provides fast IP block lookups using radix trees
@@ -150,18 +203,36 @@ func NewEmptyIpLookupHelper() *IpLookupHelper {
 func (helper *IpLookupHelper) AddCIDR(cidr string) error {
 	_, block, err := net.ParseCIDR(cidr)
 	if err != nil {
-		return fmt.Errorf("parse error on CIDR %q: %v", cidr, err)
+		return &ErrInvalidCIDR{Value: cidr, Err: err}
 	}
-	helper.tree.insert(block)
-	helper.count++
+	helper.addBlock(block)
 	return nil
 }
 
+// addBlock adds an already parsed CIDR block to the helper
+func (helper *IpLookupHelper) addBlock(block *net.IPNet) {
+	helper.addSourcedBlock(block, nil)
+}
+
+// addSourcedBlock adds a CIDR block with its source. A block listed twice keeps its first source.
+func (helper *IpLookupHelper) addSourcedBlock(block *net.IPNet, source *RuleSource) {
+	node := helper.tree.insert(block)
+	if node.source == nil {
+		node.source = source
+	}
+	helper.count++
+}
+
 // Count returns the number of CIDR blocks stored in the helper
 func (helper *IpLookupHelper) Count() int {
 	return helper.count
 }
 
+// MemoryBytes estimates the memory used by the tree, for MemoryBudgetMB
+func (helper *IpLookupHelper) MemoryBytes() int64 {
+	return int64(helper.tree.nodes)*radixNodeBytes + int64(helper.count)*radixEndpointBytes
+}
+
 // NewIpLookupHelper creates a new IP lookup helper with the given CIDR block list
 func NewIpLookupHelper(cidrBlocks []string) (*IpLookupHelper, error) {
 	helper := NewEmptyIpLookupHelper()
@@ -176,6 +247,27 @@ func NewIpLookupHelper(cidrBlocks []string) (*IpLookupHelper, error) {
 	return helper, nil
 }
 
+// CIDRHits is the number of lookups a CIDR block matched (as the most specific block)
+type CIDRHits struct {
+	CIDR string `json:"cidr"`
+	Hits int64  `json:"hits"`
+}
+
+// HitCounts returns the hit counter of every CIDR block, most hits first, including blocks that never matched
+func (helper *IpLookupHelper) HitCounts() []CIDRHits {
+	counts := make([]CIDRHits, 0, helper.count)
+	helper.tree.walk(func(node *radixNode) {
+		counts = append(counts, CIDRHits{CIDR: node.cidr, Hits: atomic.LoadInt64(&node.hits)})
+	})
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Hits != counts[j].Hits {
+			return counts[i].Hits > counts[j].Hits
+		}
+		return counts[i].CIDR < counts[j].CIDR
+	})
+	return counts
+}
+
 // IsContained checks if an IP is contained in any of the CIDR blocks
 // Returns (isContained, prefixLength, error)
 func (helper *IpLookupHelper) IsContained(ipAddr net.IP) (bool, int, error) {
@@ -185,3 +277,15 @@ func (helper *IpLookupHelper) IsContained(ipAddr net.IP) (bool, int, error) {
 	found, prefixLen := helper.tree.contains(ipAddr)
 	return found, prefixLen, nil
 }
+
+// Match returns the most specific CIDR block containing the IP and its source, without counting a hit
+func (helper *IpLookupHelper) Match(ipAddr net.IP) (string, *RuleSource, bool) {
+	if ipAddr == nil {
+		return "", nil, false
+	}
+	node := helper.tree.longestMatch(ipAddr)
+	if node == nil {
+		return "", nil, false
+	}
+	return node.cidr, node.source, true
+}
@@ -0,0 +1,369 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseLoadShed is used when a request is answered with a 503 because its country is being shed
+const PhaseLoadShed = "load_shed"
+
+// LoadShed is a country shed until Expires, as stored in the load shed file
+type LoadShed struct {
+	Country string    `json:"country"`
+	Expires time.Time `json:"expires"`
+}
+
+// loadShedder holds the countries shed during an incident. Every entry expires, so a forgotten shed
+// doesn't turn into a permanent block.
+type loadShedder struct {
+	file     string // Empty keeps the entries in memory only
+	interval time.Duration
+	reloadMu sync.Mutex // Serializes reloads of the watcher and writes of the admin API
+
+	mu      sync.RWMutex
+	sheds   map[string]time.Time // Country code -> expiry
+	maxTTL  time.Duration        // Longest shed accepted by add, from the latest configuration
+	modTime time.Time
+	size    int64
+	logger  *slog.Logger
+}
+
+var (
+	// loadShedders shares one shed list (and one watcher) per file between plugin instances
+	loadShedders      = make(map[string]*loadShedder)
+	loadSheddersMutex sync.Mutex
+)
+
+// getLoadShedder returns the shed list for LoadShedFile, loading it and starting its watcher on first use.
+// Without a file every plugin instance gets its own in-memory list.
+func getLoadShedder(cfg *Config, logger *slog.Logger) (*loadShedder, error) {
+	if cfg.LoadShedMaxSeconds < 0 {
+		return nil, fmt.Errorf("LoadShedMaxSeconds must not be negative, got %d", cfg.LoadShedMaxSeconds)
+	}
+	maxTTL := time.Duration(cfg.LoadShedMaxSeconds) * time.Second
+	if cfg.LoadShedFile == "" {
+		return newLoadShedder("", 0, maxTTL, logger), nil
+	}
+	if cfg.LoadShedIntervalSeconds <= 0 {
+		return nil, fmt.Errorf("LoadShedIntervalSeconds must be positive, got %d", cfg.LoadShedIntervalSeconds)
+	}
+
+	loadSheddersMutex.Lock()
+	defer loadSheddersMutex.Unlock()
+
+	if existing, ok := loadShedders[cfg.LoadShedFile]; ok {
+		existing.mu.Lock()
+		existing.maxTTL, existing.logger = maxTTL, logger
+		existing.mu.Unlock()
+		return existing, nil
+	}
+
+	shedder := newLoadShedder(cfg.LoadShedFile, time.Duration(cfg.LoadShedIntervalSeconds)*time.Second, maxTTL, logger)
+	if err := shedder.reload(); err != nil {
+		return nil, err
+	}
+	loadShedders[cfg.LoadShedFile] = shedder
+	go shedder.loop()
+	return shedder, nil
+}
+
+func newLoadShedder(file string, interval, maxTTL time.Duration, logger *slog.Logger) *loadShedder {
+	return &loadShedder{
+		file:     file,
+		interval: interval,
+		sheds:    make(map[string]time.Time),
+		maxTTL:   maxTTL,
+		logger:   logger,
+	}
+}
+
+// loop checks the file after every interval, so incident tooling can shed countries by writing it
+func (s *loadShedder) loop() {
+	for {
+		time.Sleep(s.interval)
+		if err := s.reload(); err != nil {
+			s.mu.RLock()
+			logger := s.logger
+			s.mu.RUnlock()
+			logger.Warn("failed to reload load shed file, keeping the previous entries", "file", s.file, "error", err)
+		}
+	}
+}
+
+// reload reads the file when it changed since the last read. A missing file sheds nothing,
+// expired and invalid lines are dropped.
+func (s *loadShedder) reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	info, err := os.Stat(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		s.mu.Lock()
+		s.sheds, s.modTime, s.size = make(map[string]time.Time), time.Time{}, 0
+		s.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat load shed file %s: %w", s.file, err)
+	}
+
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime) && info.Size() == s.size
+	logger := s.logger
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to open load shed file %s: %w", s.file, err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	sheds := make(map[string]time.Time)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		country, expiryValue, _ := strings.Cut(line, ",")
+		countries, err := shedCountries(country)
+		if err != nil {
+			logger.Warn("invalid entry in load shed file", "file", s.file, "line", lineNum, "error", err)
+			continue
+		}
+		expires, err := parseShedExpiry(expiryValue)
+		if err != nil {
+			logger.Warn("invalid expiry in load shed file", "file", s.file, "line", lineNum, "error", err)
+			continue
+		}
+		if !expires.After(now) {
+			continue
+		}
+		for _, code := range countries {
+			if expires.After(sheds[code]) {
+				sheds[code] = expires
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read load shed file %s: %w", s.file, err)
+	}
+
+	s.mu.Lock()
+	s.sheds, s.modTime, s.size = sheds, info.ModTime(), info.Size()
+	s.mu.Unlock()
+	logger.Info("load shed file loaded", "file", s.file, "countries", len(sheds))
+	return nil
+}
+
+// shedCountries returns the countries of an alpha-2 code, numeric code or group such as "EU"
+func shedCountries(value string) ([]string, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if members, isGroup := countryGroups[value]; isGroup {
+		return members, nil
+	}
+	code, err := countryCode(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid country %q: %w", value, err)
+	}
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return nil, fmt.Errorf("invalid country %q: expected an ISO 3166-1 code or a group", value)
+	}
+	return []string{code}, nil
+}
+
+// parseShedExpiry accepts RFC 3339 timestamps or unix seconds. Unlike bans, sheds can't be permanent.
+func parseShedExpiry(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("an expiry is required")
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// shedding returns how long the country is still shed, zero when it is not
+func (s *loadShedder) shedding(country string, now time.Time) time.Duration {
+	s.mu.RLock()
+	expires, ok := s.sheds[country]
+	s.mu.RUnlock()
+	if !ok || !expires.After(now) {
+		return 0
+	}
+	return expires.Sub(now)
+}
+
+// add sheds a country or group for ttl, which must be positive and at most LoadShedMaxSeconds (0 disables add)
+func (s *loadShedder) add(country string, ttl time.Duration) ([]LoadShed, error) {
+	countries, err := shedCountries(country)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	maxTTL := s.maxTTL
+	s.mu.RUnlock()
+	if maxTTL == 0 {
+		return nil, fmt.Errorf("shedding through the API is disabled, LoadShedMaxSeconds is 0")
+	}
+	if ttl <= 0 || ttl > maxTTL {
+		return nil, fmt.Errorf("shed duration must be between 1s and %s, got %s", maxTTL, ttl)
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	s.mu.Lock()
+	added := make([]LoadShed, 0, len(countries))
+	for _, code := range countries {
+		s.sheds[code] = expires
+		added = append(added, LoadShed{Country: code, Expires: expires})
+	}
+	s.purgeLocked()
+	err = s.persistLocked()
+	s.mu.Unlock()
+	return added, err
+}
+
+// remove lifts the shed of a country or group. Returns false when none of its countries was shed.
+func (s *loadShedder) remove(country string) (bool, error) {
+	countries, err := shedCountries(country)
+	if err != nil {
+		return false, err
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := false
+	for _, code := range countries {
+		if _, ok := s.sheds[code]; ok {
+			delete(s.sheds, code)
+			removed = true
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	s.purgeLocked()
+	return true, s.persistLocked()
+}
+
+// list returns the active sheds sorted by country
+func (s *loadShedder) list() []LoadShed {
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sheds := make([]LoadShed, 0, len(s.sheds))
+	for country, expires := range s.sheds {
+		if expires.After(now) {
+			sheds = append(sheds, LoadShed{Country: country, Expires: expires})
+		}
+	}
+	sort.Slice(sheds, func(i, j int) bool { return sheds[i].Country < sheds[j].Country })
+	return sheds
+}
+
+// purgeLocked drops expired sheds. Callers must hold the write lock.
+func (s *loadShedder) purgeLocked() {
+	now := time.Now()
+	for country, expires := range s.sheds {
+		if !expires.After(now) {
+			delete(s.sheds, country)
+		}
+	}
+}
+
+// persistLocked writes the active sheds to the file and remembers its state, so the watcher doesn't
+// read it back. Callers must hold the write lock and reloadMu.
+func (s *loadShedder) persistLocked() error {
+	if s.file == "" {
+		return nil
+	}
+
+	countries := make([]string, 0, len(s.sheds))
+	for country := range s.sheds {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	var content strings.Builder
+	content.WriteString("# country,expiry (RFC 3339 or unix seconds)\n")
+	for _, country := range countries {
+		content.WriteString(country)
+		content.WriteString(",")
+		content.WriteString(s.sheds[country].UTC().Format(time.RFC3339))
+		content.WriteString("\n")
+	}
+
+	if err := writeFileAtomic(s.file, []byte(content.String())); err != nil {
+		return fmt.Errorf("failed to persist load shed file %s: %w", s.file, err)
+	}
+	if info, err := os.Stat(s.file); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// serveLoadShed writes the 503, with Retry-After set to the time left until the shed expires
+func serveLoadShed(rw http.ResponseWriter, remaining time.Duration) {
+	seconds := int64((remaining + time.Second - 1) / time.Second)
+	rw.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// ShedCountry answers requests from a country (code or group like "EU") with 503 and Retry-After
+// for ttl, at most LoadShedMaxSeconds. With LoadShedFile the shed is persisted.
+func (p Plugin) ShedCountry(country string, ttl time.Duration) error {
+	if p.loadShedder == nil {
+		return fmt.Errorf("plugin is disabled")
+	}
+	sheds, err := p.loadShedder.add(country, ttl)
+	if err == nil {
+		p.logger.Info("country shed", "country", country, "countries", len(sheds), "expires", sheds[0].Expires)
+	}
+	return err
+}
+
+// UnshedCountry lifts a shed before it expires. Returns false when the country was not shed.
+func (p Plugin) UnshedCountry(country string) (bool, error) {
+	if p.loadShedder == nil {
+		return false, fmt.Errorf("plugin is disabled")
+	}
+	removed, err := p.loadShedder.remove(country)
+	if removed {
+		p.logger.Info("country shed lifted", "country", country)
+	}
+	return removed, err
+}
+
+// LoadSheds returns the countries currently shed
+func (p Plugin) LoadSheds() []LoadShed {
+	if p.loadShedder == nil {
+		return nil
+	}
+	return p.loadShedder.list()
+}
@@ -0,0 +1,187 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadShed(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US", "DE", "IE"}
+	cfg.AllowedIPBlocks = []string{"8.8.4.0/24"}
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Action"
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	if err := plugin.ShedCountry("US", 10*time.Minute); err != nil {
+		t.Fatalf("failed to shed: %v", err)
+	}
+	if err := plugin.ShedCountry("EU", time.Minute); err != nil {
+		t.Fatalf("failed to shed a group: %v", err)
+	}
+	for _, tt := range []struct {
+		country string
+		ttl     time.Duration
+	}{{"US", 0}, {"US", 2 * time.Hour}, {"XX1", time.Minute}, {"999", time.Minute}} {
+		if err := plugin.ShedCountry(tt.country, tt.ttl); err == nil {
+			t.Errorf("expected an error shedding %s for %s", tt.country, tt.ttl)
+		}
+	}
+
+	serve := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("8.8.8.8")
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("X-Geoblock-Action") != PhaseLoadShed {
+		t.Fatalf("expected a 503 with remediation %s, got %d and %q", PhaseLoadShed, rr.Code, rr.Header().Get("X-Geoblock-Action"))
+	}
+	if seconds, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || seconds < 590 || seconds > 600 {
+		t.Errorf("expected Retry-After close to 600, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr := serve("85.214.132.1"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a group member to be shed, got %d", rr.Code)
+	}
+	if rr := serve("8.8.4.4"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected allowed IP blocks not to be shed, got %d", rr.Code)
+	}
+	if rr := serve("1.1.1.1"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected blocked countries to keep the ban response, got %d", rr.Code)
+	}
+
+	if sheds := plugin.LoadSheds(); len(sheds) != 28 {
+		t.Errorf("expected US and the 27 EU members to be shed, got %d", len(sheds))
+	}
+	if removed, err := plugin.UnshedCountry("US"); err != nil || !removed {
+		t.Errorf("expected the shed to be lifted, got %v and %v", removed, err)
+	}
+	if removed, _ := plugin.UnshedCountry("US"); removed {
+		t.Error("expected nothing to lift the second time")
+	}
+	if rr := serve("8.8.8.8"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected the lifted country to pass, got %d", rr.Code)
+	}
+}
+
+func TestLoadShedFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "shed.txt")
+	inAnHour := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	content := "# comment\n" +
+		"US," + inAnHour + "\n" +
+		"276," + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "\n" + // DE
+		"AU," + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + "\n" +
+		"IE,\n" + // Expiry required
+		"garbage," + inAnHour + "\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write shed file: %v", err)
+	}
+
+	shedder := newLoadShedder(file, time.Hour, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := shedder.reload(); err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	now := time.Now()
+	for country, want := range map[string]bool{"US": true, "DE": true, "AU": false, "IE": false} {
+		if got := shedder.shedding(country, now) > 0; got != want {
+			t.Errorf("expected shedding=%v for %s, got %v", want, country, got)
+		}
+	}
+
+	// Writes of the admin API are persisted, external changes are picked up by the next reload
+	if _, err := shedder.add("CN", time.Minute); err != nil {
+		t.Fatalf("failed to shed: %v", err)
+	}
+	written, err := os.ReadFile(file)
+	if err != nil || !strings.Contains(string(written), "CN,") || !strings.Contains(string(written), "US,") {
+		t.Fatalf("expected CN and US in the file, got %q (%v)", written, err)
+	}
+	if err := os.WriteFile(file, []byte("BR,"+inAnHour+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write shed file: %v", err)
+	}
+	if err := shedder.reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if sheds := shedder.list(); len(sheds) != 1 || sheds[0].Country != "BR" {
+		t.Errorf("expected only BR after the reload, got %+v", sheds)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := shedder.reload(); err != nil || len(shedder.list()) != 0 {
+		t.Errorf("expected a removed file to shed nothing, got %+v (%v)", shedder.list(), err)
+	}
+}
+
+func TestAdminShed(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.AdminPath = "/.geoblock"
+	cfg.AdminToken = "s3cret"
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request(http.MethodPost, "/.geoblock/shed", `{"country": "AU", "ttlSeconds": 600}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := request(http.MethodPost, "/.geoblock/shed", `{"country": "AU"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a duration, got %d", rr.Code)
+	}
+
+	rr := request(http.MethodGet, "/.geoblock/shed", "")
+	var sheds []LoadShed
+	if err := json.Unmarshal(rr.Body.Bytes(), &sheds); err != nil {
+		t.Fatalf("failed to decode sheds: %v", err)
+	}
+	if len(sheds) != 1 || sheds[0].Country != "AU" || sheds[0].Expires.IsZero() {
+		t.Errorf("unexpected sheds: %+v", sheds)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	shed := httptest.NewRecorder()
+	plugin.ServeHTTP(shed, req)
+	if shed.Code != http.StatusServiceUnavailable || shed.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a 503 with Retry-After, got %d", shed.Code)
+	}
+
+	if rr := request(http.MethodDelete, "/.geoblock/shed?country=AU", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := request(http.MethodDelete, "/.geoblock/shed?country=AU", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a country not shed, got %d", rr.Code)
+	}
+}
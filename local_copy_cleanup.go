@@ -0,0 +1,69 @@
+package traefik_geoblock
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// localCopyPattern matches the names createLocalDatabaseCopy generates
+var localCopyPattern = regexp.MustCompile(`^IP2LOCATION-LITE-.+_\d{8}_\d{6}_\d+\.BIN$`)
+
+// liveLocalCopies holds the local copies still opened by a factory of this process
+var (
+	liveLocalCopiesMutex sync.Mutex
+	liveLocalCopies      = make(map[string]struct{})
+)
+
+// trackLocalCopy marks a local copy as in use, or no longer in use
+func trackLocalCopy(path string, live bool) {
+	liveLocalCopiesMutex.Lock()
+	defer liveLocalCopiesMutex.Unlock()
+	if live {
+		liveLocalCopies[path] = struct{}{}
+	} else {
+		delete(liveLocalCopies, path)
+	}
+}
+
+// cleanupOrphanedLocalCopies deletes local copies in dir older than maxAge that no factory of this process uses.
+// They are left behind by crashed or restarted processes. Returns the number of deleted files.
+func cleanupOrphanedLocalCopies(dir string, maxAge time.Duration, now time.Time, logger *slog.Logger) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Warn("failed to scan for orphaned local database copies", "directory", dir, "error", err)
+		return 0
+	}
+
+	liveLocalCopiesMutex.Lock()
+	defer liveLocalCopiesMutex.Unlock()
+
+	deleted := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !localCopyPattern.MatchString(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if _, live := liveLocalCopies[path]; live {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		// Copies still opened by another process fail to delete on Windows and are retried next startup
+		if err := os.Remove(path); err != nil {
+			logger.Debug("failed to delete orphaned local database copy", "file", path, "error", err)
+			continue
+		}
+		deleted++
+	}
+
+	if deleted > 0 {
+		logger.Info("deleted orphaned local database copies", "directory", dir, "files", deleted)
+	}
+	return deleted
+}
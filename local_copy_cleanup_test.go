@@ -0,0 +1,96 @@
+package traefik_geoblock
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanupOrphanedLocalCopies(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	files := map[string]time.Time{
+		"IP2LOCATION-LITE-DB1.IPV6_20240101_120000_123456789.BIN": old, // orphaned
+		"IP2LOCATION-LITE-DB1.IPV6_20240101_120000_987654321.BIN": old, // still used by this process
+		"IP2LOCATION-LITE-DB1.IPV6_20240102_120000_1.BIN":         now, // too recent
+		"20240101_IP2LOCATION-LITE-DB1.IPV6.BIN":                  old, // downloaded database
+		"notes.txt":                                               old,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	live := filepath.Join(dir, "IP2LOCATION-LITE-DB1.IPV6_20240101_120000_987654321.BIN")
+	trackLocalCopy(live, true)
+	defer trackLocalCopy(live, false)
+
+	deleted := cleanupOrphanedLocalCopies(dir, 24*time.Hour, now, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted copy, got %d", deleted)
+	}
+
+	for name := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		orphan := name == "IP2LOCATION-LITE-DB1.IPV6_20240101_120000_123456789.BIN"
+		if orphan && !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+		if !orphan && err != nil {
+			t.Errorf("Expected %s to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestDatabaseFactory_CleansUpOrphanedCopies(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	updateDir := t.TempDir()
+	copyDir := t.TempDir()
+	if err := copyFile("./IP2LOCATION-LITE-DB1.IPV6.BIN", filepath.Join(updateDir, time.Now().Format("20060102")+"_IP2LOCATION-LITE-DB1.IPV6.BIN"), true); err != nil {
+		t.Fatalf("Failed to copy database: %v", err)
+	}
+	orphan := filepath.Join(copyDir, "IP2LOCATION-LITE-DB1.IPV6_20240101_120000_1.BIN")
+	if err := os.WriteFile(orphan, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(orphan, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	factory, err := NewDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:             "./IP2LOCATION-LITE-DB1.IPV6.BIN",
+		DatabaseAutoUpdate:           true,
+		DatabaseAutoUpdateDir:        updateDir,
+		DatabaseAutoUpdateCode:       "DB1",
+		DatabaseLocalCopyDir:         copyDir,
+		DatabaseLocalCopyMaxAgeHours: 24,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Failed to create factory: %v", err)
+	}
+	// The update goroutine writes to the temp dirs, it must be done before they are removed
+	defer func() {
+		factory.Close()
+		<-factory.updateDone
+	}()
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("Expected orphaned copy to be deleted on startup")
+	}
+	if _, err := os.Stat(factory.GetWrapper().GetPath()); err != nil {
+		t.Errorf("Expected the new local copy to exist: %v", err)
+	}
+}
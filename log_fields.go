@@ -0,0 +1,131 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Log field actions
+const (
+	LogFieldDrop   = "drop"   // Remove the field from the log entries
+	LogFieldRename = "rename" // Write the field under RenameTo
+	LogFieldHash   = "hash"   // Replace the value with its salted SHA-256 (optionally under RenameTo)
+)
+
+// LogFieldOption customizes one log field, e.g. hashing "ip" where raw IPs are personal data
+type LogFieldOption struct {
+	Field    string // Field name as written by the plugin: "ip", "ip_chain", "remote_addr", "country", ...
+	Action   string // "drop", "rename" or "hash"
+	RenameTo string // New field name for "rename", optional for "hash"
+}
+
+// logFieldHandler rewrites the fields of every record before passing it on
+type logFieldHandler struct {
+	next  slog.Handler
+	rules map[string]LogFieldOption
+	salt  string
+}
+
+// applyLogFieldOptions wraps the logger so the configured fields are dropped, renamed or hashed.
+// Returns the logger unchanged when no options are configured.
+func applyLogFieldOptions(logger *slog.Logger, options []LogFieldOption, salt string) (*slog.Logger, error) {
+	if len(options) == 0 {
+		return logger, nil
+	}
+
+	rules := make(map[string]LogFieldOption, len(options))
+	for _, option := range options {
+		if option.Field == "" {
+			return nil, fmt.Errorf("LogFieldOptions entry without Field")
+		}
+		switch option.Action {
+		case LogFieldDrop, LogFieldHash:
+		case LogFieldRename:
+			if option.RenameTo == "" {
+				return nil, fmt.Errorf("LogFieldOptions %q: rename requires RenameTo", option.Field)
+			}
+		default:
+			return nil, fmt.Errorf("LogFieldOptions %q: invalid action %q, must be one of: drop, rename, hash", option.Field, option.Action)
+		}
+		rules[option.Field] = option
+		if option.Action == LogFieldHash && salt == "" {
+			// The IPv4 space is small enough to reverse unsalted hashes by brute force
+			logger.Warn("hashing log field without LogHashSalt", "field", option.Field)
+		}
+	}
+
+	return slog.New(&logFieldHandler{next: logger.Handler(), rules: rules, salt: salt}), nil
+}
+
+func (h *logFieldHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *logFieldHandler) Handle(ctx context.Context, record slog.Record) error {
+	rewritten := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr, keep := h.rewrite(attr); keep {
+			rewritten.AddAttrs(attr)
+		}
+		return true
+	})
+	return h.next.Handle(ctx, rewritten)
+}
+
+func (h *logFieldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kept := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr, keep := h.rewrite(attr); keep {
+			kept = append(kept, attr)
+		}
+	}
+	return &logFieldHandler{next: h.next.WithAttrs(kept), rules: h.rules, salt: h.salt}
+}
+
+func (h *logFieldHandler) WithGroup(name string) slog.Handler {
+	return &logFieldHandler{next: h.next.WithGroup(name), rules: h.rules, salt: h.salt}
+}
+
+// rewrite applies the rule for the field, returning false when the field is dropped
+func (h *logFieldHandler) rewrite(attr slog.Attr) (slog.Attr, bool) {
+	rule, ok := h.rules[attr.Key]
+	if !ok {
+		return attr, true
+	}
+
+	switch rule.Action {
+	case LogFieldDrop:
+		return slog.Attr{}, false
+	case LogFieldRename:
+		attr.Key = rule.RenameTo
+	case LogFieldHash:
+		attr.Value = slog.StringValue(h.hashList(attr.Value.String()))
+		if rule.RenameTo != "" {
+			attr.Key = rule.RenameTo
+		}
+	}
+	return attr, true
+}
+
+// hashList hashes each element of a comma separated list (such as ip_chain) on its own,
+// so the same IP gets the same hash wherever it appears
+func (h *logFieldHandler) hashList(value string) string {
+	if value == "" {
+		return ""
+	}
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		parts[i] = hashLogValue(h.salt, strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hashLogValue returns the hex SHA-256 of salt+value
+func hashLogValue(salt, value string) string {
+	sum := sha256.Sum256([]byte(salt + value))
+	return hex.EncodeToString(sum[:])
+}
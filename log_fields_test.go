@@ -0,0 +1,74 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogFieldOptions(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	logger, err := applyLogFieldOptions(base, []LogFieldOption{
+		{Field: "ip", Action: LogFieldHash},
+		{Field: "ip_chain", Action: LogFieldHash, RenameTo: "ip_chain_hash"},
+		{Field: "remote_addr", Action: LogFieldDrop},
+		{Field: "country", Action: LogFieldRename, RenameTo: "geo_country"},
+	}, "pepper")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logger.With("remote_addr", "10.0.0.1:1234").Info("blocked request",
+		"ip", "8.8.8.8", "ip_chain", "8.8.8.8, 1.1.1.1", "country", "US", "phase", "blocked_country")
+
+	var entry map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry %q: %v", buf.String(), err)
+	}
+
+	ipHash := hashLogValue("pepper", "8.8.8.8")
+	if entry["ip"] != ipHash {
+		t.Errorf("expected hashed ip %s, got %s", ipHash, entry["ip"])
+	}
+	if want := ipHash + ", " + hashLogValue("pepper", "1.1.1.1"); entry["ip_chain_hash"] != want {
+		t.Errorf("expected ip_chain_hash %s, got %s", want, entry["ip_chain_hash"])
+	}
+	if _, found := entry["ip_chain"]; found {
+		t.Error("expected ip_chain to be renamed")
+	}
+	if _, found := entry["remote_addr"]; found {
+		t.Error("expected remote_addr to be dropped")
+	}
+	if entry["geo_country"] != "US" || entry["phase"] != "blocked_country" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if strings.Contains(buf.String(), "8.8.8.8") {
+		t.Errorf("raw IP leaked into the log: %s", buf.String())
+	}
+}
+
+func TestLogFieldOptionsValidation(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.LogFieldOptions = []LogFieldOption{{Field: "ip", Action: "encrypt"}}
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Error("expected error for an invalid action")
+	}
+
+	cfg.LogFieldOptions = []LogFieldOption{{Field: "ip", Action: LogFieldRename}}
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Error("expected error for rename without RenameTo")
+	}
+
+	cfg.LogFieldOptions = []LogFieldOption{{Field: "ip", Action: LogFieldHash}}
+	cfg.LogHashSalt = "pepper"
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err != nil {
+		t.Errorf("expected no error, but got: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LogPhaseOff turns off the request log of a phase in LogPhaseLevels
+const LogPhaseOff = "off"
+
+// phaseLogLevel is the request log level of a phase, enabled is false for "off"
+type phaseLogLevel struct {
+	level   slog.Level
+	enabled bool
+}
+
+// phaseLogLevels maps decision phases to the level of their request log
+type phaseLogLevels map[string]phaseLogLevel
+
+// newPhaseLogLevels validates LogPhaseLevels. Returns nil when no phase is configured.
+func newPhaseLogLevels(levels map[string]string) (phaseLogLevels, error) {
+	if len(levels) == 0 {
+		return nil, nil
+	}
+	parsed := make(phaseLogLevels, len(levels))
+	for phase, level := range levels {
+		switch strings.ToLower(level) {
+		case "debug":
+			parsed[phase] = phaseLogLevel{level: slog.LevelDebug, enabled: true}
+		case "info":
+			parsed[phase] = phaseLogLevel{level: slog.LevelInfo, enabled: true}
+		case "warn":
+			parsed[phase] = phaseLogLevel{level: slog.LevelWarn, enabled: true}
+		case "error":
+			parsed[phase] = phaseLogLevel{level: slog.LevelError, enabled: true}
+		case LogPhaseOff:
+			parsed[phase] = phaseLogLevel{}
+		default:
+			return nil, fmt.Errorf("invalid LogPhaseLevels[%s] %q, must be debug, info, warn, error or off", phase, level)
+		}
+	}
+	return parsed, nil
+}
+
+// level returns the level of the request log for a phase and whether it is written. Phases missing from
+// LogPhaseLevels get the fallback, so blocked requests keep following LogBannedRequests.
+func (l phaseLogLevels) level(phase string, fallback slog.Level, fallbackEnabled bool) (slog.Level, bool) {
+	if configured, ok := l[phase]; ok {
+		return configured.level, configured.enabled
+	}
+	return fallback, fallbackEnabled
+}
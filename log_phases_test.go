@@ -0,0 +1,80 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogPhaseLevels(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US"}
+	cfg.BlockedCountries = []string{"DE"}
+	cfg.AllowPrivate = true
+	cfg.LogPhaseLevels = map[string]string{
+		PhaseBlockedCountry: "warn",
+		PhaseAllowPrivate:   "debug",
+		PhaseDefaultAllow:   "off",
+	}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		ip   string
+		want string // Expected log line prefix, empty for none
+	}{
+		{"85.214.132.1", `level=WARN msg="blocked request"`},
+		{"10.0.0.1", `level=DEBUG msg="allowed request"`},
+		{"8.8.8.8", ""}, // Allowed phases are only logged when listed
+		{"1.1.1.1", ""}, // Turned off
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			logs := &syncBuffer{}
+			plugin.logger = slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+			output := logs.String()
+			requestLogs := strings.Count(output, "request\" ")
+			if tt.want == "" {
+				if requestLogs != 0 {
+					t.Errorf("expected no request log, got %s", output)
+				}
+			} else if !strings.Contains(output, tt.want) || requestLogs != 1 {
+				t.Errorf("expected a single %s line, got %s", tt.want, output)
+			}
+		})
+	}
+}
+
+func TestNewPhaseLogLevels(t *testing.T) {
+	levels, err := newPhaseLogLevels(map[string]string{PhaseLookupError: "ERROR", PhaseBlockedIPBlock: "off"})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if level, ok := levels.level(PhaseLookupError, slog.LevelInfo, false); !ok || level != slog.LevelError {
+		t.Errorf("expected error level, got %v, %v", level, ok)
+	}
+	if _, ok := levels.level(PhaseBlockedIPBlock, slog.LevelInfo, true); ok {
+		t.Error("expected the phase to be turned off")
+	}
+	if level, ok := levels.level(PhaseBlockedCountry, slog.LevelInfo, true); !ok || level != slog.LevelInfo {
+		t.Errorf("expected the fallback for unlisted phases, got %v, %v", level, ok)
+	}
+
+	if _, err := newPhaseLogLevels(map[string]string{PhaseBlockedCountry: "verbose"}); err == nil || !strings.Contains(err.Error(), "LogPhaseLevels[blocked_country]") {
+		t.Errorf("expected an error naming the phase, got %v", err)
+	}
+}
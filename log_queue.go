@@ -0,0 +1,142 @@
+package traefik_geoblock
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// logQueueHighWaterPercent is the fill level that triggers a warning
+	logQueueHighWaterPercent = 80
+	// logQueueWarnInterval limits the high-water and drop warnings to one per interval
+	logQueueWarnInterval = time.Minute
+)
+
+// LogQueueStats reports the state of the asynchronous log queue
+type LogQueueStats struct {
+	Enabled  bool  `json:"enabled"`
+	Queued   int   `json:"queued"`
+	Capacity int   `json:"capacity"`
+	Written  int64 `json:"written"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// asyncLogWriter hands log lines to a background goroutine through a bounded queue, so a slow
+// destination (file, socket, stdout piped to a busy collector) never blocks ServeHTTP.
+// Lines are dropped when the queue is full.
+type asyncLogWriter struct {
+	out         io.Writer
+	queue       chan []byte
+	stop        chan struct{} // Closed by close, the goroutine writes what is queued and exits
+	done        chan struct{} // Closed when the goroutine has exited
+	stopOnce    sync.Once
+	stopped     *int32       // Set by close, later lines are written synchronously
+	warnings    *slog.Logger // Reports the queue filling up, outside of the queue itself
+	written     *int64
+	dropped     *int64
+	lastWarning *int64 // Unix nanoseconds of the last warning
+}
+
+// newAsyncLogWriter starts the goroutine writing queued lines to out
+func newAsyncLogWriter(out io.Writer, size int, warnings *slog.Logger) *asyncLogWriter {
+	w := &asyncLogWriter{
+		out:         out,
+		queue:       make(chan []byte, size),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		stopped:     new(int32),
+		warnings:    warnings,
+		written:     new(int64),
+		dropped:     new(int64),
+		lastWarning: new(int64),
+	}
+	go w.run()
+	return w
+}
+
+// Write queues a copy of the line, slog handlers reuse their buffers
+func (w *asyncLogWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(w.stopped) == 1 {
+		return w.out.Write(p)
+	}
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	select {
+	case w.queue <- line:
+		if len(w.queue)*100 >= cap(w.queue)*logQueueHighWaterPercent {
+			w.warn("log queue above high-water mark")
+		}
+	default:
+		atomic.AddInt64(w.dropped, 1)
+		w.warn("log queue full, dropping log lines")
+	}
+	return len(p), nil
+}
+
+// run writes the queued lines in order until close
+func (w *asyncLogWriter) run() {
+	defer close(w.done)
+	for {
+		select {
+		case line := <-w.queue:
+			w.write(line)
+		case <-w.stop:
+			for {
+				select {
+				case line := <-w.queue:
+					w.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes one queued line
+func (w *asyncLogWriter) write(line []byte) {
+	_, _ = w.out.Write(line) // Nobody to report a failed log write to
+	atomic.AddInt64(w.written, 1)
+}
+
+// close writes the queued lines and stops the goroutine. Lines logged afterwards are written synchronously.
+func (w *asyncLogWriter) close() {
+	w.stopOnce.Do(func() {
+		atomic.StoreInt32(w.stopped, 1)
+		close(w.stop)
+	})
+	<-w.done
+}
+
+// warn logs at most one warning per logQueueWarnInterval
+func (w *asyncLogWriter) warn(msg string) {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(w.lastWarning)
+	if now-last < int64(logQueueWarnInterval) || !atomic.CompareAndSwapInt64(w.lastWarning, last, now) {
+		return
+	}
+	w.warnings.Warn(msg, "queued", len(w.queue), "capacity", cap(w.queue), "dropped", atomic.LoadInt64(w.dropped))
+}
+
+// stats returns the queue counters
+func (w *asyncLogWriter) stats() LogQueueStats {
+	return LogQueueStats{
+		Enabled:  true,
+		Queued:   len(w.queue),
+		Capacity: cap(w.queue),
+		Written:  atomic.LoadInt64(w.written),
+		Dropped:  atomic.LoadInt64(w.dropped),
+	}
+}
+
+// LogQueueStats reports the asynchronous log queue counters. Enabled is false when LogQueueSize is 0.
+func (p Plugin) LogQueueStats() LogQueueStats {
+	if p.logQueue == nil {
+		return LogQueueStats{}
+	}
+	return p.logQueue.stats()
+}
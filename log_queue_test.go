@@ -0,0 +1,88 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// stalledWriter blocks every write until released, like a collector that stopped reading
+type stalledWriter struct {
+	entered chan struct{}
+	release chan struct{}
+	out     *syncBuffer
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.release
+	return w.out.Write(p)
+}
+
+func TestAsyncLogWriter(t *testing.T) {
+	out := &syncBuffer{}
+	warnings := &syncBuffer{}
+	stalled := &stalledWriter{entered: make(chan struct{}, 10), release: make(chan struct{}), out: out}
+	queue := newAsyncLogWriter(stalled, 2, slog.New(slog.NewTextHandler(warnings, nil)))
+	logger := slog.New(slog.NewTextHandler(queue, nil))
+
+	logger.Info("first")
+	<-stalled.entered // The writer holds "first", the queue is empty
+
+	// None of these block although nothing is written
+	logger.Info("second")
+	logger.Info("third")
+	logger.Info("fourth")
+
+	if stats := queue.stats(); stats.Queued != 2 || stats.Dropped != 1 {
+		t.Errorf("expected 2 queued and 1 dropped line, got %+v", stats)
+	}
+	if !strings.Contains(warnings.String(), "log queue above high-water mark") {
+		t.Errorf("expected a high-water warning, got %q", warnings.String())
+	}
+
+	close(stalled.release)
+	queue.close() // Writes what is queued before returning
+	logger.Info("fifth")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "first") || !strings.Contains(lines[2], "third") || !strings.Contains(lines[3], "fifth") {
+		t.Errorf("expected the queued lines in order, then the line logged after close, got %q", out.String())
+	}
+}
+
+func TestLogQueueStats(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.LogQueueSize = 16
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if stats := plugin.(*Plugin).LogQueueStats(); !stats.Enabled || stats.Capacity != 16 {
+		t.Errorf("expected an enabled queue of 16 lines, got %+v", stats)
+	}
+	plugin.(*Plugin).Close()
+
+	// Synchronous by default, and disabled instances never start a writer
+	for _, enabled := range []bool{true, false} {
+		cfg := CreateConfig()
+		cfg.Enabled = enabled
+		cfg.DatabaseFilePath = tinyDbFilePath
+		if !enabled {
+			cfg.LogQueueSize = 16
+		}
+		plugin, err = New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		if stats := plugin.(*Plugin).LogQueueStats(); stats.Enabled {
+			t.Errorf("enabled=%t: expected synchronous logging, got %+v", enabled, stats)
+		}
+		plugin.(*Plugin).Close()
+	}
+}
@@ -31,8 +31,15 @@ func createBootstrapLogger(name string) *slog.Logger {
 	return slog.New(handler).With("plugin", name)
 }
 
-// createLogger creates a configured logger based on the provided settings
+// createLogger creates a configured logger based on the provided settings, writing synchronously
 func createLogger(name, level, format, path string, bufferSizeBytes, timeoutSeconds int, bootstrapLogger *slog.Logger) *slog.Logger {
+	logger, _ := createQueuedLogger(name, level, format, path, bufferSizeBytes, timeoutSeconds, 0, bootstrapLogger)
+	return logger
+}
+
+// createQueuedLogger creates a configured logger. With a positive queueSize lines are written by a
+// background goroutine, the returned queue is nil otherwise.
+func createQueuedLogger(name, level, format, path string, bufferSizeBytes, timeoutSeconds, queueSize int, bootstrapLogger *slog.Logger) (*slog.Logger, *asyncLogWriter) {
 	var logLevel slog.Level
 	level = strings.ToLower(level) // Convert level to lowercase
 	switch level {
@@ -60,7 +67,10 @@ func createLogger(name, level, format, path string, bufferSizeBytes, timeoutSeco
 	var destination string = "stdout"
 
 	// Only attempt file writing if explicitly specified
-	if path != "" {
+	if network, address, ok := parseSocketLogPath(path); ok {
+		writer = newSocketLogWriter(network, address)
+		destination = path
+	} else if path != "" {
 		timeout := time.Duration(timeoutSeconds) * time.Second // Convert seconds to duration
 		bw, err := newBufferedFileWriter(path, bufferSizeBytes, timeout)
 		if err != nil {
@@ -71,6 +81,12 @@ func createLogger(name, level, format, path string, bufferSizeBytes, timeoutSeco
 		}
 	}
 
+	var queue *asyncLogWriter
+	if queueSize > 0 {
+		queue = newAsyncLogWriter(writer, queueSize, bootstrapLogger)
+		writer = queue
+	}
+
 	var handler slog.Handler
 	format = strings.ToLower(format)
 	if format == "json" {
@@ -84,5 +100,5 @@ func createLogger(name, level, format, path string, bufferSizeBytes, timeoutSeco
 	if logLevel <= slog.LevelDebug {
 		bootstrapLogger.Debug(fmt.Sprintf("Logging to %s with %s format at %s level", destination, format, logLevel))
 	}
-	return slog.New(handler).With("plugin", name)
+	return slog.New(handler).With("plugin", name), queue
 }
@@ -0,0 +1,149 @@
+package traefik_geoblock
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencySubBuckets splits every power of two into this many buckets, a relative error of at most 1/8
+	latencySubBucketBits = 3
+	latencySubBuckets    = 1 << latencySubBucketBits
+	latencyBuckets       = 64 * latencySubBuckets
+)
+
+// LookupLatency summarizes database lookup durations. Percentiles are upper bounds of their histogram
+// bucket, within 12.5% of the real value.
+type LookupLatency struct {
+	Enabled   bool  `json:"enabled"`
+	Count     int64 `json:"count"`     // Lookups recorded
+	P50Micros int64 `json:"p50Micros"` // Median, in microseconds
+	P95Micros int64 `json:"p95Micros"`
+	P99Micros int64 `json:"p99Micros"`
+	MaxMicros int64 `json:"maxMicros"` // Slowest lookup, in microseconds
+}
+
+// latencyHistogram counts durations in log-linear buckets (HDR style), so recording is a couple of
+// atomic adds and memory stays fixed whatever the traffic
+type latencyHistogram struct {
+	counts [latencyBuckets]int64
+	max    int64 // Nanoseconds
+}
+
+// latencyBucket returns the bucket of a duration in nanoseconds
+func latencyBucket(ns int64) int {
+	if ns < latencySubBuckets {
+		return int(ns)
+	}
+	exponent := bits.Len64(uint64(ns)) - 1 - latencySubBucketBits
+	return (exponent+1)*latencySubBuckets + int(ns>>uint(exponent)) - latencySubBuckets
+}
+
+// latencyBucketUpperBound returns the largest duration in nanoseconds counted in a bucket
+func latencyBucketUpperBound(bucket int) int64 {
+	if bucket < latencySubBuckets {
+		return int64(bucket)
+	}
+	exponent := bucket/latencySubBuckets - 1
+	mantissa := int64(bucket%latencySubBuckets + latencySubBuckets)
+	return (mantissa+1)<<uint(exponent) - 1
+}
+
+// record adds a lookup duration
+func (h *latencyHistogram) record(d time.Duration) {
+	ns := int64(d)
+	if ns < 0 {
+		ns = 0
+	}
+	atomic.AddInt64(&h.counts[latencyBucket(ns)], 1)
+	for {
+		slowest := atomic.LoadInt64(&h.max)
+		if ns <= slowest || atomic.CompareAndSwapInt64(&h.max, slowest, ns) {
+			return
+		}
+	}
+}
+
+// counters returns a copy of the bucket counters
+func (h *latencyHistogram) counters() [latencyBuckets]int64 {
+	var counts [latencyBuckets]int64
+	for i := range counts {
+		counts[i] = atomic.LoadInt64(&h.counts[i])
+	}
+	return counts
+}
+
+// summarize computes the percentiles of the lookups counted since previous, a copy returned by counters
+// (nil for all lookups). Max is the slowest lookup since startup when previous is nil, else the upper
+// bound of the slowest bucket in the interval.
+func (h *latencyHistogram) summarize(counts [latencyBuckets]int64, previous *[latencyBuckets]int64) LookupLatency {
+	summary := LookupLatency{Enabled: true}
+	if previous != nil {
+		for i := range counts {
+			counts[i] -= previous[i]
+		}
+	}
+	for _, count := range counts {
+		summary.Count += count
+	}
+	if summary.Count == 0 {
+		return summary
+	}
+
+	percentile := func(fraction float64) int64 {
+		rank := int64(fraction*float64(summary.Count) + 0.5)
+		if rank < 1 {
+			rank = 1
+		}
+		var seen int64
+		for bucket, count := range counts {
+			seen += count
+			if seen >= rank {
+				return latencyBucketUpperBound(bucket) / int64(time.Microsecond)
+			}
+		}
+		return 0
+	}
+	summary.P50Micros = percentile(0.50)
+	summary.P95Micros = percentile(0.95)
+	summary.P99Micros = percentile(0.99)
+	if previous == nil {
+		summary.MaxMicros = atomic.LoadInt64(&h.max) / int64(time.Microsecond)
+	} else {
+		summary.MaxMicros = percentile(1)
+	}
+	return summary
+}
+
+// logLatencySummaries logs the lookup latency of every interval that had lookups, until the factory is closed
+func (df *DatabaseFactory) logLatencySummaries(ticker Ticker) {
+	var previous [latencyBuckets]int64
+	for {
+		select {
+		case <-ticker.C():
+			counts := df.wrapper.latency.counters()
+			summary := df.wrapper.latency.summarize(counts, &previous)
+			previous = counts
+			if summary.Count == 0 {
+				continue
+			}
+			df.logger.Info("database lookup latency",
+				"lookups", summary.Count,
+				"p50_us", summary.P50Micros,
+				"p95_us", summary.P95Micros,
+				"p99_us", summary.P99Micros,
+				"max_us", summary.MaxMicros)
+		case <-df.stopChan:
+			return
+		}
+	}
+}
+
+// LookupLatency reports the database lookup latency since startup. Enabled is false with an injected Lookuper.
+func (p Plugin) LookupLatency() LookupLatency {
+	if p.db == nil {
+		return LookupLatency{}
+	}
+	return p.db.latency.summarize(p.db.latency.counters(), nil)
+}
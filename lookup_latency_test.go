@@ -0,0 +1,83 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	for _, ns := range []int64{0, 7, 8, 15, 16, 1000, 123456, 1 << 40, 1<<62 + 12345} {
+		bucket := latencyBucket(ns)
+		upper := latencyBucketUpperBound(bucket)
+		if upper < ns || (ns >= latencySubBuckets && float64(upper-ns) > float64(ns)/latencySubBuckets) {
+			t.Errorf("%d: bucket %d has upper bound %d", ns, bucket, upper)
+		}
+		if bucket > 0 && latencyBucketUpperBound(bucket-1) >= ns {
+			t.Errorf("%d: also fits the previous bucket", ns)
+		}
+	}
+
+	h := &latencyHistogram{}
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	summary := h.summarize(h.counters(), nil)
+	within := func(got, want int64) bool { return got >= want && float64(got) <= float64(want)*1.125 }
+	if summary.Count != 100 || !within(summary.P50Micros, 50000) || !within(summary.P95Micros, 95000) ||
+		!within(summary.P99Micros, 99000) || summary.MaxMicros != 100000 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	previous := h.counters()
+	h.record(3 * time.Microsecond)
+	if interval := h.summarize(h.counters(), &previous); interval.Count != 1 || !within(interval.P99Micros, 3) || interval.MaxMicros > 3 {
+		t.Errorf("expected only the last lookup in the interval, got %+v", interval)
+	}
+}
+
+func TestLookupLatency(t *testing.T) {
+	clock := newFakeClock(time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC))
+	logs := &syncBuffer{}
+	factory, err := newDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:          tinyDbFilePath,
+		DatabaseLatencyLogSeconds: 60,
+	}, slog.New(slog.NewTextHandler(logs, nil)), clock)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := factory.GetWrapper().LookupCountry("8.8.8.8"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(time.Minute)
+	waitFor(t, "latency summary", func() bool {
+		return strings.Contains(logs.String(), "database lookup latency") && strings.Contains(logs.String(), "lookups=10 ")
+	})
+
+	// Quiet intervals aren't logged
+	clock.Advance(time.Minute)
+	time.Sleep(50 * time.Millisecond)
+	if got := strings.Count(logs.String(), "database lookup latency"); got != 1 {
+		t.Errorf("expected a single summary, got %d", got)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	before := plugin.LookupLatency().Count
+	plugin.Lookup("1.1.1.1")
+	if latency := plugin.LookupLatency(); !latency.Enabled || latency.Count != before+1 {
+		t.Errorf("expected one more lookup than %d, got %+v", before, latency)
+	}
+}
@@ -0,0 +1,84 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PhaseMaintenance is used when a request is answered with the maintenance page
+const PhaseMaintenance = "maintenance"
+
+// maintenanceMode answers requests from selected countries with a 503, regardless of the allow/block lists
+type maintenanceMode struct {
+	countries   map[string]struct{}
+	htmlContent string // Optional page, {{.Country}} and {{.RetryAfter}} are replaced
+	retryAfter  string // Retry-After header value, empty to omit it
+}
+
+// newMaintenanceMode loads the maintenance settings. Returns nil when no maintenance countries are configured.
+func newMaintenanceMode(cfg *Config, logger *slog.Logger) (*maintenanceMode, error) {
+	if len(cfg.MaintenanceCountries) == 0 {
+		return nil, nil
+	}
+
+	retryAfter := strings.TrimSpace(cfg.MaintenanceRetryAfter)
+	if retryAfter != "" {
+		// Retry-After is either a number of seconds or an HTTP date
+		if seconds, err := strconv.Atoi(retryAfter); err != nil || seconds < 0 {
+			if _, err := http.ParseTime(retryAfter); err != nil {
+				return nil, fmt.Errorf("invalid MaintenanceRetryAfter %q: must be seconds or an HTTP date", cfg.MaintenanceRetryAfter)
+			}
+		}
+	}
+
+	var htmlContent string
+	if cfg.MaintenanceHtmlFilePath != "" {
+		path, err := fileUtils.Search(cfg.MaintenanceHtmlFilePath, "geoblockmaintenance.html", logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find maintenance HTML file: %w", err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load maintenance HTML file %s: %w", path, err)
+		}
+		htmlContent = string(content)
+	}
+
+	return &maintenanceMode{
+		countries:   expandCountryGroups(cfg.MaintenanceCountries),
+		htmlContent: htmlContent,
+		retryAfter:  retryAfter,
+	}, nil
+}
+
+// applies reports whether the country is under maintenance
+func (m *maintenanceMode) applies(country string) bool {
+	_, ok := m.countries[country]
+	return ok
+}
+
+// serve writes the 503 maintenance response
+func (m *maintenanceMode) serve(rw http.ResponseWriter, req *http.Request, country string, logger *slog.Logger) {
+	if m.retryAfter != "" {
+		rw.Header().Set("Retry-After", m.retryAfter)
+	}
+
+	if m.htmlContent != "" && req.Method == http.MethodGet {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+
+		content := m.htmlContent
+		content = strings.ReplaceAll(content, "{{.Country}}", country)
+		content = strings.ReplaceAll(content, "{{.RetryAfter}}", m.retryAfter)
+
+		if _, err := rw.Write([]byte(content)); err != nil {
+			logger.Warn("failed to write maintenance HTML response", "error", err)
+		}
+		return
+	}
+	rw.WriteHeader(http.StatusServiceUnavailable)
+}
@@ -0,0 +1,95 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	cfg := &Config{
+		Enabled:                      true,
+		DatabaseFilePath:             tinyDbFilePath,
+		AllowedCountries:             []string{"AU", "US"},
+		BlockedCountries:             []string{"IE"},
+		DefaultAllow:                 true,
+		DisallowedStatusCode:         http.StatusForbidden,
+		IPHeaders:                    []string{"x-real-ip"},
+		IPHeaderStrategy:             IPHeaderStrategyCheckAll,
+		MaintenanceCountries:         []string{"DE", "US", "IE"},
+		MaintenanceHtmlFilePath:      "./geoblockmaintenance.html",
+		MaintenanceRetryAfter:        "120",
+		RemediationHeadersCustomName: "X-Geoblock-Action",
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		ip     string
+		method string
+		status int
+		phase  string
+	}{
+		{name: "default allowed country under maintenance", ip: "85.214.132.117", method: http.MethodGet, status: http.StatusServiceUnavailable, phase: PhaseMaintenance},
+		{name: "allow listed country under maintenance", ip: "8.8.8.8", method: http.MethodHead, status: http.StatusServiceUnavailable, phase: PhaseMaintenance},
+		{name: "country not under maintenance", ip: "1.1.1.1", method: http.MethodGet, status: http.StatusTeapot},
+		{name: "blocked country keeps ban response", ip: "2a00:1450::1", method: http.MethodGet, status: http.StatusForbidden, phase: PhaseBlockedCountry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("X-Geoblock-Action"); got != tt.phase {
+				t.Errorf("expected remediation header %q, got %q", tt.phase, got)
+			}
+			if tt.phase != PhaseMaintenance {
+				return
+			}
+			if got := rr.Header().Get("Retry-After"); got != "120" {
+				t.Errorf("expected Retry-After 120, got %q", got)
+			}
+			body := rr.Body.String()
+			if tt.method == http.MethodGet && !strings.Contains(body, `data-country="DE"`) {
+				t.Errorf("expected maintenance page with country placeholder replaced, got %q", body)
+			}
+			if tt.method != http.MethodGet && body != "" {
+				t.Errorf("expected empty body for %s, got %q", tt.method, body)
+			}
+		})
+	}
+}
+
+func TestMaintenanceModeValidation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	for _, value := range []string{"", "0", "3600", "Wed, 21 Oct 2026 07:28:00 GMT"} {
+		if _, err := newMaintenanceMode(&Config{MaintenanceCountries: []string{"DE"}, MaintenanceRetryAfter: value}, logger); err != nil {
+			t.Errorf("expected Retry-After %q to be accepted, got %v", value, err)
+		}
+	}
+
+	for _, value := range []string{"-5", "soon"} {
+		if _, err := newMaintenanceMode(&Config{MaintenanceCountries: []string{"DE"}, MaintenanceRetryAfter: value}, logger); err == nil {
+			t.Errorf("expected Retry-After %q to be rejected", value)
+		}
+	}
+
+	if _, err := newMaintenanceMode(&Config{MaintenanceCountries: []string{"DE"}, MaintenanceHtmlFilePath: "./missing-maintenance.html"}, logger); err == nil {
+		t.Error("expected error for a missing maintenance page")
+	}
+}
@@ -0,0 +1,143 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// Estimated sizes used for MemoryBudgetMB, on 64-bit platforms. They include the allocator and map overhead,
+// so the estimate lands near what the Go runtime reports rather than the raw field sizes.
+const (
+	radixNodeBytes          = 64  // One bit of a CIDR block path in the tree
+	radixEndpointBytes      = 96  // CIDR string and RuleSource of an inserted block
+	collectedBlockBytes     = 80  // Parsed block waiting for aggregation
+	rangeCacheEntryBytes    = 112 // cachedRange (two keys and the country) in both families
+	dnsblCacheEntryBytes    = 144 // IP key, zone and expiry, with the map overhead
+	botCacheEntryBytes      = 128 // IP key and verification result
+	decisionCacheEntryBytes = 256 // IP, method, host and path key with the answer
+)
+
+// memoryBudget adds up the estimated memory of the IP block trees against MemoryBudgetMB, per source,
+// so an exceeded budget can name the lists that take the room. Shared by the allowed and blocked trees.
+type memoryBudget struct {
+	limit   int64
+	used    int64
+	sources map[string]int64 // Estimated bytes per block file, AllowedIPBlocks/BlockedIPBlocks for the static lists
+}
+
+// newMemoryBudget returns nil when megabytes is 0
+func newMemoryBudget(megabytes int) *memoryBudget {
+	if megabytes <= 0 {
+		return nil
+	}
+	return &memoryBudget{limit: int64(megabytes) << 20, sources: make(map[string]int64)}
+}
+
+// renewed returns an empty budget with the same limit, for rules built again (nil stays nil)
+func (b *memoryBudget) renewed() *memoryBudget {
+	if b == nil {
+		return nil
+	}
+	return &memoryBudget{limit: b.limit, sources: make(map[string]int64)}
+}
+
+// charge accounts bytes to a source and fails once the budget is exceeded
+func (b *memoryBudget) charge(source string, bytes int64) error {
+	if b == nil {
+		return nil
+	}
+	b.used += bytes
+	b.sources[source] += bytes
+	if b.used <= b.limit {
+		return nil
+	}
+
+	sources := make([]string, 0, len(b.sources))
+	for name := range b.sources {
+		sources = append(sources, name)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if b.sources[sources[i]] != b.sources[sources[j]] {
+			return b.sources[sources[i]] > b.sources[sources[j]]
+		}
+		return sources[i] < sources[j]
+	})
+	if len(sources) > 5 {
+		sources = sources[:5]
+	}
+	largest := make([]string, len(sources))
+	for i, name := range sources {
+		largest[i] = fmt.Sprintf("%s (%s)", name, formatMegabytes(b.sources[name]))
+	}
+	return fmt.Errorf("IP block lists exceed MemoryBudgetMB (%d MB) while loading %s, largest sources: %s",
+		b.limit>>20, source, strings.Join(largest, ", "))
+}
+
+// remaining returns the bytes left for the caches
+func (b *memoryBudget) remaining() int64 {
+	if b.used >= b.limit {
+		return 0
+	}
+	return b.limit - b.used
+}
+
+// formatMegabytes formats an estimate such as "12.3 MB"
+func formatMegabytes(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+}
+
+// budgetedCache is a cache whose capacity can be reduced to fit the memory budget
+type budgetedCache struct {
+	name       string
+	entries    *int  // Capacity, in entries
+	entryBytes int64 // Estimated size of an entry
+}
+
+// shedCaches shrinks the caches to the memory the IP block trees leave, all by the same factor, keeping at
+// least one entry each. The lists are loaded first, so the caches give way before a list is refused.
+func shedCaches(budget *memoryBudget, caches []budgetedCache, logger *slog.Logger) {
+	if budget == nil {
+		return
+	}
+
+	var needed int64
+	for _, cache := range caches {
+		needed += int64(*cache.entries) * cache.entryBytes
+	}
+	available := budget.remaining()
+	if needed <= available {
+		budget.used += needed
+		logger.Debug("memory budget", "limit", formatMegabytes(budget.limit), "ip_blocks", formatMegabytes(budget.used-needed), "caches", formatMegabytes(needed))
+		return
+	}
+
+	for _, cache := range caches {
+		before := *cache.entries
+		*cache.entries = int(int64(before) * available / needed)
+		if *cache.entries < 1 {
+			*cache.entries = 1
+		}
+		budget.used += int64(*cache.entries) * cache.entryBytes
+		logger.Warn("cache shrunk to fit MemoryBudgetMB", "cache", cache.name, "entries", *cache.entries, "configured", before)
+	}
+}
+
+// budgetedCaches lists the enabled caches of a plugin instance
+func budgetedCaches(rows *rangeCache, dnsbl *dnsblChecker, bots *verifiedBots, decisions *decisionService) []budgetedCache {
+	var caches []budgetedCache
+	if rows != nil {
+		caches = append(caches, budgetedCache{name: "RangeCacheSize", entries: &rows.maxSize, entryBytes: rangeCacheEntryBytes})
+	}
+	if dnsbl != nil && dnsbl.cacheTTL > 0 {
+		caches = append(caches, budgetedCache{name: "DNSBL", entries: &dnsbl.maxEntries, entryBytes: dnsblCacheEntryBytes})
+	}
+	if bots != nil && bots.cacheTTL > 0 {
+		caches = append(caches, budgetedCache{name: "VerifiedBots", entries: &bots.maxEntries, entryBytes: botCacheEntryBytes})
+	}
+	if decisions != nil && decisions.cacheTTL > 0 {
+		caches = append(caches, budgetedCache{name: "DecisionService", entries: &decisions.maxEntries, entryBytes: decisionCacheEntryBytes})
+	}
+	return caches
+}
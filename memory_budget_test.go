@@ -0,0 +1,79 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBudget_RefusesLists(t *testing.T) {
+	dir := t.TempDir()
+	var lines strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&lines, "10.%d.%d.%d/32\n", i>>16, (i>>8)&0xff, i&0xff)
+	}
+	bigFile := filepath.Join(dir, "big.txt")
+	if err := os.WriteFile(bigFile, []byte(lines.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.BlockedIPBlocks = []string{"192.0.2.0/24"}
+	cfg.BlockedIPBlocksDir = dir
+	cfg.MemoryBudgetMB = 1
+
+	_, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err == nil {
+		t.Fatal("expected the lists to exceed the memory budget")
+	}
+	for _, want := range []string{"MemoryBudgetMB (1 MB)", bigFile + " (", "BlockedIPBlocks ("} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %v", want, err)
+		}
+	}
+
+	// The same lists load with enough room
+	cfg.MemoryBudgetMB = 64
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	if blocks := plugin.blockedIPBlocks; blocks.Count() != 20001 || blocks.MemoryBytes() <= 1<<20 {
+		t.Errorf("expected 20001 blocks above 1 MB, got %d using %d bytes", blocks.Count(), blocks.MemoryBytes())
+	}
+}
+
+func TestMemoryBudget_ShedsCaches(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.RangeCacheSize = 100000
+	cfg.MemoryBudgetMB = 1
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected the cache to shrink instead of an error, got: %v", err)
+	}
+	defer plugin.Close()
+	rows := plugin.rangeCache
+	if rows.maxSize <= 0 || int64(rows.maxSize)*rangeCacheEntryBytes > 1<<20 {
+		t.Errorf("expected the range cache to fit in 1 MB, got %d rows", rows.maxSize)
+	}
+
+	// Caches that fit are left alone
+	cfg.MemoryBudgetMB = 64
+	roomy, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer roomy.Close()
+	if size := roomy.rangeCache.maxSize; size != 100000 {
+		t.Errorf("expected 100000 rows, got %d", size)
+	}
+}
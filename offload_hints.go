@@ -0,0 +1,131 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/fnv"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OffloadHints are the per-CIDR verdicts an external agent can program into XDP/eBPF maps.
+// Bans apply first; otherwise the longest matching prefix of Allow and Drop wins, Allow on equal length.
+// Serial changes whenever the content does.
+type OffloadHints struct {
+	Serial string       `json:"serial"`
+	Bans   []DynamicBan `json:"bans"`
+	Allow  []string     `json:"allow"`
+	Drop   []string     `json:"drop"`
+}
+
+// offloadHints caches the aggregated IP block verdicts, which only change with a new plugin instance
+type offloadHints struct {
+	once   sync.Once
+	allow  []string
+	drop   []string
+	serial []byte // Hash of allow and drop
+}
+
+// build aggregates the IP blocks. An aggregated block is only used when no block of the other list lies
+// inside it, otherwise the shorter prefix could change which list wins there.
+func (h *offloadHints) build(allowed, blocked *IpLookupFileMonitor) {
+	h.once.Do(func() {
+		allowBlocks, dropBlocks := monitorPrefixes(allowed), monitorPrefixes(blocked)
+		h.allow = prefixStrings(aggregateAgainst(allowBlocks, dropBlocks))
+		h.drop = prefixStrings(aggregateAgainst(dropBlocks, allowBlocks))
+
+		hash := fnv.New64a()
+		for _, list := range [][]string{h.allow, {"|"}, h.drop} {
+			for _, cidr := range list {
+				hash.Write([]byte(cidr + "\n"))
+			}
+		}
+		h.serial = hash.Sum(nil)
+	})
+}
+
+// monitorPrefixes returns the blocks of a monitor, nil when there is none
+func monitorPrefixes(monitor *IpLookupFileMonitor) []*net.IPNet {
+	if monitor == nil {
+		return nil
+	}
+	var blocks []*net.IPNet
+	for _, hits := range monitor.HitCounts() {
+		if _, block, err := net.ParseCIDR(hits.CIDR); err == nil {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// aggregateAgainst aggregates blocks, keeping the original blocks of every merged block that contains one of others
+func aggregateAgainst(blocks, others []*net.IPNet) []*net.IPNet {
+	original := make(map[string]struct{}, len(blocks))
+	for _, block := range blocks {
+		original[block.String()] = struct{}{}
+	}
+	sortedBlocks, sortedOthers := sortedByStart(blocks), sortedByStart(others)
+
+	var result []*net.IPNet
+	for _, merged := range aggregateCIDRs(blocks) {
+		if _, unchanged := original[merged.String()]; unchanged || len(blocksWithin(merged, sortedOthers)) == 0 {
+			result = append(result, merged)
+			continue
+		}
+		result = append(result, blocksWithin(merged, sortedBlocks)...)
+	}
+	return result
+}
+
+// sortedByStart returns a copy of the blocks sorted by start address
+func sortedByStart(blocks []*net.IPNet) []*net.IPNet {
+	sorted := make([]*net.IPNet, len(blocks))
+	copy(sorted, blocks)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].IP.To16(), sorted[j].IP.To16()) < 0 })
+	return sorted
+}
+
+// blocksWithin returns the blocks, sorted by start address, that lie within the network
+func blocksWithin(network *net.IPNet, sorted []*net.IPNet) []*net.IPNet {
+	ones, bits := network.Mask.Size()
+	i := sort.Search(len(sorted), func(i int) bool { return bytes.Compare(sorted[i].IP.To16(), network.IP.To16()) >= 0 })
+	var within []*net.IPNet
+	for ; i < len(sorted) && network.Contains(sorted[i].IP); i++ {
+		// Blocks starting at the same address may be wider than the network
+		if otherOnes, otherBits := sorted[i].Mask.Size(); otherBits == bits && otherOnes >= ones {
+			within = append(within, sorted[i])
+		}
+	}
+	return within
+}
+
+// prefixStrings formats blocks as CIDR strings
+func prefixStrings(blocks []*net.IPNet) []string {
+	cidrs := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		cidrs = append(cidrs, block.String())
+	}
+	return cidrs
+}
+
+// OffloadHints returns the dynamic bans and the aggregated allowed and blocked IP blocks. In scoring mode
+// IP blocks only contribute weights, so Allow and Drop are empty.
+func (p Plugin) OffloadHints() OffloadHints {
+	hints := OffloadHints{Bans: []DynamicBan{}, Allow: []string{}, Drop: []string{}}
+	hash := fnv.New64a()
+	if p.offloadHints != nil && p.scoring == nil {
+		p.offloadHints.build(p.allowedIPBlocks, p.blockedIPBlocks)
+		hints.Allow, hints.Drop = p.offloadHints.allow, p.offloadHints.drop
+		hash.Write(p.offloadHints.serial)
+	}
+	if bans := p.DynamicBans(); bans != nil {
+		hints.Bans = bans
+	}
+	for _, ban := range hints.Bans {
+		hash.Write([]byte(ban.CIDR + "," + ban.Expires.UTC().Format(time.RFC3339) + "\n"))
+	}
+	hints.Serial = hex.EncodeToString(hash.Sum(nil))
+	return hints
+}
@@ -0,0 +1,69 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOffloadHints(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedIPBlocks = []string{"192.0.2.0/24"}
+	// The first pair merged into 192.0.2.0/24 would lose against the allowed block on the equal prefix
+	cfg.BlockedIPBlocks = []string{"192.0.2.0/25", "192.0.2.128/25", "198.51.100.0/25", "198.51.100.128/25"}
+	cfg.AdminPath = "/.geoblock"
+	cfg.AdminToken = "s3cret"
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	hints := plugin.OffloadHints()
+	if want := []string{"192.0.2.0/24"}; !reflect.DeepEqual(hints.Allow, want) {
+		t.Errorf("expected allow %v, got %v", want, hints.Allow)
+	}
+	if want := []string{"192.0.2.0/25", "192.0.2.128/25", "198.51.100.0/24"}; !reflect.DeepEqual(hints.Drop, want) {
+		t.Errorf("expected drop %v, got %v", want, hints.Drop)
+	}
+
+	offload := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/.geoblock/offload", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := offload("")
+	var served OffloadHints
+	if err := json.Unmarshal(rr.Body.Bytes(), &served); err != nil || served.Serial != hints.Serial {
+		t.Fatalf("expected the hints with serial %s, got %q (%v)", hints.Serial, rr.Body.String(), err)
+	}
+	etag := rr.Header().Get("ETag")
+	if rr := offload(etag); rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for an unchanged serial, got %d", rr.Code)
+	}
+
+	// A ban changes the serial
+	if err := plugin.BanIP("203.0.113.7", time.Hour); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	rr = offload(etag)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("expected new hints after a ban, got %d with ETag %s", rr.Code, rr.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,183 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+)
+
+// Option configures a Plugin created with NewFromOptions
+type Option func(*embedOptions)
+
+// embedOptions holds the configuration collected by the functional options
+type embedOptions struct {
+	name     string
+	cfg      *Config
+	lookuper Lookuper
+}
+
+// WithConfig uses cfg (including its Enabled flag) as the base configuration.
+// Options applied afterwards modify a copy of it.
+func WithConfig(cfg *Config) Option {
+	return func(o *embedOptions) {
+		if cfg != nil {
+			copied := *cfg
+			o.cfg = &copied
+		}
+	}
+}
+
+// WithName sets the instance name used in log entries (default: "geoblock")
+func WithName(name string) Option {
+	return func(o *embedOptions) { o.name = name }
+}
+
+// WithDatabaseFilePath sets the path to the ip2location database file or the directory containing it
+func WithDatabaseFilePath(path string) Option {
+	return func(o *embedOptions) { o.cfg.DatabaseFilePath = path }
+}
+
+// WithAllowedCountries sets the countries to allow (ISO 3166-1 alpha-2)
+func WithAllowedCountries(countries ...string) Option {
+	return func(o *embedOptions) { o.cfg.AllowedCountries = countries }
+}
+
+// WithBlockedCountries sets the countries to block (ISO 3166-1 alpha-2)
+func WithBlockedCountries(countries ...string) Option {
+	return func(o *embedOptions) { o.cfg.BlockedCountries = countries }
+}
+
+// WithAllowedIPBlocks sets the CIDR blocks to allow
+func WithAllowedIPBlocks(cidrs ...string) Option {
+	return func(o *embedOptions) { o.cfg.AllowedIPBlocks = cidrs }
+}
+
+// WithBlockedIPBlocks sets the CIDR blocks to block
+func WithBlockedIPBlocks(cidrs ...string) Option {
+	return func(o *embedOptions) { o.cfg.BlockedIPBlocks = cidrs }
+}
+
+// WithDefaultAllow sets the behavior when an IP matches no rules
+func WithDefaultAllow(allow bool) Option {
+	return func(o *embedOptions) { o.cfg.DefaultAllow = allow }
+}
+
+// WithAllowPrivate sets whether private/internal networks are allowed
+func WithAllowPrivate(allow bool) Option {
+	return func(o *embedOptions) { o.cfg.AllowPrivate = allow }
+}
+
+// WithIPHeaders sets the headers the client IP is extracted from, and the strategy to apply to them
+func WithIPHeaders(strategy string, headers ...string) Option {
+	return func(o *embedOptions) {
+		o.cfg.IPHeaderStrategy = strategy
+		o.cfg.IPHeaders = headers
+	}
+}
+
+// WithLookuper resolves countries with lookuper instead of an ip2location database, e.g. a static
+// map in tests. The database options are ignored and no BIN file is needed.
+func WithLookuper(lookuper Lookuper) Option {
+	return func(o *embedOptions) { o.lookuper = lookuper }
+}
+
+// WithLogging sets the log level ("debug", "info", "warn", "error"), format ("json", "text") and
+// destination (empty for stdout, or a file path)
+func WithLogging(level, format, path string) Option {
+	return func(o *embedOptions) {
+		o.cfg.LogLevel = level
+		o.cfg.LogFormat = format
+		o.cfg.LogPath = path
+	}
+}
+
+// NewFromOptions creates a Plugin outside of Traefik, for Go programs that want to embed the same
+// geoblocking engine. It starts from CreateConfig() with the plugin enabled and applies the options
+// in order. Use CheckAllowed and Lookup directly, or Wrap to use it as a net/http middleware.
+// Call Close when the Plugin is no longer needed.
+func NewFromOptions(opts ...Option) (*Plugin, error) {
+	o := &embedOptions{
+		name: "geoblock",
+		cfg:  CreateConfig(),
+	}
+	o.cfg.Enabled = true
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return newPlugin(context.Background(), noopNextHandler(), o.cfg, o.name, o.lookuper)
+}
+
+// Wrap returns a copy of the plugin that passes allowed requests to next, so the same
+// instance (and database) can be shared across several handlers or routers.
+func (p *Plugin) Wrap(next http.Handler) http.Handler {
+	wrapped := *p
+	wrapped.next = next
+	return &wrapped
+}
+
+// Close writes pending country statistics, quota counters and decisions, stops the background goroutines (log
+// queue, statistics pusher, range and feed refreshers, ban page and config overlay watchers) once no other
+// instance uses them and releases the database factory held by the plugin.
+// The factory and its database are closed once no other plugin instance uses them.
+// Plugins created by Traefik are never closed.
+func (p *Plugin) Close() error {
+	var err error
+	if p.countryStats != nil {
+		err = p.countryStats.flush()
+	}
+	if p.countryQuotas != nil {
+		if flushErr := p.countryQuotas.counters.flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if p.decisionLog != nil {
+		if flushErr := p.decisionLog.writer.flush(); err == nil {
+			err = flushErr
+		}
+	}
+	if p.logQueue != nil {
+		p.logQueue.close()
+	}
+	if p.statsPusher != nil {
+		releaseStatsPusher(p.statsPusher)
+		p.statsPusher = nil
+	}
+	if p.cloudFront != nil {
+		releaseCloudFrontRanges(p.cloudFront)
+		p.cloudFront = nil
+	}
+	if p.searchEngines != nil {
+		releaseCrawlerRanges(p.searchEngines)
+		p.searchEngines = nil
+	}
+	if p.bogons != nil {
+		releaseBogonList(p.bogons)
+		p.bogons = nil
+	}
+	if p.threatIntel != nil {
+		releaseThreatIntelFeed(p.threatIntel)
+		p.threatIntel = nil
+	}
+	if p.banPageFile != nil {
+		releaseBanPage(p.banPageFile)
+		p.banPageFile = nil
+	}
+	if p.configOverlay != nil {
+		releaseConfigOverlay(p.configOverlay)
+		p.configOverlay = nil
+	}
+
+	if p.factory == nil {
+		return err
+	}
+	releaseDatabaseFactory(p.factory)
+	p.factory = nil
+	p.db = nil
+	return err
+}
+
+// noopNextHandler is used as next handler for plugins that are not part of a middleware chain
+func noopNextHandler() http.Handler {
+	return http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+}
@@ -0,0 +1,310 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewFromOptions(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	plugin, err := NewFromOptions(
+		WithName("embedded"),
+		WithDatabaseFilePath(tinyDbFilePath),
+		WithAllowedCountries("AU"),
+		WithBlockedIPBlocks("1.1.1.128/25"),
+		WithIPHeaders(IPHeaderStrategyCheckFirst, "x-real-ip"),
+		WithLogging("error", "text", ""),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	allowed, country, phase, err := plugin.CheckAllowed("1.1.1.1")
+	if err != nil || !allowed || country != "AU" || phase != PhaseAllowedCountry {
+		t.Errorf("expected 1.1.1.1 to be allowed as AU, got allowed=%v country=%s phase=%s err=%v", allowed, country, phase, err)
+	}
+
+	allowed, _, phase, _ = plugin.CheckAllowed("1.1.1.200")
+	if allowed || phase != PhaseBlockedIPBlock {
+		t.Errorf("expected 1.1.1.200 to be blocked by IP block, got allowed=%v phase=%s", allowed, phase)
+	}
+
+	allowed, _, _, _ = plugin.CheckAllowed("8.8.8.8")
+	if allowed {
+		t.Error("expected 8.8.8.8 to be blocked by default")
+	}
+
+	country, err = plugin.Lookup("8.8.8.8")
+	if err != nil || country != "US" {
+		t.Errorf("expected US for 8.8.8.8, got %s (err: %v)", country, err)
+	}
+}
+
+func TestNewFromOptions_InvalidConfig(t *testing.T) {
+	plugin, err := NewFromOptions(WithDatabaseFilePath(tinyDbFilePath), WithIPHeaders("Bogus", "x-real-ip"))
+	if err == nil {
+		t.Error("expected error for invalid strategy, but got none")
+	}
+	if plugin != nil {
+		t.Error("expected plugin to be nil")
+	}
+}
+
+// staticLookuper resolves countries from a fixed map
+type staticLookuper map[string]string
+
+func (l staticLookuper) LookupCountry(ip string) (string, error) {
+	if country, ok := l[ip]; ok {
+		return country, nil
+	}
+	if ip == "203.0.113.99" {
+		return "", errors.New("lookup failed")
+	}
+	return "-", nil
+}
+
+func TestNewFromOptions_WithLookuper(t *testing.T) {
+	plugin, err := NewFromOptions(
+		WithDatabaseFilePath("/nonexistent/database.bin"),
+		WithLookuper(staticLookuper{"203.0.113.1": "FR", "203.0.113.2": "CN"}),
+		WithAllowedCountries("FR"),
+		WithLogging("error", "text", ""),
+	)
+	if err != nil {
+		t.Fatalf("expected no error without a database, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		ip          string
+		wantAllowed bool
+		wantCountry string
+	}{
+		{"203.0.113.1", true, "FR"},
+		{"203.0.113.2", false, "CN"},
+		{"203.0.113.3", false, "-"},
+	}
+	for _, tt := range tests {
+		allowed, country, _, err := plugin.CheckAllowed(tt.ip)
+		if err != nil || allowed != tt.wantAllowed || country != tt.wantCountry {
+			t.Errorf("%s: expected %v/%s, got %v/%s (err: %v)", tt.ip, tt.wantAllowed, tt.wantCountry, allowed, country, err)
+		}
+	}
+
+	if _, err := plugin.Lookup("203.0.113.99"); err == nil {
+		t.Error("expected the lookuper error to be returned")
+	}
+}
+
+func TestNewFromOptions_WithConfig(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.BlockedCountries = []string{"US"}
+	cfg.DefaultAllow = true
+
+	plugin, err := NewFromOptions(WithConfig(cfg), WithBlockedCountries("DE"))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	if len(cfg.BlockedCountries) != 1 || cfg.BlockedCountries[0] != "US" {
+		t.Error("expected the original config not to be modified")
+	}
+
+	if allowed, _, _, _ := plugin.CheckAllowed("8.8.8.8"); !allowed {
+		t.Error("expected US to be allowed after overriding blocked countries")
+	}
+	if allowed, _, _, _ := plugin.CheckAllowed("85.214.132.117"); allowed {
+		t.Error("expected DE to be blocked")
+	}
+}
+
+func TestPlugin_Wrap(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	plugin, err := NewFromOptions(
+		WithDatabaseFilePath(tinyDbFilePath),
+		WithAllowedCountries("AU"),
+		WithIPHeaders(IPHeaderStrategyCheckAll, "x-real-ip"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	handler := plugin.Wrap(&noopHandler{})
+
+	for ip, want := range map[string]int{"1.1.1.1": http.StatusTeapot, "8.8.8.8": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("expected status %d for %s, got %d", want, ip, rr.Code)
+		}
+	}
+}
+
+func TestPlugin_Close_ReleasesSharedFactory(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	first, err := NewFromOptions(WithDatabaseFilePath(tinyDbFilePath))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	second, err := NewFromOptions(WithDatabaseFilePath(tinyDbFilePath))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Errorf("expected no error on close, got: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Errorf("expected second close to be a no-op, got: %v", err)
+	}
+
+	// The factory is still in use by the second plugin
+	if _, err := second.Lookup("1.1.1.1"); err != nil {
+		t.Errorf("expected shared database to remain open, got: %v", err)
+	}
+
+	second.Close()
+
+	factoryMutex.RLock()
+	remaining := len(factories)
+	factoryMutex.RUnlock()
+	if remaining != 0 {
+		t.Errorf("expected factory to be removed after last release, %d remaining", remaining)
+	}
+}
+
+func TestPlugin_Close_StopsBackgroundGoroutines(t *testing.T) {
+	requests := make(chan struct{}, 64)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests <- struct{}{}
+		http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	banPage := filepath.Join(dir, "ban.html")
+	if err := os.WriteFile(banPage, []byte("<p>blocked</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.BanHtmlFilePath = banPage
+	cfg.BanHtmlReloadSeconds = 1
+	cfg.ConfigOverlayFile = filepath.Join(dir, "overlay.yaml")
+	cfg.ConfigOverlayIntervalSeconds = 1
+	cfg.BlockBogons = true
+	cfg.BogonFeedURLs = []string{server.URL + "/bogons.txt"}
+	cfg.BogonFeedRefreshSeconds = 1
+	cfg.AllowSearchEngines = true
+	cfg.SearchEngineFeedURLs = []string{server.URL + "/crawlers.json"}
+	cfg.SearchEngineRefreshSeconds = 1
+	cfg.ThreatIntelURL = server.URL + "/attributes/restSearch"
+	cfg.ThreatIntelFormat = ThreatIntelFormatMISP
+	cfg.ThreatIntelRefreshSeconds = 1
+
+	first, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	second, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	bogons, searchEngines, threatIntel := second.bogons, second.searchEngines, second.threatIntel
+	stops := map[string]chan struct{}{
+		"ban page":       second.banPageFile.stop,
+		"config overlay": second.configOverlay.stop,
+		"bogons":         bogons.stop,
+		"search engines": searchEngines.stop,
+		"threat intel":   threatIntel.stop,
+	}
+	registered := func() []string {
+		var names []string
+		banPageFilesMutex.Lock()
+		if _, ok := banPageFiles[banPage]; ok {
+			names = append(names, "ban page")
+		}
+		banPageFilesMutex.Unlock()
+		configOverlaysMutex.Lock()
+		if _, ok := configOverlays[cfg.ConfigOverlayFile]; ok {
+			names = append(names, "config overlay")
+		}
+		configOverlaysMutex.Unlock()
+		bogonListsMutex.Lock()
+		if _, ok := bogonLists[bogons.key]; ok {
+			names = append(names, "bogons")
+		}
+		bogonListsMutex.Unlock()
+		crawlerRangeListsMutex.Lock()
+		if _, ok := crawlerRangeLists[searchEngines.key]; ok {
+			names = append(names, "search engines")
+		}
+		crawlerRangeListsMutex.Unlock()
+		threatIntelFeedsMutex.Lock()
+		if _, ok := threatIntelFeeds[threatIntel.key]; ok {
+			names = append(names, "threat intel")
+		}
+		threatIntelFeedsMutex.Unlock()
+		return names
+	}
+
+	// The second instance still uses everything the first one shared with it
+	first.Close()
+	if names := registered(); len(names) != len(stops) {
+		t.Errorf("expected every watcher and refresher to keep running, only %v are", names)
+	}
+	for name, stop := range stops {
+		select {
+		case <-stop:
+			t.Errorf("%s: stopped while an instance uses it", name)
+		default:
+		}
+	}
+
+	second.Close()
+	if names := registered(); len(names) > 0 {
+		t.Errorf("expected the registries to be empty, %v remain", names)
+	}
+	for name, stop := range stops {
+		select {
+		case <-stop:
+		default:
+			t.Errorf("%s: not stopped after the last instance was closed", name)
+		}
+	}
+
+	// Refreshes in flight when Close was called may still arrive, nothing starts afterwards
+	time.Sleep(200 * time.Millisecond)
+	for len(requests) > 0 {
+		<-requests
+	}
+	select {
+	case <-requests:
+		t.Error("expected no refresh after the last instance was closed")
+	case <-time.After(2500 * time.Millisecond):
+	}
+}
@@ -2,17 +2,19 @@ package traefik_geoblock
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"log/slog"
 )
 
 //go:generate go run ./tools/dbdownload/main.go -o ./IP2LOCATION-LITE-DB1.IPV6.BIN
+//go:generate go run ./tools/dbgen -i ./testdata/dbgen/ranges.csv -o ./testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN -date 20250401
 
 // Add this constant near the top of the file, after imports
 const PrivateIpCountryAlias = "PRIVATE"
@@ -27,11 +29,45 @@ const (
 	PhaseDefaultAllow   = "default_allow"
 )
 
+// isCountryBlockPhase reports whether a blocked phase comes from the country rules rather than
+// from the IP itself (IP blocks, bogons, blocklists), so softer remediations may apply to it
+func isCountryBlockPhase(phase string) bool {
+	switch phase {
+	case PhaseBlockedCountry, PhaseDefaultAllow, PhaseUnknownCountry, PhaseRegistrationMismatch:
+		return true
+	}
+	return false
+}
+
+// skipLookupConflicts returns the options deciding on the country of requests allowed by an IP block,
+// which SkipLookupForAllowedIPBlocks would leave without one
+func skipLookupConflicts(cfg *Config, rules ruleSet) []string {
+	var conflicts []string
+	if len(cfg.GeoPools) > 0 {
+		conflicts = append(conflicts, "geoPools")
+	}
+	if len(cfg.MaintenanceCountries) > 0 {
+		conflicts = append(conflicts, "maintenanceCountries")
+	}
+	if len(cfg.ConsentCountries) > 0 {
+		conflicts = append(conflicts, "consentCountries")
+	}
+	if rules.usesCountry() {
+		conflicts = append(conflicts, "rules comparing the country")
+	}
+	return conflicts
+}
+
 // IP header strategy constants
 const (
 	IPHeaderStrategyCheckAll              = "CheckAll"
 	IPHeaderStrategyCheckFirst            = "CheckFirst"
 	IPHeaderStrategyCheckFirstNonePrivate = "CheckFirstNonePrivate"
+
+	// Enrichment policies: whether requests that are never blocked still pay for a country lookup
+	EnrichmentPolicyAlways                 = "Always"                 // Bypassed and ignored requests are still enriched
+	EnrichmentPolicySkipBypassed           = "SkipBypassed"           // Bypassed requests pass through without lookup
+	EnrichmentPolicySkipBypassedAndIgnored = "SkipBypassedAndIgnored" // Bypassed and ignored-verb requests pass through without lookup
 )
 
 // Config defines the plugin configuration.
@@ -42,49 +78,341 @@ type Config struct {
 	DefaultAllow     bool   // Default behavior when IP matches no rules
 	AllowPrivate     bool   // Allow requests from private/internal networks
 	BanIfError       bool   // Ban requests if IP lookup fails
+	OnParseError     string // "allow" or "block" when a client IP can't be parsed (default from BanIfError)
+	OnLookupError    string // "allow", "block" or "last-known" when a lookup fails (default from BanIfError)
+	NoIPPolicy       string // No client IP in the IP headers: "allow" (default), "block" or "use_remote_addr"
+	OnEmptyHeaders   string // Former name of NoIPPolicy, still accepted
+	StrictFiles      bool   // Fail startup on a missing BanHtmlFilePath or IP block directory and on unreadable block files
 
 	// Country-based rules (ISO 3166-1 alpha-2 format)
-	AllowedCountries []string // Whitelist of countries to allow
-	BlockedCountries []string // Blocklist of countries to block
+	AllowedCountries      []string // Whitelist of countries to allow
+	BlockedCountries      []string // Blocklist of countries to block
+	CountryListPrecedence string   // Country in both lists: "allow_first" (default), "block_first", or "error_if_both" to reject such configs
+	UnknownCountryPolicy  string   // IPs without country ("-"): "allow", "block", "zz" (use "ZZ" in the lists), empty for DefaultAllow
+
+	// Per address family overrides of DefaultAllow and the country lists
+	IPv4Policy AddressFamilyPolicy // Rules for IPv4 clients (unset fields inherit the global rules)
+	IPv6Policy AddressFamilyPolicy // Rules for IPv6 clients (unset fields inherit the global rules)
+
+	// Evaluate the IPv4 embedded in 6to4 (2002::/16) and Teredo (2001::/32) addresses instead of the
+	// tunnel address, whose location is the relay's. IP blocks, IPv4Policy and the lookup use the IPv4.
+	DecodeTunneledIPv4 bool
+
+	// Per virtual host overrides, selected by the Host header
+	HostRules         []HostRule // Rules for some hosts (unset fields inherit the global and family rules)
+	UnknownHostPolicy string     // Hosts matching no HostRules: "allow", "log" (default) or "block"
+
+	// Named profiles, so many routers can share one middleware and database with different policies.
+	// A profile applies instead of the HostRules.
+	Profiles      map[string]Profile // Policies by name (unset fields inherit the global and family rules)
+	ProfileHeader string             // Request header naming the profile, set by the routers (e.g. with a headers middleware)
 
 	// IP-based rules
 	AllowedIPBlocks    []string // Whitelist of CIDR blocks
 	BlockedIPBlocks    []string // Blocklist of CIDR blocks
-	AllowedIPBlocksDir string   // Path to directory containing allowed CIDR block files (.txt)
-	BlockedIPBlocksDir string   // Path to directory containing blocked CIDR block files (.txt)
+	AllowedIPBlocksDir string   // Path to directory containing allowed CIDR block files (.txt, .txt.gz)
+	BlockedIPBlocksDir string   // Path to directory containing blocked CIDR block files (.txt, .txt.gz)
+	MaxIPBlockRules    int      // Startup fails when the allowed or blocked blocks exceed this count (0 for no limit)
+	IPBlockLoadWorkers int      // Block files parsed in parallel (0 for one per CPU)
+	AggregateIPBlocks  bool     // Merge contained and adjacent blocks at load to save memory (match prefix lengths and hit counts then refer to the merged blocks)
+
+	// Consent gating: requests from these countries (or groups such as "EU") to these paths
+	// must carry a consent cookie or header, otherwise they are redirected to the consent URL
+	ConsentCountries   []string // Countries or country groups ("EU", "EEA") requiring consent
+	ConsentPaths       []string // Path prefixes requiring consent (empty for all paths)
+	ConsentCookieName  string   // Cookie carrying the consent token
+	ConsentHeaderName  string   // Header carrying the consent token
+	ConsentRedirectURL string   // URL to redirect to when consent is missing (return_to is appended)
+
+	// Maintenance mode: requests from these countries get a 503, independent from the allow/block lists
+	MaintenanceCountries    []string // Countries or country groups ("EU", "EEA") under maintenance
+	MaintenanceHtmlFilePath string   // Custom HTML page for maintenance responses
+	MaintenanceRetryAfter   string   // Retry-After header value (seconds or HTTP date)
+
+	// Load shedding: during incidents, countries can be answered with a 503 and Retry-After for a while,
+	// through LoadShedFile or the admin API. Unlike MaintenanceCountries and the block lists, entries expire.
+	LoadShedFile            string // "country,expiry" lines, re-read when changed (empty keeps sheds in memory)
+	LoadShedIntervalSeconds int    // How often LoadShedFile is checked for changes
+	LoadShedMaxSeconds      int    // Longest shed accepted from the admin API and ShedCountry (0 only allows the file)
+
+	// Gradual rollout: only this percentage of client IPs (by stable hash) gets blocked,
+	// the others are logged as monitor-only. Unset enforces for everybody, 0 for nobody.
+	RolloutPercent *int
+
+	// Address families where blocks are enforced: "ipv4", "ipv6", or both (empty, the default). Blocks of
+	// the other family are logged as monitor-only, e.g. to observe IPv6 decisions before enforcing them.
+	EnforceAddressFamilies []string
+
+	// Countries that a configuration change moves from allowed to blocked are let through and logged
+	// as "would block (grace)" for this many minutes after the change. 0 blocks them immediately.
+	CountryBlockGraceMinutes int
+
+	// Country lists maintained in a spreadsheet: a country_code,action(,note) CSV read at startup,
+	// replacing AllowedCountries and BlockedCountries. Every invalid row fails the startup.
+	CountryPolicyFile string
+
+	// Country lists, DefaultAllow and IP block lists read from a JSON file and applied to the running
+	// middleware when it changes, without a provider reload. A ".csv" file is read like CountryPolicyFile.
+	ConfigOverlayFile            string // Path of the overlay file (empty disables it)
+	ConfigOverlayIntervalSeconds int    // How often the file is checked for changes
+
+	// Scoring mode: when ScoreThreshold is set, public IPs are not decided by the lists alone.
+	// Every signal adds its weight and the request is blocked when the total reaches the threshold.
+	ScoreThreshold            int            // Score at which requests are blocked (0 disables scoring)
+	ScoreCountryWeights       map[string]int // Weight per country code or group ("EU", "EEA")
+	ScoreUnknownCountryWeight int            // Weight when the database has no country for the IP
+	ScoreAllowedCountryWeight int            // Weight when the country is in AllowedCountries
+	ScoreBlockedCountryWeight int            // Weight when the country is in BlockedCountries
+	ScoreAllowedIPBlockWeight int            // Weight when the IP is in AllowedIPBlocks
+	ScoreBlockedIPBlockWeight int            // Weight when the IP is in BlockedIPBlocks
+	ScoreDNSBLWeight          int            // Weight when the IP is listed in a DNSBL zone (DNSBLAction "score")
+
+	// DNS blocklists, checked for public IPs regardless of country (allowed IP blocks skip them)
+	DNSBLZones        []string // Zones to query, e.g. "zen.spamhaus.org" (empty disables DNSBL lookups)
+	DNSBLAction       string   // "block" (default), "score" or "log" for listed IPs
+	DNSBLTimeoutMs    int      // Latency budget per request, slower answers are cached for later requests
+	DNSBLCacheSeconds int      // How long answers are cached (0 disables caching)
+
+	// Verified crawlers: requests with a crawler User-Agent whose IP passes reverse DNS and forward
+	// confirmation are exempt from country blocks (IP blocks, bogons and the like still apply)
+	VerifiedBots             []string // "googlebot", "bingbot", "applebot", "yandexbot", "baiduspider"
+	VerifiedBotsTimeoutMs    int      // Budget for the DNS lookups of one verification
+	VerifiedBotsCacheSeconds int      // How long verification results are cached per IP (0 disables caching)
+
+	// User-Agent rules: allowed requests from a country are blocked when their User-Agent matches one of the
+	// country's regular expressions, e.g. scripted clients from some countries while browsers pass
+	UAPatternsByCountry map[string][]string // Country code or group ("EU") to User-Agent patterns
+
+	// Search engines: IPs in the crawler ranges published by the search engines are exempt from country blocks
+	AllowSearchEngines         bool     // Download the crawler ranges and exempt them
+	SearchEngineFeedURLs       []string // JSON range files (empty uses the Googlebot and Bingbot files)
+	SearchEngineRefreshSeconds int      // Range refresh interval
+
+	// CloudFront: the country of CloudFront-Viewer-Country is used instead of the database, only when the peer
+	// is in the CloudFront ranges of the AWS range file. The country rules and IP rules still apply.
+	TrustCloudFrontViewerCountry bool   // Trust CloudFront-Viewer-Country from CloudFront peers
+	CloudFrontRangesURL          string // AWS range file (empty uses https://ip-ranges.amazonaws.com/ip-ranges.json)
+	CloudFrontRefreshSeconds     int    // Range refresh interval
+
+	// Rules: "<condition> => <action>" expressions checked after the built-in rules, the first match decides,
+	// e.g. "country in [CN,RU] and path startsWith '/admin' => block 403"
+	Rules []string
+
+	// External decision service: the final decision is deferred to an OPA or webhook endpoint
+	DecisionServiceURL          string            // Endpoint receiving the request context (empty disables it)
+	DecisionServiceFormat       string            // "webhook" (default) or "opa"
+	DecisionServiceHeaders      map[string]string // Extra headers sent to the service (e.g. Authorization)
+	DecisionServiceTimeoutMs    int               // Request timeout in milliseconds
+	DecisionServiceCacheSeconds int               // How long answers are cached (0 disables caching)
+	DecisionServiceFallback     string            // "local" (default), "allow" or "block" when the service fails
+
+	// QA helper: trusted clients can force the detected country with this header (disabled when empty).
+	// Only honored when the peer and every IP in the chain are private or in the trusted blocks.
+	DebugCountryOverrideHeader          string   // Header carrying the forced country code
+	DebugCountryOverrideTrustedIPBlocks []string // Public CIDRs also allowed to use the override
+
+	// Country statistics: per-country request counts in fixed time buckets, to see which countries
+	// send traffic before enabling blocking. Optionally persisted to a compact ring file.
+	CountryStats              bool   // Enable the country statistics collector
+	CountryStatsFile          string // Ring file to persist the buckets (empty keeps them in memory only)
+	CountryStatsBucketSeconds int    // Duration of one bucket
+	CountryStatsBuckets       int    // Number of buckets kept in the ring
+	CountryStatsSampleRate    int    // Record one request out of N, counts are scaled back up
+
+	// Statistics push for setups without Prometheus: cumulative allowed/blocked counters per country and
+	// error counters, sent to InfluxDB or Graphite on an interval.
+	StatsPushAddress string            // "udp://host:port", "tcp://host:port" or an InfluxDB http(s) write URL (empty disables)
+	StatsPushFormat  string            // "influx" (line protocol) or "graphite" (plaintext)
+	StatsPushSeconds int               // Push interval
+	StatsPushPrefix  string            // Measurement prefix (influx) or first metric path segment (graphite)
+	StatsPushHeaders map[string]string // Headers sent with http pushes, e.g. the InfluxDB Authorization token
+
+	// Per-country request budgets (codes or groups such as "EU", counted per country). Requests allowed
+	// by the country rules are blocked with phase "country_quota" once the budget is used up.
+	CountryDailyQuotas   map[string]int // Allowed requests per UTC day
+	CountryMonthlyQuotas map[string]int // Allowed requests per UTC month
+	CountryQuotaFile     string         // File to persist the counters in (empty keeps them in memory only)
+
+	// Admin endpoint served by the plugin itself (e.g. /stats/countries below this path)
+	// Access is checked independently of the geoblock rules: every configured requirement must be met.
+	AdminPath              string   // Path prefix of the admin endpoint (empty disables it)
+	AdminToken             string   // Bearer token required to access the admin endpoint (optional with the settings below)
+	AdminAllowedCIDRs      []string // Client IPs allowed to reach the admin endpoint (empty for any)
+	AdminRequireClientCert bool     // Require a client certificate verified by Traefik's TLS options (mTLS)
+	AdminClientCertNames   []string // Accepted certificate common or DNS names (empty for any verified certificate)
+
+	// Header spoofing protection: when the direct peer is not a trusted proxy, the IP headers are
+	// ignored and RemoteAddr is the only client IP
+	RequireRemoteAddrMatch bool     // Only trust IP headers set by TrustedProxies
+	TrustedProxies         []string // CIDRs or IPs of the proxies allowed to set IP headers
+
+	// Performance: IPs in AllowedIPBlocks skip the database lookup. Only effective when nothing needs
+	// their country (no CountryHeader, ResponseCountryHeader, CountryCookieName or scoring). Rejected with
+	// GeoPools, MaintenanceCountries, ConsentCountries or Rules comparing the country, which decide on it.
+	SkipLookupForAllowedIPBlocks bool
+
+	// Bogons: reserved and unallocated ranges never legitimately seen as a client address
+	BlockBogons             bool     // Block bogon IPs with their own phase
+	BogonBlocks             []string // Replace the built-in bogon ranges (empty uses the built-in list)
+	BogonFeedURLs           []string // Feeds with one CIDR per line, e.g. the Team Cymru full bogons lists
+	BogonFeedRefreshSeconds int      // Feed refresh interval
+
+	// Threat intelligence: IP indicators of a MISP server or a STIX/TAXII feed are blocked until they expire
+	ThreatIntelURL               string            // MISP attributes/restSearch URL, or STIX bundle / TAXII 2.1 collection objects URL
+	ThreatIntelFormat            string            // "misp" or "stix"
+	ThreatIntelHeaders           map[string]string // Headers sent with every request, e.g. the MISP Authorization key
+	ThreatIntelRefreshSeconds    int               // Feed refresh interval
+	ThreatIntelDefaultTTLSeconds int               // Validity of indicators without an expiry, after they were last seen or modified
+
+	// Custom range to country assignments, checked before the database
+	RangeOverrides     map[string]string // CIDR to country code, checked before RangeOverridesFile
+	RangeOverridesFile string            // "CIDR,COUNTRY" lines or a snapshot compiled with tools/overridegen
+
+	// Registration check: RIR delegation files give the country a range is registered to, which can differ
+	// from where the database geolocates it
+	RegistrationFiles        []string // "delegated-<registry>-extended-latest" files from the five RIRs
+	RequireRegistrationMatch bool     // Allowed countries also need the registration country in AllowedCountries
+
+	// Usage types of the commercial IP2Location editions (DB23 to DB26), checked after the IP blocks
+	BlockedUsageTypes []string // e.g. ["DCH"] to block data centers and hosting, or "MOB" for mobile networks
+
+	// Runtime bans (admin API, auto-escalation) persisted as "cidr,expiry" lines and reloaded at startup
+	DynamicBlocklistFile string // File to persist runtime bans in (empty keeps them in memory only)
+
+	// Export of the runtime bans for a firewall in front of Traefik, rewritten periodically
+	BanExportFile            string // File to write the active bans to (empty disables the export)
+	BanExportFormat          string // "ipset" (default, for ipset restore) or "nftables" (for nft -f)
+	BanExportSetName         string // Sets are named <name>4 and <name>6, the nftables table <name>
+	BanExportIntervalSeconds int    // Time between two exports
+
+	// Honeypot paths: any request for them bans the client IP in the dynamic blocklist, whatever its country
+	TrapPaths      []string // Paths like "/wp-login.php" or "/.env", a trailing "*" matches a prefix
+	TrapBanSeconds int      // Ban duration for trapped IPs (0 bans permanently)
 
 	// Response settings
-	DisallowedStatusCode int    // HTTP status code for blocked requests
-	BanHtmlFilePath      string // Custom HTML template for blocked requests
-	CountryHeader        string // Header to write the country code to
+	DisallowedStatusCode  int    // HTTP status code for blocked requests
+	BanHtmlFilePath       string // Custom HTML template for blocked requests
+	BanHtmlReloadSeconds  int    // Check BanHtmlFilePath for changes at this interval and reload it (0 disables)
+	DisableDefaultBanPage bool   // Return only the status code when no BanHtmlFilePath is set
+	BanAppealURL          string // URL for the {{.AppealURL}} placeholder, e.g. a form to request access
+	CountryHeader         string // Header to write the country code to
+	CountryHeaderFormat   string // CountryHeader values: "code" (default, "US"), "lowercase" ("us") or "name" ("United States")
+	PrivateCountryAlias   string // CountryHeader value for private and loopback IPs (default "PRIVATE"), e.g. "LOCAL"
+	BlockedBodyPolicy     string // Unread body of blocked requests: "drain" (default), "limit" or "close" the connection
+	BlockedBodyLimitBytes int64  // Larger bodies close the connection with the "limit" policy
+
+	// Challenge country blocks instead of banning them, clients passing the challenge get a signed cookie
+	BanMode             string // "block" (default), "challenge" or "drop"
+	ChallengeType       string // "js" (default) sets the cookie from a script, "cookie" sets it on the response
+	ChallengeSecret     string // HMAC key for the challenge cookie, at least 16 characters
+	ChallengeCookieName string // Name of the challenge cookie
+	ChallengeTTLSeconds int    // How long a passed challenge is valid for
+
+	// Country hints on allowed responses, for frontends that localize content
+	ResponseCountryHeader      string // Response header to write the detected country code to
+	CountryCookieName          string // Cookie to store the detected country code in (empty to disable)
+	CountryCookieDomain        string // Cookie Domain attribute (default: host only)
+	CountryCookiePath          string // Cookie Path attribute (default: "/")
+	CountryCookieMaxAgeSeconds int    // Cookie Max-Age in seconds (0 for a session cookie)
+	CountryCookieSecure        bool   // Cookie Secure attribute
+	CountryCookieHttpOnly      bool   // Cookie HttpOnly attribute (leave false so frontend scripts can read it)
+	CountryCookieSameSite      string // Cookie SameSite attribute: "Lax" (default), "Strict" or "None"
+
+	// Routing hint on allowed requests, so load balancers or backends can send users to the nearest cluster
+	GeoPools       map[string]string // Country code or group ("EU") to pool name, e.g. {"EU": "eu", "US": "us"}
+	GeoPoolHeader  string            // Request header carrying the pool name
+	GeoPoolDefault string            // Pool for countries without an entry (empty omits the header)
+
+	// Sticky allow decisions: a signed cookie skips the lookups for the rest of the browsing session
+	DecisionCookieName       string // Cookie carrying the country of allowed clients (empty to disable)
+	DecisionCookieSecret     string // HMAC key for the decision cookie, at least 16 characters
+	DecisionCookieTTLSeconds int    // How long a decision stays valid
+	DecisionCookieSecure     bool   // Cookie Secure attribute
 
 	// Logging configuration
 	LogLevel                    string // Log level: "debug", "info", "warn", "error"
 	LogFormat                   string // Log format: "json" or "text"
-	LogPath                     string // Log destination: "stdout", "stderr", or file path
+	LogPath                     string // Log destination: "stdout", "stderr", file path, or unix:///path.sock
 	LogBannedRequests           bool   // Log blocked requests
 	FileLogBufferSizeBytes      int    // Buffer size for file logging in bytes (default: 1024)
 	FileLogBufferTimeoutSeconds int    // Buffer timeout for file logging in seconds (default: 2)
+	LogQueueSize                int    // Log lines queued for a background writer, dropped when full (0 writes synchronously)
+
+	// Decision log: one "unix_seconds,ip,country,phase,allow|block" line per decision, buffered like file logs,
+	// to replay against a candidate configuration or database before rolling it out (tools/logreplay -decisions)
+	DecisionLogFile string // File the decisions are appended to (empty disables the decision log)
+
+	// Request log level per decision phase: "debug", "info", "warn", "error" or "off", e.g. {"blocked_country": "info",
+	// "allow_private": "debug", "lookup_error": "error"}. Unlisted blocked phases follow LogBannedRequests (info),
+	// unlisted allowed phases are not logged, and lookup and parse errors are logged as errors.
+	LogPhaseLevels map[string]string
+
+	// Privacy: drop, rename or hash fields (e.g. the client IP) in every log entry
+	LogFieldOptions []LogFieldOption // Per-field actions
+	LogHashSalt     string           // Salt prepended to values before hashing
 
 	// BypassHeaders is a map of header names to values that, when matched,
 	// will skip the geoblocking check entirely
 	BypassHeaders map[string]string
 
+	// Signed one-time bypass tokens: "<expiry>.<nonce>.<base64url HMAC-SHA256 of expiry.nonce>"
+	BypassTokenSecret          string // HMAC key, at least 16 characters (empty disables bypass tokens)
+	BypassTokenHeader          string // Request header carrying the token
+	BypassTokenMaxTTLSeconds   int    // Tokens expiring later than this are rejected
+	BypassTokenReplayCacheSize int    // Used tokens remembered until they expire; when full, new tokens are rejected
+
+	// TLS fingerprints, written to FingerprintHeader by a proxy in front of the plugin (JA3, JA4...)
+	FingerprintHeader  string   // Request header carrying the client's TLS fingerprint
+	BypassFingerprints []string // Fingerprints that skip the geoblocking check, like BypassHeaders
+	BlockFingerprints  []string // Fingerprints blocked regardless of country and IP block rules
+
+	// IP header conflicts: the configured IP headers naming different clients
+	ConflictPolicy  string // "ignore" (default), "flag" (log and set ConflictHeader) or "block"
+	ConflictCompare string // "country" (default) or "ip"
+	ConflictHeader  string // Request header set to the conflicting values with the flag and block policies
+
 	// IP extraction settings
-	IPHeaders        []string // List of headers to check for client IP addresses (cannot be empty)
+	IPHeaders        []string // Headers to check for client IP addresses (cannot be empty), "*" wildcards and "regex:" allowed
 	IPHeaderStrategy string   // Strategy for processing multiple IP addresses: "CheckAll", "CheckFirst", "CheckFirstNonePrivate"
+	EnrichmentPolicy string   // Lookups for bypassed/ignored requests: "Always", "SkipBypassed", "SkipBypassedAndIgnored"
+	MaxChainLength   int      // Entries of the IP headers parsed per request, together (0 for no limit)
+	LongChainPolicy  string   // More entries than MaxChainLength: "allow", "log" (default) or "block"
 
 	// HTTP verb filtering
 	IgnoreVerbs []string // List of HTTP verbs to ignore for blocking (still enriched with GeoIP)
 
 	// Remediation settings
 	RemediationHeadersCustomName string // Name of the header to add to blocked responses indicating the phase/reason
+	VerdictHeader                string // Request header to append the verdict to, e.g. "allowed;country=US;phase=allowed_country"
+	AccessLogHeaderPrefix        string // Prefix of the Country, Phase and Verdict request headers for access logs, e.g. "X-Geoblock-"
+	RuleSourceHeader             string // Request header set to the IP block rule that decided and its file:line, e.g. "X-Geoblock-Rule"
+
+	// Startup
+	InitBudgetMs int // Fail the plugin creation when initialization takes longer (0 disables the budget)
+
+	// Performance
+	RangeCacheSize int // Database rows cached per address family, so IPs of a seen row skip the file (0 disables)
+	MemoryBudgetMB int // Estimated memory of the IP block trees and caches: caches shrink first, then startup fails (0 for no limit)
+
+	// Stale database: flag responses and raise log severity while the database is older than DatabaseStaleDays
+	DatabaseStaleDays      int    // Age in days from which the database is stale (0 disables the check)
+	DatabaseStaleHeader    string // Response header set to the age, e.g. "47d", on ban pages
+	DatabaseStaleOnAllowed bool   // Also set the header on allowed responses
 
 	// Auto-update settings
-	DatabaseAutoUpdate      bool   `json:"databaseAutoUpdate,omitempty"`
-	DatabaseAutoUpdateDir   string `json:"databaseAutoUpdateDir,omitempty"`
-	DatabaseAutoUpdateToken string `json:"databaseAutoUpdateToken,omitempty"`
-	DatabaseAutoUpdateCode  string `json:"databaseAutoUpdateCode,omitempty"`
+	DatabaseAutoUpdate           bool   `json:"databaseAutoUpdate,omitempty"`
+	DatabaseAutoUpdateDir        string `json:"databaseAutoUpdateDir,omitempty"`
+	DatabaseAutoUpdateToken      string `json:"databaseAutoUpdateToken,omitempty"`
+	DatabaseAutoUpdateCode       string `json:"databaseAutoUpdateCode,omitempty"`
+	DatabaseAutoUpdateWindow     string `json:"databaseAutoUpdateWindow,omitempty"`     // Daily window for downloads and hot swaps, e.g. "02:00-05:00 UTC" (empty for any time)
+	NoLocalCopy                  bool   `json:"noLocalCopy,omitempty"`                  // Open databases in place (read-only) instead of temp copies, and skip the update lock file
+	DatabaseLocalCopyDir         string `json:"databaseLocalCopyDir,omitempty"`         // Directory for local database copies (defaults to the OS temp directory)
+	DatabaseLocalCopyMaxAgeHours int    `json:"databaseLocalCopyMaxAgeHours,omitempty"` // Delete orphaned local copies older than this on startup (0 disables)
+	DatabaseHotSwapWebhookURL    string `json:"databaseHotSwapWebhookURL,omitempty"`    // POSTed a HotSwapEvent when a hot swap changes the database version
+	DatabaseWarmUp               string `json:"databaseWarmUp,omitempty"`               // Before a database is used: "none" (default), "read" it once into the page cache, or load it into "memory"
+	DatabaseLatencyLogSeconds    int    `json:"databaseLatencyLogSeconds,omitempty"`    // Log database lookup p50/p95/p99 at this interval (0 disables it)
+	DatabaseHeartbeatTarget      string `json:"databaseHeartbeatTarget,omitempty"`      // Shared directory or http(s) URL to publish the database version to, warning about diverging replicas
+	DatabaseHeartbeatSeconds     int    `json:"databaseHeartbeatSeconds,omitempty"`     // Heartbeat interval
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -96,14 +424,57 @@ func CreateConfig() *Config {
 		LogPath:                      "",                                       // Default to traefik
 		BanIfError:                   true,                                     // Default to banning on errors
 		BypassHeaders:                make(map[string]string),                  // Initialize empty map
+		BypassTokenHeader:            "X-Geoblock-Bypass-Token",                // Default bypass token header
+		BypassTokenMaxTTLSeconds:     3600,                                     // One-time tokens are short-lived
+		BypassTokenReplayCacheSize:   100000,                                   // About 10MB of used tokens at most
 		IPHeaders:                    []string{"x-forwarded-for", "x-real-ip"}, // Default IP headers
 		IPHeaderStrategy:             IPHeaderStrategyCheckAll,                 // Default to checking all IPs
+		MaxChainLength:               10,                                       // Longer chains are header stuffing, not proxies
+		EnrichmentPolicy:             EnrichmentPolicyAlways,                   // Default to enriching every request
 		DatabaseAutoUpdateCode:       "DB1",                                    // Default database code
+		DatabaseLocalCopyMaxAgeHours: 24,                                       // Reclaim copies left by previous processes
+		DatabaseStaleHeader:          "X-Geoblock-DB-Stale",                    // Only set once DatabaseStaleDays is reached
 		LogBannedRequests:            true,                                     // Default to logging blocked requests
 		CountryHeader:                "",                                       // Default to empty thus not setting the header
 		RemediationHeadersCustomName: "",                                       // Default to empty thus not setting the header
 		FileLogBufferSizeBytes:       1024,                                     // Default buffer size 1024 bytes
 		FileLogBufferTimeoutSeconds:  2,                                        // Default timeout 2 seconds
+		CountryCookiePath:            "/",                                      // Default cookie path
+		CountryCookieSameSite:        "Lax",                                    // Default cookie SameSite
+		GeoPoolHeader:                "X-Geo-Pool",                             // Default routing hint header
+		DecisionCookieTTLSeconds:     900,                                      // Sessions re-check every 15 minutes
+		ScoreAllowedCountryWeight:    -100,                                     // Allowed countries lower the score
+		ScoreBlockedCountryWeight:    100,                                      // Blocked countries raise the score
+		ScoreAllowedIPBlockWeight:    -1000,                                    // IP blocks outweigh countries
+		ScoreBlockedIPBlockWeight:    1000,                                     // IP blocks outweigh countries
+		DecisionServiceTimeoutMs:     200,                                      // Keep the added latency small
+		DecisionServiceCacheSeconds:  60,                                       // Default decision cache duration
+		DNSBLTimeoutMs:               50,                                       // Keep the added latency small
+		DNSBLCacheSeconds:            300,                                      // Listings change slowly
+		VerifiedBotsTimeoutMs:        1000,                                     // Reverse DNS can be slow, only blocked requests wait
+		VerifiedBotsCacheSeconds:     3600,                                     // Crawler addresses are stable
+		SearchEngineRefreshSeconds:   86400,                                    // Refresh crawler ranges daily
+		CloudFrontRefreshSeconds:     86400,                                    // Refresh CloudFront ranges daily
+		ChallengeCookieName:          "geoblock_challenge",                     // Default challenge cookie name
+		ChallengeTTLSeconds:          3600,                                     // Humans pass the challenge once an hour
+		TrapBanSeconds:               86400,                                    // Scanners come back, keep them out for a day
+		BanExportIntervalSeconds:     60,                                       // Firewalls pick up new bans within a minute
+		ConfigOverlayIntervalSeconds: 10,                                       // Overlay changes apply within seconds
+		LoadShedIntervalSeconds:      10,                                       // Sheds written by incident tooling apply within seconds
+		LoadShedMaxSeconds:           3600,                                     // Sheds last an hour at most
+		BlockedBodyLimitBytes:        65536,                                    // Small forms keep their keep-alive connection
+		CountryStatsBucketSeconds:    3600,                                     // Hourly buckets
+		CountryStatsBuckets:          168,                                      // One week of hourly buckets
+		CountryStatsSampleRate:       1,                                        // Record every request
+		StatsPushFormat:              StatsPushFormatInflux,                    // InfluxDB line protocol
+		StatsPushSeconds:             60,                                       // Push every minute
+		StatsPushPrefix:              "geoblock",                               // geoblock_requests, geoblock_errors
+		BogonFeedRefreshSeconds:      86400,                                    // Refresh bogon feeds daily
+		ThreatIntelRefreshSeconds:    3600,                                     // Refresh threat intelligence hourly
+		ThreatIntelDefaultTTLSeconds: 604800,                                   // Indicators without expiry are valid for a week
+		RangeCacheSize:               4096,                                     // Cache up to 4096 database rows per family
+		DatabaseHeartbeatSeconds:     300,                                      // Publish the database version every 5 minutes
+		BanHtmlReloadSeconds:         30,                                       // Pick up ban page edits within 30 seconds
 	}
 }
 
@@ -112,41 +483,144 @@ type Plugin struct {
 	next                         http.Handler
 	name                         string
 	databaseFile                 string           // Just for testing purposes
-	db                           *DatabaseWrapper // Changed from ip2location.DB to DatabaseWrapper
+	db                           *DatabaseWrapper // Changed from ip2location.DB to DatabaseWrapper, nil with an injected Lookuper
+	lookuper                     Lookuper         // Country resolver, db unless injected
+	factory                      *DatabaseFactory // Shared factory owning db, released by Close
 	enabled                      bool
 	allowedCountries             map[string]struct{} // Instead of []string to improve lookup performance
 	blockedCountries             map[string]struct{} // Instead of []string to improve lookup performance
 	defaultAllow                 bool
+	countryBlockFirst            bool // BlockedCountries wins over AllowedCountries
 	allowPrivate                 bool
-	banIfError                   bool
+	decodeTunneledIPv4           bool // Evaluate the IPv4 of 6to4 and Teredo addresses
 	disallowedStatusCode         int
 	allowedIPBlocks              *IpLookupFileMonitor // Fast radix tree-based allowed IP block lookups
 	blockedIPBlocks              *IpLookupFileMonitor // Fast radix tree-based blocked IP block lookups
+	offloadHints                 *offloadHints        // Aggregated IP block verdicts for XDP/eBPF agents, built on first use
 	banHtmlContent               string               // Changed from banHtmlTemplate
+	banPageFile                  *banPageFile         // Reloaded BanHtmlFilePath, nil when not watched
+	banAppealURL                 string               // Value of the {{.AppealURL}} ban page placeholder
 	logger                       *slog.Logger
 	bypassHeaders                map[string]string
 	ipHeaders                    []string            // List of headers to check for client IP addresses
+	ipHeaderPreset               []platformHeader    // Headers of a cloud load balancer preset, nil otherwise
+	ipHeaderPatterns             ipHeaderPatterns    // Wildcard and regex entries of ipHeaders, nil without any
 	ipHeaderStrategy             string              // Strategy for processing multiple IP addresses
+	maxChainLength               int                 // IP header entries parsed per request, 0 for no limit
+	longChainPolicy              string              // What happens to requests with more entries
+	enrichmentPolicy             string              // Whether bypassed/ignored requests are still enriched
 	ignoreVerbs                  map[string]struct{} // Set of HTTP verbs to ignore for blocking
 	logBannedRequests            bool
+	logPhaseLevels               phaseLogLevels // Request log levels by phase, nil when LogPhaseLevels is empty
 	countryHeader                string
-	remediationHeadersCustomName string // Name of the header to add to blocked responses
+	countryHeaderFormat          string            // Format of the CountryHeader values
+	privateCountryAlias          string            // CountryHeader value for private IPs
+	remediationHeadersCustomName string            // Name of the header to add to blocked responses
+	verdictHeader                string            // Request header the verdict is appended to
+	accessLogHeaderPrefix        string            // Prefix of the access log field headers, empty when disabled
+	ruleSourceHeader             string            // Request header carrying the matched IP block rule
+	responseCountryHeader        string            // Name of the response header carrying the detected country
+	countryCookie                *http.Cookie      // Template for the country cookie, nil when disabled
+	geoPools                     *geoPools         // Country to upstream pool routing hint, nil when disabled
+	consent                      *consentGate      // Consent gating, nil when disabled
+	maintenance                  *maintenanceMode  // Per-country maintenance, nil when disabled
+	blockedBody                  *blockedBody      // Handling of the body of blocked requests, nil to let the server drain it
+	dropConnections              bool              // BanMode "drop": blocked connections are closed without a response
+	fingerprints                 *tlsFingerprints  // TLS fingerprint bypass and block lists, nil when disabled
+	bypassTokens                 *bypassTokens     // Signed one-time bypass tokens, nil when disabled
+	ipConflicts                  *ipConflicts      // IP header comparison, nil with the ignore policy
+	rolloutPercent               int               // Percentage of client IPs where blocks are enforced
+	monitorFamily                string            // Address family whose blocks are only logged, empty when both are enforced
+	countryGrace                 *countryGrace     // Configurations replaced within the grace period, nil when none
+	configOverlay                *configOverlay    // Rules from ConfigOverlayFile, nil when disabled
+	scoring                      *scoringPipeline  // Scoring mode, nil when disabled
+	decisionService              *decisionService  // External decision service, nil when disabled
+	countryOverride              *countryOverride  // Debug country override, nil when disabled
+	countryStats                 *countryStats     // Country statistics collector, nil when disabled
+	statsPusher                  *statsPusher      // InfluxDB/Graphite counters, nil when StatsPushAddress is empty
+	countryQuotas                *countryQuotas    // Per-country request budgets, nil when none is configured
+	admin                        *adminEndpoint    // Admin endpoint, nil when disabled
+	errorPolicies                *errorPolicies    // Policies and counters for parse/lookup errors and missing IPs
+	requireRemoteAddrMatch       bool              // Ignore IP headers unless the peer is a trusted proxy
+	trustedProxies               []*net.IPNet      // Proxies allowed to set IP headers
+	skipLookupForAllowedIPBlocks bool              // Allowed IP blocks are decided without database lookup
+	dynamicBlocklist             *dynamicBlocklist // Runtime bans, shared between instances using the same file
+	loadShedder                  *loadShedder      // Countries shed during incidents, shared per LoadShedFile
+	decisionLog                  *decisionLog      // Decisions for later replay, nil without DecisionLogFile
+	bogons                       *bogonList        // Bogon ranges, nil when BlockBogons is disabled
+	threatIntel                  *threatIntelFeed  // Threat intelligence indicators, nil when ThreatIntelURL is empty
+	ipv4Rules                    *countryRules     // IPv4 country rules, nil when they match the global rules
+	ipv6Rules                    *countryRules     // IPv6 country rules, nil when they match the global rules
+	unknownCountryPolicy         string            // How IPs without country are decided
+	rangeCache                   *rangeCache       // Cached database rows, nil when disabled
+	stats                        *pluginStats      // Request counters returned by Stats
+	staleDatabase                *staleDatabase    // Database age check, nil when DatabaseStaleDays is 0
+	rangeOverrides               *rangeOverrides   // Custom range to country assignments, nil when none
+	usageTypes                   *usageTypeRules   // BlockedUsageTypes, nil when none
+	dnsbl                        *dnsblChecker     // DNSBL lookups, nil when no zones are configured
+	userAgents                   *userAgentRules   // UAPatternsByCountry, nil when none
+	verifiedBots                 *verifiedBots     // Crawler verification, nil when VerifiedBots is empty
+	searchEngines                *crawlerRanges    // Published crawler ranges, nil when AllowSearchEngines is disabled
+	cloudFront                   *cloudFrontRanges // CloudFront edge ranges, nil unless TrustCloudFrontViewerCountry
+	viewerIP                     string            // Client whose country CloudFront sent, set per request
+	viewerCountry                string            // CloudFront-Viewer-Country of viewerIP, set per request
+	rules                        ruleSet           // Compiled Rules, nil when there is none
+	registrations                *registrations    // RIR registrations, nil unless RequireRegistrationMatch
+	challenge                    *challengeGate    // Challenge for country blocks, nil unless BanMode is "challenge"
+	trapPaths                    *trapPaths        // Honeypot paths, nil when none
+	hostRules                    *hostRules        // Per host country rules, nil when none
+	profiles                     *profiles         // Named policies selected per request, nil when none
+	decisionCookie               *decisionCookie   // Sticky client countries, nil when DecisionCookieName is empty
+	logQueue                     *asyncLogWriter   // Asynchronous log writer, nil when LogQueueSize is 0
+}
+
+// Lookuper resolves the country code (ISO 3166-1 alpha-2, "-" when unknown) of an IP address.
+// DatabaseWrapper implements it; embedders and tests can inject their own with WithLookuper.
+type Lookuper interface {
+	LookupCountry(ip string) (string, error)
 }
 
 // New creates a new plugin instance.
 func New(ctx context.Context, next http.Handler, cfg *Config, name string) (http.Handler, error) {
+	plugin, err := newPlugin(ctx, next, cfg, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
+
+// newPlugin creates a plugin instance. A nil lookuper uses the database configured in cfg.
+func newPlugin(ctx context.Context, next http.Handler, cfg *Config, name string, lookuper Lookuper) (*Plugin, error) {
 	bootstrapLogger := createBootstrapLogger(name)
 
 	if next == nil {
-		return nil, fmt.Errorf("%s: no next handler provided", name)
+		return nil, invalidConfig(name, fmt.Errorf("no next handler provided"))
 	}
 
 	if cfg == nil {
-		return nil, fmt.Errorf("%s: no config provided", name)
+		return nil, invalidConfig(name, fmt.Errorf("no config provided"))
+	}
+	cfg, err := resolveConfigEnv(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
 	}
 
+	timer := newInitTimer(cfg.InitBudgetMs)
+
 	// Create logger first so we can use it for debugging
-	logger := createLogger(name, cfg.LogLevel, cfg.LogFormat, cfg.LogPath, cfg.FileLogBufferSizeBytes, cfg.FileLogBufferTimeoutSeconds, bootstrapLogger)
+	if cfg.LogQueueSize < 0 {
+		return nil, invalidConfig(name, fmt.Errorf("LogQueueSize can't be negative, got %d", cfg.LogQueueSize))
+	}
+	queueSize := cfg.LogQueueSize
+	if !cfg.Enabled {
+		queueSize = 0 // Disabled instances hardly log, no need for a writer goroutine
+	}
+	logger, logQueue := createQueuedLogger(name, cfg.LogLevel, cfg.LogFormat, cfg.LogPath,
+		cfg.FileLogBufferSizeBytes, cfg.FileLogBufferTimeoutSeconds, queueSize, bootstrapLogger)
+	logger, err = applyLogFieldOptions(logger, cfg.LogFieldOptions, cfg.LogHashSalt)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
 	logger.Debug("initializing plugin",
 		"logLevel", cfg.LogLevel,
 		"logFormat", cfg.LogFormat,
@@ -164,79 +638,444 @@ func New(ctx context.Context, next http.Handler, cfg *Config, name string) (http
 	}
 
 	if http.StatusText(cfg.DisallowedStatusCode) == "" {
-		return nil, fmt.Errorf("%s: %d is not a valid http status code", name, cfg.DisallowedStatusCode)
+		return nil, invalidConfig(name, fmt.Errorf("%d is not a valid http status code", cfg.DisallowedStatusCode))
+	}
+
+	// Validate IPHeaderStrategy, presets bring their own headers
+	ipHeaders := cfg.IPHeaders
+	ipPreset := ipHeaderPreset(cfg.IPHeaderStrategy)
+	if ipPreset != nil {
+		ipHeaders = presetHeaderNames(ipPreset)
+	} else if cfg.IPHeaderStrategy != IPHeaderStrategyCheckAll &&
+		cfg.IPHeaderStrategy != IPHeaderStrategyCheckFirst &&
+		cfg.IPHeaderStrategy != IPHeaderStrategyCheckFirstNonePrivate {
+		return nil, invalidConfig(name, fmt.Errorf("invalid IPHeaderStrategy '%s', must be one of: %s, %s, %s, or a preset: %s, %s, %s",
+			cfg.IPHeaderStrategy,
+			IPHeaderStrategyCheckAll, IPHeaderStrategyCheckFirst, IPHeaderStrategyCheckFirstNonePrivate,
+			IPHeaderStrategyCloudFront, IPHeaderStrategyAzure, IPHeaderStrategyGCLB))
 	}
 
 	// Validate that IPHeaders is not empty
-	if len(cfg.IPHeaders) == 0 {
-		return nil, fmt.Errorf("%s: IPHeaders cannot be empty - at least one header must be specified for IP extraction", name)
+	if len(ipHeaders) == 0 {
+		return nil, invalidConfig(name, fmt.Errorf("IPHeaders cannot be empty - at least one header must be specified for IP extraction"))
+	}
+	var headerPatterns ipHeaderPatterns
+	if ipPreset == nil {
+		var err error
+		if headerPatterns, err = newIPHeaderPatterns(ipHeaders); err != nil {
+			return nil, invalidConfig(name, err)
+		}
 	}
 
-	// Validate IPHeaderStrategy
-	if cfg.IPHeaderStrategy != IPHeaderStrategyCheckAll &&
-		cfg.IPHeaderStrategy != IPHeaderStrategyCheckFirst &&
-		cfg.IPHeaderStrategy != IPHeaderStrategyCheckFirstNonePrivate {
-		return nil, fmt.Errorf("%s: invalid IPHeaderStrategy '%s', must be one of: %s, %s, %s",
-			name, cfg.IPHeaderStrategy,
-			IPHeaderStrategyCheckAll, IPHeaderStrategyCheckFirst, IPHeaderStrategyCheckFirstNonePrivate)
+	// Validate EnrichmentPolicy, empty keeps the historical behavior
+	if cfg.EnrichmentPolicy == "" {
+		cfg.EnrichmentPolicy = EnrichmentPolicyAlways
+	}
+	if cfg.EnrichmentPolicy != EnrichmentPolicyAlways &&
+		cfg.EnrichmentPolicy != EnrichmentPolicySkipBypassed &&
+		cfg.EnrichmentPolicy != EnrichmentPolicySkipBypassedAndIgnored {
+		return nil, invalidConfig(name, fmt.Errorf("invalid EnrichmentPolicy '%s', must be one of: %s, %s, %s",
+			cfg.EnrichmentPolicy,
+			EnrichmentPolicyAlways, EnrichmentPolicySkipBypassed, EnrichmentPolicySkipBypassedAndIgnored))
 	}
 
 	// Create database configuration
 	dbConfig := &DatabaseConfig{
-		DatabaseFilePath:        cfg.DatabaseFilePath,
-		DatabaseAutoUpdate:      cfg.DatabaseAutoUpdate,
-		DatabaseAutoUpdateDir:   cfg.DatabaseAutoUpdateDir,
-		DatabaseAutoUpdateToken: cfg.DatabaseAutoUpdateToken,
-		DatabaseAutoUpdateCode:  cfg.DatabaseAutoUpdateCode,
+		DatabaseFilePath:             cfg.DatabaseFilePath,
+		DatabaseAutoUpdate:           cfg.DatabaseAutoUpdate,
+		DatabaseAutoUpdateDir:        cfg.DatabaseAutoUpdateDir,
+		DatabaseAutoUpdateToken:      cfg.DatabaseAutoUpdateToken,
+		DatabaseAutoUpdateCode:       cfg.DatabaseAutoUpdateCode,
+		DatabaseAutoUpdateWindow:     cfg.DatabaseAutoUpdateWindow,
+		NoLocalCopy:                  cfg.NoLocalCopy,
+		DatabaseLocalCopyDir:         cfg.DatabaseLocalCopyDir,
+		DatabaseLocalCopyMaxAgeHours: cfg.DatabaseLocalCopyMaxAgeHours,
+		DatabaseHotSwapWebhookURL:    cfg.DatabaseHotSwapWebhookURL,
+		DatabaseWarmUp:               cfg.DatabaseWarmUp,
+		DatabaseLatencyLogSeconds:    cfg.DatabaseLatencyLogSeconds,
+		DatabaseHeartbeatTarget:      cfg.DatabaseHeartbeatTarget,
+		DatabaseHeartbeatSeconds:     cfg.DatabaseHeartbeatSeconds,
 	}
 
-	// Get database factory - uses singleton pattern per database path
-	// Using the bootstrap logger here because the database factory is shared between all plugins
-	factory, err := GetDatabaseFactory(dbConfig, bootstrapLogger)
-	if err != nil {
-		return nil, fmt.Errorf("%s: failed to get database factory: %w", name, err)
-	}
+	// An injected resolver replaces the database entirely
+	var factory *DatabaseFactory
+	var db *DatabaseWrapper
+	var databasePath string
+	if lookuper == nil {
+		// Get database factory - uses singleton pattern per database path
+		// Using the bootstrap logger here because the database factory is shared between all plugins
+		factory, err = GetDatabaseFactory(dbConfig, bootstrapLogger)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to get database factory: %w", name, err)
+		}
 
-	// Get the database wrapper
-	db := factory.GetWrapper()
-	databasePath := db.GetPath()
+		// Get the database wrapper
+		db = factory.GetWrapper()
+		databasePath = db.GetPath()
+		lookuper = db
+	}
+	if err := timer.step("database"); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
 
 	// Create separate IP lookup file monitors with radix trees for fast lookups and file monitoring
-	allowedIPHelper, err := NewIpLookupFileMonitor(cfg.AllowedIPBlocks, cfg.AllowedIPBlocksDir, logger)
+	if cfg.MaxIPBlockRules < 0 || cfg.IPBlockLoadWorkers < 0 {
+		return nil, invalidConfig(name, fmt.Errorf("MaxIPBlockRules and IPBlockLoadWorkers must not be negative"))
+	}
+	if cfg.MemoryBudgetMB < 0 {
+		return nil, invalidConfig(name, fmt.Errorf("MemoryBudgetMB must not be negative, got %d", cfg.MemoryBudgetMB))
+	}
+	memoryBudget := newMemoryBudget(cfg.MemoryBudgetMB)
+	blockLoadOptions := ipBlockLoadOptions{maxRules: cfg.MaxIPBlockRules, workers: cfg.IPBlockLoadWorkers, aggregate: cfg.AggregateIPBlocks, strict: cfg.StrictFiles, memoryBudget: memoryBudget}
+	allowedLoadOptions := blockLoadOptions
+	allowedLoadOptions.allowList = true
+	allowedIPHelper, err := newIpLookupFileMonitorWithOptions(cfg.AllowedIPBlocks, cfg.AllowedIPBlocksDir, allowedLoadOptions, logger)
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed loading allowed IP blocks: %w", name, err)
+		return nil, invalidConfig(name, fmt.Errorf("failed loading allowed IP blocks: %w", err))
 	}
 
-	blockedIPHelper, err := NewIpLookupFileMonitor(cfg.BlockedIPBlocks, cfg.BlockedIPBlocksDir, logger)
+	blockedIPHelper, err := newIpLookupFileMonitorWithOptions(cfg.BlockedIPBlocks, cfg.BlockedIPBlocksDir, blockLoadOptions, logger)
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed loading blocked IP blocks: %w", name, err)
+		return nil, invalidConfig(name, fmt.Errorf("failed loading blocked IP blocks: %w", err))
+	}
+	if err := timer.step("ip_blocks"); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
 	var banHtmlContent string
+	var banPage *banPageFile
 
 	if cfg.BanHtmlFilePath != "" {
+		// The search falls back to TRAEFIK_PLUGIN_GEOBLOCK_PATH, strict mode wants the configured path itself
+		if cfg.StrictFiles {
+			if _, err := os.Stat(cfg.BanHtmlFilePath); err != nil {
+				return nil, invalidConfig(name, fmt.Errorf("ban HTML file (StrictFiles): %w", err))
+			}
+		}
 		var err error
 		cfg.BanHtmlFilePath, err = fileUtils.Search(cfg.BanHtmlFilePath, "geoblockban.html", logger)
 		if err != nil {
-			return nil, fmt.Errorf("%s: failed to find ban HTML file: %w", name, err)
+			return nil, invalidConfig(name, fmt.Errorf("failed to find ban HTML file: %w", err))
 		}
 		content, err := os.ReadFile(cfg.BanHtmlFilePath)
 		if err != nil {
-			return nil, fmt.Errorf("%s: failed to load ban HTML file %s: %w", name, cfg.BanHtmlFilePath, err)
+			return nil, invalidConfig(name, fmt.Errorf("failed to load ban HTML file %s: %w", cfg.BanHtmlFilePath, err))
 		} else {
 			banHtmlContent = string(content)
 		}
+		if cfg.BanHtmlReloadSeconds > 0 {
+			banPage = watchBanPage(cfg.BanHtmlFilePath, banHtmlContent, time.Duration(cfg.BanHtmlReloadSeconds)*time.Second, logger)
+		}
+	} else if !cfg.DisableDefaultBanPage {
+		banHtmlContent = defaultBanHtml
+	}
+	if err := timer.step("ban_page"); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	countryCookie, err := newCountryCookieTemplate(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	countryHeaderFormat, privateCountryAlias, err := validateCountryHeaderFormat(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	geoPools, err := newGeoPools(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	consent, err := newConsentGate(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	maintenance, err := newMaintenanceMode(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	blockedBody, err := newBlockedBody(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	fingerprints, err := newTLSFingerprints(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	bypassTokens, err := newBypassTokens(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	longChainPolicy, err := validateLongChainPolicy(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	ipConflicts, err := newIPConflicts(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	rolloutPercent, err := validateRolloutPercent(cfg.RolloutPercent)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	monitorFamily, err := validateEnforceAddressFamilies(cfg.EnforceAddressFamilies)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	logPhaseLevels, err := newPhaseLogLevels(cfg.LogPhaseLevels)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	scoring, err := newScoringPipeline(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	decisionService, err := newDecisionService(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	countryOverride, err := newCountryOverride(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	countryStats, err := newCountryStats(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	countryQuotas, err := newCountryQuotas(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	admin, err := newAdminEndpoint(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	errorPolicies, err := newErrorPolicies(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	trustedProxies, err := parseIPNetworks("TrustedProxies", cfg.TrustedProxies)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	dynamicBlocklist, err := getDynamicBlocklist(cfg.DynamicBlocklistFile, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+	if err := startBanExport(cfg, dynamicBlocklist, logger); err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	loadShedder, err := getLoadShedder(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	decisionLog, err := getDecisionLog(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	if err := validateUnknownCountryPolicy(cfg.UnknownCountryPolicy); err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	bogons, err := newBogonList(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	threatIntel, err := newThreatIntelFeed(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	// Cached rows come from the BIN file, an injected Lookuper has none
+	var rowCache *rangeCache
+	if db != nil {
+		rowCache = newRangeCache(cfg.RangeCacheSize)
+	}
+
+	staleDatabase, err := newStaleDatabase(cfg, db)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	rangeOverrides, err := newRangeOverrides(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	usageTypes, err := newUsageTypeRules(cfg, lookuper, db)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	dnsbl, err := newDNSBLChecker(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	userAgents, err := newUserAgentRules(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	verifiedBots, err := newVerifiedBots(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	// Caches get what the IP block trees leave of the memory budget
+	shedCaches(memoryBudget, budgetedCaches(rowCache, dnsbl, verifiedBots, decisionService), logger)
+
+	cloudFront, err := newCloudFrontRanges(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	searchEngines, err := newCrawlerRanges(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	rules, err := newRuleSet(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	registrations, err := newRegistrations(cfg, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	challenge, err := newChallengeGate(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	trapPaths, err := newTrapPaths(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	decisionCookie, err := newDecisionCookie(cfg)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+	if conflicts := skipLookupConflicts(cfg, rules); cfg.SkipLookupForAllowedIPBlocks && len(conflicts) > 0 {
+		return nil, invalidConfig(name, fmt.Errorf("skipLookupForAllowedIPBlocks leaves the allowed IP blocks without a country, "+
+			"which %s decide on", strings.Join(conflicts, ", ")))
+	}
+	skipLookupForAllowedIPBlocks := cfg.SkipLookupForAllowedIPBlocks &&
+		cfg.CountryHeader == "" && cfg.ResponseCountryHeader == "" && cfg.CountryCookieName == "" && scoring == nil
+	if cfg.SkipLookupForAllowedIPBlocks && !skipLookupForAllowedIPBlocks {
+		logger.Warn("skipLookupForAllowedIPBlocks has no effect when the country is needed " +
+			"(countryHeader, responseCountryHeader, countryCookieName or scoreThreshold is set)")
+	}
+
+	if cfg.RequireRemoteAddrMatch && len(trustedProxies) == 0 {
+		logger.Warn("requireRemoteAddrMatch is enabled without trustedProxies, IP headers will always be ignored")
+	}
+
+	if cfg.CountryPolicyFile != "" {
+		if cfg.AllowedCountries, cfg.BlockedCountries, err = loadCountryPolicy(cfg); err != nil {
+			return nil, invalidConfig(name, err)
+		}
+		logger.Info("country policy loaded", "file", cfg.CountryPolicyFile,
+			"allowed_countries", len(cfg.AllowedCountries),
+			"blocked_countries", len(cfg.BlockedCountries))
 	}
 
 	// Convert slices to maps for O(1) lookup
-	allowedCountries := make(map[string]struct{}, len(cfg.AllowedCountries))
-	for _, c := range cfg.AllowedCountries {
-		allowedCountries[c] = struct{}{}
+	allowedCountries, err := countrySet("AllowedCountries", cfg.AllowedCountries)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+	blockedCountries, err := countrySet("BlockedCountries", cfg.BlockedCountries)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	globalRules := countryRules{allowed: allowedCountries, blocked: blockedCountries, defaultAllow: cfg.DefaultAllow}
+	countryBlockFirst, err := validateCountryListPrecedence(cfg.CountryListPrecedence, "global", globalRules, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
 	}
+	globalRules.blockFirst = countryBlockFirst
 
-	blockedCountries := make(map[string]struct{}, len(cfg.BlockedCountries))
-	for _, c := range cfg.BlockedCountries {
-		blockedCountries[c] = struct{}{}
+	ipv4Rules, err := newCountryRules("IPv4Policy", cfg.IPv4Policy, globalRules)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+	ipv6Rules, err := newCountryRules("IPv6Policy", cfg.IPv6Policy, globalRules)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	// Family lists replace the global ones, so they need the same validation
+	for _, family := range []struct {
+		scope  string
+		policy AddressFamilyPolicy
+		rules  *countryRules
+	}{{"IPv4Policy", cfg.IPv4Policy, ipv4Rules}, {"IPv6Policy", cfg.IPv6Policy, ipv6Rules}} {
+		if family.rules == nil || (len(family.policy.AllowedCountries) == 0 && len(family.policy.BlockedCountries) == 0) {
+			continue
+		}
+		if _, err := validateCountryListPrecedence(cfg.CountryListPrecedence, family.scope, *family.rules, logger); err != nil {
+			return nil, invalidConfig(name, err)
+		}
+	}
+
+	hostRules, err := newHostRules(cfg, globalRules, ipv4Rules, ipv6Rules, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	profiles, err := newProfiles(cfg, globalRules, ipv4Rules, ipv6Rules, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	countryGrace, err := newCountryGrace(cfg, name, globalRules, ipv4Rules, ipv6Rules, time.Now())
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	configOverlay, err := startConfigOverlay(cfg, overlayRules{
+		global:          globalRules,
+		ipv4Rules:       ipv4Rules,
+		ipv6Rules:       ipv6Rules,
+		allowedIPBlocks: allowedIPHelper,
+		blockedIPBlocks: blockedIPHelper,
+	}, blockLoadOptions, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
+	}
+
+	statsPusher, err := newStatsPusher(cfg, name, errorPolicies, logger)
+	if err != nil {
+		return nil, invalidConfig(name, err)
 	}
 
 	// Convert ignore verbs to map for O(1) lookup, normalize to uppercase
@@ -250,25 +1089,98 @@ func New(ctx context.Context, next http.Handler, cfg *Config, name string) (http
 		name:                         name,
 		databaseFile:                 databasePath,
 		db:                           db,
+		lookuper:                     lookuper,
+		factory:                      factory,
 		enabled:                      cfg.Enabled,
 		allowedCountries:             allowedCountries,
 		blockedCountries:             blockedCountries,
 		defaultAllow:                 cfg.DefaultAllow,
+		countryBlockFirst:            countryBlockFirst,
 		allowPrivate:                 cfg.AllowPrivate,
-		banIfError:                   cfg.BanIfError,
+		decodeTunneledIPv4:           cfg.DecodeTunneledIPv4,
 		disallowedStatusCode:         cfg.DisallowedStatusCode,
 		allowedIPBlocks:              allowedIPHelper,
 		blockedIPBlocks:              blockedIPHelper,
+		offloadHints:                 &offloadHints{},
 		banHtmlContent:               banHtmlContent,
+		banPageFile:                  banPage,
+		banAppealURL:                 cfg.BanAppealURL,
+		blockedBody:                  blockedBody,
+		fingerprints:                 fingerprints,
+		bypassTokens:                 bypassTokens,
+		ipConflicts:                  ipConflicts,
+		dropConnections:              strings.EqualFold(cfg.BanMode, BanModeDrop),
 		bypassHeaders:                cfg.BypassHeaders,
-		ipHeaders:                    cfg.IPHeaders,
+		ipHeaders:                    ipHeaders,
+		ipHeaderPreset:               ipPreset,
+		ipHeaderPatterns:             headerPatterns,
 		ipHeaderStrategy:             cfg.IPHeaderStrategy,
+		maxChainLength:               cfg.MaxChainLength,
+		longChainPolicy:              longChainPolicy,
+		enrichmentPolicy:             cfg.EnrichmentPolicy,
 		ignoreVerbs:                  ignoreVerbs,
 		logger:                       logger,
 		logBannedRequests:            cfg.LogBannedRequests,
+		logPhaseLevels:               logPhaseLevels,
 		countryHeader:                cfg.CountryHeader,
+		countryHeaderFormat:          countryHeaderFormat,
+		privateCountryAlias:          privateCountryAlias,
 		remediationHeadersCustomName: cfg.RemediationHeadersCustomName,
+		verdictHeader:                cfg.VerdictHeader,
+		accessLogHeaderPrefix:        cfg.AccessLogHeaderPrefix,
+		ruleSourceHeader:             cfg.RuleSourceHeader,
+		responseCountryHeader:        cfg.ResponseCountryHeader,
+		countryCookie:                countryCookie,
+		geoPools:                     geoPools,
+		consent:                      consent,
+		maintenance:                  maintenance,
+		rolloutPercent:               rolloutPercent,
+		monitorFamily:                monitorFamily,
+		countryGrace:                 countryGrace,
+		configOverlay:                configOverlay,
+		scoring:                      scoring,
+		decisionService:              decisionService,
+		countryOverride:              countryOverride,
+		countryStats:                 countryStats,
+		statsPusher:                  statsPusher,
+		countryQuotas:                countryQuotas,
+		admin:                        admin,
+		errorPolicies:                errorPolicies,
+		requireRemoteAddrMatch:       cfg.RequireRemoteAddrMatch,
+		trustedProxies:               trustedProxies,
+		skipLookupForAllowedIPBlocks: skipLookupForAllowedIPBlocks,
+		dynamicBlocklist:             dynamicBlocklist,
+		loadShedder:                  loadShedder,
+		decisionLog:                  decisionLog,
+		bogons:                       bogons,
+		threatIntel:                  threatIntel,
+		ipv4Rules:                    ipv4Rules,
+		ipv6Rules:                    ipv6Rules,
+		unknownCountryPolicy:         cfg.UnknownCountryPolicy,
+		rangeCache:                   rowCache,
+		stats:                        newPluginStats(),
+		staleDatabase:                staleDatabase,
+		rangeOverrides:               rangeOverrides,
+		usageTypes:                   usageTypes,
+		dnsbl:                        dnsbl,
+		userAgents:                   userAgents,
+		verifiedBots:                 verifiedBots,
+		searchEngines:                searchEngines,
+		cloudFront:                   cloudFront,
+		rules:                        rules,
+		registrations:                registrations,
+		challenge:                    challenge,
+		trapPaths:                    trapPaths,
+		hostRules:                    hostRules,
+		profiles:                     profiles,
+		decisionCookie:               decisionCookie,
+		logQueue:                     logQueue,
+	}
+
+	if err := timer.step("features"); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
+	logger.Debug("plugin initialized", timer.logArgs()...)
 
 	return plugin, nil
 }
@@ -281,14 +1193,25 @@ func (p Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Admin requests are answered by the plugin and never reach the backend
+	if p.serveAdmin(rw, req) {
+		return
+	}
+
+	if p.configOverlay != nil {
+		p.configOverlay.apply(&p)
+	}
+
 	// Get list of unique remote IPs
-	remoteIPs := p.GetRemoteIPs(req)
+	remoteIPs, longChain := p.remoteIPs(req)
 	var ipChain string = strings.Join(remoteIPs, ", ")
 	var skipBlocking bool = false
+	var skipEnrichment bool = false
 
-	// Check if this HTTP verb should be ignored for blocking (but still enriched)
+	// Check if this HTTP verb should be ignored for blocking (enriched unless the enrichment policy says otherwise)
 	if _, ignored := p.ignoreVerbs[strings.ToUpper(req.Method)]; ignored {
 		skipBlocking = true
+		skipEnrichment = p.enrichmentPolicy == EnrichmentPolicySkipBypassedAndIgnored
 		p.logger.Debug("HTTP verb ignored for blocking",
 			"method", req.Method,
 			"remote_addr", req.RemoteAddr,
@@ -304,17 +1227,428 @@ func (p Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 				"remote_addr", req.RemoteAddr,
 				"ip_chain", ipChain)
 			skipBlocking = true
+			skipEnrichment = skipEnrichment || p.enrichmentPolicy != EnrichmentPolicyAlways
 			break
 		}
 	}
 
+	// A valid one-time token bypasses like a bypass header, a replayed one is only logged
+	if p.bypassTokens != nil && !skipBlocking {
+		switch p.bypassTokens.check(req, time.Now()) {
+		case bypassTokenAccepted:
+			p.logger.Debug("bypassing geoblock due to bypass token",
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain)
+			skipBlocking = true
+			skipEnrichment = skipEnrichment || p.enrichmentPolicy != EnrichmentPolicyAlways
+		case bypassTokenReplayed:
+			p.logger.Warn("rejected replayed bypass token",
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain)
+		case bypassTokenCacheFull:
+			p.logger.Warn("rejected bypass token, the replay cache is full",
+				"limit", p.bypassTokens.limit,
+				"remote_addr", req.RemoteAddr)
+		case bypassTokenInvalid, bypassTokenExpired:
+			p.logger.Debug("rejected invalid or expired bypass token",
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain)
+		}
+	}
+
+	// Known TLS fingerprints bypass or block regardless of geography
+	var blockedFingerprint string
+	if p.fingerprints != nil && !skipBlocking {
+		switch fingerprint, action := p.fingerprints.match(req); action {
+		case fingerprintBypass:
+			p.logger.Debug("bypassing geoblock due to TLS fingerprint",
+				"fingerprint", fingerprint,
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain)
+			skipBlocking = true
+			skipEnrichment = skipEnrichment || p.enrichmentPolicy != EnrichmentPolicyAlways
+		case fingerprintBlock:
+			blockedFingerprint = fingerprint
+		}
+	}
+
+	// Short-circuit before any database lookup
+	if skipEnrichment {
+		p.logger.Debug("skipping enrichment for request", "enrichment_policy", p.enrichmentPolicy)
+		p.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Headers naming different clients are logged, and blocked with the block policy
+	var ipConflict string
+	if p.ipConflicts != nil {
+		if clients := p.detectIPConflict(req); clients != nil {
+			ipConflict = formatIPConflict(clients)
+			p.logger.Warn("IP headers name different clients",
+				"conflict", ipConflict,
+				"policy", p.ipConflicts.policy,
+				"host", req.Host,
+				"path", req.URL.Path,
+				"remote_addr", req.RemoteAddr)
+		}
+		if p.ipConflicts.header != "" {
+			if ipConflict != "" {
+				req.Header.Set(p.ipConflicts.header, ipConflict)
+			} else {
+				req.Header.Del(p.ipConflicts.header)
+			}
+		}
+	}
+	blockedConflict := ipConflict != "" && p.ipConflicts.policy == ConflictPolicyBlock && !skipBlocking
+
+	// Stuffed IP headers were only parsed up to MaxChainLength
+	if longChain && p.longChainPolicy != LongChainPolicyAllow {
+		p.logger.Warn("IP headers longer than MaxChainLength",
+			"max_chain_length", p.maxChainLength,
+			"policy", p.longChainPolicy,
+			"ip_chain", ipChain,
+			"host", req.Host,
+			"path", req.URL.Path,
+			"remote_addr", req.RemoteAddr)
+	}
+	blockedLongChain := longChain && p.longChainPolicy == LongChainPolicyBlock && !skipBlocking
+
+	// Requests selecting a profile, or else for hosts with HostRules, are evaluated with their rules
+	evaluator, unknownHost, profiled := p, false, false
+	if p.profiles != nil {
+		var profile string
+		var rule *hostRule
+		if profile, rule, profiled = p.profiles.match(req); profiled {
+			evaluator = p.withHostRule(rule)
+		} else if profile != "" {
+			p.logger.Debug("unknown profile requested, ignoring it", "profile", profile, "host", req.Host)
+		}
+	}
+	if p.hostRules != nil && !profiled {
+		evaluator, unknownHost = p.forHost(req.Host)
+	}
+	if p.cloudFront != nil {
+		evaluator = evaluator.withViewerCountry(req)
+	}
+
+	var decision ipDecision
+	overrideCountry := p.debugCountryOverride(req, remoteIPs, ipChain)
+
+	// A valid decision cookie only replaces the database lookup of the client, every check still runs
+	var cookieCountry string
+	if p.decisionCookie != nil && overrideCountry == "" && evaluator.viewerCountry == "" {
+		if ip := cookieClientIP(remoteIPs); ip != "" {
+			if country, ok := p.decisionCookie.country(req, p.databaseVersion(), evaluator.policyFingerprint(), time.Now()); ok {
+				evaluator.viewerIP, evaluator.viewerCountry, cookieCountry = ip, country, country
+			}
+		}
+	}
+
+	if overrideCountry != "" {
+		decision = evaluator.evaluateCountryOverride(req, remoteIPs, overrideCountry, skipBlocking)
+	} else {
+		decision = evaluator.evaluateIPs(req, remoteIPs, ipChain, skipBlocking)
+	}
+	if cookieCountry != "" && decision.country == cookieCountry && p.decisionCookie.eligible(decision) {
+		decision.phase = PhaseDecisionCookie
+	}
+	if unknownHost {
+		// Probing for unknown virtual hosts is typical of scanners
+		switch p.hostRules.unknownPolicy {
+		case UnknownHostPolicyLog:
+			p.logger.Info("request for unknown host",
+				"host", req.Host,
+				"ip", decision.ip,
+				"country", decision.country,
+				"path", req.URL.Path,
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain)
+		case UnknownHostPolicyBlock:
+			if !skipBlocking && !decision.blocked && decision.phase != PhaseAllowPrivate && decision.phase != PhaseAllowedIPBlock {
+				decision = ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseUnknownHost}
+			}
+		}
+	}
+	if p.trapPaths != nil && !skipBlocking && p.trapPaths.matches(req.URL.Path) {
+		decision = p.trapPaths.trap(decision, req.URL.Path, p.dynamicBlocklist, p.logger)
+	}
+	if p.userAgents != nil && !skipBlocking {
+		if pattern, blocked := p.userAgents.blocks(req, decision); blocked {
+			p.logger.Debug("User-Agent blocked for country",
+				"ip", decision.ip,
+				"country", decision.country,
+				"user_agent", req.UserAgent(),
+				"pattern", pattern)
+			decision = ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseBlockedUserAgent}
+		}
+	}
+	if p.verifiedBots != nil && !skipBlocking {
+		if bot, exempt := p.verifiedBots.exempts(req, decision, p.logger); exempt {
+			p.logger.Debug("verified crawler exempted from country block",
+				"bot", bot,
+				"ip", decision.ip,
+				"country", decision.country,
+				"blocked_phase", decision.phase)
+			decision = ipDecision{ip: decision.ip, country: decision.country, phase: PhaseVerifiedBot}
+		}
+	}
+	if p.searchEngines != nil && !skipBlocking && p.searchEngines.exempts(decision) {
+		p.logger.Debug("search engine range exempted from country block",
+			"ip", decision.ip,
+			"country", decision.country,
+			"blocked_phase", decision.phase)
+		decision = ipDecision{ip: decision.ip, country: decision.country, phase: PhaseSearchEngine}
+	}
+	if p.challenge != nil && !skipBlocking && decision.blocked && p.challenge.applies(req, decision) &&
+		p.challenge.passed(req, decision.ip, time.Now()) {
+		decision = ipDecision{ip: decision.ip, country: decision.country, phase: PhaseChallengePassed}
+	}
+	if p.rules != nil && !skipBlocking {
+		if rule, ok := p.rules.match(req, decision); ok {
+			p.logger.Debug("rule matched",
+				"rule", rule.source,
+				"ip", decision.ip,
+				"country", decision.country,
+				"previous_phase", decision.phase)
+			decision = rule.apply(decision)
+			if rule.status != 0 {
+				evaluator.disallowedStatusCode = rule.status
+			}
+		}
+	}
+	if p.decisionService != nil && !skipBlocking {
+		decision = p.decisionService.decide(req, decision, p.logger)
+	}
+	if blockedFingerprint != "" {
+		p.logger.Debug("blocked TLS fingerprint",
+			"fingerprint", blockedFingerprint,
+			"ip", decision.ip,
+			"country", decision.country,
+			"phase", decision.phase)
+		decision = ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseBlockedFingerprint}
+	}
+	if blockedConflict {
+		decision = ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseIPConflict}
+	}
+	if blockedLongChain {
+		decision = ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseLongChain}
+	}
+	if p.decisionCookie != nil && !skipBlocking && overrideCountry == "" && p.decisionCookie.eligible(decision) {
+		p.decisionCookie.issue(rw, req, decision.country, p.databaseVersion(), evaluator.policyFingerprint(), time.Now())
+	}
+	evaluator.respond(rw, req, decision, ipChain, skipBlocking)
+}
+
+// respond applies the decision: the challenge or ban page for blocked requests, then maintenance,
+// consent and the country annotations before allowed requests are passed on
+func (p Plugin) respond(rw http.ResponseWriter, req *http.Request, decision ipDecision, ipChain string, skipBlocking bool) {
+	if p.countryQuotas != nil && !skipBlocking {
+		decision = p.countryQuotas.apply(decision, time.Now())
+	}
+	blocked := decision.blocked && p.enforceBlock(decision, ipChain)
+	if p.stats != nil {
+		p.stats.record(decision.phase, blocked)
+	}
+	if p.countryStats != nil {
+		p.countryStats.record(decision.country, blocked)
+	}
+	if p.statsPusher != nil {
+		p.statsPusher.record(decision.country, blocked)
+	}
+	if p.decisionLog != nil && !skipBlocking {
+		p.decisionLog.record(time.Now(), decision, blocked)
+	}
+	p.appendVerdict(req, decision, blocked, skipBlocking)
+	req = p.withAccessLogFields(req, decision, blocked, skipBlocking)
+
+	// Tell operators which feed decided, client-sent values never pass
+	matchedRule := p.matchedRule(decision)
+	if matchedRule != "" {
+		p.logger.Debug("IP block rule matched", "ip", decision.ip, "phase", decision.phase, "rule", matchedRule)
+	}
+	if p.ruleSourceHeader != "" {
+		if matchedRule != "" {
+			req.Header.Set(p.ruleSourceHeader, matchedRule)
+		} else {
+			req.Header.Del(p.ruleSourceHeader)
+		}
+	}
+
+	if blocked && p.challenge != nil && p.challenge.applies(req, decision) {
+		p.logger.Debug("challenged request",
+			"ip", decision.ip,
+			"country", decision.country,
+			"blocked_phase", decision.phase,
+			"path", req.URL.Path)
+		if p.remediationHeadersCustomName != "" {
+			rw.Header().Set(p.remediationHeadersCustomName, PhaseChallenge)
+		}
+		p.challenge.serve(rw, decision.ip, p.disallowedStatusCode, time.Now())
+		return
+	}
+
+	// Stale data is flagged at the edge and in the logs
+	var staleAge string
+	if p.staleDatabase != nil {
+		staleAge = p.staleDatabase.check(time.Now(), p.logger)
+	}
+
+	if blocked {
+		if level, ok := p.logPhaseLevels.level(decision.phase, slog.LevelInfo, p.logBannedRequests); ok && decision.err == nil {
+			logArgs := decision.scoreLogArgs()
+			if matchedRule != "" {
+				logArgs = append(logArgs, "rule", matchedRule)
+			}
+			if staleAge != "" {
+				if level < slog.LevelWarn {
+					level = slog.LevelWarn
+				}
+				logArgs = append(logArgs, "database_age", staleAge)
+			}
+			p.logger.Log(req.Context(), level, "blocked request", append([]any{
+				"ip", decision.ip,
+				"ip_chain", ipChain,
+				"country", decision.country,
+				"host", req.Host,
+				"method", req.Method,
+				"phase", decision.phase,
+				"path", req.URL.Path,
+				"remote_addr", req.RemoteAddr}, logArgs...)...)
+		}
+		if p.dropConnections && dropConnection(rw) {
+			return
+		}
+		hangUp := p.blockedBody != nil && p.blockedBody.prepare(rw, req)
+		if staleAge != "" && p.staleDatabase.header != "" {
+			rw.Header().Set(p.staleDatabase.header, staleAge)
+		}
+		p.serveBanHtml(rw, decision.ip, decision.country, decision.phase, req.Method)
+		if hangUp {
+			p.blockedBody.hangUp(rw, p.logger)
+		}
+		return
+	}
+
+	// Allowed requests are only logged for the phases listed in LogPhaseLevels
+	if level, ok := p.logPhaseLevels.level(decision.phase, slog.LevelInfo, false); ok && !decision.blocked {
+		p.logger.Log(req.Context(), level, "allowed request",
+			"ip", decision.ip,
+			"ip_chain", ipChain,
+			"country", decision.country,
+			"host", req.Host,
+			"method", req.Method,
+			"phase", decision.phase,
+			"path", req.URL.Path,
+			"remote_addr", req.RemoteAddr)
+	}
+
+	if p.loadShedder != nil && !skipBlocking && decision.phase != PhaseAllowPrivate && decision.phase != PhaseAllowedIPBlock {
+		if remaining := p.loadShedder.shedding(decision.country, time.Now()); remaining > 0 {
+			p.logger.Debug("country shed",
+				"country", decision.country,
+				"path", req.URL.Path,
+				"remote_addr", req.RemoteAddr,
+				"ip_chain", ipChain,
+				"remaining", remaining)
+			if p.remediationHeadersCustomName != "" {
+				rw.Header().Set(p.remediationHeadersCustomName, PhaseLoadShed)
+			}
+			serveLoadShed(rw, remaining)
+			return
+		}
+	}
+
+	if p.maintenance != nil && !skipBlocking && p.maintenance.applies(decision.country) {
+		p.logger.Debug("country under maintenance",
+			"country", decision.country,
+			"path", req.URL.Path,
+			"remote_addr", req.RemoteAddr,
+			"ip_chain", ipChain)
+		if p.remediationHeadersCustomName != "" {
+			rw.Header().Set(p.remediationHeadersCustomName, PhaseMaintenance)
+		}
+		p.maintenance.serve(rw, req, decision.country, p.logger)
+		return
+	}
+
+	if p.consent != nil && !skipBlocking && p.consent.required(req, decision.country) {
+		p.logger.Debug("consent required, redirecting",
+			"country", decision.country,
+			"path", req.URL.Path,
+			"remote_addr", req.RemoteAddr,
+			"ip_chain", ipChain)
+		if p.remediationHeadersCustomName != "" {
+			rw.Header().Set(p.remediationHeadersCustomName, PhaseConsentRequired)
+		}
+		p.consent.redirect(rw, req)
+		return
+	}
+
+	if staleAge != "" && p.staleDatabase.onAllowed && p.staleDatabase.header != "" {
+		rw.Header().Set(p.staleDatabase.header, staleAge)
+	}
+	if p.geoPools != nil {
+		p.geoPools.annotate(req, decision.country)
+	}
+	p.annotateAllowedResponse(rw, req, decision.country)
+	p.next.ServeHTTP(rw, req)
+}
+
+// ipDecision is the outcome of evaluating the client IPs of a request
+type ipDecision struct {
+	blocked bool         // Whether the request must be blocked
+	ip      string       // IP that caused the block, or the client IP the country was detected for when allowed
+	country string       // Country of that IP, or the detected client country when allowed
+	phase   string       // Phase where the decision was made (for allowed requests, the phase of the detected IP)
+	err     error        // Set when the block is caused by a failed check (error policy)
+	score   *scoreResult // Score breakdown when scoring mode made the decision
+}
+
+// scoreLogArgs returns the score and its factors as log key/value pairs, when scoring made the decision
+func (d ipDecision) scoreLogArgs() []any {
+	if d.score == nil {
+		return nil
+	}
+	return []any{"score", d.score.total, "score_factors", d.score.factorsString()}
+}
+
+// evaluateIPs runs the client IPs through CheckAllowed following the configured IP header strategy,
+// and sets the country header on the request. The first IP that must be blocked ends the evaluation,
+// unless skipBlocking is set, in which case all IPs are evaluated for enrichment only.
+func (p Plugin) evaluateIPs(req *http.Request, remoteIPs []string, ipChain string, skipBlocking bool) ipDecision {
 	// Process IPs based on strategy
 	var foundPublicIP bool = false
 	var countryHeaderSet bool = false
+	var detectedCountry string = PrivateIpCountryAlias
+	var detectedIP string
+	var detectedPhase string
+
+	// Without client IP in the headers, NoIPPolicy decides
+	noIPPolicy := ""
+	if len(remoteIPs) == 0 {
+		noIPPolicy = p.errorPolicies.forEmptyHeaders()
+		if peer := cleanIPAddress(req.RemoteAddr); noIPPolicy == NoIPPolicyUseRemoteAddr && peer != "" {
+			p.logger.Debug("no client IP found in IP headers, using the remote address",
+				"ip_headers", strings.Join(p.ipHeaders, ","),
+				"remote_addr", req.RemoteAddr)
+			remoteIPs = []string{peer}
+			ipChain = peer
+		}
+	}
+	if len(remoteIPs) > 0 {
+		detectedIP = remoteIPs[0]
+	}
 
 	// Set country header to PRIVATE initially - will be overridden by real countries
 	if p.countryHeader != "" {
-		req.Header.Set(p.countryHeader, PrivateIpCountryAlias)
+		req.Header.Set(p.countryHeader, p.countryHeaderValue(PrivateIpCountryAlias))
+	}
+
+	if len(remoteIPs) == 0 && noIPPolicy != ErrorPolicyAllow && !skipBlocking {
+		p.logger.Debug("no client IP found in IP headers",
+			"ip_headers", strings.Join(p.ipHeaders, ","),
+			"remote_addr", req.RemoteAddr)
+		return ipDecision{blocked: true, country: "Unknown", phase: PhaseEmptyHeaders}
 	}
 
 	for i, ip := range remoteIPs {
@@ -337,50 +1671,55 @@ func (p Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			}
 		}
 
-		allowed, country, phase, err := p.CheckAllowed(ip)
+		allowed, country, phase, score, err := p.checkIP(ip)
 
 		// Override country header only with the first real (non-private) country we encounter
-		if p.countryHeader != "" && country != "" && country != PrivateIpCountryAlias && !countryHeaderSet {
-			req.Header.Set(p.countryHeader, country)
+		if country != "" && country != PrivateIpCountryAlias && !countryHeaderSet {
+			if p.countryHeader != "" {
+				req.Header.Set(p.countryHeader, p.countryHeaderValue(country))
+			}
+			detectedCountry = country
+			detectedIP = ip
 			countryHeaderSet = true
 		}
 
 		if err != nil {
-			p.logger.Error("request check failed",
-				"ip", ip,
-				"ip_chain", ipChain,
-				"host", req.Host,
-				"method", req.Method,
-				"path", req.URL.Path,
-				"phase", phase,
-				"error", err,
-				"remote_addr", req.RemoteAddr)
-
-			if p.banIfError && !skipBlocking {
-				p.serveBanHtml(rw, ip, "Unknown", "error", req.Method)
-				return
-			}
-			// For non-CheckAll strategies, continue to next IP on error
-			if p.ipHeaderStrategy != IPHeaderStrategyCheckAll {
-				continue
-			}
-			continue
-		}
-
-		if !allowed && !skipBlocking {
-			if p.logBannedRequests {
-				p.logger.Info("blocked request",
+			policy, errorPhase := p.errorPolicies.forError(err)
+			if level, ok := p.logPhaseLevels.level(errorPhase, slog.LevelError, true); ok {
+				p.logger.Log(req.Context(), level, "request check failed",
 					"ip", ip,
 					"ip_chain", ipChain,
-					"country", country,
 					"host", req.Host,
 					"method", req.Method,
-					"phase", phase,
 					"path", req.URL.Path,
+					"phase", phase,
+					"error", err,
 					"remote_addr", req.RemoteAddr)
 			}
-			p.serveBanHtml(rw, ip, country, phase, req.Method)
-			return
+
+			if policy == ErrorPolicyLastKnown {
+				last, found := p.errorPolicies.recall(ip)
+				if !found {
+					policy = ErrorPolicyBlock // Nothing to fall back on
+				} else if !last.allowed && !skipBlocking {
+					return ipDecision{blocked: true, ip: ip, country: last.country, phase: last.phase}
+				} else {
+					continue
+				}
+			}
+			if policy == ErrorPolicyBlock && !skipBlocking {
+				return ipDecision{blocked: true, ip: ip, country: "Unknown", phase: errorPhase, err: err}
+			}
+			continue
+		}
+
+		p.errorPolicies.remember(ip, allowed, country, phase)
+		if ip == detectedIP {
+			detectedPhase = phase
+		}
+
+		if !allowed && !skipBlocking {
+			return ipDecision{blocked: true, ip: ip, country: country, phase: phase, score: score}
 		}
 
 		// For CheckFirstNonePrivate, stop after processing first non-private IP
@@ -389,7 +1728,7 @@ func (p Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	p.next.ServeHTTP(rw, req)
+	return ipDecision{ip: detectedIP, country: detectedCountry, phase: detectedPhase}
 }
 
 // GetRemoteIPs collects the remote IPs from the configured IP headers.
@@ -398,12 +1737,39 @@ func (p Plugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 // because the leftmost IP is typically the original client IP in proxy chains.
 //
 // Special synthetic header "remoteAddress" maps to req.RemoteAddr for direct access to the connection's remote address.
+//
+// With requireRemoteAddrMatch, only RemoteAddr is returned when the peer is not one of the trusted proxies.
 func (p Plugin) GetRemoteIPs(req *http.Request) []string {
+	ips, _ := p.remoteIPs(req)
+	return ips
+}
+
+// remoteIPs implements GetRemoteIPs, and also reports whether the IP headers hold more than
+// MaxChainLength entries. Entries past the limit are not parsed.
+func (p Plugin) remoteIPs(req *http.Request) ([]string, bool) {
+	// A client connecting directly can put anything in the IP headers
+	if peer, untrusted := p.untrustedPeerIP(req); untrusted {
+		p.logger.Debug("ignoring IP headers from untrusted peer", "remote_addr", req.RemoteAddr)
+		if peer == "" {
+			return nil, false
+		}
+		return []string{peer}, false
+	}
+
+	if p.ipHeaderPreset != nil {
+		return presetRemoteIPs(req, p.ipHeaderPreset), false
+	}
+
 	var ips []string
 	seenIPs := make(map[string]struct{}) // For deduplication
+	var firstInvalid string
+	skipped := 0
+	entries := 0
+	truncated := false
 
 	// Check each configured IP header in order
-	for _, headerName := range p.ipHeaders {
+headers:
+	for _, headerName := range p.requestIPHeaders(req) {
 		var headerValue string
 
 		// Handle synthetic "remoteAddress" header
@@ -415,11 +1781,26 @@ func (p Plugin) GetRemoteIPs(req *http.Request) []string {
 
 		if headerValue != "" {
 			// Process IPs within this header left-to-right (leftmost is original client)
-			for _, ip := range strings.Split(headerValue, ",") {
-				ip = cleanIPAddress(ip)
+			for rest, more := headerValue, true; more; {
+				if p.maxChainLength > 0 && entries == p.maxChainLength {
+					truncated = true
+					break headers
+				}
+				entries++
+				var token string
+				token, rest, more = strings.Cut(rest, ",")
+				ip, valid := parseIPToken(token)
 				if ip == "" {
 					continue
 				}
+				if !valid {
+					p.logger.Debug("skipping IP header token that is not an IP address", "header", headerName, "token", ip)
+					if firstInvalid == "" && !isPlaceholderToken(ip) {
+						firstInvalid = ip
+					}
+					skipped++
+					continue
+				}
 				// Only add if we haven't seen this IP before
 				if _, seen := seenIPs[ip]; !seen {
 					seenIPs[ip] = struct{}{}
@@ -429,7 +1810,15 @@ func (p Plugin) GetRemoteIPs(req *http.Request) []string {
 		}
 	}
 
-	return ips
+	// Nothing but garbage still goes through OnParseError, instead of looking like a request without headers
+	if len(ips) == 0 && firstInvalid != "" {
+		ips = []string{firstInvalid}
+		skipped--
+	}
+	if skipped > 0 && p.errorPolicies != nil {
+		p.errorPolicies.skipTokens(skipped)
+	}
+	return ips, truncated
 }
 
 func cleanIPAddress(ip string) string {
@@ -445,6 +1834,26 @@ func cleanIPAddress(ip string) string {
 	return ip // If no port, return the original IP
 }
 
+// parseIPToken cleans one comma-separated token of an IP header: spaces, quotes, ports and the brackets
+// of IPv6 addresses are removed. Returns the cleaned token, and whether it is an IP address.
+func parseIPToken(token string) (string, bool) {
+	token = strings.Trim(strings.TrimSpace(token), `"`)
+	ip := cleanIPAddress(token)
+	if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
+		ip = ip[1 : len(ip)-1]
+	}
+	if ip == "" {
+		return "", false
+	}
+	return ip, net.ParseIP(ip) != nil
+}
+
+// isPlaceholderToken reports whether a token stands for a hidden client (RFC 7239 "unknown" and
+// obfuscated identifiers like "_hidden"), which means no IP rather than an invalid one
+func isPlaceholderToken(token string) bool {
+	return strings.EqualFold(token, "unknown") || strings.HasPrefix(token, "_")
+}
+
 // CheckAllowed determines if an IP address should be allowed through based on configured rules.
 // Returns:
 // - allow: whether the request should be allowed
@@ -452,79 +1861,181 @@ func cleanIPAddress(ip string) string {
 // - err: any errors encountered during the check
 // - phase: the phase in the verification process where the decision was made
 func (p Plugin) CheckAllowed(ip string) (allow bool, country string, phase string, err error) {
+	if p.configOverlay != nil {
+		p.configOverlay.apply(&p)
+	}
+	allow, country, phase, _, err = p.checkIP(ip)
+	return allow, country, phase, err
+}
+
+// checkIP implements CheckAllowed, and also returns the score breakdown when scoring is enabled
+func (p Plugin) checkIP(ip string) (allow bool, country string, phase string, score *scoreResult, err error) {
 	ipAddr := net.ParseIP(ip)
 	if ipAddr == nil {
-		return false, ip, "", fmt.Errorf("unable to parse IP address from [%s]", ip)
+		return false, ip, "", nil, &ipParseError{ip: ip}
+	}
+	if p.decodeTunneledIPv4 {
+		if embedded := tunneledIPv4(ipAddr); embedded != nil {
+			p.logger.Debug("evaluating the IPv4 of a tunneled address", "ip", ip, "ipv4", embedded.String())
+			ipAddr, ip = embedded, embedded.String()
+		}
+	}
+
+	// Runtime bans win over every static rule. The country is only looked up for the logs.
+	if p.dynamicBlocklist != nil {
+		if banned, _ := p.dynamicBlocklist.contains(ipAddr); banned {
+			country, _ = p.Lookup(ip)
+			return false, country, PhaseDynamicBlocklist, nil, nil
+		}
 	}
 
 	if ipAddr.IsPrivate() || ipAddr.IsLoopback() {
 		if p.allowPrivate {
-			return true, PrivateIpCountryAlias, PhaseAllowPrivate, nil
+			return true, PrivateIpCountryAlias, PhaseAllowPrivate, nil, nil
 		} else {
-			return false, PrivateIpCountryAlias, PhaseAllowPrivate, nil
+			return false, PrivateIpCountryAlias, PhaseAllowPrivate, nil, nil
 		}
 	}
 
-	// Look up the country for this IP first, so we have it available for all code paths
-	country, err = p.Lookup(ip)
-	if err != nil {
-		return false, ip, "", fmt.Errorf("lookup of %s failed: %w", ip, err)
+	// Bogons are spoofed or misrouted, no list can make them legitimate
+	if p.bogons != nil && p.bogons.contains(ipAddr) {
+		return false, BogonCountryAlias, PhaseBogon, nil, nil
 	}
 
 	blocked, blockedNetworkLength, err := p.isBlockedIPBlocks(ipAddr)
 	if err != nil {
-		return false, country, "", fmt.Errorf("failed to check if IP %q is blocked by IP block: %w", ip, err)
+		return false, "", "", nil, fmt.Errorf("failed to check if IP %q is blocked by IP block: %w", ip, err)
 	}
 
 	allowed, allowedNetworkLength, err := p.isAllowedIPBlocks(ipAddr)
 	if err != nil {
-		return false, country, "", fmt.Errorf("failed to check if IP %q is allowed by IP block: %w", ip, err)
+		return false, "", "", nil, fmt.Errorf("failed to check if IP %q is allowed by IP block: %w", ip, err)
 	}
 
 	// NB: whichever matched prefix is longer has higher priority: more specific to less specific only if both matched.
-	if (allowedNetworkLength < blockedNetworkLength) && (allowedNetworkLength > 0) && (blockedNetworkLength > 0) {
+	blockedWins := (allowedNetworkLength < blockedNetworkLength) && (allowedNetworkLength > 0) && (blockedNetworkLength > 0)
+
+	// Trusted ranges don't need a country when nothing consumes it
+	if p.skipLookupForAllowedIPBlocks && allowed && !(blocked && blockedWins) {
+		return true, "", PhaseAllowedIPBlock, nil, nil
+	}
+
+	// Look up the country for this IP, so we have it available for all remaining code paths
+	country, err = p.Lookup(ip)
+	if err != nil {
+		return false, ip, "", nil, fmt.Errorf("lookup of %s failed: %w", ip, err)
+	}
+	if p.unknownCountryPolicy == UnknownCountryPolicyZZ && isUnknownCountry(country) {
+		country = UnknownCountryAlias
+	}
+
+	// Usage types, threat intelligence and DNSBL listings block outright, unless an allowed IP block matched
+	allowedByBlock := allowed && !(blocked && blockedWins)
+	if p.usageTypes != nil && !allowedByBlock {
+		usageType, blockedUsage, err := p.usageTypes.check(ip)
+		if err != nil {
+			return false, country, "", nil, fmt.Errorf("usage type lookup of %s failed: %w", ip, err)
+		}
+		if blockedUsage {
+			p.logger.Debug("usage type blocked", "ip", ip, "country", country, "usage_type", usageType)
+			return false, country, PhaseBlockedUsageType, nil, nil
+		}
+	}
+	if p.threatIntel != nil && !allowedByBlock {
+		if indicator, listed := p.threatIntel.match(ipAddr, time.Now()); listed {
+			p.logger.Debug("IP is a threat intelligence indicator", "ip", ip, "country", country, "indicator", indicator)
+			return false, country, PhaseThreatIntel, nil, nil
+		}
+	}
+	dnsblListed := false
+	if p.dnsbl != nil && !allowedByBlock {
+		if zone, listed := p.dnsbl.check(ipAddr, p.logger); listed {
+			switch p.dnsbl.action {
+			case DNSBLActionBlock:
+				p.logger.Debug("IP listed in DNSBL", "ip", ip, "country", country, "zone", zone)
+				return false, country, PhaseDNSBL, nil, nil
+			case DNSBLActionScore:
+				dnsblListed = true
+			default:
+				p.logger.Info("IP listed in DNSBL", "ip", ip, "country", country, "zone", zone)
+			}
+		}
+	}
+
+	// In scoring mode lists contribute weights instead of deciding on their own
+	rules := p.countryRulesFor(ipAddr)
+	if p.scoring != nil {
+		_, allowedCountry := rules.allowed[country]
+		_, blockedCountry := rules.blocked[country]
+		score = p.scoring.evaluateInput(scoreInput{
+			country:        country,
+			allowedIPBlock: allowed,
+			blockedIPBlock: blocked,
+			allowedCountry: allowedCountry,
+			blockedCountry: blockedCountry,
+			dnsblListed:    dnsblListed,
+		})
+		p.logger.Debug("score evaluated", "ip", ip, "country", country, "score", score.total,
+			"threshold", p.scoring.threshold, "factors", score.factorsString())
+		return !score.blocked, country, PhaseScore, score, nil
+	}
+
+	if blockedWins {
 		if blocked {
-			return false, country, PhaseBlockedIPBlock, nil
+			return false, country, PhaseBlockedIPBlock, nil, nil
 		}
 		if allowed {
-			return true, country, PhaseAllowedIPBlock, nil
+			return true, country, PhaseAllowedIPBlock, nil, nil
 		}
 	} else {
 		if allowed {
-			return true, country, PhaseAllowedIPBlock, nil
+			return true, country, PhaseAllowedIPBlock, nil, nil
 		}
 		if blocked {
-			return false, country, PhaseBlockedIPBlock, nil
+			return false, country, PhaseBlockedIPBlock, nil, nil
 		}
 	}
 
-	if _, allowed := p.allowedCountries[country]; allowed {
-		return true, country, PhaseAllowedCountry, nil
+	if isUnknownCountry(country) {
+		switch p.unknownCountryPolicy {
+		case UnknownCountryPolicyAllow:
+			return true, country, PhaseUnknownCountry, nil, nil
+		case UnknownCountryPolicyBlock:
+			return false, country, PhaseUnknownCountry, nil, nil
+		}
 	}
 
-	if _, blocked := p.blockedCountries[country]; blocked {
-		return false, country, PhaseBlockedCountry, nil
-	}
+	allow, phase = rules.check(country)
 
-	if p.defaultAllow {
-		return true, country, PhaseDefaultAllow, nil
+	// Geolocated in an allowed country is not enough, the range must also be registered to one
+	if allow && phase == PhaseAllowedCountry && p.registrations != nil {
+		registered, found := p.registrations.lookup(ipAddr)
+		if _, registeredAllowed := rules.allowed[registered]; !found || !registeredAllowed {
+			p.logger.Debug("registration country does not match", "ip", ip, "country", country, "registered_country", registered)
+			return false, country, PhaseRegistrationMismatch, nil, nil
+		}
 	}
-	return false, country, PhaseDefaultAllow, nil
+	return allow, country, phase, nil, nil
 }
 
-// Lookup queries the ip2location database for a given IP address.
+// Lookup queries the ip2location database for a given IP address. RangeOverrides take precedence.
 func (p Plugin) Lookup(ip string) (string, error) {
-	record, err := p.db.Get_country_short(ip)
-	if err != nil {
-		return "", err
+	if p.viewerCountry != "" && ip == p.viewerIP {
+		return p.viewerCountry, nil
+	}
+	if p.rangeOverrides != nil {
+		if country, ok := p.rangeOverrides.lookup(net.ParseIP(ip)); ok {
+			return country, nil
+		}
 	}
 
-	// Avoid redundant assignment and string conversion
-	if strings.HasPrefix(strings.ToLower(record.Country_short), "invalid") {
-		return "", errors.New(record.Country_short)
+	if p.rangeCache != nil {
+		if country, ok, err := p.rangeCache.lookup(p.db, ip); ok {
+			return country, err
+		}
 	}
 
-	return record.Country_short, nil
+	return p.lookuper.LookupCountry(ip)
 }
 
 // isAllowedIPBlocks checks if an IP is allowed based on the allowed CIDR blocks using fast radix tree lookup
@@ -544,19 +2055,23 @@ func (p Plugin) serveBanHtml(rw http.ResponseWriter, ip, country, phase string,
 		rw.Header().Set(p.remediationHeadersCustomName, phase)
 	}
 
-	if p.banHtmlContent != "" && requestMethod == http.MethodGet {
+	banHtml := p.banHtmlContent
+	if p.banPageFile != nil {
+		banHtml = p.banPageFile.get()
+	}
+	if banHtml != "" && requestMethod == http.MethodGet && statusAllowsBody(p.disallowedStatusCode) {
+		content := renderBanHtml(banHtml, ip, country, p.banAppealURL)
 		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Header().Set("Content-Length", strconv.Itoa(len(content)))
 		rw.WriteHeader(p.disallowedStatusCode)
 
-		// Simple string replacements
-		content := p.banHtmlContent
-		content = strings.ReplaceAll(content, "{{.Country}}", country)
-		content = strings.ReplaceAll(content, "{{.IP}}", ip)
-
 		if _, err := rw.Write([]byte(content)); err != nil {
 			p.logger.Warn("failed to write ban HTML response", "error", err)
 		}
 		return
 	}
+	if statusAllowsBody(p.disallowedStatusCode) {
+		rw.Header().Set("Content-Length", "0") // Complete without a chunked terminator, in case the connection is hijacked
+	}
 	rw.WriteHeader(p.disallowedStatusCode)
 }
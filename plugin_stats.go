@@ -0,0 +1,87 @@
+package traefik_geoblock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// PluginStats is a snapshot of the request counters, for programs embedding the plugin.
+// Counters start at zero when the plugin is created.
+type PluginStats struct {
+	Evaluated        int64             `json:"evaluated"`        // Requests that got a decision
+	Allowed          int64             `json:"allowed"`          // Requests passed on, monitor-only blocks included
+	Blocked          int64             `json:"blocked"`          // Requests blocked
+	Phases           map[string]int64  `json:"phases"`           // Requests by decision phase, allowed and blocked
+	RangeCacheHits   int64             `json:"rangeCacheHits"`   // Lookups answered by the range cache
+	RangeCacheMisses int64             `json:"rangeCacheMisses"` // Lookups that read the database (0 without range cache)
+	DatabaseVersion  string            `json:"databaseVersion"`  // Version of the database in use, empty with an injected Lookuper
+	Errors           ErrorCounts       `json:"errors"`
+	BypassTokens     *BypassTokenStats `json:"bypassTokens,omitempty"` // Nil without BypassTokenSecret
+}
+
+// pluginStats counts the decisions of respond. Plugin has value receivers, so the counters are shared
+// through pointers.
+type pluginStats struct {
+	evaluated *int64
+	blocked   *int64
+
+	mu     *sync.RWMutex
+	phases map[string]*int64 // Phases are few, so entries are only added, never removed
+}
+
+func newPluginStats() *pluginStats {
+	return &pluginStats{
+		evaluated: new(int64),
+		blocked:   new(int64),
+		mu:        &sync.RWMutex{},
+		phases:    make(map[string]*int64),
+	}
+}
+
+// record counts one decision
+func (s *pluginStats) record(phase string, blocked bool) {
+	atomic.AddInt64(s.evaluated, 1)
+	if blocked {
+		atomic.AddInt64(s.blocked, 1)
+	}
+
+	s.mu.RLock()
+	count, ok := s.phases[phase]
+	s.mu.RUnlock()
+	if !ok {
+		s.mu.Lock()
+		if count, ok = s.phases[phase]; !ok {
+			count = new(int64)
+			s.phases[phase] = count
+		}
+		s.mu.Unlock()
+	}
+	atomic.AddInt64(count, 1)
+}
+
+// Stats returns the request counters, range cache hits and the database version without parsing logs
+func (p Plugin) Stats() PluginStats {
+	stats := PluginStats{
+		Phases:          make(map[string]int64),
+		DatabaseVersion: p.databaseVersion(),
+		Errors:          p.ErrorCounts(),
+	}
+	if p.stats != nil {
+		stats.Evaluated = atomic.LoadInt64(p.stats.evaluated)
+		stats.Blocked = atomic.LoadInt64(p.stats.blocked)
+		stats.Allowed = stats.Evaluated - stats.Blocked
+		p.stats.mu.RLock()
+		for phase, count := range p.stats.phases {
+			stats.Phases[phase] = atomic.LoadInt64(count)
+		}
+		p.stats.mu.RUnlock()
+	}
+	if p.bypassTokens != nil {
+		stats.BypassTokens = p.bypassTokens.stats()
+	}
+	if p.rangeCache != nil {
+		stats.RangeCacheHits = atomic.LoadInt64(p.rangeCache.hits)
+		stats.RangeCacheMisses = atomic.LoadInt64(p.rangeCache.misses)
+	}
+	return stats
+}
@@ -0,0 +1,48 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPluginStats(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	for _, ip := range []string{"8.8.8.8", "8.8.8.9", "85.214.132.1", "not-an-ip"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	stats := plugin.Stats()
+	if stats.Evaluated != 4 || stats.Allowed != 2 || stats.Blocked != 2 {
+		t.Errorf("expected 4 evaluated, 2 allowed and 2 blocked, got %+v", stats)
+	}
+	if stats.Phases[PhaseAllowedCountry] != 2 || stats.Phases[PhaseDefaultAllow] != 1 || stats.Phases[PhaseParseError] != 1 {
+		t.Errorf("unexpected phase counts %v", stats.Phases)
+	}
+	// Both US addresses are in the same database row
+	if stats.RangeCacheMisses != 2 || stats.RangeCacheHits != 1 {
+		t.Errorf("expected 2 misses and 1 hit, got %d and %d", stats.RangeCacheMisses, stats.RangeCacheHits)
+	}
+	if stats.DatabaseVersion != "25.4.1" || stats.Errors.ParseErrors != 1 {
+		t.Errorf("expected version 25.4.1 and one parse error, got %q and %+v", stats.DatabaseVersion, stats.Errors)
+	}
+
+	// The snapshot is a copy
+	stats.Phases[PhaseAllowedCountry] = 100
+	if plugin.Stats().Phases[PhaseAllowedCountry] != 2 {
+		t.Error("expected the snapshot not to share its phase map")
+	}
+}
@@ -14,6 +14,8 @@ import (
 const (
 	pluginName = "geoblock"
 	dbFilePath = "./IP2LOCATION-LITE-DB1.IPV6.BIN"
+	// Tiny database generated with tools/dbgen from testdata/dbgen/ranges.csv
+	tinyDbFilePath = "./testdata/tiny/IP2LOCATION-LITE-DB1.IPV6.BIN"
 )
 
 type noopHandler struct{}
@@ -857,6 +859,35 @@ func TestPlugin_Lookup(t *testing.T) {
 	})
 }
 
+func TestPlugin_TinyDatabase(t *testing.T) {
+	cfg := &Config{
+		Enabled:              true,
+		DatabaseFilePath:     tinyDbFilePath,
+		AllowedCountries:     []string{"AU"},
+		DisallowedStatusCode: http.StatusForbidden,
+		IPHeaders:            []string{"x-forwarded-for", "x-real-ip"},
+		IPHeaderStrategy:     IPHeaderStrategyCheckAll,
+	}
+
+	testRequest(t, "AU IP allowed", cfg, "1.1.1.1", http.StatusTeapot)
+	testRequest(t, "US IP blocked", cfg, "8.8.8.8", http.StatusForbidden)
+	testRequest(t, "unassigned IP blocked", cfg, "9.9.9.9", http.StatusForbidden)
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	for ip, want := range map[string]string{"1.1.1.1": "AU", "2001:4860::8888": "US", "9.9.9.9": "-"} {
+		country, err := plugin.(*Plugin).Lookup(ip)
+		if err != nil {
+			t.Errorf("lookup of %s failed: %v", ip, err)
+		}
+		if country != want {
+			t.Errorf("expected country %s for %s, got %s", want, ip, country)
+		}
+	}
+}
+
 func TestPlugin_ServeHTTP_MalformedIP(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1854,6 +1885,48 @@ func TestGetRemoteIPs_SyntheticRemoteAddress(t *testing.T) {
 	}
 }
 
+func TestGetRemoteIPs_TokenHardening(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.IPHeaders = []string{"x-forwarded-for"}
+
+	tests := []struct {
+		name        string
+		header      string
+		want        []string
+		wantSkipped int64
+	}{
+		{"ports and spaces", "1.2.3.4:443, [2001:db8::1]:8443 , unknown", []string{"1.2.3.4", "2001:db8::1"}, 1},
+		{"bracketed IPv6 without port", "[2001:db8::2]", []string{"2001:db8::2"}, 0},
+		{"quoted values", `"8.8.8.8", "[2001:db8::3]:80"`, []string{"8.8.8.8", "2001:db8::3"}, 0},
+		{"RFC 7239 obfuscated identifiers", "_hidden, _SEVKISEK, 1.1.1.1", []string{"1.1.1.1"}, 2},
+		{"empty tokens", ",,8.8.4.4,, ,", []string{"8.8.4.4"}, 0},
+		{"garbage between addresses", "8.8.8.8, not-an-ip, 300.1.1.1, 1.1.1.1", []string{"8.8.8.8", "1.1.1.1"}, 2},
+		{"unknown only means no IP", "unknown, UNKNOWN", nil, 2},
+		{"garbage only goes to OnParseError", "not-an-ip, unknown, also-bad", []string{"not-an-ip"}, 2},
+		{"zone identifiers are not addresses", "fe80::1%eth0, 8.8.8.8", []string{"8.8.8.8"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			defer plugin.Close()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Forwarded-For", tt.header)
+			if got := plugin.GetRemoteIPs(req); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			if got := plugin.ErrorCounts().SkippedTokens; got != tt.wantSkipped {
+				t.Errorf("expected %d skipped tokens, got %d", tt.wantSkipped, got)
+			}
+		})
+	}
+}
+
 func TestRemoteAddress_IntegrationWithStrategies(t *testing.T) {
 	// Test remoteAddress with different IP header strategies
 	cfg := &Config{
@@ -2063,3 +2136,152 @@ func TestIgnoreVerbs_ShouldSkipBlockingButStillEnrich(t *testing.T) {
 		})
 	}
 }
+
+func TestEnrichmentPolicy(t *testing.T) {
+	tests := []struct {
+		policy          string
+		bypassCountry   string
+		ignoredCountry  string
+		expectCreateErr bool
+	}{
+		{policy: "", bypassCountry: "US", ignoredCountry: "US"},
+		{policy: EnrichmentPolicyAlways, bypassCountry: "US", ignoredCountry: "US"},
+		{policy: EnrichmentPolicySkipBypassed, bypassCountry: "", ignoredCountry: "US"},
+		{policy: EnrichmentPolicySkipBypassedAndIgnored, bypassCountry: "", ignoredCountry: ""},
+		{policy: "Never", expectCreateErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run("Policy_"+tt.policy, func(t *testing.T) {
+			var seenCountry string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seenCountry = r.Header.Get("X-Country-Code")
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			cfg := &Config{
+				Enabled:              true,
+				DatabaseFilePath:     tinyDbFilePath,
+				BlockedCountries:     []string{"US"},
+				DefaultAllow:         true,
+				DisallowedStatusCode: http.StatusForbidden,
+				IPHeaders:            []string{"x-forwarded-for"},
+				IPHeaderStrategy:     IPHeaderStrategyCheckAll,
+				EnrichmentPolicy:     tt.policy,
+				CountryHeader:        "X-Country-Code",
+				IgnoreVerbs:          []string{"OPTIONS"},
+				BypassHeaders:        map[string]string{"X-Bypass-Token": "secret123"},
+			}
+
+			plugin, err := New(context.TODO(), next, cfg, pluginName)
+			if tt.expectCreateErr {
+				if err == nil {
+					t.Fatal("expected error for invalid EnrichmentPolicy")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create plugin: %v", err)
+			}
+
+			serve := func(method string, bypass bool) (int, string) {
+				seenCountry = ""
+				req := httptest.NewRequest(method, "/", nil)
+				req.Header.Set("X-Forwarded-For", "8.8.8.8")
+				if bypass {
+					req.Header.Set("X-Bypass-Token", "secret123")
+				}
+				rr := httptest.NewRecorder()
+				plugin.ServeHTTP(rr, req)
+				return rr.Code, seenCountry
+			}
+
+			if status, country := serve(http.MethodGet, true); status != http.StatusTeapot || country != tt.bypassCountry {
+				t.Errorf("bypassed request: expected %d/%q, got %d/%q", http.StatusTeapot, tt.bypassCountry, status, country)
+			}
+			if status, country := serve(http.MethodOptions, false); status != http.StatusTeapot || country != tt.ignoredCountry {
+				t.Errorf("ignored verb: expected %d/%q, got %d/%q", http.StatusTeapot, tt.ignoredCountry, status, country)
+			}
+			if status, _ := serve(http.MethodGet, false); status != http.StatusForbidden {
+				t.Errorf("regular request: expected %d, got %d", http.StatusForbidden, status)
+			}
+		})
+	}
+}
+
+func TestSkipLookupForAllowedIPBlocks(t *testing.T) {
+	newPlugin := func(t *testing.T, countryHeader string) *Plugin {
+		t.Helper()
+		cfg := &Config{
+			Enabled:                      true,
+			DatabaseFilePath:             tinyDbFilePath,
+			AllowedIPBlocks:              []string{"1.1.1.0/24"},
+			BlockedIPBlocks:              []string{"1.1.1.128/25"},
+			BanIfError:                   true,
+			DisallowedStatusCode:         http.StatusForbidden,
+			IPHeaders:                    []string{"x-real-ip"},
+			IPHeaderStrategy:             IPHeaderStrategyCheckAll,
+			CountryHeader:                countryHeader,
+			SkipLookupForAllowedIPBlocks: true,
+		}
+		handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("Failed to create plugin: %v", err)
+		}
+		plugin := handler.(*Plugin)
+		// Every database lookup fails from now on, so only requests that skip it can pass
+		breakDatabase(t, plugin)
+		return plugin
+	}
+
+	plugin := newPlugin(t, "")
+	if rr := serveWithClientIP(plugin, "1.1.1.1"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected allowed IP block to skip the lookup, got status %d", rr.Code)
+	}
+	if rr := serveWithClientIP(plugin, "1.1.1.200"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected more specific blocked IP block to still be looked up and blocked, got status %d", rr.Code)
+	}
+	if rr := serveWithClientIP(plugin, "8.8.8.8"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected other IPs to be looked up, got status %d", rr.Code)
+	}
+
+	// The country header needs the lookup, so the flag has no effect
+	plugin = newPlugin(t, "X-IPCountry")
+	if rr := serveWithClientIP(plugin, "1.1.1.1"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected lookup when a country header is configured, got status %d", rr.Code)
+	}
+
+	// Options deciding on the country reject it, an allowed IP block would be an unknown country to them
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{"geo pools", func(cfg *Config) { cfg.GeoPools = map[string]string{"EU": "eu"} }, true},
+		{"maintenance", func(cfg *Config) { cfg.MaintenanceCountries = []string{"DE"} }, true},
+		{"consent", func(cfg *Config) {
+			cfg.ConsentCountries = []string{"EU"}
+			cfg.ConsentCookieName = "consent"
+			cfg.ConsentRedirectURL = "https://example.com/consent"
+		}, true},
+		{"rule comparing the country", func(cfg *Config) { cfg.Rules = []string{"path startsWith '/admin' and not country == DE => block"} }, true},
+		{"rule without the country", func(cfg *Config) { cfg.Rules = []string{"path startsWith '/admin' => block"} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.AllowedIPBlocks = []string{"1.1.1.0/24"}
+			cfg.SkipLookupForAllowedIPBlocks = true
+			tt.modify(cfg)
+			_, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if tt.wantErr && (err == nil || !strings.Contains(err.Error(), "skipLookupForAllowedIPBlocks")) {
+				t.Errorf("expected a skipLookupForAllowedIPBlocks error, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected no error, but got: %v", err)
+			}
+		})
+	}
+}
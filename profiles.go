@@ -0,0 +1,80 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// Profile is a named policy of a middleware shared by many routers. Unset fields inherit the global
+// settings, or IPv4Policy/IPv6Policy for their address family.
+type Profile struct {
+	Hosts            []string // Host names selecting the profile when the request names none, "*.example.com" matches any subdomain
+	DefaultPolicy    string   // "allow" or "block" when no rule matches (empty inherits)
+	AllowedCountries []string // Replaces AllowedCountries when not empty
+	BlockedCountries []string // Replaces BlockedCountries when not empty
+}
+
+// profiles selects a named policy by request header, then by Host header
+type profiles struct {
+	header    string
+	byName    map[string]*hostRule
+	hosts     []hostRule // Profiles with Hosts, in name order
+	hostNames []string   // Names of the profiles in hosts
+}
+
+// newProfiles validates the profiles on top of the family rules. Returns nil when none is configured.
+func newProfiles(cfg *Config, global countryRules, ipv4Rules, ipv6Rules *countryRules, logger *slog.Logger) (*profiles, error) {
+	if len(cfg.Profiles) == 0 {
+		if cfg.ProfileHeader != "" {
+			logger.Warn("ProfileHeader has no effect without Profiles")
+		}
+		return nil, nil
+	}
+
+	// Sorted, so overlapping Hosts resolve the same way on every start
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := &profiles{header: cfg.ProfileHeader, byName: make(map[string]*hostRule, len(names))}
+	for _, name := range names {
+		profile := cfg.Profiles[name]
+		scope := fmt.Sprintf("Profiles[%s]", name)
+		if cfg.ProfileHeader == "" && len(profile.Hosts) == 0 {
+			return nil, fmt.Errorf("%s can never be selected, set ProfileHeader or Hosts", scope)
+		}
+
+		policy := AddressFamilyPolicy{DefaultPolicy: profile.DefaultPolicy, AllowedCountries: profile.AllowedCountries, BlockedCountries: profile.BlockedCountries}
+		rule, err := newHostRule(cfg, scope, profile.Hosts, policy, global, ipv4Rules, ipv6Rules, logger)
+		if err != nil {
+			return nil, err
+		}
+		p.byName[name] = &rule
+		if len(profile.Hosts) > 0 {
+			p.hosts = append(p.hosts, rule)
+			p.hostNames = append(p.hostNames, name)
+		}
+	}
+	return p, nil
+}
+
+// match returns the name and rules of the profile named by the request header, or else of the first
+// profile for the Host header. An unknown name is ignored, so clients can't drop the profile of their host;
+// it is still returned when no profile matches, for logs.
+func (p *profiles) match(req *http.Request) (string, *hostRule, bool) {
+	var name string
+	if p.header != "" {
+		name = req.Header.Get(p.header)
+		if rule, ok := p.byName[name]; ok {
+			return name, rule, true
+		}
+	}
+	if i := matchHost(p.hosts, hostName(req.Host)); i >= 0 {
+		return p.hostNames[i], &p.hosts[i], true
+	}
+	return name, nil, false
+}
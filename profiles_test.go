@@ -0,0 +1,68 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.HostRules = []HostRule{{Hosts: []string{"shop.example.com"}, AllowedCountries: []string{"DE"}}}
+	cfg.ProfileHeader = "X-Geoblock-Profile"
+	cfg.Profiles = map[string]Profile{
+		"relaxed": {DefaultPolicy: "allow"},
+		"strict":  {Hosts: []string{"*.admin.example.com"}, AllowedCountries: []string{"IE"}},
+	}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		name    string
+		host    string
+		profile string
+		ip      string
+		want    int
+	}{
+		{name: "header selects relaxed", host: "example.com", profile: "relaxed", ip: "8.8.8.8", want: http.StatusTeapot},
+		{name: "header wins over host rules", host: "shop.example.com", profile: "relaxed", ip: "8.8.8.8", want: http.StatusTeapot},
+		{name: "header wins over profile hosts", host: "eu.admin.example.com", profile: "relaxed", ip: "1.1.1.1", want: http.StatusTeapot},
+		{name: "host selects strict", host: "eu.admin.example.com", ip: "1.1.1.1", want: http.StatusForbidden},
+		{name: "strict allows its countries", host: "eu.admin.example.com", ip: "2a00:1450::1", want: http.StatusTeapot},
+		{name: "unknown profile is ignored", host: "shop.example.com", profile: "missing", ip: "85.214.132.1", want: http.StatusTeapot},
+		{name: "unknown profile keeps the host profile", host: "eu.admin.example.com", profile: "x", ip: "1.1.1.1", want: http.StatusForbidden},
+		{name: "global rules without profile", host: "example.com", ip: "8.8.8.8", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			req.Header.Set("X-Real-IP", tt.ip)
+			if tt.profile != "" {
+				req.Header.Set("X-Geoblock-Profile", tt.profile)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	cfg = CreateConfig()
+	cfg.Profiles = map[string]Profile{"orphan": {DefaultPolicy: "allow"}}
+	if _, err := newProfiles(cfg, countryRules{}, nil, nil, plugin.logger); err == nil {
+		t.Error("expected an error for a profile that can never be selected")
+	}
+}
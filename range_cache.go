@@ -0,0 +1,111 @@
+package traefik_geoblock
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// cachedRange is one database row: every IP in [from, to) has the same country
+type cachedRange struct {
+	from, to rangeKey
+	country  string
+}
+
+// rangeCache caches whole database rows, so IPs of an already seen row (e.g. an IPv6 scan walking a /32)
+// are answered without reading the BIN file. Rows never overlap, so each family is a sorted slice searched
+// by binary search. A full family is reset rather than evicting entries one by one.
+type rangeCache struct {
+	mu      sync.RWMutex
+	maxSize int
+	path    string // Database the rows come from, the cache is reset when it is hot-swapped
+	v4, v6  []cachedRange
+	hits    *int64 // Lookups answered from the cache
+	misses  *int64 // Lookups that read a row from the database
+}
+
+// newRangeCache returns nil when size is 0
+func newRangeCache(size int) *rangeCache {
+	if size <= 0 {
+		return nil
+	}
+	return &rangeCache{maxSize: size, hits: new(int64), misses: new(int64)}
+}
+
+// lookup returns the country of the IP from the cache, or from the database row which is then cached.
+// ok is false when the IP has to be looked up by the ip2location library (invalid, 6to4 or Teredo addresses).
+func (c *rangeCache) lookup(db *DatabaseWrapper, ip string) (country string, ok bool, err error) {
+	ipAddr := net.ParseIP(ip)
+	if ipAddr == nil {
+		return "", false, nil
+	}
+	key, v4 := ipRangeKey(ipAddr)
+	path := db.GetPath()
+
+	c.mu.RLock()
+	if c.path == path {
+		if country, found := findRange(c.family(v4), key); found {
+			c.mu.RUnlock()
+			atomic.AddInt64(c.hits, 1)
+			return country, true, nil
+		}
+	}
+	c.mu.RUnlock()
+	atomic.AddInt64(c.misses, 1)
+
+	country, from, to, v4, err := db.LookupRange(ipAddr)
+	if errors.Is(err, errRangeNotSupported) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path != path {
+		c.path, c.v4, c.v6 = path, nil, nil
+	}
+	ranges := c.family(v4)
+	if len(ranges) >= c.maxSize {
+		ranges = nil
+	}
+	ranges = insertRange(ranges, cachedRange{from: from, to: to, country: country})
+	if v4 {
+		c.v4 = ranges
+	} else {
+		c.v6 = ranges
+	}
+	return country, true, nil
+}
+
+// family returns the rows of the address family. Callers must hold a lock.
+func (c *rangeCache) family(v4 bool) []cachedRange {
+	if v4 {
+		return c.v4
+	}
+	return c.v6
+}
+
+// findRange returns the country of the row containing key
+func findRange(ranges []cachedRange, key rangeKey) (string, bool) {
+	i := sort.Search(len(ranges), func(i int) bool { return key.less(ranges[i].to) })
+	if i < len(ranges) && !key.less(ranges[i].from) {
+		return ranges[i].country, true
+	}
+	return "", false
+}
+
+// insertRange adds the row keeping the slice sorted. A row already present (concurrent miss) is kept once.
+func insertRange(ranges []cachedRange, r cachedRange) []cachedRange {
+	i := sort.Search(len(ranges), func(i int) bool { return r.from.less(ranges[i].to) })
+	if i < len(ranges) && ranges[i].from == r.from {
+		return ranges
+	}
+	ranges = append(ranges, cachedRange{})
+	copy(ranges[i+1:], ranges[i:])
+	ranges[i] = r
+	return ranges
+}
@@ -0,0 +1,98 @@
+package traefik_geoblock
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/ip2location/ip2location-go/v9"
+)
+
+func TestRangeCacheMatchesLibrary(t *testing.T) {
+	db, err := ip2location.OpenDB(dbFilePath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	wrapper := newDatabaseWrapper(db, dbFilePath, nil)
+	defer wrapper.Close()
+
+	cache := newRangeCache(1024)
+	random := rand.New(rand.NewSource(1))
+
+	ips := []string{"0.0.0.0", "255.255.255.255", "1.1.1.1", "8.8.8.8", "::1", "2001:4860::8888",
+		"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "::ffff:8.8.8.8"}
+	for i := 0; i < 3000; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, random.Uint32())
+		ips = append(ips, ip.String())
+
+		ip6 := make(net.IP, 16)
+		binary.BigEndian.PutUint16(ip6, uint16(0x2000+random.Intn(0x1000))) // Mostly allocated space
+		random.Read(ip6[2:])
+		ips = append(ips, ip6.String())
+	}
+
+	// Twice, so the second pass is served from the cache where the rows were kept
+	for pass := 0; pass < 2; pass++ {
+		served := 0
+		for _, ip := range ips {
+			want, err := db.Get_country_short(ip)
+			if err != nil {
+				t.Fatalf("library lookup of %s failed: %v", ip, err)
+			}
+			got, ok, err := cache.lookup(wrapper, ip)
+			if err != nil {
+				t.Fatalf("cached lookup of %s failed: %v", ip, err)
+			}
+			if ok {
+				served++
+				if got != want.Country_short {
+					t.Errorf("pass %d: %s: expected %q, got %q", pass, ip, want.Country_short, got)
+				}
+			}
+		}
+		if served < len(ips)*9/10 {
+			t.Errorf("pass %d: expected most lookups to use the range reader, got %d of %d", pass, served, len(ips))
+		}
+	}
+}
+
+func TestRangeCacheServesRowWithoutFile(t *testing.T) {
+	wrapper := newDatabaseWrapper(nil, tinyDbFilePath, nil)
+	cache := newRangeCache(16)
+
+	if country, ok, err := cache.lookup(wrapper, "8.8.8.1"); !ok || err != nil || country != "US" {
+		t.Fatalf("expected US, got %q %v %v", country, ok, err)
+	}
+
+	// Other IPs of the cached 8.8.8.0/24 row don't need the file anymore
+	wrapper.Close()
+	if country, ok, err := cache.lookup(wrapper, "8.8.8.200"); !ok || err != nil || country != "US" {
+		t.Errorf("expected cached US, got %q %v %v", country, ok, err)
+	}
+
+	// 6to4 and Teredo are left to the library, which maps them to IPv4
+	if _, ok, _ := cache.lookup(wrapper, "2002:808:808::1"); ok {
+		t.Error("expected 6to4 addresses to fall back to the library")
+	}
+}
+
+func TestRangeCacheReset(t *testing.T) {
+	wrapper := newDatabaseWrapper(nil, tinyDbFilePath, nil)
+	defer wrapper.Close()
+	cache := newRangeCache(1)
+
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "8.8.4.4"} {
+		if _, _, err := cache.lookup(wrapper, ip); err != nil {
+			t.Fatalf("lookup of %s failed: %v", ip, err)
+		}
+	}
+	if len(cache.v4) != 1 {
+		t.Errorf("expected the full cache to be reset, got %d rows", len(cache.v4))
+	}
+	if newRangeCache(0) != nil {
+		t.Error("expected no cache for size 0")
+	}
+}
@@ -0,0 +1,338 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// rangeOverridesMagic starts a compiled range overrides snapshot
+const rangeOverridesMagic = "GBOVR\x00\x00\x01"
+
+const (
+	rangeOverridesV4EntrySize = 4 + 4 + 2   // from, to, country
+	rangeOverridesV6EntrySize = 16 + 16 + 2 // from, to, country
+)
+
+// overrideRange maps the inclusive range [from, to] to a country
+type overrideRange struct {
+	from, to rangeKey
+	country  string
+}
+
+// overrideTable holds disjoint, sorted ranges per address family
+type overrideTable struct {
+	v4, v6 []overrideRange
+}
+
+// rangeOverrides replaces database countries for custom ranges. Tables are checked in order.
+type rangeOverrides struct {
+	tables []*overrideTable
+}
+
+// overridePrefix is a parsed "CIDR,COUNTRY" assignment
+type overridePrefix struct {
+	from, to  rangeKey
+	v4        bool
+	prefixLen int
+	country   string
+}
+
+// newRangeOverrides loads RangeOverrides and RangeOverridesFile. Returns nil when neither is set.
+func newRangeOverrides(cfg *Config, logger *slog.Logger) (*rangeOverrides, error) {
+	if len(cfg.RangeOverrides) == 0 && cfg.RangeOverridesFile == "" {
+		return nil, nil
+	}
+
+	overrides := &rangeOverrides{}
+
+	// Inline overrides are checked first so they can patch a shared file
+	if len(cfg.RangeOverrides) > 0 {
+		prefixes := make([]overridePrefix, 0, len(cfg.RangeOverrides))
+		for cidr, country := range cfg.RangeOverrides {
+			prefix, err := parseOverridePrefix(cidr, country)
+			if err != nil {
+				return nil, fmt.Errorf("RangeOverrides: %w", err)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		overrides.tables = append(overrides.tables, flattenOverridePrefixes(prefixes))
+	}
+
+	if cfg.RangeOverridesFile != "" {
+		data, err := os.ReadFile(cfg.RangeOverridesFile)
+		if err != nil {
+			return nil, fmt.Errorf("RangeOverridesFile: %w", err)
+		}
+		table, err := readOverrideTable(data)
+		if err != nil {
+			return nil, fmt.Errorf("RangeOverridesFile %s: %w", cfg.RangeOverridesFile, err)
+		}
+		overrides.tables = append(overrides.tables, table)
+		logger.Debug("loaded range overrides", "file", cfg.RangeOverridesFile,
+			"compiled", bytes.HasPrefix(data, []byte(rangeOverridesMagic)), "ipv4_ranges", len(table.v4), "ipv6_ranges", len(table.v6))
+	}
+
+	return overrides, nil
+}
+
+// lookup returns the overridden country for the IP, if any
+func (o *rangeOverrides) lookup(ip net.IP) (string, bool) {
+	if ip == nil {
+		return "", false
+	}
+	key, v4 := ipRangeKey(ip)
+	for _, table := range o.tables {
+		if country, ok := table.lookup(key, v4); ok {
+			return country, true
+		}
+	}
+	return "", false
+}
+
+// lookup returns the country of the range containing the key
+func (t *overrideTable) lookup(key rangeKey, v4 bool) (string, bool) {
+	ranges := t.v6
+	if v4 {
+		ranges = t.v4
+	}
+	// First range ending at or after the key
+	i := sort.Search(len(ranges), func(i int) bool { return !ranges[i].to.less(key) })
+	if i < len(ranges) && !key.less(ranges[i].from) {
+		return ranges[i].country, true
+	}
+	return "", false
+}
+
+// parseOverridePrefix parses a CIDR and a two letter country code
+func parseOverridePrefix(cidr, country string) (overridePrefix, error) {
+	_, block, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return overridePrefix{}, err
+	}
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return overridePrefix{}, fmt.Errorf("invalid country code %q for %s", country, cidr)
+	}
+
+	prefixLen, bits := block.Mask.Size()
+	from, v4 := ipRangeKey(block.IP)
+	if v4 != (bits == 32) {
+		return overridePrefix{}, fmt.Errorf("IPv4-mapped IPv6 CIDR %s is not supported, use the IPv4 form", cidr)
+	}
+
+	// Set every host bit to get the last address
+	to := from
+	hostBits := uint(bits - prefixLen)
+	switch {
+	case v4:
+		to.lo |= 1<<hostBits - 1
+	case hostBits >= 64:
+		to.lo = ^uint64(0)
+		to.hi |= 1<<(hostBits-64) - 1
+	default:
+		to.lo |= 1<<hostBits - 1
+	}
+	return overridePrefix{from: from, to: to, v4: v4, prefixLen: prefixLen, country: country}, nil
+}
+
+// parseOverrideLines reads "CIDR,COUNTRY[,NAME]" lines, skipping blank lines and # comments
+func parseOverrideLines(r io.Reader) ([]overridePrefix, error) {
+	var prefixes []overridePrefix
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected CIDR,COUNTRY", lineNum)
+		}
+		prefix, err := parseOverridePrefix(fields[0], fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
+
+// flattenOverridePrefixes turns possibly nested prefixes into disjoint ranges where the most specific
+// prefix wins. Among identical prefixes, the last one wins.
+func flattenOverridePrefixes(prefixes []overridePrefix) *overrideTable {
+	var v4, v6 []overridePrefix
+	for _, prefix := range prefixes {
+		if prefix.v4 {
+			v4 = append(v4, prefix)
+		} else {
+			v6 = append(v6, prefix)
+		}
+	}
+	return &overrideTable{v4: flattenFamily(v4), v6: flattenFamily(v6)}
+}
+
+// flattenFamily sweeps the prefixes of one address family. CIDRs are either nested or disjoint,
+// so the innermost open prefix on the stack always owns the current position.
+func flattenFamily(prefixes []overridePrefix) []overrideRange {
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		if prefixes[i].from != prefixes[j].from {
+			return prefixes[i].from.less(prefixes[j].from)
+		}
+		return prefixes[i].prefixLen < prefixes[j].prefixLen
+	})
+
+	var ranges []overrideRange
+	emit := func(from, to rangeKey, country string) {
+		if n := len(ranges); n > 0 && ranges[n-1].country == country {
+			if next, overflow := nextRangeKey(ranges[n-1].to); !overflow && next == from {
+				ranges[n-1].to = to
+				return
+			}
+		}
+		ranges = append(ranges, overrideRange{from: from, to: to, country: country})
+	}
+
+	var stack []overridePrefix
+	var pos rangeKey
+	exhausted := false // pos moved past the last address
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if exhausted || top.to.less(pos) {
+			return
+		}
+		emit(pos, top.to, top.country)
+		pos, exhausted = nextRangeKey(top.to)
+	}
+
+	for _, prefix := range prefixes {
+		for len(stack) > 0 && stack[len(stack)-1].to.less(prefix.from) {
+			pop()
+		}
+		if len(stack) > 0 && pos.less(prefix.from) {
+			emit(pos, prevRangeKey(prefix.from), stack[len(stack)-1].country)
+		}
+		pos = prefix.from
+		stack = append(stack, prefix)
+	}
+	for len(stack) > 0 {
+		pop()
+	}
+	return ranges
+}
+
+// nextRangeKey returns key+1, and whether it wrapped around
+func nextRangeKey(key rangeKey) (rangeKey, bool) {
+	if key.lo != ^uint64(0) {
+		return rangeKey{hi: key.hi, lo: key.lo + 1}, false
+	}
+	return rangeKey{hi: key.hi + 1}, key.hi == ^uint64(0)
+}
+
+// prevRangeKey returns key-1. key must not be zero.
+func prevRangeKey(key rangeKey) rangeKey {
+	if key.lo != 0 {
+		return rangeKey{hi: key.hi, lo: key.lo - 1}
+	}
+	return rangeKey{hi: key.hi - 1, lo: ^uint64(0)}
+}
+
+// readOverrideTable loads a compiled snapshot or, failing the magic check, "CIDR,COUNTRY" lines
+func readOverrideTable(data []byte) (*overrideTable, error) {
+	if !bytes.HasPrefix(data, []byte(rangeOverridesMagic)) {
+		prefixes, err := parseOverrideLines(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return flattenOverridePrefixes(prefixes), nil
+	}
+
+	data = data[len(rangeOverridesMagic):]
+	if len(data) < 8 {
+		return nil, fmt.Errorf("truncated snapshot header")
+	}
+	v4Count := uint64(binary.LittleEndian.Uint32(data))
+	v6Count := uint64(binary.LittleEndian.Uint32(data[4:]))
+	data = data[8:]
+	if uint64(len(data)) != v4Count*rangeOverridesV4EntrySize+v6Count*rangeOverridesV6EntrySize {
+		return nil, fmt.Errorf("snapshot size does not match its %d IPv4 and %d IPv6 ranges", v4Count, v6Count)
+	}
+
+	table := &overrideTable{v4: make([]overrideRange, v4Count), v6: make([]overrideRange, v6Count)}
+	for i := range table.v4 {
+		entry := data[i*rangeOverridesV4EntrySize:]
+		table.v4[i] = overrideRange{
+			from:    rangeKey{lo: uint64(binary.LittleEndian.Uint32(entry))},
+			to:      rangeKey{lo: uint64(binary.LittleEndian.Uint32(entry[4:]))},
+			country: string(entry[8:10]),
+		}
+	}
+	data = data[v4Count*rangeOverridesV4EntrySize:]
+	for i := range table.v6 {
+		entry := data[i*rangeOverridesV6EntrySize:]
+		table.v6[i] = overrideRange{
+			from:    rangeKey{hi: binary.LittleEndian.Uint64(entry), lo: binary.LittleEndian.Uint64(entry[8:])},
+			to:      rangeKey{hi: binary.LittleEndian.Uint64(entry[16:]), lo: binary.LittleEndian.Uint64(entry[24:])},
+			country: string(entry[32:34]),
+		}
+	}
+
+	// Lookups binary search the ranges, so refuse anything out of order
+	for _, ranges := range [][]overrideRange{table.v4, table.v6} {
+		for i, r := range ranges {
+			if r.to.less(r.from) || (i > 0 && !ranges[i-1].to.less(r.from)) {
+				return nil, fmt.Errorf("snapshot ranges are not sorted and disjoint")
+			}
+		}
+	}
+	return table, nil
+}
+
+// writeSnapshot writes the table in the compiled snapshot format
+func (t *overrideTable) writeSnapshot(w io.Writer) error {
+	buf := make([]byte, 0, len(rangeOverridesMagic)+8+len(t.v4)*rangeOverridesV4EntrySize+len(t.v6)*rangeOverridesV6EntrySize)
+	buf = append(buf, rangeOverridesMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.v4)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.v6)))
+	for _, r := range t.v4 {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(r.from.lo))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(r.to.lo))
+		buf = append(buf, r.country...)
+	}
+	for _, r := range t.v6 {
+		buf = binary.LittleEndian.AppendUint64(buf, r.from.hi)
+		buf = binary.LittleEndian.AppendUint64(buf, r.from.lo)
+		buf = binary.LittleEndian.AppendUint64(buf, r.to.hi)
+		buf = binary.LittleEndian.AppendUint64(buf, r.to.lo)
+		buf = append(buf, r.country...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// CompileRangeOverrides compiles "CIDR,COUNTRY[,NAME]" lines into the snapshot format accepted by
+// RangeOverridesFile, so startup skips parsing and flattening large lists. Returns the number of ranges written.
+func CompileRangeOverrides(in io.Reader, out io.Writer) (int, error) {
+	prefixes, err := parseOverrideLines(in)
+	if err != nil {
+		return 0, err
+	}
+	table := flattenOverridePrefixes(prefixes)
+	if err := table.writeSnapshot(out); err != nil {
+		return 0, err
+	}
+	return len(table.v4) + len(table.v6), nil
+}
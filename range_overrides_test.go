@@ -0,0 +1,137 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const rangeOverridesText = `# office ranges
+10.0.0.0/8,US
+10.20.0.0/16,DE,Germany
+10.20.5.0/24,FR
+10.255.255.255/32,CH
+192.0.2.0/25,JP
+192.0.2.128/25,JP
+::/0,NL
+2001:db8::/32,SE
+`
+
+func TestRangeOverrides_Lookup(t *testing.T) {
+	prefixes, err := parseOverrideLines(strings.NewReader(rangeOverridesText))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	table := flattenOverridePrefixes(prefixes)
+
+	// Adjacent ranges with the same country are merged
+	if len(table.v4) != 7 {
+		t.Errorf("expected 7 IPv4 ranges, got %d: %+v", len(table.v4), table.v4)
+	}
+
+	var compiled bytes.Buffer
+	if err := table.writeSnapshot(&compiled); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	loaded, err := readOverrideTable(compiled.Bytes())
+	if err != nil {
+		t.Fatalf("reading snapshot failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"10.0.0.1":         "US",
+		"10.19.255.255":    "US",
+		"10.20.0.0":        "DE",
+		"10.20.5.77":       "FR",
+		"10.20.6.0":        "DE",
+		"10.21.0.0":        "US",
+		"10.255.255.254":   "US",
+		"10.255.255.255":   "CH",
+		"192.0.2.200":      "JP",
+		"11.0.0.0":         "",
+		"2001:db8::1":      "SE",
+		"2001:db9::1":      "NL",
+		"ffff:ffff::1":     "NL",
+		"::ffff:10.20.5.1": "FR",
+	}
+	for name, overrides := range map[string]*rangeOverrides{
+		"text":     {tables: []*overrideTable{table}},
+		"snapshot": {tables: []*overrideTable{loaded}},
+	} {
+		for ip, want := range tests {
+			got, ok := overrides.lookup(net.ParseIP(ip))
+			if got != want || ok != (want != "") {
+				t.Errorf("%s: lookup(%s) = %q/%v, want %q", name, ip, got, ok, want)
+			}
+		}
+	}
+}
+
+func TestRangeOverrides_InvalidInput(t *testing.T) {
+	for _, input := range []string{"10.0.0.0/8", "10.0.0.0/8,USA", "10.0.0.0/33,US", "::ffff:10.0.0.0/104,US"} {
+		if _, err := parseOverrideLines(strings.NewReader(input)); err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+
+	var compiled bytes.Buffer
+	if _, err := CompileRangeOverrides(strings.NewReader(rangeOverridesText), &compiled); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	if _, err := readOverrideTable(compiled.Bytes()[:compiled.Len()-3]); err == nil {
+		t.Error("expected error for a truncated snapshot")
+	}
+}
+
+func TestRangeOverrides_Plugin(t *testing.T) {
+	var compiled bytes.Buffer
+	if _, err := CompileRangeOverrides(strings.NewReader("9.9.9.0/24,CH\n8.8.8.0/24,CH\n"), &compiled); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	snapshotPath := filepath.Join(t.TempDir(), "overrides.bin")
+	if err := os.WriteFile(snapshotPath, compiled.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"CH"}
+	cfg.RangeOverridesFile = snapshotPath
+	cfg.RangeOverrides = map[string]string{"8.8.8.8/32": "us"}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		ip          string
+		wantAllowed bool
+		wantCountry string
+	}{
+		{"9.9.9.9", true, "CH"},  // No country in the database, overridden by the snapshot
+		{"8.8.8.1", true, "CH"},  // US in the database, overridden by the snapshot
+		{"8.8.8.8", false, "US"}, // Inline overrides win over the file
+		{"1.1.1.1", false, "AU"}, // Not overridden
+	}
+	for _, tt := range tests {
+		allowed, country, _, err := plugin.CheckAllowed(tt.ip)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if allowed != tt.wantAllowed || country != tt.wantCountry {
+			t.Errorf("%s: expected %v/%s, got %v/%s", tt.ip, tt.wantAllowed, tt.wantCountry, allowed, country)
+		}
+	}
+
+	cfg.RangeOverrides = map[string]string{"8.8.8.8/32": "United States"}
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Error("expected error for an invalid country code")
+	}
+}
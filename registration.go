@@ -0,0 +1,129 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PhaseRegistrationMismatch is used when an IP geolocated in an allowed country is registered elsewhere
+const PhaseRegistrationMismatch = "registration_mismatch"
+
+// registrations maps IP ranges to the country they are registered to, from RIR delegation files
+type registrations struct {
+	table *overrideTable
+}
+
+// newRegistrations loads RegistrationFiles. Returns nil unless RequireRegistrationMatch is set.
+func newRegistrations(cfg *Config, logger *slog.Logger) (*registrations, error) {
+	if !cfg.RequireRegistrationMatch {
+		if len(cfg.RegistrationFiles) > 0 {
+			logger.Warn("RegistrationFiles has no effect without RequireRegistrationMatch")
+		}
+		return nil, nil
+	}
+	if len(cfg.RegistrationFiles) == 0 {
+		return nil, fmt.Errorf("RequireRegistrationMatch needs RegistrationFiles")
+	}
+
+	var v4, v6 []overrideRange
+	for _, path := range cfg.RegistrationFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("RegistrationFiles: %w", err)
+		}
+		fileV4, fileV6, err := parseDelegations(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("RegistrationFiles %s: %w", path, err)
+		}
+		logger.Debug("loaded registrations", "file", path, "ipv4_ranges", len(fileV4), "ipv6_ranges", len(fileV6))
+		v4 = append(v4, fileV4...)
+		v6 = append(v6, fileV6...)
+	}
+
+	v4, v4Overlaps := disjointRanges(v4)
+	v6, v6Overlaps := disjointRanges(v6)
+	if overlaps := v4Overlaps + v6Overlaps; overlaps > 0 {
+		// Usually the same registry file listed twice, the first registration wins
+		logger.Warn("ignored overlapping registrations", "count", overlaps)
+	}
+	return &registrations{table: &overrideTable{v4: v4, v6: v6}}, nil
+}
+
+// lookup returns the country the IP is registered to
+func (r *registrations) lookup(ip net.IP) (string, bool) {
+	key, v4 := ipRangeKey(ip)
+	return r.table.lookup(key, v4)
+}
+
+// parseDelegations reads an RIR statistics exchange file ("delegated-<registry>-extended-latest"):
+// registry|cc|type|start|value|date|status[|opaque-id]. IPv4 values are address counts, IPv6 values prefix lengths.
+// Only allocated and assigned ranges are returned.
+func parseDelegations(r io.Reader) (v4, v6 []overrideRange, err error) {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		// The version line starts with a number, summary lines have "*" as country
+		if len(fields) < 7 || fields[1] == "*" || fields[1] == "" {
+			continue
+		}
+		if status := fields[6]; status != "allocated" && status != "assigned" {
+			continue
+		}
+		country := strings.ToUpper(fields[1])
+		if len(country) != 2 {
+			return nil, nil, fmt.Errorf("line %d: invalid country code %q", lineNum, fields[1])
+		}
+
+		switch fields[2] {
+		case "ipv4":
+			start := net.ParseIP(fields[3]).To4()
+			count, err := strconv.ParseUint(fields[4], 10, 32)
+			if start == nil || err != nil || count == 0 {
+				return nil, nil, fmt.Errorf("line %d: invalid IPv4 delegation %s|%s", lineNum, fields[3], fields[4])
+			}
+			from, _ := ipRangeKey(start)
+			to := rangeKey{lo: from.lo + count - 1}
+			if to.lo > 0xFFFFFFFF {
+				return nil, nil, fmt.Errorf("line %d: IPv4 delegation %s|%s overflows", lineNum, fields[3], fields[4])
+			}
+			v4 = append(v4, overrideRange{from: from, to: to, country: country})
+		case "ipv6":
+			prefix, err := parseOverridePrefix(fields[3]+"/"+fields[4], country)
+			if err != nil || prefix.v4 {
+				return nil, nil, fmt.Errorf("line %d: invalid IPv6 delegation %s/%s", lineNum, fields[3], fields[4])
+			}
+			v6 = append(v6, overrideRange{from: prefix.from, to: prefix.to, country: country})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return v4, v6, nil
+}
+
+// disjointRanges sorts the ranges and drops the ones overlapping an earlier range. Returns the number dropped.
+func disjointRanges(ranges []overrideRange) ([]overrideRange, int) {
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].from.less(ranges[j].from) })
+	kept := ranges[:0]
+	for _, r := range ranges {
+		if n := len(kept); n > 0 && !kept[n-1].to.less(r.from) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, len(ranges) - len(kept)
+}
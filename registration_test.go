@@ -0,0 +1,97 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDelegations = `2|ripencc|20250401|5|19830705|20250331|+0100
+ripencc|*|ipv4|*|3|summary
+ripencc|DE|ipv4|85.214.0.0|65536|20010101|allocated|x
+ripencc|NL|ipv4|185.5.82.0|256|20150101|assigned|y
+ripencc|ZZ|ipv4|185.5.83.0|256||available|
+arin|US|ipv4|8.8.8.0|512|19920101|allocated|z
+arin|US|asn|15169|1|20000330|assigned|z
+ripencc|IE|ipv6|2a00:1450::|32|20090101|allocated|w
+`
+
+func TestParseDelegations(t *testing.T) {
+	v4, v6, err := parseDelegations(strings.NewReader(testDelegations))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(v4) != 3 || len(v6) != 1 {
+		t.Fatalf("expected 3 IPv4 and 1 IPv6 ranges, got %d and %d", len(v4), len(v6))
+	}
+
+	v4, _ = disjointRanges(v4)
+	r := &registrations{table: &overrideTable{v4: v4, v6: v6}}
+	tests := map[string]string{
+		"85.214.132.117": "DE",
+		"85.215.0.1":     "",
+		"8.8.9.255":      "US", // 512 addresses span two /24s
+		"8.8.10.0":       "",
+		"185.5.82.10":    "NL",
+		"185.5.83.10":    "", // available space is not registered
+		"2a00:1450::1":   "IE",
+	}
+	for ip, want := range tests {
+		if got, _ := r.lookup(net.ParseIP(ip)); got != want {
+			t.Errorf("%s: expected %q, got %q", ip, want, got)
+		}
+	}
+
+	if _, _, err := parseDelegations(strings.NewReader("arin|US|ipv4|8.8.8.0|0|19920101|allocated\n")); err == nil {
+		t.Error("expected an empty IPv4 delegation to be rejected")
+	}
+}
+
+func TestRequireRegistrationMatch(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	path := filepath.Join(t.TempDir(), "delegated-test-extended-latest")
+	if err := os.WriteFile(path, []byte(testDelegations), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"DE", "US"}
+	cfg.RegistrationFiles = []string{path}
+	cfg.RequireRegistrationMatch = true
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		ip          string
+		wantAllowed bool
+		wantPhase   string
+	}{
+		{"85.214.132.117", true, PhaseAllowedCountry},     // Geolocated and registered in DE
+		{"8.8.8.8", true, PhaseAllowedCountry},            // Geolocated and registered in US
+		{"185.5.82.10", false, PhaseRegistrationMismatch}, // Geolocated in DE, registered in NL
+		{"8.8.4.4", false, PhaseRegistrationMismatch},     // Geolocated in US, not registered
+		{"2a00:1450::1", false, PhaseDefaultAllow},        // IE is not allowed in the first place
+	}
+	for _, tt := range tests {
+		allowed, _, phase, err := plugin.CheckAllowed(tt.ip)
+		if err != nil || allowed != tt.wantAllowed || phase != tt.wantPhase {
+			t.Errorf("%s: expected %v/%s, got %v/%s (err: %v)", tt.ip, tt.wantAllowed, tt.wantPhase, allowed, phase, err)
+		}
+	}
+
+	cfg.RegistrationFiles = nil
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil); err == nil {
+		t.Error("expected RequireRegistrationMatch without RegistrationFiles to fail")
+	}
+}
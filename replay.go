@@ -0,0 +1,103 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReplaySummary reports what the configured rules would have done with the requests found in an access log
+type ReplaySummary struct {
+	Lines            int            // Total number of lines read
+	Evaluated        int            // Lines where a client IP was found and evaluated
+	Skipped          int            // Lines where no client IP could be extracted
+	Allowed          int            // Requests that would have been allowed
+	Blocked          int            // Requests that would have been blocked
+	Errors           int            // Requests whose evaluation failed
+	UniqueIPs        int            // Number of distinct client IPs seen
+	BlockedByCountry map[string]int // Blocked requests grouped by country code
+	BlockedByPhase   map[string]int // Blocked requests grouped by decision phase
+}
+
+// Replay reads an access log line by line and runs every client IP through CheckAllowed.
+// Nothing is blocked: the result is a summary of what would have been blocked with the current
+// configuration. As a side effect every lookup touches the database, so replaying a recent log
+// before enabling enforcement also warms up the database pages for the real traffic.
+//
+// Supported formats (auto-detected per line):
+//   - Common/Combined Log Format (nginx, Apache): the client IP is the first field
+//   - Traefik JSON access logs: the ClientHost or ClientAddr field
+func (p Plugin) Replay(r io.Reader) (*ReplaySummary, error) {
+	summary := &ReplaySummary{
+		BlockedByCountry: make(map[string]int),
+		BlockedByPhase:   make(map[string]int),
+	}
+	seenIPs := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // JSON access log lines can be long
+	for scanner.Scan() {
+		summary.Lines++
+
+		ip := extractIPFromLogLine(scanner.Text())
+		if ip == "" {
+			summary.Skipped++
+			continue
+		}
+
+		summary.Evaluated++
+		seenIPs[ip] = struct{}{}
+
+		allowed, country, phase, err := p.CheckAllowed(ip)
+		switch {
+		case err != nil:
+			summary.Errors++
+			p.logger.Debug("replay evaluation failed", "ip", ip, "error", err)
+		case allowed:
+			summary.Allowed++
+		default:
+			summary.Blocked++
+			summary.BlockedByCountry[country]++
+			summary.BlockedByPhase[phase]++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return summary, fmt.Errorf("error reading access log: %w", err)
+	}
+
+	summary.UniqueIPs = len(seenIPs)
+	return summary, nil
+}
+
+// extractIPFromLogLine returns the client IP of a single access log line, or an empty string if none was found
+func extractIPFromLogLine(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	// Traefik JSON access log
+	if strings.HasPrefix(line, "{") {
+		var entry struct {
+			ClientHost string `json:"ClientHost"`
+			ClientAddr string `json:"ClientAddr"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return ""
+		}
+		if entry.ClientHost != "" {
+			return cleanIPAddress(entry.ClientHost)
+		}
+		return cleanIPAddress(entry.ClientAddr)
+	}
+
+	// Common/Combined Log Format: the remote host is the first field
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] == "-" {
+		return ""
+	}
+	return cleanIPAddress(fields[0])
+}
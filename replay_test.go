@@ -0,0 +1,89 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractIPFromLogLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"common log format", `8.8.8.8 - - [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 2326`, "8.8.8.8"},
+		{"combined log format ipv6", `2001:db8::1 - frank [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 2326 "-" "curl/8.0"`, "2001:db8::1"},
+		{"traefik json client host", `{"ClientHost":"1.1.1.1","ClientAddr":"1.1.1.1:51234","RequestPath":"/"}`, "1.1.1.1"},
+		{"traefik json client addr only", `{"ClientAddr":"1.1.1.1:51234"}`, "1.1.1.1"},
+		{"empty line", "", ""},
+		{"comment", "# generated by nginx", ""},
+		{"dash host", `- - - [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 0`, ""},
+		{"broken json", `{"ClientHost":`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractIPFromLogLine(tt.line); got != tt.want {
+				t.Errorf("extractIPFromLogLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlugin_Replay(t *testing.T) {
+	cfg := &Config{
+		Enabled:              true,
+		DatabaseFilePath:     dbFilePath,
+		AllowedCountries:     []string{"AU"},
+		AllowPrivate:         true,
+		DisallowedStatusCode: http.StatusForbidden,
+		IPHeaders:            []string{"x-forwarded-for", "x-real-ip"},
+		IPHeaderStrategy:     IPHeaderStrategyCheckAll,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	accessLog := strings.Join([]string{
+		`1.1.1.1 - - [10/Oct/2024:13:55:36 +0000] "GET / HTTP/1.1" 200 2326`,
+		`8.8.8.8 - - [10/Oct/2024:13:55:37 +0000] "GET / HTTP/1.1" 200 2326`,
+		`{"ClientHost":"8.8.8.8","RequestPath":"/api"}`,
+		`192.168.1.10 - - [10/Oct/2024:13:55:38 +0000] "GET / HTTP/1.1" 200 2326`,
+		`# log rotated`,
+		`not-an-ip - - [10/Oct/2024:13:55:39 +0000] "GET / HTTP/1.1" 200 2326`,
+	}, "\n")
+
+	summary, err := plugin.(*Plugin).Replay(strings.NewReader(accessLog))
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	if summary.Lines != 6 {
+		t.Errorf("expected 6 lines, got %d", summary.Lines)
+	}
+	if summary.Evaluated != 5 || summary.Skipped != 1 {
+		t.Errorf("expected 5 evaluated and 1 skipped, got %d and %d", summary.Evaluated, summary.Skipped)
+	}
+	if summary.Allowed != 2 {
+		t.Errorf("expected 2 allowed (AU + private), got %d", summary.Allowed)
+	}
+	if summary.Blocked != 2 {
+		t.Errorf("expected 2 blocked, got %d", summary.Blocked)
+	}
+	if summary.Errors != 1 {
+		t.Errorf("expected 1 error, got %d", summary.Errors)
+	}
+	if summary.UniqueIPs != 4 {
+		t.Errorf("expected 4 unique IPs, got %d", summary.UniqueIPs)
+	}
+	if summary.BlockedByCountry["US"] != 2 {
+		t.Errorf("expected 2 blocked requests for US, got %d", summary.BlockedByCountry["US"])
+	}
+	if summary.BlockedByPhase[PhaseDefaultAllow] != 2 {
+		t.Errorf("expected 2 blocked requests in phase %s, got %d", PhaseDefaultAllow, summary.BlockedByPhase[PhaseDefaultAllow])
+	}
+}
@@ -0,0 +1,227 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// heartbeatTimeout bounds one publication to a heartbeat endpoint
+	heartbeatTimeout = 10 * time.Second
+	// heartbeatStaleIntervals is how many missed intervals make a replica count as gone
+	heartbeatStaleIntervals = 3
+)
+
+// DatabaseHeartbeat is what a replica publishes about its database to DatabaseHeartbeatTarget
+type DatabaseHeartbeat struct {
+	Host      string    `json:"host"`
+	FactoryID string    `json:"factoryId"`
+	Version   string    `json:"version"` // Database version, e.g. "25.4.1"
+	SHA256    string    `json:"sha256"`  // Hash of the database file in use
+	Time      time.Time `json:"time"`
+}
+
+// validateHeartbeatTarget checks the heartbeat settings, an empty target disables the heartbeat
+func validateHeartbeatTarget(target string, seconds int) error {
+	if target == "" {
+		return nil
+	}
+	if seconds <= 0 {
+		return fmt.Errorf("DatabaseHeartbeatSeconds must be positive, got %d", seconds)
+	}
+	if !isHeartbeatURL(target) {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, target, nil)
+	if err != nil || req.URL.Host == "" {
+		return fmt.Errorf("invalid DatabaseHeartbeatTarget %q, must be a directory or an http(s) URL", target)
+	}
+	return nil
+}
+
+// isHeartbeatURL tells an endpoint from a shared directory
+func isHeartbeatURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// runHeartbeat publishes the database of this replica at startup and on every tick, and warns about replicas
+// more than one monthly release apart, until the factory is closed
+func (df *DatabaseFactory) runHeartbeat(ticker Ticker) {
+	host, _ := os.Hostname()
+	var hashedPath, hash string
+	for {
+		path := df.wrapper.GetPath()
+		if path != hashedPath {
+			sum, err := hashFile(path)
+			if err != nil {
+				df.logger.Warn("failed to hash database for the heartbeat", "path", path, "error", err)
+			}
+			hashedPath, hash = path, sum
+		}
+
+		own := DatabaseHeartbeat{Host: host, FactoryID: df.factoryID, SHA256: hash, Time: df.clock.Now().UTC()}
+		if version := df.wrapper.GetVersion(); version != nil {
+			own.Version = version.String()
+		}
+		replicas, err := df.publishHeartbeat(own)
+		if err != nil {
+			df.logger.Warn("database heartbeat failed", "target", df.config.DatabaseHeartbeatTarget, "error", err)
+		} else {
+			maxAge := heartbeatStaleIntervals * time.Duration(df.config.DatabaseHeartbeatSeconds) * time.Second
+			df.compareReplicas(own, replicas, maxAge)
+		}
+
+		select {
+		case <-ticker.C():
+		case <-df.stopChan:
+			return
+		}
+	}
+}
+
+// publishHeartbeat writes the heartbeat and returns those of the other replicas. A directory holds one file per
+// replica; an endpoint is POSTed the heartbeat and may answer with a JSON array of the replicas it knows.
+func (df *DatabaseFactory) publishHeartbeat(own DatabaseHeartbeat) ([]DatabaseHeartbeat, error) {
+	encoded, err := json.Marshal(own)
+	if err != nil {
+		return nil, err
+	}
+	target := df.config.DatabaseHeartbeatTarget
+
+	if isHeartbeatURL(target) {
+		client := &http.Client{Timeout: heartbeatTimeout}
+		resp, err := client.Post(target, "application/json", bytes.NewReader(encoded)) // #nosec G107
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		var replicas []DatabaseHeartbeat
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &replicas); err != nil {
+				return nil, fmt.Errorf("invalid replica list: %w", err)
+			}
+		}
+		return replicas, nil
+	}
+
+	// Written then renamed, so readers never see half a file
+	name := heartbeatFileName(own)
+	temp := filepath.Join(target, "."+name+".tmp")
+	if err := os.WriteFile(temp, encoded, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(temp, filepath.Join(target, name)); err != nil {
+		os.Remove(temp)
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(target, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var replicas []DatabaseHeartbeat
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue // Removed by its replica in the meantime
+		}
+		var replica DatabaseHeartbeat
+		if err := json.Unmarshal(content, &replica); err != nil {
+			df.logger.Debug("ignoring invalid heartbeat file", "file", file, "error", err)
+			continue
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+// heartbeatFileName names the heartbeat file of a replica in the shared directory
+func heartbeatFileName(own DatabaseHeartbeat) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, own.Host)
+	return name + "-" + own.FactoryID + ".json"
+}
+
+// compareReplicas warns about replicas more than one release apart, or on the same version with another file.
+// Replicas that stopped publishing for maxAge are ignored.
+func (df *DatabaseFactory) compareReplicas(own DatabaseHeartbeat, replicas []DatabaseHeartbeat, maxAge time.Duration) {
+	ownRelease, ok := databaseRelease(own.Version)
+	if !ok {
+		return
+	}
+	for _, replica := range replicas {
+		if replica.Host == own.Host && replica.FactoryID == own.FactoryID {
+			continue
+		}
+		if own.Time.Sub(replica.Time) > maxAge {
+			continue
+		}
+		release, ok := databaseRelease(replica.Version)
+		if !ok {
+			continue
+		}
+
+		apart := ownRelease - release
+		if apart < 0 {
+			apart = -apart
+		}
+		switch {
+		case apart > 1:
+			df.logger.Warn("replica database diverges",
+				"replica", replica.Host,
+				"replica_version", replica.Version,
+				"version", own.Version,
+				"releases_apart", apart,
+				"behind", ownRelease < release)
+		case replica.Version == own.Version && replica.SHA256 != "" && own.SHA256 != "" && replica.SHA256 != own.SHA256:
+			df.logger.Warn("replica database differs with the same version",
+				"replica", replica.Host,
+				"version", own.Version,
+				"replica_sha256", replica.SHA256,
+				"sha256", own.SHA256)
+		}
+	}
+}
+
+// databaseRelease numbers the monthly release of a "year.month.day" version, so versions can be subtracted
+func databaseRelease(version string) (int, bool) {
+	var year, month, day int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &year, &month, &day); err != nil || month < 1 || month > 12 {
+		return 0, false
+	}
+	return year*12 + month - 1, true
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,122 @@
+package traefik_geoblock
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicaHeartbeat_Directory(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)
+	writeReplica := func(name string, heartbeat DatabaseHeartbeat) {
+		t.Helper()
+		encoded, _ := json.Marshal(heartbeat)
+		if err := os.WriteFile(filepath.Join(dir, name), encoded, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeReplica("stuck.json", DatabaseHeartbeat{Host: "stuck", FactoryID: "1", Version: "25.1.1", Time: now})
+	writeReplica("previous.json", DatabaseHeartbeat{Host: "previous", FactoryID: "1", Version: "25.3.1", Time: now})
+	writeReplica("gone.json", DatabaseHeartbeat{Host: "gone", FactoryID: "1", Version: "24.1.1", Time: now.Add(-time.Hour)})
+
+	clock := newFakeClock(now)
+	logs := &syncBuffer{}
+	factory, err := newDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:         tinyDbFilePath,
+		DatabaseHeartbeatTarget:  dir,
+		DatabaseHeartbeatSeconds: 60,
+	}, slog.New(slog.NewTextHandler(logs, nil)), clock)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	waitFor(t, "divergence warning", func() bool { return strings.Contains(logs.String(), "replica database diverges") })
+	output := logs.String()
+	for _, want := range []string{"replica=stuck", "replica_version=25.1.1", "version=25.4.1", "releases_apart=3", "behind=false"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in the warning, got %s", want, output)
+		}
+	}
+	// One release apart is normal during a rollout, and replicas that stopped publishing are ignored
+	for _, unwanted := range []string{"replica=previous", "replica=gone"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("expected no warning for %q, got %s", unwanted, output)
+		}
+	}
+
+	host, _ := os.Hostname()
+	content, err := os.ReadFile(filepath.Join(dir, heartbeatFileName(DatabaseHeartbeat{Host: host, FactoryID: factory.GetFactoryID()})))
+	if err != nil {
+		t.Fatalf("expected the heartbeat of this replica: %v", err)
+	}
+	var own DatabaseHeartbeat
+	if err := json.Unmarshal(content, &own); err != nil || own.Version != "25.4.1" || len(own.SHA256) != 64 {
+		t.Errorf("unexpected heartbeat %s (%v)", content, err)
+	}
+}
+
+func TestReplicaHeartbeat_Endpoint(t *testing.T) {
+	published := make(chan DatabaseHeartbeat, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var heartbeat DatabaseHeartbeat
+		if err := json.NewDecoder(r.Body).Decode(&heartbeat); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		published <- heartbeat
+		json.NewEncoder(w).Encode([]DatabaseHeartbeat{
+			heartbeat,
+			{Host: "ahead", FactoryID: "1", Version: "25.6.1", Time: heartbeat.Time},
+			{Host: "twin", FactoryID: "1", Version: heartbeat.Version, SHA256: "00", Time: heartbeat.Time},
+		})
+	}))
+	defer server.Close()
+
+	logs := &syncBuffer{}
+	factory, err := newDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:         tinyDbFilePath,
+		DatabaseHeartbeatTarget:  server.URL,
+		DatabaseHeartbeatSeconds: 60,
+	}, slog.New(slog.NewTextHandler(logs, nil)), newFakeClock(time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	if heartbeat := <-published; heartbeat.Version != "25.4.1" || heartbeat.FactoryID != factory.GetFactoryID() {
+		t.Errorf("unexpected heartbeat %+v", heartbeat)
+	}
+	waitFor(t, "replica warnings", func() bool {
+		return strings.Contains(logs.String(), "replica=ahead") && strings.Contains(logs.String(), "replica database differs with the same version")
+	})
+	if !strings.Contains(logs.String(), "behind=true") {
+		t.Errorf("expected this replica to be behind, got %s", logs.String())
+	}
+}
+
+func TestValidateHeartbeatTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		seconds int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"/shared/geoblock", 300, false},
+		{"https://fleet.example.com/heartbeat", 300, false},
+		{"https://", 300, true},
+		{"/shared/geoblock", 0, true},
+	}
+	for _, tt := range tests {
+		if err := validateHeartbeatTarget(tt.target, tt.seconds); (err != nil) != tt.wantErr {
+			t.Errorf("validateHeartbeatTarget(%q, %d) = %v, wantErr %v", tt.target, tt.seconds, err, tt.wantErr)
+		}
+	}
+}
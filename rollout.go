@@ -0,0 +1,81 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+)
+
+// validateRolloutPercent checks the RolloutPercent setting. Unset enforces every block, so configs
+// without the option are unchanged; 0 enforces none, every block is monitor-only.
+func validateRolloutPercent(percent *int) (int, error) {
+	if percent == nil {
+		return 100, nil
+	}
+	if *percent < 0 || *percent > 100 {
+		return 0, fmt.Errorf("RolloutPercent must be between 0 and 100, got %d", *percent)
+	}
+	return *percent, nil
+}
+
+// rolloutBucket maps an IP to a stable bucket in [0, 100)
+func rolloutBucket(ip string) int {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return int(h.Sum32() % 100)
+}
+
+// enforceBlock reports whether a blocking decision must be enforced. When RolloutPercent is below 100,
+// only IPs whose hash bucket falls inside the percentage are blocked. The rest are logged as
+// monitor-only and let through, so the impact of a new rule can be measured before full rollout.
+// Countries still in their CountryBlockGraceMinutes, and IPs of a family left out of EnforceAddressFamilies,
+// are let through the same way.
+func (p Plugin) enforceBlock(decision ipDecision, ipChain string) bool {
+	if p.countryGrace != nil {
+		if until, ok := p.countryGrace.until(decision, time.Now()); ok {
+			if level, ok := p.logPhaseLevels.level(decision.phase, slog.LevelInfo, p.logBannedRequests); ok {
+				p.logger.Log(context.Background(), level, "would block (grace)",
+					"ip", decision.ip,
+					"ip_chain", ipChain,
+					"country", decision.country,
+					"phase", decision.phase,
+					"grace_until", until.UTC().Format(time.RFC3339))
+			}
+			return false
+		}
+	}
+
+	if p.monitorFamily != "" && addressFamily(decision.ip) == p.monitorFamily {
+		if level, ok := p.logPhaseLevels.level(decision.phase, slog.LevelInfo, p.logBannedRequests); ok {
+			p.logger.Log(context.Background(), level, "monitor-only block (address family not enforced)",
+				"ip", decision.ip,
+				"ip_chain", ipChain,
+				"country", decision.country,
+				"phase", decision.phase,
+				"address_family", p.monitorFamily)
+		}
+		return false
+	}
+
+	if p.rolloutPercent >= 100 {
+		return true
+	}
+
+	bucket := rolloutBucket(decision.ip)
+	if bucket < p.rolloutPercent {
+		return true
+	}
+
+	if level, ok := p.logPhaseLevels.level(decision.phase, slog.LevelInfo, p.logBannedRequests); ok {
+		p.logger.Log(context.Background(), level, "monitor-only block (outside rollout)",
+			"ip", decision.ip,
+			"ip_chain", ipChain,
+			"country", decision.country,
+			"phase", decision.phase,
+			"rollout_bucket", bucket,
+			"rollout_percent", p.rolloutPercent)
+	}
+	return false
+}
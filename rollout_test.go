@@ -0,0 +1,111 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRolloutPercent(t *testing.T) {
+	percent := 30
+	cfg := &Config{
+		Enabled:              true,
+		DatabaseFilePath:     tinyDbFilePath,
+		BlockedCountries:     []string{"DE"},
+		DefaultAllow:         true,
+		DisallowedStatusCode: http.StatusForbidden,
+		IPHeaders:            []string{"x-real-ip"},
+		IPHeaderStrategy:     IPHeaderStrategyCheckAll,
+		RolloutPercent:       &percent,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	blocked := 0
+	for i := 0; i < 256; i++ {
+		ip := fmt.Sprintf("85.214.132.%d", i)
+		expected := http.StatusTeapot
+		if rolloutBucket(ip) < 30 {
+			expected = http.StatusForbidden
+			blocked++
+		}
+
+		// Same client twice: the decision must be stable
+		for attempt := 0; attempt < 2; attempt++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", ip)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if rr.Code != expected {
+				t.Fatalf("%s: expected status %d, got %d", ip, expected, rr.Code)
+			}
+		}
+	}
+
+	if blocked == 0 || blocked == 256 {
+		t.Errorf("expected a partial rollout, got %d of 256 blocked", blocked)
+	}
+}
+
+func TestRolloutPercentZero(t *testing.T) {
+	percent := 0
+	cfg := &Config{
+		Enabled:              true,
+		DatabaseFilePath:     tinyDbFilePath,
+		BlockedCountries:     []string{"DE"},
+		DefaultAllow:         true,
+		DisallowedStatusCode: http.StatusForbidden,
+		IPHeaders:            []string{"x-real-ip"},
+		IPHeaderStrategy:     IPHeaderStrategyCheckAll,
+		RolloutPercent:       &percent,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	// A rollout starting at 0% is monitor-only, nothing is blocked
+	for i := 0; i < 256; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", fmt.Sprintf("85.214.132.%d", i))
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		if rr.Code != http.StatusTeapot {
+			t.Fatalf("expected no block at 0%%, got status %d", rr.Code)
+		}
+	}
+}
+
+func TestValidateRolloutPercent(t *testing.T) {
+	percent := func(n int) *int { return &n }
+	tests := []struct {
+		in      *int
+		want    int
+		wantErr bool
+	}{
+		{in: nil, want: 100},
+		{in: percent(0), want: 0},
+		{in: percent(1), want: 1},
+		{in: percent(100), want: 100},
+		{in: percent(-1), wantErr: true},
+		{in: percent(101), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := validateRolloutPercent(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateRolloutPercent(%v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("validateRolloutPercent(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
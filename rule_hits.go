@@ -0,0 +1,47 @@
+package traefik_geoblock
+
+import "net"
+
+// RuleHitCounts lists the configured CIDR rules with the number of times each one decided a lookup.
+// Rules with zero hits after a representative period are candidates for pruning.
+type RuleHitCounts struct {
+	AllowedIPBlocks []CIDRHits `json:"allowedIPBlocks"`
+	BlockedIPBlocks []CIDRHits `json:"blockedIPBlocks"`
+}
+
+// RuleHits returns the hit counters of the allowed and blocked IP blocks (static and directory-loaded).
+// A lookup counts for the most specific block of each list it matched. Counters start at plugin creation.
+func (p Plugin) RuleHits() RuleHitCounts {
+	counts := RuleHitCounts{AllowedIPBlocks: []CIDRHits{}, BlockedIPBlocks: []CIDRHits{}}
+	if p.allowedIPBlocks != nil {
+		counts.AllowedIPBlocks = p.allowedIPBlocks.HitCounts()
+	}
+	if p.blockedIPBlocks != nil {
+		counts.BlockedIPBlocks = p.blockedIPBlocks.HitCounts()
+	}
+	return counts
+}
+
+// matchedRule returns the IP block rule that decided the request with its source, e.g.
+// "203.0.113.0/24 feeds/drop.txt:12 (SBL123)". Empty when no IP block decided it.
+func (p Plugin) matchedRule(decision ipDecision) string {
+	monitor := p.blockedIPBlocks
+	switch decision.phase {
+	case PhaseBlockedIPBlock:
+	case PhaseAllowedIPBlock:
+		monitor = p.allowedIPBlocks
+	default:
+		return ""
+	}
+	if monitor == nil {
+		return ""
+	}
+	cidr, source, ok := monitor.Match(net.ParseIP(decision.ip))
+	if !ok {
+		return ""
+	}
+	if source == nil {
+		return cidr
+	}
+	return cidr + " " + source.String()
+}
@@ -0,0 +1,93 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRuleHits(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedIPBlocks = []string{"8.8.8.0/24", "8.8.8.8/32", "203.0.113.0/24"}
+	cfg.BlockedIPBlocks = []string{"1.1.1.0/24"}
+	cfg.AdminPath = "/.geoblock"
+	cfg.AdminToken = "s3cret"
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	for _, ip := range []string{"8.8.8.8", "8.8.8.8", "8.8.8.1", "1.1.1.1", "9.9.9.9"} {
+		if _, _, _, err := plugin.CheckAllowed(ip); err != nil {
+			t.Fatalf("unexpected error for %s: %v", ip, err)
+		}
+	}
+
+	hits := plugin.RuleHits()
+	wantAllowed := []CIDRHits{{CIDR: "8.8.8.8/32", Hits: 2}, {CIDR: "8.8.8.0/24", Hits: 1}, {CIDR: "203.0.113.0/24", Hits: 0}}
+	if len(hits.AllowedIPBlocks) != len(wantAllowed) {
+		t.Fatalf("expected %v, got %v", wantAllowed, hits.AllowedIPBlocks)
+	}
+	for i, want := range wantAllowed {
+		if hits.AllowedIPBlocks[i] != want {
+			t.Errorf("expected %v, got %v", wantAllowed, hits.AllowedIPBlocks)
+		}
+	}
+	if len(hits.BlockedIPBlocks) != 1 || hits.BlockedIPBlocks[0].Hits != 1 {
+		t.Errorf("unexpected blocked hits %v", hits.BlockedIPBlocks)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/.geoblock/stats/rules", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := httptest.NewRecorder()
+	plugin.ServeHTTP(rr, req)
+
+	var served RuleHitCounts
+	if err := json.Unmarshal(rr.Body.Bytes(), &served); err != nil {
+		t.Fatalf("invalid admin response %q: %v", rr.Body.String(), err)
+	}
+	if len(served.AllowedIPBlocks) != 3 || served.AllowedIPBlocks[0].CIDR != "8.8.8.8/32" {
+		t.Errorf("unexpected admin response %v", served)
+	}
+}
+
+func TestRuleSourceHeader(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		seen = req.Header.Get("X-Geoblock-Rule")
+	})
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.AllowedIPBlocks = []string{"203.0.113.0/24", "8.8.8.0/24"}
+	cfg.RuleSourceHeader = "X-Geoblock-Rule"
+
+	handler, err := New(context.TODO(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if want := "8.8.8.0/24 static:2"; seen != want {
+		t.Errorf("expected %q, got %q", want, seen)
+	}
+
+	// Client-sent values are removed when no rule matched
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	req.Header.Set("X-Geoblock-Rule", "spoofed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "" {
+		t.Errorf("expected no rule header, got %q", seen)
+	}
+}
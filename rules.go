@@ -0,0 +1,435 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PhaseRule is used when one of the Rules decided
+const PhaseRule = "rule"
+
+// Rules are written "<condition> => <action>", e.g.
+//
+//	country in [CN, RU] and path startsWith '/admin' => block 403
+//	header.X-Partner == 'acme' or ip in [203.0.113.0/24] => allow
+//
+// Conditions compare a field with a value and combine with and, or, not and parentheses.
+// Fields: country, ip, path, host, method, phase (of the decision without rules) and header.<Name>.
+// Operators: == and != for every field, in [list] (countries may be groups like EU, IPs may be CIDRs),
+// and startsWith, endsWith, contains and matches (a regular expression) for the text fields.
+// Actions: allow, or block with an optional status code.
+
+// ruleSet is the compiled Rules, the first matching rule decides
+type ruleSet []*compiledRule
+
+// compiledRule is one rule of the Rules
+type compiledRule struct {
+	source    string
+	condition ruleCondition
+	block     bool
+	status    int // Status of blocked responses, 0 uses DisallowedStatusCode
+}
+
+// ruleInput is what conditions are evaluated against
+type ruleInput struct {
+	req      *http.Request
+	decision ipDecision
+}
+
+// ruleCondition is a node of a compiled condition
+type ruleCondition interface {
+	eval(in *ruleInput) bool
+}
+
+type ruleAnd struct{ left, right ruleCondition }
+type ruleOr struct{ left, right ruleCondition }
+type ruleNot struct{ operand ruleCondition }
+
+func (c ruleAnd) eval(in *ruleInput) bool { return c.left.eval(in) && c.right.eval(in) }
+func (c ruleOr) eval(in *ruleInput) bool  { return c.left.eval(in) || c.right.eval(in) }
+func (c ruleNot) eval(in *ruleInput) bool { return !c.operand.eval(in) }
+
+// ruleComparison compares a field with a value
+type ruleComparison struct {
+	field  string
+	header string // Header name of header.<Name> fields
+	op     string
+	value  string
+	set    map[string]struct{} // Values of in, for every field but ip
+	nets   []*net.IPNet        // Values of ip comparisons, addresses or CIDRs
+	re     *regexp.Regexp
+}
+
+// newRuleSet compiles the Rules. Returns nil when there is none.
+func newRuleSet(cfg *Config) (ruleSet, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+	rules := make(ruleSet, 0, len(cfg.Rules))
+	for i, source := range cfg.Rules {
+		rule, err := compileRule(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Rules[%d] %q: %w", i, source, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// usesCountry reports whether a rule compares the country
+func (r ruleSet) usesCountry() bool {
+	for _, rule := range r {
+		if conditionUsesField(rule.condition, "country") {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionUsesField reports whether a comparison of the condition reads the field
+func conditionUsesField(condition ruleCondition, field string) bool {
+	switch c := condition.(type) {
+	case ruleAnd:
+		return conditionUsesField(c.left, field) || conditionUsesField(c.right, field)
+	case ruleOr:
+		return conditionUsesField(c.left, field) || conditionUsesField(c.right, field)
+	case ruleNot:
+		return conditionUsesField(c.operand, field)
+	case *ruleComparison:
+		return c.field == field
+	}
+	return false
+}
+
+// match returns the first rule matching the request
+func (r ruleSet) match(req *http.Request, decision ipDecision) (*compiledRule, bool) {
+	in := &ruleInput{req: req, decision: decision}
+	for _, rule := range r {
+		if rule.condition.eval(in) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// apply returns the decision of the rule
+func (r *compiledRule) apply(decision ipDecision) ipDecision {
+	return ipDecision{blocked: r.block, ip: decision.ip, country: decision.country, phase: PhaseRule}
+}
+
+// eval compares the field of the request with the value
+func (c *ruleComparison) eval(in *ruleInput) bool {
+	if c.field == "ip" {
+		ip := net.ParseIP(in.decision.ip)
+		matched := ip != nil && containsIP(c.nets, ip)
+		return matched == (c.op != "!=")
+	}
+
+	actual := c.fieldValue(in)
+	switch c.op {
+	case "==":
+		return actual == c.value
+	case "!=":
+		return actual != c.value
+	case "in":
+		_, ok := c.set[actual]
+		return ok
+	case "startswith":
+		return strings.HasPrefix(actual, c.value)
+	case "endswith":
+		return strings.HasSuffix(actual, c.value)
+	case "contains":
+		return strings.Contains(actual, c.value)
+	case "matches":
+		return c.re.MatchString(actual)
+	}
+	return false
+}
+
+// fieldValue returns the value of a text field, normalized like the values it is compared with
+func (c *ruleComparison) fieldValue(in *ruleInput) string {
+	switch c.field {
+	case "country":
+		return in.decision.country
+	case "path":
+		return in.req.URL.Path
+	case "host":
+		return hostName(in.req.Host)
+	case "method":
+		return in.req.Method
+	case "phase":
+		return in.decision.phase
+	}
+	return in.req.Header.Get(c.header)
+}
+
+// ruleToken is a word, a quoted string or one of the symbols ( ) [ ] , == != =>
+type ruleToken struct {
+	text   string
+	quoted bool
+	pos    int
+}
+
+// tokenizeRule splits a rule into tokens. Words run until a space, a symbol or a quote,
+// so paths, CIDRs and IPv6 addresses need no quotes.
+func tokenizeRule(source string) ([]ruleToken, error) {
+	var tokens []ruleToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("()[],", c) >= 0:
+			tokens = append(tokens, ruleToken{text: string(c), pos: i})
+			i++
+		case strings.HasPrefix(source[i:], "==") || strings.HasPrefix(source[i:], "!=") || strings.HasPrefix(source[i:], "=>"):
+			tokens = append(tokens, ruleToken{text: source[i : i+2], pos: i})
+			i += 2
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, ruleToken{text: source[i+1 : i+1+end], quoted: true, pos: i})
+			i += end + 2
+		default:
+			start := i
+			for i < len(source) && strings.IndexByte(" \t()[],'\"=!", source[i]) < 0 {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected %q at position %d", source[i], i)
+			}
+			tokens = append(tokens, ruleToken{text: source[start:i], pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+// ruleParser is a recursive descent parser over the tokens of one rule
+type ruleParser struct {
+	tokens []ruleToken
+	next   int
+	end    int // Position reported for a missing token
+}
+
+// compileRule parses "<condition> => <action>"
+func compileRule(source string) (*compiledRule, error) {
+	tokens, err := tokenizeRule(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{tokens: tokens, end: len(source)}
+
+	condition, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("=>"); err != nil {
+		return nil, err
+	}
+	rule := &compiledRule{source: source, condition: condition}
+
+	action, ok := p.take()
+	switch {
+	case ok && !action.quoted && strings.EqualFold(action.text, "allow"):
+	case ok && !action.quoted && strings.EqualFold(action.text, "block"):
+		rule.block = true
+		if status, ok := p.take(); ok {
+			code, err := strconv.Atoi(status.text)
+			if err != nil || http.StatusText(code) == "" {
+				return nil, fmt.Errorf("invalid status %q at position %d", status.text, status.pos)
+			}
+			rule.status = code
+		}
+	case ok:
+		return nil, fmt.Errorf("unknown action %q at position %d, must be allow or block", action.text, action.pos)
+	default:
+		return nil, fmt.Errorf("missing action after =>")
+	}
+	if extra, ok := p.take(); ok {
+		return nil, fmt.Errorf("unexpected %q at position %d", extra.text, extra.pos)
+	}
+	return rule, nil
+}
+
+// peekWord reports whether the next token is the unquoted keyword
+func (p *ruleParser) peekWord(keyword string) bool {
+	return p.next < len(p.tokens) && !p.tokens[p.next].quoted && strings.EqualFold(p.tokens[p.next].text, keyword)
+}
+
+// take returns the next token
+func (p *ruleParser) take() (ruleToken, bool) {
+	if p.next >= len(p.tokens) {
+		return ruleToken{pos: p.end}, false
+	}
+	p.next++
+	return p.tokens[p.next-1], true
+}
+
+// expect consumes the symbol
+func (p *ruleParser) expect(symbol string) error {
+	token, ok := p.take()
+	if !ok {
+		return fmt.Errorf("expected %q at the end", symbol)
+	}
+	if token.quoted || token.text != symbol {
+		return fmt.Errorf("expected %q at position %d, got %q", symbol, token.pos, token.text)
+	}
+	return nil
+}
+
+func (p *ruleParser) parseOr() (ruleCondition, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peekWord("or") {
+		p.next++
+		var right ruleCondition
+		if right, err = p.parseAnd(); err == nil {
+			left = ruleOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) parseAnd() (ruleCondition, error) {
+	left, err := p.parseNot()
+	for err == nil && p.peekWord("and") {
+		p.next++
+		var right ruleCondition
+		if right, err = p.parseNot(); err == nil {
+			left = ruleAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *ruleParser) parseNot() (ruleCondition, error) {
+	if p.peekWord("not") {
+		p.next++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return ruleNot{operand}, nil
+	}
+	if p.next < len(p.tokens) && !p.tokens[p.next].quoted && p.tokens[p.next].text == "(" {
+		p.next++
+		condition, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return condition, p.expect(")")
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses "<field> <operator> <value>" and compiles the value for the field
+func (p *ruleParser) parseComparison() (ruleCondition, error) {
+	fieldToken, ok := p.take()
+	if !ok {
+		return nil, fmt.Errorf("expected a condition at the end")
+	}
+	c := &ruleComparison{field: strings.ToLower(fieldToken.text)}
+	switch {
+	case fieldToken.quoted:
+		return nil, fmt.Errorf("expected a field at position %d, got a string", fieldToken.pos)
+	case strings.HasPrefix(c.field, "header.") && len(c.field) > len("header."):
+		c.header, c.field = fieldToken.text[len("header."):], "header"
+	case c.field == "country", c.field == "ip", c.field == "path", c.field == "host", c.field == "method", c.field == "phase":
+	default:
+		return nil, fmt.Errorf("unknown field %q at position %d", fieldToken.text, fieldToken.pos)
+	}
+
+	opToken, ok := p.take()
+	c.op = strings.ToLower(opToken.text)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("expected an operator after %q", fieldToken.text)
+	case opToken.quoted:
+		return nil, fmt.Errorf("expected an operator at position %d, got a string", opToken.pos)
+	case c.op == "==" || c.op == "!=" || c.op == "in":
+	case c.op == "startswith" || c.op == "endswith" || c.op == "contains" || c.op == "matches":
+		if c.field == "ip" {
+			return nil, fmt.Errorf("operator %q at position %d doesn't apply to ip", opToken.text, opToken.pos)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q at position %d", opToken.text, opToken.pos)
+	}
+
+	var values []string
+	if c.op == "in" {
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		for {
+			value, ok := p.take()
+			if !ok {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			if !value.quoted && value.text == "]" && len(values) == 0 {
+				break
+			}
+			if !value.quoted && strings.IndexByte("()[],=!", value.text[0]) >= 0 {
+				return nil, fmt.Errorf("expected a value at position %d, got %q", value.pos, value.text)
+			}
+			values = append(values, value.text)
+			if sep, _ := p.take(); sep.quoted || (sep.text != "," && sep.text != "]") {
+				return nil, fmt.Errorf("expected \",\" or \"]\" at position %d", sep.pos)
+			} else if sep.text == "]" {
+				break
+			}
+		}
+	} else {
+		value, ok := p.take()
+		if !ok {
+			return nil, fmt.Errorf("expected a value after %q", opToken.text)
+		}
+		if !value.quoted && strings.IndexByte("()[],=!", value.text[0]) >= 0 {
+			return nil, fmt.Errorf("expected a value at position %d, got %q", value.pos, value.text)
+		}
+		values = []string{value.text}
+	}
+	return c, c.compile(values)
+}
+
+// compile prepares the values: countries are uppercased and groups expanded, methods uppercased,
+// hosts lowercased, IPs parsed as addresses or CIDRs and expressions compiled
+func (c *ruleComparison) compile(values []string) error {
+	for i, value := range values {
+		switch c.field {
+		case "country", "method":
+			values[i] = strings.ToUpper(value)
+		case "host":
+			values[i] = strings.ToLower(value)
+		}
+	}
+
+	switch {
+	case c.field == "ip":
+		nets, err := parseIPNetworks("ip", values)
+		if err != nil {
+			return err
+		}
+		c.nets = nets
+	case c.op == "in" && c.field == "country":
+		c.set = expandCountryGroups(values)
+	case c.op == "in":
+		c.set = make(map[string]struct{}, len(values))
+		for _, value := range values {
+			c.set[value] = struct{}{}
+		}
+	case c.op == "matches":
+		re, err := regexp.Compile(values[0])
+		if err != nil {
+			return fmt.Errorf("invalid expression %q: %w", values[0], err)
+		}
+		c.re = re
+	default:
+		c.value = values[0]
+	}
+	return nil
+}
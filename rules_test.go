@@ -0,0 +1,109 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.BlockedCountries = []string{"DE"}
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Action"
+	cfg.Rules = []string{
+		"country in [US, AU] and path startsWith '/admin' => block 451",
+		`header.X-Partner == "acme" or ip in [85.214.132.0/24] => allow`,
+		"host == API.example.com and method != get and not (phase == allowed_country) => block",
+		"path matches '^/v[0-9]+/internal' => block",
+		"country in [EU] and path endsWith .php => block 404",
+	}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		name      string
+		ip        string
+		method    string
+		host      string
+		path      string
+		partner   string
+		want      int
+		wantPhase string
+	}{
+		{"admin from US", "8.8.8.8", http.MethodGet, "example.com", "/admin/users", "", 451, PhaseRule},
+		{"admin from AU", "1.1.1.1", http.MethodGet, "example.com", "/admin", "", 451, PhaseRule},
+		{"public page from US", "8.8.8.8", http.MethodGet, "example.com", "/", "", http.StatusTeapot, ""},
+		{"blocked country lifted by IP rule", "85.214.132.7", http.MethodGet, "example.com", "/", "", http.StatusTeapot, ""},
+		{"blocked country lifted by header rule", "185.5.82.1", http.MethodGet, "example.com", "/", "acme", http.StatusTeapot, ""},
+		{"blocked country without a rule", "185.5.82.1", http.MethodGet, "example.com", "/", "other", http.StatusForbidden, PhaseBlockedCountry},
+		{"API writes", "8.8.8.8", http.MethodPost, "api.example.com:443", "/", "", http.StatusForbidden, PhaseRule},
+		{"API reads", "8.8.8.8", http.MethodGet, "api.example.com", "/", "", http.StatusTeapot, ""},
+		{"regular expression", "8.8.8.8", http.MethodGet, "example.com", "/v2/internal/x", "", http.StatusForbidden, PhaseRule},
+		{"country group", "2a00:1450::1", http.MethodGet, "example.com", "/index.php", "", http.StatusNotFound, PhaseRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.URL.Path = tt.path
+			req.Host = tt.host
+			req.Header.Set("X-Real-IP", tt.ip)
+			if tt.partner != "" {
+				req.Header.Set("X-Partner", tt.partner)
+			}
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+			if got := rr.Header().Get("X-Geoblock-Action"); got != tt.wantPhase {
+				t.Errorf("expected phase %q, got %q", tt.wantPhase, got)
+			}
+		})
+	}
+}
+
+func TestCompileRule_Errors(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr string
+	}{
+		{"country == US", `expected "=>" at the end`},
+		{"country == US =>", "missing action"},
+		{"country == US => deny", `unknown action "deny"`},
+		{"country == US => block 999", `invalid status "999"`},
+		{"asn == 13335 => block", `unknown field "asn"`},
+		{"country like US => block", `unknown operator "like"`},
+		{"ip startsWith 10. => block", "doesn't apply to ip"},
+		{"ip in [10.0.0.0/33] => block", "invalid ip entry"},
+		{"path matches '(' => block", "invalid expression"},
+		{"country in [US, => block", `expected a value at position 16, got "=>"`},
+		{"country in US => block", `expected "["`},
+		{"(country == US => block", `expected ")"`},
+		{"path == '/admin => block", "unterminated string"},
+		{"country == US => allow now", `unexpected "now"`},
+		{"country = US => block", `unexpected '='`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, err := compileRule(tt.rule)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cfg := CreateConfig()
+	cfg.Rules = []string{"country == US => block", "country == => block"}
+	if _, err := newRuleSet(cfg); err == nil || !strings.Contains(err.Error(), "Rules[1]") {
+		t.Errorf("expected the index of the invalid rule, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PhaseScore is used when the decision was made by the scoring pipeline
+const PhaseScore = "score"
+
+// scoreInput holds the signals known about an IP when it is scored
+type scoreInput struct {
+	country        string
+	allowedIPBlock bool
+	blockedIPBlock bool
+	allowedCountry bool
+	blockedCountry bool
+	dnsblListed    bool
+}
+
+// scoreSignal is one step of the scoring pipeline. It returns the weight it contributes and
+// whether it applied at all, so that only contributing signals are reported as factors.
+type scoreSignal struct {
+	name   string
+	weight func(in scoreInput) (int, bool)
+}
+
+// scoreFactor is the contribution of a single signal
+type scoreFactor struct {
+	name   string
+	weight int
+}
+
+// scoreResult is the outcome of scoring an IP
+type scoreResult struct {
+	total   int
+	blocked bool
+	factors []scoreFactor
+}
+
+// factorsString renders the contributing factors for logging, e.g. "country=60,blocked_ip_block=100"
+func (r *scoreResult) factorsString() string {
+	parts := make([]string, len(r.factors))
+	for i, f := range r.factors {
+		parts[i] = fmt.Sprintf("%s=%d", f.name, f.weight)
+	}
+	return strings.Join(parts, ",")
+}
+
+// scoringPipeline sums the weights of all signals and blocks at or above the threshold
+type scoringPipeline struct {
+	threshold int
+	signals   []scoreSignal
+}
+
+// newScoringPipeline builds the pipeline from the config. Returns nil when ScoreThreshold is 0.
+// New signals (for example ASN or proxy flags once a database carrying them is used) are added here.
+func newScoringPipeline(cfg *Config) (*scoringPipeline, error) {
+	if cfg.ScoreThreshold == 0 {
+		return nil, nil
+	}
+	if cfg.ScoreThreshold < 0 {
+		return nil, fmt.Errorf("ScoreThreshold must be positive, got %d", cfg.ScoreThreshold)
+	}
+
+	// Expand groups, explicit country entries win over group members
+	countryWeights := make(map[string]int)
+	keys := make([]string, 0, len(cfg.ScoreCountryWeights))
+	for key := range cfg.ScoreCountryWeights {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if members, isGroup := countryGroups[strings.ToUpper(key)]; isGroup {
+			for _, m := range members {
+				if _, explicit := cfg.ScoreCountryWeights[m]; !explicit {
+					countryWeights[m] = cfg.ScoreCountryWeights[key]
+				}
+			}
+			continue
+		}
+		countryWeights[key] = cfg.ScoreCountryWeights[key]
+	}
+
+	flag := func(weight int, get func(in scoreInput) bool) func(in scoreInput) (int, bool) {
+		return func(in scoreInput) (int, bool) {
+			return weight, weight != 0 && get(in)
+		}
+	}
+
+	return &scoringPipeline{
+		threshold: cfg.ScoreThreshold,
+		signals: []scoreSignal{
+			{name: "country", weight: func(in scoreInput) (int, bool) {
+				w, ok := countryWeights[in.country]
+				return w, ok && w != 0
+			}},
+			{name: "unknown_country", weight: flag(cfg.ScoreUnknownCountryWeight, func(in scoreInput) bool {
+				return isUnknownCountry(in.country) || in.country == UnknownCountryAlias
+			})},
+			{name: "allowed_country", weight: flag(cfg.ScoreAllowedCountryWeight, func(in scoreInput) bool { return in.allowedCountry })},
+			{name: "blocked_country", weight: flag(cfg.ScoreBlockedCountryWeight, func(in scoreInput) bool { return in.blockedCountry })},
+			{name: "allowed_ip_block", weight: flag(cfg.ScoreAllowedIPBlockWeight, func(in scoreInput) bool { return in.allowedIPBlock })},
+			{name: "blocked_ip_block", weight: flag(cfg.ScoreBlockedIPBlockWeight, func(in scoreInput) bool { return in.blockedIPBlock })},
+			{name: "dnsbl", weight: flag(cfg.ScoreDNSBLWeight, func(in scoreInput) bool { return in.dnsblListed })},
+		},
+	}, nil
+}
+
+// evaluate runs every signal and sums the contributing weights
+func (s *scoringPipeline) evaluate(country string, allowedIPBlock, blockedIPBlock, allowedCountry, blockedCountry bool) *scoreResult {
+	return s.evaluateInput(scoreInput{
+		country:        country,
+		allowedIPBlock: allowedIPBlock,
+		blockedIPBlock: blockedIPBlock,
+		allowedCountry: allowedCountry,
+		blockedCountry: blockedCountry,
+	})
+}
+
+// evaluateInput is evaluate with every signal, including the optional external ones
+func (s *scoringPipeline) evaluateInput(in scoreInput) *scoreResult {
+	result := &scoreResult{}
+	for _, signal := range s.signals {
+		if weight, applies := signal.weight(in); applies {
+			result.total += weight
+			result.factors = append(result.factors, scoreFactor{name: signal.name, weight: weight})
+		}
+	}
+	result.blocked = result.total >= s.threshold
+	return result
+}
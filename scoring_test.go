@@ -0,0 +1,97 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScoringMode(t *testing.T) {
+	cfg := &Config{
+		Enabled:                      true,
+		DatabaseFilePath:             tinyDbFilePath,
+		AllowedCountries:             []string{"AU"},
+		BlockedIPBlocks:              []string{"1.1.1.128/25"},
+		DisallowedStatusCode:         http.StatusForbidden,
+		IPHeaders:                    []string{"x-real-ip"},
+		IPHeaderStrategy:             IPHeaderStrategyCheckAll,
+		RemediationHeadersCustomName: "X-Geoblock-Action",
+		ScoreThreshold:               50,
+		ScoreCountryWeights:          map[string]int{"US": 60, "DE": 30, "EU": 10},
+		ScoreUnknownCountryWeight:    50,
+		ScoreAllowedCountryWeight:    -100,
+		ScoreBlockedIPBlockWeight:    1000,
+	}
+
+	plugin, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ip      string
+		blocked bool
+	}{
+		{name: "country weight above threshold", ip: "8.8.8.8", blocked: true},
+		{name: "country weight below threshold", ip: "85.214.132.117"},
+		{name: "group weight", ip: "2a00:1450::1"},
+		{name: "unknown country", ip: "9.9.9.9", blocked: true},
+		{name: "allowed country", ip: "1.1.1.1"},
+		{name: "blocked ip block outweighs allowed country", ip: "1.1.1.200", blocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+
+			if tt.blocked {
+				if rr.Code != http.StatusForbidden {
+					t.Fatalf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+				}
+				if got := rr.Header().Get("X-Geoblock-Action"); got != PhaseScore {
+					t.Errorf("expected remediation header %q, got %q", PhaseScore, got)
+				}
+				return
+			}
+			if rr.Code != http.StatusTeapot {
+				t.Errorf("expected request to be allowed, got status %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestScoringPipelineEvaluate(t *testing.T) {
+	pipeline, err := newScoringPipeline(&Config{
+		ScoreThreshold:            100,
+		ScoreCountryWeights:       map[string]int{"eu": 20, "FR": 70},
+		ScoreBlockedCountryWeight: 40,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	result := pipeline.evaluate("FR", false, false, false, true)
+	if result.total != 110 || !result.blocked {
+		t.Errorf("expected blocked score 110, got %d (blocked=%v)", result.total, result.blocked)
+	}
+	if got := result.factorsString(); got != "country=70,blocked_country=40" {
+		t.Errorf("unexpected factors %q", got)
+	}
+
+	result = pipeline.evaluate("DE", false, false, false, false)
+	if result.total != 20 || result.blocked {
+		t.Errorf("expected allowed score 20, got %d (blocked=%v)", result.total, result.blocked)
+	}
+
+	if p, err := newScoringPipeline(&Config{}); p != nil || err != nil {
+		t.Errorf("expected scoring to be disabled without a threshold, got %v, %v", p, err)
+	}
+	if _, err := newScoringPipeline(&Config{ScoreThreshold: -1}); err == nil {
+		t.Error("expected error for a negative threshold")
+	}
+}
@@ -0,0 +1,209 @@
+package traefik_geoblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseSearchEngine is used when a country block was lifted because the IP is in a published crawler range
+const PhaseSearchEngine = "search_engine"
+
+// Range files published by the search engines, in the {"prefixes": [{"ipv4Prefix": ...}]} format
+const (
+	GooglebotRangesURL = "https://developers.google.com/static/search/apis/ipranges/googlebot.json"
+	BingbotRangesURL   = "https://www.bing.com/toolbox/bingbot.json"
+)
+
+// defaultSearchEngineFeeds are used when SearchEngineFeedURLs is empty
+var defaultSearchEngineFeeds = []string{GooglebotRangesURL, BingbotRangesURL}
+
+// crawlerRanges matches IPs against the crawler ranges of the feeds. Unlike verifiedBots it needs
+// neither the User-Agent nor DNS lookups, the ranges are downloaded in the background.
+type crawlerRanges struct {
+	mu     sync.RWMutex
+	ranges *IpLookupHelper // Empty until the first refresh succeeds
+
+	feeds   []string
+	refresh time.Duration
+	client  *http.Client
+	logger  *slog.Logger
+
+	key      string        // Entry in crawlerRangeLists
+	refCount int           // Plugin instances using the list, guarded by crawlerRangeListsMutex
+	stop     chan struct{} // Closed by releaseCrawlerRanges when the last instance is closed
+}
+
+var (
+	// crawlerRangeLists shares one list (and one refresher) per configuration between plugin instances
+	crawlerRangeLists      = make(map[string]*crawlerRanges)
+	crawlerRangeListsMutex sync.Mutex
+)
+
+// newCrawlerRanges starts refreshing the crawler ranges. Returns nil when AllowSearchEngines is disabled.
+func newCrawlerRanges(cfg *Config, logger *slog.Logger) (*crawlerRanges, error) {
+	if !cfg.AllowSearchEngines {
+		return nil, nil
+	}
+	feeds := cfg.SearchEngineFeedURLs
+	if len(feeds) == 0 {
+		feeds = defaultSearchEngineFeeds
+	}
+	for _, feed := range feeds {
+		if !strings.HasPrefix(feed, "http://") && !strings.HasPrefix(feed, "https://") {
+			return nil, fmt.Errorf("invalid SearchEngineFeedURLs entry %q, must be an http(s) URL", feed)
+		}
+	}
+	if cfg.SearchEngineRefreshSeconds <= 0 {
+		return nil, fmt.Errorf("SearchEngineRefreshSeconds must be positive, got %d", cfg.SearchEngineRefreshSeconds)
+	}
+	refresh := time.Duration(cfg.SearchEngineRefreshSeconds) * time.Second
+
+	key := strings.Join(feeds, ",") + "|" + refresh.String()
+	crawlerRangeListsMutex.Lock()
+	defer crawlerRangeListsMutex.Unlock()
+	if existing, ok := crawlerRangeLists[key]; ok {
+		existing.refCount++
+		return existing, nil
+	}
+
+	list := &crawlerRanges{
+		ranges:   NewEmptyIpLookupHelper(),
+		feeds:    feeds,
+		refresh:  refresh,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		logger:   logger,
+		key:      key,
+		refCount: 1,
+		stop:     make(chan struct{}),
+	}
+	go list.refreshLoop()
+
+	crawlerRangeLists[key] = list
+	return list, nil
+}
+
+// releaseCrawlerRanges drops one reference to the list and stops its refresher once no plugin instance uses it
+func releaseCrawlerRanges(list *crawlerRanges) {
+	crawlerRangeListsMutex.Lock()
+	defer crawlerRangeListsMutex.Unlock()
+
+	list.refCount--
+	if list.refCount > 0 {
+		return
+	}
+	if registered, exists := crawlerRangeLists[list.key]; exists && registered == list {
+		delete(crawlerRangeLists, list.key)
+	}
+	close(list.stop)
+}
+
+// contains reports whether the IP is in one of the crawler ranges
+func (s *crawlerRanges) contains(ip net.IP) bool {
+	s.mu.RLock()
+	ranges := s.ranges
+	s.mu.RUnlock()
+
+	found, _, _ := ranges.IsContained(ip)
+	return found
+}
+
+// exempts reports whether a country block of a crawler IP must be lifted. Other blocks still apply.
+func (s *crawlerRanges) exempts(decision ipDecision) bool {
+	if !decision.blocked || !isCountryBlockPhase(decision.phase) {
+		return false
+	}
+	ip := net.ParseIP(decision.ip)
+	return ip != nil && s.contains(ip)
+}
+
+// refreshLoop downloads the feeds now and then periodically until stopped, keeping the previous ranges on failure
+func (s *crawlerRanges) refreshLoop() {
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := s.refreshFeeds(); err != nil {
+			s.logger.Warn("search engine range refresh failed, keeping previous ranges", "error", err)
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshFeeds downloads every feed and swaps the ranges in once all of them succeeded
+func (s *crawlerRanges) refreshFeeds() error {
+	ranges := NewEmptyIpLookupHelper()
+	count := 0
+	for _, url := range s.feeds {
+		blocks, err := s.fetchFeed(url)
+		if err != nil {
+			return err
+		}
+		for _, cidr := range blocks {
+			if err := ranges.AddCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid range in search engine feed %s: %w", url, err)
+			}
+		}
+		count += len(blocks)
+	}
+
+	s.mu.Lock()
+	s.ranges = ranges
+	s.mu.Unlock()
+	s.logger.Debug("search engine ranges refreshed", "feeds", len(s.feeds), "ranges", count)
+	return nil
+}
+
+// fetchFeed downloads a range file
+func (s *crawlerRanges) fetchFeed(url string) ([]string, error) {
+	resp, err := s.client.Get(url) // #nosec G107
+	if err != nil {
+		return nil, fmt.Errorf("failed to download search engine feed %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download search engine feed %s: status %d", url, resp.StatusCode)
+	}
+	return parseSearchEngineFeed(resp.Body, url)
+}
+
+// parseSearchEngineFeed reads the prefixes of a range file, rejecting the whole file on the first invalid
+// prefix. A file without prefixes is rejected too, it would silently remove the exemption.
+func parseSearchEngineFeed(r io.Reader, source string) ([]string, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, 10<<20)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid search engine feed %s: %w", source, err)
+	}
+
+	var blocks []string
+	for _, prefix := range feed.Prefixes {
+		for _, cidr := range []string{prefix.IPv4Prefix, prefix.IPv6Prefix} {
+			if cidr == "" {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return nil, fmt.Errorf("invalid prefix in search engine feed %s: %q", source, cidr)
+			}
+			blocks = append(blocks, cidr)
+		}
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("search engine feed %s has no prefixes", source)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,104 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAllowSearchEngines(t *testing.T) {
+	var broken atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if broken.Load() {
+			rw.Write([]byte(`{"prefixes": [{"ipv4Prefix": "8.8.4.0/33"}]}`))
+			return
+		}
+		rw.Write([]byte(`{"creationTime": "2026-10-01T00:00:00", "prefixes": [
+			{"ipv4Prefix": "8.8.4.0/27"},
+			{"ipv6Prefix": "2001:4860:4801:10::/64"}
+		]}`))
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.BlockedCountries = []string{"US"}
+	cfg.BlockedIPBlocks = []string{"8.8.4.8/32"}
+	cfg.AllowSearchEngines = true
+	cfg.SearchEngineFeedURLs = []string{server.URL + "/googlebot.json"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	waitFor(t, "crawler ranges", func() bool { return plugin.searchEngines.contains(net.ParseIP("8.8.4.1")) })
+
+	tests := []struct {
+		name string
+		ip   string
+		want int
+	}{
+		{"crawler range", "8.8.4.4", http.StatusTeapot},
+		{"crawler IPv6 range", "2001:4860:4801:10::1", http.StatusTeapot},
+		{"outside the ranges", "8.8.4.200", http.StatusForbidden},
+		{"blocked IP block still applies", "8.8.4.8", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	// A broken feed keeps the previous ranges
+	broken.Store(true)
+	if err := plugin.searchEngines.refreshFeeds(); err == nil {
+		t.Fatal("expected an error for an invalid prefix")
+	}
+	if !plugin.searchEngines.contains(net.ParseIP("8.8.4.4")) {
+		t.Error("expected the previous ranges to be kept")
+	}
+}
+
+func TestParseSearchEngineFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		want    int
+		wantErr string
+	}{
+		{"both families", `{"prefixes": [{"ipv4Prefix": "66.249.64.0/27"}, {"ipv6Prefix": "2001:4860:4801:10::/64"}]}`, 2, ""},
+		{"invalid prefix", `{"prefixes": [{"ipv4Prefix": "66.249.64.0"}]}`, 0, "invalid prefix"},
+		{"no prefixes", `{"prefixes": []}`, 0, "no prefixes"},
+		{"not JSON", `66.249.64.0/27`, 0, "invalid search engine feed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseSearchEngineFeed(strings.NewReader(tt.feed), "test")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(blocks) != tt.want {
+				t.Errorf("expected %d prefixes, got %d", tt.want, len(blocks))
+			}
+		})
+	}
+}
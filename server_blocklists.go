@@ -0,0 +1,104 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Formats of the files in the IP block directories, detected per file from the first rule line
+const (
+	blockFileFormatPlain  = "plain"  // One CIDR per line
+	blockFileFormatNginx  = "nginx"  // "deny 1.2.3.0/24;" and "allow 1.2.3.4;" directives
+	blockFileFormatApache = "apache" // "Require not ip 1.2.3.0/24" and "Require ip ..." (also 2.2's "Deny from" and "Allow from")
+)
+
+// detectBlockFileFormat tells the format of a file from its first line that isn't empty or a comment
+func detectBlockFileFormat(line string) string {
+	lower := strings.ToLower(line)
+	switch {
+	case (strings.HasPrefix(lower, "deny ") || strings.HasPrefix(lower, "allow ")) && strings.Contains(lower, ";"):
+		return blockFileFormatNginx
+	case strings.HasPrefix(lower, "require "), strings.HasPrefix(lower, "<require"),
+		strings.HasPrefix(lower, "deny from "), strings.HasPrefix(lower, "allow from "), strings.HasPrefix(lower, "order "):
+		return blockFileFormatApache
+	}
+	return blockFileFormatPlain
+}
+
+// serverDirectiveAddresses returns the addresses a line of an nginx or Apache file contributes to the list,
+// and the comment after '#'. Blocked lists take the deny directives, allowed lists the allow ones; other
+// directives (such as "deny all;" or "<RequireAll>") contribute nothing.
+func serverDirectiveAddresses(format string, line string, allowList bool) ([]string, string) {
+	var comment string
+	if i := strings.Index(line, "#"); i >= 0 {
+		line, comment = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	var addresses []string
+	switch format {
+	case blockFileFormatNginx:
+		for _, statement := range strings.Split(line, ";") {
+			fields := strings.Fields(statement)
+			if len(fields) != 2 || strings.EqualFold(fields[1], "all") {
+				continue
+			}
+			verb := strings.ToLower(fields[0])
+			if (verb == "deny" && !allowList) || (verb == "allow" && allowList) {
+				addresses = append(addresses, fields[1])
+			}
+		}
+	case blockFileFormatApache:
+		fields := strings.Fields(line)
+		lower := strings.Fields(strings.ToLower(line))
+		switch {
+		case len(lower) > 3 && lower[0] == "require" && lower[1] == "not" && lower[2] == "ip" && !allowList:
+			addresses = fields[3:]
+		case len(lower) > 2 && lower[0] == "require" && lower[1] == "ip" && allowList:
+			addresses = fields[2:]
+		case len(lower) > 2 && lower[0] == "deny" && lower[1] == "from" && !allowList,
+			len(lower) > 2 && lower[0] == "allow" && lower[1] == "from" && allowList:
+			for _, address := range fields[2:] {
+				if !strings.EqualFold(address, "all") {
+					addresses = append(addresses, address)
+				}
+			}
+		}
+	}
+	return addresses, comment
+}
+
+// parseServerAddress parses an address as nginx and Apache write them: a CIDR, a single IP, or for
+// Apache a partial IPv4 address such as "10.1" for 10.1.0.0/16
+func parseServerAddress(address string) (*net.IPNet, error) {
+	if block, err := parseHostOrCIDR(address); err == nil || strings.Contains(address, "/") {
+		return block, err
+	}
+
+	octets := strings.Split(strings.TrimSuffix(address, "."), ".")
+	if prefixLength := 8 * len(octets); prefixLength < 32 {
+		for len(octets) < 4 {
+			octets = append(octets, "0")
+		}
+		if ip := net.ParseIP(strings.Join(octets, ".")).To4(); ip != nil {
+			return &net.IPNet{IP: ip, Mask: net.CIDRMask(prefixLength, 32)}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid IP address %q", address)
+}
+
+// parseHostOrCIDR parses a CIDR, or a single IP as a host block
+func parseHostOrCIDR(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		_, block, err := net.ParseCIDR(address)
+		return block, err
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", address)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
@@ -0,0 +1,92 @@
+package traefik_geoblock
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	socketLogDialTimeout  = time.Second
+	socketLogWriteTimeout = time.Second
+	socketLogRetryDelay   = 2 * time.Second // Minimum delay between reconnect attempts
+)
+
+// socketLogWriter streams log lines to a unix socket, e.g. a local vector or fluent-bit source.
+// The connection is re-established when the collector restarts. Lines written while the collector is
+// unreachable are dropped, logging never blocks or fails a request.
+type socketLogWriter struct {
+	mu          sync.Mutex
+	network     string // "unix" (stream) or "unixgram" (datagram)
+	address     string
+	conn        net.Conn
+	lastAttempt time.Time
+}
+
+// parseSocketLogPath returns the network and socket path for unix:// and unixgram:// log paths
+func parseSocketLogPath(path string) (network, address string, ok bool) {
+	if address, found := strings.CutPrefix(path, "unix://"); found {
+		return "unix", address, true
+	}
+	if address, found := strings.CutPrefix(path, "unixgram://"); found {
+		return "unixgram", address, true
+	}
+	return "", "", false
+}
+
+// newSocketLogWriter creates the writer and attempts a first connection. A collector that is not up
+// yet is not an error, the writer keeps retrying on later writes.
+func newSocketLogWriter(network, address string) *socketLogWriter {
+	w := &socketLogWriter{network: network, address: address}
+	w.mu.Lock()
+	_ = w.connectLocked()
+	w.mu.Unlock()
+	return w
+}
+
+func (w *socketLogWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// One reconnect attempt per write when the connection broke, throttled when the collector is down
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if time.Since(w.lastAttempt) < socketLogRetryDelay || w.connectLocked() != nil {
+				break
+			}
+		}
+
+		_ = w.conn.SetWriteDeadline(time.Now().Add(socketLogWriteTimeout))
+		if _, err := w.conn.Write(p); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	return len(p), nil // Dropped
+}
+
+// connectLocked dials the socket. Callers must hold the lock.
+func (w *socketLogWriter) connectLocked() error {
+	w.lastAttempt = time.Now()
+	conn, err := net.DialTimeout(w.network, w.address, socketLogDialTimeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *socketLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,95 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSocketLogWriterReconnects(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gbsock") // Short path, unix socket paths are limited to ~100 bytes
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "log.sock")
+
+	// Collector not running yet: writes are dropped without error
+	logger := createLogger("test", "info", "text", "unix://"+socketPath, 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	logger.Info("lost")
+
+	accepted := make(chan net.Conn, 10)
+	listen := func() (net.Listener, chan string) {
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		lines := make(chan string, 10)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- conn
+				go func() {
+					scanner := bufio.NewScanner(conn)
+					for scanner.Scan() {
+						lines <- scanner.Text()
+					}
+				}()
+			}
+		}()
+		return listener, lines
+	}
+
+	expectLine := func(lines chan string) {
+		t.Helper()
+		select {
+		case line := <-lines:
+			if line == "" {
+				t.Error("expected a log line")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for log line")
+		}
+	}
+
+	writer := newSocketLogWriter("unix", socketPath)
+	listener, lines := listen()
+	writer.lastAttempt = time.Time{} // Skip the reconnect throttle
+	if _, err := writer.Write([]byte("first\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	expectLine(lines)
+
+	// Collector restarts, the writer only notices on the next write
+	listener.Close()
+	(<-accepted).Close()
+	os.Remove(socketPath)
+	listener, lines = listen()
+	defer listener.Close()
+
+	writer.lastAttempt = time.Time{}
+	if _, err := writer.Write([]byte("second\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	expectLine(lines)
+}
+
+func TestParseSocketLogPath(t *testing.T) {
+	if network, address, ok := parseSocketLogPath("unix:///var/run/geoblock.sock"); !ok || network != "unix" || address != "/var/run/geoblock.sock" {
+		t.Errorf("unexpected result %q %q %v", network, address, ok)
+	}
+	if network, _, ok := parseSocketLogPath("unixgram:///dev/log"); !ok || network != "unixgram" {
+		t.Errorf("unexpected result %q %v", network, ok)
+	}
+	if _, _, ok := parseSocketLogPath("/var/log/geoblock.log"); ok {
+		t.Error("expected plain paths not to be sockets")
+	}
+}
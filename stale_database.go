@@ -0,0 +1,63 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// staleDatabaseWarnInterval is the minimum time between two "database is stale" warnings
+const staleDatabaseWarnInterval = time.Hour
+
+// staleDatabase makes an outdated database visible: failed auto-updates otherwise go unnoticed
+// while the plugin keeps answering from old data
+type staleDatabase struct {
+	db          *DatabaseWrapper
+	threshold   time.Duration
+	header      string
+	onAllowed   bool
+	lastWarning *int64 // Unix nanoseconds of the last warning
+}
+
+// newStaleDatabase validates the stale database settings. Returns nil when DatabaseStaleDays is 0
+// or the database is injected, which has no version.
+func newStaleDatabase(cfg *Config, db *DatabaseWrapper) (*staleDatabase, error) {
+	if cfg.DatabaseStaleDays < 0 {
+		return nil, fmt.Errorf("DatabaseStaleDays must not be negative, got %d", cfg.DatabaseStaleDays)
+	}
+	if cfg.DatabaseStaleDays == 0 || db == nil {
+		return nil, nil
+	}
+	return &staleDatabase{
+		db:          db,
+		threshold:   time.Duration(cfg.DatabaseStaleDays) * 24 * time.Hour,
+		header:      cfg.DatabaseStaleHeader,
+		onAllowed:   cfg.DatabaseStaleOnAllowed,
+		lastWarning: new(int64),
+	}, nil
+}
+
+// check returns the age of the database in days, e.g. "47d", or "" while it is recent.
+// The version is read on every call, a hot swap ends the staleness at once.
+func (s *staleDatabase) check(now time.Time, logger *slog.Logger) string {
+	version := s.db.GetVersion()
+	if version == nil {
+		return ""
+	}
+	age := now.Sub(version.Date())
+	if age <= s.threshold {
+		return ""
+	}
+
+	days := fmt.Sprintf("%dd", int(age.Hours()/24))
+	last := atomic.LoadInt64(s.lastWarning)
+	if now.UnixNano()-last >= int64(staleDatabaseWarnInterval) && atomic.CompareAndSwapInt64(s.lastWarning, last, now.UnixNano()) {
+		logger.Error("database is stale, check the database updates",
+			"version", version.String(),
+			"age", days,
+			"stale_days", int(s.threshold.Hours()/24),
+			"path", s.db.GetPath())
+	}
+	return days
+}
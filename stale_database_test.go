@@ -0,0 +1,108 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleDatabase(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	// The tiny database is from 2025-04-01
+	tests := []struct {
+		name       string
+		staleDays  int
+		onAllowed  bool
+		wantStale  bool
+		wantHeader map[string]bool // By IP
+	}{
+		{"recent enough", 100000, true, false, map[string]bool{"8.8.8.8": false, "1.1.1.1": false}},
+		{"stale, ban pages only", 30, false, true, map[string]bool{"8.8.8.8": true, "1.1.1.1": false}},
+		{"stale, allowed responses too", 30, true, true, map[string]bool{"8.8.8.8": true, "1.1.1.1": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.AllowedCountries = []string{"AU"}
+			cfg.DatabaseStaleDays = tt.staleDays
+			cfg.DatabaseStaleOnAllowed = tt.onAllowed
+
+			plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+			defer plugin.Close()
+			logs := &syncBuffer{}
+			plugin.logger = slog.New(slog.NewTextHandler(logs, nil))
+
+			for _, ip := range []string{"8.8.8.8", "1.1.1.1", "8.8.8.8"} {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-Real-IP", ip)
+				rr := httptest.NewRecorder()
+				plugin.ServeHTTP(rr, req)
+
+				value := rr.Header().Get("X-Geoblock-DB-Stale")
+				if tt.wantHeader[ip] != (value != "") {
+					t.Errorf("%s: unexpected stale header %q", ip, value)
+				}
+				if value != "" && (!strings.HasSuffix(value, "d") || value == "0d") {
+					t.Errorf("%s: expected an age in days, got %q", ip, value)
+				}
+			}
+
+			content := logs.String()
+			if got := strings.Count(content, "database is stale"); got != map[bool]int{true: 1, false: 0}[tt.wantStale] {
+				t.Errorf("expected one stale warning when stale, got %d in %s", got, content)
+			}
+			blockedLevel := "level=INFO msg=\"blocked request\""
+			if tt.wantStale {
+				blockedLevel = "level=WARN msg=\"blocked request\""
+			}
+			if !strings.Contains(content, blockedLevel) {
+				t.Errorf("expected %s in %s", blockedLevel, content)
+			}
+		})
+	}
+}
+
+func TestStaleDatabase_NegativeDays(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.DatabaseStaleDays = -1
+	if _, err := newStaleDatabase(cfg, &DatabaseWrapper{}); err == nil {
+		t.Fatal("expected an error for negative DatabaseStaleDays")
+	}
+}
+
+func TestStaleDatabase_WarnsOncePerInterval(t *testing.T) {
+	logs := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	stale := &staleDatabase{
+		db:          newDatabaseWrapper(nil, "db.bin", &DBVersion{Year: 25, Month: 4, Day: 1}),
+		threshold:   24 * time.Hour,
+		lastWarning: new(int64),
+	}
+
+	now := time.Date(2025, 4, 11, 12, 0, 0, 0, time.UTC)
+	if age := stale.check(now, logger); age != "10d" {
+		t.Errorf("expected age 10d, got %q", age)
+	}
+	stale.check(now.Add(time.Minute), logger)
+	if got := strings.Count(logs.String(), "database is stale"); got != 1 {
+		t.Errorf("expected one warning within the interval, got %d", got)
+	}
+	stale.check(now.Add(staleDatabaseWarnInterval), logger)
+	if got := strings.Count(logs.String(), "database is stale"); got != 2 {
+		t.Errorf("expected a second warning after the interval, got %d", got)
+	}
+	if age := stale.check(time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC), logger); age != "" {
+		t.Errorf("expected a recent database not to be stale, got %q", age)
+	}
+}
@@ -0,0 +1,367 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of StatsPushFormat
+const (
+	StatsPushFormatInflux   = "influx"   // InfluxDB line protocol
+	StatsPushFormatGraphite = "graphite" // Graphite plaintext protocol
+)
+
+const (
+	// statsPushTimeout bounds one push, dial included
+	statsPushTimeout = 10 * time.Second
+	// statsPushDatagramSize keeps UDP datagrams below a typical MTU, lines are never split
+	statsPushDatagramSize = 1400
+)
+
+// statsPusher pushes cumulative request and error counters to InfluxDB or Graphite, for setups without
+// Prometheus. Counters only grow, so a lost push is caught up by the next one.
+type statsPusher struct {
+	mu         sync.Mutex
+	countries  map[string]CountryCount // Cumulative counters by country
+	errorsBase ErrorCounts             // Counters of the plugin instances replaced by a configuration reload
+	errors     *errorPolicies          // Counters of the current plugin instance
+
+	network  string // "udp", "tcp" or "http" (http and https URLs)
+	address  string
+	format   string
+	prefix   string
+	host     string
+	plugin   string
+	headers  map[string]string
+	interval time.Duration
+	client   *http.Client
+	logger   *slog.Logger
+
+	key      string        // Entry in statsPushers
+	refCount int           // Plugin instances using the pusher, guarded by statsPushersMutex
+	stop     chan struct{} // Closed by releaseStatsPusher when the last instance is closed
+}
+
+var (
+	// statsPushers shares one pusher per plugin and target, so counters survive configuration reloads
+	statsPushers      = make(map[string]*statsPusher)
+	statsPushersMutex sync.Mutex
+)
+
+// newStatsPusher starts pushing the counters. Returns nil when no StatsPushAddress is configured.
+func newStatsPusher(cfg *Config, name string, errors *errorPolicies, logger *slog.Logger) (*statsPusher, error) {
+	if cfg.StatsPushAddress == "" {
+		return nil, nil
+	}
+	format := strings.ToLower(cfg.StatsPushFormat)
+	if format != StatsPushFormatInflux && format != StatsPushFormatGraphite {
+		return nil, fmt.Errorf("invalid StatsPushFormat %q, must be one of: %s, %s",
+			cfg.StatsPushFormat, StatsPushFormatInflux, StatsPushFormatGraphite)
+	}
+	if cfg.StatsPushSeconds <= 0 {
+		return nil, fmt.Errorf("StatsPushSeconds must be positive, got %d", cfg.StatsPushSeconds)
+	}
+	if cfg.StatsPushPrefix == "" {
+		return nil, fmt.Errorf("StatsPushPrefix cannot be empty")
+	}
+
+	network, address, err := parseStatsPushAddress(cfg.StatsPushAddress)
+	if err != nil {
+		return nil, err
+	}
+	if network == "http" && format != StatsPushFormatInflux {
+		return nil, fmt.Errorf("StatsPushAddress %q: http(s) pushes require StatsPushFormat %s", cfg.StatsPushAddress, StatsPushFormatInflux)
+	}
+	interval := time.Duration(cfg.StatsPushSeconds) * time.Second
+
+	headerNames := make([]string, 0, len(cfg.StatsPushHeaders))
+	for header := range cfg.StatsPushHeaders {
+		headerNames = append(headerNames, header+"="+cfg.StatsPushHeaders[header])
+	}
+	sort.Strings(headerNames)
+	key := name + "|" + cfg.StatsPushAddress + "|" + format + "|" + cfg.StatsPushPrefix + "|" + strings.Join(headerNames, ",") + "|" + interval.String()
+
+	statsPushersMutex.Lock()
+	defer statsPushersMutex.Unlock()
+	if existing, ok := statsPushers[key]; ok {
+		existing.replaceErrors(errors)
+		existing.refCount++
+		return existing, nil
+	}
+
+	host, _ := os.Hostname()
+	pusher := &statsPusher{
+		countries: make(map[string]CountryCount),
+		errors:    errors,
+		network:   network,
+		address:   address,
+		format:    format,
+		prefix:    cfg.StatsPushPrefix,
+		host:      host,
+		plugin:    name,
+		headers:   cfg.StatsPushHeaders,
+		interval:  interval,
+		client:    &http.Client{Timeout: statsPushTimeout},
+		logger:    logger,
+		key:       key,
+		refCount:  1,
+		stop:      make(chan struct{}),
+	}
+	go pusher.loop()
+
+	statsPushers[key] = pusher
+	return pusher, nil
+}
+
+// releaseStatsPusher drops one reference to the pusher and stops it once no plugin instance uses it
+func releaseStatsPusher(pusher *statsPusher) {
+	statsPushersMutex.Lock()
+	defer statsPushersMutex.Unlock()
+
+	pusher.refCount--
+	if pusher.refCount > 0 {
+		return
+	}
+	if registered, exists := statsPushers[pusher.key]; exists && registered == pusher {
+		delete(statsPushers, pusher.key)
+	}
+	close(pusher.stop)
+}
+
+// parseStatsPushAddress returns the network and address of udp://, tcp:// and http(s):// targets
+func parseStatsPushAddress(target string) (network, address string, err error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		req, err := http.NewRequest(http.MethodPost, target, nil)
+		if err != nil || req.URL.Host == "" {
+			return "", "", fmt.Errorf("invalid StatsPushAddress %q", target)
+		}
+		return "http", target, nil
+	}
+	for _, network := range []string{"udp", "tcp"} {
+		if address, found := strings.CutPrefix(target, network+"://"); found {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return "", "", fmt.Errorf("invalid StatsPushAddress %q: %w", target, err)
+			}
+			return network, address, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid StatsPushAddress %q, must start with udp://, tcp://, http:// or https://", target)
+}
+
+// replaceErrors switches to the error counters of a new plugin instance, keeping the totals growing
+func (s *statsPusher) replaceErrors(errors *errorPolicies) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.errors != nil && s.errors != errors {
+		previous := s.errors.counts()
+		s.errorsBase.ParseErrors += previous.ParseErrors
+		s.errorsBase.LookupErrors += previous.LookupErrors
+		s.errorsBase.EmptyHeaders += previous.EmptyHeaders
+		s.errorsBase.SkippedTokens += previous.SkippedTokens
+	}
+	s.errors = errors
+}
+
+// record counts a request for the country
+func (s *statsPusher) record(country string, blocked bool) {
+	if country == "" {
+		country = "unknown"
+	}
+	s.mu.Lock()
+	count := s.countries[country]
+	count.Requests++
+	if blocked {
+		count.Blocked++
+	}
+	s.countries[country] = count
+	s.mu.Unlock()
+}
+
+// snapshot returns a copy of the counters
+func (s *statsPusher) snapshot() (map[string]CountryCount, ErrorCounts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	countries := make(map[string]CountryCount, len(s.countries))
+	for country, count := range s.countries {
+		countries[country] = count
+	}
+	errors := s.errorsBase
+	if s.errors != nil {
+		current := s.errors.counts()
+		errors.ParseErrors += current.ParseErrors
+		errors.LookupErrors += current.LookupErrors
+		errors.EmptyHeaders += current.EmptyHeaders
+		errors.SkippedTokens += current.SkippedTokens
+	}
+	return countries, errors
+}
+
+// loop pushes the counters on every interval until stopped, failures are logged and retried on the next one
+func (s *statsPusher) loop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.push(time.Now()); err != nil {
+				s.logger.Warn("failed to push statistics", "address", s.address, "format", s.format, "error", err)
+			}
+		}
+	}
+}
+
+// push encodes the counters and sends them
+func (s *statsPusher) push(now time.Time) error {
+	countries, errors := s.snapshot()
+	var lines []string
+	if s.format == StatsPushFormatInflux {
+		lines = s.influxLines(countries, errors, now)
+	} else {
+		lines = s.graphiteLines(countries, errors, now)
+	}
+
+	switch s.network {
+	case "http":
+		return s.pushHTTP(lines)
+	case "udp":
+		return s.pushDatagrams(lines)
+	default:
+		return s.pushStream(lines)
+	}
+}
+
+// influxLines encodes the counters as InfluxDB line protocol, one point per country
+func (s *statsPusher) influxLines(countries map[string]CountryCount, errors ErrorCounts, now time.Time) []string {
+	tags := ",host=" + influxEscape(s.host) + ",plugin=" + influxEscape(s.plugin)
+	measurement := influxEscape(s.prefix)
+	timestamp := now.UnixNano()
+
+	lines := make([]string, 0, len(countries)+1)
+	for _, country := range sortedCountries(countries) {
+		count := countries[country]
+		lines = append(lines, fmt.Sprintf("%s_requests%s,country=%s allowed=%di,blocked=%di %d",
+			measurement, tags, influxEscape(country), count.Requests-count.Blocked, count.Blocked, timestamp))
+	}
+	lines = append(lines, fmt.Sprintf("%s_errors%s parse=%di,lookup=%di,empty_headers=%di,skipped_tokens=%di %d",
+		measurement, tags, errors.ParseErrors, errors.LookupErrors, errors.EmptyHeaders, errors.SkippedTokens, timestamp))
+	return lines
+}
+
+// graphiteLines encodes the counters as Graphite plaintext, below <prefix>.<host>.<plugin>
+func (s *statsPusher) graphiteLines(countries map[string]CountryCount, errors ErrorCounts, now time.Time) []string {
+	path := s.prefix + "." + graphiteEscape(s.host) + "." + graphiteEscape(s.plugin)
+	timestamp := now.Unix()
+
+	lines := make([]string, 0, 2*len(countries)+4)
+	for _, country := range sortedCountries(countries) {
+		count := countries[country]
+		metric := path + ".requests." + graphiteEscape(country)
+		lines = append(lines,
+			fmt.Sprintf("%s.allowed %d %d", metric, count.Requests-count.Blocked, timestamp),
+			fmt.Sprintf("%s.blocked %d %d", metric, count.Blocked, timestamp))
+	}
+	lines = append(lines,
+		fmt.Sprintf("%s.errors.parse %d %d", path, errors.ParseErrors, timestamp),
+		fmt.Sprintf("%s.errors.lookup %d %d", path, errors.LookupErrors, timestamp),
+		fmt.Sprintf("%s.errors.empty_headers %d %d", path, errors.EmptyHeaders, timestamp),
+		fmt.Sprintf("%s.errors.skipped_tokens %d %d", path, errors.SkippedTokens, timestamp))
+	return lines
+}
+
+// pushHTTP posts the lines to an InfluxDB write endpoint
+func (s *statsPusher) pushHTTP(lines []string) error {
+	req, err := http.NewRequest(http.MethodPost, s.address, strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pushStream writes all lines over one TCP connection
+func (s *statsPusher) pushStream(lines []string) error {
+	conn, err := net.DialTimeout("tcp", s.address, statsPushTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(time.Now().Add(statsPushTimeout))
+	_, err = conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	return err
+}
+
+// pushDatagrams packs whole lines into datagrams that fit statsPushDatagramSize
+func (s *statsPusher) pushDatagrams(lines []string) error {
+	conn, err := net.DialTimeout("udp", s.address, statsPushTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var datagram bytes.Buffer
+	send := func() error {
+		if datagram.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(datagram.Bytes())
+		datagram.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if datagram.Len() > 0 && datagram.Len()+len(line)+1 > statsPushDatagramSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		datagram.WriteString(line)
+		datagram.WriteByte('\n')
+	}
+	return send()
+}
+
+// sortedCountries returns the country codes in a stable order
+func sortedCountries(countries map[string]CountryCount) []string {
+	codes := make([]string, 0, len(countries))
+	for country := range countries {
+		codes = append(codes, country)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// influxEscape escapes measurement names and tag values for the line protocol
+func influxEscape(value string) string {
+	return strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`).Replace(value)
+}
+
+// graphiteEscape keeps a value to a single Graphite path segment
+func graphiteEscape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == ' ' || r == '/' {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,207 @@
+package traefik_geoblock
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsPush_GraphiteTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US"}
+	cfg.StatsPushAddress = "tcp://" + listener.Addr().String()
+	cfg.StatsPushFormat = StatsPushFormatGraphite
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, "graphite-test", nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	for _, ip := range []string{"8.8.8.8", "8.8.4.4", "85.214.132.1"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-IP", ip)
+		plugin.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := plugin.statsPusher.push(time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	lines := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		".graphite-test.requests.US.allowed 2 1700000000",
+		".graphite-test.requests.US.blocked 0 1700000000",
+		".graphite-test.requests.DE.blocked 1 1700000000",
+		".graphite-test.errors.parse 0 1700000000",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("expected %q in the push, got %s", want, lines)
+		}
+	}
+	if !strings.HasPrefix(lines, "geoblock.") {
+		t.Errorf("expected metrics below the prefix, got %s", lines)
+	}
+}
+
+func TestStatsPush_InfluxHTTP(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.BlockedCountries = []string{"AU"}
+	cfg.StatsPushAddress = server.URL + "/api/v2/write?org=ops&bucket=edge"
+	cfg.StatsPushHeaders = map[string]string{"Authorization": "Token s3cret"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, "influx test", nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	plugin.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "not-an-ip")
+	plugin.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := plugin.statsPusher.push(time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	body := <-bodies
+	for _, want := range []string{
+		`geoblock_requests,host=`,
+		`,plugin=influx\ test,country=AU allowed=0i,blocked=1i 1700000000000000000`,
+		`parse=1i,lookup=0i`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the push, got %s", want, body)
+		}
+	}
+}
+
+func TestStatsPush_StopsOnClose(t *testing.T) {
+	pushes := make(chan struct{}, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes <- struct{}{}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.StatsPushAddress = server.URL + "/write"
+	cfg.StatsPushSeconds = 1
+
+	// A configuration reload shares the pusher, closing the previous instance keeps it running
+	first, err := newPlugin(context.TODO(), &noopHandler{}, cfg, "close-test", nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	second, err := newPlugin(context.TODO(), &noopHandler{}, cfg, "close-test", nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if first.statsPusher != second.statsPusher {
+		t.Fatal("expected both instances to share the pusher")
+	}
+	pusher := second.statsPusher
+	first.Close()
+
+	select {
+	case <-pushes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the pusher to keep running while an instance uses it")
+	}
+	second.Close()
+
+	statsPushersMutex.Lock()
+	_, registered := statsPushers[pusher.key]
+	statsPushersMutex.Unlock()
+	if registered {
+		t.Error("expected the pusher to be removed from the registry")
+	}
+	select {
+	case <-pushes:
+		t.Error("expected no pushes after the last instance was closed")
+	case <-time.After(2500 * time.Millisecond):
+	}
+}
+
+func TestStatsPushValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"Disabled", func(cfg *Config) {}, ""},
+		{"UDP", func(cfg *Config) { cfg.StatsPushAddress = "udp://127.0.0.1:8089" }, ""},
+		{"NoPort", func(cfg *Config) { cfg.StatsPushAddress = "udp://localhost" }, "invalid StatsPushAddress"},
+		{"UnknownScheme", func(cfg *Config) { cfg.StatsPushAddress = "statsd://localhost:8125" }, "must start with"},
+		{"GraphiteOverHTTP", func(cfg *Config) {
+			cfg.StatsPushAddress = "https://graphite.example.com"
+			cfg.StatsPushFormat = StatsPushFormatGraphite
+		}, "require StatsPushFormat influx"},
+		{"UnknownFormat", func(cfg *Config) {
+			cfg.StatsPushAddress = "udp://127.0.0.1:8089"
+			cfg.StatsPushFormat = "statsd"
+		}, "invalid StatsPushFormat"},
+		{"Interval", func(cfg *Config) {
+			cfg.StatsPushAddress = "udp://127.0.0.1:8089"
+			cfg.StatsPushSeconds = 0
+		}, "StatsPushSeconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			tt.modify(cfg)
+			_, err := newStatsPusher(cfg, "validation-"+tt.name, nil, nil)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package traefik_geoblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseThreatIntel is used when the IP is an active indicator of the threat intelligence feed
+const PhaseThreatIntel = "threat_intel"
+
+// Threat intelligence feed formats
+const (
+	ThreatIntelFormatMISP = "misp" // MISP attributes/restSearch endpoint, ip-src and ip-dst attributes
+	ThreatIntelFormatSTIX = "stix" // STIX 2.1 bundle or TAXII 2.1 collection objects, ipv4-addr/ipv6-addr indicator patterns
+)
+
+const (
+	// threatIntelMaxBody caps a single feed response
+	threatIntelMaxBody = 64 << 20
+	// threatIntelMaxPages caps the TAXII pages followed in one refresh
+	threatIntelMaxPages = 1000
+)
+
+// stixAddressPattern finds the address comparisons of a STIX pattern
+var stixAddressPattern = regexp.MustCompile(`(?i)ipv[46]-addr:value\s*=\s*'([^']+)'`)
+
+// ThreatIntelStats reports the state of the threat intelligence ingestion
+type ThreatIntelStats struct {
+	Enabled     bool      `json:"enabled"`
+	Indicators  int       `json:"indicators"`            // Indicators currently blocked
+	Ingested    int       `json:"ingested"`              // Indicators accepted by the last successful refresh
+	Expired     int       `json:"expired"`               // Indicators of the last successful refresh that were already expired
+	Skipped     int       `json:"skipped"`               // Entries of the last successful refresh that weren't usable IP indicators
+	Refreshes   int64     `json:"refreshes"`             // Successful refreshes
+	Failures    int64     `json:"failures"`              // Failed refreshes, the previous indicators were kept
+	LastRefresh time.Time `json:"lastRefresh,omitempty"` // Time of the last successful refresh
+	LastError   string    `json:"lastError,omitempty"`   // Error of the last failed refresh, cleared by a success
+}
+
+// threatIntelFeed blocks the IP indicators of a MISP server or a STIX/TAXII feed until they expire.
+// Each refresh replaces the indicators; expired ones stop matching right away.
+type threatIntelFeed struct {
+	mu         sync.RWMutex
+	indicators *IpLookupHelper      // Most specific indicator of an IP
+	expires    map[string]time.Time // By CIDR
+	stats      ThreatIntelStats
+
+	url        string
+	format     string
+	headers    map[string]string
+	defaultTTL time.Duration
+	refresh    time.Duration
+	client     *http.Client
+	logger     *slog.Logger
+
+	key      string        // Entry in threatIntelFeeds
+	refCount int           // Plugin instances using the feed, guarded by threatIntelFeedsMutex
+	stop     chan struct{} // Closed by releaseThreatIntelFeed when the last instance is closed
+}
+
+var (
+	// threatIntelFeeds shares one feed (and one refresher) per configuration between plugin instances
+	threatIntelFeeds      = make(map[string]*threatIntelFeed)
+	threatIntelFeedsMutex sync.Mutex
+)
+
+// threatIndicator is an IP indicator with the end of its validity
+type threatIndicator struct {
+	block   *net.IPNet
+	expires time.Time
+}
+
+// newThreatIntelFeed starts ingesting the feed. Returns nil when no ThreatIntelURL is configured.
+func newThreatIntelFeed(cfg *Config, logger *slog.Logger) (*threatIntelFeed, error) {
+	if cfg.ThreatIntelURL == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(cfg.ThreatIntelURL, "http://") && !strings.HasPrefix(cfg.ThreatIntelURL, "https://") {
+		return nil, fmt.Errorf("invalid ThreatIntelURL %q, must be an http(s) URL", cfg.ThreatIntelURL)
+	}
+	format := strings.ToLower(cfg.ThreatIntelFormat)
+	switch format {
+	case ThreatIntelFormatMISP, ThreatIntelFormatSTIX:
+	default:
+		return nil, fmt.Errorf("invalid ThreatIntelFormat %q, must be one of: %s, %s",
+			cfg.ThreatIntelFormat, ThreatIntelFormatMISP, ThreatIntelFormatSTIX)
+	}
+	if cfg.ThreatIntelRefreshSeconds <= 0 {
+		return nil, fmt.Errorf("ThreatIntelRefreshSeconds must be positive, got %d", cfg.ThreatIntelRefreshSeconds)
+	}
+	if cfg.ThreatIntelDefaultTTLSeconds <= 0 {
+		return nil, fmt.Errorf("ThreatIntelDefaultTTLSeconds must be positive, got %d", cfg.ThreatIntelDefaultTTLSeconds)
+	}
+	refresh := time.Duration(cfg.ThreatIntelRefreshSeconds) * time.Second
+	defaultTTL := time.Duration(cfg.ThreatIntelDefaultTTLSeconds) * time.Second
+
+	headerNames := make([]string, 0, len(cfg.ThreatIntelHeaders))
+	for name := range cfg.ThreatIntelHeaders {
+		headerNames = append(headerNames, name+"="+cfg.ThreatIntelHeaders[name])
+	}
+	sort.Strings(headerNames)
+	key := cfg.ThreatIntelURL + "|" + format + "|" + strings.Join(headerNames, ",") + "|" + refresh.String() + "|" + defaultTTL.String()
+	threatIntelFeedsMutex.Lock()
+	defer threatIntelFeedsMutex.Unlock()
+	if existing, ok := threatIntelFeeds[key]; ok {
+		existing.refCount++
+		return existing, nil
+	}
+
+	feed := &threatIntelFeed{
+		indicators: NewEmptyIpLookupHelper(),
+		expires:    make(map[string]time.Time),
+		stats:      ThreatIntelStats{Enabled: true},
+		url:        cfg.ThreatIntelURL,
+		format:     format,
+		headers:    cfg.ThreatIntelHeaders,
+		defaultTTL: defaultTTL,
+		refresh:    refresh,
+		client:     &http.Client{Timeout: 60 * time.Second},
+		logger:     logger,
+		key:        key,
+		refCount:   1,
+		stop:       make(chan struct{}),
+	}
+	go feed.refreshLoop()
+
+	threatIntelFeeds[key] = feed
+	return feed, nil
+}
+
+// releaseThreatIntelFeed drops one reference to the feed and stops its refresher once no plugin instance uses it
+func releaseThreatIntelFeed(feed *threatIntelFeed) {
+	threatIntelFeedsMutex.Lock()
+	defer threatIntelFeedsMutex.Unlock()
+
+	feed.refCount--
+	if feed.refCount > 0 {
+		return
+	}
+	if registered, exists := threatIntelFeeds[feed.key]; exists && registered == feed {
+		delete(threatIntelFeeds, feed.key)
+	}
+	close(feed.stop)
+}
+
+// match returns the active indicator containing the IP
+func (f *threatIntelFeed) match(ip net.IP, now time.Time) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	cidr, _, found := f.indicators.Match(ip)
+	if !found || !now.Before(f.expires[cidr]) {
+		return "", false
+	}
+	return cidr, true
+}
+
+// snapshot returns the ingestion stats with the number of indicators still active
+func (f *threatIntelFeed) snapshot(now time.Time) ThreatIntelStats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	stats := f.stats
+	stats.Indicators = 0
+	for _, expires := range f.expires {
+		if now.Before(expires) {
+			stats.Indicators++
+		}
+	}
+	return stats
+}
+
+// refreshLoop ingests the feed now and then periodically until stopped, keeping the previous indicators on failure
+func (f *threatIntelFeed) refreshLoop() {
+	ticker := time.NewTicker(f.refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := f.refreshFeed(time.Now()); err != nil {
+			f.mu.Lock()
+			f.stats.Failures++
+			f.stats.LastError = err.Error()
+			f.mu.Unlock()
+			f.logger.Warn("threat intelligence refresh failed, keeping previous indicators", "url", f.url, "error", err)
+		}
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshFeed downloads the indicators and swaps them in. Expired indicators are left out.
+func (f *threatIntelFeed) refreshFeed(now time.Time) error {
+	var indicators []threatIndicator
+	var skipped int
+	var err error
+	if f.format == ThreatIntelFormatMISP {
+		indicators, skipped, err = f.fetchMISP(now)
+	} else {
+		indicators, skipped, err = f.fetchSTIX(now)
+	}
+	if err != nil {
+		return err
+	}
+
+	helper := NewEmptyIpLookupHelper()
+	expires := make(map[string]time.Time, len(indicators))
+	expired := 0
+	for _, indicator := range indicators {
+		if !now.Before(indicator.expires) {
+			expired++
+			continue
+		}
+		cidr := indicator.block.String()
+		if previous, listed := expires[cidr]; listed {
+			// Listed twice, the longest validity wins
+			if indicator.expires.After(previous) {
+				expires[cidr] = indicator.expires
+			}
+			continue
+		}
+		helper.addBlock(indicator.block)
+		expires[cidr] = indicator.expires
+	}
+
+	f.mu.Lock()
+	f.indicators, f.expires = helper, expires
+	f.stats.Ingested = len(expires)
+	f.stats.Expired = expired
+	f.stats.Skipped = skipped
+	f.stats.Refreshes++
+	f.stats.LastRefresh = now
+	f.stats.LastError = ""
+	f.mu.Unlock()
+	f.logger.Info("threat intelligence refreshed", "url", f.url, "format", f.format,
+		"indicators", len(expires), "expired", expired, "skipped", skipped)
+	return nil
+}
+
+// get sends a request to the feed with the configured headers and returns the capped body
+func (f *threatIntelFeed) get(method, target string, body []byte, accept string) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range f.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download threat intelligence from %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download threat intelligence from %s: status %d", target, resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, threatIntelMaxBody+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read threat intelligence from %s: %w", target, err)
+	}
+	if len(content) > threatIntelMaxBody {
+		return nil, fmt.Errorf("threat intelligence from %s exceeds %d bytes", target, threatIntelMaxBody)
+	}
+	return content, nil
+}
+
+// fetchMISP queries the restSearch endpoint for IDS-flagged IP attributes
+func (f *threatIntelFeed) fetchMISP(now time.Time) ([]threatIndicator, int, error) {
+	query := []byte(`{"returnFormat":"json","type":["ip-src","ip-dst","ip-src|port","ip-dst|port"],"to_ids":true,"deleted":false}`)
+	content, err := f.get(http.MethodPost, f.url, query, "application/json")
+	if err != nil {
+		return nil, 0, err
+	}
+	return parseMISPAttributes(content, f.defaultTTL, now)
+}
+
+// parseMISPAttributes reads the attributes of a restSearch response. MISP has no expiry, an attribute is
+// valid for the default TTL after it was last seen (or last changed).
+func parseMISPAttributes(content []byte, defaultTTL time.Duration, now time.Time) ([]threatIndicator, int, error) {
+	var response struct {
+		Response struct {
+			Attribute []struct {
+				Type      string `json:"type"`
+				Value     string `json:"value"`
+				Timestamp string `json:"timestamp"`
+				LastSeen  string `json:"last_seen"`
+			} `json:"Attribute"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, 0, fmt.Errorf("invalid MISP response: %w", err)
+	}
+
+	var indicators []threatIndicator
+	skipped := 0
+	for _, attribute := range response.Response.Attribute {
+		value := attribute.Value
+		if strings.HasSuffix(attribute.Type, "|port") {
+			value, _, _ = strings.Cut(value, "|")
+		}
+		block, err := parseHostOrCIDR(strings.TrimSpace(value))
+		if err != nil || !strings.HasPrefix(attribute.Type, "ip-") {
+			skipped++
+			continue
+		}
+
+		seen := now
+		if lastSeen, err := time.Parse(time.RFC3339Nano, attribute.LastSeen); err == nil {
+			seen = lastSeen
+		} else if seconds, err := strconv.ParseInt(attribute.Timestamp, 10, 64); err == nil {
+			seen = time.Unix(seconds, 0)
+		}
+		indicators = append(indicators, threatIndicator{block: block, expires: seen.Add(defaultTTL)})
+	}
+	return indicators, skipped, nil
+}
+
+// fetchSTIX reads a STIX bundle, or the pages of a TAXII 2.1 collection
+func (f *threatIntelFeed) fetchSTIX(now time.Time) ([]threatIndicator, int, error) {
+	var indicators []threatIndicator
+	skipped := 0
+	target := f.url
+	for page := 0; page < threatIntelMaxPages; page++ {
+		content, err := f.get(http.MethodGet, target, nil, "application/taxii+json;version=2.1, application/json")
+		if err != nil {
+			return nil, 0, err
+		}
+		pageIndicators, pageSkipped, next, err := parseSTIXObjects(content, f.defaultTTL, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		indicators = append(indicators, pageIndicators...)
+		skipped += pageSkipped
+		if next == "" {
+			return indicators, skipped, nil
+		}
+
+		parsed, err := url.Parse(f.url)
+		if err != nil {
+			return nil, 0, err
+		}
+		query := parsed.Query()
+		query.Set("next", next)
+		parsed.RawQuery = query.Encode()
+		target = parsed.String()
+	}
+	return nil, 0, fmt.Errorf("more than %d TAXII pages at %s", threatIntelMaxPages, f.url)
+}
+
+// parseSTIXObjects reads the indicators of a STIX bundle or TAXII envelope and returns the next page, if any.
+// Only patterns made of IP comparisons joined by OR are used: an AND with other observables (a port,
+// a domain) would block far more than the indicator describes. Revoked indicators are skipped.
+// An indicator is valid until valid_until, or for the default TTL after it was last modified.
+func parseSTIXObjects(content []byte, defaultTTL time.Duration, now time.Time) ([]threatIndicator, int, string, error) {
+	var envelope struct {
+		More    bool   `json:"more"`
+		Next    string `json:"next"`
+		Objects []struct {
+			Type        string `json:"type"`
+			Pattern     string `json:"pattern"`
+			PatternType string `json:"pattern_type"`
+			Modified    string `json:"modified"`
+			ValidUntil  string `json:"valid_until"`
+			Revoked     bool   `json:"revoked"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(content, &envelope); err != nil {
+		return nil, 0, "", fmt.Errorf("invalid STIX content: %w", err)
+	}
+
+	var indicators []threatIndicator
+	skipped := 0
+	for _, object := range envelope.Objects {
+		if object.Type != "indicator" {
+			continue
+		}
+		if object.Revoked || (object.PatternType != "" && object.PatternType != "stix") {
+			skipped++
+			continue
+		}
+		matches := stixAddressPattern.FindAllStringSubmatch(object.Pattern, -1)
+		rest := strings.NewReplacer("[", " ", "]", " ", "(", " ", ")", " ").Replace(stixAddressPattern.ReplaceAllString(object.Pattern, ""))
+		onlyAddresses := len(matches) > 0
+		for _, token := range strings.Fields(rest) {
+			if !strings.EqualFold(token, "OR") {
+				onlyAddresses = false
+			}
+		}
+		if !onlyAddresses {
+			skipped++
+			continue
+		}
+
+		expires := now.Add(defaultTTL)
+		if validUntil, err := time.Parse(time.RFC3339Nano, object.ValidUntil); err == nil {
+			expires = validUntil
+		} else if modified, err := time.Parse(time.RFC3339Nano, object.Modified); err == nil {
+			expires = modified.Add(defaultTTL)
+		}
+		for _, match := range matches {
+			block, err := parseHostOrCIDR(match[1])
+			if err != nil {
+				skipped++
+				continue
+			}
+			indicators = append(indicators, threatIndicator{block: block, expires: expires})
+		}
+	}
+
+	next := ""
+	if envelope.More {
+		next = envelope.Next
+	}
+	return indicators, skipped, next, nil
+}
+
+// ThreatIntelStats reports the threat intelligence ingestion. Enabled is false without ThreatIntelURL.
+func (p Plugin) ThreatIntelStats() ThreatIntelStats {
+	if p.threatIntel == nil {
+		return ThreatIntelStats{}
+	}
+	return p.threatIntel.snapshot(time.Now())
+}
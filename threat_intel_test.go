@@ -0,0 +1,170 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThreatIntel_MISP(t *testing.T) {
+	var broken atomic.Bool
+	var authorized atomic.Bool
+	lastSeen := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorized.Store(req.Method == http.MethodPost && req.Header.Get("Authorization") == "misp-key")
+		if broken.Load() {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Write([]byte(`{"response": {"Attribute": [
+			{"type": "ip-src", "value": "8.8.8.0/28", "last_seen": "` + lastSeen + `"},
+			{"type": "ip-dst|port", "value": "8.8.4.4|443"},
+			{"type": "ip-src", "value": "1.1.1.1", "timestamp": "946684800"},
+			{"type": "ip-src", "value": "1.1.1.2"},
+			{"type": "ip-src", "value": "not-an-ip"},
+			{"type": "domain", "value": "example.com"}
+		]}}`))
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.AllowedIPBlocks = []string{"1.1.1.2/32"}
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Action"
+	cfg.ThreatIntelURL = server.URL + "/attributes/restSearch"
+	cfg.ThreatIntelFormat = "MISP"
+	cfg.ThreatIntelHeaders = map[string]string{"Authorization": "misp-key"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+	waitFor(t, "threat intelligence", func() bool { return plugin.ThreatIntelStats().Refreshes > 0 })
+	if !authorized.Load() {
+		t.Error("expected a POST with the configured headers")
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want int
+	}{
+		{"indicator range", "8.8.8.8", http.StatusForbidden},
+		{"outside the range", "8.8.8.200", http.StatusTeapot},
+		{"indicator with port", "8.8.4.4", http.StatusForbidden},
+		{"expired indicator", "1.1.1.1", http.StatusTeapot},
+		{"allowed IP block wins", "1.1.1.2", http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+			if rr.Code == http.StatusForbidden && rr.Header().Get("X-Geoblock-Action") != PhaseThreatIntel {
+				t.Errorf("expected phase %s, got %q", PhaseThreatIntel, rr.Header().Get("X-Geoblock-Action"))
+			}
+		})
+	}
+
+	stats := plugin.ThreatIntelStats()
+	if !stats.Enabled || stats.Indicators != 3 || stats.Ingested != 3 || stats.Expired != 1 || stats.Skipped != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// A failed refresh keeps the indicators and reports the error
+	broken.Store(true)
+	if err := plugin.threatIntel.refreshFeed(time.Now()); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if _, listed := plugin.threatIntel.match(net.ParseIP("8.8.8.8"), time.Now()); !listed {
+		t.Error("expected the previous indicators to be kept")
+	}
+	if _, listed := plugin.threatIntel.match(net.ParseIP("8.8.8.8"), time.Now().Add(8*24*time.Hour)); listed {
+		t.Error("expected the indicator to expire after the default TTL")
+	}
+}
+
+func TestParseSTIXObjects(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	content := []byte(`{"more": true, "next": "page-2", "objects": [
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[ipv4-addr:value = '203.0.113.0/24']", "valid_until": "2026-10-02T00:00:00Z"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[ipv4-addr:value = '198.51.100.1' OR ipv6-addr:value = '2001:db8::1']", "modified": "2026-09-30T00:00:00Z"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[ipv4-addr:value = '192.0.2.1' AND network-traffic:dst_port = 443]"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[domain-name:value = 'example.com']"},
+		{"type": "indicator", "pattern_type": "stix", "pattern": "[ipv4-addr:value = '192.0.2.2']", "revoked": true},
+		{"type": "indicator", "pattern_type": "snort", "pattern": "alert ip 192.0.2.3 any -> any any"},
+		{"type": "malware", "name": "not an indicator"}
+	]}`)
+
+	indicators, skipped, next, err := parseSTIXObjects(content, 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if next != "page-2" || skipped != 4 {
+		t.Errorf("expected next page-2 and 4 skipped, got %q and %d", next, skipped)
+	}
+	got := make([]string, 0, len(indicators))
+	for _, indicator := range indicators {
+		got = append(got, indicator.block.String()+"@"+indicator.expires.Format(time.RFC3339))
+	}
+	want := "203.0.113.0/24@2026-10-02T00:00:00Z 198.51.100.1/32@2026-10-01T00:00:00Z 2001:db8::1/128@2026-10-01T00:00:00Z"
+	if strings.Join(got, " ") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestThreatIntel_TAXIIPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		envelope := map[string]any{"objects": []map[string]string{
+			{"type": "indicator", "pattern": "[ipv4-addr:value = '203.0.113.1']"},
+		}}
+		if req.URL.Query().Get("next") == "" {
+			envelope = map[string]any{"more": true, "next": "2", "objects": []map[string]string{
+				{"type": "indicator", "pattern": "[ipv4-addr:value = '203.0.113.0/28']"},
+			}}
+		}
+		json.NewEncoder(rw).Encode(envelope)
+	}))
+	defer server.Close()
+
+	cfg := CreateConfig()
+	cfg.ThreatIntelURL = server.URL + "/taxii2/api/collections/abc/objects/?added_after=2026-01-01T00:00:00Z"
+	cfg.ThreatIntelFormat = ThreatIntelFormatSTIX
+	cfg.ThreatIntelRefreshSeconds = 3601 // Own feed, the refresh loop of the other tests doesn't apply
+	feed, err := newThreatIntelFeed(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	waitFor(t, "threat intelligence", func() bool { return feed.snapshot(time.Now()).Refreshes > 0 })
+	if stats := feed.snapshot(time.Now()); stats.Indicators != 2 {
+		t.Errorf("expected the indicators of both pages, got %+v", stats)
+	}
+}
+
+func TestThreatIntel_Invalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{ThreatIntelURL: "misp.example.com", ThreatIntelFormat: "misp", ThreatIntelRefreshSeconds: 1, ThreatIntelDefaultTTLSeconds: 1},
+		{ThreatIntelURL: "https://misp.example.com", ThreatIntelFormat: "openioc", ThreatIntelRefreshSeconds: 1, ThreatIntelDefaultTTLSeconds: 1},
+		{ThreatIntelURL: "https://misp.example.com", ThreatIntelFormat: "misp", ThreatIntelDefaultTTLSeconds: 1},
+		{ThreatIntelURL: "https://misp.example.com", ThreatIntelFormat: "misp", ThreatIntelRefreshSeconds: 1},
+	} {
+		if _, err := newThreatIntelFeed(&cfg, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+			t.Errorf("expected an error for %s %s", cfg.ThreatIntelURL, cfg.ThreatIntelFormat)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+func main() {
+	var statsFilePath string
+	var perBucket bool
+	var width int
+
+	flag.StringVar(&statsFilePath, "file", "", "Path to the country stats ring file (countryStatsFile)")
+	flag.BoolVar(&perBucket, "buckets", false, "Print every time bucket instead of the totals only")
+	flag.IntVar(&width, "width", 50, "Width of the histogram bars")
+	flag.Parse()
+
+	if statsFilePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	snapshot, err := geoblock.ReadCountryStatsFile(statsFilePath)
+	if err != nil {
+		log.Fatalf("reading country stats failed: %v", err)
+	}
+
+	fmt.Printf("buckets: %d x %ds, sample rate 1/%d\n", len(snapshot.Buckets), snapshot.BucketSeconds, snapshot.SampleRate)
+	if len(snapshot.Buckets) > 0 {
+		fmt.Printf("from %s to %s\n", snapshot.Buckets[0].Start.Format("2006-01-02 15:04"),
+			snapshot.Buckets[len(snapshot.Buckets)-1].Start.Format("2006-01-02 15:04"))
+	}
+
+	if perBucket {
+		for _, bucket := range snapshot.Buckets {
+			fmt.Printf("\n%s\n", bucket.Start.Format("2006-01-02 15:04"))
+			printHistogram(bucket.Countries, width)
+		}
+		return
+	}
+
+	fmt.Println()
+	printHistogram(snapshot.Totals, width)
+}
+
+// printHistogram prints one bar per country, largest first
+func printHistogram(counts map[string]geoblock.CountryCount, width int) {
+	countries := make([]string, 0, len(counts))
+	var max int64
+	for country, count := range counts {
+		countries = append(countries, country)
+		if count.Requests > max {
+			max = count.Requests
+		}
+	}
+	sort.Slice(countries, func(i, j int) bool {
+		if counts[countries[i]].Requests != counts[countries[j]].Requests {
+			return counts[countries[i]].Requests > counts[countries[j]].Requests
+		}
+		return countries[i] < countries[j]
+	})
+
+	for _, country := range countries {
+		count := counts[country]
+		bar := 0
+		if max > 0 {
+			bar = int(count.Requests * int64(width) / max)
+		}
+		fmt.Printf("  %-8s %10d  blocked %10d  %s\n", country, count.Requests, count.Blocked, strings.Repeat("#", bar))
+	}
+}
@@ -0,0 +1,268 @@
+// Command dbgen builds tiny but valid IP2Location DB1 BIN files (IPv4 + IPv6 country tables)
+// from a small list of CIDR to country assignments, so unit tests and CI don't need the full
+// LITE database.
+//
+// Input format, one assignment per line (blank lines and # comments are ignored):
+//
+//	1.1.1.0/24,AU,Australia
+//	2001:4860::/32,US
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	headerSize    = 64  // Size of the BIN header read by the ip2location library
+	minFileSize   = 512 // The plugin reads the first 512 bytes to extract the version
+	unknownCode   = "-" // Country code used for unassigned space, same as the LITE database
+	ipv4ColSize   = 8   // IP from (4) + country pointer (4)
+	ipv6ColSize   = 20  // IP from (16) + country pointer (4)
+	dbTypeCountry = 1   // DB1
+	dbColumns     = 2   // IP from + country
+	productCode   = 1   // IP2Location
+)
+
+// assignment is a single range to country mapping
+type assignment struct {
+	from, to  *big.Int
+	short     string
+	long      string
+	ipv6Space bool
+}
+
+// row is a single database row: the start of the range and the country it maps to
+type row struct {
+	from  *big.Int
+	short string
+}
+
+func main() {
+	var inFilePath, outFilePath, dateStr string
+
+	flag.StringVar(&inFilePath, "i", "", "Input file with CIDR,COUNTRY[,NAME] lines")
+	flag.StringVar(&outFilePath, "o", "", "Output file path")
+	flag.StringVar(&dateStr, "date", time.Now().UTC().Format("20060102"), "Database date written to the header (YYYYMMDD)")
+	flag.Parse()
+
+	if inFilePath == "" || outFilePath == "" {
+		log.Fatalln("both -i and -o must be provided")
+	}
+
+	date, err := time.Parse("20060102", dateStr)
+	if err != nil {
+		log.Fatalf("invalid date %q: %v", dateStr, err)
+	}
+
+	assignments, err := readAssignments(inFilePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	content, err := buildDatabase(assignments, date)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(outFilePath, content, 0644); err != nil { // #nosec G306
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s (%d bytes, %d assignments)", outFilePath, len(content), len(assignments))
+}
+
+// readAssignments parses the input file
+func readAssignments(path string) ([]assignment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var assignments []assignment
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		a, err := parseAssignment(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		assignments = append(assignments, a)
+	}
+
+	return assignments, scanner.Err()
+}
+
+// parseAssignment parses a single CIDR,COUNTRY[,NAME] line
+func parseAssignment(line string) (assignment, error) {
+	parts := strings.Split(line, ",")
+	if len(parts) < 2 {
+		return assignment{}, fmt.Errorf("expected CIDR,COUNTRY[,NAME], got %q", line)
+	}
+
+	_, network, err := net.ParseCIDR(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return assignment{}, err
+	}
+
+	short := strings.ToUpper(strings.TrimSpace(parts[1]))
+	if len(short) != 2 {
+		return assignment{}, fmt.Errorf("country code must have two letters, got %q", short)
+	}
+
+	long := short
+	if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+		long = strings.TrimSpace(parts[2])
+	}
+
+	ip := network.IP.To4()
+	ipv6Space := ip == nil
+	if ipv6Space {
+		ip = network.IP.To16()
+	}
+
+	from := new(big.Int).SetBytes(ip)
+	ones, bits := network.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	to := new(big.Int).Sub(new(big.Int).Add(from, size), big.NewInt(1))
+
+	return assignment{from: from, to: to, short: short, long: long, ipv6Space: ipv6Space}, nil
+}
+
+// buildRows turns the assignments of one address family into contiguous rows covering the whole space.
+// Gaps are filled with the unknown country, and a trailing sentinel row holds the maximum address.
+func buildRows(assignments []assignment, maxAddr *big.Int) ([]row, error) {
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].from.Cmp(assignments[j].from) < 0 })
+
+	var rows []row
+	cur := big.NewInt(0)
+	for _, a := range assignments {
+		if a.from.Cmp(cur) < 0 {
+			return nil, fmt.Errorf("overlapping ranges are not supported (%s)", a.short)
+		}
+		if a.from.Cmp(cur) > 0 {
+			rows = append(rows, row{from: cur, short: unknownCode})
+		}
+		rows = append(rows, row{from: a.from, short: a.short})
+		cur = new(big.Int).Add(a.to, big.NewInt(1))
+	}
+	if cur.Cmp(maxAddr) < 0 {
+		rows = append(rows, row{from: cur, short: unknownCode})
+	}
+
+	return append(rows, row{from: maxAddr, short: unknownCode}), nil
+}
+
+// buildDatabase serializes the assignments into the DB1 BIN layout understood by ip2location-go
+func buildDatabase(assignments []assignment, date time.Time) ([]byte, error) {
+	var ipv4, ipv6 []assignment
+	names := map[string]string{unknownCode: unknownCode}
+	for _, a := range assignments {
+		names[a.short] = a.long
+		if a.ipv6Space {
+			ipv6 = append(ipv6, a)
+		} else {
+			ipv4 = append(ipv4, a)
+		}
+	}
+
+	maxIPv4 := new(big.Int).SetUint64(0xFFFFFFFF)
+	maxIPv6 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+	rows4, err := buildRows(ipv4, maxIPv4)
+	if err != nil {
+		return nil, err
+	}
+	rows6, err := buildRows(ipv6, maxIPv6)
+	if err != nil {
+		return nil, err
+	}
+
+	// Offsets are 1-based in the BIN format. The ipfrom of the row after the last one is read
+	// as the end of the range, so each table is followed by one extra ipfrom column.
+	ipv4Base := headerSize + 1
+	ipv6Base := ipv4Base + len(rows4)*ipv4ColSize + 4
+	stringsOffset := ipv6Base - 1 + len(rows6)*ipv6ColSize + 16
+
+	// String table: [len][short] padded to 3 bytes, followed by [len][long]
+	countries := make([]string, 0, len(names))
+	for code := range names {
+		countries = append(countries, code)
+	}
+	sort.Strings(countries)
+
+	pointers := make(map[string]uint32, len(countries))
+	var stringTable []byte
+	for _, code := range countries {
+		pointers[code] = uint32(stringsOffset + len(stringTable)) // #nosec G115
+		entry := make([]byte, 3)
+		entry[0] = byte(len(code))
+		copy(entry[1:], code)
+		stringTable = append(stringTable, entry...)
+		stringTable = append(stringTable, byte(len(names[code])))
+		stringTable = append(stringTable, names[code]...)
+	}
+
+	buf := make([]byte, stringsOffset, stringsOffset+len(stringTable)+minFileSize)
+
+	// IPv4 table
+	pos := ipv4Base - 1
+	for _, r := range rows4 {
+		binary.LittleEndian.PutUint32(buf[pos:], uint32(r.from.Uint64())) // #nosec G115
+		binary.LittleEndian.PutUint32(buf[pos+4:], pointers[r.short])
+		pos += ipv4ColSize
+	}
+	binary.LittleEndian.PutUint32(buf[pos:], 0xFFFFFFFF)
+
+	// IPv6 table
+	pos = ipv6Base - 1
+	for _, r := range rows6 {
+		putUint128(buf[pos:], r.from)
+		binary.LittleEndian.PutUint32(buf[pos+16:], pointers[r.short])
+		pos += ipv6ColSize
+	}
+	putUint128(buf[pos:], maxIPv6)
+
+	buf = append(buf, stringTable...)
+	if len(buf) < minFileSize {
+		buf = append(buf, make([]byte, minFileSize-len(buf))...)
+	}
+
+	// Header. Row counts exclude the sentinel row, no index tables are written.
+	buf[0] = dbTypeCountry
+	buf[1] = dbColumns
+	buf[2] = byte(date.Year() - 2000)
+	buf[3] = byte(date.Month())
+	buf[4] = byte(date.Day())
+	binary.LittleEndian.PutUint32(buf[5:], uint32(len(rows4)-1))  // #nosec G115
+	binary.LittleEndian.PutUint32(buf[9:], uint32(ipv4Base))      // #nosec G115
+	binary.LittleEndian.PutUint32(buf[13:], uint32(len(rows6)-1)) // #nosec G115
+	binary.LittleEndian.PutUint32(buf[17:], uint32(ipv6Base))     // #nosec G115
+	buf[29] = productCode
+	binary.LittleEndian.PutUint32(buf[31:], uint32(len(buf))) // #nosec G115
+
+	return buf, nil
+}
+
+// putUint128 writes a 128-bit number in little endian byte order
+func putUint128(dst []byte, n *big.Int) {
+	be := n.FillBytes(make([]byte, 16))
+	for i := 0; i < 16; i++ {
+		dst[i] = be[15-i]
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ip2location/ip2location-go/v9"
+)
+
+func TestBuildDatabase(t *testing.T) {
+	var assignments []assignment
+	for _, line := range []string{
+		"1.1.1.0/24,AU,Australia",
+		"8.8.8.0/24,us",
+		"2001:4860::/32,US,United States of America",
+		"255.255.255.0/24,ZZ",
+	} {
+		a, err := parseAssignment(line)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", line, err)
+		}
+		assignments = append(assignments, a)
+	}
+
+	content, err := buildDatabase(assignments, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to build database: %v", err)
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "tiny.BIN")
+	if err := os.WriteFile(dbPath, content, 0600); err != nil {
+		t.Fatalf("failed to write database: %v", err)
+	}
+
+	db, err := ip2location.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open generated database: %v", err)
+	}
+	defer db.Close()
+
+	if version := db.DatabaseVersion(); version != "2025.4.1" {
+		t.Errorf("expected version 2025.4.1, got %s", version)
+	}
+
+	tests := map[string]string{
+		"1.1.1.0":         "AU",
+		"1.1.1.1":         "AU",
+		"1.1.1.255":       "AU",
+		"1.1.2.0":         "-",
+		"0.0.0.0":         "-",
+		"8.8.8.8":         "US",
+		"9.9.9.9":         "-",
+		"255.255.255.255": "ZZ",
+		"::ffff:1.1.1.1":  "AU",
+		"2001:4860::1":    "US",
+		"2001:4861::1":    "-",
+		"::1":             "-",
+		"ffff::1":         "-",
+	}
+	for ip, want := range tests {
+		record, err := db.Get_country_short(ip)
+		if err != nil {
+			t.Errorf("lookup of %s failed: %v", ip, err)
+			continue
+		}
+		if record.Country_short != want {
+			t.Errorf("lookup of %s: expected %q, got %q", ip, want, record.Country_short)
+		}
+	}
+
+	record, err := db.Get_country_long("1.1.1.1")
+	if err != nil || record.Country_long != "Australia" {
+		t.Errorf("expected long name Australia, got %q (err: %v)", record.Country_long, err)
+	}
+}
+
+func TestParseAssignment_Errors(t *testing.T) {
+	for _, line := range []string{"1.1.1.0/24", "not-a-cidr,US", "1.1.1.0/24,USA"} {
+		if _, err := parseAssignment(line); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
+
+func TestBuildRows_Overlapping(t *testing.T) {
+	a, _ := parseAssignment("1.1.0.0/16,AU")
+	b, _ := parseAssignment("1.1.1.0/24,NZ")
+	if _, err := buildDatabase([]assignment{a, b}, time.Now()); err == nil {
+		t.Error("expected error for overlapping ranges")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+func main() {
+	var configFilePath, databaseFilePath, accessLogPath, ipsFilePath, decisionLogPath string
+
+	flag.StringVar(&configFilePath, "config", "", "Path to a JSON file with the plugin configuration")
+	flag.StringVar(&databaseFilePath, "db", "", "Path to the IP2Location database (overrides the config file)")
+	flag.StringVar(&accessLogPath, "log", "", "Path to the access log to replay (defaults to stdin)")
+	flag.StringVar(&ipsFilePath, "ips", "", "Path to a file with one IP per line to check instead of replaying a log (- for stdin), prints JSON lines")
+	flag.StringVar(&decisionLogPath, "decisions", "", "Path to a decision log (decisionLogFile) to re-evaluate with the config and database, prints the changed decisions")
+	flag.Parse()
+
+	cfg := geoblock.CreateConfig()
+	if configFilePath != "" {
+		content, err := os.ReadFile(configFilePath)
+		if err != nil {
+			log.Fatalf("reading config file failed: %v", err)
+		}
+		if err := json.Unmarshal(content, cfg); err != nil {
+			log.Fatalf("parsing config file failed: %v", err)
+		}
+	}
+	cfg.Enabled = true
+	cfg.LogLevel = "error"
+	if databaseFilePath != "" {
+		cfg.DatabaseFilePath = databaseFilePath
+	}
+
+	handler, err := geoblock.New(context.Background(), http.NotFoundHandler(), cfg, "logreplay")
+	if err != nil {
+		log.Fatalf("creating plugin failed: %v", err)
+	}
+	plugin := handler.(*geoblock.Plugin)
+
+	if ipsFilePath != "" {
+		checkIPs(plugin, ipsFilePath)
+		return
+	}
+	if decisionLogPath != "" {
+		replayDecisions(plugin, decisionLogPath)
+		return
+	}
+
+	input := os.Stdin
+	if accessLogPath != "" {
+		input, err = os.Open(accessLogPath)
+		if err != nil {
+			log.Fatalf("opening access log failed: %v", err)
+		}
+		defer input.Close()
+	}
+
+	summary, err := plugin.Replay(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("lines:      %d\n", summary.Lines)
+	fmt.Printf("evaluated:  %d (%d unique IPs)\n", summary.Evaluated, summary.UniqueIPs)
+	fmt.Printf("skipped:    %d\n", summary.Skipped)
+	fmt.Printf("allowed:    %d\n", summary.Allowed)
+	fmt.Printf("blocked:    %d\n", summary.Blocked)
+	fmt.Printf("errors:     %d\n", summary.Errors)
+	printCounts("blocked by country", summary.BlockedByCountry)
+	printCounts("blocked by phase", summary.BlockedByPhase)
+}
+
+// checkIPs evaluates the IPs of a file, one per line, and prints one JSON result per IP
+func checkIPs(plugin *geoblock.Plugin, path string) {
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("opening IP list failed: %v", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var ips []string
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			ips = append(ips, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("reading IP list failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, result := range plugin.CheckAllowedBatch(ips) {
+		if err := encoder.Encode(result); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// replayDecisions re-evaluates a decision log and prints what the candidate config and database would change
+func replayDecisions(plugin *geoblock.Plugin, path string) {
+	input, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("opening decision log failed: %v", err)
+	}
+	defer input.Close()
+
+	diff, err := plugin.ReplayDecisions(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("decisions:       %d\n", diff.Records)
+	fmt.Printf("skipped lines:   %d\n", diff.Skipped)
+	fmt.Printf("errors:          %d\n", diff.Errors)
+	fmt.Printf("unchanged:       %d\n", diff.Unchanged)
+	fmt.Printf("newly blocked:   %d\n", diff.NewlyBlocked)
+	fmt.Printf("newly allowed:   %d\n", diff.NewlyAllowed)
+	fmt.Printf("country changed: %d\n", diff.CountryChanged)
+	printCounts("newly blocked by country", diff.NewlyBlockedByCountry)
+	printCounts("newly allowed by country", diff.NewlyAllowedByCountry)
+	printCounts("phase changes", diff.PhaseChanges)
+}
+
+// printCounts prints a map of counters sorted by descending count
+func printCounts(title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Printf("\n%s:\n", title)
+	for _, k := range keys {
+		fmt.Printf("  %-20s %d\n", k, counts[k])
+	}
+}
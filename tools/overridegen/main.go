@@ -0,0 +1,47 @@
+// Command overridegen compiles range to country assignments into the snapshot format accepted by
+// RangeOverridesFile. The plugin also reads the text format directly, but large lists are parsed and
+// flattened on every start; a compiled snapshot is loaded with a single read.
+//
+// Input format, one assignment per line (blank lines and # comments are ignored, the same as dbgen):
+//
+//	10.0.0.0/8,US
+//	10.20.0.0/16,DE,Germany
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	geoblock "github.com/david-garcia-garcia/traefik-geoblock"
+)
+
+func main() {
+	var inFilePath, outFilePath string
+
+	flag.StringVar(&inFilePath, "i", "", "Input file with CIDR,COUNTRY[,NAME] lines")
+	flag.StringVar(&outFilePath, "o", "", "Output snapshot path")
+	flag.Parse()
+
+	if inFilePath == "" || outFilePath == "" {
+		log.Fatalln("both -i and -o must be provided")
+	}
+
+	in, err := os.Open(inFilePath)
+	if err != nil {
+		log.Fatalf("opening input failed: %v", err)
+	}
+	defer in.Close()
+
+	var out bytes.Buffer
+	ranges, err := geoblock.CompileRangeOverrides(in, &out)
+	if err != nil {
+		log.Fatalf("compiling %s failed: %v", inFilePath, err)
+	}
+	if err := os.WriteFile(outFilePath, out.Bytes(), 0644); err != nil {
+		log.Fatalf("writing snapshot failed: %v", err)
+	}
+	fmt.Printf("wrote %d ranges (%d bytes) to %s\n", ranges, out.Len(), outFilePath)
+}
@@ -0,0 +1,81 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+)
+
+// PhaseTrapPath is used when a request hit one of the TrapPaths
+const PhaseTrapPath = "trap_path"
+
+// trapPaths bans the IPs requesting honeypot paths in the dynamic blocklist
+type trapPaths struct {
+	exact    map[string]struct{} // Lowercased paths
+	prefixes []string            // Lowercased prefixes, from entries ending with "*"
+	ttl      time.Duration       // Ban duration, 0 bans permanently
+}
+
+// newTrapPaths validates TrapPaths. Returns nil when no paths are configured.
+func newTrapPaths(cfg *Config) (*trapPaths, error) {
+	if len(cfg.TrapPaths) == 0 {
+		return nil, nil
+	}
+	if cfg.TrapBanSeconds < 0 {
+		return nil, fmt.Errorf("TrapBanSeconds can't be negative, got %d", cfg.TrapBanSeconds)
+	}
+
+	traps := &trapPaths{
+		exact: make(map[string]struct{}, len(cfg.TrapPaths)),
+		ttl:   time.Duration(cfg.TrapBanSeconds) * time.Second,
+	}
+	for _, entry := range cfg.TrapPaths {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if !strings.HasPrefix(entry, "/") {
+			return nil, fmt.Errorf("invalid TrapPaths entry %q: must start with /", entry)
+		}
+		if prefix, isPrefix := strings.CutSuffix(entry, "*"); isPrefix {
+			traps.prefixes = append(traps.prefixes, prefix)
+			continue
+		}
+		traps.exact[path.Clean(entry)] = struct{}{}
+	}
+	return traps, nil
+}
+
+// matches reports whether the request path is a trap. Paths are cleaned and compared case-insensitively,
+// so "//WP-LOGIN.php" or "/x/../.env" don't slip through.
+func (t *trapPaths) matches(requestPath string) bool {
+	cleaned := strings.ToLower(path.Clean("/" + requestPath))
+	if _, ok := t.exact[cleaned]; ok {
+		return true
+	}
+	for _, prefix := range t.prefixes {
+		if strings.HasPrefix(cleaned, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// trap bans the IP of a decision whose request hit a trap path. Private IPs and allowedIPBlocks are never banned.
+// Returns the decision to apply to the trapping request.
+func (t *trapPaths) trap(decision ipDecision, requestPath string, blocklist *dynamicBlocklist, logger *slog.Logger) ipDecision {
+	if decision.ip == "" || decision.phase == PhaseAllowPrivate || decision.phase == PhaseAllowedIPBlock {
+		return decision
+	}
+
+	ban, err := blocklist.add(decision.ip, t.ttl)
+	if err != nil {
+		logger.Error("failed to ban trap path client", "ip", decision.ip, "error", err)
+	} else {
+		logger.Warn("trap path hit, client banned",
+			"ip", decision.ip,
+			"country", decision.country,
+			"path", requestPath,
+			"expires", ban.Expires)
+	}
+	return ipDecision{blocked: true, ip: decision.ip, country: decision.country, phase: PhaseTrapPath}
+}
@@ -0,0 +1,67 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrapPaths(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.AllowedIPBlocks = []string{"8.8.8.8/32"}
+	cfg.AllowPrivate = true
+	cfg.TrapPaths = []string{"/wp-login.php", "/.env", "/cgi-bin/*"}
+	cfg.RemediationHeadersCustomName = "X-Geoblock-Phase"
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	serve := func(ip, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		plugin.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve("1.1.1.1", "/"); rr.Code != http.StatusTeapot {
+		t.Fatalf("expected an allowed country to pass, got %d", rr.Code)
+	}
+	if rr := serve("1.1.1.1", "//WP-Login.php"); rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseTrapPath {
+		t.Fatalf("expected the trap to block, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+	}
+	if rr := serve("1.1.1.1", "/"); rr.Code != http.StatusForbidden || rr.Header().Get("X-Geoblock-Phase") != PhaseDynamicBlocklist {
+		t.Errorf("expected the trapped IP to stay banned, got %d %q", rr.Code, rr.Header().Get("X-Geoblock-Phase"))
+	}
+	bans := plugin.DynamicBans()
+	if len(bans) != 1 || bans[0].CIDR != "1.1.1.1/32" || bans[0].Expires.IsZero() {
+		t.Errorf("expected a temporary ban for 1.1.1.1, got %+v", bans)
+	}
+
+	if rr := serve("1.1.1.2", "/cgi-bin/test.cgi"); rr.Header().Get("X-Geoblock-Phase") != PhaseTrapPath {
+		t.Errorf("expected the prefix to trap, got %q", rr.Header().Get("X-Geoblock-Phase"))
+	}
+	if rr := serve("8.8.8.8", "/.env"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected allowedIPBlocks not to be trapped, got %d", rr.Code)
+	}
+	if rr := serve("192.168.1.1", "/.env"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected private IPs not to be trapped, got %d", rr.Code)
+	}
+	if rr := serve("1.1.1.3", "/.envelope"); rr.Code != http.StatusTeapot {
+		t.Errorf("expected only the exact path to trap, got %d", rr.Code)
+	}
+
+	if _, err := newTrapPaths(&Config{TrapPaths: []string{"wp-login.php"}}); err == nil {
+		t.Error("expected a relative path to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseIPNetworks parses a list of CIDRs for the given option. Plain IPs are accepted as single-address networks.
+func parseIPNetworks(option string, entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %w", option, &ErrInvalidCIDR{Value: entry, Err: err})
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsIP reports whether any of the networks contains the IP
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// untrustedPeerIP returns the direct peer IP when RequireRemoteAddrMatch is on and the peer is not a
+// trusted proxy. In that case the IP headers were set by the client itself and must be ignored.
+func (p Plugin) untrustedPeerIP(req *http.Request) (string, bool) {
+	if !p.requireRemoteAddrMatch {
+		return "", false
+	}
+
+	peer := cleanIPAddress(req.RemoteAddr)
+	peerIP := net.ParseIP(peer)
+	if peerIP != nil && containsIP(p.trustedProxies, peerIP) {
+		return "", false
+	}
+	return peer, true
+}
@@ -0,0 +1,77 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireRemoteAddrMatch(t *testing.T) {
+	cfg := &Config{
+		Enabled:                true,
+		DatabaseFilePath:       tinyDbFilePath,
+		AllowedCountries:       []string{"AU"},
+		DisallowedStatusCode:   http.StatusForbidden,
+		IPHeaders:              []string{"x-forwarded-for"},
+		IPHeaderStrategy:       IPHeaderStrategyCheckAll,
+		RequireRemoteAddrMatch: true,
+		TrustedProxies:         []string{"10.0.0.0/8", "192.168.1.10"},
+	}
+
+	handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	plugin := handler.(*Plugin)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantIPs    []string
+		status     int
+	}{
+		{name: "trusted proxy network", remoteAddr: "10.1.2.3:443", xff: "1.1.1.1", wantIPs: []string{"1.1.1.1"}, status: http.StatusTeapot},
+		{name: "trusted single proxy", remoteAddr: "192.168.1.10:443", xff: "8.8.8.8", wantIPs: []string{"8.8.8.8"}, status: http.StatusForbidden},
+		{name: "direct client spoofing allowed country", remoteAddr: "8.8.8.8:51000", xff: "1.1.1.1", wantIPs: []string{"8.8.8.8"}, status: http.StatusForbidden},
+		{name: "untrusted private peer", remoteAddr: "192.168.1.11:443", xff: "1.1.1.1", wantIPs: []string{"192.168.1.11"}, status: http.StatusForbidden},
+		{name: "direct allowed client", remoteAddr: "1.1.1.1:51000", xff: "8.8.8.8", wantIPs: []string{"1.1.1.1"}, status: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.xff)
+
+			ips := plugin.GetRemoteIPs(req)
+			if len(ips) != len(tt.wantIPs) || ips[0] != tt.wantIPs[0] {
+				t.Errorf("expected IPs %v, got %v", tt.wantIPs, ips)
+			}
+
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestParseIPNetworks(t *testing.T) {
+	networks, err := parseIPNetworks("TrustedProxies", []string{"10.0.0.0/8", " 192.168.1.10 ", "2001:db8::1", "2001:db8:1::/48"})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.1.10/32", "2001:db8::1/128", "2001:db8:1::/48"}
+	for i, network := range networks {
+		if network.String() != want[i] {
+			t.Errorf("expected %s, got %s", want[i], network)
+		}
+	}
+
+	if _, err := parseIPNetworks("TrustedProxies", []string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected error for an invalid CIDR")
+	}
+}
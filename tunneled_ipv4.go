@@ -0,0 +1,36 @@
+package traefik_geoblock
+
+import (
+	"net"
+)
+
+var (
+	// sixToFourPrefix is 2002::/16, the 6to4 prefix followed by the IPv4 of the relay-facing host (RFC 3056)
+	sixToFourPrefix = &net.IPNet{IP: net.ParseIP("2002::"), Mask: net.CIDRMask(16, 128)}
+	// teredoPrefix is 2001::/32, whose last 32 bits are the client's IPv4 with every bit inverted (RFC 4380)
+	teredoPrefix = &net.IPNet{IP: net.ParseIP("2001::"), Mask: net.CIDRMask(32, 128)}
+)
+
+// tunneledIPv4 returns the IPv4 embedded in a 6to4 or Teredo address, nil for other addresses.
+// The tunnel prefixes only locate the relays. IP2Location databases already answer with the country of
+// the embedded IPv4, but IP blocks, the private network and bogon checks, IPv4Policy and injected
+// Lookupers would otherwise see the tunnel address. Embedded addresses that are not public unicast (private, loopback...) are ignored: a client could
+// otherwise craft a tunnel address that evaluates as an allowed private network.
+func tunneledIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return nil
+	}
+	var embedded net.IP
+	switch {
+	case sixToFourPrefix.Contains(ip):
+		embedded = net.IPv4(ip[2], ip[3], ip[4], ip[5])
+	case teredoPrefix.Contains(ip):
+		embedded = net.IPv4(^ip[12], ^ip[13], ^ip[14], ^ip[15])
+	default:
+		return nil
+	}
+	if !embedded.IsGlobalUnicast() || embedded.IsPrivate() {
+		return nil
+	}
+	return embedded
+}
@@ -0,0 +1,76 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTunneledIPv4(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"2002:808:808::1", "8.8.8.8"},                      // 6to4
+		{"2002:55d6:8401:1::1", "85.214.132.1"},             // 6to4 with a subnet
+		{"2001:0:4136:e378:8000:63bf:fefe:fefe", "1.1.1.1"}, // Teredo, inverted client address
+		{"2002:a00:1::1", ""},                               // 6to4 of a private address
+		{"2001:0:4136:e378:8000:63bf:80ff:fffe", ""},        // Teredo of 127.0.0.1
+		{"2001:4860::1", ""},                                // Not Teredo, only 2001::/32 is
+		{"8.8.8.8", ""},
+	}
+	for _, tt := range tests {
+		got := tunneledIPv4(net.ParseIP(tt.ip))
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("%s: expected %q, got %v", tt.ip, tt.want, got)
+		}
+	}
+}
+
+func TestDecodeTunneledIPv4(t *testing.T) {
+	newTestPlugin := func(decode bool) *Plugin {
+		cfg := CreateConfig()
+		cfg.Enabled = true
+		cfg.DatabaseFilePath = tinyDbFilePath
+		cfg.AllowedCountries = []string{"US", "AU"}
+		cfg.BlockedIPBlocks = []string{"8.8.4.4/32"}
+		cfg.DecodeTunneledIPv4 = decode
+		plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+		if err != nil {
+			t.Fatalf("expected no error, but got: %v", err)
+		}
+		t.Cleanup(func() { plugin.Close() })
+		return plugin
+	}
+
+	tests := []struct {
+		name   string
+		ip     string
+		decode bool
+		want   int
+	}{
+		{"6to4 decoded", "2002:808:808::1", true, http.StatusTeapot},
+		{"IP blocks see the tunnel address without decoding", "2002:808:404::1", false, http.StatusTeapot},
+		{"Teredo decoded", "2001:0:4136:e378:8000:63bf:fefe:fefe", true, http.StatusTeapot},
+		{"IP blocks apply to the IPv4", "2002:808:404::1", true, http.StatusForbidden},
+		{"private IPv4 not decoded", "2002:a00:1::1", true, http.StatusForbidden},
+	}
+	plugins := map[bool]*Plugin{true: newTestPlugin(true), false: newTestPlugin(false)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			rr := httptest.NewRecorder()
+			plugins[tt.decode].ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	if _, country, phase, _ := plugins[true].CheckAllowed("2002:808:404::1"); country != "US" || phase != PhaseBlockedIPBlock {
+		t.Errorf("expected US and phase %s, got %s and %s", PhaseBlockedIPBlock, country, phase)
+	}
+}
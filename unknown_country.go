@@ -0,0 +1,32 @@
+package traefik_geoblock
+
+import "fmt"
+
+// PhaseUnknownCountry is used when UnknownCountryPolicy decides for an IP the database has no country for
+const PhaseUnknownCountry = "unknown_country"
+
+// UnknownCountryAlias is the country reported for unresolvable IPs with UnknownCountryPolicy "zz",
+// usable in AllowedCountries and BlockedCountries (user-assigned ISO 3166 code for "unknown")
+const UnknownCountryAlias = "ZZ"
+
+// Unknown country policies
+const (
+	UnknownCountryPolicyDefault = ""      // Treat "-" like any other country (lists, then DefaultAllow)
+	UnknownCountryPolicyAllow   = "allow" // Allow unresolvable IPs
+	UnknownCountryPolicyBlock   = "block" // Block unresolvable IPs
+	UnknownCountryPolicyZZ      = "zz"    // Report them as "ZZ" and apply the country lists to that code
+)
+
+// validateUnknownCountryPolicy checks the UnknownCountryPolicy option
+func validateUnknownCountryPolicy(policy string) error {
+	switch policy {
+	case UnknownCountryPolicyDefault, UnknownCountryPolicyAllow, UnknownCountryPolicyBlock, UnknownCountryPolicyZZ:
+		return nil
+	}
+	return fmt.Errorf("invalid UnknownCountryPolicy %q, must be one of: allow, block, zz", policy)
+}
+
+// isUnknownCountry reports whether the database had no country for the IP
+func isUnknownCountry(country string) bool {
+	return country == "" || country == "-"
+}
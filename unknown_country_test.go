@@ -0,0 +1,60 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUnknownCountryPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		allowed     []string
+		blocked     []string
+		defaultOK   bool
+		wantAllowed bool
+		wantCountry string
+		wantPhase   string
+	}{
+		{name: "default keeps DefaultAllow", policy: "", defaultOK: true, wantAllowed: true, wantCountry: "-", wantPhase: PhaseDefaultAllow},
+		{name: "allow", policy: UnknownCountryPolicyAllow, wantAllowed: true, wantCountry: "-", wantPhase: PhaseUnknownCountry},
+		{name: "block", policy: UnknownCountryPolicyBlock, defaultOK: true, wantAllowed: false, wantCountry: "-", wantPhase: PhaseUnknownCountry},
+		{name: "zz in allowed list", policy: UnknownCountryPolicyZZ, allowed: []string{"ZZ"}, wantAllowed: true, wantCountry: "ZZ", wantPhase: PhaseAllowedCountry},
+		{name: "zz in blocked list", policy: UnknownCountryPolicyZZ, blocked: []string{"ZZ"}, defaultOK: true, wantAllowed: false, wantCountry: "ZZ", wantPhase: PhaseBlockedCountry},
+		{name: "zz unlisted", policy: UnknownCountryPolicyZZ, defaultOK: true, wantAllowed: true, wantCountry: "ZZ", wantPhase: PhaseDefaultAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.UnknownCountryPolicy = tt.policy
+			cfg.AllowedCountries = tt.allowed
+			cfg.BlockedCountries = tt.blocked
+			cfg.DefaultAllow = tt.defaultOK
+
+			handler, err := New(context.TODO(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("expected no error, but got: %v", err)
+			}
+
+			// 9.9.9.9 has no country in the tiny database
+			allowed, country, phase, err := handler.(*Plugin).CheckAllowed("9.9.9.9")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if allowed != tt.wantAllowed || country != tt.wantCountry || phase != tt.wantPhase {
+				t.Errorf("expected %v/%s/%s, got %v/%s/%s", tt.wantAllowed, tt.wantCountry, tt.wantPhase, allowed, country, phase)
+			}
+		})
+	}
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.UnknownCountryPolicy = "ignore"
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Error("expected error for an invalid UnknownCountryPolicy")
+	}
+}
@@ -0,0 +1,101 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// updateWindowTick is how often the update scheduler checks whether it is inside DatabaseAutoUpdateWindow,
+// and so the shortest window that can't be missed
+const updateWindowTick = 10 * time.Minute
+
+// updateWindow is the daily time range downloads and hot swaps are limited to. It can span midnight.
+type updateWindow struct {
+	start    time.Duration // Offset from midnight
+	end      time.Duration
+	location *time.Location
+}
+
+// parseUpdateWindow parses "HH:MM-HH:MM" with an optional time zone, e.g. "02:00-05:00 UTC" or
+// "23:00-01:00 Europe/Paris". Returns nil for an empty value, updates then run whenever they are due.
+func parseUpdateWindow(value string) (*updateWindow, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q, expected \"HH:MM-HH:MM [time zone]\"", value)
+	}
+	window := &updateWindow{location: time.UTC}
+	if len(fields) == 2 {
+		location, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q: unknown time zone %q", value, fields[1])
+		}
+		window.location = location
+	}
+
+	from, to, found := strings.Cut(fields[0], "-")
+	if !found {
+		return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q, expected \"HH:MM-HH:MM [time zone]\"", value)
+	}
+	var err error
+	if window.start, err = parseTimeOfDay(from); err != nil {
+		return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q: %w", value, err)
+	}
+	if window.end, err = parseTimeOfDay(to); err != nil {
+		return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q: %w", value, err)
+	}
+	if window.start == window.end {
+		return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q: the window starts and ends at the same time", value)
+	}
+	if window.length() < updateWindowTick {
+		return nil, fmt.Errorf("invalid DatabaseAutoUpdateWindow %q: the window must last at least %s", value, updateWindowTick)
+	}
+	return window, nil
+}
+
+// parseTimeOfDay parses "HH:MM" into an offset from midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// length returns how long the window lasts, windows ending before they start span midnight
+func (w *updateWindow) length() time.Duration {
+	if w.end > w.start {
+		return w.end - w.start
+	}
+	return 24*time.Hour - w.start + w.end
+}
+
+// opened returns when the window containing now opened, and false when now is outside the window
+func (w *updateWindow) opened(now time.Time) (time.Time, bool) {
+	local := now.In(w.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, w.location)
+	offset := local.Sub(midnight)
+
+	switch {
+	case w.start < w.end && offset >= w.start && offset < w.end:
+		return midnight.Add(w.start), true
+	case w.start > w.end && offset >= w.start:
+		return midnight.Add(w.start), true
+	case w.start > w.end && offset < w.end:
+		return midnight.AddDate(0, 0, -1).Add(w.start), true
+	}
+	return time.Time{}, false
+}
+
+// String returns the window as configured, for logs
+func (w *updateWindow) String() string {
+	format := func(offset time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+	}
+	return format(w.start) + "-" + format(w.end) + " " + w.location.String()
+}
@@ -0,0 +1,101 @@
+package traefik_geoblock
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateWindow(t *testing.T) {
+	for _, invalid := range []string{"02:00", "2am-5am", "02:00-05:00 Mars/Olympus", "02:00-02:00", "02:00-02:05", "02:00-05:00 UTC extra"} {
+		if _, err := parseUpdateWindow(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+	if window, err := parseUpdateWindow(""); window != nil || err != nil {
+		t.Errorf("expected no window, got %v, %v", window, err)
+	}
+
+	day := func(hour, minute int) time.Time { return time.Date(2025, 6, 10, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window string
+		now    time.Time
+		opened time.Time // Zero when outside
+	}{
+		{"02:00-05:00 UTC", day(1, 59), time.Time{}},
+		{"02:00-05:00", day(2, 0), day(2, 0)},
+		{"02:00-05:00 UTC", day(4, 59), day(2, 0)},
+		{"02:00-05:00 UTC", day(5, 0), time.Time{}},
+		{"23:00-01:00 UTC", day(23, 30), day(23, 0)},
+		{"23:00-01:00 UTC", day(0, 30), day(23, 0).AddDate(0, 0, -1)},
+		{"23:00-01:00 UTC", day(12, 0), time.Time{}},
+		{"02:00-05:00 Etc/GMT-2", day(1, 0), day(0, 0)}, // 03:00 at UTC+2, opened at 00:00 UTC
+	}
+	for _, tt := range tests {
+		window, err := parseUpdateWindow(tt.window)
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got: %v", tt.window, err)
+		}
+		opened, inside := window.opened(tt.now)
+		if inside != !tt.opened.IsZero() || !opened.Equal(tt.opened) {
+			t.Errorf("%s at %s: got %s, %v, want %s", tt.window, tt.now.Format("15:04"), opened, inside, tt.opened)
+		}
+	}
+}
+
+func TestDatabaseFactory_UpdateWindow(t *testing.T) {
+	// The tiny database is from 2025-04-01, so every check finds it old
+	clock := newFakeClock(time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC))
+	logs := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	updateDir := t.TempDir()
+	if err := copyFile(tinyDbFilePath, filepath.Join(updateDir, "20250601_IP2LOCATION-LITE-DB1.IPV6.BIN"), true); err != nil {
+		t.Fatal(err)
+	}
+	factory, err := newDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:         tinyDbFilePath,
+		DatabaseAutoUpdate:       true,
+		DatabaseAutoUpdateDir:    updateDir,
+		NoLocalCopy:              true,
+		DatabaseAutoUpdateWindow: "02:00-03:00 UTC",
+	}, logger, clock)
+	if err != nil {
+		t.Fatalf("failed to create factory: %v", err)
+	}
+	defer factory.Close()
+	checks := func() int { return strings.Count(logs.String(), "checkAndUpdate: database is old") }
+
+	// Nothing happens at startup or during the day, outside the window
+	clock.Advance(12 * time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	if n := checks(); n != 0 {
+		t.Fatalf("expected no update check outside the window, got %d", n)
+	}
+
+	// One check per window, whatever the number of ticks inside it
+	clock.Advance(2 * time.Hour)
+	waitFor(t, "update check in the window", func() bool { return checks() == 1 })
+	for i := 0; i < 5; i++ {
+		clock.Advance(updateWindowTick)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := checks(); n != 1 {
+		t.Errorf("expected one update check in the window, got %d", n)
+	}
+
+	clock.Advance(24 * time.Hour)
+	waitFor(t, "update check in the next window", func() bool { return checks() == 2 })
+
+	if _, err := newDatabaseFactory(&DatabaseConfig{
+		DatabaseFilePath:         tinyDbFilePath,
+		DatabaseAutoUpdate:       true,
+		DatabaseAutoUpdateDir:    updateDir,
+		NoLocalCopy:              true,
+		DatabaseAutoUpdateWindow: "tonight",
+	}, logger, clock); err == nil {
+		t.Error("expected an error for an invalid window")
+	}
+}
@@ -0,0 +1,128 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PhaseBlockedUsageType is used when the usage type of the IP is in BlockedUsageTypes
+const PhaseBlockedUsageType = "blocked_usage_type"
+
+// ip2locationUnavailable starts the value the ip2location library returns for columns the database lacks
+const ip2locationUnavailable = "This parameter is unavailable"
+
+// GeoRecord is the lookup result for an IP. Commercial IP2Location editions fill more fields
+// (ZIP code and time zone from DB9/DB11, ISP and domain from DB8, usage type from DB23 to DB26),
+// fields the database does not have are empty.
+type GeoRecord struct {
+	Country   string // ISO 3166-1 alpha-2, "-" when unknown
+	ZipCode   string
+	TimeZone  string // UTC offset, e.g. "+02:00"
+	ISP       string
+	Domain    string
+	UsageType string // e.g. "DCH" for data centers and hosting, "ISP/MOB" for mobile ISPs
+}
+
+// RecordLookuper is a Lookuper that also returns the commercial fields of an IP.
+// DatabaseWrapper implements it; injected Lookupers need it for BlockedUsageTypes.
+type RecordLookuper interface {
+	Lookuper
+	LookupRecord(ip string) (GeoRecord, error)
+}
+
+// LookupRecord returns every field the database has for the IP
+func (dw *DatabaseWrapper) LookupRecord(ip string) (GeoRecord, error) {
+	db := dw.current().db
+	if db == nil {
+		return GeoRecord{}, errDatabaseClosed
+	}
+	ip2locationGlobals.RLock()
+	record, err := db.Get_all(ip)
+	ip2locationGlobals.RUnlock()
+	if err != nil {
+		return GeoRecord{}, err
+	}
+
+	field := func(value string) string {
+		if strings.HasPrefix(value, ip2locationUnavailable) {
+			return ""
+		}
+		return value
+	}
+	return GeoRecord{
+		Country:   field(record.Country_short),
+		ZipCode:   field(record.Zipcode),
+		TimeZone:  field(record.Timezone),
+		ISP:       field(record.Isp),
+		Domain:    field(record.Domain),
+		UsageType: field(record.Usagetype),
+	}, nil
+}
+
+// usageTypeRules blocks IPs by their IP2Location usage type
+type usageTypeRules struct {
+	records RecordLookuper
+	blocked map[string]struct{}
+}
+
+// newUsageTypeRules validates BlockedUsageTypes against the resolver. Returns nil when none are configured.
+func newUsageTypeRules(cfg *Config, lookuper Lookuper, db *DatabaseWrapper) (*usageTypeRules, error) {
+	if len(cfg.BlockedUsageTypes) == 0 {
+		return nil, nil
+	}
+
+	records, ok := lookuper.(RecordLookuper)
+	if !ok {
+		return nil, fmt.Errorf("BlockedUsageTypes needs a Lookuper implementing RecordLookuper")
+	}
+	// Checked once here, the LITE editions would otherwise silently never match
+	if db != nil {
+		if version := db.GetVersion(); version != nil && (version.Type < 23 || version.Type > 26) {
+			return nil, fmt.Errorf("BlockedUsageTypes needs a database with usage types (DB23 to DB26), %s is DB%d", db.GetPath(), version.Type)
+		}
+	}
+
+	blocked := make(map[string]struct{}, len(cfg.BlockedUsageTypes))
+	for _, usageType := range cfg.BlockedUsageTypes {
+		usageType = strings.ToUpper(strings.TrimSpace(usageType))
+		if usageType == "" {
+			return nil, fmt.Errorf("BlockedUsageTypes contains an empty usage type")
+		}
+		blocked[usageType] = struct{}{}
+	}
+	return &usageTypeRules{records: records, blocked: blocked}, nil
+}
+
+// check returns the usage type of the IP and whether it is blocked. Combined types such as "ISP/MOB"
+// are blocked when any part is.
+func (r *usageTypeRules) check(ip string) (string, bool, error) {
+	record, err := r.records.LookupRecord(ip)
+	if err != nil {
+		return "", false, err
+	}
+	for _, part := range strings.Split(record.UsageType, "/") {
+		if _, blocked := r.blocked[part]; blocked {
+			return record.UsageType, true, nil
+		}
+	}
+	return record.UsageType, false, nil
+}
+
+// LookupRecord returns the database fields of an IP, with the country after RangeOverrides.
+// Only Country is set when the resolver is a plain Lookuper.
+func (p Plugin) LookupRecord(ip string) (GeoRecord, error) {
+	country, err := p.Lookup(ip)
+	if err != nil {
+		return GeoRecord{}, err
+	}
+	records, ok := p.lookuper.(RecordLookuper)
+	if !ok {
+		return GeoRecord{Country: country}, nil
+	}
+	record, err := records.LookupRecord(ip)
+	if err != nil {
+		return GeoRecord{}, err
+	}
+	record.Country = country
+	return record, nil
+}
@@ -0,0 +1,100 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// usageTypeLookuper resolves every IP to US with a fixed usage type per IP
+type usageTypeLookuper map[string]string
+
+func (l usageTypeLookuper) LookupCountry(ip string) (string, error) {
+	return "US", nil
+}
+
+func (l usageTypeLookuper) LookupRecord(ip string) (GeoRecord, error) {
+	return GeoRecord{Country: "US", UsageType: l[ip], ISP: "Example ISP"}, nil
+}
+
+func TestBlockedUsageTypes(t *testing.T) {
+	lookuper := usageTypeLookuper{
+		"203.0.113.1": "DCH",
+		"203.0.113.2": "ISP/MOB",
+		"203.0.113.3": "ISP",
+		"203.0.113.4": "DCH",
+	}
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DefaultAllow = true
+	cfg.BlockedUsageTypes = []string{"dch", "MOB"}
+	cfg.AllowedIPBlocks = []string{"203.0.113.4/32"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, lookuper)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		ip          string
+		wantAllowed bool
+		wantPhase   string
+	}{
+		{"203.0.113.1", false, PhaseBlockedUsageType},
+		{"203.0.113.2", false, PhaseBlockedUsageType},
+		{"203.0.113.3", true, PhaseDefaultAllow},
+		{"203.0.113.4", true, PhaseAllowedIPBlock},
+	}
+	for _, tt := range tests {
+		allowed, country, phase, err := plugin.CheckAllowed(tt.ip)
+		if err != nil || allowed != tt.wantAllowed || phase != tt.wantPhase || country != "US" {
+			t.Errorf("%s: expected %v/%s, got %v/%s/%s (err: %v)", tt.ip, tt.wantAllowed, tt.wantPhase, allowed, phase, country, err)
+		}
+	}
+
+	record, err := plugin.LookupRecord("203.0.113.2")
+	if err != nil || record.UsageType != "ISP/MOB" || record.ISP != "Example ISP" {
+		t.Errorf("unexpected record %+v (err: %v)", record, err)
+	}
+}
+
+func TestBlockedUsageTypes_Validation(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.BlockedUsageTypes = []string{"DCH"}
+	if _, err := New(context.TODO(), &noopHandler{}, cfg, pluginName); err == nil || !strings.Contains(err.Error(), "DB23 to DB26") {
+		t.Errorf("expected the DB1 database to be rejected, got: %v", err)
+	}
+
+	if _, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, staticLookuper{}); err == nil || !strings.Contains(err.Error(), "RecordLookuper") {
+		t.Errorf("expected a plain Lookuper to be rejected, got: %v", err)
+	}
+}
+
+func TestDatabaseWrapper_LookupRecord(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	// DB1 only has countries, the other columns must not leak the library's placeholder text
+	record, err := plugin.LookupRecord("8.8.8.8")
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if record != (GeoRecord{Country: "US"}) {
+		t.Errorf("expected only the country, got %+v", record)
+	}
+}
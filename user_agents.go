@@ -0,0 +1,88 @@
+package traefik_geoblock
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PhaseBlockedUserAgent is used when the User-Agent matches a UAPatternsByCountry pattern of the request's country
+const PhaseBlockedUserAgent = "blocked_user_agent"
+
+// userAgentRules blocks User-Agents, e.g. scripted clients, only from some countries
+type userAgentRules struct {
+	patterns map[string][]*regexp.Regexp // Country code to patterns
+}
+
+// newUserAgentRules compiles UAPatternsByCountry. Keys are country codes (alpha-2 or numeric) or groups
+// such as "EU"; a country listed directly and through a group gets both pattern lists.
+// Returns nil when no patterns are configured.
+func newUserAgentRules(cfg *Config) (*userAgentRules, error) {
+	if len(cfg.UAPatternsByCountry) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(cfg.UAPatternsByCountry))
+	for key := range cfg.UAPatternsByCountry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	patterns := make(map[string][]*regexp.Regexp)
+	for _, key := range keys {
+		if len(cfg.UAPatternsByCountry[key]) == 0 {
+			return nil, fmt.Errorf("UAPatternsByCountry[%s] has no patterns", key)
+		}
+		compiled := make([]*regexp.Regexp, 0, len(cfg.UAPatternsByCountry[key]))
+		for _, pattern := range cfg.UAPatternsByCountry[key] {
+			if strings.TrimSpace(pattern) == "" {
+				return nil, fmt.Errorf("UAPatternsByCountry[%s] contains an empty pattern", key)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UAPatternsByCountry[%s] pattern %q: %w", key, pattern, err)
+			}
+			compiled = append(compiled, re)
+		}
+
+		if members, isGroup := countryGroups[strings.ToUpper(key)]; isGroup {
+			for _, m := range members {
+				patterns[m] = append(patterns[m], compiled...)
+			}
+			continue
+		}
+		code, err := countryCode(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UAPatternsByCountry entry %q: %w", key, err)
+		}
+		code = strings.ToUpper(strings.TrimSpace(code))
+		patterns[code] = append(patterns[code], compiled...)
+	}
+	return &userAgentRules{patterns: patterns}, nil
+}
+
+// match returns the pattern the User-Agent matches for the country, if any
+func (r *userAgentRules) match(req *http.Request, country string) (string, bool) {
+	patterns, ok := r.patterns[country]
+	if !ok {
+		return "", false
+	}
+	userAgent := req.UserAgent()
+	for _, re := range patterns {
+		if re.MatchString(userAgent) {
+			return re.String(), true
+		}
+	}
+	return "", false
+}
+
+// blocks returns the pattern that blocks an allowed request. Requests allowed by IP (private ranges and
+// AllowedIPBlocks) are left alone, like the other country based checks.
+func (r *userAgentRules) blocks(req *http.Request, decision ipDecision) (string, bool) {
+	if decision.blocked || decision.phase == PhaseAllowPrivate || decision.phase == PhaseAllowedIPBlock {
+		return "", false
+	}
+	return r.match(req, decision.country)
+}
@@ -0,0 +1,85 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUAPatternsByCountry(t *testing.T) {
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"US", "DE", "AU"}
+	cfg.AllowedIPBlocks = []string{"8.8.4.0/24"}
+	cfg.AllowPrivate = true
+	cfg.UAPatternsByCountry = map[string][]string{
+		"US":  {"^curl/", "(?i)python-requests"},
+		"EU":  {"^Wget/"},
+		"036": {"^Go-http-client/"}, // AU
+	}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		want      int
+	}{
+		{"browser", "8.8.8.8", "Mozilla/5.0 (X11; Linux x86_64)", http.StatusTeapot},
+		{"curl", "8.8.8.8", "curl/8.5.0", http.StatusForbidden},
+		{"case insensitive pattern", "8.8.8.8", "Python-Requests/2.31", http.StatusForbidden},
+		{"pattern of another country", "85.214.132.1", "curl/8.5.0", http.StatusTeapot},
+		{"group", "85.214.132.1", "Wget/1.21", http.StatusForbidden},
+		{"numeric code", "1.1.1.1", "Go-http-client/1.1", http.StatusForbidden},
+		{"allowed IP block", "8.8.4.4", "curl/8.5.0", http.StatusTeapot},
+		{"private network", "10.0.0.1", "curl/8.5.0", http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+	if phases := plugin.Stats().Phases; phases[PhaseBlockedUserAgent] != 4 {
+		t.Errorf("expected 4 requests with phase %s, got %v", PhaseBlockedUserAgent, phases)
+	}
+}
+
+func TestUAPatternsByCountryValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns map[string][]string
+		wantErr  string
+	}{
+		{"invalid pattern", map[string][]string{"US": {"curl/("}}, "invalid UAPatternsByCountry[US] pattern"},
+		{"no patterns", map[string][]string{"US": {}}, "has no patterns"},
+		{"empty pattern", map[string][]string{"US": {" "}}, "empty pattern"},
+		{"unknown numeric code", map[string][]string{"999": {"^curl/"}}, "unknown ISO 3166-1 numeric country code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateConfig()
+			cfg.Enabled = true
+			cfg.DatabaseFilePath = tinyDbFilePath
+			cfg.UAPatternsByCountry = tt.patterns
+			_, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
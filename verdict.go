@@ -0,0 +1,89 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Verdicts written to the VerdictHeader
+const (
+	VerdictAllowed   = "allowed"   // Request passed the checks
+	VerdictBlocked   = "blocked"   // Request was blocked
+	VerdictBypassed  = "bypassed"  // Blocking was skipped (bypass header or ignored verb)
+	VerdictMonitored = "monitored" // Request would have been blocked but was let through (rollout, grace, address family)
+)
+
+// verdictToken formats the verdict as "allowed;country=US;phase=allowed_country"
+func verdictToken(verdict string, decision ipDecision) string {
+	var token strings.Builder
+	token.WriteString(verdict)
+	if decision.country != "" {
+		token.WriteString(";country=")
+		token.WriteString(decision.country)
+	}
+	if decision.phase != "" {
+		token.WriteString(";phase=")
+		token.WriteString(decision.phase)
+	}
+	return token.String()
+}
+
+// verdictOf returns the verdict of a request
+func verdictOf(decision ipDecision, blocked, skipBlocking bool) string {
+	switch {
+	case blocked:
+		return VerdictBlocked
+	case decision.blocked:
+		return VerdictMonitored
+	case skipBlocking:
+		return VerdictBypassed
+	}
+	return VerdictAllowed
+}
+
+// appendVerdict appends the verdict to the request's VerdictHeader, so the backend and access logs see it.
+// Values are appended rather than replaced, so several chained middlewares each leave their token.
+func (p Plugin) appendVerdict(req *http.Request, decision ipDecision, blocked, skipBlocking bool) {
+	if p.verdictHeader == "" {
+		return
+	}
+	req.Header.Add(p.verdictHeader, verdictToken(verdictOf(decision, blocked, skipBlocking), decision))
+}
+
+// RequestVerdict is the outcome of the geoblock checks for a request
+type RequestVerdict struct {
+	Verdict string // One of the Verdict constants
+	Country string
+	Phase   string
+}
+
+// requestVerdictKey is the context key of the RequestVerdict
+type requestVerdictKey struct{}
+
+// RequestVerdictFromContext returns the verdict stored by a middleware with AccessLogHeaderPrefix set.
+// With chained middlewares, the one closest to the handler wins.
+func RequestVerdictFromContext(ctx context.Context) (RequestVerdict, bool) {
+	verdict, ok := ctx.Value(requestVerdictKey{}).(RequestVerdict)
+	return verdict, ok
+}
+
+// withAccessLogFields sets one request header per field (<prefix>Country, <prefix>Phase, <prefix>Verdict), which
+// Traefik's access log keeps with accesslog.fields.headers.names, and stores the verdict in the request context.
+// Headers are replaced, so values sent by the client never reach the logs. Returns the request unchanged when
+// AccessLogHeaderPrefix is empty.
+func (p Plugin) withAccessLogFields(req *http.Request, decision ipDecision, blocked, skipBlocking bool) *http.Request {
+	if p.accessLogHeaderPrefix == "" {
+		return req
+	}
+
+	verdict := RequestVerdict{Verdict: verdictOf(decision, blocked, skipBlocking), Country: decision.country, Phase: decision.phase}
+	for name, value := range map[string]string{"Country": verdict.Country, "Phase": verdict.Phase, "Verdict": verdict.Verdict} {
+		if value == "" {
+			req.Header.Del(p.accessLogHeaderPrefix + name)
+			continue
+		}
+		req.Header.Set(p.accessLogHeaderPrefix+name, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), requestVerdictKey{}, verdict))
+}
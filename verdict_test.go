@@ -0,0 +1,113 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerdictHeader(t *testing.T) {
+	var seen []string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		seen = req.Header.Values("X-Geoblock-Verdict")
+	})
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.IPHeaders = []string{"x-real-ip"}
+	cfg.BypassHeaders = map[string]string{"X-Bypass": "yes"}
+	cfg.VerdictHeader = "X-Geoblock-Verdict"
+
+	handler, err := New(context.TODO(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ip      string
+		bypass  bool
+		prior   string
+		want    []string
+		reached bool
+	}{
+		{name: "allowed", ip: "1.1.1.1", want: []string{"allowed;country=AU;phase=allowed_country"}, reached: true},
+		{name: "private", ip: "10.0.0.1", want: []string{"blocked;country=PRIVATE;phase=allow_private"}},
+		{name: "blocked", ip: "8.8.8.8", want: []string{"blocked;country=US;phase=default_allow"}},
+		{name: "bypassed", ip: "8.8.8.8", bypass: true, want: []string{"bypassed;country=US;phase=default_allow"}, reached: true},
+		{name: "appended", ip: "1.1.1.1", prior: "allowed;country=AU", want: []string{"allowed;country=AU", "allowed;country=AU;phase=allowed_country"}, reached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			if tt.bypass {
+				req.Header.Set("X-Bypass", "yes")
+			}
+			if tt.prior != "" {
+				req.Header.Set("X-Geoblock-Verdict", tt.prior)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			// Blocked requests carry the verdict on the request for access logs
+			got := req.Header.Values("X-Geoblock-Verdict")
+			if tt.reached && len(seen) != len(got) {
+				t.Errorf("expected backend to see %v, got %v", got, seen)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessLogFields(t *testing.T) {
+	var fromContext RequestVerdict
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fromContext, _ = RequestVerdictFromContext(req.Context())
+	})
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.AllowedCountries = []string{"AU"}
+	cfg.IPHeaders = []string{"x-real-ip"}
+	cfg.AccessLogHeaderPrefix = "X-Geoblock-"
+
+	handler, err := New(context.TODO(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+
+	// Blocked: the headers stay on the request Traefik's access log reads
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	req.Header.Set("X-Geoblock-Verdict", "allowed")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got := req.Header.Get("X-Geoblock-Verdict"); got != VerdictBlocked {
+		t.Errorf("expected the client value to be replaced by %q, got %q", VerdictBlocked, got)
+	}
+	if req.Header.Get("X-Geoblock-Country") != "US" || req.Header.Get("X-Geoblock-Phase") != PhaseDefaultAllow {
+		t.Errorf("expected country and phase headers, got %v", req.Header)
+	}
+
+	// Allowed: the backend finds the verdict in the context
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	want := RequestVerdict{Verdict: VerdictAllowed, Country: "AU", Phase: PhaseAllowedCountry}
+	if fromContext != want {
+		t.Errorf("expected %+v in the context, got %+v", want, fromContext)
+	}
+}
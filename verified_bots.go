@@ -0,0 +1,167 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PhaseVerifiedBot is used when a verified crawler is let through a country block
+const PhaseVerifiedBot = "verified_bot"
+
+// maxVerifiedBotCacheEntries bounds the verification cache, it is flushed when full
+const maxVerifiedBotCacheEntries = 10000
+
+// knownBot describes how a crawler identifies itself and which reverse DNS names its operator uses
+type knownBot struct {
+	userAgent string   // Case-insensitive User-Agent substring
+	domains   []string // Reverse DNS name suffixes published by the operator
+}
+
+// knownBots are the crawlers VerifiedBots can name, as documented by their operators
+var knownBots = map[string]knownBot{
+	"googlebot":   {userAgent: "googlebot", domains: []string{".googlebot.com", ".google.com"}},
+	"bingbot":     {userAgent: "bingbot", domains: []string{".search.msn.com"}},
+	"applebot":    {userAgent: "applebot", domains: []string{".applebot.apple.com"}},
+	"yandexbot":   {userAgent: "yandexbot", domains: []string{".yandex.ru", ".yandex.net", ".yandex.com"}},
+	"baiduspider": {userAgent: "baiduspider", domains: []string{".crawl.baidu.com", ".crawl.baidu.jp"}},
+}
+
+// verifiedBotEntry is a cached verification result
+type verifiedBotEntry struct {
+	verified bool
+	expires  time.Time
+}
+
+// verifiedBots exempts crawlers from country blocks once their IP passes reverse DNS and forward confirmation
+type verifiedBots struct {
+	bots       map[string]knownBot
+	timeout    time.Duration
+	cacheTTL   time.Duration
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu         *sync.Mutex
+	cache      map[string]verifiedBotEntry
+	maxEntries int // Cache capacity, maxVerifiedBotCacheEntries unless shrunk by MemoryBudgetMB
+}
+
+// newVerifiedBots validates VerifiedBots. Returns nil when no bots are configured.
+func newVerifiedBots(cfg *Config) (*verifiedBots, error) {
+	if len(cfg.VerifiedBots) == 0 {
+		return nil, nil
+	}
+	if cfg.VerifiedBotsTimeoutMs <= 0 {
+		return nil, fmt.Errorf("VerifiedBotsTimeoutMs must be positive, got %d", cfg.VerifiedBotsTimeoutMs)
+	}
+	if cfg.VerifiedBotsCacheSeconds < 0 {
+		return nil, fmt.Errorf("VerifiedBotsCacheSeconds can't be negative, got %d", cfg.VerifiedBotsCacheSeconds)
+	}
+
+	bots := make(map[string]knownBot, len(cfg.VerifiedBots))
+	for _, name := range cfg.VerifiedBots {
+		name = strings.ToLower(strings.TrimSpace(name))
+		bot, known := knownBots[name]
+		if !known {
+			return nil, fmt.Errorf("unknown VerifiedBots entry %q, must be one of: applebot, baiduspider, bingbot, googlebot, yandexbot", name)
+		}
+		bots[name] = bot
+	}
+
+	return &verifiedBots{
+		bots:       bots,
+		timeout:    time.Duration(cfg.VerifiedBotsTimeoutMs) * time.Millisecond,
+		cacheTTL:   time.Duration(cfg.VerifiedBotsCacheSeconds) * time.Second,
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		lookupHost: net.DefaultResolver.LookupHost,
+		mu:         &sync.Mutex{},
+		cache:      make(map[string]verifiedBotEntry),
+		maxEntries: maxVerifiedBotCacheEntries,
+	}, nil
+}
+
+// exempts reports whether the decision is a country block on a request from a verified crawler
+func (v *verifiedBots) exempts(req *http.Request, decision ipDecision, logger *slog.Logger) (string, bool) {
+	if !decision.blocked || decision.ip == "" || !isCountryBlockPhase(decision.phase) {
+		return "", false
+	}
+
+	userAgent := strings.ToLower(req.UserAgent())
+	for name, bot := range v.bots {
+		if !strings.Contains(userAgent, bot.userAgent) {
+			continue
+		}
+		if v.verify(req.Context(), name, bot, decision.ip, logger) {
+			return name, true
+		}
+		// Logged so impersonation attempts are visible
+		logger.Debug("crawler User-Agent failed verification", "bot", name, "ip", decision.ip, "user_agent", req.UserAgent())
+		return "", false
+	}
+	return "", false
+}
+
+// verify checks that the IP has a reverse DNS name of the operator which resolves back to the IP
+func (v *verifiedBots) verify(ctx context.Context, name string, bot knownBot, ip string, logger *slog.Logger) bool {
+	key := name + "|" + ip
+	v.mu.Lock()
+	entry, cached := v.cache[key]
+	v.mu.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.verified
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	verified := false
+	hosts, err := v.lookupAddr(ctx, ip)
+	if err != nil {
+		logger.Debug("crawler reverse DNS lookup failed", "bot", name, "ip", ip, "error", err)
+	}
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if !hasAnySuffix(host, bot.domains) {
+			continue
+		}
+		addrs, err := v.lookupHost(ctx, host)
+		if err != nil {
+			logger.Debug("crawler forward DNS lookup failed", "bot", name, "host", host, "error", err)
+			continue
+		}
+		for _, addr := range addrs {
+			if net.ParseIP(addr).Equal(net.ParseIP(ip)) {
+				verified = true
+			}
+		}
+		if verified {
+			break
+		}
+	}
+
+	// Timeouts are not cached, the next request tries again
+	if ctx.Err() == nil && v.cacheTTL > 0 {
+		v.mu.Lock()
+		if len(v.cache) >= v.maxEntries {
+			v.cache = make(map[string]verifiedBotEntry)
+		}
+		v.cache[key] = verifiedBotEntry{verified: verified, expires: time.Now().Add(v.cacheTTL)}
+		v.mu.Unlock()
+	}
+	return verified
+}
+
+// hasAnySuffix reports whether s ends with one of the suffixes
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package traefik_geoblock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifiedBots(t *testing.T) {
+	CleanupFactories()
+	defer CleanupFactories()
+
+	cfg := CreateConfig()
+	cfg.Enabled = true
+	cfg.DatabaseFilePath = tinyDbFilePath
+	cfg.DefaultAllow = true
+	cfg.BlockedCountries = []string{"US"}
+	cfg.BlockedIPBlocks = []string{"8.8.4.8/32"}
+	cfg.VerifiedBots = []string{"Googlebot"}
+
+	plugin, err := newPlugin(context.TODO(), &noopHandler{}, cfg, pluginName, nil)
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	defer plugin.Close()
+
+	reverse := map[string][]string{
+		"8.8.4.4": {"crawl-8-8-4-4.googlebot.com."},
+		"8.8.8.8": {"crawl.googlebot.com.evil.example."},
+		"8.8.4.5": {"crawl-8-8-4-5.googlebot.com."}, // Forward lookup points elsewhere
+		"8.8.4.8": {"crawl-8-8-4-8.googlebot.com."},
+	}
+	forward := map[string][]string{
+		"crawl-8-8-4-4.googlebot.com": {"8.8.4.4"},
+		"crawl-8-8-4-5.googlebot.com": {"8.8.4.4"},
+		"crawl-8-8-4-8.googlebot.com": {"8.8.4.8"},
+	}
+	lookups := 0
+	plugin.verifiedBots.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		if hosts, ok := reverse[addr]; ok {
+			return hosts, nil
+		}
+		return nil, errors.New("no PTR record")
+	}
+	plugin.verifiedBots.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return forward[host], nil
+	}
+
+	const googlebotUA = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		want      int
+	}{
+		{"verified crawler", "8.8.4.4", googlebotUA, http.StatusTeapot},
+		{"browser from the same IP", "8.8.4.4", "Mozilla/5.0", http.StatusForbidden},
+		{"spoofed reverse DNS", "8.8.8.8", googlebotUA, http.StatusForbidden},
+		{"forward lookup mismatch", "8.8.4.5", googlebotUA, http.StatusForbidden},
+		{"blocked IP block still applies", "8.8.4.8", googlebotUA, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-IP", tt.ip)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+			plugin.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rr.Code)
+			}
+		})
+	}
+
+	// The verification of 8.8.4.4 was cached
+	before := lookups
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-IP", "8.8.4.4")
+	req.Header.Set("User-Agent", googlebotUA)
+	plugin.ServeHTTP(httptest.NewRecorder(), req)
+	if lookups != before {
+		t.Error("expected the cached verification to be reused")
+	}
+
+	if _, err := newVerifiedBots(&Config{VerifiedBots: []string{"examplebot"}, VerifiedBotsTimeoutMs: 100}); err == nil {
+		t.Error("expected an unknown crawler to be rejected")
+	}
+}
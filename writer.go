@@ -14,9 +14,16 @@ type bufferedFileWriter struct {
 	maxSize   int
 	timeout   time.Duration
 	lastFlush time.Time
+	clock     Clock
+	done      chan struct{} // Closed by Close to stop the flush timer
 }
 
 func newBufferedFileWriter(path string, maxSize int, timeout time.Duration) (*bufferedFileWriter, error) {
+	return newBufferedFileWriterWithClock(path, maxSize, timeout, systemClock{})
+}
+
+// newBufferedFileWriterWithClock creates a writer whose timed flushes follow clock
+func newBufferedFileWriterWithClock(path string, maxSize int, timeout time.Duration, clock Clock) (*bufferedFileWriter, error) {
 	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
@@ -28,11 +35,13 @@ func newBufferedFileWriter(path string, maxSize int, timeout time.Duration) (*bu
 		buffer:    make([]byte, 0, maxSize),
 		maxSize:   maxSize,
 		timeout:   timeout,
-		lastFlush: time.Now(),
+		lastFlush: clock.Now(),
+		clock:     clock,
+		done:      make(chan struct{}),
 	}
 
 	// Start background flush timer
-	go w.flushTimer()
+	go w.flushTimer(clock.NewTicker(timeout))
 
 	return w, nil
 }
@@ -56,19 +65,36 @@ func (w *bufferedFileWriter) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+
 	if err := w.flushLocked(); err != nil {
 		return err
 	}
 	return w.file.Close()
 }
 
-func (w *bufferedFileWriter) flushTimer() {
-	ticker := time.NewTicker(w.timeout)
+// flush writes the buffered bytes without closing the file
+func (w *bufferedFileWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked()
+}
+
+func (w *bufferedFileWriter) flushTimer(ticker Ticker) {
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C():
+		case <-w.done:
+			return
+		}
 		w.mu.Lock()
-		if time.Since(w.lastFlush) >= w.timeout && len(w.buffer) > 0 {
+		if w.clock.Now().Sub(w.lastFlush) >= w.timeout && len(w.buffer) > 0 {
 			_ = w.flushLocked() // Ignore error as this is a background routine
 		}
 		w.mu.Unlock()
@@ -86,6 +112,6 @@ func (w *bufferedFileWriter) flushLocked() error {
 	}
 
 	w.buffer = w.buffer[:0] // Clear buffer but keep capacity
-	w.lastFlush = time.Now()
+	w.lastFlush = w.clock.Now()
 	return nil
 }